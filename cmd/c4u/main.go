@@ -18,11 +18,13 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"time"
 
 	"github.com/facebook/time/ptp/c4u"
 	"github.com/facebook/time/ptp/c4u/clock"
 	"github.com/facebook/time/ptp/c4u/stats"
+	"github.com/facebook/time/ptp/policy"
 	ptp "github.com/facebook/time/ptp/protocol"
 	log "github.com/sirupsen/logrus"
 )
@@ -34,6 +36,8 @@ func main() {
 		interval            time.Duration
 		lockBaseLine        time.Duration
 		logLevel            string
+		mappingFile         string
+		policyFile          string
 		monitoringPort      int
 		once                bool
 		sample              int
@@ -44,15 +48,19 @@ func main() {
 	flag.BoolVar(&once, "once", false, "Run once and exit")
 	flag.StringVar(&c.Path, "path", "/etc/ptp4u.yaml", "Path to a config file")
 	flag.StringVar(&c.Pid, "ptp4u", "/var/run/ptp4u.pid", "Path to a ptp4u pid file")
-	flag.StringVar(&c.AccuracyExpr, "accuracyExpr", "abs(mean(phcoffset)) + 3 * stddev(phcoffset) + abs(mean(oscillatoroffset)) + 3 * stddev(oscillatoroffset)", "Math to calculate clock accuracy")
-	flag.StringVar(&c.ClassExpr, "classExpr", "p99(oscillatorclass)", "Math to calculate clock class")
+	flag.StringVar(&c.AccuracyExpr, "accuracyExpr", c4u.DefaultAccuracyExpr, "Math to calculate clock accuracy")
+	flag.StringVar(&c.ClassExpr, "classExpr", c4u.DefaultClassExpr, "Math to calculate clock class")
 	flag.IntVar(&sample, "sample", 600, "Sliding window size (samples) for clock data calculations")
 	flag.DurationVar(&interval, "interval", time.Second, "Data cata collection interval")
 	flag.StringVar(&logLevel, "loglevel", "info", "Set a log level. Can be: debug, info, warning, error")
 	flag.IntVar(&monitoringPort, "monitoringport", 8889, "Port to run monitoring server on")
-	flag.DurationVar(&lockBaseLine, "lockBaseLine", 100*time.Nanosecond, "Minimum value for ClockClass in LOCK state")
-	flag.DurationVar(&holdoverBaseLine, "holdoverBaseLine", time.Microsecond, "Minimum value for ClockClass in HOLDOVER state")
-	flag.DurationVar(&calibratingBaseLine, "calibratingBaseLine", 250*time.Nanosecond, "Minimum value for ClockClass in CALIBRATING state")
+	flag.DurationVar(&lockBaseLine, "lockBaseLine", c4u.DefaultLockBaseLine, "Minimum value for ClockClass in LOCK state")
+	flag.DurationVar(&holdoverBaseLine, "holdoverBaseLine", c4u.DefaultHoldoverBaseLine, "Minimum value for ClockClass in HOLDOVER state")
+	flag.DurationVar(&calibratingBaseLine, "calibratingBaseLine", c4u.DefaultCalibratingBaseLine, "Minimum value for ClockClass in CALIBRATING state")
+	flag.StringVar(&c.LostPolicy, "lostPolicy", c4u.PolicyFailover, fmt.Sprintf("What to advertise when the upstream reference is lost. Can be: %s, %s", c4u.PolicyFailover, c4u.PolicyHoldover))
+	flag.DurationVar(&c.HoldoverTimeout, "holdoverTimeout", time.Hour, "How long to advertise HOLDOVER after the reference is lost before degrading. Used by holdover policy")
+	flag.StringVar(&mappingFile, "mapping", "", "Path to a table mapping offsets and holdover time to the advertised clock quality. Overrides RFC 8173 accuracy thresholds and the holdover timeout")
+	flag.StringVar(&policyFile, "policy", "", "Path to a policy with quality rules overriding the calculated clock quality. Disabled if empty")
 	flag.Parse()
 
 	switch logLevel {
@@ -68,10 +76,32 @@ func main() {
 		log.Fatalf("Unrecognized log level: %v", logLevel)
 	}
 
+	switch c.LostPolicy {
+	case c4u.PolicyFailover, c4u.PolicyHoldover:
+	default:
+		log.Fatalf("Unrecognized lost reference policy: %v", c.LostPolicy)
+	}
+
 	c.LockBaseLine = ptp.ClockAccuracyFromOffset(lockBaseLine)
 	c.HoldoverBaseLine = ptp.ClockAccuracyFromOffset(holdoverBaseLine)
 	c.CalibratingBaseLine = ptp.ClockAccuracyFromOffset(calibratingBaseLine)
 
+	if mappingFile != "" {
+		m, err := clock.ReadMapping(mappingFile)
+		if err != nil {
+			log.Fatalf("Failed to read the clock quality mapping: %v", err)
+		}
+		c.Mapping = m
+	}
+
+	if policyFile != "" {
+		p, err := policy.Read(policyFile)
+		if err != nil {
+			log.Fatalf("Failed to read the policy: %v", err)
+		}
+		c.Policy = p
+	}
+
 	if once {
 		sample = 1
 	}
@@ -22,9 +22,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/facebook/time/fbclock/daemon"
+	"github.com/facebook/time/fbclock/ring"
 	ptp "github.com/facebook/time/ptp/protocol"
 
 	log "github.com/sirupsen/logrus"
@@ -59,6 +62,11 @@ func main() {
 	flag.StringVar(&cfg.Math.Drift, "drift", daemon.MathDefaultDrift, "Math expression for Drift PPB")
 	flag.DurationVar(&cfg.Interval, "i", time.Second, "Interval at which we talk to PTP client and update data in shm")
 	flag.DurationVar(&cfg.LinearizabilityTestInterval, "I", time.Minute, "Interval at which we run linearizability tests. 0 means disabled.")
+	flag.StringVar(&cfg.HistoryBackend, "historybackend", daemon.HistoryMemory, "Where measurement history is kept: memory, file or sqlite. Use memory on read-only root")
+	flag.StringVar(&cfg.HistoryPath, "historypath", "", "Path to the history file or database of the file and sqlite backends")
+	flag.DurationVar(&cfg.HistoryRetention, "historyretention", 0, "How long the file and sqlite backends keep measurements on top of the ring buffer size")
+	flag.StringVar(&cfg.EventRingPath, "eventring", "", fmt.Sprintf("Publish every measurement with its error bound to the shared memory ring at this path, e.g. %s. Disabled if empty", ring.DefaultPath))
+	flag.IntVar(&cfg.EventRingSize, "eventringsize", 4096, "Number of measurements the event ring keeps")
 
 	flag.StringVar(&cfgPath, "cfg", "", "Path to config")
 	flag.BoolVar(&manageDevice, "manage", true, fmt.Sprintf("Manage device. This will setup %q as a copy of PHC device associated with given network interface", daemon.ManagedPTPDevicePath))
@@ -122,7 +130,9 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	ctx := context.Background()
+	// stop on termination, so the measurement history is closed
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	if err := s.Run(ctx); err != nil {
 		log.Fatal(err)
 	}
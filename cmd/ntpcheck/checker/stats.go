@@ -38,6 +38,12 @@ type NTPStats struct {
 	PeerCount   int     `json:"ntp.peer.count"`     // number of upstream peers
 }
 
+// NTPStatsLegacy is NTPStats with the system.ntp_stat value kept for backwards compatibility
+type NTPStatsLegacy struct {
+	NTPStats
+	SystemNTPStat float64 `json:"system.ntp_stat"`
+}
+
 // NewNTPStats constructs NTPStats from NTPCheckResult
 func NewNTPStats(r *NTPCheckResult) (*NTPStats, error) {
 	if r.SysVars == nil {
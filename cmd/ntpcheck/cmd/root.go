@@ -32,9 +32,11 @@ var RootCmd = &cobra.Command{
 
 var verbose bool
 var server string
+var schemaOutput bool
 
 func init() {
 	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	RootCmd.PersistentFlags().BoolVarP(&schemaOutput, "schema", "", false, "print JSON schema of the command output instead of running it")
 }
 
 // ConfigureVerbosity configures log verbosity based on parsed flags. Needs to be called by any subcommand.
@@ -0,0 +1,69 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/facebook/time/cmd/ntpcheck/checker"
+	"github.com/facebook/time/jsonschema"
+)
+
+//go:generate go test -run TestSchemaFiles -update-schemas
+
+// schemaDir keeps the published schema files, relative to this package
+const schemaDir = "../schema"
+
+// outputSchemas are schemas of the JSON output by command.
+// Version has to be bumped on any incompatible change of the output
+var outputSchemas = map[*cobra.Command]*jsonschema.Schema{
+	statsCmd: jsonschema.New("ntpcheck/stats", 1, "NTP system peer and clock stats, with system.ntp_stat if run with --legacy",
+		jsonschema.AnyOf(jsonschema.Reflect(checker.NTPStats{}), jsonschema.Reflect(checker.NTPStatsLegacy{}))),
+	peerstatsCmd: jsonschema.New("ntpcheck/peerstats", 1, "NTP stats of every peer, keyed by the peer hostname with dots and colons replaced by underscores",
+		jsonschema.Pattern(`^ntp\.peers\.[^.]+\.(delay|poll|jitter|offset|stratum)$`, float64(0))),
+	serverStatsCmd: jsonschema.New("ntpcheck/serverstats", 1, "NTP server packet counters",
+		jsonschema.Reflect(checker.ServerStats{})),
+}
+
+// with --schema the commands print the schema of their output instead of running
+func init() {
+	for c, s := range outputSchemas {
+		run, s := c.Run, s
+		c.Run = func(c *cobra.Command, args []string) {
+			if !schemaOutput {
+				run(c, args)
+				return
+			}
+			if err := printSchema(s); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// printSchema prints the schema document
+func printSchema(s *jsonschema.Schema) error {
+	b, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(b))
+	return nil
+}
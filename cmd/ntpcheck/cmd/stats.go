@@ -28,17 +28,12 @@ import (
 )
 
 func printStats(r *checker.NTPCheckResult, legacy bool) error {
-	type ntpStatsLegacy struct {
-		checker.NTPStats
-		SystemNTPStat float64 `json:"system.ntp_stat"`
-	}
-
 	output, err := checker.NewNTPStats(r)
 	if err != nil {
 		return err
 	}
 	if legacy {
-		extraOutput := ntpStatsLegacy{
+		extraOutput := checker.NTPStatsLegacy{
 			NTPStats:      *output,
 			SystemNTPStat: math.Abs(output.Offset),
 		}
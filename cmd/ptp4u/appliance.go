@@ -0,0 +1,39 @@
+//go:build appliance
+// +build appliance
+
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	_ "embed"
+
+	"github.com/facebook/time/leapsectz"
+	"github.com/facebook/time/ptp/ptp4u/server"
+)
+
+//go:embed appliance.yaml
+var applianceConfig []byte
+
+// profile of timing appliances: interface is detected, leap seconds
+// are built in and the default config is embedded into the binary
+var profile = buildProfile{
+	name:     "appliance",
+	iface:    server.IfaceAuto,
+	leapFile: leapsectz.BuiltinFile,
+	config:   applianceConfig,
+}
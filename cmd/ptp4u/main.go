@@ -17,51 +17,165 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/facebook/time/leapsectz"
+	"github.com/facebook/time/ptp/c4u"
+	"github.com/facebook/time/ptp/policy"
 	"github.com/facebook/time/ptp/ptp4u/drain"
+	"github.com/facebook/time/ptp/ptp4u/events"
+	"github.com/facebook/time/ptp/ptp4u/seccomp"
 	"github.com/facebook/time/ptp/ptp4u/server"
+	"github.com/facebook/time/ptp/ptp4u/shmstats"
 	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/ptp/sptp/client"
+	"github.com/facebook/time/ptp/unified"
 	"github.com/facebook/time/timestamp"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Set reasonable defaults for Dynamic config
-	c := &server.Config{
-		DynamicConfig: server.DynamicConfig{
-			ClockAccuracy:  0x21,
-			ClockClass:     6,
-			DrainInterval:  30 * time.Second,
-			MaxSubDuration: 1 * time.Hour,
-			MetricInterval: 1 * time.Minute,
-			MinSubInterval: 1 * time.Second,
-			UTCOffset:      37 * time.Second,
-		},
-	}
+	c := &server.Config{StaticConfig: server.DefaultStaticConfig(), DynamicConfig: server.DefaultDynamicConfig()}
 
 	var ipaddr string
+	var listeners string
+	var simEpoch string
+	var peers string
+	var ntpServers string
+	var canaryTargets string
+	var fpsCaps string
+	var sptpConfig string
+	uc := &unified.Config{Quality: c4u.NewConfig()}
+	var statsdTags string
+	var traceLog bool
+	var detect bool
+	var eventFlowLabel uint
+	var generalFlowLabel uint
+	var priority1 uint
+	var priority2 uint
+	var upstreamDomain int
 
+	flag.BoolVar(&c.WorkerCPUStats, "workercpustats", false, "Report CPU time used by each send worker and its pipeline phases. Pins workers to OS threads")
+	flag.BoolVar(&c.ECN, "ecn", true, "Send Sync packets ECN capable and count DelayReqs received with the Congestion Experienced mark. Disable where middleboxes mishandle ECN")
+	flag.DurationVar(&c.FollowUpBudget, "followupbudget", 0, "Maximum delay between sending Sync and its Follow Up. TX timestamps not read in time are handled by -followuppolicy. 0 waits for the TX timestamp")
+	flag.StringVar(&c.FollowUpPolicy, "followuppolicy", server.FollowUpSkip, fmt.Sprintf("What to do when the TX timestamp misses -followupbudget. Can be: %s to drop the Follow Up, %s to send it with a software timestamp flagged by a TLV, %s to send the Sync again", server.FollowUpSkip, server.FollowUpSoftware, server.FollowUpResend))
+	flag.StringVar(&fpsCaps, "fpscap", "", "Comma separated list of type:pps caps of the Sync and Announce packets sent to all subscriptions, e.g. sync:50000. Intervals of the type are stretched proportionally when its subscriptions ask for more. No caps if empty")
+	flag.IntVar(&c.FPSGlobalCap, "fpsglobalcap", 0, "Cap of all Sync, Follow Up and Announce packets per second sent to all subscriptions. Intervals of all types are stretched proportionally when exceeded. 0 disables the cap")
+	flag.BoolVar(&c.GrantHints, "granthints", false, "Honor the grant duration hinted by clients in the grant hint TLV, up to the max subscription duration")
+	flag.DurationVar(&c.GrantHintMinAge, "granthintminage", 10*time.Minute, "How long a subscription has to run before its grant hint is honored")
+	flag.IntVar(&c.EventHopLimit, "eventhoplimit", 0, "IPv6 hop limit of Sync packets. 0 keeps the system default")
+	flag.IntVar(&c.GeneralHopLimit, "generalhoplimit", 0, "IPv6 hop limit of Announce, Follow Up, Delay Response and Signaling packets. 0 keeps the system default")
+	flag.UintVar(&eventFlowLabel, "eventflowlabel", 0, "IPv6 flow label of Sync packets, for deterministic paths in fabrics hashing on flow label. 0 keeps the kernel assigned labels")
+	flag.UintVar(&generalFlowLabel, "generalflowlabel", 0, "IPv6 flow label of Announce, Follow Up, Delay Response and Signaling packets. 0 keeps the kernel assigned labels")
 	flag.IntVar(&c.DSCP, "dscp", 0, "DSCP for PTP packets, valid values are between 0-63 (used by send workers)")
+	flag.Float64Var(&c.LogRate, "lograte", 1, "Per client and error class log lines per second. Suppressed lines are summarized every metric interval. 0 disables the limit")
+	flag.IntVar(&c.LogBurst, "logburst", 10, "Per client and error class log burst")
+	flag.StringVar(&c.EventsURL, "eventsurl", "", "Webhook to POST significant events to as JSON arrays. Disabled if empty")
+	flag.IntVar(&c.TimelineSize, "timeline", events.DefaultTimeline, "Keep this many recent significant events in memory, served on /timeline of the monitoring port. 0 disables")
+	flag.IntVar(&c.EventsBatchSize, "eventsbatch", 100, "Maximum number of events in one webhook request")
+	flag.DurationVar(&c.EventsFlushInterval, "eventsflush", 10*time.Second, "Maximum delay before the queued events are sent")
 	flag.IntVar(&c.MonitoringPort, "monitoringport", 8888, "Port to run monitoring server on")
+	flag.IntVar(&c.GNMIPort, "gnmiport", 0, "Port to serve the stats over gNMI on. Disabled if 0")
+	flag.StringVar(&c.GNMITLSCert, "gnmitlscert", "", "TLS certificate of the gNMI server. Plain text if empty")
+	flag.StringVar(&c.GNMITLSKey, "gnmitlskey", "", "TLS key of the gNMI server")
+	flag.IntVar(&c.ClientStatsLimit, "clientstats", 0, "Keep per client counters of up to this many clients, served as top talkers on /clients of the monitoring port. 0 disables")
+	flag.IntVar(&c.StatsHistory, "statshistory", stats.DefaultHistory, "Keep this many stats snapshots in memory, served on /history of the monitoring port with the difference of the last two on /delta. 0 disables")
+	flag.StringVar(&c.MonitoringBackend, "monitoringbackend", stats.BackendJSON, fmt.Sprintf("Monitoring backend. %s serves JSON on /, %s serves Prometheus metrics on /metrics, %s pushes to -statsdaddr and serves JSON on /", stats.BackendJSON, stats.BackendPrometheus, stats.BackendStatsD))
+	flag.StringVar(&c.StatsD.Addr, "statsdaddr", "localhost:8125", "host:port of the StatsD agent to push stats to")
+	flag.StringVar(&c.StatsD.Prefix, "statsdprefix", "ptp4u.", "Prefix of the metric names pushed to StatsD")
+	flag.StringVar(&statsdTags, "statsdtags", "", "Comma separated list of key:value tags added to every metric pushed to StatsD. Requires -dogstatsd")
+	flag.BoolVar(&c.StatsD.DogStatsD, "dogstatsd", true, "Push to StatsD in the DogStatsD format with labels as tags. Plain StatsD gets labels appended to the metric names")
+	flag.DurationVar(&c.StatsD.FlushInterval, "statsdflush", 10*time.Second, "Interval of pushing stats to StatsD")
+	flag.DurationVar(&c.ReportIntervals.JSON, "jsoninterval", 0, "Snapshot interval of the stats served as JSON by the json and statsd backends. 0 uses the metricinterval of the dynamic config")
+	flag.DurationVar(&c.ReportIntervals.Prometheus, "prometheusinterval", 0, "Snapshot interval of the prometheus backend. 0 uses the metricinterval of the dynamic config")
+	flag.BoolVar(&c.ReportIntervals.PrometheusOnScrape, "prometheusonscrape", false, "Take a fresh snapshot on every scrape of /metrics on top of the periodic ones")
+	flag.StringVar(&ntpServers, "ntpservers", "", "Comma separated list of NTP servers to cross-check served time against. Disabled if empty")
+	flag.StringVar(&canaryTargets, "canary", "", fmt.Sprintf("Comma separated list of canary subscription targets, %s for the server itself or responder hosts receiving Syncs. Alarms when the send path exceeds the budgets. Disabled if empty", server.CanarySelf))
+	flag.DurationVar(&c.CanaryInterval, "canaryinterval", time.Second, "Sync interval of the canary subscriptions")
+	flag.DurationVar(&c.CanaryTXTSBudget, "canarytxtsbudget", 10*time.Millisecond, "Maximum time to read the TX timestamp of a canary Sync before raising the alarm. 0 disables the check")
+	flag.DurationVar(&c.CanaryCadenceBudget, "canarycadencebudget", 100*time.Millisecond, "Maximum deviation of the time between canary Syncs from -canaryinterval before raising the alarm. 0 disables the check")
+	flag.DurationVar(&c.NTPCheckInterval, "ntpinterval", time.Minute, "Interval of the NTP cross-check")
+	flag.DurationVar(&c.NTPMaxOffset, "ntpmaxoffset", 100*time.Millisecond, "Maximum offset of served time from NTP before raising the alarm")
+	flag.DurationVar(&c.UTCOffsetCheckInterval, "utcoffsetcheck", time.Minute, "Interval of checking advertised UTC offset against the kernel TAI offset and the leap second file. 0 disables the check")
+	flag.StringVar(&c.LeapFile, "leapfile", profile.leapFile, fmt.Sprintf("Leap second file for the UTC offset check and leap second handling, time zone file or leap-seconds.list. %s for the built-in table, system default if empty", leapsectz.BuiltinFile))
+	flag.StringVar(&c.AltTimeZone, "alttimezone", "", "Time zone to announce in the ALTERNATE_TIME_OFFSET_INDICATOR TLV, such as America/Los_Angeles. DST transitions are followed automatically. Not announced if empty")
+	flag.DurationVar(&c.AltTimeZoneInterval, "alttimezoneinterval", time.Minute, "Interval of checking the time zone database for updates of -alttimezone")
+	flag.DurationVar(&c.LeapInterval, "leapinterval", 0, "Interval of re-reading the leap second file. Announces upcoming leap seconds and flips the UTC offset when they occur. 0 keeps the UTC offset of the config")
+	flag.DurationVar(&c.LeapSmear, "leapsmear", 0, "Smear leap seconds into the served time over this period before they occur instead of announcing and stepping them. Requires -leapinterval")
+	flag.DurationVar(&c.ClockClassDwell, "clockclassdwell", 0, "Minimum time between announced clock class changes. Degradation is ramped one class per dwell, recovery waits for the class to be stable for dwell. 0 disables debouncing")
+	flag.IntVar(&c.PeerPort, "peerport", 0, "Port to exchange time statements with peer ptp4u instances on. Disabled if 0")
+	flag.DurationVar(&c.PeerInterval, "peerinterval", 10*time.Second, "Interval of sending time statements to peers")
+	flag.DurationVar(&c.PeerMaxOffset, "peermaxoffset", time.Millisecond, "Maximum offset from the majority of peers before degrading")
+	flag.StringVar(&c.PeerKeyFile, "peerkey", "", "File with the shared key peer statements are signed with")
+	flag.StringVar(&peers, "peers", "", "Comma separated list of peer host:port")
+	flag.IntVar(&c.TunnelPort, "tunnelport", 0, "Port of the experimental PTP over TCP/TLS listener for monitoring. Disabled if 0")
+	flag.DurationVar(&c.RollbackWindow, "rollbackwindow", time.Minute, "Roll back to the previous dynamic config if health checks fail within this window after reload. 0 disables rollback")
+	flag.IntVar(&c.IdleSubscriptions, "idlesubs", 0, "Wake up to this many subscriptions from a single sleeping scheduler instead of a ticker per subscription. Cuts idle CPU of small deployments. 0 disables")
+	flag.BoolVar(&c.PathDelay, "pathdelay", false, "Estimate client to server delay from DelayReqs of the clients synchronized to this server and export percentiles per client prefix")
+	flag.IntVar(&c.PathDelayPrefix4, "pathdelayprefix4", 24, "IPv4 prefix length the path delay is aggregated by")
+	flag.IntVar(&c.PathDelayPrefix6, "pathdelayprefix6", 64, "IPv6 prefix length the path delay is aggregated by")
+	flag.StringVar(&c.QuirksFile, "quirks", "", "Path to a table of NIC model specific hardware timestamp latencies. No correction if empty")
 	flag.IntVar(&c.QueueSize, "queue", 0, "Size of the queue to send out packets")
-	flag.IntVar(&c.RecvWorkers, "recvworkers", 10, "Set the number of receive workers")
-	flag.IntVar(&c.SendWorkers, "workers", 100, "Set the number of send workers")
+	flag.IntVar(&c.RecvWorkers, "recvworkers", 0, "Set the number of receive workers. 0 runs one per NIC RX queue, at most one per CPU")
+	flag.IntVar(&c.SendWorkers, "workers", 0, "Set the number of send workers. 0 sizes them from the CPUs, NIC TX queues and -expectedsubscriptions")
+	flag.IntVar(&c.ExpectedSubscriptions, "expectedsubscriptions", 0, "Subscriptions the send workers are sized for when -workers is 0")
+	flag.IntVar(&c.SubscriptionsPerWorker, "subscriptionsperworker", server.DefaultSubscriptionsPerWorker, "Subscriptions a send worker is sized for when -workers is 0")
 	flag.UintVar(&c.DomainNumber, "domainnumber", 0, "Set the PTP domain by its number. Valid values are [0-255]")
 	flag.StringVar(&c.ConfigFile, "config", "", "Path to a config with dynamic settings")
+	flag.DurationVar(&c.ConfigWatchInterval, "configwatch", 0, "How often to check the config file for changes and reload it. 0 disables watching, SIGHUP still works")
+	flag.StringVar(&c.ConfigTokenFile, "configtoken", "", "Path to a file with a token authorizing config changes and graceful drain via /config and /drain on the monitoring port. Disabled if empty")
 	flag.StringVar(&c.DebugAddr, "pprofaddr", "", "host:port for the pprof to bind")
-	flag.StringVar(&c.Interface, "iface", "eth0", "Set the interface")
+	flag.StringVar(&c.DebugTapFile, "debugtap", "", "Write sampled delay requests and the responses to this pcapng file, with worker id, queue delay and TX timestamp attempts in the packet comments. Disabled if empty")
+	flag.IntVar(&c.DebugTapSample, "debugtapsample", 1000, "Write one in this many delay requests to the debug tap")
+	flag.Int64Var(&c.DebugTapMaxSize, "debugtapmaxsize", 100<<20, "Stop the debug tap once the file reaches this many bytes. 0 means no limit")
+	flag.StringVar(&c.Interface, "iface", profile.iface, fmt.Sprintf("Set the interface. %s picks the first interface with a global unicast IP, and a PHC for hardware timestamps", server.IfaceAuto))
+	flag.BoolVar(&detect, "firstrun", false, "Detect the interface, write the default dynamic config to -config unless it exists, print the flags to run with and exit")
 	flag.StringVar(&c.LogLevel, "loglevel", "warning", "Set a log level. Can be: debug, info, warning, error")
+	flag.BoolVar(&traceLog, "tracelog", false, "Log trace spans of signaling requests from grant decision to the first sends. Requires info log level")
+	flag.StringVar(&c.MgmtSocket, "mgmtsocket", "/var/run/ptp4u.sock", "Unix socket to serve the management API used by ptp4uctl on. Disabled if empty")
+	flag.IntVar(&c.ShutdownCancelRate, "shutdowncancelrate", 1000, "Subscriptions cancelled per second on shutdown. 0 means no limit")
+	flag.DurationVar(&c.ShutdownTimeout, "shutdowntimeout", 30*time.Second, "Maximum time to notify the clients on shutdown")
+	flag.IntVar(&c.RcvBufMax, "rcvbufmax", 32<<20, "Maximum size in bytes the event and general socket receive buffers can grow to when packets are dropped. 0 disables growing")
+	flag.BoolVar(&c.Standby, "standby", false, "Receive and process traffic, but never transmit. Soak step for new instances")
+	flag.StringVar(&c.Seccomp, "seccomp", "", fmt.Sprintf("Restrict syscalls with a seccomp filter once initialized. Can be: %s to kill the process on a forbidden syscall, %s to only log it. Empty disables the filter", seccomp.ModeStrict, seccomp.ModeLog))
+	flag.StringVar(&c.ShmStatsFile, "shmstats", "", fmt.Sprintf("Memory-mapped file to publish the live counters to for local readers, e.g. %s. Disabled if empty", shmstats.DefaultPath))
+	flag.DurationVar(&c.ShmStatsInterval, "shmstatsinterval", 100*time.Millisecond, "How often the live counters are published to the memory-mapped file")
+	flag.BoolVar(&c.KernelTXTrace, "kerneltxtrace", false, "Trace the in-kernel latency from sending an event message until its TX timestamp is reported with eBPF. Needs ptp4u built with the ebpf tag")
+	flag.IntVar(&c.MTU, "mtu", 0, "Path MTU. Packets which don't fit are not sent, signaling is split. 0 means interface MTU")
 	flag.StringVar(&c.PidFile, "pidfile", "/var/run/ptp4u.pid", "Pid file location")
+	flag.StringVar(&c.TenantsFile, "tenants", "", "Path to a file with tenants. Reloaded on SIGHUP. No tenants if empty")
+	flag.UintVar(&priority1, "priority1", 128, "Priority1 announced when the server is the grandmaster. Lower is preferred by clients. priority1 of the dynamic config overrides it")
+	flag.UintVar(&priority2, "priority2", 128, "Priority2 announced when the server is the grandmaster. Lower is preferred by clients. priority2 of the dynamic config overrides it")
+	flag.StringVar(&c.PolicyFile, "policy", "", "Path to a policy with grant rules deciding the requests, and quality rules overriding the clock quality in unified mode. Reloaded on SIGHUP. Disabled if empty")
+	flag.StringVar(&c.ACLFile, "acl", "", "Path to a file with client prefixes allowed and denied to subscribe and per client limits. Reloaded on SIGHUP. Everyone is allowed if empty")
+	flag.StringVar(&c.AuthFile, "auth", "", "Path to a file with the keys to authenticate messages with the AUTHENTICATION TLV. Reloaded on SIGHUP. Disabled if empty")
+	flag.StringVar(&c.BlocklistFile, "blocklist", "", "Path to a file with blocked client prefixes. Reloaded on SIGHUP and updated by ptp4uctl block. Blocklist is kept in memory only if empty")
+	flag.StringVar(&c.TunnelCertFile, "tunnelcert", "", "TLS certificate of the tunnel listener. Plain TCP if empty")
+	flag.StringVar(&c.TunnelKeyFile, "tunnelkey", "", "TLS key of the tunnel listener. Plain TCP if empty")
 	flag.StringVar(&c.TimestampType, "timestamptype", timestamp.HWTIMESTAMP, fmt.Sprintf("Timestamp type. Can be: %s, %s", timestamp.HWTIMESTAMP, timestamp.SWTIMESTAMP))
+	flag.StringVar(&c.TimeSource, "timesource", "", fmt.Sprintf("Time source to serve. Can be: %s, %s, %s. Derived from timestamp type if empty", server.TimeSourcePHC, server.TimeSourceSysClock, server.TimeSourceSimulated))
+	flag.StringVar(&simEpoch, "simepoch", "", "RFC3339 start time of the simulated time source. Current time if empty")
+	flag.Float64Var(&c.TimeRate, "timerate", 1, "How many times faster than the wall clock the simulated time runs. Schedulers and expiry follow the accelerated time, for long-horizon tests only")
 	flag.StringVar(&ipaddr, "ip", "::", "IP to bind on")
+	flag.StringVar(&listeners, "listen", "", "Comma separated list of additional interface/ip[/dscp] to serve on next to -iface and -ip, e.g. eth1/10.0.1.1,eth2/2001:db8::1/46. DSCP defaults to -dscp")
 	flag.StringVar(&c.DrainFileName, "drainfile", "/var/tmp/kill_ptp4u", "ptp4u drain file location")
 	flag.StringVar(&c.UndrainFileName, "undrainfile", "/var/tmp/unkill_ptp4u", "ptp4u force undrain file location")
+	flag.StringVar(&c.UpstreamSocket, "upstream", "", "Boundary mode: ptp4l management socket to follow the grandmaster of, e.g. /var/run/ptp4l. Empty announces ptp4u as the grandmaster")
+	flag.IntVar(&upstreamDomain, "upstreamdomain", -1, "Boundary mode: PTP domain of ptp4l. Its time and clock quality are re-served on -domainnumber. -1 is the same as -domainnumber")
+	flag.DurationVar(&c.UpstreamInterval, "upstreaminterval", time.Second, "Interval of refreshing the upstream grandmaster in boundary mode")
+	flag.StringVar(&c.DualStackPolicy, "dualstack", server.DualStackMerge, fmt.Sprintf("Handling of a client subscribing via both IPv4 and IPv6. Can be: %s (subscription follows the latest address), %s (requests from the other IP family are denied)", server.DualStackMerge, server.DualStackFirst))
+	flag.StringVar(&sptpConfig, "sptpconfig", "", "Unified mode: sync the PHC from the upstream GMs of this sptp config and calculate the clock quality in-process instead of running sptp and c4u. Disabled if empty")
+	flag.DurationVar(&uc.QualityInterval, "qualityinterval", time.Second, "Interval of the clock quality calculation in unified mode")
+	flag.IntVar(&uc.QualitySample, "qualitysample", 600, "Sliding window size (samples) of the clock quality calculation in unified mode")
+	flag.StringVar(&c.WorkerAssignment, "assignment", server.AssignmentHash, fmt.Sprintf("Worker assignment of new clients. Can be: %s, %s", server.AssignmentHash, server.AssignmentLoad))
 	flag.Parse()
 
 	switch c.LogLevel {
@@ -77,22 +191,185 @@ func main() {
 		log.Fatalf("Unrecognized log level: %v", c.LogLevel)
 	}
 
+	// time source decides the socket timestamps, so the timestamp type the interface detection and the checks rely on follows it
+	if ts := server.TimestampTypeOf(c.TimeSource); ts != "" {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "timestamptype" && c.TimestampType != ts {
+				log.Fatalf("Time source %s uses %s timestamps, conflicting with timestamp type %s", c.TimeSource, ts, c.TimestampType)
+			}
+		})
+		c.TimestampType = ts
+	}
+
+	var dc *server.DynamicConfig
 	if c.ConfigFile != "" {
-		dc, err := server.ReadDynamicConfig(c.ConfigFile)
+		var err error
+		dc, err = server.ReadDynamicConfig(c.ConfigFile)
+		// first run creates the missing config
+		if detect && errors.Is(err, os.ErrNotExist) {
+			dc, err = nil, nil
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
+	}
+	if dc == nil && profile.config != nil {
+		var err error
+		dc, err = server.ParseDynamicConfig(profile.config)
+		if err != nil {
+			log.Fatalf("Invalid embedded config of the %s profile: %v", profile.name, err)
+		}
+	}
+	if dc != nil {
 		c.DynamicConfig = *dc
 	}
 
+	if c.AltTimeZone != "" && c.AltTimeZoneInterval <= 0 {
+		log.Fatalf("Unsupported time zone database check interval %v", c.AltTimeZoneInterval)
+	}
+	if c.LeapSmear < 0 || (c.LeapSmear > 0 && c.LeapInterval <= 0) {
+		log.Fatalf("Leap second smear %v requires positive -leapinterval", c.LeapSmear)
+	}
+
 	if c.DSCP < 0 || c.DSCP > 63 {
 		log.Fatalf("Unsupported DSCP value %v", c.DSCP)
 	}
 
+	for _, hops := range []int{c.EventHopLimit, c.GeneralHopLimit} {
+		if hops < 0 || hops > 255 {
+			log.Fatalf("Unsupported hop limit value %v", hops)
+		}
+	}
+	for _, label := range []uint{eventFlowLabel, generalFlowLabel} {
+		if label > server.MaxFlowLabel {
+			log.Fatalf("Unsupported flow label value %v", label)
+		}
+	}
+	c.EventFlowLabel = uint32(eventFlowLabel)
+	c.GeneralFlowLabel = uint32(generalFlowLabel)
+
+	if c.ExpectedSubscriptions < 0 {
+		log.Fatalf("Unsupported expected subscriptions %v", c.ExpectedSubscriptions)
+	}
+	if c.SubscriptionsPerWorker <= 0 {
+		log.Fatalf("Unsupported subscriptions per worker %v", c.SubscriptionsPerWorker)
+	}
+
 	if c.DomainNumber > 255 {
 		log.Fatalf("Unsupported DomainNumber value %v", c.DomainNumber)
 	}
 
+	if (c.TunnelCertFile == "") != (c.TunnelKeyFile == "") {
+		log.Fatalf("Both tunnel certificate and key are required for TLS")
+	}
+
+	if c.PeerPort != 0 {
+		if c.PeerKeyFile == "" {
+			log.Fatalf("Peer key is required to exchange statements with peers")
+		}
+		if peers == "" {
+			log.Fatalf("Peer list is required to exchange statements with peers")
+		}
+		c.Peers = strings.Split(peers, ",")
+	}
+
+	if ntpServers != "" {
+		c.NTPServers = strings.Split(ntpServers, ",")
+	}
+
+	if canaryTargets != "" {
+		if c.CanaryInterval <= 0 {
+			log.Fatalf("Unsupported canary interval %v", c.CanaryInterval)
+		}
+		c.CanaryTargets = strings.Split(canaryTargets, ",")
+		for _, t := range c.CanaryTargets {
+			// traffic to the server itself is looped back without hardware TX timestamps
+			if t == server.CanarySelf && c.TimestampType == timestamp.HWTIMESTAMP {
+				log.Fatalf("Canary target %s requires software timestamps", server.CanarySelf)
+			}
+		}
+	}
+
+	fps, err := server.ParseFPSCaps(fpsCaps)
+	if err != nil {
+		log.Fatalf("Failed to parse FPS caps: %v", err)
+	}
+	c.FPSCaps = fps
+	if priority1 >= 255 {
+		log.Fatalf("Unsupported priority1 %d, must be below 255", priority1)
+	}
+	if priority2 > 255 {
+		log.Fatalf("Unsupported priority2 %d, must be up to 255", priority2)
+	}
+	c.DefaultPriority1, c.DefaultPriority2 = uint8(priority1), uint8(priority2)
+	if c.DebugTapFile != "" && c.DebugTapSample <= 0 {
+		log.Fatalf("Unsupported debug tap sample %d, must be positive", c.DebugTapSample)
+	}
+	if c.DebugTapMaxSize < 0 {
+		log.Fatalf("Unsupported debug tap max size %d", c.DebugTapMaxSize)
+	}
+	if c.FPSGlobalCap < 0 {
+		log.Fatalf("Unsupported global FPS cap %d", c.FPSGlobalCap)
+	}
+
+	if statsdTags != "" {
+		c.StatsD.Tags = strings.Split(statsdTags, ",")
+	}
+
+	switch c.DualStackPolicy {
+	case server.DualStackMerge, server.DualStackFirst:
+		log.Debugf("Using %s dual-stack policy", c.DualStackPolicy)
+	default:
+		log.Fatalf("Unrecognized dual-stack policy: %s", c.DualStackPolicy)
+	}
+
+	if c.FollowUpBudget < 0 {
+		log.Fatalf("Unsupported Follow Up budget %v", c.FollowUpBudget)
+	}
+	switch c.FollowUpPolicy {
+	case server.FollowUpSkip, server.FollowUpSoftware, server.FollowUpResend:
+		log.Debugf("Using %s Follow Up policy", c.FollowUpPolicy)
+	default:
+		log.Fatalf("Unrecognized Follow Up policy: %s", c.FollowUpPolicy)
+	}
+
+	if c.UpstreamSocket != "" && c.UpstreamInterval <= 0 {
+		log.Fatalf("Unsupported upstream interval %v", c.UpstreamInterval)
+	}
+
+	switch {
+	case upstreamDomain < 0:
+		c.UpstreamDomain = c.DomainNumber
+	case upstreamDomain > 255:
+		log.Fatalf("Unsupported upstream domain %v", upstreamDomain)
+	default:
+		c.UpstreamDomain = uint(upstreamDomain)
+	}
+
+	if c.GrantHintMinAge < 0 {
+		log.Fatalf("Unsupported grant hint min age %v", c.GrantHintMinAge)
+	}
+	if (c.GNMITLSCert == "") != (c.GNMITLSKey == "") {
+		log.Fatalf("gNMI TLS needs both -gnmitlscert and -gnmitlskey")
+	}
+	if c.ShmStatsFile != "" && c.ShmStatsInterval <= 0 {
+		log.Fatalf("Unsupported shared memory stats interval %v", c.ShmStatsInterval)
+	}
+
+	switch c.Seccomp {
+	case "", seccomp.ModeStrict, seccomp.ModeLog:
+		log.Debugf("Using seccomp mode %q", c.Seccomp)
+	default:
+		log.Fatalf("Unrecognized seccomp mode: %s", c.Seccomp)
+	}
+
+	switch c.WorkerAssignment {
+	case server.AssignmentHash, server.AssignmentLoad:
+		log.Debugf("Using %s worker assignment", c.WorkerAssignment)
+	default:
+		log.Fatalf("Unrecognized worker assignment: %s", c.WorkerAssignment)
+	}
+
 	switch c.TimestampType {
 	case timestamp.SWTIMESTAMP:
 		log.Warning("Software timestamps greatly reduce the precision")
@@ -103,6 +380,43 @@ func main() {
 		log.Fatalf("Unrecognized timestamp type: %s", c.TimestampType)
 	}
 
+	switch c.TimeSource {
+	case "", server.TimeSourcePHC, server.TimeSourceSysClock:
+		if c.TimeRate != 1 {
+			log.Fatalf("Time rate %v requires the %s time source", c.TimeRate, server.TimeSourceSimulated)
+		}
+	case server.TimeSourceSimulated:
+		log.Warning("Simulated time source is for lab use only")
+		if c.TimeRate <= 0 {
+			log.Fatalf("Time rate must be positive, got %v", c.TimeRate)
+		}
+		if simEpoch != "" {
+			epoch, err := time.Parse(time.RFC3339, simEpoch)
+			if err != nil {
+				log.Fatalf("Invalid simulated epoch: %v", err)
+			}
+			c.SimulatedEpoch = epoch
+		}
+	default:
+		log.Fatalf("Unrecognized time source: %s", c.TimeSource)
+	}
+
+	if c.Interface == server.IfaceAuto {
+		iface, err := server.DetectIface(c.TimestampType == timestamp.HWTIMESTAMP)
+		if err != nil {
+			log.Fatalf("Failed to detect the interface: %v", err)
+		}
+		log.Infof("Detected interface %s", iface)
+		c.Interface = iface
+	}
+
+	if detect {
+		if err := firstRun(c, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	c.IP = net.ParseIP(ipaddr)
 	found, err := c.IfaceHasIP()
 	if err != nil {
@@ -111,6 +425,19 @@ func main() {
 	if !found {
 		log.Fatalf("IP '%s' is not found on interface '%s'", c.IP, c.Interface)
 	}
+	c.Listeners, err = server.ParseListeners(listeners, c.DSCP)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range c.Listeners {
+		found, err := l.HasIP()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !found {
+			log.Fatalf("IP '%s' is not found on interface '%s'", l.IP, l.Interface)
+		}
+	}
 
 	if c.DebugAddr != "" {
 		log.Warningf("Staring profiler on %s", c.DebugAddr)
@@ -123,7 +450,12 @@ func main() {
 
 	// Monitoring
 	// Replace with your implementation of Stats
-	st := stats.NewJSONStats()
+	st, err := stats.NewStats(c.MonitoringBackend, c.StatsD, c.ReportIntervals)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.SetClientsLimit(c.ClientStatsLimit)
+	st.SetHistorySize(c.StatsHistory)
 	go st.Start(c.MonitoringPort)
 
 	// drain check
@@ -135,6 +467,27 @@ func main() {
 		Stats:  st,
 		Checks: checks,
 	}
+	if traceLog {
+		s.Tracer = server.LogTracer{}
+	}
+
+	if sptpConfig != "" {
+		uc.Client, err = client.ReadConfig(sptpConfig)
+		if err != nil {
+			log.Fatalf("Failed to read the sptp config: %v", err)
+		}
+		if c.PolicyFile != "" {
+			uc.Quality.Policy, err = policy.Read(c.PolicyFile)
+			if err != nil {
+				log.Fatalf("Failed to read the policy: %v", err)
+			}
+		}
+		d := &unified.Daemon{Config: uc, Server: &s}
+		if err := d.Start(); err != nil {
+			log.Fatalf("Unified run failed: %v", err)
+		}
+		return
+	}
 
 	if err := s.Start(); err != nil {
 		log.Fatalf("Server run failed: %v", err)
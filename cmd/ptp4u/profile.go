@@ -0,0 +1,60 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/facebook/time/ptp/ptp4u/server"
+)
+
+// buildProfile holds the defaults which differ between build profiles
+type buildProfile struct {
+	// name of the profile
+	name string
+	// default interface
+	iface string
+	// default leap second file
+	leapFile string
+	// embedded dynamic config used when no config file is set
+	config []byte
+}
+
+// firstRun writes the dynamic config unless it already exists
+// and prints the flags to run ptp4u with on this host
+func firstRun(c *server.Config, w io.Writer) error {
+	if c.ConfigFile == "" {
+		return fmt.Errorf("config file is required for the first run")
+	}
+	if _, err := os.Stat(c.ConfigFile); errors.Is(err, os.ErrNotExist) {
+		if err := c.DynamicConfig.Write(c.ConfigFile); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "# wrote default dynamic config to %s\n", c.ConfigFile)
+	} else if err != nil {
+		return err
+	}
+	args := fmt.Sprintf("-iface %s -timestamptype %s -config %s", c.Interface, c.TimestampType, c.ConfigFile)
+	if c.LeapFile != "" {
+		args += fmt.Sprintf(" -leapfile %s", c.LeapFile)
+	}
+	fmt.Fprintln(w, args)
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/server"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var batchDryRunFlag bool
+
+func init() {
+	RootCmd.AddCommand(expireCmd)
+	RootCmd.AddCommand(regrantCmd)
+	RootCmd.AddCommand(purgeCmd)
+	for _, c := range []*cobra.Command{expireCmd, regrantCmd, purgeCmd} {
+		c.Flags().BoolVarP(&batchDryRunFlag, "dry-run", "n", false, "only report the affected subscriptions")
+	}
+}
+
+func printBatchReport(r *server.MgmtBatchReport) error {
+	if rootJSONFlag {
+		return printJSON(r)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"address", "identity", "type", "interval", "expires in", "worker"})
+	now := time.Now()
+	for _, s := range r.Subscriptions {
+		table.Append([]string{
+			s.Address,
+			s.Client,
+			s.Type,
+			s.Interval.String(),
+			s.Expire.Sub(now).Round(time.Second).String(),
+			fmt.Sprintf("%d", s.Worker),
+		})
+	}
+	table.Render()
+	verb := "affected"
+	if r.DryRun {
+		verb = "would be affected"
+	}
+	fmt.Printf("%s: %d subscriptions %s\n", r.Operation, len(r.Subscriptions), verb)
+	for _, c := range r.NotFound {
+		fmt.Printf("%s: no running sync or announce subscription of %s\n", r.Operation, c)
+	}
+	return nil
+}
+
+func batchRun(op string, b *server.MgmtBatch) error {
+	b.DryRun = batchDryRunFlag
+	r := &server.MgmtBatchReport{}
+	if err := mgmtRequest(http.MethodPost, "/batch/"+op, b, r); err != nil {
+		return err
+	}
+	return printBatchReport(r)
+}
+
+var expireCmd = &cobra.Command{
+	Use:   "expire <ip|prefix>",
+	Short: "Cancel all subscriptions of the clients within the IP or network",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if err := batchRun("expire", &server.MgmtBatch{Prefix: args[0]}); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var regrantCmd = &cobra.Command{
+	Use:   "regrant <interval> <ip|identity>...",
+	Short: "Change the interval of sync and announce subscriptions of the clients and re-grant them",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(_ *cobra.Command, args []string) {
+		interval, err := time.ParseDuration(args[0])
+		if err != nil {
+			log.Fatalf("Invalid interval %q: %v", args[0], err)
+		}
+		if err := batchRun("regrant", &server.MgmtBatch{Interval: interval, Clients: args[1:]}); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Remove finished subscriptions left in the send workers",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := batchRun("purge", &server.MgmtBatch{}); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/server"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	blockTTLFlag    time.Duration
+	blockReasonFlag string
+)
+
+func init() {
+	RootCmd.AddCommand(blocklistCmd)
+	RootCmd.AddCommand(blockCmd)
+	RootCmd.AddCommand(unblockCmd)
+	blockCmd.Flags().DurationVarP(&blockTTLFlag, "ttl", "t", time.Hour, "lift the block after this time. 0 blocks until unblocked")
+	blockCmd.Flags().StringVarP(&blockReasonFlag, "reason", "r", "", "note why the client is blocked")
+}
+
+func printBlocklist(list []server.BlockEntry) error {
+	if rootJSONFlag {
+		return printJSON(list)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"prefix", "expires in", "dropped", "reason"})
+	now := time.Now()
+	for _, e := range list {
+		expire := "never"
+		if !e.Expire.IsZero() {
+			expire = e.Expire.Sub(now).Round(time.Second).String()
+		}
+		table.Append([]string{e.Prefix, expire, fmt.Sprintf("%d", e.Dropped), e.Reason})
+	}
+	table.Render()
+	return nil
+}
+
+func blocklistRun(method, path string, body interface{}) error {
+	list := []server.BlockEntry{}
+	if err := mgmtRequest(method, path, body, &list); err != nil {
+		return err
+	}
+	return printBlocklist(list)
+}
+
+var blocklistCmd = &cobra.Command{
+	Use:   "blocklist",
+	Short: "List blocked clients",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := blocklistRun(http.MethodGet, "/blocklist", nil); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var blockCmd = &cobra.Command{
+	Use:   "block <ip|prefix>",
+	Short: "Silently drop requests of the client IP or network",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		b := &server.MgmtBlock{Prefix: args[0], TTL: blockTTLFlag, Reason: blockReasonFlag}
+		if err := blocklistRun(http.MethodPost, "/blocklist", b); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var unblockCmd = &cobra.Command{
+	Use:   "unblock <ip|prefix>",
+	Short: "Remove the client IP or network from the blocklist",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		q := url.Values{}
+		q.Set("prefix", args[0])
+		if err := blocklistRun(http.MethodDelete, "/blocklist?"+q.Encode(), nil); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,64 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+}
+
+func configRun() error {
+	c := map[string]interface{}{}
+	if err := mgmtRequest(http.MethodGet, "/config", nil, &c); err != nil {
+		return err
+	}
+	if rootJSONFlag {
+		return printJSON(c)
+	}
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"option", "value"})
+	for _, k := range keys {
+		table.Append([]string{k, fmt.Sprintf("%v", c[k])})
+	}
+	table.Render()
+	return nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Dump the running config",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := configRun(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,59 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/facebook/time/ptp/ptp4u/server"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(drainCmd)
+	RootCmd.AddCommand(undrainCmd)
+}
+
+func drainRun(method string) error {
+	st := &server.MgmtStatus{}
+	if err := mgmtRequest(method, "/drain", nil, st); err != nil {
+		return err
+	}
+	return printStatus(st)
+}
+
+var drainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Drain the server. Takes effect on the next drain check",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := drainRun(http.MethodPost); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var undrainCmd = &cobra.Command{
+	Use:   "undrain",
+	Short: "Release the drain requested by ptp4uctl. Other drain checks still apply",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := drainRun(http.MethodDelete); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,60 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/facebook/time/ptp/ptp4u/server"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(logLevelCmd)
+}
+
+func logLevelRun(args []string) error {
+	l := &server.MgmtLogLevel{}
+	var err error
+	if len(args) == 0 {
+		err = mgmtRequest(http.MethodGet, "/loglevel", nil, l)
+	} else {
+		err = mgmtRequest(http.MethodPut, "/loglevel", &server.MgmtLogLevel{Level: args[0]}, l)
+	}
+	if err != nil {
+		return err
+	}
+	if rootJSONFlag {
+		return printJSON(l)
+	}
+	fmt.Println(l.Level)
+	return nil
+}
+
+var logLevelCmd = &cobra.Command{
+	Use:   "loglevel [level]",
+	Short: "Print or change the log level. Can be: debug, info, warning, error",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if err := logLevelRun(args); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
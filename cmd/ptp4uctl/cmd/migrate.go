@@ -0,0 +1,114 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/facebook/time/ptp/linuxptp"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var migrateOutFlag string
+
+func init() {
+	RootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().StringVarP(&migrateOutFlag, "out", "o", ".", "directory to write ptp4u.yaml or sptp.yaml to")
+}
+
+func printMigrateReport(report []linuxptp.Finding) error {
+	if rootJSONFlag {
+		return printJSON(report)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"file", "section", "option", "value", "status", "note"})
+	for _, f := range report {
+		table.Append([]string{f.File, f.Section, f.Option, f.Value, f.Status, f.Note})
+	}
+	table.Render()
+	return nil
+}
+
+// writeYAML writes the config as YAML into the output directory
+func writeYAML(name string, config interface{}) (string, error) {
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(migrateOutFlag, name)
+	return path, os.WriteFile(path, b, 0644)
+}
+
+// migrateRun converts the linuxptp configs and returns the number of unsupported options
+func migrateRun(ptp4lPath, phc2sysPath string) (int, error) {
+	ptp4l, err := linuxptp.Read(ptp4lPath)
+	if err != nil {
+		return 0, err
+	}
+	var phc2sys *linuxptp.Config
+	if phc2sysPath != "" {
+		if phc2sys, err = linuxptp.Read(phc2sysPath); err != nil {
+			return 0, err
+		}
+	}
+	res, err := linuxptp.Convert(ptp4l, phc2sys)
+	if err != nil {
+		return 0, err
+	}
+	if err := printMigrateReport(res.Report); err != nil {
+		return 0, err
+	}
+	if res.Role == linuxptp.RoleServer {
+		path, err := writeYAML("ptp4u.yaml", res.Dynamic)
+		if err != nil {
+			return 0, err
+		}
+		log.Infof("Wrote dynamic config to %s, run: ptp4u -config %s %s", path, path, strings.Join(res.Flags(), " "))
+	} else {
+		path, err := writeYAML("sptp.yaml", res.Client)
+		if err != nil {
+			return 0, err
+		}
+		log.Infof("Wrote config to %s, run: sptp -config %s", path, path)
+	}
+	return res.Unsupported(), nil
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate <ptp4l.conf> [phc2sys.conf]",
+	Short: "Convert linuxptp configs into ptp4u or sptp config and report options without an equivalent",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(_ *cobra.Command, args []string) {
+		phc2sys := ""
+		if len(args) > 1 {
+			phc2sys = args[1]
+		}
+		unsupported, err := migrateRun(args[0], phc2sys)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if unsupported > 0 {
+			log.Warningf("%d options have no equivalent, review the report", unsupported)
+		}
+	},
+}
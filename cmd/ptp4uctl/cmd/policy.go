@@ -0,0 +1,87 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/facebook/time/ptp/policy"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyTestCmd)
+}
+
+func printPolicyResults(results []*policy.TestResult) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"test", "result", "got", "want", "error"})
+	for _, r := range results {
+		result := "PASS"
+		if !r.Passed() {
+			result = "FAIL"
+		}
+		errStr := ""
+		if r.Err != nil {
+			errStr = r.Err.Error()
+		}
+		table.Append([]string{r.Name, result, r.Got, r.Want, errStr})
+	}
+	table.Render()
+}
+
+// policyTestRun runs the tests of the policy file and returns the number of failed ones
+func policyTestRun(path string) (int, error) {
+	p, err := policy.Read(path)
+	if err != nil {
+		return 0, fmt.Errorf("reading policy: %w", err)
+	}
+	results := p.RunTests()
+	printPolicyResults(results)
+	failed := 0
+	for _, r := range results {
+		if !r.Passed() {
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with policy files offline",
+}
+
+var policyTestCmd = &cobra.Command{
+	Use:   "test <file>",
+	Short: "Validate the policy file and run its tests",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		failed, err := policyTestRun(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if failed > 0 {
+			log.Fatalf("%d policy tests failed", failed)
+		}
+	},
+}
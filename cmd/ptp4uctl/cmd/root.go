@@ -0,0 +1,115 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// RootCmd is a main entry point
+var RootCmd = &cobra.Command{
+	Use:   "ptp4uctl",
+	Short: "Control and inspect a running ptp4u",
+}
+
+// flags
+var rootSocketFlag string
+var rootJSONFlag bool
+var rootSchemaFlag bool
+
+func init() {
+	RootCmd.PersistentFlags().StringVarP(&rootSocketFlag, "socket", "S", "/var/run/ptp4u.sock", "ptp4u management socket")
+	RootCmd.PersistentFlags().BoolVarP(&rootJSONFlag, "json", "j", false, "print JSON instead of a table")
+	RootCmd.PersistentFlags().BoolVarP(&rootSchemaFlag, "schema", "", false, "print JSON schema of the command output instead of running it")
+}
+
+// Execute is the main entry point for CLI interface
+func Execute() {
+	if err := RootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// mgmtClient talks HTTP to the ptp4u management socket
+func mgmtClient(socket string) *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// mgmtRequest sends the request to the management API and decodes JSON reply into v
+func mgmtRequest(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		r = bytes.NewReader(js)
+	}
+	// host is ignored, connection always goes to the socket
+	req, err := http.NewRequest(method, "http://ptp4u"+path, r)
+	if err != nil {
+		return err
+	}
+	resp, err := mgmtClient(rootSocketFlag).Do(req)
+	if err != nil {
+		return fmt.Errorf("talking to ptp4u: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading reply: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ptp4u replied %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	// keep integers such as durations readable in untyped replies
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("unmarshaling reply: %w", err)
+	}
+	return nil
+}
+
+// printJSON prints v as indented JSON
+func printJSON(v interface{}) error {
+	js, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	fmt.Println(string(js))
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/server"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	atIDFlag             string
+	atClockClassFlag     uint8
+	atClockAccuracyFlag  uint8
+	atUTCOffsetFlag      time.Duration
+	atMinSubIntervalFlag time.Duration
+	atMaxSubDurationFlag time.Duration
+	atDrainFlag          bool
+	atUndrainFlag        bool
+)
+
+func init() {
+	RootCmd.AddCommand(scheduleCmd)
+	RootCmd.AddCommand(atCmd)
+	RootCmd.AddCommand(cancelCmd)
+	atCmd.Flags().StringVarP(&atIDFlag, "id", "i", "", "id of the change, derived from the time if empty")
+	atCmd.Flags().Uint8VarP(&atClockClassFlag, "clockclass", "c", 0, "clock class to announce")
+	atCmd.Flags().Uint8VarP(&atClockAccuracyFlag, "clockaccuracy", "a", 0, "clock accuracy to announce")
+	atCmd.Flags().DurationVarP(&atUTCOffsetFlag, "utcoffset", "u", 0, "UTC offset to announce")
+	atCmd.Flags().DurationVarP(&atMinSubIntervalFlag, "minsubinterval", "", 0, "minimum interval of sync and announce subscriptions")
+	atCmd.Flags().DurationVarP(&atMaxSubDurationFlag, "maxsubduration", "", 0, "maximum subscription duration")
+	atCmd.Flags().BoolVarP(&atDrainFlag, "drain", "d", false, "engage the graceful drain")
+	atCmd.Flags().BoolVarP(&atUndrainFlag, "undrain", "", false, "release the graceful drain")
+}
+
+// scheduledChanges describes what the change does
+func scheduledChanges(c *server.ScheduledChange) string {
+	changes := []string{}
+	if c.ClockClass != nil {
+		changes = append(changes, fmt.Sprintf("clockclass=%d", *c.ClockClass))
+	}
+	if c.ClockAccuracy != nil {
+		changes = append(changes, fmt.Sprintf("clockaccuracy=%d", *c.ClockAccuracy))
+	}
+	if c.UTCOffset != nil {
+		changes = append(changes, fmt.Sprintf("utcoffset=%v", *c.UTCOffset))
+	}
+	if c.MinSubInterval != nil {
+		changes = append(changes, fmt.Sprintf("minsubinterval=%v", *c.MinSubInterval))
+	}
+	if c.MaxSubDuration != nil {
+		changes = append(changes, fmt.Sprintf("maxsubduration=%v", *c.MaxSubDuration))
+	}
+	if c.Drain != nil {
+		changes = append(changes, fmt.Sprintf("drain=%v", *c.Drain))
+	}
+	return strings.Join(changes, " ")
+}
+
+func printSchedule(pending []server.ScheduledChange) error {
+	if rootJSONFlag {
+		return printJSON(pending)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"id", "at", "due in", "changes"})
+	now := time.Now()
+	for i := range pending {
+		c := &pending[i]
+		table.Append([]string{c.ID, c.At.UTC().Format(time.RFC3339), c.At.Sub(now).Round(time.Second).String(), scheduledChanges(c)})
+	}
+	table.Render()
+	return nil
+}
+
+func scheduleRun(method, path string, body interface{}) ([]server.ScheduledChange, error) {
+	pending := []server.ScheduledChange{}
+	if err := mgmtRequest(method, path, body, &pending); err != nil {
+		return nil, err
+	}
+	return pending, printSchedule(pending)
+}
+
+// parseScheduleTime parses RFC3339 time or a duration from now
+func parseScheduleTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time %q is neither RFC3339 nor a duration", s)
+	}
+	return at, nil
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "List config changes scheduled for a future time",
+	Run: func(_ *cobra.Command, _ []string) {
+		if _, err := scheduleRun(http.MethodGet, "/schedule", nil); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var atCmd = &cobra.Command{
+	Use:   "at <RFC3339 time|duration from now>",
+	Short: "Schedule a config change, e.g. switching the UTC offset at the leap second or draining for maintenance",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		at, err := parseScheduleTime(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := &server.ScheduledChange{ID: atIDFlag, At: at}
+		flags := cmd.Flags()
+		if flags.Changed("clockclass") {
+			class := ptp.ClockClass(atClockClassFlag)
+			c.ClockClass = &class
+		}
+		if flags.Changed("clockaccuracy") {
+			accuracy := ptp.ClockAccuracy(atClockAccuracyFlag)
+			c.ClockAccuracy = &accuracy
+		}
+		if flags.Changed("utcoffset") {
+			c.UTCOffset = &atUTCOffsetFlag
+		}
+		if flags.Changed("minsubinterval") {
+			c.MinSubInterval = &atMinSubIntervalFlag
+		}
+		if flags.Changed("maxsubduration") {
+			c.MaxSubDuration = &atMaxSubDurationFlag
+		}
+		if atDrainFlag && atUndrainFlag {
+			log.Fatal("--drain and --undrain are mutually exclusive")
+		}
+		if atDrainFlag || atUndrainFlag {
+			c.Drain = &atDrainFlag
+		}
+		before := []server.ScheduledChange{}
+		if err := mgmtRequest(http.MethodGet, "/schedule", nil, &before); err != nil {
+			log.Fatal(err)
+		}
+		pending, err := scheduleRun(http.MethodPost, "/schedule", c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if rootJSONFlag {
+			return
+		}
+		known := map[string]bool{}
+		for _, p := range before {
+			known[p.ID] = true
+		}
+		for _, p := range pending {
+			if !known[p.ID] {
+				fmt.Printf("cancel with: ptp4uctl cancel %s\n", p.ID)
+			}
+		}
+	},
+}
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel the scheduled config change",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		q := url.Values{}
+		q.Set("id", args[0])
+		if _, err := scheduleRun(http.MethodDelete, "/schedule?"+q.Encode(), nil); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/facebook/time/jsonschema"
+	"github.com/facebook/time/ptp/linuxptp"
+	"github.com/facebook/time/ptp/ptp4u/server"
+)
+
+//go:generate go test -run TestSchemaFiles -update-schemas
+
+// schemaDir keeps the published schema files, relative to this package
+const schemaDir = "../schema"
+
+// outputSchemas are schemas of the JSON output by command.
+// Version has to be bumped on any incompatible change of the output
+var outputSchemas = map[*cobra.Command]*jsonschema.Schema{
+	statusCmd: jsonschema.New("ptp4uctl/status", 1, "Server status, printed with --json. Also printed by drain and undrain",
+		jsonschema.Reflect(server.MgmtStatus{})),
+	subscriptionsCmd: jsonschema.New("ptp4uctl/subscriptions", 1, "Running subscriptions, printed with --json",
+		jsonschema.Reflect([]*server.MgmtSubscription{})),
+	blocklistCmd: jsonschema.New("ptp4uctl/blocklist", 1, "Blocked clients, printed with --json. Also printed by block and unblock",
+		jsonschema.Reflect([]server.BlockEntry{})),
+	logLevelCmd: jsonschema.New("ptp4uctl/loglevel", 1, "Server log level, printed with --json",
+		jsonschema.Reflect(server.MgmtLogLevel{})),
+	expireCmd: jsonschema.New("ptp4uctl/expire", 1, "Batch operation report, printed with --json. Also printed by regrant and purge",
+		jsonschema.Reflect(server.MgmtBatchReport{})),
+	scheduleCmd: jsonschema.New("ptp4uctl/schedule", 1, "Pending scheduled config changes, printed with --json. Also printed by at and cancel",
+		jsonschema.Reflect([]server.ScheduledChange{})),
+	migrateCmd: jsonschema.New("ptp4uctl/migrate", 1, "Report on the converted linuxptp options, printed with --json",
+		jsonschema.Reflect([]linuxptp.Finding{})),
+}
+
+// with --schema the commands print the schema of their output instead of running
+func init() {
+	for c, s := range outputSchemas {
+		run, s := c.Run, s
+		c.Run = func(c *cobra.Command, args []string) {
+			if !rootSchemaFlag {
+				run(c, args)
+				return
+			}
+			if err := printSchema(s); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// printSchema prints the schema document
+func printSchema(s *jsonschema.Schema) error {
+	b, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(b))
+	return nil
+}
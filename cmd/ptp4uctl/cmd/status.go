@@ -0,0 +1,75 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/facebook/time/ptp/ptp4u/server"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(statusCmd)
+}
+
+func printStatus(st *server.MgmtStatus) error {
+	if rootJSONFlag {
+		return printJSON(st)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"identity", "clock", "utc offset", "drained", "degraded", "generation", "subscriptions", "workers"})
+	drained := fmt.Sprintf("%v", st.Drained)
+	if st.ManualDrain {
+		drained += " (manual)"
+	}
+	table.Append([]string{
+		st.ClockIdentity,
+		fmt.Sprintf("%d:0x%x", st.ClockClass, st.ClockAccuracy),
+		st.UTCOffset.String(),
+		drained,
+		fmt.Sprintf("%v", st.Degraded),
+		fmt.Sprintf("%d", st.ConfigGeneration),
+		fmt.Sprintf("%d", st.Subscriptions),
+		fmt.Sprintf("%d", st.Workers),
+	})
+	table.Render()
+	return nil
+}
+
+func statusRun() error {
+	st := &server.MgmtStatus{}
+	if err := mgmtRequest(http.MethodGet, "/status", nil, st); err != nil {
+		return err
+	}
+	return printStatus(st)
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print server status",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := statusRun(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
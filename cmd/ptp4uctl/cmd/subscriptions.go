@@ -0,0 +1,92 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/server"
+
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	subscriptionsTypeFlag    string
+	subscriptionsAddressFlag string
+	subscriptionsTenantFlag  string
+)
+
+func init() {
+	RootCmd.AddCommand(subscriptionsCmd)
+	subscriptionsCmd.Flags().StringVarP(&subscriptionsTypeFlag, "type", "t", "", "only show subscriptions of this message type (sync, announce, delay_resp)")
+	subscriptionsCmd.Flags().StringVarP(&subscriptionsAddressFlag, "address", "a", "", "only show subscriptions of this client address")
+	subscriptionsCmd.Flags().StringVarP(&subscriptionsTenantFlag, "tenant", "T", "", "only show subscriptions of this tenant")
+}
+
+func subscriptionsRun() error {
+	q := url.Values{}
+	if subscriptionsTypeFlag != "" {
+		q.Set("type", subscriptionsTypeFlag)
+	}
+	if subscriptionsAddressFlag != "" {
+		q.Set("address", subscriptionsAddressFlag)
+	}
+	if subscriptionsTenantFlag != "" {
+		q.Set("tenant", subscriptionsTenantFlag)
+	}
+	subs := []*server.MgmtSubscription{}
+	if err := mgmtRequest(http.MethodGet, "/subscriptions?"+q.Encode(), nil, &subs); err != nil {
+		return err
+	}
+	if rootJSONFlag {
+		return printJSON(subs)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"address", "other address", "identity", "type", "interval", "expires in", "worker", "tenant"})
+	now := time.Now()
+	for _, s := range subs {
+		table.Append([]string{
+			s.Address,
+			s.AltAddress,
+			s.Client,
+			s.Type,
+			s.Interval.String(),
+			s.Expire.Sub(now).Round(time.Second).String(),
+			fmt.Sprintf("%d", s.Worker),
+			s.Tenant,
+		})
+	}
+	table.Render()
+	return nil
+}
+
+var subscriptionsCmd = &cobra.Command{
+	Use:     "subscriptions",
+	Aliases: []string{"subs"},
+	Short:   "List running subscriptions",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := subscriptionsRun(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,131 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/facebook/time/ptp/anonymize"
+)
+
+// readKey reads the key from the file, or generates a random one if path is empty
+func readKey(path string) ([]byte, error) {
+	if path == "" {
+		key := make([]byte, anonymize.KeySize)
+		_, err := rand.Read(key)
+		return key, err
+	}
+	return os.ReadFile(path)
+}
+
+// parseKeep parses comma separated list of prefixes or addresses
+func parseKeep(keep string) ([]*net.IPNet, error) {
+	res := []*net.IPNet{}
+	for _, s := range strings.Split(keep, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func run(input, output, keyFile, keep, mappingFile string) error {
+	key, err := readKey(keyFile)
+	if err != nil {
+		return fmt.Errorf("reading key: %w", err)
+	}
+	prefixes, err := parseKeep(keep)
+	if err != nil {
+		return fmt.Errorf("parsing kept prefixes: %w", err)
+	}
+	a, err := anonymize.New(key, prefixes)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	res, err := a.Capture(in, out)
+	if err != nil {
+		return err
+	}
+	log.Infof("Wrote %d packets to %s, dropped %d non PTP and %d malformed packets", res.Written, output, res.NotPTP, res.Malformed)
+
+	if mappingFile == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(a.Mapping(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mappingFile, b, 0600)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "ptpanon: anonymizes addresses and clock identities in PTP captures, so they can be shared.\nUsage:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "%s [input] [output]\n", os.Args[0])
+		fmt.Fprint(flag.CommandLine.Output(), "where [input] is any .pcap or .pcapng packet capture and [output] is the anonymized .pcap\n")
+		flag.PrintDefaults()
+	}
+	keyFile := flag.String("key", "", fmt.Sprintf("File with the secret key of at least %d bytes. Captures anonymized with the same key map addresses the same way. Random key if empty", anonymize.KeySize))
+	keep := flag.String("keep", "", "Comma separated list of addresses or prefixes to keep as is, e.g. of the grandmasters")
+	mappingFile := flag.String("mapping", "", "Write original to anonymized values as JSON to this file. It reveals the topology, don't share it. Disabled if empty")
+	flag.Parse()
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), *keyFile, *keep, *mappingFile); err != nil {
+		log.Fatal(err)
+	}
+}
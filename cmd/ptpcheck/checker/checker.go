@@ -17,6 +17,8 @@ limitations under the License.
 package checker
 
 import (
+	"math"
+
 	ptp "github.com/facebook/time/ptp/protocol"
 )
 
@@ -34,3 +36,31 @@ type PTPCheckResult struct {
 	PortStatsRX         map[string]uint64
 	PortServiceStats    *ptp.PortServiceStats
 }
+
+// PTPStats is the output of ptpcheck stats
+type PTPStats struct {
+	Offset            float64 `json:"ptp.offset_ns"`
+	OffsetAbs         float64 `json:"ptp.offset_abs_ns"`
+	MeanPathDelay     float64 `json:"ptp.mean_path_delay_ns"`
+	StepsRemoved      int     `json:"ptp.steps_removed"`
+	GMPresent         int     `json:"ptp.gm_present"` // bool for ODS
+	CorrectionFieldRX int64   `json:"ptp.cf_rx,omitempty"`
+	CorrectionFieldTX int64   `json:"ptp.cf_tx,omitempty"`
+}
+
+// NewPTPStats constructs PTPStats from PTPCheckResult
+func NewPTPStats(r *PTPCheckResult) *PTPStats {
+	output := &PTPStats{
+		Offset:            r.OffsetFromMasterNS,
+		OffsetAbs:         math.Abs(r.OffsetFromMasterNS),
+		MeanPathDelay:     r.MeanPathDelayNS,
+		StepsRemoved:      r.StepsRemoved,
+		GMPresent:         0,
+		CorrectionFieldRX: r.CorrectionFieldRxNS,
+		CorrectionFieldTX: r.CorrectionFieldTxNS,
+	}
+	if r.GrandmasterPresent {
+		output.GMPresent = 1
+	}
+	return output
+}
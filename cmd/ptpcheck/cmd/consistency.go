@@ -0,0 +1,241 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	sptp "github.com/facebook/time/ptp/sptp/client"
+)
+
+// ConsistencyPair is the time difference between two GMs, GM A minus GM B
+type ConsistencyPair struct {
+	A       string        `json:"a"`
+	B       string        `json:"b"`
+	Samples int           `json:"samples"`
+	Mean    time.Duration `json:"mean_ns"`
+	StdDev  time.Duration `json:"stddev_ns"`
+	CILow   time.Duration `json:"ci95_low_ns"`
+	CIHigh  time.Duration `json:"ci95_high_ns"`
+}
+
+// ConsistencyStats is the JSON output of ptpcheck consistency
+type ConsistencyStats struct {
+	Rounds int               `json:"rounds"`
+	Pairs  []ConsistencyPair `json:"pairs"`
+}
+
+var (
+	consistencyIfaceFlag        string
+	consistencyTimestampingFlag string
+	consistencyIntervalFlag     time.Duration
+	consistencyTimeoutFlag      time.Duration
+	consistencyRoundsFlag       int
+	consistencyJSONFlag         bool
+)
+
+func init() {
+	RootCmd.AddCommand(consistencyCmd)
+	consistencyCmd.Flags().StringVarP(&consistencyIfaceFlag, "iface", "i", "eth0", "network interface to use")
+	consistencyCmd.Flags().StringVarP(&consistencyTimestampingFlag, "timestamping", "T", "", fmt.Sprintf("timestamping to use, either %q or %q. empty means auto-detection", sptp.HWTIMESTAMP, sptp.SWTIMESTAMP))
+	consistencyCmd.Flags().DurationVarP(&consistencyIntervalFlag, "interval", "I", time.Second, "interval between measurement rounds")
+	consistencyCmd.Flags().DurationVarP(&consistencyTimeoutFlag, "timeout", "t", 500*time.Millisecond, "timeout of a single exchange with a GM")
+	consistencyCmd.Flags().IntVarP(&consistencyRoundsFlag, "rounds", "n", 60, "number of measurement rounds")
+	consistencyCmd.Flags().BoolVarP(&consistencyJSONFlag, "json", "j", false, "produce json output")
+}
+
+// tQuantile95 are two-sided 95% quantiles of Student's t-distribution by degrees of freedom
+var tQuantile95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tQuantile returns the 95% confidence multiplier of the standard error for n samples
+func tQuantile(n int) float64 {
+	df := n - 1
+	if df <= len(tQuantile95) {
+		return tQuantile95[df-1]
+	}
+	return 1.96
+}
+
+// pairStats calculates mean, standard deviation and 95% confidence interval of the mean of the differences
+func pairStats(a, b string, diffs []float64) ConsistencyPair {
+	p := ConsistencyPair{A: a, B: b, Samples: len(diffs)}
+	if len(diffs) == 0 {
+		return p
+	}
+	var sum float64
+	for _, d := range diffs {
+		sum += d
+	}
+	mean := sum / float64(len(diffs))
+	p.Mean = time.Duration(math.Round(mean))
+	p.CILow, p.CIHigh = p.Mean, p.Mean
+	if len(diffs) < 2 {
+		return p
+	}
+	var sq float64
+	for _, d := range diffs {
+		sq += (d - mean) * (d - mean)
+	}
+	sd := math.Sqrt(sq / float64(len(diffs)-1))
+	margin := tQuantile(len(diffs)) * sd / math.Sqrt(float64(len(diffs)))
+	p.StdDev = time.Duration(math.Round(sd))
+	p.CILow = time.Duration(math.Round(mean - margin))
+	p.CIHigh = time.Duration(math.Round(mean + margin))
+	return p
+}
+
+// pairwiseDiffs calculates differences between every pair of GMs from the offsets of the local clock to them.
+// Offsets of a round are measured simultaneously against the same PHC, so the PHC error cancels out
+// and GM A - GM B is offset to B - offset to A. Rounds missing either GM are skipped for the pair
+func pairwiseDiffs(servers []string, rounds []map[string]time.Duration) []ConsistencyPair {
+	pairs := []ConsistencyPair{}
+	for i, a := range servers {
+		for _, b := range servers[i+1:] {
+			diffs := []float64{}
+			for _, round := range rounds {
+				offsetA, okA := round[a]
+				offsetB, okB := round[b]
+				if !okA || !okB {
+					continue
+				}
+				diffs = append(diffs, float64(offsetB-offsetA))
+			}
+			pairs = append(pairs, pairStats(a, b, diffs))
+		}
+	}
+	return pairs
+}
+
+// consistencyServers resolves the GMs into addresses normalized the way sptp client keys them
+func consistencyServers(targets []string) ([]string, error) {
+	servers := []string{}
+	for _, t := range targets {
+		address := t
+		names, err := net.LookupHost(t)
+		if err == nil && len(names) > 0 {
+			address = names[0]
+		}
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("unable to resolve %q", t)
+		}
+		servers = append(servers, ip.String())
+	}
+	sort.Strings(servers)
+	return servers, nil
+}
+
+// reportConsistency prints the pairwise differences as a table
+func reportConsistency(stats *ConsistencyStats) {
+	fmt.Printf("Collected %d rounds\n", stats.Rounds)
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	fmt.Fprintln(w, "GM A\tGM B\tsamples\tA - B mean\tstddev\t95% CI\t")
+	for _, p := range stats.Pairs {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%v\t%v\t[%v, %v]\t\n", p.A, p.B, p.Samples, p.Mean, p.StdDev, p.CILow, p.CIHigh)
+	}
+	w.Flush()
+}
+
+func consistencyRun(targets []string, iface, timestamping string, interval, timeout time.Duration, rounds int, isJSON bool) error {
+	servers, err := consistencyServers(targets)
+	if err != nil {
+		return err
+	}
+	cfg := &sptp.Config{
+		Iface:        iface,
+		Timestamping: timestamping,
+		Servers:      map[string]int{},
+	}
+	for i, s := range servers {
+		cfg.Servers[s] = i
+	}
+	p, err := sptp.NewSPTP(cfg, sptp.NewStats())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if err := p.RunListener(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Errorf("listener failed: %v", err)
+		}
+	}()
+
+	offsets := []map[string]time.Duration{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for len(offsets) < rounds {
+		<-ticker.C
+		round := map[string]time.Duration{}
+		for server, res := range p.RunOnce(ctx, timeout) {
+			if res.Error != nil || res.Measurement == nil {
+				log.Warningf("round %d: no measurement from %s: %v", len(offsets), server, res.Error)
+				continue
+			}
+			log.Debugf("round %d: %s offset %v, delay %v", len(offsets), server, res.Measurement.Offset, res.Measurement.Delay)
+			round[server] = res.Measurement.Offset
+		}
+		offsets = append(offsets, round)
+	}
+
+	stats := &ConsistencyStats{Rounds: len(offsets), Pairs: pairwiseDiffs(servers, offsets)}
+	if isJSON {
+		str, err := json.Marshal(stats)
+		if err != nil {
+			return fmt.Errorf("marshaling json: %w", err)
+		}
+		fmt.Println(string(str))
+		return nil
+	}
+	reportConsistency(stats)
+	return nil
+}
+
+var consistencyCmd = &cobra.Command{
+	Use:   "consistency GM GM [GM...]",
+	Short: "Measure pairwise time differences between several PTP unicast servers",
+	Long: `Consistency subcommand subscribes to several PTP unicast servers simultaneously over a single interface,
+measures offset of the local PHC to every server in each round and reports the difference between every pair
+of servers with its 95% confidence interval. The PHC is never steered, the error of the local clock cancels out
+as all servers are measured against it at the same time. Path delay asymmetries are not compensated.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(c *cobra.Command, args []string) {
+		ConfigureVerbosity()
+		if consistencyRoundsFlag < 1 {
+			log.Fatalf("rounds must be positive, got %d", consistencyRoundsFlag)
+		}
+		if err := consistencyRun(args, consistencyIfaceFlag, consistencyTimestampingFlag, consistencyIntervalFlag, consistencyTimeoutFlag, consistencyRoundsFlag, consistencyJSONFlag); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
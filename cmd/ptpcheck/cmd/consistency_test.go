@@ -0,0 +1,80 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairwiseDiffs(t *testing.T) {
+	servers := []string{"::1", "::2", "::3"}
+	rounds := []map[string]time.Duration{
+		{"::1": 100, "::2": 90, "::3": 0},
+		{"::1": 110, "::2": 100},
+		{"::1": 120, "::2": 120, "::3": 30},
+		{"::2": 50, "::3": 40},
+	}
+	pairs := pairwiseDiffs(servers, rounds)
+	require.Len(t, pairs, 3)
+
+	// ::1 - ::2 is offset to ::2 - offset to ::1: -10, -10, 0
+	require.Equal(t, "::1", pairs[0].A)
+	require.Equal(t, "::2", pairs[0].B)
+	require.Equal(t, 3, pairs[0].Samples)
+	require.Equal(t, time.Duration(-7), pairs[0].Mean)
+	require.Equal(t, time.Duration(6), pairs[0].StdDev)
+	// mean ± 4.303 * 5.77 / sqrt(3)
+	require.Equal(t, time.Duration(-21), pairs[0].CILow)
+	require.Equal(t, time.Duration(8), pairs[0].CIHigh)
+
+	// rounds missing either GM are skipped: -100, -90
+	require.Equal(t, "::1", pairs[1].A)
+	require.Equal(t, "::3", pairs[1].B)
+	require.Equal(t, 2, pairs[1].Samples)
+	require.Equal(t, time.Duration(-95), pairs[1].Mean)
+
+	require.Equal(t, "::2", pairs[2].A)
+	require.Equal(t, "::3", pairs[2].B)
+	require.Equal(t, 3, pairs[2].Samples)
+}
+
+func TestPairStats(t *testing.T) {
+	p := pairStats("a", "b", nil)
+	require.Equal(t, ConsistencyPair{A: "a", B: "b"}, p)
+
+	p = pairStats("a", "b", []float64{42})
+	require.Equal(t, ConsistencyPair{A: "a", B: "b", Samples: 1, Mean: 42, CILow: 42, CIHigh: 42}, p)
+
+	// no spread means no uncertainty
+	p = pairStats("a", "b", []float64{5, 5, 5, 5})
+	require.Equal(t, ConsistencyPair{A: "a", B: "b", Samples: 4, Mean: 5, CILow: 5, CIHigh: 5}, p)
+}
+
+func TestTQuantile(t *testing.T) {
+	require.Equal(t, 12.706, tQuantile(2))
+	require.Equal(t, 2.042, tQuantile(31))
+	require.Equal(t, 1.96, tQuantile(32))
+}
+
+func TestConsistencyServers(t *testing.T) {
+	servers, err := consistencyServers([]string{"2001:db8::2", "192.0.2.1", "2001:0db8::1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.1", "2001:db8::1", "2001:db8::2"}, servers)
+}
@@ -26,7 +26,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
-type phcStats struct {
+// PHCDiffStats is the JSON output of ptpcheck phcdiff
+type PHCDiffStats struct {
 	PHCOffset time.Duration `json:"ptp.phc.offset_ns"`
 	PHC1Delay time.Duration `json:"ptp.phc.1.delay_ns"`
 	PHC2Delay time.Duration `json:"ptp.phc.2.delay_ns"`
@@ -59,7 +60,7 @@ func phcdiffRun(deviceA, deviceB string, isJSON bool) error {
 	phcOffset := phc.OffsetBetweenExtendedReadings(extendedA, extendedB)
 
 	if isJSON {
-		stats := phcStats{PHCOffset: phcOffset, PHC1Delay: timeAndOffsetA.Delay, PHC2Delay: timeAndOffsetB.Delay}
+		stats := PHCDiffStats{PHCOffset: phcOffset, PHC1Delay: timeAndOffsetA.Delay, PHC2Delay: timeAndOffsetB.Delay}
 		str, err := json.Marshal(stats)
 		if err != nil {
 			return fmt.Errorf("marshaling json: %w", err)
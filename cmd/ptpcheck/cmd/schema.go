@@ -0,0 +1,79 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/facebook/time/cmd/ptpcheck/checker"
+	"github.com/facebook/time/jsonschema"
+	"github.com/facebook/time/phc"
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+//go:generate go test -run TestSchemaFiles -update-schemas
+
+// schemaDir keeps the published schema files, relative to this package
+const schemaDir = "../schema"
+
+// outputSchemas are schemas of the JSON output by command.
+// Version has to be bumped on any incompatible change of the output
+var outputSchemas = map[*cobra.Command]*jsonschema.Schema{
+	statsCmd: jsonschema.New("ptpcheck/stats", 1, "PTP client offset and path delay",
+		jsonschema.Reflect(checker.PTPStats{})),
+	portStatsCmd: jsonschema.New("ptpcheck/portstats", 1, "PTP port TX and RX counters by message type",
+		jsonschema.Pattern(`^ptp\.portstats\.(tx|rx)\.[a-z0-9_]+$`, uint64(0))),
+	serviceStatsCmd: jsonschema.New("ptpcheck/servicestats", 1, "PTP port service counters of ptp4l, or system stats of sptp",
+		jsonschema.AnyOf(jsonschema.Reflect(ptp.PortServiceStats{}), jsonschema.Reflect(map[string]int64{}))),
+	phcdiffCmd: jsonschema.New("ptpcheck/phcdiff", 1, "Offset between two PHCs and their read delays in ns, printed with --json",
+		jsonschema.Reflect(PHCDiffStats{})),
+	consistencyCmd: jsonschema.New("ptpcheck/consistency", 1, "Pairwise time differences between GMs with 95% confidence intervals in ns, printed with --json",
+		jsonschema.Reflect(ConsistencyStats{})),
+	timestampsCmd: jsonschema.New("ptpcheck/timestamps", 1, "Timestamps self-test verdict with measured offsets in ns, printed with --json",
+		jsonschema.Reflect(TimestampsReport{})),
+	topologyCmd: jsonschema.New("ptpcheck/topology", 1, "PHC devices with their pins, parent NICs and hardware timestamping settings, printed with --json",
+		jsonschema.Reflect(phc.Topology{})),
+}
+
+// with --schema the commands print the schema of their output instead of running
+func init() {
+	for c, s := range outputSchemas {
+		run, s := c.Run, s
+		c.Run = func(c *cobra.Command, args []string) {
+			if !rootSchemaFlag {
+				run(c, args)
+				return
+			}
+			if err := printSchema(s); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// printSchema prints the schema document
+func printSchema(s *jsonschema.Schema) error {
+	b, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(b))
+	return nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateSchemas = flag.Bool("update-schemas", false, "regenerate the published schema files")
+
+func TestSchemaFiles(t *testing.T) {
+	for c, s := range outputSchemas {
+		b, err := s.Marshal()
+		require.NoError(t, err)
+		path := filepath.Join(schemaDir, fmt.Sprintf("%s.v%d.json", c.Name(), s.Version))
+		if *updateSchemas {
+			require.NoError(t, os.WriteFile(path, b, 0644))
+			continue
+		}
+		published, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, string(published), string(b), "%s is out of date, run go generate", path)
+	}
+}
@@ -19,7 +19,6 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"math"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -28,30 +27,7 @@ import (
 )
 
 func printStats(r *checker.PTPCheckResult) error {
-	type stats struct {
-		Offset            float64 `json:"ptp.offset_ns"`
-		OffsetAbs         float64 `json:"ptp.offset_abs_ns"`
-		MeanPathDelay     float64 `json:"ptp.mean_path_delay_ns"`
-		StepsRemoved      int     `json:"ptp.steps_removed"`
-		GMPresent         int     `json:"ptp.gm_present"` // bool for ODS
-		CorrectionFieldRX int64   `json:"ptp.cf_rx,omitempty"`
-		CorrectionFieldTX int64   `json:"ptp.cf_tx,omitempty"`
-	}
-
-	output := stats{
-		Offset:            r.OffsetFromMasterNS,
-		OffsetAbs:         math.Abs(r.OffsetFromMasterNS),
-		MeanPathDelay:     r.MeanPathDelayNS,
-		StepsRemoved:      r.StepsRemoved,
-		GMPresent:         0,
-		CorrectionFieldRX: r.CorrectionFieldRxNS,
-		CorrectionFieldTX: r.CorrectionFieldTxNS,
-	}
-	if r.GrandmasterPresent {
-		output.GMPresent = 1
-	}
-
-	toPrint, err := json.Marshal(output)
+	toPrint, err := json.Marshal(checker.NewPTPStats(r))
 	if err != nil {
 		return err
 	}
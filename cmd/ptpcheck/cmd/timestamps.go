@@ -0,0 +1,314 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+
+	"github.com/facebook/time/phc"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+)
+
+// flags
+var (
+	timestampsIfaceFlag        string
+	timestampsTimestampingFlag string
+	timestampsAddressFlag      string
+	timestampsPortFlag         int
+	timestampsCountFlag        int
+	timestampsIntervalFlag     time.Duration
+	timestampsTimeoutFlag      time.Duration
+	timestampsMaxOffsetFlag    time.Duration
+	timestampsJSONFlag         bool
+)
+
+func init() {
+	RootCmd.AddCommand(timestampsCmd)
+	timestampsCmd.Flags().StringVarP(&timestampsIfaceFlag, "iface", "i", "lo", "network interface to send from")
+	timestampsCmd.Flags().StringVarP(&timestampsTimestampingFlag, "timestamping", "T", timestamp.SWTIMESTAMP, fmt.Sprintf("timestamping to test, either %q or %q", timestamp.HWTIMESTAMP, timestamp.SWTIMESTAMP))
+	timestampsCmd.Flags().StringVarP(&timestampsAddressFlag, "address", "a", "127.0.0.1", "local address the packets are sent to and received on")
+	timestampsCmd.Flags().IntVarP(&timestampsPortFlag, "port", "p", 0, "UDP port the packets are sent to. 0 means 319 for hardware timestamps, which NICs filtering PTP event messages require, and any free port for software ones")
+	timestampsCmd.Flags().IntVarP(&timestampsCountFlag, "count", "n", 10, "number of packets to send")
+	timestampsCmd.Flags().DurationVarP(&timestampsIntervalFlag, "interval", "I", 100*time.Millisecond, "interval between packets")
+	timestampsCmd.Flags().DurationVarP(&timestampsTimeoutFlag, "timeout", "t", time.Second, "timeout of reading a single timestamp")
+	timestampsCmd.Flags().DurationVarP(&timestampsMaxOffsetFlag, "max-offset", "m", time.Millisecond, "maximum distance of a timestamp from the clock read around the exchange, and of RX from TX")
+	timestampsCmd.Flags().BoolVarP(&timestampsJSONFlag, "json", "j", false, "produce json output")
+}
+
+// TimestampsSample is a single packet sent to ourselves
+type TimestampsSample struct {
+	TX time.Time `json:"tx"`
+	RX time.Time `json:"rx"`
+	// TXOffset is TX timestamp minus the clock read right before sending
+	TXOffset time.Duration `json:"tx_offset_ns"`
+	// RXOffset is the clock read right after receiving minus RX timestamp
+	RXOffset time.Duration `json:"rx_offset_ns"`
+	// Path is RX minus TX timestamp
+	Path  time.Duration `json:"path_ns"`
+	Error string        `json:"error,omitempty"`
+}
+
+// TimestampsReport is the self-test verdict
+type TimestampsReport struct {
+	Timestamping string             `json:"timestamping"`
+	Iface        string             `json:"iface"`
+	MaxOffset    time.Duration      `json:"max_offset_ns"`
+	Pass         bool               `json:"pass"`
+	Failed       int                `json:"failed"`
+	MaxTXOffset  time.Duration      `json:"max_tx_offset_ns"`
+	MaxRXOffset  time.Duration      `json:"max_rx_offset_ns"`
+	MaxPath      time.Duration      `json:"max_path_ns"`
+	Problems     []string           `json:"problems"`
+	Samples      []TimestampsSample `json:"samples"`
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// evaluateTimestamps checks every sample has both timestamps in order and close to the clock
+func evaluateTimestamps(samples []TimestampsSample, maxOffset time.Duration) *TimestampsReport {
+	r := &TimestampsReport{MaxOffset: maxOffset, Problems: []string{}, Samples: samples}
+	for i, s := range samples {
+		var problems []string
+		if s.Error != "" {
+			problems = append(problems, s.Error)
+		} else {
+			if absDuration(s.TXOffset) > maxOffset {
+				problems = append(problems, fmt.Sprintf("TX timestamp is %v away from the clock", s.TXOffset))
+			}
+			if absDuration(s.RXOffset) > maxOffset {
+				problems = append(problems, fmt.Sprintf("RX timestamp is %v away from the clock", s.RXOffset))
+			}
+			if s.Path < 0 {
+				problems = append(problems, fmt.Sprintf("RX timestamp is %v before TX", -s.Path))
+			} else if s.Path > maxOffset {
+				problems = append(problems, fmt.Sprintf("RX timestamp is %v after TX", s.Path))
+			}
+			if absDuration(s.TXOffset) > r.MaxTXOffset {
+				r.MaxTXOffset = absDuration(s.TXOffset)
+			}
+			if absDuration(s.RXOffset) > r.MaxRXOffset {
+				r.MaxRXOffset = absDuration(s.RXOffset)
+			}
+			if absDuration(s.Path) > r.MaxPath {
+				r.MaxPath = absDuration(s.Path)
+			}
+		}
+		if len(problems) > 0 {
+			r.Failed++
+			for _, p := range problems {
+				r.Problems = append(r.Problems, fmt.Sprintf("packet %d: %s", i, p))
+			}
+		}
+	}
+	r.Pass = len(samples) > 0 && r.Failed == 0
+	return r
+}
+
+// timestampsSocket opens UDP socket on addr with timestamps enabled, in blocking mode
+func timestampsSocket(addr *net.UDPAddr, iface, timestamping string, timeout time.Duration) (*net.UDPConn, int, error) {
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, -1, err
+	}
+	fd, err := timestamp.ConnFd(conn)
+	if err != nil {
+		conn.Close()
+		return nil, -1, err
+	}
+	switch timestamping {
+	case timestamp.HWTIMESTAMP:
+		err = timestamp.EnableHWTimestamps(fd, iface)
+	case timestamp.SWTIMESTAMP:
+		err = timestamp.EnableSWTimestamps(fd)
+	default:
+		err = fmt.Errorf("unknown timestamping %q", timestamping)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, -1, fmt.Errorf("enabling %s timestamps: %w", timestamping, err)
+	}
+	// set it to blocking mode, otherwise recvmsg will just return with nothing most of the time
+	if err := unix.SetNonblock(fd, false); err != nil {
+		conn.Close()
+		return nil, -1, err
+	}
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		conn.Close()
+		return nil, -1, err
+	}
+	return conn, fd, nil
+}
+
+// timestampsClock returns the clock the timestamps are taken from
+func timestampsClock(iface, timestamping string) func() (time.Time, error) {
+	if timestamping == timestamp.HWTIMESTAMP {
+		return func() (time.Time, error) { return phc.Time(iface, phc.MethodIoctlSysOffsetExtended) }
+	}
+	return func() (time.Time, error) { return time.Now(), nil }
+}
+
+// timestampsExchange sends a Sync to ourselves and measures its timestamps against the clock
+func timestampsExchange(txFd, rxFd int, dst unix.Sockaddr, seq uint16, clock func() (time.Time, error), timeout time.Duration) TimestampsSample {
+	s := TimestampsSample{}
+	p := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:         ptp.Version,
+			MessageLength:   uint16(binary.Size(ptp.SyncDelayReq{})),
+			SequenceID:      seq,
+		},
+	}
+	b, err := ptp.Bytes(p)
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+	before, err := clock()
+	if err != nil {
+		s.Error = fmt.Sprintf("reading clock: %v", err)
+		return s
+	}
+	if err := unix.Sendto(txFd, b, 0, dst); err != nil {
+		s.Error = fmt.Sprintf("sending: %v", err)
+		return s
+	}
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+	s.TX, _, err = timestamp.ReadTXtimestampBufDeadline(txFd, oob, toob, time.Now().Add(timeout))
+	if err != nil {
+		s.Error = fmt.Sprintf("reading TX timestamp: %v", err)
+		return s
+	}
+	_, _, s.RX, err = timestamp.ReadPacketWithRXTimestamp(rxFd)
+	if err != nil {
+		s.Error = fmt.Sprintf("reading RX timestamp: %v", err)
+		return s
+	}
+	after, err := clock()
+	if err != nil {
+		s.Error = fmt.Sprintf("reading clock: %v", err)
+		return s
+	}
+	s.TXOffset = s.TX.Sub(before)
+	s.RXOffset = after.Sub(s.RX)
+	s.Path = s.RX.Sub(s.TX)
+	return s
+}
+
+func timestampsRun(iface, timestamping, address string, port, count int, interval, timeout, maxOffset time.Duration) (*TimestampsReport, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", address)
+	}
+	if port == 0 && timestamping == timestamp.HWTIMESTAMP {
+		port = ptp.PortEvent
+	}
+	rx, rxFd, err := timestampsSocket(&net.UDPAddr{IP: ip, Port: port}, iface, timestamping, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("opening receiving socket: %w", err)
+	}
+	defer rx.Close()
+	tx, txFd, err := timestampsSocket(&net.UDPAddr{IP: ip}, iface, timestamping, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("opening sending socket: %w", err)
+	}
+	defer tx.Close()
+
+	dst := timestamp.IPToSockaddr(ip, rx.LocalAddr().(*net.UDPAddr).Port)
+	clock := timestampsClock(iface, timestamping)
+	samples := []TimestampsSample{}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		s := timestampsExchange(txFd, rxFd, dst, uint16(i), clock, timeout)
+		log.Debugf("packet %d: %+v", i, s)
+		samples = append(samples, s)
+	}
+	r := evaluateTimestamps(samples, maxOffset)
+	r.Timestamping = timestamping
+	r.Iface = iface
+	return r, nil
+}
+
+// reportTimestamps prints the verdict with the measured offsets
+func reportTimestamps(r *TimestampsReport) {
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', tabwriter.AlignRight|tabwriter.Debug)
+	fmt.Fprintln(w, "packet\tTX - clock\tclock - RX\tRX - TX\terror\t")
+	for i, s := range r.Samples {
+		fmt.Fprintf(w, "%d\t%v\t%v\t%v\t%s\t\n", i, s.TXOffset, s.RXOffset, s.Path, s.Error)
+	}
+	w.Flush()
+	for _, p := range r.Problems {
+		fmt.Println(failString, p)
+	}
+	if r.Pass {
+		fmt.Printf("%s %s timestamps on %s: %d packets within %v of the clock, max TX offset %v, max RX offset %v, max path %v\n",
+			okString, r.Timestamping, r.Iface, len(r.Samples), r.MaxOffset, r.MaxTXOffset, r.MaxRXOffset, r.MaxPath)
+		return
+	}
+	fmt.Printf("%s %s timestamps on %s: %d of %d packets failed\n", failString, r.Timestamping, r.Iface, r.Failed, len(r.Samples))
+}
+
+var timestampsCmd = &cobra.Command{
+	Use:   "timestamps",
+	Short: "Self-test RX and TX timestamps by sending packets to ourselves",
+	Long: `Timestamps subcommand sends PTP Sync messages from the interface to a local address and checks that
+every packet gets both TX and RX timestamps, that RX follows TX, and that both are close to the clock read
+around the exchange: the PHC of the interface for hardware timestamps, the system clock for software ones.
+Packets to local addresses are looped back by the kernel, so hardware timestamps need them routed out of the
+NIC and back, e.g. over a cable between two ports. Exits with non-zero code if the test fails.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		ConfigureVerbosity()
+		if timestampsCountFlag < 1 {
+			log.Fatalf("count must be positive, got %d", timestampsCountFlag)
+		}
+		r, err := timestampsRun(timestampsIfaceFlag, timestampsTimestampingFlag, timestampsAddressFlag, timestampsPortFlag, timestampsCountFlag, timestampsIntervalFlag, timestampsTimeoutFlag, timestampsMaxOffsetFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if timestampsJSONFlag {
+			js, err := json.Marshal(r)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(js))
+		} else {
+			reportTimestamps(r)
+		}
+		if !r.Pass {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,69 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateTimestamps(t *testing.T) {
+	samples := []TimestampsSample{
+		{TXOffset: 10 * time.Microsecond, RXOffset: 20 * time.Microsecond, Path: 5 * time.Microsecond},
+		{TXOffset: 15 * time.Microsecond, RXOffset: 30 * time.Microsecond, Path: 3 * time.Microsecond},
+	}
+	r := evaluateTimestamps(samples, time.Millisecond)
+	require.True(t, r.Pass)
+	require.Equal(t, 0, r.Failed)
+	require.Empty(t, r.Problems)
+	require.Equal(t, 15*time.Microsecond, r.MaxTXOffset)
+	require.Equal(t, 30*time.Microsecond, r.MaxRXOffset)
+	require.Equal(t, 5*time.Microsecond, r.MaxPath)
+
+	samples = append(samples,
+		TimestampsSample{Error: "reading TX timestamp: nope"},
+		TimestampsSample{TXOffset: -2 * time.Millisecond, RXOffset: 20 * time.Microsecond, Path: -time.Microsecond},
+		TimestampsSample{TXOffset: 10 * time.Microsecond, RXOffset: 3 * time.Second, Path: 2 * time.Millisecond},
+	)
+	r = evaluateTimestamps(samples, time.Millisecond)
+	require.False(t, r.Pass)
+	require.Equal(t, 3, r.Failed)
+	require.Equal(t, []string{
+		"packet 2: reading TX timestamp: nope",
+		"packet 3: TX timestamp is -2ms away from the clock",
+		"packet 3: RX timestamp is 1µs before TX",
+		"packet 4: RX timestamp is 3s away from the clock",
+		"packet 4: RX timestamp is 2ms after TX",
+	}, r.Problems)
+
+	require.False(t, evaluateTimestamps(nil, time.Millisecond).Pass)
+}
+
+func TestTimestampsRunLoopback(t *testing.T) {
+	r, err := timestampsRun("lo", timestamp.SWTIMESTAMP, "127.0.0.1", 0, 3, time.Millisecond, time.Second, time.Second)
+	require.NoError(t, err)
+	require.Len(t, r.Samples, 3)
+	require.True(t, r.Pass, "%v", r.Problems)
+	require.Equal(t, "lo", r.Iface)
+	for _, s := range r.Samples {
+		require.False(t, s.TX.IsZero())
+		require.False(t, s.RX.IsZero())
+	}
+}
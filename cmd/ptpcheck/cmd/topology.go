@@ -0,0 +1,133 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/facebook/time/phc"
+)
+
+// flags
+var (
+	topologyJSONFlag  bool
+	topologyCheckFlag bool
+)
+
+func init() {
+	RootCmd.AddCommand(topologyCmd)
+	topologyCmd.Flags().BoolVarP(&topologyJSONFlag, "json", "j", false, "produce json output")
+	topologyCmd.Flags().BoolVarP(&topologyCheckFlag, "check", "c", false, "check that the interfaces have a PHC with hardware timestamps enabled, exit with non-zero code otherwise")
+}
+
+// checkTopology returns problems preventing PTP on the interfaces, all NIC interfaces if none are given
+func checkTopology(t *phc.Topology, ifaces []string) []string {
+	problems := []string{}
+	if len(t.Clocks) == 0 {
+		return append(problems, "no PHC devices found")
+	}
+	if len(ifaces) == 0 {
+		for _, c := range t.Clocks {
+			for _, iface := range c.Ifaces {
+				ifaces = append(ifaces, iface.Name)
+			}
+		}
+	}
+	for _, name := range ifaces {
+		c, ok := t.Clock(name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s has no PHC", name))
+			continue
+		}
+		for _, iface := range c.Ifaces {
+			if iface.Name != name {
+				continue
+			}
+			switch {
+			case iface.HWTstamp == nil:
+				problems = append(problems, fmt.Sprintf("%s: can't read hardware timestamping setting: %s", name, iface.HWTstampError))
+			case !iface.HWTstamp.Enabled():
+				problems = append(problems, fmt.Sprintf("%s: hardware timestamps are disabled (tx_type %d, rx_filter %d)", name, iface.HWTstamp.TXType, iface.HWTstamp.RXFilter))
+			}
+		}
+	}
+	return problems
+}
+
+func printTopology(t *phc.Topology) {
+	for _, c := range t.Clocks {
+		kind := "NIC"
+		if c.Virtual {
+			kind = "virtual"
+		}
+		fmt.Printf("%s: %s (%s), max adjustment %d ppb, %d external timestamp channels, %d periodic outputs, pps %v\n",
+			c.Device, c.Name, kind, c.MaxAdjustment, c.ExtTS, c.PerOut, c.PPS)
+		if c.Bus != "" {
+			fmt.Printf("\tbus: %s\n", c.Bus)
+		}
+		for _, p := range c.Pins {
+			fmt.Printf("\tpin %s: %s, channel %d\n", p.Name, phc.PinFuncName(p.Function), p.Channel)
+		}
+		for _, iface := range c.Ifaces {
+			if iface.HWTstamp == nil {
+				fmt.Printf("\tiface %s: hwtstamp unknown: %s\n", iface.Name, iface.HWTstampError)
+				continue
+			}
+			fmt.Printf("\tiface %s: hwtstamp tx_type %d, rx_filter %d\n", iface.Name, iface.HWTstamp.TXType, iface.HWTstamp.RXFilter)
+		}
+	}
+}
+
+var topologyCmd = &cobra.Command{
+	Use:   "topology [network interface]...",
+	Short: "Print PHC devices with their pins, parent NICs and hardware timestamping settings",
+	Long: `Topology subcommand reads PHC devices, their pins and parent NICs from sysfs, and the current hardware
+timestamping setting of every NIC interface. With --check it verifies that the given interfaces, all NIC interfaces
+if none are given, have a PHC with hardware timestamps enabled.`,
+	Run: func(_ *cobra.Command, args []string) {
+		ConfigureVerbosity()
+		t, err := phc.DiscoverTopology()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if topologyJSONFlag {
+			js, err := json.Marshal(t)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(js))
+		} else {
+			printTopology(t)
+		}
+		if !topologyCheckFlag {
+			return
+		}
+		problems := checkTopology(t, args)
+		if len(problems) == 0 {
+			fmt.Fprintln(os.Stderr, okString, "PHC topology")
+			return
+		}
+		fmt.Fprintln(os.Stderr, failString, strings.Join(problems, "\n"+failString+" "))
+		os.Exit(1)
+	},
+}
@@ -0,0 +1,44 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/phc"
+)
+
+func TestCheckTopology(t *testing.T) {
+	require.Equal(t, []string{"no PHC devices found"}, checkTopology(&phc.Topology{}, nil))
+
+	topo := &phc.Topology{Clocks: []phc.TopologyClock{
+		{Device: "/dev/ptp0", Name: phc.ClockNameKVM, Virtual: true},
+		{Device: "/dev/ptp1", Ifaces: []phc.TopologyIface{
+			{Name: "eth0", HWTstamp: &phc.HWTstampConfig{TXType: phc.HWTstampTXOn, RXFilter: phc.HWTstampFilterPTPv2}},
+			{Name: "eth1", HWTstamp: &phc.HWTstampConfig{}},
+			{Name: "eth2", HWTstampError: "operation not supported"},
+		}},
+	}}
+	require.Empty(t, checkTopology(topo, []string{"eth0"}))
+	require.Equal(t, []string{"eth3 has no PHC"}, checkTopology(topo, []string{"eth0", "eth3"}))
+	require.Equal(t, []string{
+		"eth1: hardware timestamps are disabled (tx_type 0, rx_filter 0)",
+		"eth2: can't read hardware timestamping setting: operation not supported",
+	}, checkTopology(topo, nil))
+}
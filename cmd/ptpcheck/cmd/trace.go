@@ -27,6 +27,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	ptp "github.com/facebook/time/ptp/protocol"
 	client "github.com/facebook/time/ptp/simpleclient"
 )
 
@@ -35,6 +36,11 @@ var traceDurationFlag time.Duration
 var traceTimeoutFlag time.Duration
 var traceIfaceFlag string
 var traceTimestampingFlag string
+var traceTransportFlag string
+var traceTunnelPortFlag int
+var traceInsecureTLSFlag bool
+var traceMastersFlag []string
+var traceLogQueryIntervalFlag int
 
 func init() {
 	RootCmd.AddCommand(traceCmd)
@@ -43,6 +49,11 @@ func init() {
 	traceCmd.Flags().StringVarP(&traceTimestampingFlag, "timestamping", "T", "", fmt.Sprintf("timestamping to use, either %q or %q. empty means auto-detection", client.HWTIMESTAMP, client.SWTIMESTAMP))
 	traceCmd.Flags().DurationVarP(&traceTimeoutFlag, "timeout", "t", 15*time.Second, "global timeout")
 	traceCmd.Flags().DurationVarP(&traceDurationFlag, "duration", "d", 10*time.Second, "duration of the exchange")
+	traceCmd.Flags().StringVarP(&traceTransportFlag, "transport", "", client.TransportUDP, fmt.Sprintf("transport to use, either %q, %q or %q. %q and %q are experimental and have reduced accuracy", client.TransportUDP, client.TransportTCP, client.TransportTLS, client.TransportTCP, client.TransportTLS))
+	traceCmd.Flags().IntVarP(&traceTunnelPortFlag, "tunnelport", "", 3190, "server port for tcp and tls transports")
+	traceCmd.Flags().BoolVarP(&traceInsecureTLSFlag, "insecure", "", false, "skip server certificate verification for tls transport")
+	traceCmd.Flags().StringSliceVarP(&traceMastersFlag, "masters", "M", nil, "unicast master table: potential servers to discover the best active one from, instead of --server. udp transport only")
+	traceCmd.Flags().IntVarP(&traceLogQueryIntervalFlag, "logqueryinterval", "", 0, "log2 of the interval unicast master table entries are queried at")
 }
 
 // reportMeasurements prints all data we collected over the course of communication
@@ -52,6 +63,9 @@ func reportMeasurements(history []*client.MeasurementResult) {
 		fmt.Println("No measurements collected")
 		return
 	}
+	if history[0].Transport != client.TransportUDP {
+		fmt.Printf("Collected over experimental %s transport, accuracy is reduced\n", history[0].Transport)
+	}
 	fmt.Println("Collected measurements:")
 	fmt.Fprintf(w, "N\t")
 	for i := range history {
@@ -131,12 +145,21 @@ Once negotiation is done, client and server exchange messages:
 
 When the duration client requested to receive messages passes, server may send CANCEL_UNICAST_TRANSMISSION packet to client
 to notify about this event. Clients responds with ACKNOWLEDGE_CANCEL_UNICAST_TRANSMISSION and that's all.
+
+With --masters the client is provisioned with a unicast master table instead of a single server, and discovers the server to talk to:
+1. client sends REQUEST_UNICAST_TRANSMISSION for ANNOUNCE messages to every server of the table,
+repeating it every query interval to servers which haven't answered yet.
+2. servers which grant ANNOUNCE messages send ANNOUNCE, servers announcing themselves as alternate masters are skipped.
+3. client selects the best of the remaining servers with BMCA, and cancels ANNOUNCE messages from the rest of them.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		ConfigureVerbosity()
 
-		if traceRemoteServerFlag == "" {
-			log.Fatal("remote server must be specified")
+		if traceRemoteServerFlag == "" && len(traceMastersFlag) == 0 {
+			log.Fatal("remote server or unicast master table must be specified")
+		}
+		if len(traceMastersFlag) > 0 && traceTransportFlag != client.TransportUDP {
+			log.Fatalf("unicast master table is only supported with %q transport", client.TransportUDP)
 		}
 		if traceDurationFlag > traceTimeoutFlag {
 			log.Fatal("duration must be less than timeout")
@@ -148,6 +171,12 @@ to notify about this event. Clients responds with ACKNOWLEDGE_CANCEL_UNICAST_TRA
 			Timeout:      traceTimeoutFlag,
 			Duration:     traceDurationFlag,
 			Timestamping: traceTimestampingFlag,
+			Transport:    traceTransportFlag,
+			Port:         traceTunnelPortFlag,
+			InsecureTLS:  traceInsecureTLSFlag,
+
+			UnicastMasterTable: traceMastersFlag,
+			LogQueryInterval:   ptp.LogInterval(traceLogQueryIntervalFlag),
 		}
 		if err := runTrace(cfg); err != nil {
 			log.Fatal(err)
@@ -0,0 +1,109 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/facebook/time/ptp/monitor"
+	"github.com/facebook/time/ptp/simpleclient"
+)
+
+func main() {
+	var (
+		verboseFlag        bool
+		serverFlag         string
+		ifaceFlag          string
+		timestampingFlag   string
+		durationFlag       time.Duration
+		retryIntervalFlag  time.Duration
+		monitoringPortFlag int
+		soakFlag           monitor.SoakConfig
+		soakReportFlag     string
+	)
+
+	flag.BoolVar(&verboseFlag, "verbose", false, "verbose output")
+	flag.StringVar(&serverFlag, "server", "", "PTP unicast server to monitor")
+	flag.StringVar(&ifaceFlag, "iface", "eth0", "network interface to use")
+	flag.StringVar(&timestampingFlag, "timestamping", simpleclient.HWTIMESTAMP, fmt.Sprintf("timestamping to use, either %q or %q", simpleclient.HWTIMESTAMP, simpleclient.SWTIMESTAMP))
+	flag.DurationVar(&durationFlag, "duration", time.Minute, "duration of unicast transmission requested in every session")
+	flag.DurationVar(&retryIntervalFlag, "retryinterval", 5*time.Second, "how long to wait before retrying a failed session")
+	flag.IntVar(&monitoringPortFlag, "monitoringport", 4270, "port to start monitoring http server on")
+	flag.DurationVar(&soakFlag.Duration, "soak", 0, "soak for this long verifying the invariants, then print the pass/fail JSON report and exit. 0 monitors forever")
+	flag.DurationVar(&soakFlag.MaxOffset, "soakmaxoffset", time.Millisecond, "soak fails if the absolute offset of any measurement exceeds this. 0 disables the check")
+	flag.IntVar(&soakFlag.MaxSessionErrors, "soakmaxsessionerrors", 0, "soak fails if more sessions fail, i.e. grant renewals are denied or yield no measurements")
+	flag.IntVar(&soakFlag.MaxSequenceGaps, "soakmaxsequencegaps", 0, "soak fails if more Syncs are missing from the sequence")
+	flag.StringVar(&soakReportFlag, "soakreport", "", "file to write the soak report to. Stdout if empty")
+
+	flag.Parse()
+
+	log.SetLevel(log.InfoLevel)
+	if verboseFlag {
+		log.SetLevel(log.DebugLevel)
+	}
+	if serverFlag == "" {
+		log.Fatal("server must be specified")
+	}
+	if durationFlag < time.Second {
+		log.Fatalf("duration must be at least a second, got %v", durationFlag)
+	}
+
+	cfg := &monitor.Config{
+		Server:        serverFlag,
+		Iface:         ifaceFlag,
+		Timestamping:  timestampingFlag,
+		Duration:      durationFlag,
+		RetryInterval: retryIntervalFlag,
+		Soak:          soakFlag,
+	}
+	stats := monitor.NewJSONStats()
+	go stats.Start(monitoringPortFlag)
+	if soakFlag.Duration > 0 {
+		report := monitor.New(cfg, stats).Soak(context.Background())
+		if err := writeReport(report, soakReportFlag); err != nil {
+			log.Fatal(err)
+		}
+		if !report.Passed {
+			os.Exit(1)
+		}
+		return
+	}
+	if err := monitor.New(cfg, stats).Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeReport writes the soak report as JSON to the file, or stdout if path is empty
+func writeReport(report *monitor.SoakReport, path string) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if path == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
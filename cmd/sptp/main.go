@@ -112,6 +112,9 @@ func updateSysStatsForever(sysstats *client.SysStats, statsserver client.StatsSe
 func doWork(cfg *client.Config) error {
 	stats := client.NewJSONStats()
 	sysstats := &client.SysStats{}
+	if err := stats.SetBackend(cfg.MonitoringBackend, cfg.StatsD); err != nil {
+		return err
+	}
 	go updateSysStatsForever(sysstats, stats, cfg.MetricsAggregationWindow)
 	go stats.Start(cfg.MonitoringPort)
 	p, err := client.NewSPTP(cfg, stats)
@@ -131,6 +134,7 @@ func main() {
 		dscpFlag           int
 		configFlag         string
 		pprofFlag          string
+		backendFlag        string
 	)
 
 	flag.BoolVar(&verboseFlag, "verbose", false, "verbose output")
@@ -140,6 +144,7 @@ func main() {
 	flag.IntVar(&dscpFlag, "dscp", 0, "DSCP for PTP packets, valid values are between 0-63 (used by send workers)")
 	flag.DurationVar(&intervalFlag, "interval", time.Second, "how often to send DelayReq to each GM")
 	flag.StringVar(&pprofFlag, "pprof", "", "Address to have the profiler listen on, disabled if empty.")
+	flag.StringVar(&backendFlag, "monitoringbackend", "", "monitoring backend shared with ptp4u: json, prometheus adds /metrics, statsd pushes to the agent of the config. JSON is always served")
 
 	flag.Parse()
 
@@ -151,6 +156,9 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if backendFlag != "" {
+		cfg.MonitoringBackend = backendFlag
+	}
 	if pprofFlag != "" {
 		go func() {
 			err = http.ListenAndServe(pprofFlag, nil)
@@ -32,6 +32,11 @@ type Config struct {
 	Interval                    time.Duration // how often do we poll ptp4l and update data in shm
 	Iface                       string        // network interface to use
 	LinearizabilityTestInterval time.Duration // perform the linearizability test every so often
+	HistoryBackend              string        // where DataPoints are kept: memory (default), file or sqlite
+	HistoryPath                 string        // file or database of the durable history backends
+	HistoryRetention            time.Duration // how long durable backends keep DataPoints on top of the ring size
+	EventRingPath               string        // shared memory ring every DataPoint is published to with its error bound, disabled if empty
+	EventRingSize               int           // number of records the event ring keeps
 }
 
 // EvalAndValidate makes sure config is valid and evaluates expressions for further use.
@@ -42,6 +47,24 @@ func (c *Config) EvalAndValidate() error {
 	if c.RingSize <= 0 {
 		return fmt.Errorf("bad config: 'ringsize' must be >0")
 	}
+	switch c.HistoryBackend {
+	case "", HistoryMemory:
+	case HistoryFile, HistorySQLite:
+		if c.HistoryPath == "" {
+			return fmt.Errorf("bad config: 'historypath' is required for %s history", c.HistoryBackend)
+		}
+		if c.HistoryBackend == HistorySQLite && !sqliteSupported {
+			return fmt.Errorf("bad config: %w", ErrSQLiteUnsupported)
+		}
+	default:
+		return fmt.Errorf("bad config: unsupported 'historybackend' %q", c.HistoryBackend)
+	}
+	if c.HistoryRetention < 0 {
+		return fmt.Errorf("bad config: 'historyretention' must be >=0")
+	}
+	if c.EventRingPath != "" && c.EventRingSize <= 0 {
+		return fmt.Errorf("bad config: 'eventringsize' must be >0")
+	}
 	if c.Interval > time.Minute {
 		return fmt.Errorf("bad config: 'interval' is over a minute")
 	}
@@ -28,6 +28,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/facebook/time/fbclock"
+	"github.com/facebook/time/fbclock/ring"
 
 	"github.com/facebook/time/ptp/linearizability"
 
@@ -96,9 +97,11 @@ type Daemon struct {
 	state *daemonState
 	stats StatsServer
 	l     Logger
+	// ring the DataPoints are published to for other processes. Disabled if nil
+	events *ring.Writer
 
-	// function to get PHC time from configured PHC device
-	getPHCTime func() (time.Time, error)
+	// function to get PHC time and its read uncertainty from configured PHC device
+	getPHCTime func() (time.Time, time.Duration, error)
 	// function to get PHC freq from configured PHC device
 	getPHCFreqPPB func() (float64, error)
 }
@@ -113,29 +116,43 @@ func minRingSize(configuredRingSize int, interval time.Duration) int {
 	return size
 }
 
+// window is the aggregation window, how long the DataPoints of the ring buffer span.
+// Older DataPoints were collected before a gap, they are not used for the calculated values
+func (s *Daemon) window() time.Duration {
+	return time.Duration(minRingSize(s.cfg.RingSize, s.cfg.Interval)) * s.cfg.Interval
+}
+
 // New creates new fbclock-daemon
 func New(cfg *Config, stats StatsServer, l Logger, dataFetcher DataFetcher) (*Daemon, error) {
 	// we need at least 1m of samples for aggregate values
 	effectiveRingSize := minRingSize(cfg.RingSize, cfg.Interval)
+	history, err := NewHistory(cfg.HistoryBackend, cfg.HistoryPath, effectiveRingSize, cfg.HistoryRetention)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s measurement history: %w", cfg.HistoryBackend, err)
+	}
 	s := &Daemon{
 		stats:       stats,
-		state:       newDaemonState(effectiveRingSize),
+		state:       newDaemonStateWithHistory(effectiveRingSize, history),
 		cfg:         cfg,
 		l:           l,
 		DataFetcher: dataFetcher,
 	}
 	phcDevice, err := phc.IfaceToPHCDevice(cfg.Iface)
 	if err != nil {
+		history.Close()
 		return nil, fmt.Errorf("finding PHC device for %q: %w", cfg.Iface, err)
 	}
 	// function to get time from phc
-	s.getPHCTime = func() (time.Time, error) { return phc.TimeFromDevice(phcDevice) }
+	s.getPHCTime = func() (time.Time, time.Duration, error) {
+		return phc.TimeWithUncertaintyFromDevice(phcDevice, phc.MethodSyscallClockGettime)
+	}
 	s.getPHCFreqPPB = func() (float64, error) { return phc.FrequencyPPBFromDevice(phcDevice) }
 	// calculated values
 	s.stats.SetCounter("m_ns", 0)
 	s.stats.SetCounter("w_ns", 0)
 	s.stats.SetCounter("drift_ppb", 0)
 	s.stats.SetCounter("time_since_ingress_ns", 0)
+	s.stats.SetCounter("phc_read_uncertainty_ns", 0)
 	// error counters
 	s.stats.SetCounter("data_error", 0)
 	s.stats.SetCounter("phc_error", 0)
@@ -155,7 +172,7 @@ func New(cfg *Config, stats StatsServer, l Logger, dataFetcher DataFetcher) (*Da
 }
 
 func (s *Daemon) calcW() (float64, error) {
-	lastN := s.state.takeDataPoint(s.cfg.RingSize)
+	lastN := s.state.takeDataPoint(s.cfg.RingSize, s.window())
 	if len(lastN) != s.cfg.RingSize {
 		return 0, fmt.Errorf("%w getting M: want %d, got %d", errNotEnoughData, s.cfg.RingSize, len(lastN))
 	}
@@ -208,7 +225,7 @@ func (s *Daemon) calcW() (float64, error) {
 }
 
 func (s *Daemon) calcDriftPPB() (float64, error) {
-	lastN := s.state.takeDataPoint(s.cfg.RingSize)
+	lastN := s.state.takeDataPoint(s.cfg.RingSize, s.window())
 	if len(lastN) != s.cfg.RingSize {
 		return 0, fmt.Errorf("%w calculating drift: want %d, got %d", errNotEnoughData, s.cfg.RingSize, len(lastN))
 	}
@@ -265,9 +282,10 @@ func (s *Daemon) doWork(shm *fbclock.Shm, data *DataPoint) error {
 	s.stats.SetCounter("clock_accuracy_ns", int64(data.ClockAccuracyNS))
 	// try and calculate how long ago was the ingress time
 	// use clock_gettime as the fastest and widely available method
-	if phcTime, err := s.getPHCTime(); err != nil {
+	if phcTime, uncertainty, err := s.getPHCTime(); err != nil {
 		log.Warningf("Failed to get PHC time from %s: %v", s.cfg.Iface, err)
 	} else {
+		s.stats.SetCounter("phc_read_uncertainty_ns", uncertainty.Nanoseconds())
 		if data.IngressTimeNS > 0 {
 			s.state.updateIngressTimeNS(data.IngressTimeNS)
 		}
@@ -292,8 +310,17 @@ func (s *Daemon) doWork(shm *fbclock.Shm, data *DataPoint) error {
 	if err := fbclock.StoreFBClockData(shm.File.Fd(), *d); err != nil {
 		return err
 	}
+	s.events.Publish(ring.Record{
+		IngressTimeNS:        data.IngressTimeNS,
+		MasterOffsetNS:       data.MasterOffsetNS,
+		PathDelayNS:          data.PathDelayNS,
+		FreqAdjustmentPPB:    data.FreqAdjustmentPPB,
+		ClockAccuracyNS:      data.ClockAccuracyNS,
+		ErrorBoundNS:         float64(d.ErrorBoundNS),
+		HoldoverMultiplierNS: d.HoldoverMultiplierNS,
+	})
 	// aggregated stats over 1 minute
-	maxDp := s.state.aggregateDataPointsMax(minRingSize(s.cfg.RingSize, s.cfg.Interval))
+	maxDp := s.state.aggregateDataPointsMax(minRingSize(s.cfg.RingSize, s.cfg.Interval), s.window())
 	s.stats.SetCounter("master_offset_ns.60.abs_max", int64(maxDp.MasterOffsetNS))
 	s.stats.SetCounter("path_delay_ns.60.abs_max", int64(maxDp.PathDelayNS))
 	s.stats.SetCounter("freq_adj_ppb.60.abs_max", int64(maxDp.FreqAdjustmentPPB))
@@ -328,7 +355,7 @@ func (s *Daemon) runLinearizabilityTests(ctx context.Context) {
 
 	ticker := time.NewTicker(s.cfg.LinearizabilityTestInterval)
 	defer ticker.Stop()
-	for ; true; <-ticker.C { // first run without delay, then at interval
+	for ; ctx.Err() == nil; waitTick(ctx, ticker.C) { // first run without delay, then at interval until cancelled
 		eg := new(errgroup.Group)
 		currentResults := map[string]*linearizability.TestResult{}
 
@@ -404,20 +431,41 @@ func (s *Daemon) runLinearizabilityTests(ctx context.Context) {
 	}
 }
 
-// Run a daemon
+// waitTick waits for the next tick unless the context is cancelled first
+func waitTick(ctx context.Context, tick <-chan time.Time) {
+	select {
+	case <-ctx.Done():
+	case <-tick:
+	}
+}
+
+// Run a daemon until the context is cancelled
 func (s *Daemon) Run(ctx context.Context) error {
+	defer func() {
+		if err := s.state.history.Close(); err != nil {
+			log.Errorf("closing measurement history: %v", err)
+		}
+	}()
 	shm, err := fbclock.OpenFBClockSHM()
 	if err != nil {
 		return fmt.Errorf("opening fbclock shm: %w", err)
 	}
 	defer shm.Close()
 
+	if s.cfg.EventRingPath != "" {
+		s.events, err = ring.Create(s.cfg.EventRingPath, s.cfg.EventRingSize)
+		if err != nil {
+			return fmt.Errorf("creating event ring: %w", err)
+		}
+		defer s.events.Close()
+	}
+
 	if s.cfg.LinearizabilityTestInterval != 0 {
 		go s.runLinearizabilityTests(ctx)
 	}
 	ticker := time.NewTicker(s.cfg.Interval)
 	defer ticker.Stop()
-	for ; true; <-ticker.C { // first run without delay, then at interval
+	for ; ctx.Err() == nil; waitTick(ctx, ticker.C) { // first run without delay, then at interval until cancelled
 		data, err := s.DataFetcher.FetchStats(s.cfg)
 		if err != nil {
 			log.Error(err)
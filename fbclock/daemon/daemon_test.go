@@ -18,6 +18,7 @@ package daemon
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/facebook/time/fbclock"
+	"github.com/facebook/time/fbclock/ring"
 	"github.com/facebook/time/ptp/linearizability"
 
 	ptp "github.com/facebook/time/ptp/protocol"
@@ -102,7 +104,7 @@ func TestDaemonStateAggregateMax(t *testing.T) {
 	for _, tr := range probes {
 		s.pushDataPoint(tr)
 	}
-	got := s.aggregateDataPointsMax(3)
+	got := s.aggregateDataPointsMax(3, 3*time.Second)
 	want := &DataPoint{
 		MasterOffsetNS:    2000.0,
 		PathDelayNS:       300,
@@ -111,6 +113,49 @@ func TestDaemonStateAggregateMax(t *testing.T) {
 	require.Equal(t, want, got)
 }
 
+func TestDaemonStateTakeDataPointWindow(t *testing.T) {
+	s := newDaemonState(4)
+
+	// data points from before the gap
+	s.pushDataPoint(testDataPoint(1))
+	s.pushDataPoint(testDataPoint(10))
+	s.pushDataPoint(testDataPoint(11))
+	s.pushDataPoint(testDataPoint(12))
+
+	got := s.takeDataPoint(4, 4*time.Second)
+	require.Equal(t, []*DataPoint{testDataPoint(12), testDataPoint(11), testDataPoint(10)}, got)
+	got = s.takeDataPoint(4, time.Minute)
+	require.Len(t, got, 4)
+
+	maxDp := s.aggregateDataPointsMax(4, 4*time.Second)
+	require.Equal(t, float64(12), maxDp.MasterOffsetNS)
+	require.Equal(t, float64(12), maxDp.FreqAdjustmentPPB)
+}
+
+func TestDaemonStateHistoryRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := NewHistory(HistoryFile, path, 3, 0)
+	require.NoError(t, err)
+	s := newDaemonStateWithHistory(3, h)
+	for i := 1; i <= 3; i++ {
+		s.pushDataPoint(testDataPoint(i))
+	}
+	require.NoError(t, h.Close())
+
+	// data points of the previous run are kept for analysis only
+	h, err = NewHistory(HistoryFile, path, 3, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	s = newDaemonStateWithHistory(3, h)
+	require.Empty(t, s.takeDataPoint(3, time.Minute))
+	s.pushDataPoint(testDataPoint(4))
+	require.Equal(t, []*DataPoint{testDataPoint(4)}, s.takeDataPoint(3, time.Minute))
+
+	got, err := h.Last(3)
+	require.NoError(t, err)
+	require.Equal(t, []*DataPoint{testDataPoint(4), testDataPoint(3), testDataPoint(2)}, got)
+}
+
 func TestTargetsChange(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -470,7 +515,9 @@ func TestDaemonDoWork(t *testing.T) {
 	startTime := time.Duration(1647359186979431900)
 	phcTime := startTime // we modify this during the test
 	// override function to get PHC time
-	s.getPHCTime = func() (time.Time, error) { return time.Unix(0, int64(phcTime)), nil }
+	s.getPHCTime = func() (time.Time, time.Duration, error) {
+		return time.Unix(0, int64(phcTime)), 50 * time.Nanosecond, nil
+	}
 	// shared mem
 	tmpFile, err := os.CreateTemp("", "daemon_test")
 	require.NoError(t, err)
@@ -478,6 +525,13 @@ func TestDaemonDoWork(t *testing.T) {
 	shm, err := fbclock.OpenFBClockShmCustom(tmpFile.Name())
 	require.NoError(t, err)
 	defer shm.Close()
+	ringPath := filepath.Join(t.TempDir(), "ring")
+	s.events, err = ring.Create(ringPath, 16)
+	require.NoError(t, err)
+	defer s.events.Close()
+	events, err := ring.Open(ringPath)
+	require.NoError(t, err)
+	defer events.Close()
 
 	// populate the data
 	var d *DataPoint
@@ -526,6 +580,7 @@ func TestDaemonDoWork(t *testing.T) {
 		// check exported stats
 		require.Equal(t, int64(tme), stats.counters["ingress_time_ns"])
 		require.Equal(t, int64(time.Microsecond), stats.counters["time_since_ingress_ns"])
+		require.Equal(t, int64(50), stats.counters["phc_read_uncertainty_ns"])
 		require.Equal(t, int64(d.MasterOffsetNS), stats.counters["master_offset_ns"])
 		require.Equal(t, int64(d.PathDelayNS), stats.counters["path_delay_ns"])
 		require.Equal(t, int64(d.FreqAdjustmentPPB), stats.counters["freq_adj_ppb"])
@@ -584,6 +639,22 @@ func TestDaemonDoWork(t *testing.T) {
 	require.Equal(t, want.ErrorBoundNS, got.ErrorBoundNS)
 	require.InDelta(t, want.HoldoverMultiplierNS, got.HoldoverMultiplierNS, 0.001)
 
+	// and published it to the event ring, once
+	rec, ok := events.Next()
+	require.True(t, ok)
+	require.Equal(t, ring.Record{
+		IngressTimeNS:        d.IngressTimeNS,
+		MasterOffsetNS:       d.MasterOffsetNS,
+		PathDelayNS:          d.PathDelayNS,
+		FreqAdjustmentPPB:    d.FreqAdjustmentPPB,
+		ClockAccuracyNS:      d.ClockAccuracyNS,
+		ErrorBoundNS:         48,
+		HoldoverMultiplierNS: rec.HoldoverMultiplierNS,
+	}, rec)
+	require.InDelta(t, want.HoldoverMultiplierNS, rec.HoldoverMultiplierNS, 0.001)
+	_, ok = events.Next()
+	require.False(t, ok)
+
 	// ptp4l has a hiccup, but that should be okay
 	d = &DataPoint{
 		IngressTimeNS:     0,
@@ -0,0 +1,238 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemon
+
+import (
+	"bufio"
+	"container/ring"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Measurement history backends
+const (
+	// HistoryMemory keeps the history in memory, it's lost on restart
+	HistoryMemory = "memory"
+	// HistoryFile keeps the history in a file of JSON lines
+	HistoryFile = "file"
+	// HistorySQLite keeps the history in an SQLite database
+	HistorySQLite = "sqlite"
+)
+
+// History stores the DataPoints collected from the PTP client
+type History interface {
+	// Push stores the data point
+	Push(d *DataPoint) error
+	// Last returns up to n latest data points, the newest first
+	Last(n int) ([]*DataPoint, error)
+	// Close releases the storage
+	Close() error
+}
+
+// ErrSQLiteUnsupported is returned for the sqlite backend when the daemon is built without the sqlite tag.
+// The backend links SQLite with cgo, so it's left out of the default builds
+var ErrSQLiteUnsupported = errors.New("sqlite history needs fbclock-daemon built with the sqlite tag")
+
+// NewHistory returns the history of the backend, keeping at least size latest data points.
+// Durable backends keep the data points of the retention on top of it
+func NewHistory(backend, path string, size int, retention time.Duration) (History, error) {
+	switch backend {
+	case "", HistoryMemory:
+		return newMemoryHistory(size), nil
+	case HistoryFile:
+		return newFileHistory(path, size, retention)
+	case HistorySQLite:
+		return newSQLiteHistory(path, size, retention)
+	}
+	return nil, fmt.Errorf("unsupported history backend %q", backend)
+}
+
+// memoryHistory is a ring buffer of the latest data points
+type memoryHistory struct {
+	r *ring.Ring
+}
+
+func newMemoryHistory(size int) *memoryHistory {
+	// ring buffer is initialized with nils
+	return &memoryHistory{r: ring.New(size)}
+}
+
+// Push stores the data point, overwriting the oldest one
+func (h *memoryHistory) Push(d *DataPoint) error {
+	h.r.Value = d
+	h.r = h.r.Next()
+	return nil
+}
+
+// Last returns up to n latest data points, the newest first
+func (h *memoryHistory) Last(n int) ([]*DataPoint, error) {
+	if n > h.r.Len() {
+		n = h.r.Len()
+	}
+	result := []*DataPoint{}
+	r := h.r.Prev()
+	for j := 0; j < n; j++ {
+		if r.Value == nil {
+			continue
+		}
+		result = append(result, r.Value.(*DataPoint))
+		r = r.Prev()
+	}
+	return result, nil
+}
+
+// Close does nothing
+func (h *memoryHistory) Close() error {
+	return nil
+}
+
+// retained returns the data points to keep out of all of them, oldest first:
+// the latest size ones and the ones within the retention of the newest
+func retained(points []*DataPoint, size int, retention time.Duration) []*DataPoint {
+	if len(points) == 0 {
+		return points
+	}
+	first := len(points) - size
+	if first < 0 {
+		first = 0
+	}
+	cutoff := points[len(points)-1].IngressTimeNS - retention.Nanoseconds()
+	for first > 0 && points[first-1].IngressTimeNS >= cutoff {
+		first--
+	}
+	return points[first:]
+}
+
+// fileHistory appends the data points to a file of JSON lines and serves them from memory.
+// The file is compacted down to the retained data points when it has grown twice as big
+type fileHistory struct {
+	path      string
+	size      int
+	retention time.Duration
+
+	mem *memoryHistory
+	f   *os.File
+	// number of data points in the file and after the last compaction
+	lines     int
+	compacted int
+}
+
+func newFileHistory(path string, size int, retention time.Duration) (*fileHistory, error) {
+	h := &fileHistory{path: path, size: size, retention: retention}
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// read returns all data points of the file, oldest first. Malformed lines, like the last one
+// written on a crash, are skipped
+func (h *fileHistory) read() ([]*DataPoint, error) {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	points := []*DataPoint{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		d := &DataPoint{}
+		if err := json.Unmarshal(scanner.Bytes(), d); err != nil {
+			continue
+		}
+		points = append(points, d)
+	}
+	return points, scanner.Err()
+}
+
+// compact rewrites the file with the retained data points and reopens it for appending
+func (h *fileHistory) compact() error {
+	points, err := h.read()
+	if err != nil {
+		return fmt.Errorf("reading history %s: %w", h.path, err)
+	}
+	points = retained(points, h.size, h.retention)
+	tmp := h.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, d := range points {
+		if err := enc.Encode(d); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+	if h.f != nil {
+		h.f.Close()
+	}
+	if h.f, err = os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	h.mem = newMemoryHistory(h.size)
+	for _, d := range points {
+		_ = h.mem.Push(d)
+	}
+	h.lines = len(points)
+	h.compacted = len(points)
+	return nil
+}
+
+// Push appends the data point to the file
+func (h *fileHistory) Push(d *DataPoint) error {
+	_ = h.mem.Push(d)
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if _, err := h.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("writing history %s: %w", h.path, err)
+	}
+	h.lines++
+	if h.lines >= 2*h.compacted && h.lines > h.size {
+		return h.compact()
+	}
+	return nil
+}
+
+// Last returns up to n latest data points, the newest first
+func (h *fileHistory) Last(n int) ([]*DataPoint, error) {
+	return h.mem.Last(n)
+}
+
+// Close closes the file
+func (h *fileHistory) Close() error {
+	return h.f.Close()
+}
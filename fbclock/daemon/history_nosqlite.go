@@ -0,0 +1,32 @@
+//go:build !sqlite
+// +build !sqlite
+
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemon
+
+import (
+	"time"
+)
+
+// sqliteSupported reports the daemon is built with the sqlite tag
+const sqliteSupported = false
+
+// newSQLiteHistory is not supported in this build
+func newSQLiteHistory(_ string, _ int, _ time.Duration) (History, error) {
+	return nil, ErrSQLiteUnsupported
+}
@@ -0,0 +1,105 @@
+//go:build sqlite
+// +build sqlite
+
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemon
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	// registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteHistorySchema = `CREATE TABLE IF NOT EXISTS datapoints (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	ingress_time_ns INTEGER NOT NULL,
+	master_offset_ns REAL NOT NULL,
+	path_delay_ns REAL NOT NULL,
+	freq_adjustment_ppb REAL NOT NULL,
+	clock_accuracy_ns REAL NOT NULL
+)`
+
+// sqliteSupported reports the daemon is built with the sqlite tag
+const sqliteSupported = true
+
+// sqliteHistory keeps the data points in an SQLite database, so they can be queried for analysis
+type sqliteHistory struct {
+	db        *sql.DB
+	size      int
+	retention time.Duration
+}
+
+func newSQLiteHistory(path string, size int, retention time.Duration) (*sqliteHistory, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteHistorySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating history schema in %s: %w", path, err)
+	}
+	return &sqliteHistory{db: db, size: size, retention: retention}, nil
+}
+
+// Push inserts the data point and drops the ones which are no longer retained
+func (h *sqliteHistory) Push(d *DataPoint) error {
+	res, err := h.db.Exec(
+		"INSERT INTO datapoints (ingress_time_ns, master_offset_ns, path_delay_ns, freq_adjustment_ppb, clock_accuracy_ns) VALUES (?, ?, ?, ?, ?)",
+		d.IngressTimeNS, d.MasterOffsetNS, d.PathDelayNS, d.FreqAdjustmentPPB, d.ClockAccuracyNS,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting into history: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = h.db.Exec(
+		"DELETE FROM datapoints WHERE id <= ? AND ingress_time_ns < ?",
+		id-int64(h.size), d.IngressTimeNS-h.retention.Nanoseconds(),
+	)
+	return err
+}
+
+// Last returns up to n latest data points, the newest first
+func (h *sqliteHistory) Last(n int) ([]*DataPoint, error) {
+	rows, err := h.db.Query(
+		"SELECT ingress_time_ns, master_offset_ns, path_delay_ns, freq_adjustment_ppb, clock_accuracy_ns FROM datapoints ORDER BY id DESC LIMIT ?", n,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying history: %w", err)
+	}
+	defer rows.Close()
+	result := []*DataPoint{}
+	for rows.Next() {
+		d := &DataPoint{}
+		if err := rows.Scan(&d.IngressTimeNS, &d.MasterOffsetNS, &d.PathDelayNS, &d.FreqAdjustmentPPB, &d.ClockAccuracyNS); err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+// Close closes the database
+func (h *sqliteHistory) Close() error {
+	return h.db.Close()
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testDataPoint(i int) *DataPoint {
+	return &DataPoint{
+		IngressTimeNS:     int64(i) * time.Second.Nanoseconds(),
+		MasterOffsetNS:    float64(i),
+		PathDelayNS:       float64(100 + i),
+		FreqAdjustmentPPB: float64(-i),
+		ClockAccuracyNS:   25,
+	}
+}
+
+// skipUnsupported skips the tests of the backends left out of the build
+func skipUnsupported(t *testing.T, backend string) {
+	if backend != HistorySQLite || sqliteSupported {
+		return
+	}
+	_, err := NewHistory(backend, filepath.Join(t.TempDir(), "history"), 3, 0)
+	require.ErrorIs(t, err, ErrSQLiteUnsupported)
+	t.Skip(err)
+}
+
+func TestHistoryBackends(t *testing.T) {
+	for _, backend := range []string{HistoryMemory, HistoryFile, HistorySQLite} {
+		t.Run(backend, func(t *testing.T) {
+			skipUnsupported(t, backend)
+			h, err := NewHistory(backend, filepath.Join(t.TempDir(), "history"), 3, 0)
+			require.NoError(t, err)
+			defer h.Close()
+
+			got, err := h.Last(3)
+			require.NoError(t, err)
+			require.Empty(t, got)
+
+			for i := 1; i <= 5; i++ {
+				require.NoError(t, h.Push(testDataPoint(i)))
+			}
+			got, err = h.Last(2)
+			require.NoError(t, err)
+			require.Equal(t, []*DataPoint{testDataPoint(5), testDataPoint(4)}, got)
+			got, err = h.Last(10)
+			require.NoError(t, err)
+			require.Equal(t, []*DataPoint{testDataPoint(5), testDataPoint(4), testDataPoint(3)}, got)
+		})
+	}
+
+	_, err := NewHistory("tape", "", 3, 0)
+	require.Error(t, err)
+}
+
+func TestHistoryDurable(t *testing.T) {
+	for _, backend := range []string{HistoryFile, HistorySQLite} {
+		t.Run(backend, func(t *testing.T) {
+			skipUnsupported(t, backend)
+			path := filepath.Join(t.TempDir(), "history")
+			h, err := NewHistory(backend, path, 3, 0)
+			require.NoError(t, err)
+			for i := 1; i <= 10; i++ {
+				require.NoError(t, h.Push(testDataPoint(i)))
+			}
+			require.NoError(t, h.Close())
+
+			// history survives the restart
+			h, err = NewHistory(backend, path, 3, 0)
+			require.NoError(t, err)
+			defer h.Close()
+			got, err := h.Last(3)
+			require.NoError(t, err)
+			require.Equal(t, []*DataPoint{testDataPoint(10), testDataPoint(9), testDataPoint(8)}, got)
+		})
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	for _, backend := range []string{HistoryFile, HistorySQLite} {
+		t.Run(backend, func(t *testing.T) {
+			skipUnsupported(t, backend)
+			path := filepath.Join(t.TempDir(), "history")
+			h, err := NewHistory(backend, path, 2, 5*time.Second)
+			require.NoError(t, err)
+			for i := 1; i <= 20; i++ {
+				require.NoError(t, h.Push(testDataPoint(i)))
+			}
+			require.NoError(t, h.Close())
+
+			h, err = NewHistory(backend, path, 2, 5*time.Second)
+			require.NoError(t, err)
+			defer h.Close()
+			// the last 5 seconds are kept on top of the ring size
+			got, err := h.Last(20)
+			require.NoError(t, err)
+			if backend == HistoryFile {
+				// but only the ring size is served from memory
+				require.Equal(t, []*DataPoint{testDataPoint(20), testDataPoint(19)}, got)
+				points, err := h.(*fileHistory).read()
+				require.NoError(t, err)
+				require.Equal(t, []*DataPoint{testDataPoint(15), testDataPoint(16), testDataPoint(17), testDataPoint(18), testDataPoint(19), testDataPoint(20)}, points)
+				return
+			}
+			require.Equal(t, 6, len(got))
+			require.Equal(t, testDataPoint(15), got[5])
+		})
+	}
+}
+
+func TestFileHistoryCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	// line torn by a crash is skipped
+	require.NoError(t, os.WriteFile(path, []byte(`{"IngressTimeNS":1000000000,"MasterOffsetNS":1,"PathDelayNS":101,"FreqAdjustmentPPB":-1,"ClockAccuracyNS":25}
+{"IngressTimeNS":2000`), 0644))
+	h, err := newFileHistory(path, 3, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	got, err := h.Last(3)
+	require.NoError(t, err)
+	require.Equal(t, []*DataPoint{testDataPoint(1)}, got)
+
+	for i := 2; i <= 7; i++ {
+		require.NoError(t, h.Push(testDataPoint(i)))
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	// compacted down to 3 lines at 4 lines and again at 6
+	require.Equal(t, 3, strings.Count(string(data), "\n"))
+}
+
+func TestRetained(t *testing.T) {
+	points := []*DataPoint{testDataPoint(1), testDataPoint(2), testDataPoint(3), testDataPoint(10)}
+	require.Equal(t, points[2:], retained(points, 2, 0))
+	require.Equal(t, points[2:], retained(points, 2, 7*time.Second))
+	require.Equal(t, points[1:], retained(points, 2, 8*time.Second))
+	require.Equal(t, points, retained(points, 10, 0))
+	require.Empty(t, retained(nil, 2, time.Second))
+}
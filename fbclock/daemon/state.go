@@ -20,15 +20,18 @@ import (
 	"container/ring"
 	"math"
 	"sync"
+	"time"
 
 	"github.com/facebook/time/ptp/linearizability"
+	log "github.com/sirupsen/logrus"
 )
 
 // state of the daemon, guarded by mutex
 type daemonState struct {
 	sync.Mutex
 
-	DataPoints                 *ring.Ring // DataPoints we collected from ptp4l
+	DataPoints                 *ring.Ring // DataPoints we collected from ptp4l since start
+	history                    History    // DataPoints kept for analysis, including the ones of previous runs
 	mmms                       *ring.Ring // M values we calculated
 	linearizabilityTestResults *ring.Ring // linearizability test results
 
@@ -36,8 +39,13 @@ type daemonState struct {
 }
 
 func newDaemonState(ringSize int) *daemonState {
+	return newDaemonStateWithHistory(ringSize, newMemoryHistory(ringSize))
+}
+
+func newDaemonStateWithHistory(ringSize int, history History) *daemonState {
 	s := &daemonState{
 		DataPoints:                 ring.New(ringSize),
+		history:                    history,
 		mmms:                       ring.New(ringSize),
 		linearizabilityTestResults: ring.New(ringSize),
 	}
@@ -72,33 +80,41 @@ func (s *daemonState) pushDataPoint(data *DataPoint) {
 	defer s.Unlock()
 	s.DataPoints.Value = data
 	s.DataPoints = s.DataPoints.Next()
+	if err := s.history.Push(data); err != nil {
+		log.Errorf("Failed to store data point: %v", err)
+	}
 }
 
-func (s *daemonState) takeDataPoint(n int) []*DataPoint {
-	s.Lock()
-	defer s.Unlock()
+// lastDataPoints returns up to n latest DataPoints, the newest first,
+// skipping the ones ingressed more than window before the newest. Zero window keeps all of them
+func (s *daemonState) lastDataPoints(n int, window time.Duration) []*DataPoint {
 	result := []*DataPoint{}
 	r := s.DataPoints.Prev()
 	for j := 0; j < n; j++ {
 		if r.Value == nil {
 			continue
 		}
-		result = append(result, r.Value.(*DataPoint))
+		dp := r.Value.(*DataPoint)
+		if window > 0 && len(result) > 0 && dp.IngressTimeNS < result[0].IngressTimeNS-window.Nanoseconds() {
+			break
+		}
+		result = append(result, dp)
 		r = r.Prev()
 	}
 	return result
 }
 
-func (s *daemonState) aggregateDataPointsMax(n int) *DataPoint {
+func (s *daemonState) takeDataPoint(n int, window time.Duration) []*DataPoint {
+	s.Lock()
+	defer s.Unlock()
+	return s.lastDataPoints(n, window)
+}
+
+func (s *daemonState) aggregateDataPointsMax(n int, window time.Duration) *DataPoint {
 	s.Lock()
 	defer s.Unlock()
 	d := &DataPoint{}
-	r := s.DataPoints.Prev()
-	for j := 0; j < n; j++ {
-		if r.Value == nil {
-			continue
-		}
-		dp := r.Value.(*DataPoint)
+	for _, dp := range s.lastDataPoints(n, window) {
 		if math.Abs(dp.MasterOffsetNS) > d.MasterOffsetNS {
 			d.MasterOffsetNS = math.Abs(dp.MasterOffsetNS)
 		}
@@ -108,7 +124,6 @@ func (s *daemonState) aggregateDataPointsMax(n int) *DataPoint {
 		if math.Abs(dp.FreqAdjustmentPPB) > d.FreqAdjustmentPPB {
 			d.FreqAdjustmentPPB = math.Abs(dp.FreqAdjustmentPPB)
 		}
-		r = r.Prev()
 	}
 	return d
 }
@@ -27,22 +27,55 @@ package fbclock
 import "C"
 
 import (
+	"errors"
 	"fmt"
 	"time"
 	"unsafe"
 )
 
+var (
+	// ErrNoData means the daemon publishes no synchronization data, e.g. when PTP sync is lost
+	ErrNoData = errors.New("no data from daemon")
+	// ErrBoundExceeded means the error bound of the time is above the required one, e.g. after too long holdover
+	ErrBoundExceeded = errors.New("error bound exceeded")
+)
+
 func strerror(errCode C.int) string {
 	cStr := C.fbclock_strerror(errCode)
 	return C.GoString(cStr)
 }
 
+// codeError returns the error of the fbclock error code, the sentinel one where there is
+func codeError(errCode C.int) error {
+	switch errCode {
+	case C.FBCLOCK_E_NO_DATA:
+		return ErrNoData
+	case C.FBCLOCK_E_WOU_TOO_BIG:
+		return fmt.Errorf("%w: %s", ErrBoundExceeded, strerror(errCode))
+	default:
+		return errors.New(strerror(errCode))
+	}
+}
+
 // TrueTime is a time interval we are confident the clock is right now
 type TrueTime struct {
 	Earliest time.Time
 	Latest   time.Time
 }
 
+// ErrorBound returns the half width of the interval, the maximum error of its middle
+func (tt *TrueTime) ErrorBound() time.Duration {
+	return tt.Latest.Sub(tt.Earliest) / 2
+}
+
+// Within returns ErrBoundExceeded if the error bound of the interval is above maxError
+func (tt *TrueTime) Within(maxError time.Duration) error {
+	if b := tt.ErrorBound(); b > maxError {
+		return fmt.Errorf("%w: %v is above %v", ErrBoundExceeded, b, maxError)
+	}
+	return nil
+}
+
 // FBClock wraps around fbclock C lib
 type FBClock struct {
 	cFBClock *C.fbclock_lib
@@ -79,7 +112,7 @@ func (f *FBClock) GetTime() (*TrueTime, error) {
 	tt := &C.fbclock_truetime{}
 	errCode := C.fbclock_gettime(f.cFBClock, tt)
 	if errCode != 0 {
-		return nil, fmt.Errorf("reading FBClock TrueTime: %s", strerror(errCode))
+		return nil, fmt.Errorf("reading FBClock TrueTime: %w", codeError(errCode))
 	}
 
 	earliest := time.Unix(0, int64(tt.earliest_ns))
@@ -87,3 +120,17 @@ func (f *FBClock) GetTime() (*TrueTime, error) {
 
 	return &TrueTime{Earliest: earliest, Latest: latest}, nil
 }
+
+// GetTimeWithin returns TrueTime with the error bound of at most maxError or fails.
+// ErrNoData and ErrBoundExceeded mean no time of the required quality is available right now,
+// so the application can decide what to do instead of silently using degraded time
+func (f *FBClock) GetTimeWithin(maxError time.Duration) (*TrueTime, error) {
+	tt, err := f.GetTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := tt.Within(maxError); err != nil {
+		return nil, err
+	}
+	return tt, nil
+}
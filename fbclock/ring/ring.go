@@ -0,0 +1,351 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package ring implements a shared memory ring of the measurements fbclock-daemon publishes,
+one record per data point with the computed error bound. Any number of processes can read
+the stream lock-free, e.g. to timestamp their own events against the PTP state.
+
+The file is a 64 byte header followed by 64 byte slots. Every word is accessed atomically.
+The header holds the magic, version, capacity and the number of records published so far.
+Each slot starts with a sequence, odd while the writer updates the slot and 2*n+2 once
+record n is complete, so readers detect records overwritten while they were reading them.
+*/
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultPath is where fbclock-daemon publishes the ring
+const DefaultPath = "/dev/shm/fbclock_ring_v1"
+
+const (
+	magic    = 0x6662636c6f636b72 // "fbclockr"
+	version  = 1
+	wordSize = 8
+	// header and slot sizes in words
+	headerWords = 8
+	slotWords   = 8
+
+	headerMagic    = 0
+	headerVersion  = 1
+	headerCapacity = 2
+	headerHead     = 3
+)
+
+// ErrBadRing is returned when the file is not a ring of a supported version
+var ErrBadRing = errors.New("not an fbclock ring")
+
+// Record is a single measurement published by the daemon
+type Record struct {
+	// IngressTimeNS is the PHC time the sync message was received at
+	IngressTimeNS int64
+	// MasterOffsetNS is the offset from the master
+	MasterOffsetNS float64
+	// PathDelayNS is the mean path delay
+	PathDelayNS float64
+	// FreqAdjustmentPPB is the PHC frequency adjustment
+	FreqAdjustmentPPB float64
+	// ClockAccuracyNS is the clock accuracy of the grandmaster
+	ClockAccuracyNS float64
+	// ErrorBoundNS is the error bound W at the ingress time
+	ErrorBoundNS float64
+	// HoldoverMultiplierNS is how much the error bound grows per second of holdover
+	HoldoverMultiplierNS float64
+}
+
+// ring is the mapped file
+type ring struct {
+	mem      []byte
+	capacity uint64
+}
+
+func (r *ring) word(i uint64) *uint64 {
+	return (*uint64)(unsafe.Pointer(&r.mem[i*wordSize]))
+}
+
+func (r *ring) header(i uint64) *uint64 {
+	return r.word(i)
+}
+
+// slot returns the first word of the slot of the record n
+func (r *ring) slot(n uint64) uint64 {
+	return headerWords + (n%r.capacity)*slotWords
+}
+
+func (r *ring) close() error {
+	return unix.Munmap(r.mem)
+}
+
+func size(capacity uint64) int {
+	return int((headerWords + capacity*slotWords) * wordSize)
+}
+
+func mmap(f *os.File, capacity uint64, prot int) (*ring, error) {
+	mem, err := unix.Mmap(int(f.Fd()), 0, size(capacity), prot, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", f.Name(), err)
+	}
+	return &ring{mem: mem, capacity: capacity}, nil
+}
+
+// store writes the record n to its slot
+func (r *ring) store(n uint64, rec Record) {
+	s := r.slot(n)
+	atomic.StoreUint64(r.word(s), 2*n+1)
+	atomic.StoreUint64(r.word(s+1), uint64(rec.IngressTimeNS))
+	atomic.StoreUint64(r.word(s+2), math.Float64bits(rec.MasterOffsetNS))
+	atomic.StoreUint64(r.word(s+3), math.Float64bits(rec.PathDelayNS))
+	atomic.StoreUint64(r.word(s+4), math.Float64bits(rec.FreqAdjustmentPPB))
+	atomic.StoreUint64(r.word(s+5), math.Float64bits(rec.ClockAccuracyNS))
+	atomic.StoreUint64(r.word(s+6), math.Float64bits(rec.ErrorBoundNS))
+	atomic.StoreUint64(r.word(s+7), math.Float64bits(rec.HoldoverMultiplierNS))
+	atomic.StoreUint64(r.word(s), 2*n+2)
+}
+
+// load reads the record n from its slot. False if the slot doesn't hold it
+func (r *ring) load(n uint64) (Record, bool) {
+	s := r.slot(n)
+	seq := atomic.LoadUint64(r.word(s))
+	rec := Record{
+		IngressTimeNS:        int64(atomic.LoadUint64(r.word(s + 1))),
+		MasterOffsetNS:       math.Float64frombits(atomic.LoadUint64(r.word(s + 2))),
+		PathDelayNS:          math.Float64frombits(atomic.LoadUint64(r.word(s + 3))),
+		FreqAdjustmentPPB:    math.Float64frombits(atomic.LoadUint64(r.word(s + 4))),
+		ClockAccuracyNS:      math.Float64frombits(atomic.LoadUint64(r.word(s + 5))),
+		ErrorBoundNS:         math.Float64frombits(atomic.LoadUint64(r.word(s + 6))),
+		HoldoverMultiplierNS: math.Float64frombits(atomic.LoadUint64(r.word(s + 7))),
+	}
+	return rec, seq == 2*n+2 && atomic.LoadUint64(r.word(s)) == seq
+}
+
+// Writer publishes records to the ring. There must be a single writer
+type Writer struct {
+	r    *ring
+	head uint64
+}
+
+// Create creates the ring of the capacity at path. An existing ring of the same capacity is continued,
+// so readers survive daemon restarts. Ring of another size is replaced by a new file rather than resized,
+// so the readers still mapping it don't fault on the pages cut off; Replaced tells them to reopen
+func Create(path string, capacity int) (*Writer, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("ring capacity must be positive, got %d", capacity)
+	}
+	c := uint64(capacity)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return replace(path, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != int64(size(c)) {
+		return replace(path, c)
+	}
+	r, err := mmap(f, c, unix.PROT_READ|unix.PROT_WRITE)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{r: r}
+	if atomic.LoadUint64(r.header(headerMagic)) == magic && atomic.LoadUint64(r.header(headerVersion)) == version &&
+		atomic.LoadUint64(r.header(headerCapacity)) == c {
+		w.head = atomic.LoadUint64(r.header(headerHead))
+		return w, nil
+	}
+	w.init(c)
+	return w, nil
+}
+
+// replace creates the ring in a temporary file and renames it over path
+func replace(path string, capacity uint64) (*Writer, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	w, err := func() (*Writer, error) {
+		// readable by everyone, like the fbclock shm
+		if err := f.Chmod(0644); err != nil {
+			return nil, err
+		}
+		if err := f.Truncate(int64(size(capacity))); err != nil {
+			return nil, err
+		}
+		r, err := mmap(f, capacity, unix.PROT_READ|unix.PROT_WRITE)
+		if err != nil {
+			return nil, err
+		}
+		w := &Writer{r: r}
+		w.init(capacity)
+		if err := os.Rename(f.Name(), path); err != nil {
+			r.close()
+			return nil, err
+		}
+		return w, nil
+	}()
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return w, err
+}
+
+// init writes the header of the empty ring, the magic goes last
+func (w *Writer) init(capacity uint64) {
+	atomic.StoreUint64(w.r.header(headerMagic), 0)
+	atomic.StoreUint64(w.r.header(headerVersion), version)
+	atomic.StoreUint64(w.r.header(headerCapacity), capacity)
+	atomic.StoreUint64(w.r.header(headerHead), 0)
+	atomic.StoreUint64(w.r.header(headerMagic), magic)
+}
+
+// Publish adds the record to the ring, overwriting the oldest one once the ring is full
+func (w *Writer) Publish(rec Record) {
+	if w == nil {
+		return
+	}
+	w.r.store(w.head, rec)
+	w.head++
+	atomic.StoreUint64(w.r.header(headerHead), w.head)
+}
+
+// Close unmaps the ring. The file is kept for the readers
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.r.close()
+}
+
+// Reader reads records from the ring. Readers don't write to the ring, so there can be any number of them
+type Reader struct {
+	r    *ring
+	next uint64
+	lost uint64
+	// the file mapped, to detect the ring replaced at path
+	path string
+	dev  uint64
+	ino  uint64
+}
+
+// Open opens the ring at path for reading. Next returns records published after Open
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(size(0)) {
+		return nil, ErrBadRing
+	}
+	hdr, err := mmap(f, 0, unix.PROT_READ)
+	if err != nil {
+		return nil, err
+	}
+	m, v, c := atomic.LoadUint64(hdr.header(headerMagic)), atomic.LoadUint64(hdr.header(headerVersion)), atomic.LoadUint64(hdr.header(headerCapacity))
+	hdr.close()
+	if m != magic || v != version || c == 0 || info.Size() != int64(size(c)) {
+		return nil, ErrBadRing
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(int(f.Fd()), &st); err != nil {
+		return nil, err
+	}
+	r, err := mmap(f, c, unix.PROT_READ)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, next: atomic.LoadUint64(r.header(headerHead)), path: path, dev: uint64(st.Dev), ino: st.Ino}, nil
+}
+
+// Replaced reports the ring at the path is no longer the one the reader maps, e.g. the daemon recreated it
+// with another capacity. The old ring gets no more records, so reopen the path
+func (r *Reader) Replaced() bool {
+	var st unix.Stat_t
+	if err := unix.Stat(r.path, &st); err != nil {
+		return true
+	}
+	return uint64(st.Dev) != r.dev || st.Ino != r.ino
+}
+
+// Next returns the next record, false if none was published yet.
+// Records overwritten before they were read are skipped and counted by Lost
+func (r *Reader) Next() (Record, bool) {
+	for {
+		head := atomic.LoadUint64(r.r.header(headerHead))
+		if head < r.next {
+			// the ring was recreated
+			r.next = head
+		}
+		if r.next == head {
+			return Record{}, false
+		}
+		if head-r.next > r.r.capacity {
+			r.lost += head - r.r.capacity - r.next
+			r.next = head - r.r.capacity
+		}
+		if rec, ok := r.r.load(r.next); ok {
+			r.next++
+			return rec, true
+		}
+		// overwritten while reading, skip ahead
+		if atomic.LoadUint64(r.r.header(headerHead))-r.next >= r.r.capacity {
+			r.lost++
+			r.next++
+		}
+	}
+}
+
+// Last returns the most recent record, false if none was published yet
+func (r *Reader) Last() (Record, bool) {
+	for {
+		head := atomic.LoadUint64(r.r.header(headerHead))
+		if head == 0 {
+			return Record{}, false
+		}
+		if rec, ok := r.r.load(head - 1); ok {
+			return rec, true
+		}
+	}
+}
+
+// Lost returns the number of records overwritten before Next returned them
+func (r *Reader) Lost() uint64 {
+	return r.lost
+}
+
+// Close unmaps the ring
+func (r *Reader) Close() error {
+	return r.r.close()
+}
@@ -0,0 +1,192 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ring
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func record(i int) Record {
+	return Record{
+		IngressTimeNS:        int64(1648137249050666302 + i),
+		MasterOffsetNS:       float64(i),
+		PathDelayNS:          213,
+		FreqAdjustmentPPB:    -1.5,
+		ClockAccuracyNS:      25,
+		ErrorBoundNS:         48,
+		HoldoverMultiplierNS: 64.5,
+	}
+}
+
+func TestRing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	w, err := Create(path, 4)
+	require.NoError(t, err)
+	defer w.Close()
+
+	w.Publish(record(0))
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// readers start with the records published after Open
+	_, ok := r.Next()
+	require.False(t, ok)
+	last, ok := r.Last()
+	require.True(t, ok)
+	require.Equal(t, record(0), last)
+
+	w.Publish(record(1))
+	w.Publish(record(2))
+	got, ok := r.Next()
+	require.True(t, ok)
+	require.Equal(t, record(1), got)
+	got, ok = r.Next()
+	require.True(t, ok)
+	require.Equal(t, record(2), got)
+	_, ok = r.Next()
+	require.False(t, ok)
+	require.Zero(t, r.Lost())
+
+	// slow reader loses the overwritten records
+	for i := 3; i < 10; i++ {
+		w.Publish(record(i))
+	}
+	for i := 6; i < 10; i++ {
+		got, ok = r.Next()
+		require.True(t, ok)
+		require.Equal(t, record(i), got)
+	}
+	require.Equal(t, uint64(3), r.Lost())
+	last, ok = r.Last()
+	require.True(t, ok)
+	require.Equal(t, record(9), last)
+}
+
+func TestRingMultipleReaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	w, err := Create(path, 1024)
+	require.NoError(t, err)
+	defer w.Close()
+
+	const n = 1000
+	var wg sync.WaitGroup
+	got := make([][]Record, 3)
+	for j := range got {
+		r, err := Open(path)
+		require.NoError(t, err)
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+			defer r.Close()
+			for len(got[j]) < n {
+				if rec, ok := r.Next(); ok {
+					got[j] = append(got[j], rec)
+				}
+			}
+		}(j)
+	}
+	want := make([]Record, n)
+	for i := range want {
+		want[i] = record(i)
+		w.Publish(want[i])
+	}
+	wg.Wait()
+	for _, g := range got {
+		require.Equal(t, want, g)
+	}
+}
+
+func TestRingRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	w, err := Create(path, 4)
+	require.NoError(t, err)
+	w.Publish(record(0))
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	require.NoError(t, w.Close())
+
+	// same capacity continues the ring
+	w, err = Create(path, 4)
+	require.NoError(t, err)
+	w.Publish(record(1))
+	got, ok := r.Next()
+	require.True(t, ok)
+	require.Equal(t, record(1), got)
+	require.NoError(t, w.Close())
+
+	require.False(t, r.Replaced())
+
+	// other capacity starts over in a new file
+	w, err = Create(path, 8)
+	require.NoError(t, err)
+	defer w.Close()
+	_, ok = w.r.load(0)
+	require.False(t, ok)
+	r2, err := Open(path)
+	require.NoError(t, err)
+	defer r2.Close()
+	_, ok = r2.Last()
+	require.False(t, ok)
+	require.False(t, r2.Replaced())
+
+	// reader of the old ring keeps reading its mapping until it reopens
+	w.Publish(record(2))
+	require.True(t, r.Replaced())
+	_, ok = r.Next()
+	require.False(t, ok)
+	got, ok = r.Last()
+	require.True(t, ok)
+	require.Equal(t, record(1), got)
+	got, ok = r2.Next()
+	require.True(t, ok)
+	require.Equal(t, record(2), got)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestRingOpenInvalid(t *testing.T) {
+	_, err := Create(filepath.Join(t.TempDir(), "ring"), 0)
+	require.Error(t, err)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "ring")
+	require.NoError(t, os.WriteFile(path, make([]byte, size(4)), 0644))
+	_, err = Open(path)
+	require.ErrorIs(t, err, ErrBadRing)
+
+	require.NoError(t, os.WriteFile(path, []byte{1}, 0644))
+	_, err = Open(path)
+	require.ErrorIs(t, err, ErrBadRing)
+
+	var w *Writer
+	w.Publish(record(0))
+	require.NoError(t, w.Close())
+}
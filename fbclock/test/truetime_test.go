@@ -0,0 +1,40 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	lib "github.com/facebook/time/fbclock"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrueTimeWithin(t *testing.T) {
+	now := time.Unix(1648137249, 0)
+	tt := &lib.TrueTime{Earliest: now.Add(-5 * time.Microsecond), Latest: now.Add(5 * time.Microsecond)}
+	require.Equal(t, 5*time.Microsecond, tt.ErrorBound())
+
+	require.NoError(t, tt.Within(5*time.Microsecond))
+	require.NoError(t, tt.Within(time.Millisecond))
+
+	err := tt.Within(time.Microsecond)
+	require.True(t, errors.Is(err, lib.ErrBoundExceeded))
+	require.Equal(t, "error bound exceeded: 5µs is above 1µs", err.Error())
+}
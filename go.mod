@@ -4,15 +4,20 @@ go 1.18
 
 require (
 	github.com/Knetic/govaluate v3.0.0+incompatible
+	github.com/cilium/ebpf v0.10.0
 	github.com/davecgh/go-spew v1.1.1
 	github.com/eclesh/welford v0.0.0-20150116075914-eec62615b1f0
+	github.com/facebook/time/hostendian v0.1.0
+	github.com/facebook/time/ptp/protocol v0.1.0
 	github.com/fatih/color v1.13.0
 	github.com/go-ini/ini v1.66.4
 	github.com/golang/mock v1.6.0
 	github.com/google/gopacket v1.1.19
 	github.com/hashicorp/go-version v1.5.0
 	github.com/jsimonetti/rtnetlink v1.2.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/olekukonko/tablewriter v0.0.5
+	github.com/openconfig/gnmi v0.10.0
 	github.com/pkg/errors v0.9.1
 	github.com/shirou/gopsutil v3.21.11+incompatible
 	github.com/sirupsen/logrus v1.8.1
@@ -21,17 +26,20 @@ require (
 	github.com/vtolstov/go-ioctl v0.0.0-20151206205506-6be9cced4810
 	go.bug.st/serial v1.5.0
 	golang.org/x/exp v0.0.0-20220518171630-0b5c67f07fdf
-	golang.org/x/net v0.7.0
+	golang.org/x/net v0.9.0
 	golang.org/x/sync v0.0.0-20220513210516-0976fa681c29
-	golang.org/x/sys v0.5.0
-	golang.org/x/term v0.5.0
+	golang.org/x/sys v0.7.0
+	golang.org/x/term v0.7.0
+	google.golang.org/grpc v1.56.3
+	google.golang.org/protobuf v1.30.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
-	github.com/google/go-cmp v0.5.8 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/josharian/native v1.0.0 // indirect
 	github.com/mattn/go-colorable v0.1.12 // indirect
@@ -45,5 +53,13 @@ require (
 	github.com/tklauser/go-sysconf v0.3.11 // indirect
 	github.com/tklauser/numcpus v0.6.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.2 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
 	gopkg.in/yaml.v3 v3.0.0 // indirect
 )
+
+// the modules of this repository are not published yet, resolve them to the tree until the tags are pushed
+replace (
+	github.com/facebook/time/hostendian v0.1.0 => ./hostendian
+	github.com/facebook/time/ptp/protocol v0.1.0 => ./ptp/protocol
+)
@@ -0,0 +1,3 @@
+module github.com/facebook/time/hostendian
+
+go 1.18
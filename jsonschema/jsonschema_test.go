@@ -0,0 +1,105 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonschema
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testInner struct {
+	Count uint64 `json:"count"`
+}
+
+type testOutput struct {
+	testInner
+	Offset  float64           `json:"ptp.offset_ns"`
+	Delay   time.Duration     `json:"delay"`
+	Present bool              `json:"present"`
+	Note    string            `json:"note,omitempty"`
+	Expire  time.Time         `json:"expire"`
+	IP      net.IP            `json:"ip"`
+	Peers   []*testInner      `json:"peers"`
+	Extra   map[string]int64  `json:"extra"`
+	Any     interface{}       `json:"any"`
+	Skipped int               `json:"-"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+func TestNew(t *testing.T) {
+	s := New("tool/output", 2, "Test output", Reflect(testOutput{}))
+	require.Equal(t, Draft, s.Schema)
+	require.Equal(t, "https://github.com/facebook/time/schema/tool/output.v2.json", s.ID)
+	require.Equal(t, 2, s.Version)
+	require.Equal(t, "object", s.Type)
+	require.Equal(t, false, s.AdditionalProperties)
+	require.Equal(t, []string{"count", "ptp.offset_ns", "delay", "present", "expire", "ip", "peers", "extra", "any"}, s.Required)
+
+	require.Equal(t, "integer", s.Properties["count"].Type)
+	require.Equal(t, "number", s.Properties["ptp.offset_ns"].Type)
+	require.Equal(t, "integer", s.Properties["delay"].Type)
+	require.Equal(t, "boolean", s.Properties["present"].Type)
+	require.Equal(t, "string", s.Properties["note"].Type)
+	require.Equal(t, &Schema{Type: "string", Format: "date-time"}, s.Properties["expire"])
+	require.Equal(t, "string", s.Properties["ip"].Type)
+	require.Equal(t, "array", s.Properties["peers"].Type)
+	require.Equal(t, "integer", s.Properties["peers"].Items.Properties["count"].Type)
+	require.Equal(t, &Schema{Type: "integer"}, s.Properties["extra"].AdditionalProperties)
+	require.Equal(t, &Schema{}, s.Properties["any"])
+	require.NotContains(t, s.Properties, "Skipped")
+	require.Equal(t, 11, len(s.Properties))
+}
+
+func TestPattern(t *testing.T) {
+	s := Pattern(`^ntp\.peers\.[^.]+\.delay$`, float64(0))
+	require.Equal(t, "object", s.Type)
+	require.Equal(t, false, s.AdditionalProperties)
+	require.Equal(t, &Schema{Type: "number"}, s.PatternProperties[`^ntp\.peers\.[^.]+\.delay$`])
+}
+
+func TestAnyOf(t *testing.T) {
+	s := AnyOf(Reflect(testInner{}), Reflect(map[string]int64{}))
+	require.Equal(t, 2, len(s.AnyOf))
+	require.Equal(t, "", s.Type)
+	require.Equal(t, &Schema{Type: "integer"}, s.AnyOf[1].AdditionalProperties)
+}
+
+func TestMarshal(t *testing.T) {
+	b, err := New("tool/output", 1, "", Reflect(testInner{})).Marshal()
+	require.NoError(t, err)
+	want := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://github.com/facebook/time/schema/tool/output.v1.json",
+  "title": "tool/output",
+  "version": 1,
+  "type": "object",
+  "properties": {
+    "count": {
+      "type": "integer"
+    }
+  },
+  "additionalProperties": false,
+  "required": [
+    "count"
+  ]
+}
+`
+	require.Equal(t, want, string(b))
+}
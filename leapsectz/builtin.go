@@ -0,0 +1,60 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leapsectz
+
+// BuiltinFile is the name Parse takes to return the built-in leap second table
+// instead of reading a file. Useful on systems without the time zone database
+const BuiltinFile = "builtin"
+
+// builtin is the leap second table as of IERS Bulletin C 68, times are in the right/UTC format.
+// It needs an update once a new leap second is announced
+var builtin = []LeapSecond{
+	{Tleap: 78796800, Nleap: 1},    // 1972-07-01
+	{Tleap: 94694401, Nleap: 2},    // 1973-01-01
+	{Tleap: 126230402, Nleap: 3},   // 1974-01-01
+	{Tleap: 157766403, Nleap: 4},   // 1975-01-01
+	{Tleap: 189302404, Nleap: 5},   // 1976-01-01
+	{Tleap: 220924805, Nleap: 6},   // 1977-01-01
+	{Tleap: 252460806, Nleap: 7},   // 1978-01-01
+	{Tleap: 283996807, Nleap: 8},   // 1979-01-01
+	{Tleap: 315532808, Nleap: 9},   // 1980-01-01
+	{Tleap: 362793609, Nleap: 10},  // 1981-07-01
+	{Tleap: 394329610, Nleap: 11},  // 1982-07-01
+	{Tleap: 425865611, Nleap: 12},  // 1983-07-01
+	{Tleap: 489024012, Nleap: 13},  // 1985-07-01
+	{Tleap: 567993613, Nleap: 14},  // 1988-01-01
+	{Tleap: 631152014, Nleap: 15},  // 1990-01-01
+	{Tleap: 662688015, Nleap: 16},  // 1991-01-01
+	{Tleap: 709948816, Nleap: 17},  // 1992-07-01
+	{Tleap: 741484817, Nleap: 18},  // 1993-07-01
+	{Tleap: 773020818, Nleap: 19},  // 1994-07-01
+	{Tleap: 820454419, Nleap: 20},  // 1996-01-01
+	{Tleap: 867715220, Nleap: 21},  // 1997-07-01
+	{Tleap: 915148821, Nleap: 22},  // 1999-01-01
+	{Tleap: 1136073622, Nleap: 23}, // 2006-01-01
+	{Tleap: 1230768023, Nleap: 24}, // 2009-01-01
+	{Tleap: 1341100824, Nleap: 25}, // 2012-07-01
+	{Tleap: 1435708825, Nleap: 26}, // 2015-07-01
+	{Tleap: 1483228826, Nleap: 27}, // 2017-01-01
+}
+
+// Builtin returns the built-in leap second table
+func Builtin() []LeapSecond {
+	res := make([]LeapSecond, len(builtin))
+	copy(res, builtin)
+	return res
+}
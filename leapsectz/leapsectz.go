@@ -19,11 +19,15 @@ limitations under the License.
 package leapsectz
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -34,6 +38,9 @@ var errBadData = errors.New("malformed time zone information")
 var errUnsupportedVersion = errors.New("unsupported version")
 var errNoLeapSeconds = errors.New("no leap seconds information found")
 
+// ntpEpochOffset is the number of seconds between the NTP epoch 1900-01-01 and the Unix epoch
+const ntpEpochOffset = 2208988800
+
 // LeapSecond represents a leap second
 type LeapSecond struct {
 	Tleap uint64
@@ -62,20 +69,69 @@ func (l LeapSecond) Time() time.Time {
 }
 
 // Parse returns the list of leap seconds from srcfile. Pass "" to use default file
+// or BuiltinFile to use the built-in table. Both time zone files and
+// leap-seconds.list files published by IERS and shipped with tzdata are supported
 func Parse(srcfile string) ([]LeapSecond, error) {
 	if srcfile == "" {
 		srcfile = leapFile
 	}
-	f, err := os.Open(srcfile)
+	if srcfile == BuiltinFile {
+		return Builtin(), nil
+	}
+	data, err := os.ReadFile(srcfile)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	if bytes.HasPrefix(data, []byte("TZif")) {
+		return parseVx(bytes.NewReader(data))
+	}
+	return parseList(bytes.NewReader(data))
+}
 
-	return parseVx(f)
+// parseList parses leap-seconds.list format: lines of NTP timestamp and TAI-UTC offset
+// effective from it, comments start with #
+func parseList(r io.Reader) ([]LeapSecond, error) {
+	var ret []LeapSecond
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: %q", errBadData, scanner.Text())
+		}
+		ntp, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil || ntp < ntpEpochOffset {
+			return nil, fmt.Errorf("%w: %q", errBadData, scanner.Text())
+		}
+		offset, err := strconv.ParseInt(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", errBadData, scanner.Text())
+		}
+		// the first line is the 10 seconds offset leap seconds started with
+		nleap := int32(offset) - 10
+		if nleap == 0 {
+			continue
+		}
+		// time zone files count the leap seconds inserted so far into the transition time
+		ret = append(ret, LeapSecond{Tleap: ntp - ntpEpochOffset + uint64(nleap) - 1, Nleap: nleap})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, errNoLeapSeconds
+	}
+	return ret, nil
 }
 
 // Latest returns the latest leap second from srcfile. Pass "" to use default file
+// or BuiltinFile to use the built-in table
 func Latest(srcfile string) (*LeapSecond, error) {
 	res := LeapSecond{}
 	leapSeconds, err := Parse(srcfile)
@@ -92,6 +148,17 @@ func Latest(srcfile string) (*LeapSecond, error) {
 	return &res, nil
 }
 
+// UTCOffset returns current TAI-UTC offset according to srcfile. Pass "" to use default file
+func UTCOffset(srcfile string) (time.Duration, error) {
+	latest, err := Latest(srcfile)
+	if err != nil {
+		return 0, err
+	}
+	// TAI <-> UTC offset was 10 seconds before introduction of leap seconds.
+	// https://en.wikipedia.org/wiki/Leap_second
+	return time.Duration(10+latest.Nleap) * time.Second, nil
+}
+
 func parseVx(r io.Reader) ([]LeapSecond, error) {
 	var ret []LeapSecond
 	var v byte
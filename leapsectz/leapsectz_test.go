@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -162,6 +163,48 @@ func TestParse(t *testing.T) {
 	require.ElementsMatch(t, expected, ls)
 }
 
+var leapSecondsList = []byte(`#	Updated through IERS Bulletin C 65
+#$	 3676924800
+#@	3896899200
+#
+2272060800	10	# 1 Jan 1972
+2287785600	11	# 1 Jul 1972
+2303683200	12	# 1 Jan 1973
+`)
+
+func TestParseList(t *testing.T) {
+	ls, err := parseList(bytes.NewReader(leapSecondsList))
+	require.NoError(t, err)
+	require.Equal(t, []LeapSecond{{78796800, 1}, {94694401, 2}}, ls)
+	require.Equal(t, time.Date(1972, 7, 1, 0, 0, 0, 0, time.UTC), ls[0].Time().UTC())
+	require.Equal(t, time.Date(1973, 1, 1, 0, 0, 0, 0, time.UTC), ls[1].Time().UTC())
+
+	// built-in table is the right/UTC representation of the same list
+	require.Equal(t, Builtin()[:2], ls)
+
+	_, err = parseList(strings.NewReader("# comments only\n"))
+	require.ErrorIs(t, err, errNoLeapSeconds)
+	_, err = parseList(strings.NewReader("2287785600 11 12\n"))
+	require.ErrorIs(t, err, errBadData)
+	_, err = parseList(strings.NewReader("2287785600 eleven\n"))
+	require.ErrorIs(t, err, errBadData)
+}
+
+func TestParseListFile(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "leaptest-")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(leapSecondsList)
+	require.NoError(t, err)
+	err = f.Close()
+	require.NoError(t, err)
+
+	offset, err := UTCOffset(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, 12*time.Second, offset)
+}
+
 func TestLatest(t *testing.T) {
 	expected := &LeapSecond{94694401, 2}
 	f, err := os.CreateTemp(os.TempDir(), "leaptest-")
@@ -178,6 +221,24 @@ func TestLatest(t *testing.T) {
 	require.Equal(t, expected, ls)
 }
 
+func TestUTCOffset(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "leaptest-")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(tzV2)
+	require.NoError(t, err)
+	err = f.Close()
+	require.NoError(t, err)
+
+	offset, err := UTCOffset(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, 12*time.Second, offset)
+
+	_, err = UTCOffset("/does/not/exist")
+	require.Error(t, err)
+}
+
 func TestLatestFuture(t *testing.T) {
 	expected := &LeapSecond{1649346026, 2}
 
@@ -389,3 +450,18 @@ func FuzzParse(f *testing.F) {
 		}
 	})
 }
+
+func TestBuiltin(t *testing.T) {
+	ls, err := Parse(BuiltinFile)
+	require.NoError(t, err)
+	require.Len(t, ls, 27)
+	require.Equal(t, time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), ls[len(ls)-1].Time().UTC())
+
+	// the table is a copy
+	ls[0].Nleap = 42
+	require.Equal(t, int32(1), Builtin()[0].Nleap)
+
+	offset, err := UTCOffset(BuiltinFile)
+	require.NoError(t, err)
+	require.Equal(t, 37*time.Second, offset)
+}
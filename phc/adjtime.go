@@ -146,3 +146,25 @@ func ClockStep(phcDevice string, step time.Duration) error {
 	}
 	return err
 }
+
+// TAIOffset returns TAI-UTC offset the kernel keeps for the system clock.
+// Zero means it was never set
+func TAIOffset() (time.Duration, error) {
+	tx := &unix.Timex{}
+	if _, err := ClockAdjtime(unix.CLOCK_REALTIME, tx); err != nil {
+		return 0, fmt.Errorf("reading kernel TAI offset: %w", err)
+	}
+	return time.Duration(tx.Tai) * time.Second, nil
+}
+
+// SetTAIOffset sets TAI-UTC offset the kernel keeps for the system clock. Requires CAP_SYS_TIME
+func SetTAIOffset(offset time.Duration) error {
+	tx := &unix.Timex{}
+	tx.Modes = AdjTAI
+	// man(2) adjtimex, ADJ_TAI takes the offset from the constant field
+	tx.Constant = int64(offset / time.Second)
+	if _, err := ClockAdjtime(unix.CLOCK_REALTIME, tx); err != nil {
+		return fmt.Errorf("setting kernel TAI offset: %w", err)
+	}
+	return nil
+}
@@ -36,6 +36,12 @@ type SysoffResult struct {
 	PHCTime time.Time
 }
 
+// Uncertainty returns the bound of the PHC time error caused by the read latency.
+// PHC was read at some point between the two system time readings, so the error is at most half of the window
+func (r SysoffResult) Uncertainty() time.Duration {
+	return r.Delay / 2
+}
+
 // based on sysoff_estimate from ptp4l sysoff.c
 func sysoffFromExtendedTS(extendedTS [3]PTPClockTime) SysoffResult {
 	t1 := extendedTS[0].Time()
@@ -126,6 +132,13 @@ func abs(value time.Duration) time.Duration {
 
 // OffsetBetweenExtendedReadings returns estimated difference between two PHC SYS_OFFSET_EXTENDED readings
 func OffsetBetweenExtendedReadings(extendedA, extendedB *PTPSysOffsetExtended) time.Duration {
+	offset, _ := OffsetAndUncertaintyBetweenExtendedReadings(extendedA, extendedB)
+	return offset
+}
+
+// OffsetAndUncertaintyBetweenExtendedReadings returns estimated difference between two PHC SYS_OFFSET_EXTENDED readings
+// along with the error bound caused by the read latencies of the chosen pair of samples
+func OffsetAndUncertaintyBetweenExtendedReadings(extendedA, extendedB *PTPSysOffsetExtended) (time.Duration, time.Duration) {
 	// we expect both probes to have same number of measures
 	numProbes := int(extendedA.NSamples)
 	if int(extendedB.NSamples) < numProbes {
@@ -139,6 +152,7 @@ func OffsetBetweenExtendedReadings(extendedA, extendedB *PTPSysOffsetExtended) t
 	// compensate difference between PHC time by difference in system time
 	phcOffset := sysoffB.PHCTime.Sub(sysoffA.PHCTime) - sysOffset
 	shortest := phcOffset
+	uncertainty := sysoffA.Uncertainty() + sysoffB.Uncertainty()
 	// look for smallest difference between system time midpoints
 	for i := 1; i < numProbes; i++ {
 		sysoffA = sysoffFromExtendedTS(extendedA.TS[i])
@@ -148,20 +162,28 @@ func OffsetBetweenExtendedReadings(extendedA, extendedB *PTPSysOffsetExtended) t
 
 		if abs(phcOffset) < abs(shortest) {
 			shortest = phcOffset
+			uncertainty = sysoffA.Uncertainty() + sysoffB.Uncertainty()
 		}
 	}
-	return shortest
+	return shortest, uncertainty
 }
 
 // OffsetBetweenDevices returns estimated difference between two PHC devices
 func OffsetBetweenDevices(deviceA, deviceB string) (time.Duration, error) {
+	offset, _, err := OffsetAndUncertaintyBetweenDevices(deviceA, deviceB)
+	return offset, err
+}
+
+// OffsetAndUncertaintyBetweenDevices returns estimated difference between two PHC devices along with its error bound
+func OffsetAndUncertaintyBetweenDevices(deviceA, deviceB string) (time.Duration, time.Duration, error) {
 	extendedA, err := ReadPTPSysOffsetExtended(deviceA, ExtendedNumProbes)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	extendedB, err := ReadPTPSysOffsetExtended(deviceB, ExtendedNumProbes)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	return OffsetBetweenExtendedReadings(extendedA, extendedB), nil
+	offset, uncertainty := OffsetAndUncertaintyBetweenExtendedReadings(extendedA, extendedB)
+	return offset, uncertainty, nil
 }
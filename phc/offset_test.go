@@ -98,3 +98,38 @@ func TestOffsetBetweenExtendedReadings(t *testing.T) {
 	offset := OffsetBetweenExtendedReadings(extendedA, extendedB)
 	require.Equal(t, time.Duration(-815), offset)
 }
+
+func TestSysoffResultUncertainty(t *testing.T) {
+	extended := &PTPSysOffsetExtended{
+		NSamples: 3,
+		TS: [ptpMaxSamples][3]PTPClockTime{
+			{{Sec: 1667818190, NSec: 552297411}, {Sec: 1667818153, NSec: 552297462}, {Sec: 1667818190, NSec: 552297522}},
+			{{Sec: 1667818190, NSec: 552297533}, {Sec: 1667818153, NSec: 552297582}, {Sec: 1667818190, NSec: 552297622}},
+			{{Sec: 1667818190, NSec: 552297644}, {Sec: 1667818153, NSec: 552297661}, {Sec: 1667818190, NSec: 552297722}},
+		},
+	}
+	// fastest sample took 78ns
+	require.Equal(t, time.Duration(39), SysoffEstimateExtended(extended).Uncertainty())
+}
+
+func TestOffsetAndUncertaintyBetweenExtendedReadings(t *testing.T) {
+	extendedA := &PTPSysOffsetExtended{
+		NSamples: 2,
+		TS: [ptpMaxSamples][3]PTPClockTime{
+			{{Sec: 1667818190, NSec: 552297000}, {Sec: 1667818153, NSec: 552297050}, {Sec: 1667818190, NSec: 552297100}},
+			{{Sec: 1667818190, NSec: 552298000}, {Sec: 1667818153, NSec: 552298025}, {Sec: 1667818190, NSec: 552298050}},
+		},
+	}
+	extendedB := &PTPSysOffsetExtended{
+		NSamples: 2,
+		TS: [ptpMaxSamples][3]PTPClockTime{
+			{{Sec: 1667818190, NSec: 552297000}, {Sec: 1667818153, NSec: 552297250}, {Sec: 1667818190, NSec: 552297200}},
+			{{Sec: 1667818190, NSec: 552298000}, {Sec: 1667818153, NSec: 552298035}, {Sec: 1667818190, NSec: 552298030}},
+		},
+	}
+	offset, uncertainty := OffsetAndUncertaintyBetweenExtendedReadings(extendedA, extendedB)
+	require.Equal(t, time.Duration(20), offset)
+	// second pair is chosen: 50ns and 30ns windows
+	require.Equal(t, time.Duration(40), uncertainty)
+	require.Equal(t, offset, OffsetBetweenExtendedReadings(extendedA, extendedB))
+}
@@ -94,6 +94,25 @@ func Time(iface string, method TimeMethod) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("unknown method to get PHC time %q", method)
 }
 
+// TimeWithUncertainty returns time we got from network card along with the error bound caused by the read latency.
+// With MethodIoctlSysOffsetExtended multiple samples are taken and the fastest one is used
+func TimeWithUncertainty(iface string, method TimeMethod) (time.Time, time.Duration, error) {
+	device, err := IfaceToPHCDevice(iface)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return TimeWithUncertaintyFromDevice(device, method)
+}
+
+// TimeWithUncertaintyFromDevice returns time we got from PTP device along with the error bound caused by the read latency
+func TimeWithUncertaintyFromDevice(device string, method TimeMethod) (time.Time, time.Duration, error) {
+	res, err := TimeAndOffsetFromDevice(device, method)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return res.PHCTime, res.Uncertainty(), nil
+}
+
 // TimeFromDevice returns time we got from PTP device
 func TimeFromDevice(device string) (time.Time, error) {
 	f, err := os.Open(device)
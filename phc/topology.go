@@ -0,0 +1,266 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Pin functions as defined in linux/ptp_clock.h
+const (
+	PinFuncNone    = 0
+	PinFuncExtTS   = 1
+	PinFuncPerOut  = 2
+	PinFuncPhySync = 3
+)
+
+// HW timestamping modes as defined in linux/net_tstamp.h
+const (
+	HWTstampTXOff       = 0
+	HWTstampTXOn        = 1
+	HWTstampFilterNone  = 0
+	HWTstampFilterAll   = 1
+	HWTstampFilterPTPv2 = 12
+)
+
+// pinFuncNames are names of pin functions as printed by testptp
+var pinFuncNames = map[int]string{
+	PinFuncNone:    "none",
+	PinFuncExtTS:   "extts",
+	PinFuncPerOut:  "perout",
+	PinFuncPhySync: "physync",
+}
+
+// PinFuncName returns the name of the pin function
+func PinFuncName(f int) string {
+	if name, ok := pinFuncNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", f)
+}
+
+// HWTstampConfig is the current hardware timestamping setting of a NIC
+// as per Linux kernel's include/uapi/linux/net_tstamp.h
+type HWTstampConfig struct {
+	Flags    int32 `json:"flags"`
+	TXType   int32 `json:"tx_type"`
+	RXFilter int32 `json:"rx_filter"`
+}
+
+// Enabled is true if both TX and RX hardware timestamps are on
+func (c *HWTstampConfig) Enabled() bool {
+	return c.TXType != HWTstampTXOff && c.RXFilter != HWTstampFilterNone
+}
+
+// Pin is a programmable pin of a PHC
+type Pin struct {
+	Name     string `json:"name"`
+	Function int    `json:"function"`
+	Channel  int    `json:"channel"`
+}
+
+// TopologyIface is a network interface the PHC belongs to
+type TopologyIface struct {
+	Name string `json:"name"`
+	// HWTstamp is nil if the setting can't be read, see HWTstampError
+	HWTstamp      *HWTstampConfig `json:"hwtstamp,omitempty"`
+	HWTstampError string          `json:"hwtstamp_error,omitempty"`
+}
+
+// TopologyClock is a PHC device with its pins and parent NIC
+type TopologyClock struct {
+	Device        string `json:"device"`
+	Index         int    `json:"index"`
+	Name          string `json:"name"`
+	Virtual       bool   `json:"virtual"`
+	MaxAdjustment int64  `json:"max_adjustment"`
+	ExtTS         int    `json:"n_external_timestamps"`
+	PerOut        int    `json:"n_periodic_outputs"`
+	PPS           bool   `json:"pps_available"`
+	// PCI address or other bus ID of the parent device, empty for virtual clocks
+	Bus    string          `json:"bus,omitempty"`
+	Pins   []Pin           `json:"pins"`
+	Ifaces []TopologyIface `json:"ifaces"`
+}
+
+// Topology is the PTP hardware of the host, clocks are sorted by index
+type Topology struct {
+	Clocks []TopologyClock `json:"clocks"`
+}
+
+// Clock returns the clock the interface belongs to
+func (t *Topology) Clock(iface string) (*TopologyClock, bool) {
+	for i, c := range t.Clocks {
+		for _, ifc := range c.Ifaces {
+			if ifc.Name == iface {
+				return &t.Clocks[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// hwtstampReader reads the hwtstamp setting of the interface, replaced in tests
+var hwtstampReader = IfaceHWTstamp
+
+// IfaceHWTstamp uses SIOCGHWTSTAMP ioctl to get the current hardware timestamping setting of the nic
+func IfaceHWTstamp(iface string) (*HWTstampConfig, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket for ioctl: %w", err)
+	}
+	defer unix.Close(fd)
+	data := &HWTstampConfig{}
+	ifreq := &Ifreq{}
+	copy(ifreq.Name[:unix.IFNAMSIZ-1], iface)
+	ifreq.Data = uintptr(unsafe.Pointer(data))
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL, uintptr(fd),
+		uintptr(unix.SIOCGHWTSTAMP),
+		uintptr(unsafe.Pointer(ifreq)),
+	)
+	if errno != 0 {
+		return nil, fmt.Errorf("failed to get hwtstamp config of %s: %w", iface, errno)
+	}
+	return data, nil
+}
+
+// readSysfsString reads the trimmed attribute of the device
+func readSysfsString(dir, attr string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// readSysfsInt reads the integer attribute of the device. Missing attributes, which old kernels don't have, are 0
+func readSysfsInt(dir, attr string) (int64, error) {
+	s, err := readSysfsString(dir, attr)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s of %s: %w", attr, dir, err)
+	}
+	return v, nil
+}
+
+// readPins reads the "function channel" assignments of the clock pins
+func readPins(dir string) ([]Pin, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, "pins"))
+	if os.IsNotExist(err) {
+		return []Pin{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pins := []Pin{}
+	for _, e := range entries {
+		s, err := readSysfsString(filepath.Join(dir, "pins"), e.Name())
+		if err != nil {
+			return nil, err
+		}
+		p := Pin{Name: e.Name()}
+		if _, err := fmt.Sscanf(s, "%d %d", &p.Function, &p.Channel); err != nil {
+			return nil, fmt.Errorf("parsing pin %s of %s: %w", e.Name(), dir, err)
+		}
+		pins = append(pins, p)
+	}
+	return pins, nil
+}
+
+// readClock reads the attributes of the PHC device from sysfs
+func readClock(name string) (*TopologyClock, error) {
+	dir := filepath.Join(sysfsPTP, name)
+	index, err := strconv.Atoi(strings.TrimPrefix(name, "ptp"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing index of %s: %w", name, err)
+	}
+	c := &TopologyClock{Device: filepath.Join("/dev", name), Index: index}
+	if c.Name, err = readSysfsString(dir, "clock_name"); err != nil {
+		return nil, fmt.Errorf("reading clock name of %s: %w", name, err)
+	}
+	c.Virtual = c.Name == ClockNameKVM || c.Name == ClockNameVMW
+	if c.MaxAdjustment, err = readSysfsInt(dir, "max_adjustment"); err != nil {
+		return nil, err
+	}
+	extts, err := readSysfsInt(dir, "n_external_timestamps")
+	if err != nil {
+		return nil, err
+	}
+	perout, err := readSysfsInt(dir, "n_periodic_outputs")
+	if err != nil {
+		return nil, err
+	}
+	pps, err := readSysfsInt(dir, "pps_available")
+	if err != nil {
+		return nil, err
+	}
+	c.ExtTS, c.PerOut, c.PPS = int(extts), int(perout), pps != 0
+	if c.Pins, err = readPins(dir); err != nil {
+		return nil, fmt.Errorf("reading pins of %s: %w", name, err)
+	}
+	// NIC clocks link to the parent device, which lists its network interfaces
+	c.Ifaces = []TopologyIface{}
+	if bus, err := filepath.EvalSymlinks(filepath.Join(dir, "device")); err == nil {
+		c.Bus = filepath.Base(bus)
+	}
+	nets, err := os.ReadDir(filepath.Join(dir, "device", "net"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("listing interfaces of %s: %w", name, err)
+	}
+	for _, e := range nets {
+		iface := TopologyIface{Name: e.Name()}
+		if iface.HWTstamp, err = hwtstampReader(e.Name()); err != nil {
+			iface.HWTstampError = err.Error()
+		}
+		c.Ifaces = append(c.Ifaces, iface)
+	}
+	return c, nil
+}
+
+// DiscoverTopology enumerates all PHC devices with their pins, parent NICs
+// and hardware timestamping settings of the NIC interfaces
+func DiscoverTopology() (*Topology, error) {
+	entries, err := os.ReadDir(sysfsPTP)
+	if err != nil {
+		return nil, fmt.Errorf("listing PTP clocks: %w", err)
+	}
+	t := &Topology{Clocks: []TopologyClock{}}
+	for _, e := range entries {
+		c, err := readClock(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		t.Clocks = append(t.Clocks, *c)
+	}
+	sort.Slice(t.Clocks, func(i, j int) bool { return t.Clocks[i].Index < t.Clocks[j].Index })
+	return t, nil
+}
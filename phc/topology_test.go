@@ -0,0 +1,107 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverTopology(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content+"\n"), 0644))
+	}
+	// NIC clock with pins and two ports, parent device symlinked like in sysfs
+	write("devices/0000:01:00.0/net/eth0/ifindex", "2")
+	write("devices/0000:01:00.0/net/eth1/ifindex", "3")
+	write("class/ptp2/clock_name", "mlx5_ptp")
+	write("class/ptp2/max_adjustment", "100000000")
+	write("class/ptp2/n_external_timestamps", "2")
+	write("class/ptp2/n_periodic_outputs", "1")
+	write("class/ptp2/pps_available", "1")
+	write("class/ptp2/pins/SMA1", "1 0")
+	write("class/ptp2/pins/SMA2", "2 1")
+	require.NoError(t, os.Symlink(filepath.Join(dir, "devices/0000:01:00.0"), filepath.Join(dir, "class/ptp2/device")))
+	// virtual clock of an old kernel, without the newer attributes
+	write("class/ptp0/clock_name", ClockNameKVM)
+
+	orig := sysfsPTP
+	sysfsPTP = filepath.Join(dir, "class")
+	t.Cleanup(func() { sysfsPTP = orig })
+	origReader := hwtstampReader
+	hwtstampReader = func(iface string) (*HWTstampConfig, error) {
+		if iface == "eth1" {
+			return nil, fmt.Errorf("operation not supported")
+		}
+		return &HWTstampConfig{TXType: HWTstampTXOn, RXFilter: HWTstampFilterAll}, nil
+	}
+	t.Cleanup(func() { hwtstampReader = origReader })
+
+	topo, err := DiscoverTopology()
+	require.NoError(t, err)
+	require.Equal(t, &Topology{Clocks: []TopologyClock{
+		{
+			Device:  "/dev/ptp0",
+			Index:   0,
+			Name:    ClockNameKVM,
+			Virtual: true,
+			Pins:    []Pin{},
+			Ifaces:  []TopologyIface{},
+		},
+		{
+			Device:        "/dev/ptp2",
+			Index:         2,
+			Name:          "mlx5_ptp",
+			MaxAdjustment: 100000000,
+			ExtTS:         2,
+			PerOut:        1,
+			PPS:           true,
+			Bus:           "0000:01:00.0",
+			Pins: []Pin{
+				{Name: "SMA1", Function: PinFuncExtTS, Channel: 0},
+				{Name: "SMA2", Function: PinFuncPerOut, Channel: 1},
+			},
+			Ifaces: []TopologyIface{
+				{Name: "eth0", HWTstamp: &HWTstampConfig{TXType: HWTstampTXOn, RXFilter: HWTstampFilterAll}},
+				{Name: "eth1", HWTstampError: "operation not supported"},
+			},
+		},
+	}}, topo)
+
+	c, ok := topo.Clock("eth1")
+	require.True(t, ok)
+	require.Equal(t, "/dev/ptp2", c.Device)
+	require.True(t, c.Ifaces[0].HWTstamp.Enabled())
+	_, ok = topo.Clock("eth2")
+	require.False(t, ok)
+
+	// broken pin assignment
+	write("class/ptp2/pins/SMA3", "garbage")
+	_, err = DiscoverTopology()
+	require.Error(t, err)
+}
+
+func TestPinFuncName(t *testing.T) {
+	require.Equal(t, "extts", PinFuncName(PinFuncExtTS))
+	require.Equal(t, "unknown(7)", PinFuncName(7))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Clock names virtual PHC drivers register with
+const (
+	// ClockNameKVM is registered by ptp_kvm driver
+	ClockNameKVM = "KVM virtual PTP"
+	// ClockNameVMW is registered by ptp_vmw driver
+	ClockNameVMW = "ptp_vmw"
+)
+
+// ErrNoVirtualPHC is returned when no virtual PHC device is present
+var ErrNoVirtualPHC = errors.New("no virtual PHC device found")
+
+// sysfsPTP is where the kernel exposes PTP clock attributes
+var sysfsPTP = "/sys/class/ptp"
+
+// ClockName returns the name the PHC device driver registered the clock with
+func ClockName(device string) (string, error) {
+	name, err := os.ReadFile(filepath.Join(sysfsPTP, filepath.Base(device), "clock_name"))
+	if err != nil {
+		return "", fmt.Errorf("reading clock name of %s: %w", device, err)
+	}
+	return strings.TrimSpace(string(name)), nil
+}
+
+// IsVirtual checks whether the PHC device is exposed by the hypervisor.
+// Such clocks follow the host time and can't be adjusted or used for packet timestamping
+func IsVirtual(device string) (bool, error) {
+	name, err := ClockName(device)
+	if err != nil {
+		return false, err
+	}
+	switch name {
+	case ClockNameKVM, ClockNameVMW:
+		return true, nil
+	}
+	return false, nil
+}
+
+// VirtualDevice returns path to the first virtual PHC device
+func VirtualDevice() (string, error) {
+	entries, err := os.ReadDir(sysfsPTP)
+	if err != nil {
+		return "", fmt.Errorf("listing PTP clocks: %w", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		device := filepath.Join("/dev", name)
+		virtual, err := IsVirtual(device)
+		if err != nil {
+			continue
+		}
+		if virtual {
+			return device, nil
+		}
+	}
+	return "", ErrNoVirtualPHC
+}
@@ -0,0 +1,66 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fakeSysfsPTP(t *testing.T, clocks map[string]string) {
+	dir := t.TempDir()
+	for device, name := range clocks {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, device), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, device, "clock_name"), []byte(name+"\n"), 0644))
+	}
+	orig := sysfsPTP
+	sysfsPTP = dir
+	t.Cleanup(func() { sysfsPTP = orig })
+}
+
+func TestClockName(t *testing.T) {
+	fakeSysfsPTP(t, map[string]string{"ptp0": "mlx5_ptp", "ptp1": ClockNameKVM})
+
+	name, err := ClockName("/dev/ptp0")
+	require.NoError(t, err)
+	require.Equal(t, "mlx5_ptp", name)
+
+	virtual, err := IsVirtual("/dev/ptp0")
+	require.NoError(t, err)
+	require.False(t, virtual)
+
+	virtual, err = IsVirtual("/dev/ptp1")
+	require.NoError(t, err)
+	require.True(t, virtual)
+
+	_, err = IsVirtual("/dev/ptp2")
+	require.Error(t, err)
+}
+
+func TestVirtualDevice(t *testing.T) {
+	fakeSysfsPTP(t, map[string]string{"ptp0": "mlx5_ptp", "ptp2": ClockNameVMW, "ptp1": ClockNameKVM})
+	device, err := VirtualDevice()
+	require.NoError(t, err)
+	require.Equal(t, "/dev/ptp1", device)
+
+	fakeSysfsPTP(t, map[string]string{"ptp0": "mlx5_ptp"})
+	_, err = VirtualDevice()
+	require.ErrorIs(t, err, ErrNoVirtualPHC)
+}
@@ -0,0 +1,255 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package anonymize replaces client addresses and clock identities in PTP captures
+consistently, so captures can be shared without leaking the topology.
+
+Addresses and identities are mapped with HMAC-SHA256 under a secret key: the same
+input always maps to the same output for one key, and the mapping can't be reversed
+without it. PTP fields are patched in place, so everything else in the packet stays as captured.
+*/
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// KeySize is the size of the anonymization key
+const KeySize = 32
+
+// offsets of the port identities in the PTP messages
+const (
+	headerSize                   = 34
+	sourcePortIdentityOffset     = 20
+	grandmasterIdentityOffset    = 53
+	requestingPortIdentityOffset = 44
+	targetPortIdentityOffset     = 34
+	announceTLVOffset            = 64
+	signalingTLVOffset           = 44
+	managementTLVOffset          = 48
+	clockIdentitySize            = 8
+	tlvHeadSize                  = 4
+	managementIDSize             = 2
+)
+
+// offsets of the clock identities in the data of the management TLVs
+const (
+	defaultDataSetClockIdentityOffset = 10
+	parentPortIdentityOffset          = 0
+	parentGrandmasterIdentityOffset   = 24
+)
+
+// kinds of the mapped values, so equal bytes of different kinds map differently
+const (
+	kindMAC   = "mac"
+	kindIPv4  = "ipv4"
+	kindIPv6  = "ipv6"
+	kindClock = "clock"
+)
+
+// Anonymizer maps addresses and clock identities. It is safe for concurrent use
+type Anonymizer struct {
+	key  []byte
+	keep []*net.IPNet
+
+	sync.Mutex
+	mapping map[string]map[string]string
+}
+
+// New returns Anonymizer with the key. Addresses within the keep prefixes are left as is
+func New(key []byte, keep []*net.IPNet) (*Anonymizer, error) {
+	if len(key) < KeySize {
+		return nil, fmt.Errorf("key must be at least %d bytes, got %d", KeySize, len(key))
+	}
+	return &Anonymizer{key: key, keep: keep, mapping: map[string]map[string]string{}}, nil
+}
+
+// sum returns the keyed hash of the value of the kind
+func (a *Anonymizer) sum(kind string, b []byte) []byte {
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(kind))
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// record remembers the mapping so it can be reported
+func (a *Anonymizer) record(kind, from, to string) {
+	a.Lock()
+	defer a.Unlock()
+	m, ok := a.mapping[kind]
+	if !ok {
+		m = map[string]string{}
+		a.mapping[kind] = m
+	}
+	m[from] = to
+}
+
+// Mapping returns the original to anonymized values seen so far, per kind.
+// It reveals the original values and must not be shared along with the capture
+func (a *Anonymizer) Mapping() map[string]map[string]string {
+	a.Lock()
+	defer a.Unlock()
+	res := make(map[string]map[string]string, len(a.mapping))
+	for kind, m := range a.mapping {
+		res[kind] = make(map[string]string, len(m))
+		for from, to := range m {
+			res[kind][from] = to
+		}
+	}
+	return res
+}
+
+// MAC returns the anonymized MAC address. Group addresses are kept as is,
+// the rest becomes a locally administered unicast address
+func (a *Anonymizer) MAC(mac net.HardwareAddr) net.HardwareAddr {
+	if len(mac) == 0 || mac[0]&0x01 != 0 {
+		return mac
+	}
+	res := net.HardwareAddr(a.sum(kindMAC, mac)[:len(mac)])
+	res[0] = res[0]&^0x01 | 0x02
+	a.record(kindMAC, mac.String(), res.String())
+	return res
+}
+
+// IP returns the anonymized IP. Multicast, loopback, unspecified and kept addresses are left as is.
+// IPv4 maps into 10.0.0.0/8 and IPv6 into fd00::/8, so anonymized addresses are easy to tell
+func (a *Anonymizer) IP(ip net.IP) net.IP {
+	if ip.IsMulticast() || ip.IsLoopback() || ip.IsUnspecified() {
+		return ip
+	}
+	for _, n := range a.keep {
+		if n.Contains(ip) {
+			return ip
+		}
+	}
+	var res net.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		res = make(net.IP, net.IPv4len)
+		copy(res, a.sum(kindIPv4, ip4))
+		res[0] = 10
+	} else {
+		res = make(net.IP, net.IPv6len)
+		copy(res, a.sum(kindIPv6, ip.To16()))
+		res[0] = 0xfd
+	}
+	a.record(kindIP(ip), ip.String(), res.String())
+	return res
+}
+
+func kindIP(ip net.IP) string {
+	if ip.To4() != nil {
+		return kindIPv4
+	}
+	return kindIPv6
+}
+
+// ClockIdentity returns the anonymized clock identity. Zero and wildcard identities are kept as is
+func (a *Anonymizer) ClockIdentity(c ptp.ClockIdentity) ptp.ClockIdentity {
+	if c == 0 || c == ^ptp.ClockIdentity(0) {
+		return c
+	}
+	b := make([]byte, clockIdentitySize)
+	binary.BigEndian.PutUint64(b, uint64(c))
+	res := ptp.ClockIdentity(binary.BigEndian.Uint64(a.sum(kindClock, b)))
+	a.record(kindClock, c.String(), res.String())
+	return res
+}
+
+// clockIdentityAt anonymizes the clock identity at the offset of b, if b is long enough
+func (a *Anonymizer) clockIdentityAt(b []byte, off int) {
+	if len(b) < off+clockIdentitySize {
+		return
+	}
+	c := ptp.ClockIdentity(binary.BigEndian.Uint64(b[off:]))
+	binary.BigEndian.PutUint64(b[off:], uint64(a.ClockIdentity(c)))
+}
+
+// tlvs anonymizes clock identities in the PATH_TRACE and MANAGEMENT TLVs starting at the offset of b
+func (a *Anonymizer) tlvs(b []byte, off int) {
+	for off+tlvHeadSize <= len(b) {
+		tlvType := ptp.TLVType(binary.BigEndian.Uint16(b[off:]))
+		length := int(binary.BigEndian.Uint16(b[off+2:]))
+		value := off + tlvHeadSize
+		if value+length > len(b) {
+			return
+		}
+		switch tlvType {
+		case ptp.TLVPathTrace:
+			for i := value; i+clockIdentitySize <= value+length; i += clockIdentitySize {
+				a.clockIdentityAt(b, i)
+			}
+		case ptp.TLVManagement:
+			a.managementTLV(b[value : value+length])
+		}
+		off = value + length
+	}
+}
+
+// managementTLV anonymizes clock identities in the data sets carried by the MANAGEMENT TLV value
+func (a *Anonymizer) managementTLV(v []byte) {
+	if len(v) < managementIDSize {
+		return
+	}
+	data := v[managementIDSize:]
+	switch ptp.ManagementID(binary.BigEndian.Uint16(v)) {
+	case ptp.IDDefaultDataSet:
+		a.clockIdentityAt(data, defaultDataSetClockIdentityOffset)
+	case ptp.IDParentDataSet:
+		a.clockIdentityAt(data, parentPortIdentityOffset)
+		a.clockIdentityAt(data, parentGrandmasterIdentityOffset)
+	}
+}
+
+// PTP anonymizes the clock identities of the PTP message in place.
+// It returns an error if b is not a PTPv2 message
+func (a *Anonymizer) PTP(b []byte) error {
+	if len(b) < headerSize {
+		return fmt.Errorf("PTP message too short: %d bytes", len(b))
+	}
+	if v := b[1] & 0x0f; v != ptp.MajorVersion {
+		return fmt.Errorf("unsupported PTP version %d", v)
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < headerSize {
+		return fmt.Errorf("invalid PTP message length %d", length)
+	}
+	if length < len(b) {
+		b = b[:length]
+	}
+	a.clockIdentityAt(b, sourcePortIdentityOffset)
+	switch ptp.MessageType(b[0] & 0x0f) {
+	case ptp.MessageAnnounce:
+		a.clockIdentityAt(b, grandmasterIdentityOffset)
+		a.tlvs(b, announceTLVOffset)
+	case ptp.MessageDelayResp, ptp.MessagePDelayResp, ptp.MessagePDelayRespFollowUp:
+		a.clockIdentityAt(b, requestingPortIdentityOffset)
+	case ptp.MessageSignaling:
+		a.clockIdentityAt(b, targetPortIdentityOffset)
+		a.tlvs(b, signalingTLVOffset)
+	case ptp.MessageManagement:
+		a.clockIdentityAt(b, targetPortIdentityOffset)
+		a.tlvs(b, managementTLVOffset)
+	}
+	return nil
+}
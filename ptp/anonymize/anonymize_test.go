@@ -0,0 +1,253 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anonymize
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+var testKey = bytes.Repeat([]byte{1}, KeySize)
+
+func testAnnounce(t *testing.T) []byte {
+	a := &ptp.Announce{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageAnnounce, 0),
+			Version:            ptp.Version,
+			MessageLength:      76,
+			SourcePortIdentity: ptp.PortIdentity{ClockIdentity: 0x1122334455667788, PortNumber: 1},
+		},
+		AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 0x1122334455667788, StepsRemoved: 1},
+		TLVs: []ptp.TLV{
+			&ptp.PathTraceTLV{
+				TLVHead:      ptp.TLVHead{TLVType: ptp.TLVPathTrace, LengthField: 8},
+				PathSequence: []ptp.ClockIdentity{0x1122334455667788},
+			},
+		},
+	}
+	b, err := ptp.Bytes(a)
+	require.NoError(t, err)
+	return b
+}
+
+func testPacket(t *testing.T, src, dst net.IP, port layers.UDPPort, payload []byte) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x0c, 0x42, 0xa1, 0x01, 0x02, 0x03},
+		DstMAC:       net.HardwareAddr{0x0c, 0x42, 0xa1, 0x04, 0x05, 0x06},
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: src, DstIP: dst}
+	udp := &layers.UDP{SrcPort: port, DstPort: port}
+	require.NoError(t, udp.SetNetworkLayerForChecksum(ip))
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	require.NoError(t, gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(payload)))
+	return buf.Bytes()
+}
+
+func TestNewShortKey(t *testing.T) {
+	_, err := New([]byte("secret"), nil)
+	require.Error(t, err)
+}
+
+func TestAnonymizeConsistent(t *testing.T) {
+	a, err := New(testKey, nil)
+	require.NoError(t, err)
+	b, err := New(bytes.Repeat([]byte{2}, KeySize), nil)
+	require.NoError(t, err)
+
+	ip := net.ParseIP("2001:db8::1")
+	require.Equal(t, a.IP(ip), a.IP(ip))
+	require.NotEqual(t, a.IP(ip), b.IP(ip))
+	require.Equal(t, byte(0xfd), a.IP(ip)[0])
+	require.Equal(t, byte(10), a.IP(net.ParseIP("192.0.2.1")).To4()[0])
+
+	mac := net.HardwareAddr{0x0c, 0x42, 0xa1, 0x01, 0x02, 0x03}
+	require.Equal(t, a.MAC(mac), a.MAC(mac))
+	require.Equal(t, byte(0x02), a.MAC(mac)[0]&0x03)
+
+	require.Equal(t, a.ClockIdentity(0x1122334455667788), a.ClockIdentity(0x1122334455667788))
+	require.NotEqual(t, ptp.ClockIdentity(0x1122334455667788), a.ClockIdentity(0x1122334455667788))
+}
+
+func TestAnonymizeKeep(t *testing.T) {
+	_, keep, err := net.ParseCIDR("2001:db8:1::/48")
+	require.NoError(t, err)
+	a, err := New(testKey, []*net.IPNet{keep})
+	require.NoError(t, err)
+
+	for _, ip := range []string{"2001:db8:1::1", "ff0e::181", "224.0.1.129", "::1", "::"} {
+		require.Equal(t, net.ParseIP(ip), a.IP(net.ParseIP(ip)), ip)
+	}
+	broadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	require.Equal(t, broadcast, a.MAC(broadcast))
+	require.Equal(t, ptp.ClockIdentity(0), a.ClockIdentity(0))
+	require.Equal(t, ^ptp.ClockIdentity(0), a.ClockIdentity(^ptp.ClockIdentity(0)))
+}
+
+func TestAnonymizePTP(t *testing.T) {
+	a, err := New(testKey, nil)
+	require.NoError(t, err)
+
+	b := testAnnounce(t)
+	require.NoError(t, a.PTP(b))
+	p, err := ptp.DecodePacket(b)
+	require.NoError(t, err)
+	announce := p.(*ptp.Announce)
+	anonymized := a.ClockIdentity(0x1122334455667788)
+	require.Equal(t, anonymized, announce.SourcePortIdentity.ClockIdentity)
+	require.Equal(t, uint16(1), announce.SourcePortIdentity.PortNumber)
+	require.Equal(t, anonymized, announce.GrandmasterIdentity)
+	require.Equal(t, uint16(1), announce.StepsRemoved)
+	require.Equal(t, []ptp.ClockIdentity{anonymized}, announce.TLVs[0].(*ptp.PathTraceTLV).PathSequence)
+
+	require.Error(t, a.PTP([]byte{0x0b, 0x02}))
+	b[1] = 1
+	require.Error(t, a.PTP(b))
+}
+
+func TestAnonymizePTPManagement(t *testing.T) {
+	a, err := New(testKey, nil)
+	require.NoError(t, err)
+	anonymized := a.ClockIdentity(0x1122334455667788)
+
+	head := ptp.ManagementMsgHead{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageManagement, 0),
+			Version:            ptp.Version,
+			SourcePortIdentity: ptp.PortIdentity{ClockIdentity: 0x1122334455667788, PortNumber: 1},
+		},
+		TargetPortIdentity: ptp.PortIdentity{ClockIdentity: 0x1122334455667788, PortNumber: 2},
+		ActionField:        ptp.RESPONSE,
+	}
+
+	head.MessageLength = 48 + 26
+	m := &ptp.Management{
+		ManagementMsgHead: head,
+		TLV: &ptp.DefaultDataSetTLV{
+			ManagementTLVHead: ptp.ManagementTLVHead{
+				TLVHead:      ptp.TLVHead{TLVType: ptp.TLVManagement, LengthField: 22},
+				ManagementID: ptp.IDDefaultDataSet,
+			},
+			NumberPorts:   1,
+			Priority1:     128,
+			ClockIdentity: 0x1122334455667788,
+			DomainNumber:  24,
+		},
+	}
+	b, err := m.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, a.PTP(b))
+	got := &ptp.Management{}
+	require.NoError(t, got.UnmarshalBinary(b))
+	require.Equal(t, anonymized, got.SourcePortIdentity.ClockIdentity)
+	require.Equal(t, anonymized, got.TargetPortIdentity.ClockIdentity)
+	dds := got.TLV.(*ptp.DefaultDataSetTLV)
+	require.Equal(t, anonymized, dds.ClockIdentity)
+	require.Equal(t, uint8(128), dds.Priority1)
+	require.Equal(t, uint8(24), dds.DomainNumber)
+
+	head.MessageLength = 48 + 38
+	m = &ptp.Management{
+		ManagementMsgHead: head,
+		TLV: &ptp.ParentDataSetTLV{
+			ManagementTLVHead: ptp.ManagementTLVHead{
+				TLVHead:      ptp.TLVHead{TLVType: ptp.TLVManagement, LengthField: 34},
+				ManagementID: ptp.IDParentDataSet,
+			},
+			ParentPortIdentity:   ptp.PortIdentity{ClockIdentity: 0x1122334455667788, PortNumber: 3},
+			GrandmasterPriority1: 128,
+			GrandmasterPriority2: 127,
+			GrandmasterIdentity:  0x1122334455667788,
+		},
+	}
+	b, err = m.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, a.PTP(b))
+	got = &ptp.Management{}
+	require.NoError(t, got.UnmarshalBinary(b))
+	pds := got.TLV.(*ptp.ParentDataSetTLV)
+	require.Equal(t, ptp.PortIdentity{ClockIdentity: anonymized, PortNumber: 3}, pds.ParentPortIdentity)
+	require.Equal(t, anonymized, pds.GrandmasterIdentity)
+	require.Equal(t, uint8(127), pds.GrandmasterPriority2)
+}
+
+func TestAnonymizePacket(t *testing.T) {
+	a, err := New(testKey, nil)
+	require.NoError(t, err)
+
+	src, dst := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	data := testPacket(t, src, dst, layers.UDPPort(ptp.PortGeneral), testAnnounce(t))
+	res, err := a.Packet(data, layers.LinkTypeEthernet)
+	require.NoError(t, err)
+	require.Len(t, res, len(data))
+
+	packet := gopacket.NewPacket(res, layers.LinkTypeEthernet, gopacket.Default)
+	require.Nil(t, packet.ErrorLayer())
+	eth := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	require.Equal(t, a.MAC(net.HardwareAddr{0x0c, 0x42, 0xa1, 0x01, 0x02, 0x03}), eth.SrcMAC)
+	ip := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	require.Equal(t, a.IP(src), ip.SrcIP)
+	require.Equal(t, a.IP(dst), ip.DstIP)
+
+	// checksum matches the anonymized content
+	expected := testPacket(t, a.IP(src), a.IP(dst), layers.UDPPort(ptp.PortGeneral), packet.Layer(layers.LayerTypeUDP).LayerPayload())
+	require.Equal(t, expected[14:], res[14:])
+
+	_, err = a.Packet(testPacket(t, src, dst, 53, []byte("dns")), layers.LinkTypeEthernet)
+	require.Equal(t, errNotPTP, err)
+}
+
+func TestAnonymizeCapture(t *testing.T) {
+	a, err := New(testKey, nil)
+	require.NoError(t, err)
+
+	src, dst := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	var in bytes.Buffer
+	w := pcapgo.NewWriterNanos(&in)
+	require.NoError(t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+	for _, data := range [][]byte{
+		testPacket(t, src, dst, layers.UDPPort(ptp.PortGeneral), testAnnounce(t)),
+		testPacket(t, src, dst, 53, []byte("dns")),
+		testPacket(t, src, dst, layers.UDPPort(ptp.PortEvent), []byte{1, 2, 3}),
+	} {
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(0, 1), CaptureLength: len(data), Length: len(data)}
+		require.NoError(t, w.WritePacket(ci, data))
+	}
+
+	var out bytes.Buffer
+	res, err := a.Capture(bytes.NewReader(in.Bytes()), &out)
+	require.NoError(t, err)
+	require.Equal(t, Result{Written: 1, NotPTP: 1, Malformed: 1}, res)
+
+	r, err := pcapgo.NewReader(&out)
+	require.NoError(t, err)
+	data, ci, err := r.ReadPacketData()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), ci.Timestamp.UnixNano())
+	require.NotContains(t, string(data), string(src.To16()))
+	require.Contains(t, a.Mapping()[kindIPv6], src.String())
+}
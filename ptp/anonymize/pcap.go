@@ -0,0 +1,188 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anonymize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// linuxSLL header fields used to find the link layer address
+const (
+	sllAddrTypeEther = 1
+	sllAddrLenOffset = 4
+	sllAddrOffset    = 6
+	macSize          = 6
+)
+
+// errNotPTP is returned for packets which are not PTP over UDP
+var errNotPTP = errors.New("not a PTP over UDP packet")
+
+// Result counts the packets of the capture
+type Result struct {
+	Written   int
+	NotPTP    int
+	Malformed int
+}
+
+// packetSource abstracts packet sources provided by pcapgo.Reader and pcapgo.NgReader
+type packetSource interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+// openCapture returns the reader of the pcap or pcapng capture
+func openCapture(r io.ReadSeeker) (packetSource, error) {
+	src, err := pcapgo.NewNgReader(r, pcapgo.DefaultNgReaderOptions)
+	if err == nil {
+		return src, nil
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return pcapgo.NewReader(r)
+}
+
+// Capture writes the PTP packets of the pcap or pcapng capture to w as pcap, anonymized.
+// Other packets could leak addresses in ways the anonymizer doesn't know about and are dropped
+func (a *Anonymizer) Capture(r io.ReadSeeker, w io.Writer) (Result, error) {
+	res := Result{}
+	src, err := openCapture(r)
+	if err != nil {
+		return res, fmt.Errorf("reading capture: %w", err)
+	}
+	linkType := src.LinkType()
+	out := pcapgo.NewWriterNanos(w)
+	if err := out.WriteFileHeader(uint32(1<<16-1), linkType); err != nil {
+		return res, err
+	}
+	for {
+		data, ci, err := src.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return res, nil
+		}
+		if err != nil {
+			return res, fmt.Errorf("reading packet %d: %w", res.Written+res.NotPTP+res.Malformed+1, err)
+		}
+		anonymized, err := a.Packet(data, linkType)
+		if errors.Is(err, errNotPTP) {
+			res.NotPTP++
+			continue
+		}
+		if err != nil || ci.CaptureLength < ci.Length {
+			res.Malformed++
+			continue
+		}
+		ci.CaptureLength = len(anonymized)
+		ci.Length = len(anonymized)
+		if err := out.WritePacket(ci, anonymized); err != nil {
+			return res, err
+		}
+		res.Written++
+	}
+}
+
+// macAt anonymizes the MAC address at the offset of b
+func (a *Anonymizer) macAt(b []byte, off int) {
+	if len(b) < off+macSize {
+		return
+	}
+	copy(b[off:], a.MAC(net.HardwareAddr(b[off:off+macSize])))
+}
+
+// link anonymizes the link layer addresses in place
+func (a *Anonymizer) link(b []byte, linkType layers.LinkType) {
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		a.macAt(b, 0)
+		a.macAt(b, macSize)
+	case layers.LinkTypeLinuxSLL:
+		if len(b) > sllAddrLenOffset+1 && b[2] == 0 && b[3] == sllAddrTypeEther && b[sllAddrLenOffset+1] == macSize {
+			a.macAt(b, sllAddrOffset)
+		}
+	}
+}
+
+// Packet returns the anonymized copy of the PTP over UDP packet of the link type
+func (a *Anonymizer) Packet(data []byte, linkType layers.LinkType) ([]byte, error) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.Default)
+	udp, ok := packet.TransportLayer().(*layers.UDP)
+	if !ok || !isPTPPort(udp.SrcPort) && !isPTPPort(udp.DstPort) {
+		return nil, errNotPTP
+	}
+	if l := packet.ErrorLayer(); l != nil {
+		return nil, l.Error()
+	}
+	// only link layers are allowed before IP and nothing between IP and UDP
+	pkts := packet.Layers()
+	prefix := 0
+	var network gopacket.SerializableLayer
+	for i, l := range pkts {
+		switch ip := l.(type) {
+		case *layers.IPv4:
+			ip.SrcIP, ip.DstIP = a.IP(ip.SrcIP), a.IP(ip.DstIP)
+			network = ip
+		case *layers.IPv6:
+			ip.SrcIP, ip.DstIP = a.IP(ip.SrcIP), a.IP(ip.DstIP)
+			network = ip
+		default:
+			prefix += len(l.LayerContents())
+			continue
+		}
+		if i+1 >= len(pkts) || pkts[i+1] != udp {
+			return nil, fmt.Errorf("unsupported headers between IP and UDP")
+		}
+		break
+	}
+	if network == nil {
+		return nil, errNotPTP
+	}
+	if err := udp.SetNetworkLayerForChecksum(packet.NetworkLayer()); err != nil {
+		return nil, err
+	}
+	payload := append([]byte{}, udp.Payload...)
+	if err := a.PTP(payload); err != nil {
+		return nil, err
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, network, udp, gopacket.Payload(payload)); err != nil {
+		return nil, err
+	}
+	res := make([]byte, 0, len(data))
+	res = append(res, data[:prefix]...)
+	a.link(res, linkType)
+	res = append(res, buf.Bytes()...)
+	// keep the link layer padding
+	if end := prefix + len(buf.Bytes()); end < len(data) {
+		res = append(res, data[end:]...)
+	}
+	return res, nil
+}
+
+func isPTPPort(p layers.UDPPort) bool {
+	return p == layers.UDPPort(ptp.PortEvent) || p == layers.UDPPort(ptp.PortGeneral)
+}
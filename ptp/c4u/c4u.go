@@ -17,17 +17,44 @@ limitations under the License.
 package c4u
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/facebook/time/ptp/c4u/clock"
 	"github.com/facebook/time/ptp/c4u/stats"
 	"github.com/facebook/time/ptp/c4u/utcoffset"
+	"github.com/facebook/time/ptp/policy"
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/server"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
 
+// Policies applied when the upstream reference is lost
+const (
+	// PolicyFailover pronounces the clock uncalibrated so clients fail over to another GM
+	PolicyFailover = "failover"
+	// PolicyHoldover keeps serving in holdover and then in degraded class so clients can do graceful holdover
+	PolicyHoldover = "holdover"
+)
+
+// Defaults of the calculation, also used by the c4u flags
+const (
+	DefaultAccuracyExpr        = "abs(mean(phcoffset)) + 3 * stddev(phcoffset) + abs(mean(oscillatoroffset)) + 3 * stddev(oscillatoroffset)"
+	DefaultClassExpr           = "p99(oscillatorclass)"
+	DefaultLockBaseLine        = 100 * time.Nanosecond
+	DefaultHoldoverBaseLine    = time.Microsecond
+	DefaultCalibratingBaseLine = 250 * time.Nanosecond
+)
+
+// Target is a ptp4u running in the same process the config is applied to
+type Target interface {
+	// CurrentDynamicConfig returns a copy of the applied dynamic config
+	CurrentDynamicConfig() *server.DynamicConfig
+	// UpdateDynamicConfig applies and persists the dynamic config
+	UpdateDynamicConfig(dc *server.DynamicConfig) error
+}
+
 // Config is a struct representing the config of the c4u
 type Config struct {
 	Apply               bool
@@ -39,6 +66,34 @@ type Config struct {
 	LockBaseLine        ptp.ClockAccuracy
 	CalibratingBaseLine ptp.ClockAccuracy
 	HoldoverBaseLine    ptp.ClockAccuracy
+	LostPolicy          string
+	HoldoverTimeout     time.Duration
+	// Mapping of the measurements to the advertised clock quality. Derived from the baselines if not set
+	Mapping *clock.Mapping
+	// Collect returns the clock data. Data of oscillatord and ts2phc is collected if not set
+	Collect func() (*clock.DataPoint, error)
+	// Target applies the config in-process instead of the file and SIGHUP
+	Target Target
+	// Policy overrides the clock quality by the operator rules
+	Policy *policy.Policy
+
+	// lastGood is the last time the upstream reference was available
+	lastGood time.Time
+	// quality keeps track of how long the quality rules of the policy hold
+	quality *policy.QualityEvaluator
+}
+
+// NewConfig returns the config with the default calculation and failover lost reference policy
+func NewConfig() *Config {
+	return &Config{
+		AccuracyExpr:        DefaultAccuracyExpr,
+		ClassExpr:           DefaultClassExpr,
+		LockBaseLine:        ptp.ClockAccuracyFromOffset(DefaultLockBaseLine),
+		HoldoverBaseLine:    ptp.ClockAccuracyFromOffset(DefaultHoldoverBaseLine),
+		CalibratingBaseLine: ptp.ClockAccuracyFromOffset(DefaultCalibratingBaseLine),
+		LostPolicy:          PolicyFailover,
+		HoldoverTimeout:     time.Hour,
+	}
 }
 
 var defaultConfig = &server.DynamicConfig{
@@ -48,6 +103,69 @@ var defaultConfig = &server.DynamicConfig{
 	MinSubInterval: 1 * time.Second,
 }
 
+// applyLostPolicy overrides the clock quality according to the policy if the upstream reference is lost.
+// With holdover policy the clock stays in holdover for the holdover timeout after the reference was last seen
+// and is degraded afterwards. Clock which never had the reference is degraded right away
+func applyLostPolicy(config *Config, q *ptp.ClockQuality, now time.Time) *ptp.ClockQuality {
+	if q != nil && q.ClockClass != clock.ClockClassUncalibrated {
+		config.lastGood = now
+		return q
+	}
+	if config.LostPolicy != PolicyHoldover {
+		return q
+	}
+	seen := !config.lastGood.IsZero()
+	h, ok := config.holdoverMapping().HoldoverQuality(now.Sub(config.lastGood), seen)
+	if !ok {
+		return q
+	}
+	if seen {
+		log.Warningf("Upstream reference is lost since %v, serving as class %d", config.lastGood, h.ClockClass)
+	} else {
+		log.Warningf("Upstream reference is lost, serving as class %d", h.ClockClass)
+	}
+	return h
+}
+
+// holdoverMapping returns the mapping with holdover steps. Without configured steps the clock is
+// in holdover with the holdover baseline for the holdover timeout and degraded afterwards
+func (c *Config) holdoverMapping() *clock.Mapping {
+	if c.Mapping != nil && len(c.Mapping.Holdover) > 0 {
+		return c.Mapping
+	}
+	return &clock.Mapping{
+		Holdover: []clock.HoldoverStep{
+			{After: 0, Class: clock.ClockClassHoldover, Accuracy: c.HoldoverBaseLine},
+			{After: c.HoldoverTimeout, Class: clock.ClockClassDegraded, Accuracy: ptp.ClockAccuracyUnknown},
+		},
+	}
+}
+
+// applyPolicy overrides the clock quality by the first quality rule of the policy which held for its duration
+func (c *Config) applyPolicy(q *ptp.ClockQuality, dp *clock.DataPoint, now time.Time) *ptp.ClockQuality {
+	if c.Policy == nil {
+		return q
+	}
+	if c.quality == nil {
+		c.quality = c.Policy.NewQualityEvaluator()
+	}
+	u := &policy.QualityUpdate{ClockClass: q.ClockClass, ClockAccuracy: q.ClockAccuracy}
+	if dp != nil {
+		u.PHCOffset = dp.PHCOffset
+		u.OscillatorOffset = dp.OscillatorOffset
+	}
+	rule, err := c.quality.Evaluate(u, now)
+	if err != nil {
+		log.Errorf("Failed to evaluate the quality policy: %v", err)
+	}
+	if rule == nil {
+		return q
+	}
+	log.Warningf("Quality policy rule %q applies", rule.Name)
+	rule.Apply(q)
+	return q
+}
+
 func evaluateClockQuality(config *Config, q *ptp.ClockQuality) *ptp.ClockQuality {
 	w := q
 
@@ -70,7 +188,7 @@ func evaluateClockQuality(config *Config, q *ptp.ClockQuality) *ptp.ClockQuality
 		w.ClockAccuracy = config.HoldoverBaseLine
 	} else if w.ClockClass == clock.ClockClassCalibrating && w.ClockAccuracy < config.CalibratingBaseLine {
 		w.ClockAccuracy = config.CalibratingBaseLine
-	} else if w.ClockClass == clock.ClockClassUncalibrated {
+	} else if w.ClockClass == clock.ClockClassUncalibrated || w.ClockClass == clock.ClockClassDegraded {
 		w.ClockAccuracy = ptp.ClockAccuracyUnknown
 	}
 
@@ -81,7 +199,11 @@ func evaluateClockQuality(config *Config, q *ptp.ClockQuality) *ptp.ClockQuality
 func Run(config *Config, rb *clock.RingBuffer, st stats.Stats) error {
 	defer st.Snapshot()
 	dataError := false
-	dp, err := clock.Run()
+	collect := config.Collect
+	if collect == nil {
+		collect = clock.Run
+	}
+	dp, err := collect()
 	if err != nil {
 		log.Errorf("Failed to collect clock data: %v", err)
 		dataError = true
@@ -98,14 +220,19 @@ func Run(config *Config, rb *clock.RingBuffer, st stats.Stats) error {
 		st.SetOscillatorOffsetNS(0)
 	}
 
-	w, err := clock.Worst(rb.Data(), config.AccuracyExpr, config.ClassExpr)
+	w, err := clock.Worst(rb.Data(), config.AccuracyExpr, config.ClassExpr, config.Mapping)
 	if err != nil {
 		return err
 	}
-	st.SetClockAccuracyWorst(int64(w.ClockAccuracy))
+	if w != nil {
+		st.SetClockAccuracyWorst(int64(w.ClockAccuracy))
+	} else {
+		st.SetClockAccuracyWorst(int64(ptp.ClockAccuracyUnknown))
+	}
 
 	// Evaluate and override if needed
-	q := evaluateClockQuality(config, w)
+	now := time.Now()
+	q := config.applyPolicy(evaluateClockQuality(config, applyLostPolicy(config, w, now)), dp, now)
 
 	// UTC data
 	u, err := utcoffset.Run()
@@ -122,10 +249,15 @@ func Run(config *Config, rb *clock.RingBuffer, st stats.Stats) error {
 		st.ResetDataError()
 	}
 
-	current, err := server.ReadDynamicConfig(config.Path)
-	if err != nil {
-		log.Errorf("Failed read current ptp4u config: %v. Using defaults", err)
-		current = defaultConfig
+	var current *server.DynamicConfig
+	if config.Target != nil {
+		current = config.Target.CurrentDynamicConfig()
+	} else {
+		current, err = server.ReadDynamicConfig(config.Path)
+		if err != nil {
+			log.Errorf("Failed read current ptp4u config: %v. Using defaults", err)
+			current = defaultConfig
+		}
 	}
 	pending := &server.DynamicConfig{}
 	*pending = *current
@@ -138,11 +270,18 @@ func Run(config *Config, rb *clock.RingBuffer, st stats.Stats) error {
 	st.SetClockAccuracy(int64(pending.ClockAccuracy))
 	st.SetUTCOffsetSec(int64(pending.UTCOffset.Seconds()))
 
-	if *current != *pending {
+	if !reflect.DeepEqual(current, pending) {
 		log.Infof("Current: %+v", current)
 		log.Infof("Pending: %+v", pending)
 
-		if config.Apply {
+		if config.Target != nil {
+			if err := config.Target.UpdateDynamicConfig(pending); err != nil {
+				log.Errorf("Failed to apply the ptp4u config: %v", err)
+				return nil
+			}
+			log.Info("Applied a pending config to ptp4u")
+			st.IncReload()
+		} else if config.Apply {
 			log.Infof("Saving a pending config to %s", config.Path)
 			err := pending.Write(config.Path)
 			if err != nil {
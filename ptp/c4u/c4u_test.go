@@ -24,6 +24,7 @@ import (
 	"github.com/facebook/time/ptp/c4u/clock"
 	"github.com/facebook/time/ptp/c4u/stats"
 	"github.com/facebook/time/ptp/c4u/utcoffset"
+	"github.com/facebook/time/ptp/policy"
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/server"
 	"github.com/stretchr/testify/require"
@@ -71,6 +72,66 @@ func TestRun(t *testing.T) {
 	require.Equal(t, expected, dc)
 }
 
+type fakeTarget struct {
+	dc      server.DynamicConfig
+	applied int
+}
+
+func (f *fakeTarget) CurrentDynamicConfig() *server.DynamicConfig {
+	dc := f.dc
+	return &dc
+}
+
+func (f *fakeTarget) UpdateDynamicConfig(dc *server.DynamicConfig) error {
+	f.dc = *dc
+	f.applied++
+	return nil
+}
+
+func TestRunTarget(t *testing.T) {
+	target := &fakeTarget{dc: *defaultConfig}
+	c := NewConfig()
+	c.Target = target
+	c.Collect = func() (*clock.DataPoint, error) {
+		return &clock.DataPoint{PHCOffset: 10 * time.Nanosecond, OscillatorClockClass: clock.ClockClassLock}, nil
+	}
+
+	st := stats.NewJSONStats()
+	rb := clock.NewRingBuffer(2)
+	require.NoError(t, Run(c, rb, st))
+	require.Equal(t, 1, target.applied)
+	require.Equal(t, clock.ClockClassLock, target.dc.ClockClass)
+	require.Equal(t, ptp.ClockAccuracyNanosecond100, target.dc.ClockAccuracy)
+	require.Equal(t, defaultConfig.DrainInterval, target.dc.DrainInterval)
+
+	// nothing changed
+	require.NoError(t, Run(c, rb, st))
+	require.Equal(t, 1, target.applied)
+}
+
+func TestApplyPolicy(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+quality:
+  - name: offset-out-of-spec
+    when: "abs(phcoffset) > 1000"
+    for: 60s
+    clockclass: 187
+`))
+	require.NoError(t, err)
+	c := &Config{Policy: p}
+	now := time.Now()
+	dp := &clock.DataPoint{PHCOffset: 2 * time.Microsecond}
+
+	q := c.applyPolicy(&ptp.ClockQuality{ClockClass: clock.ClockClassLock, ClockAccuracy: ptp.ClockAccuracyNanosecond100}, dp, now)
+	require.Equal(t, &ptp.ClockQuality{ClockClass: clock.ClockClassLock, ClockAccuracy: ptp.ClockAccuracyNanosecond100}, q)
+
+	q = c.applyPolicy(&ptp.ClockQuality{ClockClass: clock.ClockClassLock, ClockAccuracy: ptp.ClockAccuracyNanosecond100}, dp, now.Add(time.Minute))
+	require.Equal(t, &ptp.ClockQuality{ClockClass: clock.ClockClassDegraded, ClockAccuracy: ptp.ClockAccuracyNanosecond100}, q)
+
+	q = c.applyPolicy(&ptp.ClockQuality{ClockClass: clock.ClockClassLock, ClockAccuracy: ptp.ClockAccuracyNanosecond100}, &clock.DataPoint{}, now.Add(2*time.Minute))
+	require.Equal(t, clock.ClockClassLock, q.ClockClass)
+}
+
 func TestEvaluateClockQuality(t *testing.T) {
 	c := &Config{
 		LockBaseLine:        ptp.ClockAccuracyMicrosecond1,
@@ -114,3 +175,55 @@ func TestEvaluateClockQuality(t *testing.T) {
 	q = evaluateClockQuality(c, &ptp.ClockQuality{ClockClass: clock.ClockClassUncalibrated, ClockAccuracy: ptp.ClockAccuracyNanosecond25})
 	require.Equal(t, expected, q)
 }
+
+func TestApplyLostPolicy(t *testing.T) {
+	now := time.Now()
+	locked := &ptp.ClockQuality{ClockClass: clock.ClockClassLock, ClockAccuracy: ptp.ClockAccuracyNanosecond100}
+	uncalibrated := &ptp.ClockQuality{ClockClass: clock.ClockClassUncalibrated, ClockAccuracy: ptp.ClockAccuracyUnknown}
+	holdover := &ptp.ClockQuality{ClockClass: clock.ClockClassHoldover, ClockAccuracy: ptp.ClockAccuracyMicrosecond1}
+	degraded := &ptp.ClockQuality{ClockClass: clock.ClockClassDegraded, ClockAccuracy: ptp.ClockAccuracyUnknown}
+
+	// Failover policy passes everything through
+	c := &Config{LostPolicy: PolicyFailover, HoldoverTimeout: time.Hour}
+	require.Equal(t, locked, applyLostPolicy(c, locked, now))
+	require.Nil(t, applyLostPolicy(c, nil, now))
+	require.Equal(t, uncalibrated, applyLostPolicy(c, uncalibrated, now))
+
+	// Never had the reference
+	c = &Config{LostPolicy: PolicyHoldover, HoldoverTimeout: time.Hour, HoldoverBaseLine: ptp.ClockAccuracyMicrosecond1}
+	require.Equal(t, degraded, applyLostPolicy(c, nil, now))
+
+	require.Equal(t, locked, applyLostPolicy(c, locked, now))
+	require.Equal(t, holdover, applyLostPolicy(c, nil, now.Add(time.Minute)))
+	require.Equal(t, holdover, applyLostPolicy(c, uncalibrated, now.Add(59*time.Minute)))
+	require.Equal(t, degraded, applyLostPolicy(c, nil, now.Add(time.Hour)))
+
+	// Reference is back
+	require.Equal(t, locked, applyLostPolicy(c, locked, now.Add(2*time.Hour)))
+	require.Equal(t, holdover, applyLostPolicy(c, nil, now.Add(2*time.Hour+time.Second)))
+}
+
+func TestApplyLostPolicyMapping(t *testing.T) {
+	now := time.Now()
+	locked := &ptp.ClockQuality{ClockClass: clock.ClockClassLock, ClockAccuracy: ptp.ClockAccuracyNanosecond100}
+	uncalibrated := &ptp.ClockQuality{ClockClass: clock.ClockClassUncalibrated, ClockAccuracy: ptp.ClockAccuracyUnknown}
+	c := &Config{
+		LostPolicy: PolicyHoldover,
+		Mapping: &clock.Mapping{
+			Holdover: []clock.HoldoverStep{
+				{After: time.Minute, Class: clock.ClockClassHoldover, Accuracy: ptp.ClockAccuracyMicrosecond1},
+				{After: 10 * time.Minute, Class: clock.ClockClassHoldover, Accuracy: ptp.ClockAccuracyMicrosecond10},
+				{After: time.Hour, Class: ptp.ClockClass58, Accuracy: ptp.ClockAccuracyUnknown},
+			},
+		},
+	}
+	// Never had the reference
+	require.Equal(t, &ptp.ClockQuality{ClockClass: ptp.ClockClass58, ClockAccuracy: ptp.ClockAccuracyUnknown}, applyLostPolicy(c, nil, now))
+
+	require.Equal(t, locked, applyLostPolicy(c, locked, now))
+	// before the first step the quality is passed through
+	require.Equal(t, uncalibrated, applyLostPolicy(c, uncalibrated, now.Add(time.Second)))
+	require.Equal(t, &ptp.ClockQuality{ClockClass: clock.ClockClassHoldover, ClockAccuracy: ptp.ClockAccuracyMicrosecond1}, applyLostPolicy(c, nil, now.Add(time.Minute)))
+	require.Equal(t, &ptp.ClockQuality{ClockClass: clock.ClockClassHoldover, ClockAccuracy: ptp.ClockAccuracyMicrosecond10}, applyLostPolicy(c, nil, now.Add(30*time.Minute)))
+	require.Equal(t, &ptp.ClockQuality{ClockClass: ptp.ClockClass58, ClockAccuracy: ptp.ClockAccuracyUnknown}, applyLostPolicy(c, nil, now.Add(2*time.Hour)))
+}
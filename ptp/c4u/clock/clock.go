@@ -33,11 +33,14 @@ const (
 	ClockClassCalibrating ptp.ClockClass = ptp.ClockClass13
 	// ClockClassUncalibrated is a class representing uncalibrated state
 	ClockClassUncalibrated ptp.ClockClass = ptp.ClockClass52
+	// ClockClassDegraded is a class representing holdover out of specification (degradation alternative B)
+	ClockClassDegraded ptp.ClockClass = ptp.ClockClass187
 )
 
 // DataPoint representing a sample of data used in clock class/accuracy calculations
 type DataPoint struct {
 	PHCOffset            time.Duration
+	PHCOffsetUncertainty time.Duration
 	OscillatorOffset     time.Duration
 	OscillatorClockClass ptp.ClockClass
 }
@@ -68,8 +71,9 @@ func (rb *RingBuffer) Data() []*DataPoint {
 	return rb.data
 }
 
-// Worst finding worst case clock quality from supplied data points
-func Worst(points []*DataPoint, accuracyExpr, classExpr string) (*ptp.ClockQuality, error) {
+// Worst finding worst case clock quality from supplied data points.
+// Accuracy is mapped from the offset by the mapping, nil uses RFC 8173 thresholds
+func Worst(points []*DataPoint, accuracyExpr, classExpr string, mapping *Mapping) (*ptp.ClockQuality, error) {
 	aexpr, err := prepareExpression(accuracyExpr)
 	if err != nil {
 		return nil, fmt.Errorf("evaluating accuracy math: %w", err)
@@ -81,6 +85,7 @@ func Worst(points []*DataPoint, accuracyExpr, classExpr string) (*ptp.ClockQuali
 	}
 
 	phcOffsets := []float64{}
+	phcOffsetUncertainties := []float64{}
 	oscillatorOffsets := []float64{}
 	oscillatorClasses := []float64{}
 
@@ -93,6 +98,7 @@ func Worst(points []*DataPoint, accuracyExpr, classExpr string) (*ptp.ClockQuali
 			w = &ptp.ClockQuality{}
 		}
 		phcOffsets = append(phcOffsets, float64(c.PHCOffset))
+		phcOffsetUncertainties = append(phcOffsetUncertainties, float64(c.PHCOffsetUncertainty))
 
 		oscillatorOffsets = append(oscillatorOffsets, float64(c.OscillatorOffset))
 		oscillatorClasses = append(oscillatorClasses, float64(c.OscillatorClockClass))
@@ -102,18 +108,20 @@ func Worst(points []*DataPoint, accuracyExpr, classExpr string) (*ptp.ClockQuali
 	}
 
 	log.Debugf("phcOffsets = %v", phcOffsets)
+	log.Debugf("phcOffsetUncertainties = %v", phcOffsetUncertainties)
 	log.Debugf("oscillatorOffsets = %v", oscillatorOffsets)
 
 	offsets := map[string]interface{}{
-		"phcoffset":        phcOffsets,
-		"oscillatoroffset": oscillatorOffsets,
+		"phcoffset":            phcOffsets,
+		"phcoffsetuncertainty": phcOffsetUncertainties,
+		"oscillatoroffset":     oscillatorOffsets,
 	}
 	oRaw, err := aexpr.Evaluate(offsets)
 	if err != nil {
 		return nil, err
 	}
 	o := time.Duration(oRaw.(float64))
-	accFromOffset := ptp.ClockAccuracyFromOffset(o)
+	accFromOffset := mapping.ClockAccuracy(o)
 	log.Debugf("result of %q = %v", accuracyExpr, o)
 	log.Debugf("clockAccuracy: %v\n", accFromOffset)
 
@@ -140,13 +148,14 @@ func Run() (*DataPoint, error) {
 		return nil, err
 	}
 
-	phcOffset, err := ts2phc()
+	phcOffset, phcOffsetUncertainty, err := ts2phc()
 	if err != nil {
 		return nil, err
 	}
 
 	d := &DataPoint{
 		PHCOffset:            phcOffset,
+		PHCOffsetUncertainty: phcOffsetUncertainty,
 		OscillatorOffset:     oscillatord.Offset,
 		OscillatorClockClass: oscillatord.ClockClass,
 	}
@@ -47,7 +47,7 @@ func TestWorst(t *testing.T) {
 		},
 	}
 
-	w, err := Worst(clocks, aexpr, cexpr)
+	w, err := Worst(clocks, aexpr, cexpr, nil)
 	require.NoError(t, err)
 	require.Equal(t, expected, w)
 
@@ -66,13 +66,13 @@ func TestWorst(t *testing.T) {
 		nil,
 	}
 
-	w, err = Worst(clocks, aexpr, cexpr)
+	w, err = Worst(clocks, aexpr, cexpr, nil)
 	require.NoError(t, err)
 	require.Equal(t, expected, w)
 
 	clocks = []*DataPoint{nil, nil}
 
-	w, err = Worst(clocks, aexpr, cexpr)
+	w, err = Worst(clocks, aexpr, cexpr, nil)
 	require.NoError(t, err)
 	require.Nil(t, w)
 }
@@ -91,14 +91,33 @@ func TestWorstBig(t *testing.T) {
 		clocks = append(clocks, &DataPoint{OscillatorClockClass: ptp.ClockClass7, PHCOffset: 250 * time.Nanosecond})
 	}
 
-	w, err := Worst(clocks, aexpr, cexpr)
+	w, err := Worst(clocks, aexpr, cexpr, nil)
 	require.NoError(t, err)
 	require.Equal(t, expected, w)
 
 	// Changing 1 element to sway over the border
 	clocks[592] = &DataPoint{OscillatorClockClass: ptp.ClockClass7, PHCOffset: 250 * time.Nanosecond}
 	expected = &ptp.ClockQuality{ClockClass: ptp.ClockClass7, ClockAccuracy: ptp.ClockAccuracyNanosecond100}
-	w, err = Worst(clocks, aexpr, cexpr)
+	w, err = Worst(clocks, aexpr, cexpr, nil)
+	require.NoError(t, err)
+	require.Equal(t, expected, w)
+}
+
+func TestWorstPHCOffsetUncertainty(t *testing.T) {
+	aexpr := "abs(mean(phcoffset)) + mean(phcoffsetuncertainty)"
+	cexpr := "p99(oscillatorclass)"
+	// 200ns of offset alone is within 250ns, uncertainty pushes it over
+	expected := &ptp.ClockQuality{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyMicrosecond1}
+
+	clocks := []*DataPoint{
+		{
+			PHCOffset:            200 * time.Nanosecond,
+			PHCOffsetUncertainty: 100 * time.Nanosecond,
+			OscillatorClockClass: ClockClassLock,
+		},
+	}
+
+	w, err := Worst(clocks, aexpr, cexpr, nil)
 	require.NoError(t, err)
 	require.Equal(t, expected, w)
 }
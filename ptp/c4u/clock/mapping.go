@@ -0,0 +1,117 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// AccuracyStep advertises Accuracy for the offsets up to Offset
+type AccuracyStep struct {
+	Offset   time.Duration     `yaml:"offset"`
+	Accuracy ptp.ClockAccuracy `yaml:"accuracy"`
+}
+
+// HoldoverStep advertises Class and Accuracy once the reference is lost for at least After
+type HoldoverStep struct {
+	After    time.Duration     `yaml:"after"`
+	Class    ptp.ClockClass    `yaml:"class"`
+	Accuracy ptp.ClockAccuracy `yaml:"accuracy"`
+}
+
+// Mapping is the table from the measured offset and holdover state to the advertised clock quality
+type Mapping struct {
+	// Accuracy steps sorted by offset. Offsets over the last step have unknown accuracy.
+	// RFC 8173 accuracy thresholds are used if empty
+	Accuracy []AccuracyStep `yaml:"accuracy"`
+	// Holdover steps sorted by the time since the reference was lost
+	Holdover []HoldoverStep `yaml:"holdover"`
+}
+
+// ReadMapping reads the mapping from the YAML file
+func ReadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mapping{}
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate checks the steps are sorted
+func (m *Mapping) Validate() error {
+	for i := 1; i < len(m.Accuracy); i++ {
+		if m.Accuracy[i].Offset <= m.Accuracy[i-1].Offset {
+			return fmt.Errorf("accuracy step %d: offset %v is not greater than %v", i, m.Accuracy[i].Offset, m.Accuracy[i-1].Offset)
+		}
+	}
+	for i := 1; i < len(m.Holdover); i++ {
+		if m.Holdover[i].After <= m.Holdover[i-1].After {
+			return fmt.Errorf("holdover step %d: %v is not after %v", i, m.Holdover[i].After, m.Holdover[i-1].After)
+		}
+	}
+	return nil
+}
+
+// ClockAccuracy returns the accuracy advertised for the offset. Nil mapping uses RFC 8173 thresholds
+func (m *Mapping) ClockAccuracy(offset time.Duration) ptp.ClockAccuracy {
+	if m == nil || len(m.Accuracy) == 0 {
+		return ptp.ClockAccuracyFromOffset(offset)
+	}
+	if offset < 0 {
+		offset *= -1
+	}
+	for _, s := range m.Accuracy {
+		if offset <= s.Offset {
+			return s.Accuracy
+		}
+	}
+	return ptp.ClockAccuracyUnknown
+}
+
+// HoldoverQuality returns the quality advertised when the reference is lost for the duration.
+// It's the last step if the reference was never seen
+func (m *Mapping) HoldoverQuality(lost time.Duration, seen bool) (*ptp.ClockQuality, bool) {
+	if m == nil || len(m.Holdover) == 0 {
+		return nil, false
+	}
+	step := &m.Holdover[len(m.Holdover)-1]
+	if seen {
+		step = nil
+		for i := range m.Holdover {
+			if lost < m.Holdover[i].After {
+				break
+			}
+			step = &m.Holdover[i]
+		}
+	}
+	if step == nil {
+		return nil, false
+	}
+	return &ptp.ClockQuality{ClockClass: step.Class, ClockAccuracy: step.Accuracy}, true
+}
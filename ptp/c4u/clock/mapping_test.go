@@ -0,0 +1,127 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clock
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappingClockAccuracy(t *testing.T) {
+	var m *Mapping
+	require.Equal(t, ptp.ClockAccuracyNanosecond250, m.ClockAccuracy(-200*time.Nanosecond))
+
+	m = &Mapping{}
+	require.Equal(t, ptp.ClockAccuracyMicrosecond1, m.ClockAccuracy(time.Microsecond))
+
+	m = &Mapping{
+		Accuracy: []AccuracyStep{
+			{Offset: 100 * time.Nanosecond, Accuracy: ptp.ClockAccuracyNanosecond250},
+			{Offset: time.Microsecond, Accuracy: ptp.ClockAccuracyMicrosecond2point5},
+		},
+	}
+	require.Equal(t, ptp.ClockAccuracyNanosecond250, m.ClockAccuracy(0))
+	require.Equal(t, ptp.ClockAccuracyNanosecond250, m.ClockAccuracy(-100*time.Nanosecond))
+	require.Equal(t, ptp.ClockAccuracyMicrosecond2point5, m.ClockAccuracy(101*time.Nanosecond))
+	require.Equal(t, ptp.ClockAccuracyUnknown, m.ClockAccuracy(time.Millisecond))
+}
+
+func TestMappingHoldoverQuality(t *testing.T) {
+	var m *Mapping
+	_, ok := m.HoldoverQuality(time.Minute, true)
+	require.False(t, ok)
+
+	m = &Mapping{
+		Holdover: []HoldoverStep{
+			{After: 0, Class: ClockClassHoldover, Accuracy: ptp.ClockAccuracyMicrosecond1},
+			{After: time.Hour, Class: ClockClassDegraded, Accuracy: ptp.ClockAccuracyUnknown},
+		},
+	}
+	q, ok := m.HoldoverQuality(time.Minute, true)
+	require.True(t, ok)
+	require.Equal(t, &ptp.ClockQuality{ClockClass: ClockClassHoldover, ClockAccuracy: ptp.ClockAccuracyMicrosecond1}, q)
+
+	q, ok = m.HoldoverQuality(time.Hour, true)
+	require.True(t, ok)
+	require.Equal(t, &ptp.ClockQuality{ClockClass: ClockClassDegraded, ClockAccuracy: ptp.ClockAccuracyUnknown}, q)
+
+	// never seen the reference
+	q, ok = m.HoldoverQuality(0, false)
+	require.True(t, ok)
+	require.Equal(t, ClockClassDegraded, q.ClockClass)
+}
+
+func TestReadMapping(t *testing.T) {
+	f, err := os.CreateTemp("", "c4u-mapping")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`accuracy:
+  - offset: 100ns
+    accuracy: 0x22
+  - offset: 1us
+    accuracy: 0x23
+holdover:
+  - after: 0s
+    class: 7
+    accuracy: 0x23
+  - after: 4h
+    class: 187
+    accuracy: 0xFE
+`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	m, err := ReadMapping(f.Name())
+	require.NoError(t, err)
+	expected := &Mapping{
+		Accuracy: []AccuracyStep{
+			{Offset: 100 * time.Nanosecond, Accuracy: ptp.ClockAccuracyNanosecond250},
+			{Offset: time.Microsecond, Accuracy: ptp.ClockAccuracyMicrosecond1},
+		},
+		Holdover: []HoldoverStep{
+			{After: 0, Class: ClockClassHoldover, Accuracy: ptp.ClockAccuracyMicrosecond1},
+			{After: 4 * time.Hour, Class: ClockClassDegraded, Accuracy: ptp.ClockAccuracyUnknown},
+		},
+	}
+	require.Equal(t, expected, m)
+
+	_, err = ReadMapping("/does/not/exist")
+	require.Error(t, err)
+}
+
+func TestMappingValidate(t *testing.T) {
+	m := &Mapping{
+		Accuracy: []AccuracyStep{
+			{Offset: time.Microsecond, Accuracy: ptp.ClockAccuracyMicrosecond1},
+			{Offset: 100 * time.Nanosecond, Accuracy: ptp.ClockAccuracyNanosecond100},
+		},
+	}
+	require.EqualError(t, m.Validate(), "accuracy step 1: offset 100ns is not greater than 1µs")
+
+	m = &Mapping{
+		Holdover: []HoldoverStep{
+			{After: time.Hour, Class: ClockClassHoldover},
+			{After: time.Hour, Class: ClockClassDegraded},
+		},
+	}
+	require.EqualError(t, m.Validate(), "holdover step 1: 1h0m0s is not after 1h0m0s")
+	require.NoError(t, (&Mapping{}).Validate())
+}
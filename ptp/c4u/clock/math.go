@@ -58,6 +58,7 @@ func p99(input []float64) float64 {
 // once oscillatord supports reporting offset we can add it here
 var supportedVariables = []string{
 	"phcoffset",
+	"phcoffsetuncertainty",
 	"oscillatoroffset",
 	"oscillatorclass",
 }
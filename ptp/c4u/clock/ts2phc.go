@@ -26,6 +26,6 @@ const (
 	phcNICPath      = "/dev/ptp0"
 )
 
-func ts2phc() (time.Duration, error) {
-	return phc.OffsetBetweenDevices(phcTimeCardPath, phcNICPath)
+func ts2phc() (time.Duration, time.Duration, error) {
+	return phc.OffsetAndUncertaintyBetweenDevices(phcTimeCardPath, phcNICPath)
 }
@@ -63,6 +63,11 @@ func (s *JSONStats) Snapshot() {
 	s.report.dataError = s.dataError
 }
 
+// ServeHTTP serves the stats, so they can be served on the monitoring port of another daemon
+func (s *JSONStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handleRequest(w, r)
+}
+
 // handleRequest is a handler used for all http monitoring requests
 func (s *JSONStats) handleRequest(w http.ResponseWriter, r *http.Request) {
 	js, err := json.Marshal(s.report.toMap())
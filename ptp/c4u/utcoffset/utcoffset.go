@@ -24,16 +24,5 @@ import (
 
 // Run the utcoffset calculation
 func Run() (time.Duration, error) {
-	// TAI <-> UTC offset was 10 seconds before introduction of leap seconds.
-	// https://en.wikipedia.org/wiki/Leap_second
-	var uo int32 = 10
-
-	latestLeap, err := leapsectz.Latest("")
-	if err != nil {
-		return time.Duration(0), err
-	}
-
-	uo += latestLeap.Nleap
-
-	return time.Duration(uo) * time.Second, nil
+	return leapsectz.UTCOffset("")
 }
@@ -0,0 +1,138 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package linuxptp reads ptp4l and phc2sys configuration files and converts them
+into ptp4u and sptp configuration, reporting the options which have no equivalent.
+*/
+package linuxptp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Section names with a special meaning. Other sections are interfaces
+const (
+	SectionGlobal             = "global"
+	SectionUnicastMasterTable = "unicast_master_table"
+)
+
+// Option is a single key value line of the config
+type Option struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// Section is a bracketed section of the config with its options in file order
+type Section struct {
+	Name    string
+	Options []Option
+}
+
+// Config is a parsed linuxptp config file
+type Config struct {
+	Sections []*Section
+}
+
+// Parse parses the linuxptp config. Options before the first section belong to the global section
+func Parse(r io.Reader) (*Config, error) {
+	c := &Config{}
+	var current *Section
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := scanner.Text()
+		if i := strings.IndexByte(s, '#'); i >= 0 {
+			s = s[:i]
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if strings.HasPrefix(s, "[") {
+			if !strings.HasSuffix(s, "]") {
+				return nil, fmt.Errorf("line %d: malformed section %q", line, s)
+			}
+			name := strings.TrimSpace(s[1 : len(s)-1])
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty section name", line)
+			}
+			current = &Section{Name: name}
+			c.Sections = append(c.Sections, current)
+			continue
+		}
+		if current == nil {
+			current = &Section{Name: SectionGlobal}
+			c.Sections = append(c.Sections, current)
+		}
+		fields := strings.Fields(s)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: option %q has no value", line, fields[0])
+		}
+		current.Options = append(current.Options, Option{Key: fields[0], Value: strings.Join(fields[1:], " "), Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Read reads the linuxptp config from the file
+func Read(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Get returns the last value of the option in the global section
+func (c *Config) Get(key string) (string, bool) {
+	value, found := "", false
+	for _, s := range c.Sections {
+		if s.Name != SectionGlobal {
+			continue
+		}
+		for _, o := range s.Options {
+			if o.Key == key {
+				value, found = o.Value, true
+			}
+		}
+	}
+	return value, found
+}
+
+// Interfaces returns the interface sections in file order
+func (c *Config) Interfaces() []*Section {
+	res := []*Section{}
+	for _, s := range c.Sections {
+		if s.Name != SectionGlobal && s.Name != SectionUnicastMasterTable {
+			res = append(res, s)
+		}
+	}
+	return res
+}
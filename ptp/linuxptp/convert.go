@@ -0,0 +1,432 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linuxptp
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/server"
+	"github.com/facebook/time/ptp/sptp/client"
+	"github.com/facebook/time/timestamp"
+)
+
+// Roles of the converted ptp4l instance
+const (
+	RoleServer = "server"
+	RoleClient = "client"
+)
+
+// Statuses of the options in the report
+const (
+	StatusConverted   = "converted"
+	StatusIgnored     = "ignored"
+	StatusUnsupported = "unsupported"
+)
+
+// Files the options come from
+const (
+	FilePTP4L   = "ptp4l"
+	FilePHC2Sys = "phc2sys"
+)
+
+// sptp defaults the client config starts from
+const (
+	defaultClientMonitoringPort = 4269
+	defaultClientInterval       = time.Second
+	defaultClientAggregation    = time.Minute
+)
+
+// ignored are options which only affect ptp4l itself, such as logging
+var ignored = map[string]string{
+	"verbose":                "ptp4u and sptp log to stderr, see -loglevel",
+	"use_syslog":             "ptp4u and sptp log to stderr, see -loglevel",
+	"logging_level":          "see -loglevel",
+	"message_tag":            "no equivalent needed",
+	"summary_interval":       "stats are exported by the monitoring backends",
+	"uds_address":            "ptp4u serves management on -mgmtsocket",
+	"uds_ro_address":         "ptp4u serves management on -mgmtsocket",
+	"tx_timestamp_timeout":   "TX timestamps are polled until they arrive",
+	"logAnnounceInterval":    "unicast clients request the interval",
+	"logSyncInterval":        "unicast clients request the interval",
+	"logQueryInterval":       "sptp doesn't negotiate unicast transmission",
+	"unicast_req_duration":   "sptp doesn't negotiate unicast transmission",
+	"announceReceiptTimeout": "sptp expects an Announce with every Sync",
+	"peer_address":           "only used with P2P delay mechanism",
+}
+
+// Finding is a line of the report about a single option
+type Finding struct {
+	File    string `json:"file"`
+	Section string `json:"section"`
+	Option  string `json:"option"`
+	Value   string `json:"value"`
+	Status  string `json:"status"`
+	Note    string `json:"note"`
+}
+
+// Result is the converted configuration with the report on every option
+type Result struct {
+	Role string
+	// ServerFlags are the ptp4u command line flags, for the server role
+	ServerFlags map[string]string
+	// Dynamic is the ptp4u dynamic config, for the server role
+	Dynamic *server.DynamicConfig
+	// Client is the sptp config, for the client role
+	Client *client.Config
+	Report []Finding
+}
+
+// Unsupported returns the number of options which were not converted
+func (r *Result) Unsupported() int {
+	n := 0
+	for _, f := range r.Report {
+		if f.Status == StatusUnsupported {
+			n++
+		}
+	}
+	return n
+}
+
+// Flags returns the ptp4u command line flags sorted by name
+func (r *Result) Flags() []string {
+	names := make([]string, 0, len(r.ServerFlags))
+	for name := range r.ServerFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		res = append(res, fmt.Sprintf("-%s=%s", name, r.ServerFlags[name]))
+	}
+	return res
+}
+
+// converter converts the options of one file
+type converter struct {
+	res     *Result
+	file    string
+	ptp4l   *Config
+	servers []string
+}
+
+func (c *converter) report(section string, o Option, status, note string) {
+	c.res.Report = append(c.res.Report, Finding{File: c.file, Section: section, Option: o.Key, Value: o.Value, Status: status, Note: note})
+}
+
+func (c *converter) server() bool {
+	return c.res.Role == RoleServer
+}
+
+// role derives the role of ptp4l from its config
+func role(c *Config) (string, error) {
+	isServer, isClient := false, false
+	for _, s := range c.Sections {
+		for _, o := range s.Options {
+			switch o.Key {
+			case "serverOnly", "masterOnly", "unicast_listen":
+				isServer = isServer || o.Value == "1"
+			case "clientOnly", "slaveOnly", "unicast_master_table":
+				isClient = isClient || o.Value != "0"
+			}
+		}
+	}
+	switch {
+	case isServer && isClient:
+		return "", fmt.Errorf("config is both a server and a client")
+	case isServer:
+		return RoleServer, nil
+	case isClient:
+		return RoleClient, nil
+	}
+	return "", fmt.Errorf("can't tell the role: set serverOnly or clientOnly, ptp4u and sptp don't run the BMCA between them")
+}
+
+// logInterval converts log2 seconds to duration
+func logInterval(value string) (time.Duration, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(math.Pow(2, float64(n)) * float64(time.Second)), nil
+}
+
+// seconds converts fractional seconds to duration
+func seconds(value string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// option converts a single option and returns its status and a note
+func (c *converter) option(o Option) (string, string, error) {
+	if note, ok := ignored[o.Key]; ok {
+		return StatusIgnored, note, nil
+	}
+	switch o.Key {
+	case "serverOnly", "masterOnly", "clientOnly", "slaveOnly", "unicast_listen":
+		return StatusConverted, "role " + c.res.Role, nil
+	case "network_transport":
+		if o.Value == "L2" {
+			return StatusUnsupported, "only UDP transport is supported", nil
+		}
+		return StatusConverted, "IPv4 and IPv6 are both served", nil
+	case "delay_mechanism":
+		if o.Value != "E2E" {
+			return StatusUnsupported, "only E2E delay mechanism is supported", nil
+		}
+		return StatusConverted, "", nil
+	case "table_id":
+		return StatusConverted, "all tables are merged into the servers of the sptp config", nil
+	case "time_stamping":
+		switch o.Value {
+		case "hardware", "software":
+		case "onestep":
+			return StatusUnsupported, "ptp4u and sptp send and expect two-step Sync", nil
+		default:
+			return StatusUnsupported, "only hardware and software timestamping are supported", nil
+		}
+		ts := timestamp.HWTIMESTAMP
+		if o.Value == "software" {
+			ts = timestamp.SWTIMESTAMP
+		}
+		if c.server() {
+			c.res.ServerFlags["timestamptype"] = ts
+		} else {
+			c.res.Client.Timestamping = ts
+		}
+		return StatusConverted, "", nil
+	case "domainNumber":
+		if c.server() {
+			c.res.ServerFlags["domainnumber"] = o.Value
+			return StatusConverted, "", nil
+		}
+		if o.Value != "0" {
+			return StatusUnsupported, "sptp works in the default domain only", nil
+		}
+		return StatusConverted, "", nil
+	case "dscp_event", "dscp_general":
+		dscp, err := strconv.Atoi(o.Value)
+		if err != nil {
+			return "", "", err
+		}
+		if c.server() {
+			if prev, ok := c.res.ServerFlags["dscp"]; ok && prev != o.Value {
+				return StatusUnsupported, "single DSCP is used for all messages, keeping " + prev, nil
+			}
+			c.res.ServerFlags["dscp"] = o.Value
+		} else {
+			if c.res.Client.DSCP != 0 && c.res.Client.DSCP != dscp {
+				return StatusUnsupported, fmt.Sprintf("single DSCP is used for all messages, keeping %d", c.res.Client.DSCP), nil
+			}
+			c.res.Client.DSCP = dscp
+		}
+		return StatusConverted, "", nil
+	case "clockClass":
+		v, err := strconv.ParseUint(o.Value, 0, 8)
+		if err != nil {
+			return "", "", err
+		}
+		if !c.server() {
+			return StatusIgnored, "only used by servers", nil
+		}
+		c.res.Dynamic.ClockClass = ptp.ClockClass(v)
+		return StatusConverted, "clockclass in the dynamic config, usually managed by c4u", nil
+	case "clockAccuracy":
+		v, err := strconv.ParseUint(o.Value, 0, 8)
+		if err != nil {
+			return "", "", err
+		}
+		if !c.server() {
+			return StatusIgnored, "only used by servers", nil
+		}
+		c.res.Dynamic.ClockAccuracy = ptp.ClockAccuracy(v)
+		return StatusConverted, "clockaccuracy in the dynamic config, usually managed by c4u", nil
+	case "utc_offset":
+		v, err := strconv.Atoi(o.Value)
+		if err != nil {
+			return "", "", err
+		}
+		if !c.server() {
+			return StatusIgnored, "only used by servers", nil
+		}
+		c.res.Dynamic.UTCOffset = time.Duration(v) * time.Second
+		return StatusConverted, "utcoffset in the dynamic config", nil
+	case "priority1", "priority2":
+		v, err := strconv.ParseUint(o.Value, 0, 8)
+		if err != nil {
+			return "", "", err
+		}
+		if !c.server() {
+			return StatusIgnored, "only used by servers", nil
+		}
+		if o.Key == "priority1" && v == 255 {
+			return StatusUnsupported, "priority1 255 is reserved for slave-only clocks", nil
+		}
+		c.res.ServerFlags[o.Key] = o.Value
+		return StatusConverted, "", nil
+	case "logMinDelayReqInterval":
+		d, err := logInterval(o.Value)
+		if err != nil {
+			return "", "", err
+		}
+		if c.server() {
+			return StatusIgnored, "unicast clients request the interval", nil
+		}
+		c.res.Client.Interval = d
+		return StatusConverted, "interval of the sptp config", nil
+	case "first_step_threshold":
+		d, err := seconds(o.Value)
+		if err != nil {
+			return "", "", err
+		}
+		if c.server() {
+			return StatusIgnored, "only used by clients", nil
+		}
+		c.res.Client.FirstStepThreshold = d
+		return StatusConverted, "firststepthreshold of the sptp config", nil
+	case "UDPv4", "UDPv6":
+		if net.ParseIP(o.Value) == nil {
+			return StatusUnsupported, "not an IP address", nil
+		}
+		c.servers = append(c.servers, o.Value)
+		return StatusConverted, "servers of the sptp config", nil
+	case "L2":
+		return StatusUnsupported, "only UDP transport is supported", nil
+	}
+	if strings.HasPrefix(o.Key, "pi_") || strings.HasPrefix(o.Key, "linreg_") || o.Key == "clock_servo" || o.Key == "step_threshold" {
+		return StatusUnsupported, "sptp uses its own servo", nil
+	}
+	return StatusUnsupported, "no equivalent", nil
+}
+
+// section converts the options of the section
+func (c *converter) section(s *Section) error {
+	for _, o := range s.Options {
+		if o.Key == "unicast_master_table" {
+			c.report(s.Name, o, StatusConverted, "servers of the sptp config")
+			continue
+		}
+		status, note, err := c.option(o)
+		if err != nil {
+			return fmt.Errorf("%s line %d: invalid %s %q: %w", c.file, o.Line, o.Key, o.Value, err)
+		}
+		c.report(s.Name, o, status, note)
+	}
+	return nil
+}
+
+// interfaces converts the interface sections
+func (c *converter) interfaces() error {
+	for i, s := range c.ptp4l.Interfaces() {
+		o := Option{Key: "interface", Value: s.Name}
+		switch {
+		case i > 0:
+			c.report(s.Name, o, StatusUnsupported, "a single interface is converted, see -listen of ptp4u for more")
+		case c.server():
+			c.res.ServerFlags["iface"] = s.Name
+			c.report(s.Name, o, StatusConverted, "")
+		default:
+			c.res.Client.Iface = s.Name
+			c.report(s.Name, o, StatusConverted, "")
+		}
+		if err := c.section(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Convert converts the ptp4l config, and the phc2sys config if not nil
+func Convert(ptp4l, phc2sys *Config) (*Result, error) {
+	r, err := role(ptp4l)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Role: r}
+	if r == RoleServer {
+		dc := server.DefaultDynamicConfig()
+		res.Dynamic = &dc
+		res.ServerFlags = map[string]string{"timestamptype": timestamp.HWTIMESTAMP}
+	} else {
+		res.Client = &client.Config{
+			Timestamping:             timestamp.HWTIMESTAMP,
+			MonitoringPort:           defaultClientMonitoringPort,
+			Interval:                 defaultClientInterval,
+			MetricsAggregationWindow: defaultClientAggregation,
+			Servers:                  map[string]int{},
+		}
+	}
+
+	c := &converter{res: res, file: FilePTP4L, ptp4l: ptp4l}
+	for _, s := range ptp4l.Sections {
+		if s.Name != SectionGlobal && s.Name != SectionUnicastMasterTable {
+			continue
+		}
+		if err := c.section(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.interfaces(); err != nil {
+		return nil, err
+	}
+	if !c.server() {
+		if len(c.servers) == 0 {
+			return nil, fmt.Errorf("client has no servers in the unicast_master_table")
+		}
+		for i, s := range c.servers {
+			res.Client.Servers[s] = i
+		}
+	} else if len(c.servers) > 0 {
+		return nil, fmt.Errorf("server has a unicast_master_table")
+	}
+
+	if phc2sys != nil {
+		c.file = FilePHC2Sys
+		for _, s := range phc2sys.Sections {
+			for _, o := range s.Options {
+				c.phc2sys(s.Name, o)
+			}
+		}
+	}
+	return res, nil
+}
+
+// phc2sys reports the phc2sys option. The PHC is steered by sptp and the system clock is
+// read through fbclock, so only the step threshold carries over
+func (c *converter) phc2sys(section string, o Option) {
+	if o.Key == "first_step_threshold" && !c.server() {
+		if d, err := seconds(o.Value); err == nil {
+			c.res.Client.FirstStepThreshold = d
+			c.report(section, o, StatusConverted, "firststepthreshold of the sptp config")
+			return
+		}
+	}
+	if note, ok := ignored[o.Key]; ok {
+		c.report(section, o, StatusIgnored, note)
+		return
+	}
+	c.report(section, o, StatusUnsupported, "system clock is not synchronized from the PHC, use fbclock to read PHC time")
+}
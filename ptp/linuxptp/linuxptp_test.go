@@ -0,0 +1,148 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linuxptp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+const serverConfig = `
+# GM
+[global]
+serverOnly              1
+unicast_listen          1
+domainNumber            24
+clockClass              7
+clockAccuracy           0x22
+utc_offset              37
+dscp_event              46
+dscp_general            46
+time_stamping           hardware
+priority1               127
+summary_interval        0
+
+[eth0]
+network_transport       UDPv6
+`
+
+const clientConfig = `
+[global]
+clientOnly              1
+logMinDelayReqInterval  -1
+first_step_threshold    0.00002
+pi_proportional_const   0.7
+dscp_event              35
+
+[unicast_master_table]
+table_id                1
+logQueryInterval        2
+UDPv6                   2001:db8::1
+UDPv6                   2001:db8::2
+
+[eth1]
+unicast_master_table    1
+delay_mechanism         P2P
+`
+
+func findings(r *Result, status string) []string {
+	res := []string{}
+	for _, f := range r.Report {
+		if f.Status == status {
+			res = append(res, f.Option)
+		}
+	}
+	return res
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(clientConfig))
+	require.NoError(t, err)
+	require.Len(t, c.Sections, 3)
+	v, ok := c.Get("first_step_threshold")
+	require.True(t, ok)
+	require.Equal(t, "0.00002", v)
+	_, ok = c.Get("table_id")
+	require.False(t, ok)
+	require.Len(t, c.Interfaces(), 1)
+	require.Equal(t, "eth1", c.Interfaces()[0].Name)
+	require.Equal(t, Option{Key: "UDPv6", Value: "2001:db8::1", Line: 12}, c.Sections[1].Options[2])
+
+	for _, bad := range []string{"[global", "[ ]", "verbose"} {
+		_, err = Parse(strings.NewReader(bad))
+		require.Error(t, err, bad)
+	}
+}
+
+func TestConvertServer(t *testing.T) {
+	c, err := Parse(strings.NewReader(serverConfig))
+	require.NoError(t, err)
+	r, err := Convert(c, nil)
+	require.NoError(t, err)
+	require.Equal(t, RoleServer, r.Role)
+	require.Equal(t, []string{"-domainnumber=24", "-dscp=46", "-iface=eth0", "-priority1=127", "-timestamptype=hardware"}, r.Flags())
+	require.Equal(t, ptp.ClockClass(7), r.Dynamic.ClockClass)
+	require.Equal(t, ptp.ClockAccuracy(0x22), r.Dynamic.ClockAccuracy)
+	require.Equal(t, 37*time.Second, r.Dynamic.UTCOffset)
+	require.Empty(t, findings(r, StatusUnsupported))
+	require.Equal(t, []string{"summary_interval"}, findings(r, StatusIgnored))
+	require.Equal(t, 0, r.Unsupported())
+}
+
+func TestConvertOneStep(t *testing.T) {
+	c, err := Parse(strings.NewReader(strings.Replace(serverConfig, "time_stamping           hardware", "time_stamping           onestep", 1)))
+	require.NoError(t, err)
+	r, err := Convert(c, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"time_stamping"}, findings(r, StatusUnsupported))
+}
+
+func TestConvertClient(t *testing.T) {
+	c, err := Parse(strings.NewReader(clientConfig))
+	require.NoError(t, err)
+	phc2sys, err := Parse(strings.NewReader("[global]\nfirst_step_threshold 0.001\nstep_threshold 1\n"))
+	require.NoError(t, err)
+	r, err := Convert(c, phc2sys)
+	require.NoError(t, err)
+	require.Equal(t, RoleClient, r.Role)
+	require.Equal(t, "eth1", r.Client.Iface)
+	require.Equal(t, map[string]int{"2001:db8::1": 0, "2001:db8::2": 1}, r.Client.Servers)
+	require.Equal(t, 500*time.Millisecond, r.Client.Interval)
+	require.Equal(t, 35, r.Client.DSCP)
+	require.Equal(t, time.Millisecond, r.Client.FirstStepThreshold)
+	require.Equal(t, []string{"pi_proportional_const", "delay_mechanism", "step_threshold"}, findings(r, StatusUnsupported))
+	require.Equal(t, FilePHC2Sys, r.Report[len(r.Report)-1].File)
+}
+
+func TestConvertErrors(t *testing.T) {
+	for _, config := range []string{
+		"[global]\nserverOnly 1\nclientOnly 1\n",
+		"[global]\nverbose 1\n",
+		"[global]\nclientOnly 1\n",
+		"[global]\nserverOnly 1\nclockClass x\n",
+		"[global]\nserverOnly 1\n[unicast_master_table]\nUDPv4 192.0.2.1\n",
+	} {
+		c, err := Parse(strings.NewReader(config))
+		require.NoError(t, err)
+		_, err = Convert(c, nil)
+		require.Error(t, err, config)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package measure performs a single SPTP measurement exchange with a PTP server.
+
+It's meant to be embedded into applications which want to timestamp events against
+the grandmaster directly, without running a full client or disciplining any clock.
+It depends only on the standard library and the PTP protocol and timestamping packages of this repository.
+*/
+package measure
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultTimeout is used when no deadline is set on the context
+const DefaultTimeout = time.Second
+
+// ErrTimeout is returned when the server didn't respond in time
+var ErrTimeout = errors.New("timed out waiting for the server response")
+
+// Config specifies how to measure
+type Config struct {
+	// Server to measure against
+	Server string
+	// Iface to use hardware timestamps of. Software timestamps are used if empty
+	Iface string
+	// ClockIdentity to identify ourselves with. Doesn't need to be unique between measurements
+	ClockIdentity ptp.ClockIdentity
+}
+
+// Result is a single measurement
+type Result struct {
+	// T1 is when Sync left the server
+	T1 time.Time
+	// T2 is when Sync arrived to us
+	T2 time.Time
+	// T3 is when DelayReq left us
+	T3 time.Time
+	// T4 is when DelayReq arrived to the server
+	T4 time.Time
+	// CorrectionFieldRX is the correction of Sync
+	CorrectionFieldRX time.Duration
+	// CorrectionFieldTX is the correction of DelayReq reported back by the server
+	CorrectionFieldTX time.Duration
+	// Delay is the mean path delay
+	Delay time.Duration
+	// Offset of our clock from the server clock
+	Offset time.Duration
+	// UTCOffset is the TAI-UTC offset announced by the server
+	UTCOffset time.Duration
+	// Clocks are system clock readings taken when Sync arrived to us
+	Clocks timestamp.ClockReadings
+}
+
+// ServerTime translates local time of the same timescale as T2/T3 into the server time
+func (r *Result) ServerTime(local time.Time) time.Time {
+	return local.Add(-r.Offset)
+}
+
+// newResult calculates offset and delay from raw timestamps
+func newResult(t1, t2, t3, t4 time.Time, c1, c2 time.Duration) *Result {
+	// offset = ((t2 − t1 − c1) − (t4 − t3 − c2))/2
+	// delay = ((t2 − t1 − c1) + (t4 − t3 − c2))/2
+	clientToServerDiff := t4.Sub(t3) - c2
+	serverToClientDiff := t2.Sub(t1) - c1
+	delay := (clientToServerDiff + serverToClientDiff) / 2
+	return &Result{
+		T1:                t1,
+		T2:                t2,
+		T3:                t3,
+		T4:                t4,
+		CorrectionFieldRX: c1,
+		CorrectionFieldTX: c2,
+		Delay:             delay,
+		Offset:            serverToClientDiff - delay,
+	}
+}
+
+// corrToDuration converts PTP CorrectionField to time.Duration, ignoring
+// case where correction is too big, and dropping fractions of nanoseconds
+func corrToDuration(correction ptp.Correction) (corr time.Duration) {
+	if !correction.TooBig() {
+		corr = time.Duration(correction.Nanoseconds())
+	}
+	return
+}
+
+// delayReq builds SPTP DelayReq
+func delayReq(clockID ptp.ClockIdentity, seq uint16) *ptp.SyncDelayReq {
+	return &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			Version:         ptp.Version,
+			SequenceID:      seq,
+			MessageLength:   uint16(binary.Size(ptp.SyncDelayReq{})),
+			FlagField:       ptp.FlagUnicast | ptp.FlagProfileSpecific1,
+			SourcePortIdentity: ptp.PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: clockID,
+			},
+			LogMessageInterval: 0x7f,
+		},
+	}
+}
+
+// Measure performs a single exchange with the server.
+// Server answers DelayReq with Sync to the sending port and Announce to the general port,
+// so the general port must be available for binding
+func Measure(ctx context.Context, cfg *Config) (*Result, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+	serverAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(cfg.Server, strconv.Itoa(ptp.PortEvent)))
+	if err != nil {
+		return nil, err
+	}
+
+	// sync comes back to the port delay request was sent from, so any port will do
+	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6unspecified})
+	if err != nil {
+		return nil, err
+	}
+	defer eventConn.Close()
+	genConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6unspecified, Port: ptp.PortGeneral})
+	if err != nil {
+		return nil, err
+	}
+	defer genConn.Close()
+	if err := genConn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	connFd, err := timestamp.ConnFd(eventConn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Iface != "" {
+		err = timestamp.EnableHWTimestamps(connFd, cfg.Iface)
+	} else {
+		err = timestamp.EnableSWTimestamps(connFd)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable timestamps: %w", err)
+	}
+	// timestamps are read from the raw socket, so blocking mode with a timeout is used instead of the poller
+	if err := unix.SetNonblock(connFd, false); err != nil {
+		return nil, fmt.Errorf("failed to set event socket to blocking: %w", err)
+	}
+	tv := unix.NsecToTimeval(time.Until(deadline).Nanoseconds())
+	if err := unix.SetsockoptTimeval(connFd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, fmt.Errorf("failed to set event socket timeout: %w", err)
+	}
+
+	seq := uint16(time.Now().UnixNano())
+	b, err := ptp.Bytes(delayReq(cfg.ClockIdentity, seq))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := eventConn.WriteTo(b, serverAddr); err != nil {
+		return nil, err
+	}
+	t3, _, err := timestamp.ReadTXtimestamp(connFd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TX timestamp: %w", err)
+	}
+
+	sync := &ptp.SyncDelayReq{}
+	var t2 time.Time
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		data, _, rxts, err := timestamp.ReadPacketWithRXTimestamp(connFd)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) {
+				return nil, ErrTimeout
+			}
+			return nil, err
+		}
+		if err := ptp.FromBytes(data, sync); err != nil || sync.MessageType() != ptp.MessageSync || sync.SequenceID != seq {
+			continue
+		}
+		t2 = rxts
+		break
+	}
+	clocks, err := timestamp.ReadClocks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system clocks: %w", err)
+	}
+
+	announce := &ptp.Announce{}
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		n, err := genConn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, ErrTimeout
+			}
+			return nil, err
+		}
+		if err := ptp.FromBytes(buf[:n], announce); err != nil || announce.MessageType() != ptp.MessageAnnounce || announce.SequenceID != seq {
+			continue
+		}
+		break
+	}
+
+	res := newResult(announce.OriginTimestamp.Time(), t2, t3, sync.OriginTimestamp.Time(), corrToDuration(sync.CorrectionField), corrToDuration(announce.CorrectionField))
+	res.UTCOffset = time.Duration(announce.CurrentUTCOffset) * time.Second
+	res.Clocks = clocks
+	return res, nil
+}
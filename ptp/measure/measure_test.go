@@ -0,0 +1,56 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package measure
+
+import (
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResult(t *testing.T) {
+	t1 := time.Unix(1653574589, 0)
+	// 10us path delay each way, our clock is 1ms ahead
+	t2 := t1.Add(10*time.Microsecond + time.Millisecond)
+	t3 := t2.Add(100 * time.Microsecond)
+	t4 := t3.Add(10*time.Microsecond - time.Millisecond)
+
+	res := newResult(t1, t2, t3, t4, 0, 0)
+	require.Equal(t, 10*time.Microsecond, res.Delay)
+	require.Equal(t, time.Millisecond, res.Offset)
+	require.Equal(t, t1.Add(10*time.Microsecond), res.ServerTime(t2))
+
+	// correction fields are excluded from the path delay
+	res = newResult(t1, t2.Add(time.Microsecond), t3, t4.Add(2*time.Microsecond), time.Microsecond, 2*time.Microsecond)
+	require.Equal(t, 10*time.Microsecond, res.Delay)
+	require.Equal(t, time.Millisecond, res.Offset)
+}
+
+func TestDelayReq(t *testing.T) {
+	p := delayReq(ptp.ClockIdentity(1234), 42)
+	b, err := ptp.Bytes(p)
+	require.NoError(t, err)
+
+	got := &ptp.SyncDelayReq{}
+	require.NoError(t, ptp.FromBytes(b, got))
+	require.Equal(t, ptp.MessageDelayReq, got.MessageType())
+	require.Equal(t, uint16(42), got.SequenceID)
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagProfileSpecific1, got.FlagField)
+	require.Equal(t, ptp.ClockIdentity(1234), got.SourcePortIdentity.ClockIdentity)
+}
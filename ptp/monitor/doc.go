@@ -0,0 +1,25 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package monitor implements unicast PTP monitoring client.
+
+It runs two-step unicast negotiation sessions with a server one after another,
+measuring offset and path delay using hardware timestamps without disciplining the clock,
+and exports the measurements as stats.
+Soak runs the sessions for a fixed time instead and verifies every measurement, producing a pass/fail report.
+*/
+package monitor
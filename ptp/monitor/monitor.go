@@ -0,0 +1,123 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/facebook/time/ptp/simpleclient"
+)
+
+// sessionGrace is how long past the granted duration a session may last before it times out
+const sessionGrace = 5 * time.Second
+
+// Config specifies Monitor run options
+type Config struct {
+	// address of the server to monitor
+	Server string
+	// interface name that we'll use to send/receive packets
+	Iface string
+	// what type of typestamping to use
+	Timestamping string
+	// for how long we'll request unicast transmission from server in every session
+	Duration time.Duration
+	// how long to wait before retrying a failed session
+	RetryInterval time.Duration
+	// Soak configures the invariants verified by Soak
+	Soak SoakConfig
+}
+
+// Monitor continuously measures offset and path delay to a PTP unicast server
+type Monitor struct {
+	cfg   *Config
+	stats StatsServer
+	// measurements of the current session
+	measurements int
+	// session runs a single session requesting the duration, runSession unless tested
+	session func(duration time.Duration) error
+	// soak verifies the measurements while soaking
+	soak *soak
+}
+
+// New returns new Monitor
+func New(cfg *Config, stats StatsServer) *Monitor {
+	m := &Monitor{cfg: cfg, stats: stats}
+	m.session = m.runSession
+	return m
+}
+
+// Run runs sessions with the server one after another until ctx is done
+func (m *Monitor) Run(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m.stats.UpdateCounterBy("monitor.sessions", 1)
+		if err := m.session(m.cfg.Duration); err != nil {
+			log.Errorf("session with %s failed: %v", m.cfg.Server, err)
+			m.stats.UpdateCounterBy("monitor.session_errors", 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(m.cfg.RetryInterval):
+			}
+		}
+	}
+}
+
+// runSession negotiates unicast transmission for the duration with the server and measures until the grant ends
+func (m *Monitor) runSession(duration time.Duration) error {
+	m.measurements = 0
+	c := simpleclient.New(&simpleclient.Config{
+		Address:      m.cfg.Server,
+		Iface:        m.cfg.Iface,
+		Timeout:      duration + sessionGrace,
+		Duration:     duration,
+		Timestamping: m.cfg.Timestamping,
+		Quiet:        true,
+	}, m.record)
+	defer c.Close()
+	err := c.Run()
+	// grant expiring without cancellation from the server is fine, as long as we measured something
+	if errors.Is(err, context.DeadlineExceeded) && m.measurements > 0 {
+		err = nil
+	}
+	if err == nil && m.measurements == 0 {
+		err = fmt.Errorf("no measurements collected")
+	}
+	return err
+}
+
+// record exports the measurement as stats
+func (m *Monitor) record(r *simpleclient.MeasurementResult) {
+	m.measurements++
+	if m.soak != nil {
+		m.soak.check(r, m.measurements == 1)
+	}
+	log.Debugf("%s: offset %v, delay %v", m.cfg.Server, r.Offset, r.Delay)
+	m.stats.UpdateCounterBy("monitor.measurements", 1)
+	m.stats.SetCounter("monitor.offset_ns", int64(r.Offset))
+	m.stats.SetCounter("monitor.delay_ns", int64(r.Delay))
+	m.stats.SetCounter("monitor.server_to_client_ns", int64(r.ServerToClientDiff))
+	m.stats.SetCounter("monitor.client_to_server_ns", int64(r.ClientToServerDiff))
+	m.stats.SetCounter("monitor.last_measurement_ts", r.Timestamp.Unix())
+}
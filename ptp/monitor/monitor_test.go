@@ -0,0 +1,53 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/ptp/simpleclient"
+)
+
+func TestRecord(t *testing.T) {
+	stats := NewJSONStats()
+	m := New(&Config{Server: "192.0.2.1"}, stats)
+	ts := time.Unix(1700000000, 0)
+	m.record(&simpleclient.MeasurementResult{
+		Offset:             -42,
+		Delay:              1000,
+		ServerToClientDiff: 958,
+		ClientToServerDiff: 1042,
+		Timestamp:          ts,
+	})
+	m.record(&simpleclient.MeasurementResult{
+		Offset:    21,
+		Delay:     1010,
+		Timestamp: ts.Add(time.Second),
+	})
+	require.Equal(t, 2, m.measurements)
+	require.Equal(t, map[string]int64{
+		"monitor.measurements":        2,
+		"monitor.offset_ns":           21,
+		"monitor.delay_ns":            1010,
+		"monitor.server_to_client_ns": 0,
+		"monitor.client_to_server_ns": 0,
+		"monitor.last_measurement_ts": 1700000001,
+	}, stats.Get())
+}
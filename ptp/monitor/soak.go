@@ -0,0 +1,154 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/facebook/time/ptp/simpleclient"
+)
+
+// maxSoakFailures is how many failures are described in the report, the rest are only counted
+const maxSoakFailures = 100
+
+// minSessionDuration is the shortest unicast transmission requested by the last session of a soak
+const minSessionDuration = time.Second
+
+// SoakConfig specifies the soak run and the invariants it verifies
+type SoakConfig struct {
+	// for how long to soak
+	Duration time.Duration
+	// maximum absolute offset of every measurement, 0 disables the check
+	MaxOffset time.Duration
+	// how many sessions may fail, i.e. grant renewals denied or yielding no measurements
+	MaxSessionErrors int
+	// how many Syncs may be missing from the sequence within sessions
+	MaxSequenceGaps int
+}
+
+// SoakReport is the result of the soak run
+type SoakReport struct {
+	Passed           bool      `json:"passed"`
+	Server           string    `json:"server"`
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end"`
+	Sessions         int       `json:"sessions"`
+	SessionErrors    int       `json:"session_errors"`
+	Measurements     int       `json:"measurements"`
+	SequenceGaps     int       `json:"sequence_gaps"`
+	OffsetViolations int       `json:"offset_violations"`
+	MaxAbsOffsetNS   int64     `json:"max_abs_offset_ns"`
+	Failures         []string  `json:"failures"`
+}
+
+// soak verifies the invariants while soaking
+type soak struct {
+	cfg    SoakConfig
+	report *SoakReport
+	// sequence ID of the previous measurement in the session
+	prevSeq uint16
+}
+
+// fail describes the failure in the report
+func (s *soak) fail(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Warningf("soak: %s", msg)
+	if len(s.report.Failures) < maxSoakFailures {
+		s.report.Failures = append(s.report.Failures, msg)
+	}
+}
+
+// check verifies the measurement. Sequence is only continuous within a session
+func (s *soak) check(r *simpleclient.MeasurementResult, first bool) {
+	s.report.Measurements++
+	offset := r.Offset
+	if offset < 0 {
+		offset = -offset
+	}
+	if int64(offset) > s.report.MaxAbsOffsetNS {
+		s.report.MaxAbsOffsetNS = int64(offset)
+	}
+	if s.cfg.MaxOffset > 0 && offset > s.cfg.MaxOffset {
+		s.report.OffsetViolations++
+		s.fail("offset %v at %v is outside of %v", r.Offset, r.Timestamp, s.cfg.MaxOffset)
+	}
+	// the same Sync may be measured twice, uint16 arithmetic handles the wrap around
+	if !first {
+		if gap := r.SyncSequenceID - s.prevSeq; gap > 1 {
+			s.report.SequenceGaps += int(gap - 1)
+			s.fail("Sync sequence jumped from %d to %d at %v", s.prevSeq, r.SyncSequenceID, r.Timestamp)
+		}
+	}
+	s.prevSeq = r.SyncSequenceID
+}
+
+// verdict decides whether the soak passed. Interrupted soak never passes
+func (s *soak) verdict(interrupted error) {
+	r := s.report
+	if interrupted != nil {
+		s.fail("soak interrupted: %v", interrupted)
+	}
+	if r.Measurements == 0 {
+		s.fail("no measurements collected")
+	}
+	if r.SessionErrors > s.cfg.MaxSessionErrors {
+		s.fail("%d sessions failed, %d allowed", r.SessionErrors, s.cfg.MaxSessionErrors)
+	}
+	if r.SequenceGaps > s.cfg.MaxSequenceGaps {
+		s.fail("%d Syncs missing, %d allowed", r.SequenceGaps, s.cfg.MaxSequenceGaps)
+	}
+	r.Passed = interrupted == nil && r.Measurements > 0 && r.SessionErrors <= s.cfg.MaxSessionErrors &&
+		r.SequenceGaps <= s.cfg.MaxSequenceGaps && r.OffsetViolations == 0
+}
+
+// Soak runs sessions with the server for the soak duration, verifying the invariants on every measurement,
+// and returns the report. The last session requests only the remaining time, so the soak ends on time
+func (m *Monitor) Soak(ctx context.Context) *SoakReport {
+	start := time.Now()
+	deadline := start.Add(m.cfg.Soak.Duration)
+	m.soak = &soak{cfg: m.cfg.Soak, report: &SoakReport{Server: m.cfg.Server, Start: start, Failures: []string{}}}
+	defer func() { m.soak = nil }()
+	r := m.soak.report
+
+	for ctx.Err() == nil {
+		duration := time.Until(deadline)
+		if duration < minSessionDuration {
+			break
+		}
+		if duration > m.cfg.Duration {
+			duration = m.cfg.Duration
+		}
+		r.Sessions++
+		m.stats.UpdateCounterBy("monitor.sessions", 1)
+		if err := m.session(duration); err != nil {
+			r.SessionErrors++
+			m.stats.UpdateCounterBy("monitor.session_errors", 1)
+			m.soak.fail("session %d failed: %v", r.Sessions, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(m.cfg.RetryInterval):
+			}
+		}
+	}
+	r.End = time.Now()
+	m.soak.verdict(ctx.Err())
+	return r
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/facebook/time/ptp/simpleclient"
+)
+
+// fakeSessions returns a session runner recording the measurements of the sessions, nil measurements fail the session
+func fakeSessions(m *Monitor, sessions [][]*simpleclient.MeasurementResult, durations *[]time.Duration) func(time.Duration) error {
+	i := 0
+	return func(d time.Duration) error {
+		*durations = append(*durations, d)
+		m.measurements = 0
+		if i >= len(sessions) {
+			i = len(sessions) - 1
+		}
+		session := sessions[i]
+		i++
+		if session == nil {
+			return errors.New("server denied us grant for SYNC")
+		}
+		for _, r := range session {
+			m.record(r)
+		}
+		// sessions take their whole duration
+		time.Sleep(d)
+		return nil
+	}
+}
+
+func TestSoakPassed(t *testing.T) {
+	m := New(&Config{
+		Server:   "192.0.2.1",
+		Duration: time.Second,
+		Soak:     SoakConfig{Duration: 2500 * time.Millisecond, MaxOffset: time.Microsecond},
+	}, NewJSONStats())
+	durations := []time.Duration{}
+	m.session = fakeSessions(m, [][]*simpleclient.MeasurementResult{
+		{{Offset: 100, SyncSequenceID: 65535}, {Offset: -200, SyncSequenceID: 0}, {Offset: 10, SyncSequenceID: 0}},
+		// new subscription starts another sequence
+		{{Offset: 50, SyncSequenceID: 7}, {Offset: 60, SyncSequenceID: 8}},
+	}, &durations)
+
+	r := m.Soak(context.Background())
+	require.True(t, r.Passed, r.Failures)
+	require.Equal(t, 2, r.Sessions)
+	require.Equal(t, []time.Duration{time.Second, time.Second}, durations)
+	require.Equal(t, 5, r.Measurements)
+	require.Equal(t, int64(200), r.MaxAbsOffsetNS)
+	require.Empty(t, r.Failures)
+	require.Nil(t, m.soak)
+}
+
+func TestSoakFailed(t *testing.T) {
+	m := New(&Config{
+		Server:        "192.0.2.1",
+		Duration:      time.Second,
+		RetryInterval: 600 * time.Millisecond,
+		Soak:          SoakConfig{Duration: 2500 * time.Millisecond, MaxOffset: time.Microsecond, MaxSequenceGaps: 1},
+	}, NewJSONStats())
+	durations := []time.Duration{}
+	m.session = fakeSessions(m, [][]*simpleclient.MeasurementResult{
+		{{Offset: 100, SyncSequenceID: 1}, {Offset: 2000, SyncSequenceID: 4}},
+		nil,
+	}, &durations)
+
+	r := m.Soak(context.Background())
+	require.False(t, r.Passed)
+	require.Equal(t, 2, r.SequenceGaps)
+	require.Equal(t, 1, r.OffsetViolations)
+	require.Equal(t, 1, r.SessionErrors)
+	require.Equal(t, []string{
+		"offset 2µs at 0001-01-01 00:00:00 +0000 UTC is outside of 1µs",
+		"Sync sequence jumped from 1 to 4 at 0001-01-01 00:00:00 +0000 UTC",
+		"session 2 failed: server denied us grant for SYNC",
+		"1 sessions failed, 0 allowed",
+		"2 Syncs missing, 1 allowed",
+	}, r.Failures)
+}
+
+func TestSoakInterrupted(t *testing.T) {
+	m := New(&Config{Duration: time.Second, Soak: SoakConfig{Duration: time.Hour}}, NewJSONStats())
+	ctx, cancel := context.WithCancel(context.Background())
+	m.session = func(time.Duration) error {
+		m.record(&simpleclient.MeasurementResult{})
+		cancel()
+		return nil
+	}
+	r := m.Soak(ctx)
+	require.False(t, r.Passed)
+	require.Equal(t, 1, r.Sessions)
+	require.Equal(t, []string{"soak interrupted: context canceled"}, r.Failures)
+}
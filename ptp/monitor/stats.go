@@ -0,0 +1,93 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StatsServer is a stats server interface
+type StatsServer interface {
+	SetCounter(key string, val int64)
+	UpdateCounterBy(key string, count int64)
+}
+
+// JSONStats reports counters as JSON via http
+type JSONStats struct {
+	mux      sync.Mutex
+	counters map[string]int64
+}
+
+// NewJSONStats returns a new JSONStats
+func NewJSONStats() *JSONStats {
+	return &JSONStats{counters: map[string]int64{}}
+}
+
+// UpdateCounterBy will increment counter
+func (s *JSONStats) UpdateCounterBy(key string, count int64) {
+	s.mux.Lock()
+	s.counters[key] += count
+	s.mux.Unlock()
+}
+
+// SetCounter will set a counter to the provided value.
+func (s *JSONStats) SetCounter(key string, val int64) {
+	s.mux.Lock()
+	s.counters[key] = val
+	s.mux.Unlock()
+}
+
+// Get returns an map of counters
+func (s *JSONStats) Get() map[string]int64 {
+	ret := make(map[string]int64)
+	s.mux.Lock()
+	for key, val := range s.counters {
+		ret[key] = val
+	}
+	s.mux.Unlock()
+	return ret
+}
+
+// Start runs http server
+func (s *JSONStats) Start(monitoringport int) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleRequest)
+	addr := fmt.Sprintf(":%d", monitoringport)
+	log.Infof("Starting http json server on %s", addr)
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		log.Fatalf("Failed to start listener: %v", err)
+	}
+}
+
+// handleRequest is a handler used for all http monitoring requests
+func (s *JSONStats) handleRequest(w http.ResponseWriter, r *http.Request) {
+	js, err := json.Marshal(s.Get())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
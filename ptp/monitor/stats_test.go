@@ -0,0 +1,41 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONStatsHandler(t *testing.T) {
+	stats := NewJSONStats()
+	stats.UpdateCounterBy("monitor.sessions", 1)
+	stats.UpdateCounterBy("monitor.sessions", 1)
+	stats.SetCounter("monitor.offset_ns", -5)
+
+	w := httptest.NewRecorder()
+	stats.handleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	got := map[string]int64{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, map[string]int64{"monitor.sessions": 2, "monitor.offset_ns": -5}, got)
+}
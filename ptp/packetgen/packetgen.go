@@ -0,0 +1,381 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packetgen
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// maxPacketSize is the largest packet we generate
+const maxPacketSize = 1500
+
+// Packet is a generated packet
+type Packet struct {
+	Name string
+	Data []byte
+}
+
+// Flags by the name used in specs, as per Table 37 Values of flagField
+var Flags = map[string]uint16{
+	"alternate_master":          ptp.FlagAlternateMaster,
+	"two_step":                  ptp.FlagTwoStep,
+	"unicast":                   ptp.FlagUnicast,
+	"profile_specific_1":        ptp.FlagProfileSpecific1,
+	"profile_specific_2":        ptp.FlagProfileSpecific2,
+	"leap61":                    ptp.FlagLeap61,
+	"leap59":                    ptp.FlagLeap59,
+	"current_utc_offset_valid":  ptp.FlagCurrentUtcOffsetValid,
+	"ptp_timescale":             ptp.FlagPTPTimescale,
+	"time_traceable":            ptp.FlagTimeTraceable,
+	"frequency_traceable":       ptp.FlagFrequencyTraceable,
+	"synchronization_uncertain": ptp.FlagSynchronizationUncertain,
+}
+
+// TLVTypes by the name used in specs
+var TLVTypes = map[string]ptp.TLVType{
+	"request_unicast_transmission":            ptp.TLVRequestUnicastTransmission,
+	"grant_unicast_transmission":              ptp.TLVGrantUnicastTransmission,
+	"cancel_unicast_transmission":             ptp.TLVCancelUnicastTransmission,
+	"acknowledge_cancel_unicast_transmission": ptp.TLVAcknowledgeCancelUnicastTransmission,
+	"path_trace": ptp.TLVPathTrace,
+}
+
+// controlFields are the values of controlField defined for each message type
+var controlFields = map[ptp.MessageType]uint8{
+	ptp.MessageSync:      0,
+	ptp.MessageDelayReq:  1,
+	ptp.MessageFollowUp:  2,
+	ptp.MessageDelayResp: 3,
+}
+
+// otherControlField is the value of controlField for all other message types
+const otherControlField = 5
+
+// messageType parses message type names like delay_req
+func messageType(name string) (ptp.MessageType, error) {
+	for t, s := range ptp.MessageTypeToString {
+		if strings.EqualFold(s, name) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported message type %q", name)
+}
+
+// rawTLV is written as is, which allows TLVs of unknown types or invalid lengths
+type rawTLV struct {
+	ptp.TLVHead
+	Value []byte
+}
+
+// MarshalBinaryTo marshals bytes to rawTLV
+func (t *rawTLV) MarshalBinaryTo(b []byte) (int, error) {
+	if len(b) < 4+len(t.Value) {
+		return 0, fmt.Errorf("not enough buffer to write TLV")
+	}
+	binary.BigEndian.PutUint16(b, uint16(t.TLVType))
+	binary.BigEndian.PutUint16(b[2:], t.LengthField)
+	return 4 + copy(b[4:], t.Value), nil
+}
+
+func (p *PortSpec) build() ptp.PortIdentity {
+	return ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(p.ClockIdentity), PortNumber: p.Port}
+}
+
+func (h *HeaderSpec) build(msgType ptp.MessageType) (ptp.Header, error) {
+	header := ptp.Header{
+		SdoIDAndMsgType:     ptp.NewSdoIDAndMsgType(msgType, h.SdoID),
+		Version:             ptp.Version,
+		DomainNumber:        h.Domain,
+		MinorSdoID:          h.MinorSdoID,
+		CorrectionField:     ptp.NewCorrection(h.Correction),
+		MessageTypeSpecific: h.MessageTypeSpecific,
+		SourcePortIdentity:  h.SourcePort.build(),
+		SequenceID:          h.Sequence,
+		ControlField:        otherControlField,
+		LogMessageInterval:  ptp.LogInterval(h.LogInterval),
+	}
+	if h.Version != nil {
+		header.Version = *h.Version
+	}
+	if h.MessageLength != nil {
+		header.MessageLength = *h.MessageLength
+	}
+	if c, ok := controlFields[msgType]; ok {
+		header.ControlField = c
+	}
+	if h.ControlField != nil {
+		header.ControlField = *h.ControlField
+	}
+	for _, name := range h.Flags {
+		f, ok := Flags[name]
+		if !ok {
+			return header, fmt.Errorf("unsupported flag %q", name)
+		}
+		header.FlagField |= f
+	}
+	return header, nil
+}
+
+func (t *TLVSpec) build() (ptp.TLV, error) {
+	if t.Type == "raw" {
+		value, err := hex.DecodeString(t.Value)
+		if err != nil {
+			return nil, fmt.Errorf("decoding value of raw TLV: %w", err)
+		}
+		tlv := &rawTLV{
+			TLVHead: ptp.TLVHead{TLVType: ptp.TLVType(t.RawType), LengthField: uint16(len(value))},
+			Value:   value,
+		}
+		if t.Length != nil {
+			tlv.LengthField = *t.Length
+		}
+		return tlv, nil
+	}
+	tlvType, ok := TLVTypes[t.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLV type %q", t.Type)
+	}
+	var msgType ptp.MessageType
+	if t.MessageType != "" {
+		var err error
+		if msgType, err = messageType(t.MessageType); err != nil {
+			return nil, err
+		}
+	}
+	head := ptp.TLVHead{TLVType: tlvType}
+	var tlv ptp.TLV
+	switch tlvType {
+	case ptp.TLVRequestUnicastTransmission:
+		head.LengthField = 6
+		tlv = &ptp.RequestUnicastTransmissionTLV{
+			TLVHead:               head,
+			MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(msgType, 0),
+			LogInterMessagePeriod: ptp.LogInterval(t.LogInterval),
+			DurationField:         t.Duration,
+		}
+	case ptp.TLVGrantUnicastTransmission:
+		head.LengthField = 8
+		tlv = &ptp.GrantUnicastTransmissionTLV{
+			TLVHead:               head,
+			MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(msgType, 0),
+			LogInterMessagePeriod: ptp.LogInterval(t.LogInterval),
+			DurationField:         t.Duration,
+			Renewal:               t.Renewal,
+		}
+	case ptp.TLVCancelUnicastTransmission:
+		head.LengthField = 2
+		tlv = &ptp.CancelUnicastTransmissionTLV{
+			TLVHead:         head,
+			MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(msgType, t.Flags),
+		}
+	case ptp.TLVAcknowledgeCancelUnicastTransmission:
+		head.LengthField = 2
+		tlv = &ptp.AcknowledgeCancelUnicastTransmissionTLV{
+			TLVHead:         head,
+			MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(msgType, t.Flags),
+		}
+	case ptp.TLVPathTrace:
+		head.LengthField = uint16(8 * len(t.Path))
+		path := make([]ptp.ClockIdentity, 0, len(t.Path))
+		for _, c := range t.Path {
+			path = append(path, ptp.ClockIdentity(c))
+		}
+		tlv = &ptp.PathTraceTLV{TLVHead: head, PathSequence: path}
+	}
+	if t.Length != nil {
+		setTLVLength(tlv, *t.Length)
+	}
+	return tlv, nil
+}
+
+// setTLVLength overrides length field of the TLV built by TLVSpec
+func setTLVLength(tlv ptp.TLV, l uint16) {
+	switch t := tlv.(type) {
+	case *ptp.RequestUnicastTransmissionTLV:
+		t.LengthField = l
+	case *ptp.GrantUnicastTransmissionTLV:
+		t.LengthField = l
+	case *ptp.CancelUnicastTransmissionTLV:
+		t.LengthField = l
+	case *ptp.AcknowledgeCancelUnicastTransmissionTLV:
+		t.LengthField = l
+	case *ptp.PathTraceTLV:
+		t.LengthField = l
+	}
+}
+
+// Build returns the packet described by the spec, before any mutations are applied
+func (p *PacketSpec) Build() (ptp.Packet, error) {
+	msgType, err := messageType(p.Type)
+	if err != nil {
+		return nil, err
+	}
+	header, err := p.Header.build(msgType)
+	if err != nil {
+		return nil, err
+	}
+	var ts ptp.Timestamp
+	if p.Timestamp != "" {
+		t, err := time.Parse(time.RFC3339Nano, p.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("parsing timestamp: %w", err)
+		}
+		ts = ptp.NewTimestamp(t)
+	}
+	tlvs := make([]ptp.TLV, 0, len(p.TLVs))
+	for i := range p.TLVs {
+		tlv, err := p.TLVs[i].build()
+		if err != nil {
+			return nil, err
+		}
+		tlvs = append(tlvs, tlv)
+	}
+	if len(tlvs) > 0 && msgType != ptp.MessageAnnounce && msgType != ptp.MessageSignaling {
+		return nil, fmt.Errorf("TLVs are not supported in %s messages", msgType)
+	}
+
+	switch msgType {
+	case ptp.MessageSync, ptp.MessageDelayReq:
+		return &ptp.SyncDelayReq{
+			Header:           header,
+			SyncDelayReqBody: ptp.SyncDelayReqBody{OriginTimestamp: ts},
+		}, nil
+	case ptp.MessageFollowUp:
+		return &ptp.FollowUp{
+			Header:       header,
+			FollowUpBody: ptp.FollowUpBody{PreciseOriginTimestamp: ts},
+		}, nil
+	case ptp.MessageDelayResp:
+		return &ptp.DelayResp{
+			Header: header,
+			DelayRespBody: ptp.DelayRespBody{
+				ReceiveTimestamp:       ts,
+				RequestingPortIdentity: p.RequestingPort.build(),
+			},
+		}, nil
+	case ptp.MessageAnnounce:
+		a := p.Announce
+		return &ptp.Announce{
+			Header: header,
+			AnnounceBody: ptp.AnnounceBody{
+				OriginTimestamp:      ts,
+				CurrentUTCOffset:     a.UTCOffset,
+				GrandmasterPriority1: a.Priority1,
+				GrandmasterClockQuality: ptp.ClockQuality{
+					ClockClass:              ptp.ClockClass(a.ClockClass),
+					ClockAccuracy:           ptp.ClockAccuracy(a.ClockAccuracy),
+					OffsetScaledLogVariance: a.Variance,
+				},
+				GrandmasterPriority2: a.Priority2,
+				GrandmasterIdentity:  ptp.ClockIdentity(a.GrandmasterIdentity),
+				StepsRemoved:         a.StepsRemoved,
+				TimeSource:           ptp.TimeSource(a.TimeSource),
+			},
+			TLVs: tlvs,
+		}, nil
+	case ptp.MessageSignaling:
+		return &ptp.Signaling{
+			Header:             header,
+			TargetPortIdentity: p.TargetPort.build(),
+			TLVs:               tlvs,
+		}, nil
+	}
+	return nil, fmt.Errorf("generating %s messages is not supported", msgType)
+}
+
+// encode marshals the packet, fills in message length unless it's set explicitly and applies mutations
+func (p *PacketSpec) encode(pkt ptp.Packet) ([]byte, error) {
+	m, ok := pkt.(ptp.BinaryMarshalerTo)
+	if !ok {
+		return nil, fmt.Errorf("%s messages can't be marshaled", pkt.MessageType())
+	}
+	b := make([]byte, maxPacketSize)
+	n, err := m.MarshalBinaryTo(b)
+	if err != nil {
+		return nil, err
+	}
+	b = b[:n]
+	if p.Header.MessageLength == nil {
+		binary.BigEndian.PutUint16(b[2:], uint16(n))
+	}
+
+	for _, patch := range p.Patches {
+		value, err := hex.DecodeString(patch.Value)
+		if err != nil {
+			return nil, fmt.Errorf("decoding patch value: %w", err)
+		}
+		if patch.Offset < 0 || patch.Offset+len(value) > maxPacketSize {
+			return nil, fmt.Errorf("patch of %d bytes at offset %d is out of bounds", len(value), patch.Offset)
+		}
+		for len(b) < patch.Offset+len(value) {
+			b = append(b, 0)
+		}
+		copy(b[patch.Offset:], value)
+	}
+	if p.Append != "" {
+		value, err := hex.DecodeString(p.Append)
+		if err != nil {
+			return nil, fmt.Errorf("decoding appended bytes: %w", err)
+		}
+		b = append(b, value...)
+	}
+	if p.Truncate > 0 && p.Truncate < len(b) {
+		b = b[:p.Truncate]
+	}
+	return b, nil
+}
+
+// Generate returns Count packets described by the spec with incrementing sequence IDs
+func (p *PacketSpec) Generate() ([]Packet, error) {
+	pkt, err := p.Build()
+	if err != nil {
+		return nil, err
+	}
+	count := p.Count
+	if count == 0 {
+		count = 1
+	}
+	packets := make([]Packet, 0, count)
+	for i := 0; i < count; i++ {
+		pkt.SetSequence(p.Header.Sequence + uint16(i))
+		data, err := p.encode(pkt)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, Packet{Name: p.Name, Data: data})
+	}
+	return packets, nil
+}
+
+// Generate returns packets described by all packet specs, in order
+func (s *Spec) Generate() ([]Packet, error) {
+	var packets []Packet
+	for i := range s.Packets {
+		p, err := s.Packets[i].Generate()
+		if err != nil {
+			return nil, fmt.Errorf("generating packet %d (%s): %w", i, s.Packets[i].Name, err)
+		}
+		packets = append(packets, p...)
+	}
+	return packets, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packetgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+const specYAML = `
+packets:
+  - name: sync
+    type: sync
+    count: 3
+    header:
+      flags: [unicast, two_step]
+      sequence: 100
+      source_port: {clock_identity: 0x0123456789abcdef, port: 1}
+    timestamp: 2022-03-14T15:09:26.535897932Z
+  - name: grant
+    type: signaling
+    target_port: {clock_identity: 42, port: 2}
+    tlvs:
+      - type: grant_unicast_transmission
+        message_type: announce
+        log_interval: 1
+        duration: 300
+        renewal: 1
+  - name: truncated-announce
+    type: announce
+    truncate: 40
+`
+
+func TestGenerateYAML(t *testing.T) {
+	s, err := ParseYAML([]byte(specYAML))
+	require.NoError(t, err)
+	packets, err := s.Generate()
+	require.NoError(t, err)
+	require.Len(t, packets, 5)
+
+	for i, p := range packets[:3] {
+		require.Equal(t, "sync", p.Name)
+		decoded, err := ptp.DecodePacket(p.Data)
+		require.NoError(t, err)
+		sync, ok := decoded.(*ptp.SyncDelayReq)
+		require.True(t, ok)
+		require.Equal(t, ptp.MessageSync, sync.MessageType())
+		require.Equal(t, uint16(100+i), sync.SequenceID)
+		require.Equal(t, uint16(44), sync.MessageLength)
+		require.Equal(t, ptp.FlagUnicast|ptp.FlagTwoStep, sync.FlagField)
+		require.Equal(t, ptp.PortIdentity{ClockIdentity: 0x0123456789abcdef, PortNumber: 1}, sync.SourcePortIdentity)
+		require.Equal(t, time.Date(2022, 3, 14, 15, 9, 26, 535897932, time.UTC), sync.OriginTimestamp.Time().UTC())
+	}
+
+	decoded, err := ptp.DecodePacket(packets[3].Data)
+	require.NoError(t, err)
+	signaling, ok := decoded.(*ptp.Signaling)
+	require.True(t, ok)
+	require.Equal(t, uint8(5), signaling.ControlField)
+	require.Equal(t, ptp.PortIdentity{ClockIdentity: 42, PortNumber: 2}, signaling.TargetPortIdentity)
+	require.Equal(t, []ptp.TLV{
+		&ptp.GrantUnicastTransmissionTLV{
+			TLVHead:               ptp.TLVHead{TLVType: ptp.TLVGrantUnicastTransmission, LengthField: 8},
+			MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(ptp.MessageAnnounce, 0),
+			LogInterMessagePeriod: 1,
+			DurationField:         300,
+			Renewal:               1,
+		},
+	}, signaling.TLVs)
+
+	require.Len(t, packets[4].Data, 40)
+	_, err = ptp.DecodePacket(packets[4].Data)
+	require.Error(t, err)
+}
+
+func TestGenerateJSON(t *testing.T) {
+	spec := `{"packets": [{"name": "resp", "type": "delay_resp", "header": {"sequence": 7}, "requesting_port": {"clock_identity": 1, "port": 3}}]}`
+	s, err := ParseJSON([]byte(spec))
+	require.NoError(t, err)
+	packets, err := s.Generate()
+	require.NoError(t, err)
+	require.Len(t, packets, 1)
+
+	decoded, err := ptp.DecodePacket(packets[0].Data)
+	require.NoError(t, err)
+	resp, ok := decoded.(*ptp.DelayResp)
+	require.True(t, ok)
+	require.Equal(t, uint16(7), resp.SequenceID)
+	require.Equal(t, uint8(3), resp.ControlField)
+	require.Equal(t, ptp.PortIdentity{ClockIdentity: 1, PortNumber: 3}, resp.RequestingPortIdentity)
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	length := uint16(200)
+	tlvLength := uint16(100)
+	p := PacketSpec{
+		Type:   "signaling",
+		Header: HeaderSpec{MessageLength: &length},
+		TLVs: []TLVSpec{
+			{Type: "request_unicast_transmission", MessageType: "sync", Length: &tlvLength},
+			{Type: "raw", RawType: 0x2000, Value: "0102"},
+		},
+		Patches: []PatchSpec{{Offset: 1, Value: "03"}},
+		Append:  "ffff",
+	}
+	packets, err := p.Generate()
+	require.NoError(t, err)
+	require.Len(t, packets, 1)
+	b := packets[0].Data
+	require.Len(t, b, 34+10+10+6+2)
+	require.Equal(t, byte(3), b[1])
+	require.Equal(t, []byte{0x0, 0xc8}, b[2:4])
+	require.Equal(t, []byte{0x0, 0x64}, b[46:48])
+	require.Equal(t, []byte{0x20, 0x0, 0x0, 0x2, 0x1, 0x2, 0xff, 0xff}, b[54:])
+}
+
+func TestGenerateErrors(t *testing.T) {
+	specs := []PacketSpec{
+		{Type: "nope"},
+		{Type: "sync", Header: HeaderSpec{Flags: []string{"nope"}}},
+		{Type: "sync", Timestamp: "yesterday"},
+		{Type: "sync", TLVs: []TLVSpec{{Type: "path_trace"}}},
+		{Type: "announce", TLVs: []TLVSpec{{Type: "nope"}}},
+		{Type: "announce", TLVs: []TLVSpec{{Type: "raw", Value: "nothex"}}},
+		{Type: "sync", Patches: []PatchSpec{{Offset: maxPacketSize, Value: "00"}}},
+		{Type: "signaling"},
+	}
+	for _, s := range specs {
+		_, err := s.Generate()
+		require.Error(t, err, "%+v", s)
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	_, err := ParseYAML([]byte("packets:\n  - type: sync\n    typo: 1\n"))
+	require.Error(t, err)
+	_, err = ParseJSON([]byte(`{"packets": [{"type": "sync", "typo": 1}]}`))
+	require.Error(t, err)
+}
+
+func TestReadSpec(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "spec.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(specYAML), 0644))
+	s, err := ReadSpec(yamlPath)
+	require.NoError(t, err)
+	require.Len(t, s.Packets, 3)
+
+	jsonPath := filepath.Join(dir, "spec.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"packets": [{"type": "sync"}]}`), 0644))
+	s, err = ReadSpec(jsonPath)
+	require.NoError(t, err)
+	require.Len(t, s.Packets, 1)
+
+	_, err = ReadSpec(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package packetgen builds PTP packets from declarative specs.
+
+Specs are YAML or JSON documents describing packets field by field. Fields default
+to zero unless noted otherwise, so a spec only needs to mention what the test case is about.
+On top of valid packets, specs can describe invalid ones by overriding computed
+fields (like message length) or by mutating the encoded bytes.
+
+	packets:
+	  - name: sync
+	    type: sync
+	    count: 3
+	    header:
+	      flags: [unicast, two_step]
+	      sequence: 100
+	      source_port: {clock_identity: 0x0123456789abcdef, port: 1}
+	    timestamp: 2022-03-14T15:09:26.535897932Z
+	  - name: truncated-announce
+	    type: announce
+	    truncate: 40
+*/
+package packetgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Spec is a set of packets
+type Spec struct {
+	Packets []PacketSpec `yaml:"packets" json:"packets"`
+}
+
+// PacketSpec describes a single packet
+type PacketSpec struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is a message type, like sync, delay_req, follow_up, delay_resp, announce or signaling
+	Type string `yaml:"type" json:"type"`
+	// Count of packets to generate, sequence ID is incremented for every copy. Defaults to 1
+	Count  int        `yaml:"count" json:"count"`
+	Header HeaderSpec `yaml:"header" json:"header"`
+	// Timestamp is the origin, precise origin or receive timestamp depending on the message type, RFC3339
+	Timestamp string `yaml:"timestamp" json:"timestamp"`
+	// RequestingPort of Delay_Resp
+	RequestingPort PortSpec `yaml:"requesting_port" json:"requesting_port"`
+	// TargetPort of Signaling
+	TargetPort PortSpec     `yaml:"target_port" json:"target_port"`
+	Announce   AnnounceSpec `yaml:"announce" json:"announce"`
+	// TLVs of Announce and Signaling
+	TLVs []TLVSpec `yaml:"tlvs" json:"tlvs"`
+
+	// Mutations applied to the encoded packet, in this order
+	Patches  []PatchSpec `yaml:"patches" json:"patches"`
+	Append   string      `yaml:"append" json:"append"` // hex encoded bytes
+	Truncate int         `yaml:"truncate" json:"truncate"`
+}
+
+// HeaderSpec describes the common message header
+type HeaderSpec struct {
+	SdoID uint8 `yaml:"sdo_id" json:"sdo_id"`
+	// Version defaults to the version implemented by the protocol package
+	Version *uint8 `yaml:"version" json:"version"`
+	// MessageLength defaults to the length of the encoded packet
+	MessageLength *uint16 `yaml:"message_length" json:"message_length"`
+	Domain        uint8   `yaml:"domain" json:"domain"`
+	MinorSdoID    uint8   `yaml:"minor_sdo_id" json:"minor_sdo_id"`
+	// Flags by name, like unicast, two_step or ptp_timescale
+	Flags []string `yaml:"flags" json:"flags"`
+	// Correction in nanoseconds
+	Correction          float64  `yaml:"correction" json:"correction"`
+	MessageTypeSpecific uint32   `yaml:"message_type_specific" json:"message_type_specific"`
+	SourcePort          PortSpec `yaml:"source_port" json:"source_port"`
+	Sequence            uint16   `yaml:"sequence" json:"sequence"`
+	// ControlField defaults to the value defined for the message type
+	ControlField *uint8 `yaml:"control_field" json:"control_field"`
+	LogInterval  int8   `yaml:"log_interval" json:"log_interval"`
+}
+
+// PortSpec describes a port identity
+type PortSpec struct {
+	ClockIdentity uint64 `yaml:"clock_identity" json:"clock_identity"`
+	Port          uint16 `yaml:"port" json:"port"`
+}
+
+// AnnounceSpec describes the Announce message body
+type AnnounceSpec struct {
+	UTCOffset           int16  `yaml:"utc_offset" json:"utc_offset"`
+	Priority1           uint8  `yaml:"priority1" json:"priority1"`
+	ClockClass          uint8  `yaml:"clock_class" json:"clock_class"`
+	ClockAccuracy       uint8  `yaml:"clock_accuracy" json:"clock_accuracy"`
+	Variance            uint16 `yaml:"variance" json:"variance"`
+	Priority2           uint8  `yaml:"priority2" json:"priority2"`
+	GrandmasterIdentity uint64 `yaml:"grandmaster_identity" json:"grandmaster_identity"`
+	StepsRemoved        uint16 `yaml:"steps_removed" json:"steps_removed"`
+	TimeSource          uint8  `yaml:"time_source" json:"time_source"`
+}
+
+// TLVSpec describes a TLV
+type TLVSpec struct {
+	// Type is a TLV type, like request_unicast_transmission or path_trace.
+	// raw TLV is written as is from RawType and Value
+	Type string `yaml:"type" json:"type"`
+	// MessageType of unicast negotiation TLVs
+	MessageType string `yaml:"message_type" json:"message_type"`
+	LogInterval int8   `yaml:"log_interval" json:"log_interval"`
+	Duration    uint32 `yaml:"duration" json:"duration"`
+	Renewal     uint8  `yaml:"renewal" json:"renewal"`
+	// Flags of cancel unicast transmission TLVs
+	Flags uint8 `yaml:"flags" json:"flags"`
+	// Path of path trace TLV
+	Path []uint64 `yaml:"path" json:"path"`
+	// Length defaults to the length of the TLV value
+	Length  *uint16 `yaml:"length" json:"length"`
+	RawType uint16  `yaml:"raw_type" json:"raw_type"`
+	Value   string  `yaml:"value" json:"value"` // hex encoded bytes
+}
+
+// PatchSpec overwrites bytes of the encoded packet starting at Offset
+type PatchSpec struct {
+	Offset int    `yaml:"offset" json:"offset"`
+	Value  string `yaml:"value" json:"value"` // hex encoded bytes
+}
+
+// ParseYAML parses YAML spec
+func ParseYAML(data []byte) (*Spec, error) {
+	s := &Spec{}
+	if err := yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParseJSON parses JSON spec
+func ParseJSON(data []byte) (*Spec, error) {
+	s := &Spec{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReadSpec reads spec from the file. Files with .json extension are parsed as JSON, everything else as YAML
+func ReadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s *Spec
+	if filepath.Ext(path) == ".json" {
+		s, err = ParseJSON(data)
+	} else {
+		s, err = ParseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return s, nil
+}
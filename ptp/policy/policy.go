@@ -0,0 +1,376 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package policy implements operator rules written as expressions, evaluated by ptp4u on grant requests
+and by c4u on clock quality updates, so rules can change without code changes.
+Policy files carry their own unit tests which are run by `ptp4uctl policy test`.
+*/
+package policy
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"github.com/Knetic/govaluate"
+	ptp "github.com/facebook/time/ptp/protocol"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Actions of the grant rules
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// ExpectNone is the expected quality test outcome when no rule applies
+const ExpectNone = "none"
+
+// variables of the grant rule expressions
+var grantVariables = map[string]bool{
+	"ip":       true,
+	"type":     true,
+	"interval": true,
+	"duration": true,
+	"domain":   true,
+	"tenant":   true,
+}
+
+// variables of the quality rule expressions
+var qualityVariables = map[string]bool{
+	"phcoffset":        true,
+	"oscillatoroffset": true,
+	"clockclass":       true,
+	"clockaccuracy":    true,
+}
+
+// all the functions we support in expressions
+var functions = map[string]govaluate.ExpressionFunction{
+	"abs": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("abs: wrong number of arguments: want 1, got %d", len(args))
+		}
+		val, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("abs: want a number, got %v", args[0])
+		}
+		return math.Abs(val), nil
+	},
+	"in_prefix": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("in_prefix: wrong number of arguments: want 2, got %d", len(args))
+		}
+		ip, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("in_prefix: want an IP, got %v", args[0])
+		}
+		prefix, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("in_prefix: want a prefix, got %v", args[1])
+		}
+		_, n, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("in_prefix: %w", err)
+		}
+		return n.Contains(net.ParseIP(ip)), nil
+	},
+}
+
+// compile parses the expression using only the supported variables
+func compile(when string, vars map[string]bool) (*govaluate.EvaluableExpression, error) {
+	expr, err := govaluate.NewEvaluableExpressionWithFunctions(when, functions)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range expr.Vars() {
+		if !vars[v] {
+			return nil, fmt.Errorf("unsupported variable %q", v)
+		}
+	}
+	return expr, nil
+}
+
+// match evaluates the expression which has to be boolean
+func match(expr *govaluate.EvaluableExpression, params map[string]interface{}) (bool, error) {
+	res, err := expr.Evaluate(params)
+	if err != nil {
+		return false, err
+	}
+	b, ok := res.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q is not boolean: %v", expr.String(), res)
+	}
+	return b, nil
+}
+
+// GrantRequest is a grant request the grant rules are evaluated on
+type GrantRequest struct {
+	IP string
+	// Type of the requested messages, e.g. SYNC
+	Type string
+	// Interval is the log2 of the requested interval
+	Interval int8
+	// Duration of the requested subscription in seconds
+	Duration uint32
+	Domain   uint8
+	Tenant   string
+}
+
+func (r *GrantRequest) params() map[string]interface{} {
+	return map[string]interface{}{
+		"ip":       r.IP,
+		"type":     r.Type,
+		"interval": float64(r.Interval),
+		"duration": float64(r.Duration),
+		"domain":   float64(r.Domain),
+		"tenant":   r.Tenant,
+	}
+}
+
+// GrantRule decides the grant requests matching the expression. First matching rule wins
+type GrantRule struct {
+	Name   string
+	When   string
+	Action string
+
+	expr *govaluate.EvaluableExpression
+}
+
+// QualityUpdate is a clock quality update the quality rules are evaluated on
+type QualityUpdate struct {
+	// At is the time of the update since the first one. Only used by tests
+	At               time.Duration
+	PHCOffset        time.Duration
+	OscillatorOffset time.Duration
+	ClockClass       ptp.ClockClass
+	ClockAccuracy    ptp.ClockAccuracy
+}
+
+func (u *QualityUpdate) params() map[string]interface{} {
+	return map[string]interface{}{
+		"phcoffset":        float64(u.PHCOffset.Nanoseconds()),
+		"oscillatoroffset": float64(u.OscillatorOffset.Nanoseconds()),
+		"clockclass":       float64(u.ClockClass),
+		"clockaccuracy":    float64(u.ClockAccuracy),
+	}
+}
+
+// QualityRule overrides the clock quality once the expression holds for the duration. First applying rule wins
+type QualityRule struct {
+	Name string
+	When string
+	For  time.Duration
+	// ClockClass advertised while the rule applies. Unchanged if 0
+	ClockClass ptp.ClockClass
+	// ClockAccuracy advertised while the rule applies. Unchanged if 0
+	ClockAccuracy ptp.ClockAccuracy
+
+	expr *govaluate.EvaluableExpression
+}
+
+// Apply overrides the clock quality by the rule
+func (r *QualityRule) Apply(q *ptp.ClockQuality) {
+	if r.ClockClass != 0 {
+		q.ClockClass = r.ClockClass
+	}
+	if r.ClockAccuracy != 0 {
+		q.ClockAccuracy = r.ClockAccuracy
+	}
+}
+
+// Test is a unit test of the policy
+type Test struct {
+	Name string
+	// Grant is the request to decide
+	Grant *GrantRequest
+	// Quality are the clock quality updates evaluated in order
+	Quality []QualityUpdate
+	// Expect is allow or deny for the grant, and the name of the rule applying after the last quality update or none
+	Expect string
+}
+
+// Policy is a set of grant and quality rules with their tests
+type Policy struct {
+	Grant   []*GrantRule
+	Quality []*QualityRule
+	Tests   []*Test
+}
+
+// Parse parses and compiles the policy
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, err
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Read reads the policy from the file
+func Read(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// compile validates the rules and compiles their expressions
+func (p *Policy) compile() error {
+	var err error
+	for i, r := range p.Grant {
+		if r.Name == "" {
+			return fmt.Errorf("grant rule %d: name is required", i)
+		}
+		if r.Action != ActionAllow && r.Action != ActionDeny {
+			return fmt.Errorf("grant rule %q: unsupported action %q", r.Name, r.Action)
+		}
+		if r.expr, err = compile(r.When, grantVariables); err != nil {
+			return fmt.Errorf("grant rule %q: %w", r.Name, err)
+		}
+	}
+	for i, r := range p.Quality {
+		if r.Name == "" {
+			return fmt.Errorf("quality rule %d: name is required", i)
+		}
+		if r.For < 0 {
+			return fmt.Errorf("quality rule %q: duration must not be negative", r.Name)
+		}
+		if r.expr, err = compile(r.When, qualityVariables); err != nil {
+			return fmt.Errorf("quality rule %q: %w", r.Name, err)
+		}
+	}
+	for i, t := range p.Tests {
+		if (t.Grant == nil) == (len(t.Quality) == 0) {
+			return fmt.Errorf("test %d %q: either grant or quality is required", i, t.Name)
+		}
+	}
+	return nil
+}
+
+// DecideGrant returns the first grant rule matching the request, nil if none matches.
+// Rules failing to evaluate are skipped and reported in the error
+func (p *Policy) DecideGrant(r *GrantRequest) (*GrantRule, error) {
+	params := r.params()
+	var errs error
+	for _, rule := range p.Grant {
+		ok, err := match(rule.expr, params)
+		if err != nil {
+			errs = fmt.Errorf("grant rule %q: %w", rule.Name, err)
+			continue
+		}
+		if ok {
+			return rule, errs
+		}
+	}
+	return nil, errs
+}
+
+// QualityEvaluator keeps track of how long the quality rules of the policy hold
+type QualityEvaluator struct {
+	policy *Policy
+	since  map[*QualityRule]time.Time
+}
+
+// NewQualityEvaluator returns the evaluator of the quality rules
+func (p *Policy) NewQualityEvaluator() *QualityEvaluator {
+	return &QualityEvaluator{policy: p, since: map[*QualityRule]time.Time{}}
+}
+
+// Evaluate returns the first quality rule which held for its duration at now, nil if none applies.
+// Rules failing to evaluate don't hold and are reported in the error
+func (e *QualityEvaluator) Evaluate(u *QualityUpdate, now time.Time) (*QualityRule, error) {
+	params := u.params()
+	var applied *QualityRule
+	var errs error
+	// every rule is evaluated to keep track of since when it holds
+	for _, rule := range e.policy.Quality {
+		ok, err := match(rule.expr, params)
+		if err != nil {
+			errs = fmt.Errorf("quality rule %q: %w", rule.Name, err)
+		}
+		if !ok {
+			delete(e.since, rule)
+			continue
+		}
+		since, seen := e.since[rule]
+		if !seen {
+			since = now
+			e.since[rule] = since
+		}
+		if applied == nil && now.Sub(since) >= rule.For {
+			applied = rule
+		}
+	}
+	return applied, errs
+}
+
+// TestResult is the outcome of a policy test
+type TestResult struct {
+	Name string
+	Got  string
+	Want string
+	Err  error
+}
+
+// Passed checks the test got what it wanted
+func (r *TestResult) Passed() bool {
+	return r.Err == nil && r.Got == r.Want
+}
+
+// run runs the test against the policy
+func (t *Test) run(p *Policy) *TestResult {
+	res := &TestResult{Name: t.Name, Want: t.Expect}
+	if t.Grant != nil {
+		rule, err := p.DecideGrant(t.Grant)
+		res.Err = err
+		res.Got = ActionAllow
+		if rule != nil {
+			res.Got = rule.Action
+		}
+		return res
+	}
+	e := p.NewQualityEvaluator()
+	start := time.Unix(0, 0)
+	res.Got = ExpectNone
+	for i := range t.Quality {
+		u := &t.Quality[i]
+		rule, err := e.Evaluate(u, start.Add(u.At))
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Got = ExpectNone
+		if rule != nil {
+			res.Got = rule.Name
+		}
+	}
+	return res
+}
+
+// RunTests runs the tests of the policy
+func (p *Policy) RunTests() []*TestResult {
+	results := make([]*TestResult, 0, len(p.Tests))
+	for _, t := range p.Tests {
+		results = append(results, t.run(p))
+	}
+	return results
+}
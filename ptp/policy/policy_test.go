@@ -0,0 +1,146 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+grant:
+  - name: lab-fast-sync
+    when: "in_prefix(ip, '10.1.0.0/16') && type == 'SYNC' && interval < -4"
+    action: deny
+  - name: lab
+    when: "in_prefix(ip, '10.1.0.0/16')"
+    action: allow
+  - name: long-subscriptions
+    when: "duration > 3600"
+    action: deny
+quality:
+  - name: offset-out-of-spec
+    when: "abs(phcoffset) > 1000"
+    for: 60s
+    clockclass: 187
+    clockaccuracy: 254
+tests:
+  - name: fast sync is denied in the lab
+    grant: {ip: 10.1.2.3, type: SYNC, interval: -5, duration: 300}
+    expect: deny
+  - name: lab may subscribe for long
+    grant: {ip: 10.1.2.3, type: SYNC, interval: -4, duration: 7200}
+    expect: allow
+  - name: long subscriptions are denied
+    grant: {ip: 10.2.2.3, type: ANNOUNCE, interval: 0, duration: 7200}
+    expect: deny
+  - name: degraded after a minute out of spec
+    quality:
+      - {at: 0s, phcoffset: -2us, clockclass: 6, clockaccuracy: 33}
+      - {at: 61s, phcoffset: 1500ns, clockclass: 6, clockaccuracy: 33}
+    expect: offset-out-of-spec
+  - name: short excursion is ignored
+    quality:
+      - {at: 0s, phcoffset: 2us, clockclass: 6}
+      - {at: 30s, phcoffset: 10ns, clockclass: 6}
+      - {at: 61s, phcoffset: 2us, clockclass: 6}
+    expect: none
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	require.Len(t, p.Grant, 3)
+	require.Len(t, p.Quality, 1)
+	require.Equal(t, time.Minute, p.Quality[0].For)
+	require.Equal(t, ptp.ClockClass(187), p.Quality[0].ClockClass)
+	require.Len(t, p.Tests, 5)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown action":   "grant: [{name: r, when: 'true', action: drop}]",
+		"unknown variable": "grant: [{name: r, when: 'offset > 1', action: deny}]",
+		"quality variable": "quality: [{name: r, when: 'interval < 1'}]",
+		"syntax":           "quality: [{name: r, when: 'phcoffset >'}]",
+		"no name":          "quality: [{when: 'phcoffset > 1'}]",
+		"negative for":     "quality: [{name: r, when: 'phcoffset > 1', for: -1s}]",
+		"empty test":       "tests: [{name: t, expect: allow}]",
+		"unknown field":    "grant: [{name: r, when: 'true', action: deny, after: 1s}]",
+	} {
+		_, err := Parse([]byte(data))
+		require.Error(t, err, name)
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	for _, r := range p.RunTests() {
+		require.True(t, r.Passed(), "%s: got %q, want %q, err %v", r.Name, r.Got, r.Want, r.Err)
+	}
+
+	p.Tests[0].Expect = ActionAllow
+	r := p.RunTests()[0]
+	require.False(t, r.Passed())
+	require.Equal(t, ActionDeny, r.Got)
+}
+
+func TestDecideGrant(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	rule, err := p.DecideGrant(&GrantRequest{IP: "2001:db8::1", Type: "SYNC", Interval: -7, Duration: 60})
+	require.NoError(t, err)
+	require.Nil(t, rule)
+
+	rule, err = p.DecideGrant(&GrantRequest{IP: "10.1.0.1", Type: "SYNC", Interval: -7, Duration: 60})
+	require.NoError(t, err)
+	require.Equal(t, "lab-fast-sync", rule.Name)
+
+	p, err = Parse([]byte("grant: [{name: r, when: 'abs(ip) > 1', action: deny}]"))
+	require.NoError(t, err)
+	rule, err = p.DecideGrant(&GrantRequest{IP: "10.1.0.1"})
+	require.Error(t, err)
+	require.Nil(t, rule)
+}
+
+func TestQualityEvaluator(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	e := p.NewQualityEvaluator()
+	now := time.Now()
+
+	out := &QualityUpdate{PHCOffset: 2 * time.Microsecond, ClockClass: 6, ClockAccuracy: 33}
+	rule, err := e.Evaluate(out, now)
+	require.NoError(t, err)
+	require.Nil(t, rule)
+
+	rule, err = e.Evaluate(out, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, "offset-out-of-spec", rule.Name)
+	q := &ptp.ClockQuality{ClockClass: 6, ClockAccuracy: 33}
+	rule.Apply(q)
+	require.Equal(t, &ptp.ClockQuality{ClockClass: 187, ClockAccuracy: 254}, q)
+
+	rule, err = e.Evaluate(&QualityUpdate{PHCOffset: 10 * time.Nanosecond}, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Nil(t, rule)
+}
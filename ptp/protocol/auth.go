@@ -0,0 +1,247 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Security parameter indicator flags of the AUTHENTICATION TLV, 16.14.3.3
+const (
+	SecParamDisclosedKey uint8 = 1 << 0
+	SecParamSequenceNo   uint8 = 1 << 1
+	SecParamRES          uint8 = 1 << 2
+)
+
+// authTLVFixedSize is the size of SPP, secParamIndicator and keyID fields
+const authTLVFixedSize = 6
+
+// MaxICVLength is the longest ICV produced by HMAC-SHA256
+const MaxICVLength = sha256.Size
+
+// AuthenticationTLV is a Table 131 AUTHENTICATION TLV format.
+// Only immediate security processing is supported, so the optional disclosedKey,
+// sequenceNo and RES fields are never present
+type AuthenticationTLV struct {
+	TLVHead
+	SPP               uint8
+	SecParamIndicator uint8
+	KeyID             uint32
+	ICV               []byte
+}
+
+// MarshalBinaryTo marshals bytes to AuthenticationTLV
+func (t *AuthenticationTLV) MarshalBinaryTo(b []byte) (int, error) {
+	size := tlvHeadSize + authTLVFixedSize + len(t.ICV)
+	if len(b) < size {
+		return 0, fmt.Errorf("not enough buffer to write AuthenticationTLV")
+	}
+	tlvHeadMarshalBinaryTo(&t.TLVHead, b)
+	b[tlvHeadSize] = t.SPP
+	b[tlvHeadSize+1] = t.SecParamIndicator
+	binary.BigEndian.PutUint32(b[tlvHeadSize+2:], t.KeyID)
+	copy(b[tlvHeadSize+authTLVFixedSize:], t.ICV)
+	return size, nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (t *AuthenticationTLV) UnmarshalBinary(b []byte) error {
+	if err := unmarshalTLVHeader(&t.TLVHead, b); err != nil {
+		return err
+	}
+	if err := checkTLVLength(&t.TLVHead, len(b), authTLVFixedSize, false); err != nil {
+		return err
+	}
+	t.SPP = b[tlvHeadSize]
+	t.SecParamIndicator = b[tlvHeadSize+1]
+	if t.SecParamIndicator != 0 {
+		return fmt.Errorf("delayed security processing (secParamIndicator %#x) is not supported", t.SecParamIndicator)
+	}
+	t.KeyID = binary.BigEndian.Uint32(b[tlvHeadSize+2:])
+	t.ICV = make([]byte, int(t.LengthField)-authTLVFixedSize)
+	copy(t.ICV, b[tlvHeadSize+authTLVFixedSize:])
+	return nil
+}
+
+// Errors returned by Authenticator.Verify
+var (
+	ErrAuthMissing = errors.New("no AUTHENTICATION TLV")
+	ErrAuthSPP     = errors.New("unknown security parameter pointer")
+	ErrAuthKey     = errors.New("unknown key ID")
+	ErrAuthICV     = errors.New("ICV mismatch")
+)
+
+// AuthKey is a key of the security association
+type AuthKey struct {
+	ID  uint32
+	Key []byte
+	// ICVLength truncates HMAC-SHA256 to the given number of bytes. Full 32 bytes if 0
+	ICVLength int
+}
+
+func (k *AuthKey) icvLength() int {
+	if k.ICVLength == 0 {
+		return MaxICVLength
+	}
+	return k.ICVLength
+}
+
+// Authenticator appends and verifies AUTHENTICATION TLVs of a single security
+// association using HMAC-SHA256 with immediate security processing.
+// The ICV covers the whole message up to the ICV field except of the correctionField,
+// which is treated as zero as transparent clocks update it on the way
+type Authenticator struct {
+	SPP uint8
+	// SendKeyID is the key outgoing messages are authenticated with
+	SendKeyID uint32
+	keys      map[uint32]*AuthKey
+}
+
+// NewAuthenticator returns an Authenticator for the security parameter pointer spp.
+// Incoming messages are accepted with any of the keys, outgoing are authenticated with sendKeyID
+func NewAuthenticator(spp uint8, sendKeyID uint32, keys []*AuthKey) (*Authenticator, error) {
+	a := &Authenticator{SPP: spp, SendKeyID: sendKeyID, keys: map[uint32]*AuthKey{}}
+	for _, k := range keys {
+		if len(k.Key) == 0 {
+			return nil, fmt.Errorf("key %d is empty", k.ID)
+		}
+		if k.ICVLength < 0 || k.ICVLength > MaxICVLength || k.ICVLength%2 != 0 {
+			return nil, fmt.Errorf("key %d: ICV length must be even and at most %d bytes, got %d", k.ID, MaxICVLength, k.ICVLength)
+		}
+		if _, ok := a.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key %d", k.ID)
+		}
+		a.keys[k.ID] = k
+	}
+	if _, ok := a.keys[sendKeyID]; !ok {
+		return nil, fmt.Errorf("send key %d is not configured", sendKeyID)
+	}
+	return a, nil
+}
+
+// Size returns the size of AUTHENTICATION TLV appended to outgoing messages
+func (a *Authenticator) Size() int {
+	return tlvHeadSize + authTLVFixedSize + a.keys[a.SendKeyID].icvLength()
+}
+
+// icv computes ICV of the message with the correctionField zeroed
+func (a *Authenticator) icv(key *AuthKey, msg []byte) []byte {
+	var correction [8]byte
+	mac := hmac.New(sha256.New, key.Key)
+	mac.Write(msg[:8])
+	mac.Write(correction[:])
+	mac.Write(msg[16:])
+	return mac.Sum(nil)[:key.icvLength()]
+}
+
+// Append appends the AUTHENTICATION TLV to the message of n bytes serialized into b by BytesTo,
+// updating the messageLength. Returns the new number of bytes including the trailing padding
+func (a *Authenticator) Append(b []byte, n int) (int, error) {
+	if n < headerSize || len(b) < headerSize {
+		return 0, fmt.Errorf("not enough data to decode PTP header")
+	}
+	msgLen := int(binary.BigEndian.Uint16(b[2:]))
+	if msgLen > n {
+		return 0, fmt.Errorf("message length %d is larger than %d bytes", msgLen, n)
+	}
+	// BytesTo pads the message with zeros
+	pad := n - msgLen
+	key := a.keys[a.SendKeyID]
+	size := a.Size()
+	if msgLen+size+pad > len(b) {
+		return 0, fmt.Errorf("not enough buffer to append AuthenticationTLV")
+	}
+	tlv := &AuthenticationTLV{
+		TLVHead: TLVHead{
+			TLVType:     TLVAuthentication,
+			LengthField: uint16(size - tlvHeadSize),
+		},
+		SPP:   a.SPP,
+		KeyID: key.ID,
+		ICV:   make([]byte, key.icvLength()),
+	}
+	if _, err := tlv.MarshalBinaryTo(b[msgLen:]); err != nil {
+		return 0, err
+	}
+	total := msgLen + size
+	binary.BigEndian.PutUint16(b[2:], uint16(total))
+	copy(b[total-len(tlv.ICV):], a.icv(key, b[:total-len(tlv.ICV)]))
+	for i := total; i < total+pad; i++ {
+		b[i] = 0
+	}
+	return total + pad, nil
+}
+
+// bodySize returns the size of the message preceding its TLVs
+func bodySize(t MessageType) (int, error) {
+	switch t {
+	case MessageSync, MessageDelayReq, MessageFollowUp, MessageSignaling:
+		return headerSize + 10, nil
+	case MessageDelayResp, MessagePDelayReq, MessagePDelayResp, MessagePDelayRespFollowUp:
+		return headerSize + 20, nil
+	case MessageAnnounce:
+		return headerSize + 30, nil
+	case MessageManagement:
+		return headerSize + 14, nil
+	}
+	return 0, fmt.Errorf("unsupported message type %s", t)
+}
+
+// Verify checks the AUTHENTICATION TLV of the message, which has to be its last TLV
+func (a *Authenticator) Verify(b []byte) error {
+	if len(b) < headerSize {
+		return fmt.Errorf("not enough data to decode PTP header")
+	}
+	msgLen := int(binary.BigEndian.Uint16(b[2:]))
+	if msgLen > len(b) {
+		return fmt.Errorf("message length %d is larger than %d bytes", msgLen, len(b))
+	}
+	pos, err := bodySize(SdoIDAndMsgType(b[0]).MsgType())
+	if err != nil {
+		return err
+	}
+	last := -1
+	for pos+tlvHeadSize <= msgLen {
+		last = pos
+		pos += tlvHeadSize + int(binary.BigEndian.Uint16(b[pos+2:]))
+	}
+	if pos > msgLen {
+		return fmt.Errorf("TLV at %d exceeds message length %d", last, msgLen)
+	}
+	if last < 0 || TLVType(binary.BigEndian.Uint16(b[last:])) != TLVAuthentication {
+		return ErrAuthMissing
+	}
+	tlv := &AuthenticationTLV{}
+	if err := tlv.UnmarshalBinary(b[last:msgLen]); err != nil {
+		return err
+	}
+	if tlv.SPP != a.SPP {
+		return ErrAuthSPP
+	}
+	key, ok := a.keys[tlv.KeyID]
+	if !ok {
+		return ErrAuthKey
+	}
+	if len(tlv.ICV) != key.icvLength() || !hmac.Equal(tlv.ICV, a.icv(key, b[:msgLen-len(tlv.ICV)])) {
+		return ErrAuthICV
+	}
+	return nil
+}
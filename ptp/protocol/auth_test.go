@@ -0,0 +1,169 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testAuthenticator(t *testing.T) *Authenticator {
+	a, err := NewAuthenticator(1, 2, []*AuthKey{
+		{ID: 1, Key: []byte("old secret")},
+		{ID: 2, Key: []byte("new secret"), ICVLength: 16},
+	})
+	require.NoError(t, err)
+	return a
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	_, err := NewAuthenticator(1, 3, []*AuthKey{{ID: 1, Key: []byte("secret")}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "send key 3 is not configured")
+	_, err = NewAuthenticator(1, 1, []*AuthKey{{ID: 1}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "key 1 is empty")
+	_, err = NewAuthenticator(1, 1, []*AuthKey{{ID: 1, Key: []byte("secret"), ICVLength: 15}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ICV length must be even")
+	_, err = NewAuthenticator(1, 1, []*AuthKey{{ID: 1, Key: []byte("a")}, {ID: 1, Key: []byte("b")}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate key 1")
+}
+
+func TestAuthenticationTLV(t *testing.T) {
+	tlv := &AuthenticationTLV{
+		TLVHead: TLVHead{
+			TLVType:     TLVAuthentication,
+			LengthField: 10,
+		},
+		SPP:   3,
+		KeyID: 0x01020304,
+		ICV:   []byte{0xa, 0xb, 0xc, 0xd},
+	}
+	b := make([]byte, 14)
+	n, err := tlv.MarshalBinaryTo(b)
+	require.NoError(t, err)
+	require.Equal(t, 14, n)
+	require.Equal(t, []byte{0x80, 0x09, 0x00, 0x0a, 0x03, 0x00, 0x01, 0x02, 0x03, 0x04, 0xa, 0xb, 0xc, 0xd}, b)
+
+	got := &AuthenticationTLV{}
+	require.NoError(t, got.UnmarshalBinary(b))
+	require.Equal(t, tlv, got)
+
+	b[5] = SecParamSequenceNo
+	err = got.UnmarshalBinary(b)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "delayed security processing")
+}
+
+func TestAuthenticatorSync(t *testing.T) {
+	a := testAuthenticator(t)
+	packet := &SyncDelayReq{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageSync, 0),
+			Version:         MajorVersion,
+			MessageLength:   44,
+			SequenceID:      116,
+		},
+	}
+	b := make([]byte, 128)
+	n, err := BytesTo(packet, b)
+	require.NoError(t, err)
+	require.ErrorIs(t, a.Verify(b[:n]), ErrAuthMissing)
+
+	signed, err := a.Append(b, n)
+	require.NoError(t, err)
+	require.Equal(t, n+a.Size(), signed)
+	require.Equal(t, uint16(44+a.Size()), binary.BigEndian.Uint16(b[2:]))
+	require.Equal(t, []byte{0, 0}, b[signed-2:signed])
+	require.NoError(t, a.Verify(b[:signed]))
+
+	// signed message still decodes
+	got := &SyncDelayReq{}
+	require.NoError(t, FromBytes(b[:signed], got))
+	require.Equal(t, uint16(116), got.SequenceID)
+
+	// correctionField is excluded from ICV
+	binary.BigEndian.PutUint64(b[8:], 12345)
+	require.NoError(t, a.Verify(b[:signed]))
+
+	b[30]++
+	require.ErrorIs(t, a.Verify(b[:signed]), ErrAuthICV)
+	b[30]--
+
+	other, err := NewAuthenticator(2, 2, []*AuthKey{{ID: 2, Key: []byte("new secret"), ICVLength: 16}})
+	require.NoError(t, err)
+	require.ErrorIs(t, other.Verify(b[:signed]), ErrAuthSPP)
+
+	other, err = NewAuthenticator(1, 1, []*AuthKey{{ID: 1, Key: []byte("old secret")}})
+	require.NoError(t, err)
+	require.ErrorIs(t, other.Verify(b[:signed]), ErrAuthKey)
+
+	n, err = BytesTo(packet, b)
+	require.NoError(t, err)
+	_, err = a.Append(b[:n], n)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not enough buffer")
+}
+
+func TestAuthenticatorSignaling(t *testing.T) {
+	a := testAuthenticator(t)
+	packet := &Signaling{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageSignaling, 0),
+			Version:         MajorVersion,
+			MessageLength:   54,
+		},
+		TLVs: []TLV{
+			&RequestUnicastTransmissionTLV{
+				TLVHead: TLVHead{
+					TLVType:     TLVRequestUnicastTransmission,
+					LengthField: 6,
+				},
+				MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(MessageSync, 0),
+				LogInterMessagePeriod: 1,
+				DurationField:         60,
+			},
+		},
+	}
+	b := make([]byte, 128)
+	n, err := BytesTo(packet, b)
+	require.NoError(t, err)
+	signed, err := a.Append(b, n)
+	require.NoError(t, err)
+	require.NoError(t, a.Verify(b[:signed]))
+
+	p, err := DecodePacket(b[:signed])
+	require.NoError(t, err)
+	got := p.(*Signaling)
+	require.Len(t, got.TLVs, 2)
+	require.Equal(t, TLVAuthentication, got.TLVs[1].Type())
+	auth := got.TLVs[1].(*AuthenticationTLV)
+	require.Equal(t, uint32(2), auth.KeyID)
+	require.Len(t, auth.ICV, 16)
+
+	// key rotation: messages signed with the old key are still accepted
+	a.SendKeyID = 1
+	n, err = BytesTo(packet, b)
+	require.NoError(t, err)
+	signed, err = a.Append(b, n)
+	require.NoError(t, err)
+	require.NoError(t, a.Verify(b[:signed]))
+}
@@ -0,0 +1,66 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+)
+
+// Fixed-size fields are written through the helpers below. Network byte order
+// is spelled out in one place, and every helper converts its destination
+// into an array pointer first: that is the only bounds check, after which
+// the compiler knows all offsets are in range and merges adjacent stores
+// into wide moves instead of checking and writing byte by byte.
+
+const (
+	timestampSize    = 10 // bytes
+	portIdentitySize = 10 // bytes
+)
+
+// byteOrder is the wire byte order of all PTP fields
+var byteOrder = binary.BigEndian
+
+// putTimestamp writes 48 bit seconds followed by 32 bit nanoseconds
+func putTimestamp(b []byte, t *Timestamp) {
+	d := (*[timestampSize]byte)(b)
+	copy(d[0:6], t.Seconds[:]) //uint48
+	byteOrder.PutUint32(d[6:10], t.Nanoseconds)
+}
+
+// putPortIdentity writes clock identity followed by port number
+func putPortIdentity(b []byte, p *PortIdentity) {
+	d := (*[portIdentitySize]byte)(b)
+	byteOrder.PutUint64(d[0:8], uint64(p.ClockIdentity))
+	byteOrder.PutUint16(d[8:10], p.PortNumber)
+}
+
+// putHeader writes the common message header
+func putHeader(b []byte, p *Header) {
+	d := (*[headerSize]byte)(b)
+	d[0] = byte(p.SdoIDAndMsgType)
+	d[1] = p.Version
+	byteOrder.PutUint16(d[2:4], p.MessageLength)
+	d[4] = p.DomainNumber
+	d[5] = p.MinorSdoID
+	byteOrder.PutUint16(d[6:8], p.FlagField)
+	byteOrder.PutUint64(d[8:16], uint64(p.CorrectionField))
+	byteOrder.PutUint32(d[16:20], p.MessageTypeSpecific)
+	putPortIdentity(d[20:30], &p.SourcePortIdentity)
+	byteOrder.PutUint16(d[30:32], p.SequenceID)
+	d[32] = p.ControlField
+	d[33] = byte(p.LogMessageInterval)
+}
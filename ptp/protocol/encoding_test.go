@@ -0,0 +1,116 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var benchHeader = Header{
+	SdoIDAndMsgType:     NewSdoIDAndMsgType(MessageDelayResp, 0),
+	Version:             MajorVersion,
+	MessageLength:       54,
+	DomainNumber:        0,
+	FlagField:           FlagUnicast,
+	CorrectionField:     NewCorrection(1.5),
+	MessageTypeSpecific: 0,
+	SourcePortIdentity: PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: 36138748164966842,
+	},
+	SequenceID:         10,
+	ControlField:       3,
+	LogMessageInterval: 0x7f,
+}
+
+func TestPutHeader(t *testing.T) {
+	b := make([]byte, headerSize)
+	putHeader(b, &benchHeader)
+
+	got := Header{}
+	unmarshalHeader(&got, b)
+	require.Equal(t, benchHeader, got)
+}
+
+func TestPutTimestamp(t *testing.T) {
+	ts := Timestamp{
+		Seconds:     [6]byte{0x0, 0x00, 0x45, 0xb1, 0x11, 0x5e},
+		Nanoseconds: 73257582,
+	}
+	b := make([]byte, timestampSize+1)
+	putTimestamp(b, &ts)
+	require.Equal(t, []byte{0x0, 0x0, 0x45, 0xb1, 0x11, 0x5e, 0x4, 0x5d, 0xd2, 0x6e, 0x0}, b)
+}
+
+func TestPutPortIdentity(t *testing.T) {
+	p := PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: 13283824497738493774,
+	}
+	b := make([]byte, portIdentitySize)
+	putPortIdentity(b, &p)
+	require.Equal(t, []byte{0xb8, 0x59, 0x9f, 0xff, 0xfe, 0x55, 0xaf, 0x4e, 0x0, 0x1}, b)
+}
+
+func TestPutShortBuffer(t *testing.T) {
+	require.Panics(t, func() { putHeader(make([]byte, headerSize-1), &benchHeader) })
+	require.Panics(t, func() { putTimestamp(make([]byte, timestampSize-1), &Timestamp{}) })
+	require.Panics(t, func() { putPortIdentity(make([]byte, portIdentitySize-1), &PortIdentity{}) })
+}
+
+func TestMarshalShortBuffer(t *testing.T) {
+	packets := []BinaryMarshalerTo{
+		&SyncDelayReq{Header: benchHeader},
+		&FollowUp{Header: benchHeader},
+		&DelayResp{Header: benchHeader},
+		&Announce{Header: benchHeader},
+		&Signaling{Header: benchHeader, TLVs: []TLV{&AcknowledgeCancelUnicastTransmissionTLV{}}},
+	}
+	for _, p := range packets {
+		_, err := p.MarshalBinaryTo(make([]byte, headerSize))
+		require.Error(t, err, "%T", p)
+	}
+}
+
+func BenchmarkPutHeader(b *testing.B) {
+	buf := make([]byte, headerSize)
+	for n := 0; n < b.N; n++ {
+		putHeader(buf, &benchHeader)
+	}
+}
+
+func BenchmarkWriteDelayResp(b *testing.B) {
+	p := &DelayResp{
+		Header: benchHeader,
+		DelayRespBody: DelayRespBody{
+			ReceiveTimestamp: Timestamp{
+				Seconds:     [6]byte{0x0, 0x00, 0x45, 0xb1, 0x11, 0x5e},
+				Nanoseconds: 73257582,
+			},
+			RequestingPortIdentity: PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 13283824497738493774,
+			},
+		},
+	}
+	buf := make([]byte, 64)
+	for n := 0; n < b.N; n++ {
+		_, _ = BytesTo(p, buf)
+	}
+}
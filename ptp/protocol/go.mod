@@ -0,0 +1,17 @@
+module github.com/facebook/time/ptp/protocol
+
+go 1.18
+
+require (
+	github.com/facebook/time/hostendian v0.1.0
+	github.com/stretchr/testify v1.7.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0 // indirect
+)
+
+// hostendian is not published yet, resolve it to the tree until the tag is pushed
+replace github.com/facebook/time/hostendian v0.1.0 => ../../hostendian
@@ -0,0 +1,76 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+)
+
+// ExtensionOrganizationID is the organization ID of the ptp4u extension TLVs.
+// It is in the unassigned CID space, peers unaware of it ignore the TLVs
+var ExtensionOrganizationID = [3]byte{0xfa, 0xce, 0x00}
+
+// GrantHintSubType is the organization subtype of the grant hint TLV
+var GrantHintSubType = [3]byte{0x00, 0x00, 0x02}
+
+// Renewal strategies of the grant hint
+const (
+	// GrantHintFixed asks for the hinted duration right away
+	GrantHintFixed uint8 = 0
+	// GrantHintBackoff asks to double the granted duration on every renewal up to the hinted one
+	GrantHintBackoff uint8 = 1
+)
+
+// grantHintSize is the size of the data field: duration, strategy and a reserved byte keeping the length even
+const grantHintSize = 6
+
+// GrantHint is sent by the client along with REQUEST_UNICAST_TRANSMISSION TLVs
+// to hint the grant duration it would like, which the server may honor within its limits
+type GrantHint struct {
+	// Duration is the desired grant duration in seconds
+	Duration uint32
+	// Strategy of the renewals
+	Strategy uint8
+}
+
+// TLV returns the ORGANIZATION_EXTENSION TLV carrying the hint
+func (h GrantHint) TLV() *OrganizationExtensionTLV {
+	data := make([]byte, grantHintSize)
+	binary.BigEndian.PutUint32(data, h.Duration)
+	data[4] = h.Strategy
+	return &OrganizationExtensionTLV{
+		TLVHead: TLVHead{
+			TLVType:     TLVOrganizationExtension,
+			LengthField: uint16(6 + grantHintSize),
+		},
+		OrganizationID:      ExtensionOrganizationID,
+		OrganizationSubType: GrantHintSubType,
+		DataField:           data,
+	}
+}
+
+// FindGrantHint returns the grant hint among the TLVs of the message, if any
+func FindGrantHint(tlvs []TLV) (GrantHint, bool) {
+	for _, tlv := range tlvs {
+		o, ok := tlv.(*OrganizationExtensionTLV)
+		if !ok || o.OrganizationID != ExtensionOrganizationID || o.OrganizationSubType != GrantHintSubType || len(o.DataField) < grantHintSize {
+			continue
+		}
+		return GrantHint{Duration: binary.BigEndian.Uint32(o.DataField), Strategy: o.DataField[4]}, true
+	}
+	return GrantHint{}, false
+}
@@ -0,0 +1,43 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantHint(t *testing.T) {
+	hint := GrantHint{Duration: 3600, Strategy: GrantHintBackoff}
+	tlv := hint.TLV()
+	b := make([]byte, 64)
+	n, err := tlv.MarshalBinaryTo(b)
+	require.NoError(t, err)
+	require.Equal(t, tlvHeadSize+int(tlv.LengthField), n)
+
+	decoded := &OrganizationExtensionTLV{}
+	require.NoError(t, decoded.UnmarshalBinary(b[:n]))
+	got, ok := FindGrantHint([]TLV{&RequestUnicastTransmissionTLV{}, decoded})
+	require.True(t, ok)
+	require.Equal(t, hint, got)
+
+	_, ok = FindGrantHint([]TLV{&OrganizationExtensionTLV{OrganizationID: ExtensionOrganizationID, OrganizationSubType: [3]byte{0, 0, 1}}})
+	require.False(t, ok)
+	_, ok = FindGrantHint(nil)
+	require.False(t, ok)
+}
@@ -28,12 +28,15 @@ import (
 type MgmtClient struct {
 	Connection io.ReadWriter
 	Sequence   uint16
+	// DomainNumber of the requests. ptp4l ignores management messages of other domains
+	DomainNumber uint8
 }
 
 // SendPacket sends packet, incrementing sequence counter
 func (c *MgmtClient) SendPacket(packet *Management) error {
 	c.Sequence++
 	packet.SetSequence(c.Sequence)
+	packet.DomainNumber = c.DomainNumber
 	b, err := packet.MarshalBinary()
 	if err != nil {
 		return err
@@ -110,6 +113,34 @@ func (c *MgmtClient) CurrentDataSet() (*CurrentDataSetTLV, error) {
 	return tlv, nil
 }
 
+// TimePropertiesDataSet sends TIME_PROPERTIES_DATA_SET request and returns response
+func (c *MgmtClient) TimePropertiesDataSet() (*TimePropertiesDataSetTLV, error) {
+	req := TimePropertiesDataSetRequest()
+	p, err := c.Communicate(req)
+	if err != nil {
+		return nil, err
+	}
+	tlv, ok := p.TLV.(*TimePropertiesDataSetTLV)
+	if !ok {
+		return nil, fmt.Errorf("got unexpected management TLV %T, wanted %T", p.TLV, tlv)
+	}
+	return tlv, nil
+}
+
+// PortDataSet sends PORT_DATA_SET request and returns response
+func (c *MgmtClient) PortDataSet() (*PortDataSetTLV, error) {
+	req := PortDataSetRequest()
+	p, err := c.Communicate(req)
+	if err != nil {
+		return nil, err
+	}
+	tlv, ok := p.TLV.(*PortDataSetTLV)
+	if !ok {
+		return nil, fmt.Errorf("got unexpected management TLV %T, wanted %T", p.TLV, tlv)
+	}
+	return tlv, nil
+}
+
 // ClockAccuracy sends CLOCK_ACCURACY request and returns response
 func (c *MgmtClient) ClockAccuracy() (*ClockAccuracyTLV, error) {
 	req := ClockAccuracyRequest()
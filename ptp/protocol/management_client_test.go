@@ -170,6 +170,18 @@ func TestMgmtClientCommunicateOK(t *testing.T) {
 	require.Equal(t, conn.inputs[0], b)
 }
 
+func TestMgmtClientDomainNumber(t *testing.T) {
+	conn := newConn([]*bytes.Buffer{})
+	client := MgmtClient{Connection: conn, DomainNumber: 24}
+	req := CurrentDataSetRequest()
+	require.NoError(t, client.SendPacket(req))
+
+	require.Equal(t, 1, len(conn.inputs))
+	got, err := ProbeDomainNumber(conn.inputs[0])
+	require.NoError(t, err)
+	require.Equal(t, uint8(24), got)
+}
+
 func TestMgmtClientCurrentDataSet(t *testing.T) {
 	var err error
 	packet := &Management{
@@ -404,6 +416,119 @@ func TestMgmtClientClockAccuracy(t *testing.T) {
 	require.Equal(t, conn.inputs[0], b)
 }
 
+func TestMgmtClientTimePropertiesDataSet(t *testing.T) {
+	var err error
+	packet := &Management{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType:     NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:             MajorVersion,
+				MessageLength:       uint16(0x3a),
+				DomainNumber:        0,
+				MinorSdoID:          0,
+				FlagField:           0,
+				CorrectionField:     0,
+				MessageTypeSpecific: 0,
+				SourcePortIdentity: PortIdentity{
+					PortNumber:    0,
+					ClockIdentity: 5212879185253000328,
+				},
+				SequenceID:         1,
+				ControlField:       4,
+				LogMessageInterval: 0x7f,
+			},
+			TargetPortIdentity: PortIdentity{
+				PortNumber:    56428,
+				ClockIdentity: 0,
+			},
+			ActionField: RESPONSE,
+		},
+		TLV: &TimePropertiesDataSetTLV{
+			ManagementTLVHead: ManagementTLVHead{
+				TLVHead: TLVHead{
+					TLVType:     TLVManagement,
+					LengthField: 6,
+				},
+				ManagementID: IDTimePropertiesDataSet,
+			},
+			CurrentUTCOffset: 37,
+			Flags:            uint8(FlagCurrentUtcOffsetValid | FlagPTPTimescale),
+			TimeSource:       TimeSourceGNSS,
+		},
+	}
+	conn, client := prepareTestClient(t, packet)
+	got, err := client.TimePropertiesDataSet()
+	require.NoError(t, err)
+	require.Equal(t, packet.TLV, got)
+
+	// check that we received proper request
+	req := TimePropertiesDataSetRequest()
+	req.SetSequence(client.Sequence)
+	b, err := req.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(conn.inputs))
+	require.Equal(t, conn.inputs[0], b)
+}
+
+func TestMgmtClientPortDataSet(t *testing.T) {
+	var err error
+	packet := &Management{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType:     NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:             MajorVersion,
+				MessageLength:       uint16(0x50),
+				DomainNumber:        0,
+				MinorSdoID:          0,
+				FlagField:           0,
+				CorrectionField:     0,
+				MessageTypeSpecific: 0,
+				SourcePortIdentity: PortIdentity{
+					PortNumber:    0,
+					ClockIdentity: 5212879185253000328,
+				},
+				SequenceID:         1,
+				ControlField:       4,
+				LogMessageInterval: 0x7f,
+			},
+			TargetPortIdentity: PortIdentity{
+				PortNumber:    56428,
+				ClockIdentity: 0,
+			},
+			ActionField: RESPONSE,
+		},
+		TLV: &PortDataSetTLV{
+			ManagementTLVHead: ManagementTLVHead{
+				TLVHead: TLVHead{
+					TLVType:     TLVManagement,
+					LengthField: 28,
+				},
+				ManagementID: IDPortDataSet,
+			},
+			PortIdentity: PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 5212879185253000328,
+			},
+			PortState:              PortStateMaster,
+			AnnounceReceiptTimeout: 3,
+			DelayMechanism:         1,
+			VersionNumber:          2,
+		},
+	}
+	conn, client := prepareTestClient(t, packet)
+	got, err := client.PortDataSet()
+	require.NoError(t, err)
+	require.Equal(t, packet.TLV, got)
+
+	// check that we received proper request
+	req := PortDataSetRequest()
+	req.SetSequence(client.Sequence)
+	b, err := req.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(conn.inputs))
+	require.Equal(t, conn.inputs[0], b)
+}
+
 func TestMgmtClientTimeStatusNP(t *testing.T) {
 	var err error
 	packet := &Management{
@@ -82,6 +82,22 @@ var mgmtTLVDecoder = map[ManagementID]MgmtTLVDecoderFunc{
 		}
 		return tlv, nil
 	},
+	IDTimePropertiesDataSet: func(data []byte) (ManagementTLV, error) {
+		r := bytes.NewReader(data)
+		tlv := &TimePropertiesDataSetTLV{}
+		if err := binary.Read(r, binary.BigEndian, tlv); err != nil {
+			return nil, err
+		}
+		return tlv, nil
+	},
+	IDPortDataSet: func(data []byte) (ManagementTLV, error) {
+		r := bytes.NewReader(data)
+		tlv := &PortDataSetTLV{}
+		if err := binary.Read(r, binary.BigEndian, tlv); err != nil {
+			return nil, err
+		}
+		return tlv, nil
+	},
 	IDPortStatsNP: func(data []byte) (ManagementTLV, error) {
 		r := bytes.NewReader(data)
 		tlv := &PortStatsNPTLV{}
@@ -229,6 +245,32 @@ type ParentDataSetTLV struct {
 	GrandmasterIdentity                   ClockIdentity
 }
 
+// TimePropertiesDataSetTLV Spec Table 86 - TIME_PROPERTIES_DATA_SET management TLV data field
+type TimePropertiesDataSetTLV struct {
+	ManagementTLVHead
+
+	CurrentUTCOffset int16
+	// Flags is the second octet of the header flagField: leap61, leap59, currentUtcOffsetValid, ptpTimescale, timeTraceable, frequencyTraceable
+	Flags      uint8
+	TimeSource TimeSource
+}
+
+// PortDataSetTLV Spec Table 87 - PORT_DATA_SET management TLV data field
+type PortDataSetTLV struct {
+	ManagementTLVHead
+
+	PortIdentity            PortIdentity
+	PortState               PortState
+	LogMinDelayReqInterval  LogInterval
+	PeerMeanPathDelay       TimeInterval
+	LogAnnounceInterval     LogInterval
+	AnnounceReceiptTimeout  uint8
+	LogSyncInterval         LogInterval
+	DelayMechanism          uint8
+	LogMinPdelayReqInterval LogInterval
+	VersionNumber           uint8
+}
+
 // ClockAccuracyTLV is a TLV containing Clock Accuracy
 type ClockAccuracyTLV struct {
 	ManagementTLVHead
@@ -360,3 +402,65 @@ func ClockAccuracyRequest() *Management {
 		},
 	}
 }
+
+// TimePropertiesDataSetRequest prepares request packet for TIME_PROPERTIES_DATA_SET request
+func TimePropertiesDataSetRequest() *Management {
+	headerSize := uint16(binary.Size(ManagementMsgHead{}))
+	size := uint16(binary.Size(TimePropertiesDataSetTLV{}))
+	tlvHeadSize := uint16(binary.Size(TLVHead{}))
+	return &Management{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:            Version,
+				MessageLength:      headerSize + size,
+				SourcePortIdentity: identity,
+				LogMessageInterval: MgmtLogMessageInterval,
+			},
+			TargetPortIdentity:   DefaultTargetPortIdentity,
+			StartingBoundaryHops: 0,
+			BoundaryHops:         0,
+			ActionField:          GET,
+		},
+		TLV: &TimePropertiesDataSetTLV{
+			ManagementTLVHead: ManagementTLVHead{
+				TLVHead: TLVHead{
+					TLVType:     TLVManagement,
+					LengthField: size - tlvHeadSize,
+				},
+				ManagementID: IDTimePropertiesDataSet,
+			},
+		},
+	}
+}
+
+// PortDataSetRequest prepares request packet for PORT_DATA_SET request
+func PortDataSetRequest() *Management {
+	headerSize := uint16(binary.Size(ManagementMsgHead{}))
+	size := uint16(binary.Size(PortDataSetTLV{}))
+	tlvHeadSize := uint16(binary.Size(TLVHead{}))
+	return &Management{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType:    NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:            Version,
+				MessageLength:      headerSize + size,
+				SourcePortIdentity: identity,
+				LogMessageInterval: MgmtLogMessageInterval,
+			},
+			TargetPortIdentity:   DefaultTargetPortIdentity,
+			StartingBoundaryHops: 0,
+			BoundaryHops:         0,
+			ActionField:          GET,
+		},
+		TLV: &PortDataSetTLV{
+			ManagementTLVHead: ManagementTLVHead{
+				TLVHead: TLVHead{
+					TLVType:     TLVManagement,
+					LengthField: size - tlvHeadSize,
+				},
+				ManagementID: IDPortDataSet,
+			},
+		},
+	}
+}
@@ -243,3 +243,95 @@ func TestParseClockAccuracy(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, raw, b)
 }
+
+func TestParseTimePropertiesDataSet(t *testing.T) {
+	raw := []uint8("\x0d\x12\x00\x3a\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x48\x57\xdd\xff\xfe\x0e\x91\xda\x00\x00\x00\x00\x04\x7f\x00\x00\x00\x00\x00\x00\x00\x00\xc4\xbf\x00\x00\x02\x00\x00\x01\x00\x06\x20\x03\x00\x25\x38\x20\x00\x00")
+	packet := new(Management)
+	err := FromBytes(raw, packet)
+	require.Nil(t, err)
+	want := Management{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType: NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:         Version,
+				MessageLength:   uint16(len(raw) - 2),
+				SourcePortIdentity: PortIdentity{
+					PortNumber:    0,
+					ClockIdentity: 5212879185253405146,
+				},
+				ControlField:       4,
+				LogMessageInterval: 0x7f,
+			},
+			TargetPortIdentity: PortIdentity{
+				PortNumber:    50367,
+				ClockIdentity: 0,
+			},
+			ActionField: RESPONSE,
+		},
+		TLV: &TimePropertiesDataSetTLV{
+			ManagementTLVHead: ManagementTLVHead{
+				TLVHead: TLVHead{
+					TLVType:     TLVManagement,
+					LengthField: 6,
+				},
+				ManagementID: IDTimePropertiesDataSet,
+			},
+			CurrentUTCOffset: 37,
+			Flags:            uint8(FlagPTPTimescale | FlagTimeTraceable | FlagFrequencyTraceable),
+			TimeSource:       TimeSourceGNSS,
+		},
+	}
+	require.Equal(t, want, *packet)
+	b, err := Bytes(packet)
+	require.Nil(t, err)
+	assert.Equal(t, raw, b)
+}
+
+func TestParsePortDataSet(t *testing.T) {
+	raw := []uint8("\x0d\x12\x00\x50\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x48\x57\xdd\xff\xfe\x0e\x91\xda\x00\x00\x00\x00\x04\x7f\x00\x00\x00\x00\x00\x00\x00\x00\xc4\xbf\x00\x00\x02\x00\x00\x01\x00\x1c\x20\x04\x48\x57\xdd\xff\xfe\x0e\x91\xda\x00\x01\x06\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x03\x00\x01\x00\x02\x00\x00")
+	packet := new(Management)
+	err := FromBytes(raw, packet)
+	require.Nil(t, err)
+	want := Management{
+		ManagementMsgHead: ManagementMsgHead{
+			Header: Header{
+				SdoIDAndMsgType: NewSdoIDAndMsgType(MessageManagement, 0),
+				Version:         Version,
+				MessageLength:   uint16(len(raw) - 2),
+				SourcePortIdentity: PortIdentity{
+					PortNumber:    0,
+					ClockIdentity: 5212879185253405146,
+				},
+				ControlField:       4,
+				LogMessageInterval: 0x7f,
+			},
+			TargetPortIdentity: PortIdentity{
+				PortNumber:    50367,
+				ClockIdentity: 0,
+			},
+			ActionField: RESPONSE,
+		},
+		TLV: &PortDataSetTLV{
+			ManagementTLVHead: ManagementTLVHead{
+				TLVHead: TLVHead{
+					TLVType:     TLVManagement,
+					LengthField: 28,
+				},
+				ManagementID: IDPortDataSet,
+			},
+			PortIdentity: PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 5212879185253405146,
+			},
+			PortState:              PortStateMaster,
+			LogAnnounceInterval:    1,
+			AnnounceReceiptTimeout: 3,
+			DelayMechanism:         1,
+			VersionNumber:          2,
+		},
+	}
+	require.Equal(t, want, *packet)
+	b, err := Bytes(packet)
+	require.Nil(t, err)
+	assert.Equal(t, raw, b)
+}
@@ -111,19 +111,7 @@ func checkPacketLength(p *Header, l int) error {
 // headerMarshalBinaryTo is not a Header.MarshalBinaryTo to prevent all packets
 // from having default (and incomplete) MarshalBinaryTo implementation through embedding
 func headerMarshalBinaryTo(p *Header, b []byte) int {
-	b[0] = byte(p.SdoIDAndMsgType)
-	b[1] = p.Version
-	binary.BigEndian.PutUint16(b[2:], p.MessageLength)
-	b[4] = p.DomainNumber
-	b[5] = p.MinorSdoID
-	binary.BigEndian.PutUint16(b[6:], p.FlagField)
-	binary.BigEndian.PutUint64(b[8:], uint64(p.CorrectionField))
-	binary.BigEndian.PutUint32(b[16:], p.MessageTypeSpecific)
-	binary.BigEndian.PutUint64(b[20:], uint64(p.SourcePortIdentity.ClockIdentity))
-	binary.BigEndian.PutUint16(b[28:], p.SourcePortIdentity.PortNumber)
-	binary.BigEndian.PutUint16(b[30:], p.SequenceID)
-	b[32] = p.ControlField
-	b[33] = byte(p.LogMessageInterval)
+	putHeader(b, p)
 	return headerSize
 }
 
@@ -176,18 +164,18 @@ func (p *Announce) MarshalBinaryTo(b []byte) (int, error) {
 		return 0, fmt.Errorf("not enough buffer to write Announce")
 	}
 	n := headerMarshalBinaryTo(&p.Header, b)
-	copy(b[n:], p.OriginTimestamp.Seconds[:]) //uint48
-	binary.BigEndian.PutUint32(b[n+6:], p.OriginTimestamp.Nanoseconds)
-	binary.BigEndian.PutUint16(b[n+10:], uint16(p.CurrentUTCOffset))
-	b[n+12] = p.Reserved
-	b[n+13] = p.GrandmasterPriority1
-	b[n+14] = byte(p.GrandmasterClockQuality.ClockClass)
-	b[n+15] = byte(p.GrandmasterClockQuality.ClockAccuracy)
-	binary.BigEndian.PutUint16(b[n+16:], p.GrandmasterClockQuality.OffsetScaledLogVariance)
-	b[n+18] = p.GrandmasterPriority2
-	binary.BigEndian.PutUint64(b[n+19:], uint64(p.GrandmasterIdentity))
-	binary.BigEndian.PutUint16(b[n+27:], p.StepsRemoved)
-	b[n+29] = byte(p.TimeSource)
+	d := (*[30]byte)(b[n:])
+	putTimestamp(d[0:10], &p.OriginTimestamp)
+	byteOrder.PutUint16(d[10:12], uint16(p.CurrentUTCOffset))
+	d[12] = p.Reserved
+	d[13] = p.GrandmasterPriority1
+	d[14] = byte(p.GrandmasterClockQuality.ClockClass)
+	d[15] = byte(p.GrandmasterClockQuality.ClockAccuracy)
+	byteOrder.PutUint16(d[16:18], p.GrandmasterClockQuality.OffsetScaledLogVariance)
+	d[18] = p.GrandmasterPriority2
+	byteOrder.PutUint64(d[19:27], uint64(p.GrandmasterIdentity))
+	byteOrder.PutUint16(d[27:29], p.StepsRemoved)
+	d[29] = byte(p.TimeSource)
 	// marshal TLVs if present
 	pos := n + 30
 	tlvLen, err := writeTLVs(p.TLVs, b[pos:])
@@ -250,9 +238,8 @@ func (p *SyncDelayReq) MarshalBinaryTo(b []byte) (int, error) {
 		return 0, fmt.Errorf("not enough buffer to write SyncDelayReq")
 	}
 	n := headerMarshalBinaryTo(&p.Header, b)
-	copy(b[n:], p.OriginTimestamp.Seconds[:]) //uint48
-	binary.BigEndian.PutUint32(b[n+6:], p.OriginTimestamp.Nanoseconds)
-	return n + 10, nil
+	putTimestamp(b[n:], &p.OriginTimestamp)
+	return n + timestampSize, nil
 }
 
 // MarshalBinary converts packet to []bytes
@@ -293,9 +280,8 @@ func (p *FollowUp) MarshalBinaryTo(b []byte) (int, error) {
 		return 0, fmt.Errorf("not enough buffer to write FollowUp")
 	}
 	n := headerMarshalBinaryTo(&p.Header, b)
-	copy(b[n:], p.PreciseOriginTimestamp.Seconds[:]) //uint48
-	binary.BigEndian.PutUint32(b[n+6:], p.PreciseOriginTimestamp.Nanoseconds)
-	return n + 10, nil
+	putTimestamp(b[n:], &p.PreciseOriginTimestamp)
+	return n + timestampSize, nil
 }
 
 // MarshalBinary converts packet to []bytes
@@ -337,11 +323,9 @@ func (p *DelayResp) MarshalBinaryTo(b []byte) (int, error) {
 		return 0, fmt.Errorf("not enough buffer to write DelayResp")
 	}
 	n := headerMarshalBinaryTo(&p.Header, b)
-	copy(b[n:], p.ReceiveTimestamp.Seconds[:]) //uint48
-	binary.BigEndian.PutUint32(b[n+6:], p.ReceiveTimestamp.Nanoseconds)
-	binary.BigEndian.PutUint64(b[n+10:], uint64(p.RequestingPortIdentity.ClockIdentity))
-	binary.BigEndian.PutUint16(b[n+18:], p.RequestingPortIdentity.PortNumber)
-	return n + 20, nil
+	putTimestamp(b[n:], &p.ReceiveTimestamp)
+	putPortIdentity(b[n+timestampSize:], &p.RequestingPortIdentity)
+	return n + timestampSize + portIdentitySize, nil
 }
 
 // MarshalBinary converts packet to []bytes
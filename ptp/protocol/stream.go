@@ -0,0 +1,58 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// PTP messages carried over stream transports (TCP, TLS) have no datagram boundaries,
+// so every message is prefixed with its length as 2 bytes in network byte order.
+// This framing is not part of IEEE 1588 and is only meant for monitoring-grade measurements.
+
+// streamLenSize is the size of the frame length prefix
+const streamLenSize = 2
+
+// WriteStreamPacket writes a single length-prefixed PTP message to w
+func WriteStreamPacket(w io.Writer, b []byte) error {
+	if len(b) > 0xffff {
+		return fmt.Errorf("message of length %d doesn't fit into a stream frame", len(b))
+	}
+	frame := make([]byte, streamLenSize+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[streamLenSize:], b)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadStreamPacket reads a single length-prefixed PTP message from r into buf
+func ReadStreamPacket(r io.Reader, buf []byte) (int, error) {
+	var l [streamLenSize]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(l[:]))
+	if n > len(buf) {
+		return 0, fmt.Errorf("cannot read stream frame of length %d into %d bytes", n, len(buf))
+	}
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamPacketRoundTrip(t *testing.T) {
+	var stream bytes.Buffer
+	first := []byte{1, 2, 3}
+	second := []byte{4, 5}
+	require.NoError(t, WriteStreamPacket(&stream, first))
+	require.NoError(t, WriteStreamPacket(&stream, second))
+
+	buf := make([]byte, 16)
+	n, err := ReadStreamPacket(&stream, buf)
+	require.NoError(t, err)
+	require.Equal(t, first, buf[:n])
+	n, err = ReadStreamPacket(&stream, buf)
+	require.NoError(t, err)
+	require.Equal(t, second, buf[:n])
+}
+
+func TestStreamPacketTooLong(t *testing.T) {
+	var stream bytes.Buffer
+	require.Error(t, WriteStreamPacket(&stream, make([]byte, 0x10000)))
+
+	require.NoError(t, WriteStreamPacket(&stream, make([]byte, 10)))
+	_, err := ReadStreamPacket(&stream, make([]byte, 5))
+	require.Error(t, err)
+}
+
+func TestStreamPacketTruncated(t *testing.T) {
+	stream := bytes.NewReader([]byte{0, 4, 1, 2})
+	_, err := ReadStreamPacket(stream, make([]byte, 16))
+	require.Error(t, err)
+}
@@ -146,6 +146,20 @@ func readTLVs(tlvs []TLV, maxLength int, b []byte) ([]TLV, error) {
 			}
 			tlvs = append(tlvs, tlv)
 			pos += tlvHeadSize + int(tlv.LengthField)
+		case TLVOrganizationExtension:
+			tlv := &OrganizationExtensionTLV{}
+			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
+				return tlvs, err
+			}
+			tlvs = append(tlvs, tlv)
+			pos += tlvHeadSize + int(tlv.LengthField)
+		case TLVAuthentication:
+			tlv := &AuthenticationTLV{}
+			if err := tlv.UnmarshalBinary(b[pos:]); err != nil {
+				return tlvs, err
+			}
+			tlvs = append(tlvs, tlv)
+			pos += tlvHeadSize + int(tlv.LengthField)
 		default:
 			return tlvs, fmt.Errorf("reading TLV %s (%d) is not yet implemented", tlvType, tlvType)
 		}
@@ -365,3 +379,66 @@ func (t *AlternateTimeOffsetIndicatorTLV) UnmarshalBinary(b []byte) error {
 	}
 	return nil
 }
+
+// OrganizationExtensionTLV is a Table 53 ORGANIZATION_EXTENSION TLV format
+type OrganizationExtensionTLV struct {
+	TLVHead
+	OrganizationID      [3]byte
+	OrganizationSubType [3]byte
+	// The length of DataField shall keep the lengthField even
+	DataField []byte
+}
+
+// MarshalBinaryTo marshals bytes to OrganizationExtensionTLV
+func (t *OrganizationExtensionTLV) MarshalBinaryTo(b []byte) (int, error) {
+	size := tlvHeadSize + 6 + len(t.DataField)
+	if len(b) < size {
+		return 0, fmt.Errorf("not enough buffer to write OrganizationExtensionTLV")
+	}
+	tlvHeadMarshalBinaryTo(&t.TLVHead, b)
+	copy(b[tlvHeadSize:], t.OrganizationID[:])
+	copy(b[tlvHeadSize+3:], t.OrganizationSubType[:])
+	copy(b[tlvHeadSize+6:], t.DataField)
+	return size, nil
+}
+
+// UnmarshalBinary parses []byte and populates struct fields
+func (t *OrganizationExtensionTLV) UnmarshalBinary(b []byte) error {
+	if err := unmarshalTLVHeader(&t.TLVHead, b); err != nil {
+		return err
+	}
+	if err := checkTLVLength(&t.TLVHead, len(b), 6, false); err != nil {
+		return err
+	}
+	copy(t.OrganizationID[:], b[tlvHeadSize:])
+	copy(t.OrganizationSubType[:], b[tlvHeadSize+3:])
+	t.DataField = make([]byte, int(t.LengthField)-6)
+	copy(t.DataField, b[tlvHeadSize+6:])
+	return nil
+}
+
+// AppendTLV appends the TLV to the message of n bytes serialized into b and updates its messageLength.
+// Zero padding added by BytesTo after the message is preserved. Returns the new number of bytes
+func AppendTLV(b []byte, n int, tlv BinaryMarshalerTo) (int, error) {
+	if n < headerSize || len(b) < headerSize {
+		return 0, fmt.Errorf("not enough data to decode PTP header")
+	}
+	msgLen := int(binary.BigEndian.Uint16(b[2:]))
+	if msgLen > n {
+		return 0, fmt.Errorf("message length %d is larger than %d bytes", msgLen, n)
+	}
+	pad := n - msgLen
+	size, err := tlv.MarshalBinaryTo(b[msgLen:])
+	if err != nil {
+		return 0, err
+	}
+	total := msgLen + size
+	if total+pad > len(b) {
+		return 0, fmt.Errorf("not enough buffer to append TLV")
+	}
+	binary.BigEndian.PutUint16(b[2:], uint16(total))
+	for i := total; i < total+pad; i++ {
+		b[i] = 0
+	}
+	return total + pad, nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package protocol
 
 import (
+	"encoding/binary"
 	"testing"
 	"time"
 
@@ -149,3 +150,73 @@ func TestParseAnnounceWithAlternateTimeOffsetIndicator(t *testing.T) {
 	require.Nil(t, err)
 	assert.Equal(t, &want, pp)
 }
+
+func TestOrganizationExtensionTLV(t *testing.T) {
+	tlv := &OrganizationExtensionTLV{
+		TLVHead: TLVHead{
+			TLVType:     TLVOrganizationExtension,
+			LengthField: 8,
+		},
+		OrganizationID:      [3]byte{0xfa, 0xce, 0x00},
+		OrganizationSubType: [3]byte{0x00, 0x00, 0x01},
+		DataField:           []byte{0x01, 0x00},
+	}
+	b := make([]byte, 12)
+	n, err := tlv.MarshalBinaryTo(b)
+	require.Nil(t, err)
+	require.Equal(t, 12, n)
+	require.Equal(t, []byte{0x00, 0x03, 0x00, 0x08, 0xfa, 0xce, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00}, b)
+
+	got := &OrganizationExtensionTLV{}
+	require.Nil(t, got.UnmarshalBinary(b))
+	require.Equal(t, tlv, got)
+
+	_, err = tlv.MarshalBinaryTo(make([]byte, 11))
+	require.Error(t, err)
+}
+
+func TestAppendTLV(t *testing.T) {
+	p := &FollowUp{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageFollowUp, 0),
+			Version:         Version,
+			MessageLength:   44,
+			SequenceID:      42,
+		},
+		FollowUpBody: FollowUpBody{
+			PreciseOriginTimestamp: NewTimestamp(time.Unix(1656946102, 0)),
+		},
+	}
+	tlv := &OrganizationExtensionTLV{
+		TLVHead: TLVHead{
+			TLVType:     TLVOrganizationExtension,
+			LengthField: 8,
+		},
+		OrganizationID:      [3]byte{0xfa, 0xce, 0x00},
+		OrganizationSubType: [3]byte{0x00, 0x00, 0x01},
+		DataField:           []byte{0x01, 0x00},
+	}
+	buf := make([]byte, 128)
+	n, err := BytesTo(p, buf)
+	require.Nil(t, err)
+	n, err = AppendTLV(buf, n, tlv)
+	require.Nil(t, err)
+	require.Equal(t, 44+12+2, n)
+	require.Equal(t, uint16(56), binary.BigEndian.Uint16(buf[2:]))
+	require.Equal(t, []byte{0, 0}, buf[56:58])
+
+	got := &FollowUp{}
+	require.Nil(t, got.UnmarshalBinary(buf[:n]))
+	require.Equal(t, p.PreciseOriginTimestamp, got.PreciseOriginTimestamp)
+	tlvs, err := readTLVs(nil, n-2-44, buf[44:])
+	require.Nil(t, err)
+	require.Equal(t, []TLV{tlv}, tlvs)
+
+	_, err = AppendTLV(buf, 46, tlv)
+	require.Error(t, err)
+	short := make([]byte, 50)
+	n, err = BytesTo(p, short)
+	require.Nil(t, err)
+	_, err = AppendTLV(short, n, tlv)
+	require.Error(t, err)
+}
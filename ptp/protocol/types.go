@@ -84,6 +84,14 @@ func ProbeMsgType(data []byte) (msg MessageType, err error) {
 	return SdoIDAndMsgType(data[0]).MsgType(), nil
 }
 
+// ProbeDomainNumber reads the domain number of the header without decoding the message
+func ProbeDomainNumber(data []byte) (uint8, error) {
+	if len(data) < 5 {
+		return 0, fmt.Errorf("not enough data to probe DomainNumber")
+	}
+	return data[4], nil
+}
+
 // TLVType is type for TLV types
 type TLVType uint16
 
@@ -98,7 +106,8 @@ const (
 	TLVAcknowledgeCancelUnicastTransmission TLVType = 0x0007
 	TLVPathTrace                            TLVType = 0x0008
 	TLVAlternateTimeOffsetIndicator         TLVType = 0x0009
-	// Remaining 52 tlvType TLVs not implemented
+	TLVAuthentication                       TLVType = 0x8009
+	// Remaining 51 tlvType TLVs not implemented
 )
 
 // TLVTypeToString is a map from TLVType to string
@@ -112,6 +121,7 @@ var TLVTypeToString = map[TLVType]string{
 	TLVAcknowledgeCancelUnicastTransmission: "ACKNOWLEDGE_CANCEL_UNICAST_TRANSMISSION",
 	TLVPathTrace:                            "PATH_TRACE",
 	TLVAlternateTimeOffsetIndicator:         "ALTERNATE_TIME_OFFSET_INDICATOR",
+	TLVAuthentication:                       "AUTHENTICATION",
 }
 
 func (t TLVType) String() string {
@@ -372,6 +382,7 @@ const (
 	ClockClass14        ClockClass = 14
 	ClockClass52        ClockClass = 52
 	ClockClass58        ClockClass = 58
+	ClockClass187       ClockClass = 187
 	ClockClassSlaveOnly ClockClass = 255
 )
 
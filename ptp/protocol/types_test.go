@@ -68,6 +68,15 @@ func TestProbeMsgType(t *testing.T) {
 	}
 }
 
+func TestProbeDomainNumber(t *testing.T) {
+	_, err := ProbeDomainNumber([]byte{0x0, 0x2, 0x0, 0x2c})
+	require.Error(t, err)
+
+	got, err := ProbeDomainNumber([]byte{0x0, 0x2, 0x0, 0x2c, 24})
+	require.NoError(t, err)
+	require.Equal(t, uint8(24), got)
+}
+
 func TestMessageTypeString(t *testing.T) {
 	require.Equal(t, "SYNC", MessageSync.String())
 	require.Equal(t, "DELAY_REQ", MessageDelayReq.String())
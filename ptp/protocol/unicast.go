@@ -19,6 +19,7 @@ package protocol
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 )
 
 // UnicastMsgTypeAndFlags is a uint8 where first 4 bites contain MessageType and last 4 bits contain some flags
@@ -41,15 +42,52 @@ type Signaling struct {
 	TLVs               []TLV
 }
 
+// signalingBodySize is the size of the Signaling message without TLVs
+const signalingBodySize = headerSize + 10
+
+// SplitSignaling splits the Signaling message into as few messages of at most maxSize bytes as possible.
+// TLVs keep their order, headers are copied and message lengths updated.
+// It fails if a single TLV doesn't fit
+func SplitSignaling(p *Signaling, maxSize int) ([]*Signaling, error) {
+	if len(p.TLVs) == 0 {
+		return nil, fmt.Errorf("no TLVs in Signaling message, at least one required")
+	}
+	// the largest TLV length field can describe
+	buf := make([]byte, tlvHeadSize+math.MaxUint16)
+	parts := []*Signaling{}
+	var part *Signaling
+	size := 0
+	for _, tlv := range p.TLVs {
+		n, err := writeTLVs([]TLV{tlv}, buf)
+		if err != nil {
+			return nil, err
+		}
+		if signalingBodySize+n > maxSize {
+			return nil, fmt.Errorf("%s TLV of %d bytes doesn't fit into %d bytes", tlv.Type(), n, maxSize)
+		}
+		if part == nil || size+n > maxSize {
+			part = &Signaling{Header: p.Header, TargetPortIdentity: p.TargetPortIdentity}
+			parts = append(parts, part)
+			size = signalingBodySize
+		}
+		part.TLVs = append(part.TLVs, tlv)
+		size += n
+		part.MessageLength = uint16(size)
+	}
+	return parts, nil
+}
+
 // MarshalBinaryTo marshals bytes to Signaling
 func (p *Signaling) MarshalBinaryTo(b []byte) (int, error) {
 	if len(p.TLVs) == 0 {
 		return 0, fmt.Errorf("no TLVs in Signaling message, at least one required")
 	}
+	if len(b) < headerSize+portIdentitySize {
+		return 0, fmt.Errorf("not enough buffer to write Signaling")
+	}
 	n := headerMarshalBinaryTo(&p.Header, b)
-	binary.BigEndian.PutUint64(b[n:], uint64(p.TargetPortIdentity.ClockIdentity))
-	binary.BigEndian.PutUint16(b[n+8:], p.TargetPortIdentity.PortNumber)
-	pos := n + 10
+	putPortIdentity(b[n:], &p.TargetPortIdentity)
+	pos := n + portIdentitySize
 	tlvLen, err := writeTLVs(p.TLVs, b[pos:])
 	return pos + tlvLen, err
 }
@@ -392,3 +392,50 @@ func BenchmarkReadSignaling(b *testing.B) {
 		_ = p.UnmarshalBinary(raw)
 	}
 }
+
+func TestSplitSignaling(t *testing.T) {
+	grant := func(mt MessageType) TLV {
+		return &GrantUnicastTransmissionTLV{
+			TLVHead:               TLVHead{TLVType: TLVGrantUnicastTransmission, LengthField: 8},
+			MsgTypeAndReserved:    NewUnicastMsgTypeAndFlags(mt, 0),
+			LogInterMessagePeriod: 1,
+			DurationField:         60,
+			Renewal:               1,
+		}
+	}
+	sg := &Signaling{
+		Header: Header{
+			SdoIDAndMsgType: NewSdoIDAndMsgType(MessageSignaling, 0),
+			Version:         2,
+			SequenceID:      42,
+		},
+		TargetPortIdentity: PortIdentity{PortNumber: 1, ClockIdentity: 1234},
+		TLVs:               []TLV{grant(MessageAnnounce), grant(MessageSync), grant(MessageDelayResp)},
+	}
+
+	// room for two grants per message
+	parts, err := SplitSignaling(sg, signalingBodySize+24)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	require.Equal(t, sg.TLVs[:2], parts[0].TLVs)
+	require.Equal(t, sg.TLVs[2:], parts[1].TLVs)
+	buf := make([]byte, 508)
+	for _, p := range parts {
+		require.Equal(t, sg.SequenceID, p.SequenceID)
+		require.Equal(t, sg.TargetPortIdentity, p.TargetPortIdentity)
+		n, err := p.MarshalBinaryTo(buf)
+		require.NoError(t, err)
+		require.Equal(t, int(p.MessageLength), n)
+	}
+
+	parts, err = SplitSignaling(sg, 1500)
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	require.Equal(t, sg.TLVs, parts[0].TLVs)
+
+	_, err = SplitSignaling(sg, signalingBodySize+4)
+	require.Error(t, err)
+
+	_, err = SplitSignaling(&Signaling{}, 1500)
+	require.Error(t, err)
+}
@@ -43,3 +43,14 @@ func TestUndrain(t *testing.T) {
 	os.Remove(file.Name())
 	require.False(t, Undrain(file.Name()))
 }
+
+func TestManualDrain(t *testing.T) {
+	check := &ManualDrain{}
+	require.False(t, check.Check())
+
+	check.Set(true)
+	require.True(t, check.Check())
+
+	check.Set(false)
+	require.False(t, check.Check())
+}
@@ -0,0 +1,40 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drain
+
+import (
+	"sync/atomic"
+)
+
+// ManualDrain implements the check interface for drains requested by an operator
+type ManualDrain struct {
+	engaged int32
+}
+
+// Set engages or releases the drain
+func (m *ManualDrain) Set(engaged bool) {
+	var v int32
+	if engaged {
+		v = 1
+	}
+	atomic.StoreInt32(&m.engaged, v)
+}
+
+// Check returns true if the drain was requested
+func (m *ManualDrain) Check() bool {
+	return atomic.LoadInt32(&m.engaged) == 1
+}
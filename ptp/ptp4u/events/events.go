@@ -0,0 +1,180 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package events implements export of significant ptp4u events
+such as clock quality changes and alarms to a webhook
+and an in-memory timeline.
+*/
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event types
+const (
+	// TypeClockQuality is emitted when announced clock class or accuracy changes
+	TypeClockQuality = "clock_quality"
+	// TypeAlarm is emitted when an alarm is raised or cleared
+	TypeAlarm = "alarm"
+	// TypeSubscriptions is a summary of the subscription churn over the metric interval
+	TypeSubscriptions = "subscriptions"
+	// TypeLifecycle is emitted when the server starts or shuts down
+	TypeLifecycle = "lifecycle"
+	// TypeConfig is emitted when the dynamic config is applied or rolled back
+	TypeConfig = "config"
+	// TypeDrain is emitted when the server is drained or undrained
+	TypeDrain = "drain"
+	// TypeWorker is emitted when a send worker stops
+	TypeWorker = "worker"
+)
+
+const (
+	queueSize      = 1024
+	minBackoff     = time.Second
+	maxBackoff     = time.Minute
+	requestTimeout = 10 * time.Second
+)
+
+// Event is a significant event of the server
+type Event struct {
+	Time    time.Time        `json:"time"`
+	Type    string           `json:"type"`
+	Message string           `json:"message"`
+	Fields  map[string]int64 `json:"fields,omitempty"`
+}
+
+// Webhook publishes batches of events as JSON arrays via HTTP POST
+type Webhook struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	client        *http.Client
+	queue         chan *Event
+	dropped       int64
+	// minBackoff is the first retry delay of the failed batch
+	minBackoff time.Duration
+}
+
+// NewWebhook returns a webhook publisher sending up to batchSize events at least every flushInterval
+func NewWebhook(url string, batchSize int, flushInterval time.Duration) *Webhook {
+	return &Webhook{
+		url:           url,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		client:        &http.Client{Timeout: requestTimeout},
+		queue:         make(chan *Event, queueSize),
+		minBackoff:    minBackoff,
+	}
+}
+
+// Publish queues the event. Events are dropped if the queue is full
+func (w *Webhook) Publish(e *Event) {
+	if w == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case w.queue <- e:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+}
+
+// Dropped returns the number of events dropped because of the full queue
+func (w *Webhook) Dropped() int64 {
+	if w == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// Run sends the queued events until ctx is done.
+// Failed batches are retried with exponential backoff while new events keep queueing
+func (w *Webhook) Run(ctx context.Context) {
+	batch := []*Event{}
+	backoff := w.minBackoff
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-w.queue:
+			// Keep the pending batch bounded during long outages
+			if len(batch) >= queueSize {
+				batch = batch[1:]
+				atomic.AddInt64(&w.dropped, 1)
+			}
+			batch = append(batch, e)
+			if len(batch) < w.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := w.send(ctx, batch); err != nil {
+			log.Warningf("Failed to publish %d events: %v. Retrying in %v", len(batch), err, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = w.minBackoff
+		batch = batch[:0]
+	}
+}
+
+func (w *Webhook) send(ctx context.Context, batch []*Event) error {
+	b, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type collector struct {
+	sync.Mutex
+	fail    int
+	batches [][]*Event
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+	if c.fail > 0 {
+		c.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	batch := []*Event{}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.batches = append(c.batches, batch)
+}
+
+func (c *collector) events() int {
+	c.Lock()
+	defer c.Unlock()
+	n := 0
+	for _, b := range c.batches {
+		n += len(b)
+	}
+	return n
+}
+
+// run runs the webhook in the background. The returned function stops it and waits for it to return
+func run(w *Webhook) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestWebhookBatching(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	w := NewWebhook(srv.URL, 2, time.Hour)
+	defer run(w)()
+
+	w.Publish(&Event{Type: TypeAlarm, Message: "ntp", Fields: map[string]int64{"alarm": 1}})
+	w.Publish(&Event{Type: TypeClockQuality, Message: "changed"})
+	require.Eventually(t, func() bool { return c.events() == 2 }, time.Second, time.Millisecond)
+
+	c.Lock()
+	require.Equal(t, 1, len(c.batches))
+	require.Equal(t, TypeAlarm, c.batches[0][0].Type)
+	require.Equal(t, int64(1), c.batches[0][0].Fields["alarm"])
+	require.False(t, c.batches[0][0].Time.IsZero())
+	c.Unlock()
+}
+
+func TestWebhookFlushAndRetry(t *testing.T) {
+	c := &collector{fail: 2}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	w := NewWebhook(srv.URL, 100, 10*time.Millisecond)
+	w.minBackoff = time.Millisecond
+	defer run(w)()
+
+	w.Publish(&Event{Type: TypeSubscriptions, Message: "summary"})
+	require.Eventually(t, func() bool { return c.events() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestWebhookDrop(t *testing.T) {
+	w := NewWebhook("http://localhost", 1, time.Hour)
+	for i := 0; i < queueSize+3; i++ {
+		w.Publish(&Event{Type: TypeAlarm})
+	}
+	require.Equal(t, int64(3), w.Dropped())
+
+	var nilWebhook *Webhook
+	nilWebhook.Publish(&Event{Type: TypeAlarm})
+	require.Equal(t, int64(0), nilWebhook.Dropped())
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultTimeline is the default number of events kept in the timeline
+const DefaultTimeline = 1000
+
+// Timeline keeps the most recent events in memory, so the sequence of events
+// is available on the monitoring port without access to the logs
+type Timeline struct {
+	sync.Mutex
+	size   int
+	events []Event
+}
+
+// NewTimeline returns a timeline of up to size events
+func NewTimeline(size int) *Timeline {
+	return &Timeline{size: size}
+}
+
+// Add appends the event, dropping the oldest one when the timeline is full
+func (t *Timeline) Add(e *Event) {
+	if t == nil || t.size <= 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	t.Lock()
+	defer t.Unlock()
+	if len(t.events) >= t.size {
+		t.events = append(t.events[:0], t.events[len(t.events)-t.size+1:]...)
+	}
+	t.events = append(t.events, *e)
+}
+
+// Events returns the events of the type after since, oldest first. Empty type matches all, n > 0 limits them to the most recent ones
+func (t *Timeline) Events(since time.Time, typ string, n int) []Event {
+	t.Lock()
+	defer t.Unlock()
+	res := []Event{}
+	for _, e := range t.events {
+		if e.Time.After(since) && (typ == "" || e.Type == typ) {
+			res = append(res, e)
+		}
+	}
+	if n > 0 && len(res) > n {
+		res = res[len(res)-n:]
+	}
+	return res
+}
+
+// ServeHTTP serves the events as a JSON array. They can be filtered by type, since as RFC3339 time and limited by n
+func (t *Timeline) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "since must be RFC3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	var n int
+	if v := q.Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, "n must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+	}
+	js, err := json.Marshal(t.Events(since, q.Get("type"), n))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := stats.WriteCompressed(w, r, js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
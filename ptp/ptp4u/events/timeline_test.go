@@ -0,0 +1,83 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline(t *testing.T) {
+	tl := NewTimeline(3)
+	start := time.Unix(1700000000, 0).UTC()
+	for i, typ := range []string{TypeLifecycle, TypeConfig, TypeDrain, TypeConfig} {
+		tl.Add(&Event{Time: start.Add(time.Duration(i) * time.Second), Type: typ})
+	}
+
+	// the oldest event is dropped
+	events := tl.Events(time.Time{}, "", 0)
+	require.Len(t, events, 3)
+	require.Equal(t, TypeConfig, events[0].Type)
+	require.Equal(t, start.Add(3*time.Second), events[2].Time)
+
+	require.Len(t, tl.Events(time.Time{}, TypeConfig, 0), 2)
+	require.Len(t, tl.Events(start.Add(2*time.Second), "", 0), 1)
+	require.Equal(t, []Event{events[2]}, tl.Events(time.Time{}, "", 1))
+
+	// disabled timeline keeps nothing
+	var none *Timeline
+	none.Add(&Event{Type: TypeLifecycle})
+	disabled := NewTimeline(0)
+	disabled.Add(&Event{Type: TypeLifecycle})
+	require.Empty(t, disabled.Events(time.Time{}, "", 0))
+}
+
+func TestTimelineServeHTTP(t *testing.T) {
+	tl := NewTimeline(10)
+	tl.Add(&Event{Type: TypeDrain, Message: "graceful drain engaged"})
+	tl.Add(&Event{Type: TypeConfig, Message: "config generation 2 applied"})
+
+	rec := httptest.NewRecorder()
+	tl.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/timeline?type=drain", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var events []Event
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &events))
+	require.Len(t, events, 1)
+	require.Equal(t, "graceful drain engaged", events[0].Message)
+
+	// long timelines are compressed
+	long := NewTimeline(100)
+	for i := 0; i < 50; i++ {
+		long.Add(&Event{Type: TypeConfig, Message: "config generation 2 applied"})
+	}
+	r := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	long.ServeHTTP(rec, r)
+	require.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+
+	for _, q := range []string{"since=yesterday", "n=-1"} {
+		rec = httptest.NewRecorder()
+		tl.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/timeline?"+q, nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code, q)
+	}
+}
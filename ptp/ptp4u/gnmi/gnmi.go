@@ -0,0 +1,389 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package gnmi serves the ptp4u stats to gNMI collectors.
+
+Every stat is a leaf, its path being the JSON key split on dots: worker.3.queue is /worker/3/queue.
+Request paths select the subtree under them, "*" matches any element and "..." any number of them.
+Values are int_val, or the decimal number for the JSON encodings. The stats are read only, Set is not implemented.
+*/
+package gnmi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// MinSampleInterval is the shortest sample interval of the subscriptions
+const MinSampleInterval = 100 * time.Millisecond
+
+// Source returns the current values of the stats
+type Source func() map[string]int64
+
+// Server is the gNMI service of the stats
+type Server struct {
+	gpb.UnimplementedGNMIServer
+
+	source Source
+	// how often the source changes. Default sample interval and how often ON_CHANGE subscriptions are checked
+	interval time.Duration
+}
+
+// NewServer returns the gNMI service of the stats source which changes every interval
+func NewServer(source Source, interval time.Duration) *Server {
+	if interval < MinSampleInterval {
+		interval = MinSampleInterval
+	}
+	return &Server{source: source, interval: interval}
+}
+
+// Capabilities returns the encodings supported by the server. No models are published
+func (s *Server) Capabilities(_ context.Context, _ *gpb.CapabilityRequest) (*gpb.CapabilityResponse, error) {
+	version, _ := proto.GetExtension(gpb.File_proto_gnmi_gnmi_proto.Options(), gpb.E_GnmiService).(string)
+	return &gpb.CapabilityResponse{
+		SupportedEncodings: []gpb.Encoding{gpb.Encoding_JSON, gpb.Encoding_JSON_IETF, gpb.Encoding_PROTO},
+		GNMIVersion:        version,
+	}, nil
+}
+
+// Get returns the values of the paths. A path matching no stats is an error
+func (s *Server) Get(_ context.Context, req *gpb.GetRequest) (*gpb.GetResponse, error) {
+	if err := checkEncoding(req.GetEncoding()); err != nil {
+		return nil, err
+	}
+	values := s.source()
+	now := time.Now().UnixNano()
+	res := &gpb.GetResponse{}
+	for _, p := range req.GetPath() {
+		q := newQuery(req.GetPrefix(), p)
+		n := &gpb.Notification{Timestamp: now, Prefix: req.GetPrefix()}
+		for _, key := range sortedKeys(values) {
+			if q.match(key) {
+				n.Update = append(n.Update, q.update(key, values[key], req.GetEncoding()))
+			}
+		}
+		if len(n.Update) == 0 {
+			return nil, status.Errorf(codes.NotFound, "no stats under %s", q)
+		}
+		res.Notification = append(res.Notification, n)
+	}
+	return res, nil
+}
+
+// Subscribe serves ONCE, POLL and STREAM subscriptions. STREAM supports SAMPLE and ON_CHANGE,
+// TARGET_DEFINED is sampled when the stats change
+func (s *Server) Subscribe(stream gpb.GNMI_SubscribeServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	list := req.GetSubscribe()
+	if list == nil {
+		return status.Error(codes.InvalidArgument, "first request must be a subscription list")
+	}
+	if err := checkEncoding(list.GetEncoding()); err != nil {
+		return err
+	}
+	subs := make([]*subscription, 0, len(list.GetSubscription()))
+	for _, sub := range list.GetSubscription() {
+		if i := time.Duration(sub.GetSampleInterval()); i > 0 && i < MinSampleInterval {
+			return status.Errorf(codes.InvalidArgument, "sample interval %v is shorter than %v", i, MinSampleInterval)
+		}
+		subs = append(subs, newSubscription(list.GetPrefix(), sub, s.interval))
+	}
+
+	switch list.GetMode() {
+	case gpb.SubscriptionList_ONCE:
+		return s.sendAll(stream, list, subs)
+	case gpb.SubscriptionList_POLL:
+		for {
+			if err := s.sendAll(stream, list, subs); err != nil {
+				return err
+			}
+			req, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if req.GetPoll() == nil {
+				return status.Error(codes.InvalidArgument, "only polls are accepted on a POLL subscription")
+			}
+		}
+	case gpb.SubscriptionList_STREAM:
+		return s.stream(stream, list, subs)
+	}
+	return status.Errorf(codes.InvalidArgument, "unsupported subscription mode %s", list.GetMode())
+}
+
+// sendAll sends the current values of all subscriptions followed by the sync response
+func (s *Server) sendAll(stream gpb.GNMI_SubscribeServer, list *gpb.SubscriptionList, subs []*subscription) error {
+	values := s.source()
+	now := time.Now()
+	for _, sub := range subs {
+		if err := send(stream, sub.notification(values, now, list, true)); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}})
+}
+
+// stream sends the subscriptions when they are due until the client goes away
+func (s *Server) stream(stream gpb.GNMI_SubscribeServer, list *gpb.SubscriptionList, subs []*subscription) error {
+	values := s.source()
+	now := time.Now()
+	for _, sub := range subs {
+		n := sub.notification(values, now, list, true)
+		if list.GetUpdatesOnly() {
+			continue
+		}
+		if err := send(stream, n); err != nil {
+			return err
+		}
+	}
+	if err := stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}}); err != nil {
+		return err
+	}
+
+	// nothing more is expected from the client, but it going away
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				if !errors.Is(err, io.EOF) {
+					recvErr <- err
+				}
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(time.Until(nextDue(subs)))
+	defer timer.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case err := <-recvErr:
+			return err
+		case <-timer.C:
+		}
+		values = s.source()
+		now = time.Now()
+		for _, sub := range subs {
+			if now.Before(sub.next) {
+				continue
+			}
+			if err := send(stream, sub.notification(values, now, list, false)); err != nil {
+				return err
+			}
+		}
+		timer.Reset(time.Until(nextDue(subs)))
+	}
+}
+
+// send the notification if it has any updates or deletes
+func send(stream gpb.GNMI_SubscribeServer, n *gpb.Notification) error {
+	if len(n.GetUpdate()) == 0 && len(n.GetDelete()) == 0 {
+		return nil
+	}
+	return stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: n}})
+}
+
+// subscription is a path of the subscription list with the values last sent for it
+type subscription struct {
+	query
+	mode     gpb.SubscriptionMode
+	interval time.Duration
+	// values are only sent if they changed since the last time, except every heartbeat
+	suppress  bool
+	heartbeat time.Duration
+
+	next     time.Time
+	lastBeat time.Time
+	last     map[string]int64
+}
+
+func newSubscription(prefix *gpb.Path, sub *gpb.Subscription, interval time.Duration) *subscription {
+	res := &subscription{
+		query:     newQuery(prefix, sub.GetPath()),
+		mode:      sub.GetMode(),
+		interval:  interval,
+		suppress:  sub.GetSuppressRedundant(),
+		heartbeat: time.Duration(sub.GetHeartbeatInterval()),
+		last:      map[string]int64{},
+	}
+	switch res.mode {
+	case gpb.SubscriptionMode_SAMPLE:
+		if sub.GetSampleInterval() > 0 {
+			res.interval = time.Duration(sub.GetSampleInterval())
+		}
+	case gpb.SubscriptionMode_ON_CHANGE:
+		res.suppress = true
+	default:
+		res.mode = gpb.SubscriptionMode_TARGET_DEFINED
+		res.suppress = true
+	}
+	return res
+}
+
+// notification returns the values of the subscription to send and schedules the next one.
+// The full set is sent initially and on the heartbeat
+func (s *subscription) notification(values map[string]int64, now time.Time, list *gpb.SubscriptionList, full bool) *gpb.Notification {
+	s.next = now.Add(s.interval)
+	if s.heartbeat > 0 && now.Sub(s.lastBeat) >= s.heartbeat {
+		full = true
+	}
+	if full {
+		s.lastBeat = now
+	}
+	n := &gpb.Notification{Timestamp: now.UnixNano(), Prefix: list.GetPrefix()}
+	current := map[string]int64{}
+	for _, key := range sortedKeys(values) {
+		if !s.match(key) {
+			continue
+		}
+		v := values[key]
+		current[key] = v
+		if last, ok := s.last[key]; ok && last == v && s.suppress && !full {
+			continue
+		}
+		n.Update = append(n.Update, s.update(key, v, list.GetEncoding()))
+	}
+	// stats gone from the tree, such as histograms without samples
+	if s.suppress {
+		for _, key := range sortedKeys(s.last) {
+			if _, ok := current[key]; !ok {
+				n.Delete = append(n.Delete, s.relative(key))
+			}
+		}
+	}
+	s.last = current
+	return n
+}
+
+// nextDue returns when the earliest of the subscriptions is due
+func nextDue(subs []*subscription) time.Time {
+	var next time.Time
+	for _, sub := range subs {
+		if next.IsZero() || sub.next.Before(next) {
+			next = sub.next
+		}
+	}
+	return next
+}
+
+// query matches the stat keys against the path of the request
+type query struct {
+	// elements of the prefix, dropped from the paths of the updates
+	prefix int
+	elems  []string
+}
+
+func newQuery(prefix, path *gpb.Path) query {
+	pe := pathElems(prefix)
+	return query{prefix: len(pe), elems: append(pe, pathElems(path)...)}
+}
+
+// pathElems returns the names of the path elements, keys are not used by the stats
+func pathElems(p *gpb.Path) []string {
+	var res []string
+	for _, e := range p.GetElem() {
+		res = append(res, e.GetName())
+	}
+	if len(res) == 0 {
+		// deprecated string elements
+		res = append(res, p.GetElement()...)
+	}
+	return res
+}
+
+func (q query) String() string {
+	return "/" + strings.Join(q.elems, "/")
+}
+
+// match checks if the stat is under the path
+func (q query) match(key string) bool {
+	return matchElems(q.elems, strings.Split(key, "."))
+}
+
+func matchElems(pattern, elems []string) bool {
+	for i, p := range pattern {
+		if p == "..." {
+			return true
+		}
+		if i >= len(elems) || (p != "*" && p != elems[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// relative returns the path of the stat relative to the prefix of the request
+func (q query) relative(key string) *gpb.Path {
+	elems := strings.Split(key, ".")
+	if q.prefix <= len(elems) {
+		elems = elems[q.prefix:]
+	}
+	p := &gpb.Path{}
+	for _, e := range elems {
+		p.Elem = append(p.Elem, &gpb.PathElem{Name: e})
+	}
+	return p
+}
+
+// update returns the value of the stat in the encoding
+func (q query) update(key string, v int64, enc gpb.Encoding) *gpb.Update {
+	u := &gpb.Update{Path: q.relative(key)}
+	switch enc {
+	case gpb.Encoding_JSON:
+		u.Val = &gpb.TypedValue{Value: &gpb.TypedValue_JsonVal{JsonVal: []byte(strconv.FormatInt(v, 10))}}
+	case gpb.Encoding_JSON_IETF:
+		u.Val = &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(strconv.FormatInt(v, 10))}}
+	default:
+		u.Val = &gpb.TypedValue{Value: &gpb.TypedValue_IntVal{IntVal: v}}
+	}
+	return u
+}
+
+func checkEncoding(enc gpb.Encoding) error {
+	switch enc {
+	case gpb.Encoding_JSON, gpb.Encoding_JSON_IETF, gpb.Encoding_PROTO:
+		return nil
+	}
+	return status.Errorf(codes.Unimplemented, "unsupported encoding %s", enc)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
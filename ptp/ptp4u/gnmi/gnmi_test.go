@@ -0,0 +1,248 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gnmi
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testSource is a stats source the test changes
+type testSource struct {
+	sync.Mutex
+	values map[string]int64
+}
+
+func (s *testSource) get() map[string]int64 {
+	s.Lock()
+	defer s.Unlock()
+	res := make(map[string]int64, len(s.values))
+	for k, v := range s.values {
+		res[k] = v
+	}
+	return res
+}
+
+func (s *testSource) set(key string, v int64) {
+	s.Lock()
+	defer s.Unlock()
+	s.values[key] = v
+}
+
+func testClient(t *testing.T, src *testSource) gpb.GNMIClient {
+	l := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	gpb.RegisterGNMIServer(g, NewServer(src.get, MinSampleInterval))
+	go func() { _ = g.Serve(l) }()
+	t.Cleanup(g.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return gpb.NewGNMIClient(conn)
+}
+
+func path(elems ...string) *gpb.Path {
+	p := &gpb.Path{}
+	for _, e := range elems {
+		p.Elem = append(p.Elem, &gpb.PathElem{Name: e})
+	}
+	return p
+}
+
+func newTestSource() *testSource {
+	return &testSource{values: map[string]int64{
+		"tx.sync":        10,
+		"tx.announce":    2,
+		"worker.0.queue": 3,
+		"worker.1.queue": 4,
+		"clockclass":     6,
+	}}
+}
+
+// updates returns the values of the updates by the path
+func updates(n *gpb.Notification) map[string]int64 {
+	res := map[string]int64{}
+	for _, u := range n.GetUpdate() {
+		var key string
+		for i, e := range u.GetPath().GetElem() {
+			if i > 0 {
+				key += "."
+			}
+			key += e.GetName()
+		}
+		res[key] = u.GetVal().GetIntVal()
+	}
+	return res
+}
+
+func TestMatchElems(t *testing.T) {
+	require.True(t, matchElems(nil, []string{"tx", "sync"}))
+	require.True(t, matchElems([]string{"tx"}, []string{"tx", "sync"}))
+	require.True(t, matchElems([]string{"tx", "sync"}, []string{"tx", "sync"}))
+	require.True(t, matchElems([]string{"*", "sync"}, []string{"tx", "sync"}))
+	require.True(t, matchElems([]string{"worker", "..."}, []string{"worker", "1", "queue"}))
+	require.False(t, matchElems([]string{"tx", "sync", "p50"}, []string{"tx", "sync"}))
+	require.False(t, matchElems([]string{"rx"}, []string{"tx", "sync"}))
+}
+
+func TestCapabilities(t *testing.T) {
+	c := testClient(t, newTestSource())
+	res, err := c.Capabilities(context.Background(), &gpb.CapabilityRequest{})
+	require.NoError(t, err)
+	require.Contains(t, res.SupportedEncodings, gpb.Encoding_PROTO)
+	require.NotEmpty(t, res.GNMIVersion)
+}
+
+func TestGet(t *testing.T) {
+	c := testClient(t, newTestSource())
+	ctx := context.Background()
+
+	res, err := c.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{path("tx"), path("worker", "*", "queue")}, Encoding: gpb.Encoding_PROTO})
+	require.NoError(t, err)
+	require.Len(t, res.Notification, 2)
+	require.Equal(t, map[string]int64{"tx.sync": 10, "tx.announce": 2}, updates(res.Notification[0]))
+	require.Equal(t, map[string]int64{"worker.0.queue": 3, "worker.1.queue": 4}, updates(res.Notification[1]))
+
+	// paths are relative to the prefix
+	res, err = c.Get(ctx, &gpb.GetRequest{Prefix: path("worker"), Path: []*gpb.Path{path("1")}, Encoding: gpb.Encoding_PROTO})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"1.queue": 4}, updates(res.Notification[0]))
+
+	res, err = c.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{path("clockclass")}, Encoding: gpb.Encoding_JSON})
+	require.NoError(t, err)
+	require.Equal(t, []byte("6"), res.Notification[0].Update[0].Val.GetJsonVal())
+
+	_, err = c.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{path("rx")}})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{path("tx")}, Encoding: gpb.Encoding_ASCII})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = c.Set(ctx, &gpb.SetRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func subscribe(t *testing.T, c gpb.GNMIClient, list *gpb.SubscriptionList) gpb.GNMI_SubscribeClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	stream, err := c.Subscribe(ctx)
+	require.NoError(t, err)
+	list.Encoding = gpb.Encoding_PROTO
+	require.NoError(t, stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: list}}))
+	return stream
+}
+
+func TestSubscribeOnce(t *testing.T) {
+	c := testClient(t, newTestSource())
+	stream := subscribe(t, c, &gpb.SubscriptionList{
+		Mode:         gpb.SubscriptionList_ONCE,
+		Subscription: []*gpb.Subscription{{Path: path("tx")}},
+	})
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"tx.sync": 10, "tx.announce": 2}, updates(res.GetUpdate()))
+	res, err = stream.Recv()
+	require.NoError(t, err)
+	require.True(t, res.GetSyncResponse())
+}
+
+func TestSubscribePoll(t *testing.T) {
+	src := newTestSource()
+	c := testClient(t, src)
+	stream := subscribe(t, c, &gpb.SubscriptionList{
+		Mode:         gpb.SubscriptionList_POLL,
+		Subscription: []*gpb.Subscription{{Path: path("tx", "sync")}},
+	})
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"tx.sync": 10}, updates(res.GetUpdate()))
+	res, err = stream.Recv()
+	require.NoError(t, err)
+	require.True(t, res.GetSyncResponse())
+
+	src.set("tx.sync", 11)
+	require.NoError(t, stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Poll{Poll: &gpb.Poll{}}}))
+	res, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"tx.sync": 11}, updates(res.GetUpdate()))
+}
+
+func TestSubscribeStream(t *testing.T) {
+	src := newTestSource()
+	c := testClient(t, src)
+	stream := subscribe(t, c, &gpb.SubscriptionList{
+		Mode: gpb.SubscriptionList_STREAM,
+		Subscription: []*gpb.Subscription{
+			{Path: path("tx"), Mode: gpb.SubscriptionMode_ON_CHANGE},
+			{Path: path("clockclass"), Mode: gpb.SubscriptionMode_SAMPLE, SampleInterval: uint64(MinSampleInterval)},
+		},
+	})
+
+	// initial values, then the sync
+	seen := map[string]int64{}
+	for {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		if res.GetSyncResponse() {
+			break
+		}
+		for k, v := range updates(res.GetUpdate()) {
+			seen[k] = v
+		}
+	}
+	require.Equal(t, map[string]int64{"tx.sync": 10, "tx.announce": 2, "clockclass": 6}, seen)
+
+	// samples repeat the value, changes only carry what changed
+	src.set("tx.sync", 12)
+	var sampled, changed bool
+	for !sampled || !changed {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		u := updates(res.GetUpdate())
+		if _, ok := u["clockclass"]; ok {
+			require.Equal(t, map[string]int64{"clockclass": 6}, u)
+			sampled = true
+			continue
+		}
+		require.Equal(t, map[string]int64{"tx.sync": 12}, u)
+		changed = true
+	}
+}
+
+func TestSubscribeInvalid(t *testing.T) {
+	c := testClient(t, newTestSource())
+	stream := subscribe(t, c, &gpb.SubscriptionList{
+		Mode:         gpb.SubscriptionList_STREAM,
+		Subscription: []*gpb.Subscription{{Path: path("tx"), Mode: gpb.SubscriptionMode_SAMPLE, SampleInterval: uint64(time.Millisecond)}},
+	})
+	_, err := stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,34 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package ktrace measures the in-kernel latency of the event messages ptp4u sends: the time from
+the send syscall until the kernel reports the TX timestamp of the packet. Next to the time
+ptp4u takes to read the timestamp it tells whether jitter comes from ptp4u or from the kernel stack.
+
+The tracer is a pair of eBPF kprobes. One on udp_sendmsg and udpv6_sendmsg records the send time
+per socket of the process, the other one on __skb_tstamp_tx reports the time since the send of the socket
+the timestamp is for through a ring buffer. It needs Linux 5.12 or newer, CAP_BPF and CAP_PERFMON
+(or root), and ptp4u built with the ebpf tag. Only one send per socket can be measured at a time,
+which holds for ptp4u as workers wait for the TX timestamp before sending the next event message.
+*/
+package ktrace
+
+// maxSockets is how many sockets of the process the send times are kept for
+const maxSockets = 4096
+
+// ringSize is the size of the ring buffer of latencies, enough for a metric interval of reads to fall behind
+const ringSize = 1 << 20
@@ -0,0 +1,207 @@
+//go:build linux && ebpf && (amd64 || arm64)
+// +build linux
+// +build ebpf
+// +build amd64 arm64
+
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktrace
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/facebook/time/hostendian"
+)
+
+// sendSymbols are the kernel functions sending on the UDP sockets. IPv6 may be a module which isn't loaded
+var sendSymbols = []string{"udp_sendmsg", "udpv6_sendmsg"}
+
+// tstampSymbol is the kernel function reporting the TX timestamps to the sockets
+const tstampSymbol = "__skb_tstamp_tx"
+
+// Tracer measures the in-kernel latency of the event messages sent by the process
+type Tracer struct {
+	start  *ebpf.Map
+	events *ebpf.Map
+	links  []link.Link
+	reader *ringbuf.Reader
+}
+
+// sendProgram records the send time of the sockets of the process in the start map
+func sendProgram(start int, tgid int32) asm.Instructions {
+	return asm.Instructions{
+		// keep the context, helpers clobber R1-R5
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.FnGetCurrentPidTgid.Call(),
+		asm.RSh.Imm(asm.R0, 32),
+		asm.JNE.Imm(asm.R0, tgid, "exit"),
+		// the socket is the key
+		asm.LoadMem(asm.R1, asm.R6, sendSockOffset, asm.DWord),
+		asm.StoreMem(asm.RFP, -8, asm.R1, asm.DWord),
+		asm.FnKtimeGetNs.Call(),
+		asm.StoreMem(asm.RFP, -16, asm.R0, asm.DWord),
+		asm.LoadMapPtr(asm.R1, start),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -8),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -16),
+		// BPF_ANY
+		asm.Mov.Imm(asm.R4, 0),
+		asm.FnMapUpdateElem.Call(),
+		asm.Mov.Imm(asm.R0, 0).WithSymbol("exit"),
+		asm.Return(),
+	}
+}
+
+// tstampProgram reports the time since the send of the socket the TX timestamp is for to the events ring buffer
+func tstampProgram(start, events int) asm.Instructions {
+	return asm.Instructions{
+		asm.LoadMem(asm.R1, asm.R1, tstampSockOffset, asm.DWord),
+		asm.StoreMem(asm.RFP, -8, asm.R1, asm.DWord),
+		asm.LoadMapPtr(asm.R1, start),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -8),
+		asm.FnMapLookupElem.Call(),
+		// not a socket of the process, or the send was reported already
+		asm.JEq.Imm(asm.R0, 0, "exit"),
+		asm.LoadMem(asm.R6, asm.R0, 0, asm.DWord),
+		asm.FnKtimeGetNs.Call(),
+		asm.Sub.Reg(asm.R0, asm.R6),
+		asm.StoreMem(asm.RFP, -16, asm.R0, asm.DWord),
+		// one report per send
+		asm.LoadMapPtr(asm.R1, start),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -8),
+		asm.FnMapDeleteElem.Call(),
+		asm.LoadMapPtr(asm.R1, events),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -16),
+		asm.Mov.Imm(asm.R3, 8),
+		asm.Mov.Imm(asm.R4, 0),
+		asm.FnRingbufOutput.Call(),
+		asm.Mov.Imm(asm.R0, 0).WithSymbol("exit"),
+		asm.Return(),
+	}
+}
+
+// New loads the tracer of the sockets of the process and attaches it to the kernel
+func New(pid int) (*Tracer, error) {
+	t, err := newTracer(pid)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func newTracer(pid int) (*Tracer, error) {
+	t := &Tracer{}
+	// kernels before 5.11 account BPF memory against the memlock limit
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return t, fmt.Errorf("removing memlock limit: %w", err)
+	}
+
+	var err error
+	t.start, err = ebpf.NewMap(&ebpf.MapSpec{Name: "ptp4u_tx_start", Type: ebpf.LRUHash, KeySize: 8, ValueSize: 8, MaxEntries: maxSockets})
+	if err != nil {
+		return t, fmt.Errorf("creating send time map: %w", err)
+	}
+	t.events, err = ebpf.NewMap(&ebpf.MapSpec{Name: "ptp4u_tx_lat", Type: ebpf.RingBuf, MaxEntries: ringSize})
+	if err != nil {
+		return t, fmt.Errorf("creating latency ring buffer: %w", err)
+	}
+
+	// attached programs are referenced by the links
+	send, err := ebpf.NewProgram(&ebpf.ProgramSpec{Name: "ptp4u_tx_send", Type: ebpf.Kprobe, License: "GPL", Instructions: sendProgram(t.start.FD(), int32(pid))})
+	if err != nil {
+		return t, fmt.Errorf("loading send program: %w", err)
+	}
+	defer send.Close()
+	tstamp, err := ebpf.NewProgram(&ebpf.ProgramSpec{Name: "ptp4u_tx_tstamp", Type: ebpf.Kprobe, License: "GPL", Instructions: tstampProgram(t.start.FD(), t.events.FD())})
+	if err != nil {
+		return t, fmt.Errorf("loading timestamp program: %w", err)
+	}
+	defer tstamp.Close()
+
+	for _, sym := range sendSymbols {
+		l, err := link.Kprobe(sym, send, nil)
+		if err != nil {
+			if len(t.links) > 0 {
+				continue
+			}
+			return t, fmt.Errorf("attaching to %s: %w", sym, err)
+		}
+		t.links = append(t.links, l)
+	}
+	l, err := link.Kprobe(tstampSymbol, tstamp, nil)
+	if err != nil {
+		return t, fmt.Errorf("attaching to %s: %w", tstampSymbol, err)
+	}
+	t.links = append(t.links, l)
+
+	if t.reader, err = ringbuf.NewReader(t.events); err != nil {
+		return t, fmt.Errorf("reading latency ring buffer: %w", err)
+	}
+	return t, nil
+}
+
+// Run passes the latency of every timestamped send to observe until the tracer is closed
+func (t *Tracer) Run(observe func(time.Duration)) error {
+	var rec ringbuf.Record
+	for {
+		if err := t.reader.ReadInto(&rec); err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("reading latency ring buffer: %w", err)
+		}
+		if len(rec.RawSample) < 8 {
+			continue
+		}
+		observe(time.Duration(hostendian.Order.Uint64(rec.RawSample)))
+	}
+}
+
+// Close detaches the tracer from the kernel
+func (t *Tracer) Close() error {
+	var errs []error
+	if t.reader != nil {
+		errs = append(errs, t.reader.Close())
+	}
+	for _, l := range t.links {
+		errs = append(errs, l.Close())
+	}
+	if t.start != nil {
+		errs = append(errs, t.start.Close())
+	}
+	if t.events != nil {
+		errs = append(errs, t.events.Close())
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
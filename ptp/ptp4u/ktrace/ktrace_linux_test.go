@@ -0,0 +1,79 @@
+//go:build linux && ebpf && (amd64 || arm64)
+// +build linux
+// +build ebpf
+// +build amd64 arm64
+
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktrace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPrograms(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, sendProgram(3, 42).Marshal(&b, binary.LittleEndian))
+	require.NoError(t, tstampProgram(3, 4).Marshal(&b, binary.LittleEndian))
+}
+
+func TestTracer(t *testing.T) {
+	tr, err := New(os.Getpid())
+	if err != nil {
+		t.Skipf("kernel tracing not available: %v", err)
+	}
+	defer tr.Close()
+
+	observed := make(chan time.Duration, 1)
+	go func() {
+		require.NoError(t, tr.Run(func(d time.Duration) {
+			select {
+			case observed <- d:
+			default:
+			}
+		}))
+	}()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	raw, err := conn.SyscallConn()
+	require.NoError(t, err)
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPING, unix.SOF_TIMESTAMPING_TX_SOFTWARE|unix.SOF_TIMESTAMPING_SOFTWARE)
+	}))
+	require.NoError(t, err)
+	_, err = conn.WriteToUDP([]byte("sync"), conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+
+	select {
+	case d := <-observed:
+		require.Greater(t, d, time.Duration(0))
+		require.Less(t, d, time.Second)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no latency observed")
+	}
+	require.NoError(t, tr.Close())
+}
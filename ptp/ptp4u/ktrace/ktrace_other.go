@@ -0,0 +1,46 @@
+//go:build !linux || !ebpf || !(amd64 || arm64)
+// +build !linux !ebpf !amd64,!arm64
+
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ktrace
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned when ptp4u is built without eBPF support
+var ErrUnsupported = errors.New("kernel latency tracing needs Linux on amd64 or arm64 and ptp4u built with the ebpf tag")
+
+// Tracer measures the in-kernel latency of the event messages sent by the process
+type Tracer struct{}
+
+// New is not supported in this build
+func New(_ int) (*Tracer, error) {
+	return nil, ErrUnsupported
+}
+
+// Run is not supported in this build
+func (t *Tracer) Run(_ func(time.Duration)) error {
+	return ErrUnsupported
+}
+
+// Close is not supported in this build
+func (t *Tracer) Close() error {
+	return ErrUnsupported
+}
@@ -0,0 +1,272 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package peer implements a side channel between cooperating ptp4u instances.
+
+Every instance periodically sends a signed statement of its current time
+and clock quality to its peers. Comparing own time against the statements
+received allows an instance to detect it silently drifted away from
+the rest of the fleet and degrade itself.
+*/
+package peer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	statementVersion = 1
+	statementLen     = 19
+	signatureLen     = sha256.Size
+	// StatementSize is the size of the signed statement on the wire
+	StatementSize = statementLen + signatureLen
+)
+
+var (
+	errBadSize      = errors.New("unexpected statement size")
+	errBadVersion   = errors.New("unsupported statement version")
+	errBadSignature = errors.New("statement signature mismatch")
+)
+
+// Statement is a claim of a peer about its current time and quality
+type Statement struct {
+	ClockIdentity ptp.ClockIdentity
+	Time          time.Time
+	ClockClass    ptp.ClockClass
+	ClockAccuracy ptp.ClockAccuracy
+}
+
+// MarshalSigned serializes the statement and appends HMAC-SHA256 signature
+func (s *Statement) MarshalSigned(key []byte) []byte {
+	b := make([]byte, StatementSize)
+	b[0] = statementVersion
+	binary.BigEndian.PutUint64(b[1:], uint64(s.ClockIdentity))
+	binary.BigEndian.PutUint64(b[9:], uint64(s.Time.UnixNano()))
+	b[17] = byte(s.ClockClass)
+	b[18] = byte(s.ClockAccuracy)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b[:statementLen])
+	copy(b[statementLen:], mac.Sum(nil))
+	return b
+}
+
+// UnmarshalSigned verifies the signature and parses the statement
+func UnmarshalSigned(b []byte, key []byte) (*Statement, error) {
+	if len(b) != StatementSize {
+		return nil, errBadSize
+	}
+	if b[0] != statementVersion {
+		return nil, errBadVersion
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b[:statementLen])
+	if !hmac.Equal(mac.Sum(nil), b[statementLen:]) {
+		return nil, errBadSignature
+	}
+	return &Statement{
+		ClockIdentity: ptp.ClockIdentity(binary.BigEndian.Uint64(b[1:])),
+		Time:          time.Unix(0, int64(binary.BigEndian.Uint64(b[9:]))),
+		ClockClass:    ptp.ClockClass(b[17]),
+		ClockAccuracy: ptp.ClockAccuracy(b[18]),
+	}, nil
+}
+
+// Config is a peer monitor configuration
+type Config struct {
+	// Peers are addresses (host:port) of the cooperating instances
+	Peers []string
+	// Key is the shared secret statements are signed with
+	Key []byte
+	// Interval is how often own statement is sent to the peers
+	Interval time.Duration
+	// MaxOffset is the maximum tolerated offset from a peer
+	MaxOffset time.Duration
+}
+
+type peerState struct {
+	offset time.Duration
+	last   time.Time
+	seen   time.Time
+}
+
+// Monitor exchanges statements with peers and tracks offsets to them
+type Monitor struct {
+	sync.Mutex
+
+	config  *Config
+	id      ptp.ClockIdentity
+	now     func() (time.Time, error)
+	quality func() (ptp.ClockClass, ptp.ClockAccuracy)
+	clock   func() time.Time
+	peers   map[ptp.ClockIdentity]*peerState
+}
+
+// NewMonitor returns a peer monitor which reads own time via now and own quality via quality
+func NewMonitor(config *Config, id ptp.ClockIdentity, now func() (time.Time, error), quality func() (ptp.ClockClass, ptp.ClockAccuracy)) *Monitor {
+	return &Monitor{
+		config:  config,
+		id:      id,
+		now:     now,
+		quality: quality,
+		clock:   time.Now,
+		peers:   map[ptp.ClockIdentity]*peerState{},
+	}
+}
+
+// Run sends own statements and receives statements of the peers over conn until ctx is done
+func (m *Monitor) Run(ctx context.Context, conn net.PacketConn) error {
+	addrs := make([]net.Addr, 0, len(m.config.Peers))
+	for _, p := range m.config.Peers {
+		addr, err := net.ResolveUDPAddr("udp", p)
+		if err != nil {
+			return fmt.Errorf("resolving peer %s: %w", p, err)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(m.config.Interval):
+			}
+			b, err := m.statement()
+			if err != nil {
+				log.Errorf("Failed to prepare peer statement: %v", err)
+				continue
+			}
+			for _, addr := range addrs {
+				if _, err := conn.WriteTo(b, addr); err != nil {
+					log.Debugf("Failed to send peer statement to %s: %v", addr, err)
+				}
+			}
+		}
+	}()
+
+	buf := make([]byte, StatementSize+1)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := m.handle(buf[:n]); err != nil {
+			log.Debugf("Rejected peer statement from %s: %v", addr, err)
+		}
+	}
+}
+
+// statement returns own signed statement
+func (m *Monitor) statement() ([]byte, error) {
+	now, err := m.now()
+	if err != nil {
+		return nil, err
+	}
+	class, accuracy := m.quality()
+	s := &Statement{
+		ClockIdentity: m.id,
+		Time:          now,
+		ClockClass:    class,
+		ClockAccuracy: accuracy,
+	}
+	return s.MarshalSigned(m.config.Key), nil
+}
+
+// handle verifies a received statement and records offset to the peer
+func (m *Monitor) handle(b []byte) error {
+	now, err := m.now()
+	if err != nil {
+		return err
+	}
+	s, err := UnmarshalSigned(b, m.config.Key)
+	if err != nil {
+		return err
+	}
+	if s.ClockIdentity == m.id {
+		return fmt.Errorf("own statement")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	p, ok := m.peers[s.ClockIdentity]
+	if !ok {
+		p = &peerState{}
+		m.peers[s.ClockIdentity] = p
+	}
+	// Statements must move forward, otherwise it's a replay
+	if !s.Time.After(p.last) {
+		return fmt.Errorf("stale statement from %s", s.ClockIdentity)
+	}
+	// Peers which don't trust their own time have no vote
+	if s.ClockClass > ptp.ClockClass7 {
+		delete(m.peers, s.ClockIdentity)
+		return nil
+	}
+	p.last = s.Time
+	p.seen = m.clock()
+	p.offset = now.Sub(s.Time)
+	return nil
+}
+
+// Offsets returns offsets to peers heard from recently
+func (m *Monitor) Offsets() map[ptp.ClockIdentity]time.Duration {
+	m.Lock()
+	defer m.Unlock()
+	offsets := map[ptp.ClockIdentity]time.Duration{}
+	for id, p := range m.peers {
+		if m.clock().Sub(p.seen) > 3*m.config.Interval {
+			delete(m.peers, id)
+			continue
+		}
+		offsets[id] = p.offset
+	}
+	return offsets
+}
+
+// Drifted reports whether the majority of fresh peers disagree with own time
+func (m *Monitor) Drifted() bool {
+	offsets := m.Offsets()
+	var disagree int
+	for _, offset := range offsets {
+		if offset < 0 {
+			offset = -offset
+		}
+		if offset > m.config.MaxOffset {
+			disagree++
+		}
+	}
+	return disagree > 0 && disagree*2 > len(offsets)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = []byte("secret")
+
+func TestStatementSigned(t *testing.T) {
+	s := &Statement{
+		ClockIdentity: ptp.ClockIdentity(0xc42a1fffe6d7ca6),
+		Time:          time.Unix(1653574589, 806097770),
+		ClockClass:    ptp.ClockClass6,
+		ClockAccuracy: ptp.ClockAccuracyNanosecond100,
+	}
+	b := s.MarshalSigned(testKey)
+	require.Equal(t, StatementSize, len(b))
+
+	got, err := UnmarshalSigned(b, testKey)
+	require.NoError(t, err)
+	require.Equal(t, s.ClockIdentity, got.ClockIdentity)
+	require.True(t, s.Time.Equal(got.Time))
+	require.Equal(t, s.ClockClass, got.ClockClass)
+	require.Equal(t, s.ClockAccuracy, got.ClockAccuracy)
+
+	_, err = UnmarshalSigned(b, []byte("wrong"))
+	require.ErrorIs(t, err, errBadSignature)
+
+	b[10]++
+	_, err = UnmarshalSigned(b, testKey)
+	require.ErrorIs(t, err, errBadSignature)
+
+	_, err = UnmarshalSigned(b[:10], testKey)
+	require.ErrorIs(t, err, errBadSize)
+}
+
+func newTestMonitor(now time.Time) *Monitor {
+	m := NewMonitor(
+		&Config{Key: testKey, Interval: time.Second, MaxOffset: time.Millisecond},
+		ptp.ClockIdentity(1),
+		func() (time.Time, error) { return now, nil },
+		func() (ptp.ClockClass, ptp.ClockAccuracy) { return ptp.ClockClass6, ptp.ClockAccuracyNanosecond100 },
+	)
+	m.clock = func() time.Time { return now }
+	return m
+}
+
+func signed(id ptp.ClockIdentity, t time.Time, class ptp.ClockClass) []byte {
+	s := &Statement{ClockIdentity: id, Time: t, ClockClass: class}
+	return s.MarshalSigned(testKey)
+}
+
+func TestMonitorHandle(t *testing.T) {
+	now := time.Unix(1653574589, 0)
+	m := newTestMonitor(now)
+
+	require.NoError(t, m.handle(signed(2, now.Add(-time.Microsecond), ptp.ClockClass6)))
+	require.Equal(t, map[ptp.ClockIdentity]time.Duration{2: time.Microsecond}, m.Offsets())
+
+	// replay
+	require.Error(t, m.handle(signed(2, now.Add(-time.Microsecond), ptp.ClockClass6)))
+	// own statement
+	require.Error(t, m.handle(signed(1, now, ptp.ClockClass6)))
+	// peer in bad shape has no vote
+	require.NoError(t, m.handle(signed(3, now, ptp.ClockClass52)))
+	require.Equal(t, 1, len(m.Offsets()))
+}
+
+func TestMonitorDrifted(t *testing.T) {
+	now := time.Unix(1653574589, 0)
+	m := newTestMonitor(now)
+	require.False(t, m.Drifted())
+
+	require.NoError(t, m.handle(signed(2, now.Add(time.Second), ptp.ClockClass6)))
+	require.True(t, m.Drifted())
+
+	require.NoError(t, m.handle(signed(3, now, ptp.ClockClass6)))
+	require.False(t, m.Drifted())
+
+	require.NoError(t, m.handle(signed(4, now.Add(-time.Second), ptp.ClockClass7)))
+	require.True(t, m.Drifted())
+
+	// peers go silent
+	m.clock = func() time.Time { return now.Add(time.Minute) }
+	require.False(t, m.Drifted())
+	require.Equal(t, 0, len(m.Offsets()))
+}
+
+func TestMonitorRun(t *testing.T) {
+	connA, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	connB, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	now := func() (time.Time, error) { return time.Now(), nil }
+	quality := func() (ptp.ClockClass, ptp.ClockAccuracy) { return ptp.ClockClass6, ptp.ClockAccuracyNanosecond100 }
+	a := NewMonitor(&Config{Peers: []string{connB.LocalAddr().String()}, Key: testKey, Interval: 10 * time.Millisecond, MaxOffset: time.Second}, 1, now, quality)
+	b := NewMonitor(&Config{Peers: []string{connA.LocalAddr().String()}, Key: testKey, Interval: 10 * time.Millisecond, MaxOffset: time.Second}, 2, now, quality)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx, connA)
+	go b.Run(ctx, connB)
+
+	require.Eventually(t, func() bool {
+		_, ok := a.Offsets()[2]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, a.Drifted())
+}
@@ -0,0 +1,201 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package seccomp restricts ptp4u to the syscalls it needs with a seccomp-bpf filter.
+
+The filter is applied to all threads of the process once the server is initialized,
+so a compromised packet parser can't exec, ptrace, load modules or mount.
+*/
+package seccomp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ModeStrict kills the process on a syscall which is not allowed
+	ModeStrict = "strict"
+	// ModeLog logs syscalls which are not allowed to the audit log and lets them through
+	ModeLog = "log"
+)
+
+// from include/uapi/linux/seccomp.h
+const (
+	setModeFilter   = 1
+	filterFlagTSYNC = 1
+
+	retKillProcess = 0x80000000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+)
+
+// offsets in struct seccomp_data
+const (
+	dataNrOffset   = 0
+	dataArchOffset = 4
+)
+
+// action returns what the filter does with syscalls which are not allowed in mode
+func action(mode string) (uint32, error) {
+	switch mode {
+	case ModeStrict:
+		return retKillProcess, nil
+	case ModeLog:
+		return retLog, nil
+	default:
+		return 0, fmt.Errorf("unrecognized seccomp mode: %q", mode)
+	}
+}
+
+// Filter returns the seccomp program allowing the syscalls ptp4u needs of the native architecture
+func Filter(mode string) ([]bpf.Instruction, error) {
+	act, err := action(mode)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("seccomp is not supported on %s", runtime.GOARCH)
+	}
+	prog := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: dataArchOffset, Size: 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: auditArch, SkipTrue: 1},
+		bpf.RetConstant{Val: act},
+		bpf.LoadAbsolute{Off: dataNrOffset, Size: 4},
+	}
+	for _, nr := range allowed {
+		prog = append(prog,
+			bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(nr), SkipTrue: 1},
+			bpf.RetConstant{Val: retAllow},
+		)
+	}
+	return append(prog, bpf.RetConstant{Val: act}), nil
+}
+
+// Apply installs the filter on all threads of the process. It can't be undone
+func Apply(mode string) error {
+	prog, err := Filter(mode)
+	if err != nil {
+		return err
+	}
+	raw, err := bpf.Assemble(prog)
+	if err != nil {
+		return fmt.Errorf("assembling seccomp filter: %w", err)
+	}
+	filter := make([]unix.SockFilter, len(raw))
+	for i, r := range raw {
+		filter[i] = unix.SockFilter{Code: r.Op, Jt: r.Jt, Jf: r.Jf, K: r.K}
+	}
+	fprog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	// no_new_privs is per thread, TSYNC propagates it from the calling one
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("setting no_new_privs: %w", err)
+	}
+	r1, _, errno := unix.Syscall(unix.SYS_SECCOMP, setModeFilter, filterFlagTSYNC, uintptr(unsafe.Pointer(&fprog)))
+	if errno != 0 {
+		return fmt.Errorf("installing seccomp filter: %w", errno)
+	}
+	// with TSYNC positive result is the ID of the thread which couldn't be synchronized
+	if r1 != 0 {
+		return fmt.Errorf("installing seccomp filter: unable to synchronize thread %d", r1)
+	}
+	return nil
+}
+
+// Probe exercises a periodic path of ptp4u, such as the UTC offset check or the servo,
+// so the syscalls it makes are checked at startup rather than when it first runs
+type Probe struct {
+	Name string
+	Run  func() error
+}
+
+// SelfTest checks the filter is enforced on every thread of the process and that what ptp4u does
+// after initialization still works under it: reading files, creating sockets, reading clocks and the probes.
+// In strict mode a syscall missing from the allow list kills the process at startup instead of under load
+func SelfTest(probes ...Probe) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		mode, err := seccompMode(filepath.Join("/proc/self/task", t.Name(), "status"))
+		if os.IsNotExist(err) {
+			// thread exited
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if mode != unix.SECCOMP_MODE_FILTER {
+			return fmt.Errorf("seccomp filter is not enforced on thread %s, mode %d", t.Name(), mode)
+		}
+	}
+	fd, err := unix.Socket(unix.AF_INET6, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		fd, err = unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	}
+	if err != nil {
+		return fmt.Errorf("creating socket: %w", err)
+	}
+	if err := unix.Close(fd); err != nil {
+		return err
+	}
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_REALTIME, &ts); err != nil {
+		return fmt.Errorf("reading clock: %w", err)
+	}
+	time.Sleep(time.Millisecond)
+	for _, p := range probes {
+		if err := p.Run(); err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// seccompMode reads seccomp mode from the status file of a task
+func seccompMode(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Seccomp:") {
+			return strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Seccomp:")))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no seccomp mode in %s", path)
+}
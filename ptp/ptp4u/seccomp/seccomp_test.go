@@ -0,0 +1,115 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seccomp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// seccompData encodes struct seccomp_data. The BPF VM loads words in network byte order
+func seccompData(nr int, arch uint32) []byte {
+	b := make([]byte, 64)
+	binary.BigEndian.PutUint32(b[dataNrOffset:], uint32(nr))
+	binary.BigEndian.PutUint32(b[dataArchOffset:], arch)
+	return b
+}
+
+func runFilter(t *testing.T, mode string, nr int, arch uint32) uint32 {
+	prog, err := Filter(mode)
+	require.NoError(t, err)
+	vm, err := bpf.NewVM(prog)
+	require.NoError(t, err)
+	res, err := vm.Run(seccompData(nr, arch))
+	require.NoError(t, err)
+	return uint32(res)
+}
+
+func TestFilter(t *testing.T) {
+	_, err := Filter("lenient")
+	require.Error(t, err)
+
+	require.Equal(t, uint32(retAllow), runFilter(t, ModeStrict, unix.SYS_RECVMSG, auditArch))
+	require.Equal(t, uint32(retAllow), runFilter(t, ModeStrict, unix.SYS_SENDTO, auditArch))
+	require.Equal(t, uint32(retAllow), runFilter(t, ModeStrict, unix.SYS_CLOCK_ADJTIME, auditArch))
+	require.Equal(t, uint32(retKillProcess), runFilter(t, ModeStrict, unix.SYS_EXECVE, auditArch))
+	require.Equal(t, uint32(retKillProcess), runFilter(t, ModeStrict, unix.SYS_PTRACE, auditArch))
+	require.Equal(t, uint32(retLog), runFilter(t, ModeLog, unix.SYS_EXECVE, auditArch))
+	require.Equal(t, uint32(retAllow), runFilter(t, ModeLog, unix.SYS_FUTEX, auditArch))
+	// foreign architecture syscall numbers mean something else
+	require.Equal(t, uint32(retKillProcess), runFilter(t, ModeStrict, unix.SYS_RECVMSG, auditArch+1))
+}
+
+func TestFilterAssembles(t *testing.T) {
+	prog, err := Filter(ModeStrict)
+	require.NoError(t, err)
+	raw, err := bpf.Assemble(prog)
+	require.NoError(t, err)
+	// BPF_MAXINSNS
+	require.Less(t, len(raw), 4096)
+}
+
+func TestSeccompMode(t *testing.T) {
+	mode, err := seccompMode("/proc/self/status")
+	require.NoError(t, err)
+	require.Equal(t, unix.SECCOMP_MODE_DISABLED, mode)
+
+	_, err = seccompMode("/proc/self/nonexistent")
+	require.True(t, os.IsNotExist(err))
+}
+
+// TestApply applies the strict filter in a child process, as it can't be undone
+func TestApply(t *testing.T) {
+	if os.Getenv("SECCOMP_TEST_CHILD") == "1" {
+		if err := Apply(ModeStrict); err != nil {
+			os.Exit(2)
+		}
+		tai := Probe{Name: "kernel TAI offset", Run: func() error {
+			_, err := unix.ClockAdjtime(unix.CLOCK_REALTIME, &unix.Timex{})
+			return err
+		}}
+		if err := SelfTest(tai); err != nil {
+			os.Exit(3)
+		}
+		fmt.Print("self test passed")
+		// killed by the filter
+		_ = unix.Setuid(0)
+		os.Exit(0)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestApply$")
+	cmd.Env = append(os.Environ(), "SECCOMP_TEST_CHILD=1")
+	out, err := cmd.Output()
+	exitErr, ok := err.(*exec.ExitError)
+	require.True(t, ok, "expected the child to be killed, got %v", err)
+	if exitErr.ExitCode() == 2 {
+		t.Skip("seccomp filters are not permitted in this environment")
+	}
+	require.NotEqual(t, 3, exitErr.ExitCode(), "self test failed")
+	require.Contains(t, string(out), "self test passed")
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	require.True(t, ok)
+	require.True(t, status.Signaled())
+	require.Equal(t, syscall.SIGSYS, status.Signal())
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package seccomp
+
+import "golang.org/x/sys/unix"
+
+const auditArch = unix.AUDIT_ARCH_AARCH64
+
+// allowed are the syscalls ptp4u and the Go runtime need after initialization
+var allowed = []uintptr{
+	// memory, threads and runtime, including threads started by libc
+	unix.SYS_MMAP,
+	unix.SYS_MUNMAP,
+	unix.SYS_MPROTECT,
+	unix.SYS_MADVISE,
+	unix.SYS_MINCORE,
+	unix.SYS_BRK,
+	unix.SYS_FUTEX,
+	unix.SYS_CLONE,
+	unix.SYS_CLONE3,
+	unix.SYS_SET_ROBUST_LIST,
+	unix.SYS_RSEQ,
+	unix.SYS_SCHED_YIELD,
+	unix.SYS_SCHED_GETAFFINITY,
+	unix.SYS_GETPID,
+	unix.SYS_GETTID,
+	unix.SYS_TGKILL,
+	unix.SYS_EXIT,
+	unix.SYS_EXIT_GROUP,
+	unix.SYS_RESTART_SYSCALL,
+	unix.SYS_RT_SIGACTION,
+	unix.SYS_RT_SIGPROCMASK,
+	unix.SYS_RT_SIGRETURN,
+	unix.SYS_SIGALTSTACK,
+	unix.SYS_SETITIMER,
+	unix.SYS_TIMER_CREATE,
+	unix.SYS_TIMER_SETTIME,
+	unix.SYS_TIMER_DELETE,
+	unix.SYS_PRLIMIT64,
+	unix.SYS_UNAME,
+	unix.SYS_GETRANDOM,
+	// time, including the kernel TAI offset read and the servo steering the PHC
+	unix.SYS_CLOCK_GETTIME,
+	unix.SYS_CLOCK_ADJTIME,
+	unix.SYS_CLOCK_GETRES,
+	unix.SYS_CLOCK_NANOSLEEP,
+	unix.SYS_NANOSLEEP,
+	unix.SYS_GETTIMEOFDAY,
+	// files: config, leap second file, blocklist, pid file
+	unix.SYS_OPENAT,
+	unix.SYS_READ,
+	unix.SYS_WRITE,
+	unix.SYS_READV,
+	unix.SYS_WRITEV,
+	unix.SYS_PREAD64,
+	unix.SYS_PWRITE64,
+	unix.SYS_LSEEK,
+	unix.SYS_CLOSE,
+	unix.SYS_FSTAT,
+	unix.SYS_STATX,
+	unix.SYS_GETDENTS64,
+	unix.SYS_READLINKAT,
+	unix.SYS_UNLINKAT,
+	unix.SYS_RENAMEAT,
+	unix.SYS_RENAMEAT2,
+	unix.SYS_FCHMOD,
+	unix.SYS_FCHMODAT,
+	unix.SYS_FSYNC,
+	unix.SYS_FTRUNCATE,
+	unix.SYS_FCNTL,
+	unix.SYS_IOCTL,
+	unix.SYS_PIPE2,
+	unix.SYS_EVENTFD2,
+	unix.SYS_EPOLL_CREATE1,
+	unix.SYS_EPOLL_CTL,
+	unix.SYS_EPOLL_PWAIT,
+	unix.SYS_PPOLL,
+	unix.SYS_PSELECT6,
+	// network: PTP, tunnel, management socket, stats, webhooks
+	unix.SYS_SOCKET,
+	unix.SYS_SOCKETPAIR,
+	unix.SYS_BIND,
+	unix.SYS_LISTEN,
+	unix.SYS_ACCEPT4,
+	unix.SYS_CONNECT,
+	unix.SYS_SHUTDOWN,
+	unix.SYS_GETSOCKNAME,
+	unix.SYS_GETPEERNAME,
+	unix.SYS_SETSOCKOPT,
+	unix.SYS_GETSOCKOPT,
+	unix.SYS_SENDTO,
+	unix.SYS_RECVFROM,
+	unix.SYS_SENDMSG,
+	unix.SYS_RECVMSG,
+	unix.SYS_SENDMMSG,
+	unix.SYS_RECVMMSG,
+	unix.SYS_FSTATAT,
+	unix.SYS_GETRLIMIT,
+}
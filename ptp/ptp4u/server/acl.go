@@ -0,0 +1,233 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ACL controls which clients may subscribe and how much
+type ACL struct {
+	// Allow are client networks in CIDR notation which may subscribe. Everyone if empty
+	Allow []string
+	// Deny are client networks which may not subscribe. Takes precedence over Allow
+	Deny []string
+	// MaxSubscriptions limits running subscriptions per client IP. 0 is unlimited
+	MaxSubscriptions int64
+	// SignalingRate limits grant requests per second per client IP. 0 is unlimited
+	SignalingRate float64
+	// SignalingBurst is the number of grant requests a client may send at once. SignalingRate rounded up if 0
+	SignalingBurst int
+
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// ReadACL reads the ACL from the file
+func ReadACL(path string) (*ACL, error) {
+	acl := &ACL{}
+	cData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(cData, acl); err != nil {
+		return nil, err
+	}
+	if err := acl.parse(); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// parse validates the ACL and parses the prefixes
+func (a *ACL) parse() error {
+	if a.MaxSubscriptions < 0 || a.SignalingRate < 0 || a.SignalingBurst < 0 {
+		return fmt.Errorf("acl limits must not be negative")
+	}
+	if a.SignalingBurst == 0 && a.SignalingRate > 0 {
+		a.SignalingBurst = int(a.SignalingRate)
+		if float64(a.SignalingBurst) < a.SignalingRate {
+			a.SignalingBurst++
+		}
+	}
+	a.allow, a.deny = nil, nil
+	for _, p := range a.Allow {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("acl allow: %w", err)
+		}
+		a.allow = append(a.allow, n)
+	}
+	for _, p := range a.Deny {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("acl deny: %w", err)
+		}
+		a.deny = append(a.deny, n)
+	}
+	return nil
+}
+
+// aclDenied checks the grant request of the client against the ACL and the request rate.
+// Returns the reason of the denial, empty if the request may proceed
+func (s *Server) aclDenied(ip net.IP) string {
+	if !s.Config.acl.Allowed(ip) {
+		s.Stats.IncDeniedACL()
+		return "acl"
+	}
+	if !s.Config.acl.AllowRequest(ip) {
+		s.Stats.IncDeniedRateLimit()
+		return "rate_limit"
+	}
+	return ""
+}
+
+// rateBucket is a token bucket of a single client
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// accessControl enforces the ACL and keeps track of the per client subscriptions and request rates.
+// Subscriptions are counted by client IP, so they survive the ACL reload. nil accessControl allows everything
+type accessControl struct {
+	sync.Mutex
+	acl     *ACL
+	subs    map[string]int64
+	buckets map[string]*rateBucket
+	now     func() time.Time
+}
+
+func newAccessControl(acl *ACL) *accessControl {
+	return &accessControl{
+		acl:     acl,
+		subs:    map[string]int64{},
+		buckets: map[string]*rateBucket{},
+		now:     time.Now,
+	}
+}
+
+// update replaces the ACL
+func (ac *accessControl) update(acl *ACL) {
+	ac.Lock()
+	defer ac.Unlock()
+	ac.acl = acl
+}
+
+// Allowed reports whether the client may subscribe according to the allow and deny lists
+func (ac *accessControl) Allowed(ip net.IP) bool {
+	if ac == nil {
+		return true
+	}
+	ac.Lock()
+	defer ac.Unlock()
+	for _, n := range ac.acl.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(ac.acl.allow) == 0 {
+		return true
+	}
+	for _, n := range ac.acl.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowRequest reports whether a grant request of the client is within the signaling rate
+func (ac *accessControl) AllowRequest(ip net.IP) bool {
+	if ac == nil {
+		return true
+	}
+	ac.Lock()
+	defer ac.Unlock()
+	if ac.acl.SignalingRate == 0 {
+		return true
+	}
+	key := ip.String()
+	now := ac.now()
+	burst := float64(ac.acl.SignalingBurst)
+	b, ok := ac.buckets[key]
+	if !ok {
+		b = &rateBucket{tokens: burst, last: now}
+		ac.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * ac.acl.SignalingRate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Acquire takes a subscription slot of the client and returns the key to release it with.
+// Returns false if the client is at the limit
+func (ac *accessControl) Acquire(ip net.IP) (string, bool) {
+	if ac == nil {
+		return "", true
+	}
+	key := ip.String()
+	ac.Lock()
+	defer ac.Unlock()
+	if ac.acl.MaxSubscriptions > 0 && ac.subs[key] >= ac.acl.MaxSubscriptions {
+		return "", false
+	}
+	ac.subs[key]++
+	return key, true
+}
+
+// Release frees a subscription slot taken by Acquire
+func (ac *accessControl) Release(key string) {
+	if ac == nil || key == "" {
+		return
+	}
+	ac.Lock()
+	defer ac.Unlock()
+	ac.subs[key]--
+	if ac.subs[key] <= 0 {
+		delete(ac.subs, key)
+	}
+}
+
+// prune forgets the rate state of clients whose buckets are full again
+func (ac *accessControl) prune() {
+	if ac == nil {
+		return
+	}
+	ac.Lock()
+	defer ac.Unlock()
+	now := ac.now()
+	for key, b := range ac.buckets {
+		if ac.acl.SignalingRate == 0 || b.tokens+now.Sub(b.last).Seconds()*ac.acl.SignalingRate >= float64(ac.acl.SignalingBurst) {
+			delete(ac.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadACL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+allow:
+- 2001:db8::/32
+- 192.168.0.0/16
+deny:
+- 192.168.1.0/24
+maxsubscriptions: 3
+signalingrate: 2.5
+`), 0644))
+	acl, err := ReadACL(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(acl.allow))
+	require.Equal(t, 1, len(acl.deny))
+	require.Equal(t, int64(3), acl.MaxSubscriptions)
+	require.Equal(t, 2.5, acl.SignalingRate)
+	require.Equal(t, 3, acl.SignalingBurst)
+
+	require.NoError(t, os.WriteFile(path, []byte("deny:\n- lol\n"), 0644))
+	_, err = ReadACL(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("maxsubscriptions: -1\n"), 0644))
+	_, err = ReadACL(path)
+	require.Error(t, err)
+}
+
+func TestAccessControlAllowed(t *testing.T) {
+	var nilAC *accessControl
+	require.True(t, nilAC.Allowed(net.ParseIP("10.0.0.1")))
+
+	acl := &ACL{Deny: []string{"10.0.0.0/8"}}
+	require.NoError(t, acl.parse())
+	ac := newAccessControl(acl)
+	require.False(t, ac.Allowed(net.ParseIP("10.0.0.1")))
+	require.True(t, ac.Allowed(net.ParseIP("192.168.0.1")))
+
+	acl = &ACL{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.1.0.0/16"}}
+	require.NoError(t, acl.parse())
+	ac.update(acl)
+	require.True(t, ac.Allowed(net.ParseIP("10.0.0.1")))
+	require.False(t, ac.Allowed(net.ParseIP("10.1.0.1")))
+	require.False(t, ac.Allowed(net.ParseIP("192.168.0.1")))
+}
+
+func TestAccessControlAllowRequest(t *testing.T) {
+	acl := &ACL{SignalingRate: 1, SignalingBurst: 2}
+	require.NoError(t, acl.parse())
+	ac := newAccessControl(acl)
+	now := time.Unix(1000, 0)
+	ac.now = func() time.Time { return now }
+
+	ip := net.ParseIP("10.0.0.1")
+	require.True(t, ac.AllowRequest(ip))
+	require.True(t, ac.AllowRequest(ip))
+	require.False(t, ac.AllowRequest(ip))
+	// other clients have own budget
+	require.True(t, ac.AllowRequest(net.ParseIP("10.0.0.2")))
+
+	now = now.Add(time.Second)
+	require.True(t, ac.AllowRequest(ip))
+	require.False(t, ac.AllowRequest(ip))
+
+	// full buckets are forgotten
+	now = now.Add(time.Minute)
+	ac.prune()
+	require.Empty(t, ac.buckets)
+}
+
+func TestAccessControlAcquire(t *testing.T) {
+	acl := &ACL{MaxSubscriptions: 2}
+	require.NoError(t, acl.parse())
+	ac := newAccessControl(acl)
+
+	ip := net.ParseIP("10.0.0.1")
+	key, ok := ac.Acquire(ip)
+	require.True(t, ok)
+	require.Equal(t, "10.0.0.1", key)
+	_, ok = ac.Acquire(ip)
+	require.True(t, ok)
+	_, ok = ac.Acquire(ip)
+	require.False(t, ok)
+
+	ac.Release(key)
+	_, ok = ac.Acquire(ip)
+	require.True(t, ok)
+
+	// slots survive the reload
+	ac.update(&ACL{MaxSubscriptions: 1})
+	_, ok = ac.Acquire(ip)
+	require.False(t, ok)
+}
+
+func TestACLDenied(t *testing.T) {
+	acl := &ACL{Deny: []string{"10.1.0.0/16"}, SignalingRate: 1, SignalingBurst: 1}
+	require.NoError(t, acl.parse())
+	c := &Config{acl: newAccessControl(acl)}
+	s := &Server{Config: c, Stats: stats.NewJSONStats()}
+
+	require.Equal(t, "acl", s.aclDenied(net.ParseIP("10.1.0.1")))
+	require.Equal(t, "", s.aclDenied(net.ParseIP("10.0.0.1")))
+	require.Equal(t, "rate_limit", s.aclDenied(net.ParseIP("10.0.0.1")))
+}
@@ -0,0 +1,189 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// zoneinfoDirs are the locations of the system time zone database, in the order of time.LoadLocation
+var zoneinfoDirs = []string{"/usr/share/zoneinfo/", "/usr/share/lib/zoneinfo/", "/usr/lib/locale/TZ/"}
+
+// altTimeHorizon is how far ahead the next DST transition is looked for
+const altTimeHorizon = 366 * 24 * time.Hour
+
+// altTimeStep is the step of the transition search. Transitions of a zone are months apart
+const altTimeStep = 6 * time.Hour
+
+// altTimeOffset serves the local time of a time zone in the ALTERNATE_TIME_OFFSET_INDICATOR TLV of Announce messages.
+// The zone is re-read when its time zone database file changes, and the offset and the next jump
+// follow the DST transitions, so the TLV never needs to be edited by hand
+type altTimeOffset struct {
+	zone string
+
+	sync.Mutex
+	// file the zone was read from and its modification time. Empty if it's built into the binary
+	file    string
+	modTime time.Time
+	loc     *time.Location
+	tlv     *ptp.AlternateTimeOffsetIndicatorTLV
+	// the TLV is valid until the next jump, or until the zone or the UTC offset change. Zero if it needs an update
+	validUntil time.Time
+	utcOffset  time.Duration
+}
+
+func newAltTimeOffset(zone string) (*altTimeOffset, error) {
+	a := &altTimeOffset{zone: zone}
+	if _, err := a.load(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// zoneFile returns the time zone database file of the zone and its modification time, empty if there is none
+func zoneFile(zone string) (string, time.Time) {
+	dirs := zoneinfoDirs
+	if dir := os.Getenv("ZONEINFO"); dir != "" {
+		dirs = append([]string{dir}, dirs...)
+	}
+	for _, dir := range dirs {
+		f := filepath.Join(dir, zone)
+		if st, err := os.Stat(f); err == nil && st.Mode().IsRegular() {
+			return f, st.ModTime()
+		}
+	}
+	return "", time.Time{}
+}
+
+// load re-reads the zone if its file changed. Returns whether it did
+func (a *altTimeOffset) load() (bool, error) {
+	file, modTime := zoneFile(a.zone)
+	a.Lock()
+	unchanged := a.loc != nil && file == a.file && modTime.Equal(a.modTime)
+	a.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var loc *time.Location
+	var err error
+	if file == "" {
+		loc, err = time.LoadLocation(a.zone)
+	} else {
+		var data []byte
+		if data, err = os.ReadFile(file); err == nil {
+			loc, err = time.LoadLocationFromTZData(a.zone, data)
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("loading time zone %q: %w", a.zone, err)
+	}
+	a.Lock()
+	defer a.Unlock()
+	a.file, a.modTime, a.loc = file, modTime, loc
+	a.validUntil = time.Time{}
+	return true, nil
+}
+
+// nextTransition returns the first time after from within the horizon the UTC offset of the zone changes.
+// Zero if there is none
+func nextTransition(loc *time.Location, from time.Time, horizon time.Duration) time.Time {
+	_, offset := from.In(loc).Zone()
+	lo := from
+	for hi := from.Add(altTimeStep); hi.Sub(from) <= horizon; lo, hi = hi, hi.Add(altTimeStep) {
+		if _, o := hi.In(loc).Zone(); o == offset {
+			continue
+		}
+		// offset changed in (lo, hi], narrow it down to the second
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		return hi
+	}
+	return time.Time{}
+}
+
+// update recomputes the TLV at now if it's no longer valid. The jump is announced in PTP seconds, TAI
+func (a *altTimeOffset) update(now time.Time, utcOffset time.Duration) {
+	a.Lock()
+	defer a.Unlock()
+	if a.tlv != nil && utcOffset == a.utcOffset && now.Before(a.validUntil) {
+		return
+	}
+	name, offset := now.In(a.loc).Zone()
+	tlv := &ptp.AlternateTimeOffsetIndicatorTLV{
+		TLVHead:       ptp.TLVHead{TLVType: ptp.TLVAlternateTimeOffsetIndicator},
+		CurrentOffset: int32(offset),
+		DisplayName:   ptp.PTPText(name),
+	}
+	next := nextTransition(a.loc, now.Truncate(time.Second), altTimeHorizon)
+	if !next.IsZero() {
+		_, nextOffset := next.In(a.loc).Zone()
+		tlv.JumpSeconds = int32(nextOffset - offset)
+		tlv.TimeOfNextJump = ptp.NewPTPSeconds(next.Add(utcOffset))
+	}
+	text, _ := tlv.DisplayName.MarshalBinary()
+	tlv.LengthField = uint16(15 + len(text))
+	a.tlv = tlv
+	a.utcOffset = utcOffset
+	a.validUntil = next
+	if next.IsZero() {
+		a.validUntil = now.Add(altTimeHorizon)
+	}
+}
+
+// TLV returns the TLV to announce, nil if the alternate time offset isn't served
+func (a *altTimeOffset) TLV() *ptp.AlternateTimeOffsetIndicatorTLV {
+	if a == nil {
+		return nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	return a.tlv
+}
+
+// startAltTimeOffset checks the time zone database every interval and updates the TLV every second,
+// so the new offset is announced as soon as the jump occurs. DST transitions occur at whole seconds
+func (s *Server) startAltTimeOffset() {
+	clock := s.Config.Clock()
+	checked := time.Now()
+	for {
+		if time.Since(checked) >= s.Config.AltTimeZoneInterval {
+			if reloaded, err := s.Config.altTime.load(); err != nil {
+				log.Errorf("Failed to read time zone database: %v", err)
+			} else if reloaded {
+				log.Infof("Time zone %s changed in the time zone database", s.Config.AltTimeZone)
+			}
+			checked = time.Now()
+		}
+		now := clock.Now()
+		s.Config.altTime.update(now, s.Config.UTCOffset)
+		time.Sleep(clock.Wall(now.Truncate(time.Second).Add(time.Second).Sub(now)))
+	}
+}
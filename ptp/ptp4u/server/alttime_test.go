@@ -0,0 +1,161 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextTransition(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+
+	// DST starts at 2am local time on the second Sunday of March
+	start := time.Date(2026, time.March, 8, 10, 0, 0, 0, time.UTC)
+	require.Equal(t, start, nextTransition(la, time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), altTimeHorizon).UTC())
+	require.Equal(t, start, nextTransition(la, start.Add(-time.Second), altTimeHorizon).UTC())
+	// and ends at 2am local time on the first Sunday of November
+	end := time.Date(2026, time.November, 1, 9, 0, 0, 0, time.UTC)
+	require.Equal(t, end, nextTransition(la, start, altTimeHorizon).UTC())
+
+	// nothing within the horizon
+	require.True(t, nextTransition(la, start, 30*24*time.Hour).IsZero())
+	require.True(t, nextTransition(time.UTC, start, altTimeHorizon).IsZero())
+}
+
+func TestAltTimeOffsetUpdate(t *testing.T) {
+	a, err := newAltTimeOffset("America/Los_Angeles")
+	require.NoError(t, err)
+	start := time.Date(2026, time.March, 8, 10, 0, 0, 0, time.UTC)
+	end := time.Date(2026, time.November, 1, 9, 0, 0, 0, time.UTC)
+
+	a.update(start.Add(-time.Second), 37*time.Second)
+	tlv := a.TLV()
+	require.Equal(t, int32(-8*3600), tlv.CurrentOffset)
+	require.Equal(t, int32(3600), tlv.JumpSeconds)
+	require.Equal(t, uint64(start.Unix()+37), tlv.TimeOfNextJump.Seconds())
+	require.Equal(t, ptp.PTPText("PST"), tlv.DisplayName)
+
+	// valid until the jump
+	a.update(start.Add(-time.Millisecond), 37*time.Second)
+	require.Same(t, tlv, a.TLV())
+
+	a.update(start, 37*time.Second)
+	tlv = a.TLV()
+	require.Equal(t, int32(-7*3600), tlv.CurrentOffset)
+	require.Equal(t, int32(-3600), tlv.JumpSeconds)
+	require.Equal(t, uint64(end.Unix()+37), tlv.TimeOfNextJump.Seconds())
+	require.Equal(t, ptp.PTPText("PDT"), tlv.DisplayName)
+
+	// UTC offset change moves the jump on the PTP timescale
+	a.update(start, 38*time.Second)
+	require.Equal(t, uint64(end.Unix()+38), a.TLV().TimeOfNextJump.Seconds())
+
+	b := make([]byte, 64)
+	n, err := a.TLV().MarshalBinaryTo(b)
+	require.NoError(t, err)
+	require.Equal(t, 4+int(a.TLV().LengthField), n)
+	require.Zero(t, n%2)
+	decoded := &ptp.AlternateTimeOffsetIndicatorTLV{}
+	require.NoError(t, decoded.UnmarshalBinary(b[:n]))
+	require.Equal(t, a.TLV(), decoded)
+
+	// zones with no DST never jump
+	u, err := newAltTimeOffset("UTC")
+	require.NoError(t, err)
+	u.update(start, 37*time.Second)
+	require.Equal(t, int32(0), u.TLV().CurrentOffset)
+	require.Equal(t, int32(0), u.TLV().JumpSeconds)
+	require.True(t, u.TLV().TimeOfNextJump.Empty())
+
+	_, err = newAltTimeOffset("Nowhere/Atlantis")
+	require.Error(t, err)
+}
+
+func TestAltTimeOffsetReload(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ZONEINFO", dir)
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	laFile, _ := zoneFile("America/Los_Angeles")
+	if laFile == "" {
+		t.Skip("no system time zone database")
+	}
+	data, err := os.ReadFile(laFile)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "Test", "Zone")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	a, err := newAltTimeOffset("Test/Zone")
+	require.NoError(t, err)
+	now := time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)
+	a.update(now, 37*time.Second)
+	_, offset := now.In(la).Zone()
+	require.Equal(t, int32(offset), a.TLV().CurrentOffset)
+
+	reloaded, err := a.load()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	// tzdata update replaces the zone with Tokyo rules
+	tokyo, _ := zoneFile("Asia/Tokyo")
+	data, err = os.ReadFile(tokyo)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	require.NoError(t, os.Chtimes(path, now, now))
+	reloaded, err = a.load()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+	a.update(now, 37*time.Second)
+	require.Equal(t, int32(9*3600), a.TLV().CurrentOffset)
+	require.True(t, a.TLV().TimeOfNextJump.Empty())
+}
+
+func TestAnnounceAltTime(t *testing.T) {
+	a, err := newAltTimeOffset("America/Los_Angeles")
+	require.NoError(t, err)
+	a.update(time.Now(), 37*time.Second)
+	c := &Config{DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.UpdateAnnounce()
+	require.Empty(t, sc.Announce().TLVs)
+	length := sc.Announce().MessageLength
+
+	c.altTime = a
+	sc.UpdateAnnounce()
+	b, err := ptp.Bytes(sc.Announce())
+	require.NoError(t, err)
+	require.Equal(t, len(b)-2, int(sc.Announce().MessageLength))
+	decoded := &ptp.Announce{}
+	require.NoError(t, ptp.FromBytes(b, decoded))
+	require.Equal(t, []ptp.TLV{a.TLV()}, decoded.TLVs)
+
+	c.altTime = nil
+	sc.UpdateAnnounce()
+	require.Empty(t, sc.Announce().TLVs)
+	require.Equal(t, length, sc.Announce().MessageLength)
+}
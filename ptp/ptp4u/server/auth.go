@@ -0,0 +1,177 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// AuthKey is a key of the security association
+type AuthKey struct {
+	ID uint32
+	// Key is the HMAC-SHA256 key in hex
+	Key string
+	// ICVLength truncates the ICV to the given number of bytes. Full 32 bytes if 0
+	ICVLength int
+}
+
+// AuthConfig configures authentication of PTP messages with the AUTHENTICATION TLV
+type AuthConfig struct {
+	// SPP is the security parameter pointer of the security association
+	SPP uint8
+	// SendKey is the ID of the key outgoing messages are authenticated with
+	SendKey uint32
+	// Required drops received messages without the AUTHENTICATION TLV.
+	// Otherwise only the messages with an invalid one are dropped
+	Required bool
+	// Keys are the keys received messages are accepted with
+	Keys []AuthKey
+
+	auth *ptp.Authenticator
+}
+
+// ReadAuthConfig reads the authentication config from the file
+func ReadAuthConfig(path string) (*AuthConfig, error) {
+	ac := &AuthConfig{}
+	cData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(cData, ac); err != nil {
+		return nil, err
+	}
+	if err := ac.parse(); err != nil {
+		return nil, err
+	}
+	return ac, nil
+}
+
+// parse decodes the keys and sets up the authenticator
+func (ac *AuthConfig) parse() error {
+	keys := make([]*ptp.AuthKey, 0, len(ac.Keys))
+	for _, k := range ac.Keys {
+		key, err := hex.DecodeString(k.Key)
+		if err != nil {
+			return fmt.Errorf("decoding key %d: %w", k.ID, err)
+		}
+		keys = append(keys, &ptp.AuthKey{ID: k.ID, Key: key, ICVLength: k.ICVLength})
+	}
+	auth, err := ptp.NewAuthenticator(ac.SPP, ac.SendKey, keys)
+	if err != nil {
+		return err
+	}
+	ac.auth = auth
+	return nil
+}
+
+// messageAuth authenticates sent and verifies received messages.
+// Methods are safe to call on nil, which disables authentication
+type messageAuth struct {
+	sync.RWMutex
+	config *AuthConfig
+}
+
+func newMessageAuth(ac *AuthConfig) *messageAuth {
+	return &messageAuth{config: ac}
+}
+
+// update replaces the keys, so they can be rotated without a restart
+func (ma *messageAuth) update(ac *AuthConfig) {
+	ma.Lock()
+	defer ma.Unlock()
+	ma.config = ac
+}
+
+// size returns the number of bytes authentication adds to a sent message
+func (ma *messageAuth) size() int {
+	if ma == nil {
+		return 0
+	}
+	ma.RLock()
+	defer ma.RUnlock()
+	return ma.config.auth.Size()
+}
+
+// sign appends the AUTHENTICATION TLV to the message of n bytes serialized into b.
+// Returns the new number of bytes
+func (ma *messageAuth) sign(b []byte, n int) (int, error) {
+	if ma == nil {
+		return n, nil
+	}
+	ma.RLock()
+	defer ma.RUnlock()
+	return ma.config.auth.Append(b, n)
+}
+
+// signBytes returns the serialized message with the AUTHENTICATION TLV appended
+func (ma *messageAuth) signBytes(b []byte) ([]byte, error) {
+	if ma == nil {
+		return b, nil
+	}
+	buf := make([]byte, len(b)+ma.size())
+	copy(buf, b)
+	n, err := ma.sign(buf, len(b))
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// verify checks the AUTHENTICATION TLV of the received message.
+// Returns the reason of the failure, empty if the message is accepted
+func (ma *messageAuth) verify(b []byte) string {
+	if ma == nil {
+		return ""
+	}
+	ma.RLock()
+	defer ma.RUnlock()
+	err := ma.config.auth.Verify(b)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ptp.ErrAuthMissing):
+		if !ma.config.Required {
+			return ""
+		}
+		return "missing"
+	case errors.Is(err, ptp.ErrAuthSPP):
+		return "spp"
+	case errors.Is(err, ptp.ErrAuthKey):
+		return "key"
+	case errors.Is(err, ptp.ErrAuthICV):
+		return "icv"
+	default:
+		return "malformed"
+	}
+}
+
+// bytesTo serializes the packet into buf, authenticated if enabled
+func (s *sendWorker) bytesTo(p ptp.BinaryMarshalerTo, buf []byte) (int, error) {
+	n, err := ptp.BytesTo(p, buf)
+	if err != nil {
+		return 0, err
+	}
+	return s.config.auth.sign(buf, n)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuthConfig(t *testing.T, required bool) *AuthConfig {
+	ac := &AuthConfig{
+		SPP:      1,
+		SendKey:  2,
+		Required: required,
+		Keys: []AuthKey{
+			{ID: 1, Key: "6f6c64"},
+			{ID: 2, Key: "6e6577", ICVLength: 16},
+		},
+	}
+	require.NoError(t, ac.parse())
+	return ac
+}
+
+func TestReadAuthConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+spp: 1
+sendkey: 2
+required: true
+keys:
+- id: 1
+  key: 6f6c64
+- id: 2
+  key: 6e6577
+  icvlength: 16
+`), 0600))
+	ac, err := ReadAuthConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, uint8(1), ac.SPP)
+	require.True(t, ac.Required)
+	require.Equal(t, 2, len(ac.Keys))
+	require.Equal(t, 4+6+16, ac.auth.Size())
+
+	require.NoError(t, os.WriteFile(path, []byte("sendkey: 1\nkeys:\n- id: 1\n  key: lol\n"), 0600))
+	_, err = ReadAuthConfig(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("sendkey: 2\nkeys:\n- id: 1\n  key: 6f6c64\n"), 0600))
+	_, err = ReadAuthConfig(path)
+	require.Error(t, err)
+}
+
+func TestMessageAuth(t *testing.T) {
+	var nilAuth *messageAuth
+	require.Equal(t, 0, nilAuth.size())
+	require.Equal(t, "", nilAuth.verify([]byte{}))
+
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 100},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	sync := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSync, 0),
+			Version:         ptp.MajorVersion,
+			MessageLength:   44,
+		},
+	}
+	buf := make([]byte, 128)
+	n, err := w.bytesTo(sync, buf)
+	require.NoError(t, err)
+	require.Equal(t, 46, n)
+	unsigned := append([]byte{}, buf[:n]...)
+
+	c.auth = newMessageAuth(testAuthConfig(t, false))
+	require.Equal(t, "", c.auth.verify(unsigned))
+	n, err = w.bytesTo(sync, buf)
+	require.NoError(t, err)
+	require.Equal(t, len(unsigned)+c.auth.size(), n)
+	require.Equal(t, "", c.auth.verify(buf[:n]))
+
+	buf[30]++
+	require.Equal(t, "icv", c.auth.verify(buf[:n]))
+	buf[30]--
+
+	c.auth.update(testAuthConfig(t, true))
+	require.Equal(t, "missing", c.auth.verify(unsigned))
+	require.Equal(t, "malformed", c.auth.verify(unsigned[:4]))
+
+	ac := testAuthConfig(t, true)
+	ac.SPP = 2
+	require.NoError(t, ac.parse())
+	c.auth.update(ac)
+	require.Equal(t, "spp", c.auth.verify(buf[:n]))
+}
+
+func TestMessageAuthSignBytes(t *testing.T) {
+	ma := newMessageAuth(testAuthConfig(t, true))
+	b, err := ptp.Bytes(&ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageFollowUp, 0),
+			Version:         ptp.MajorVersion,
+			MessageLength:   44,
+		},
+	})
+	require.NoError(t, err)
+	signed, err := ma.signBytes(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b)+ma.size(), len(signed))
+	require.Equal(t, "", ma.verify(signed))
+}
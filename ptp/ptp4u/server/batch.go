@@ -0,0 +1,238 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// MgmtBatch is a batch operation accepted by the management API
+type MgmtBatch struct {
+	// Prefix selects subscriptions to expire by client IP or network
+	Prefix string `json:"prefix,omitempty"`
+	// Clients are addresses or identities of the clients to re-grant
+	Clients []string `json:"clients,omitempty"`
+	// Interval is the new interval of re-granted subscriptions
+	Interval time.Duration `json:"interval,omitempty"`
+	// DryRun reports what would be affected without changing anything
+	DryRun bool `json:"dry_run"`
+}
+
+// MgmtBatchReport is the result of a batch operation
+type MgmtBatchReport struct {
+	Operation     string              `json:"operation"`
+	DryRun        bool                `json:"dry_run"`
+	Subscriptions []*MgmtSubscription `json:"subscriptions"`
+	NotFound      []string            `json:"not_found,omitempty"`
+}
+
+// batchMatch is a running subscription selected by a batch operation
+type batchMatch struct {
+	sc   *SubscriptionClient
+	info *MgmtSubscription
+}
+
+// matchSubscriptions returns running subscriptions accepted by the match, in the management API order
+func (s *Server) matchSubscriptions(match func(*MgmtSubscription) bool) []batchMatch {
+	matches := []batchMatch{}
+	for _, w := range s.sw {
+		w.mux.Lock()
+		for _, clients := range w.clients {
+			for clientID, sc := range clients {
+				if !sc.Running() {
+					continue
+				}
+				if info := sc.info(w.id, clientID); match(info) {
+					matches = append(matches, batchMatch{sc: sc, info: info})
+				}
+			}
+		}
+		w.mux.Unlock()
+	}
+	sort.Slice(matches, func(i, j int) bool { return mgmtSubscriptionLess(matches[i].info, matches[j].info) })
+	return matches
+}
+
+func batchReport(op string, dryRun bool, matches []batchMatch) *MgmtBatchReport {
+	r := &MgmtBatchReport{Operation: op, DryRun: dryRun, Subscriptions: []*MgmtSubscription{}}
+	for _, m := range matches {
+		r.Subscriptions = append(r.Subscriptions, m.info)
+	}
+	return r
+}
+
+// batchExpire stops running subscriptions of the clients within the prefix,
+// sending CANCEL_UNICAST_TRANSMISSION to them
+func (s *Server) batchExpire(b *MgmtBatch) (*MgmtBatchReport, error) {
+	prefix, err := parseBlockPrefix(b.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	matches := s.matchSubscriptions(func(info *MgmtSubscription) bool {
+		return prefix.Contains(net.ParseIP(info.Address)) || (info.AltAddress != "" && prefix.Contains(net.ParseIP(info.AltAddress)))
+	})
+	if !b.DryRun {
+		log.Warningf("Expiring %d subscriptions of %s via management API", len(matches), b.Prefix)
+		for _, m := range matches {
+			m.sc.Stop()
+		}
+	}
+	return batchReport("expire", b.DryRun, matches), nil
+}
+
+// batchRegrant changes the interval of running sync and announce subscriptions of the clients
+// and notifies them with an unsolicited grant
+func (s *Server) batchRegrant(b *MgmtBatch) (*MgmtBatchReport, error) {
+	dcMux.Lock()
+	minInterval := s.Config.MinSubInterval
+	dcMux.Unlock()
+	if b.Interval <= 0 || b.Interval < minInterval {
+		return nil, fmt.Errorf("interval %v is below the minimum of %v", b.Interval, minInterval)
+	}
+	interval, err := ptp.NewLogInterval(b.Interval)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Clients) == 0 {
+		return nil, errors.New("no clients to re-grant")
+	}
+	found := map[string]bool{}
+	matches := s.matchSubscriptions(func(info *MgmtSubscription) bool {
+		if info.Type != ptp.MessageSync.String() && info.Type != ptp.MessageAnnounce.String() {
+			return false
+		}
+		for _, c := range b.Clients {
+			if c == info.Address || c == info.AltAddress || c == info.Client {
+				found[c] = true
+				return true
+			}
+		}
+		return false
+	})
+	r := batchReport("regrant", b.DryRun, matches)
+	for _, c := range b.Clients {
+		if !found[c] {
+			r.NotFound = append(r.NotFound, c)
+		}
+	}
+	if !b.DryRun {
+		log.Warningf("Re-granting %d subscriptions with interval %v via management API", len(matches), b.Interval)
+		for _, m := range matches {
+			m.sc.SetInterval(b.Interval)
+			m.sc.sendRegrant(interval)
+			m.info.Interval = b.Interval
+		}
+	}
+	return r, nil
+}
+
+// sendRegrant sends an unsolicited grant of the current subscription with the new interval
+// for the remaining duration, addressed as the last grant of the client
+func (sc *SubscriptionClient) sendRegrant(interval ptp.LogInterval) {
+	sc.Lock()
+	remaining := sc.expire.Sub(sc.serverConfig.Clock().Now())
+	sc.Unlock()
+	if remaining < 0 {
+		remaining = 0
+	}
+	sg := &ptp.Signaling{Header: sc.signaling.Header}
+	sg.SourcePortIdentity = sc.signaling.TargetPortIdentity
+	sc.sendSignalingGrant(sg, ptp.NewUnicastMsgTypeAndFlags(sc.subscriptionType, 0), interval, uint32(remaining.Seconds()))
+}
+
+// batchPurge removes finished subscriptions and requests of gone clients left in the send workers
+func (s *Server) batchPurge(b *MgmtBatch) *MgmtBatchReport {
+	purged := []*MgmtSubscription{}
+	for _, w := range s.sw {
+		purged = append(purged, w.purgeStale(b.DryRun)...)
+	}
+	sort.Slice(purged, func(i, j int) bool { return mgmtSubscriptionLess(purged[i], purged[j]) })
+	if !b.DryRun {
+		log.Warningf("Purged %d finished subscriptions via management API", len(purged))
+	}
+	return &MgmtBatchReport{Operation: "purge", DryRun: b.DryRun, Subscriptions: purged}
+}
+
+// purgeStale removes finished subscriptions and requests of clients with no running subscription.
+// It's what the inventory does, without waiting for the next one
+func (s *sendWorker) purgeStale(dryRun bool) []*MgmtSubscription {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	purged := []*MgmtSubscription{}
+	active := map[ptp.PortIdentity]bool{}
+	for _, subs := range s.clients {
+		for k, sc := range subs {
+			if sc.Running() {
+				active[k] = true
+				continue
+			}
+			purged = append(purged, sc.info(s.id, k))
+			if !dryRun {
+				delete(subs, k)
+				s.stats.IncSubscriptionExpired()
+			}
+		}
+	}
+	if !dryRun {
+		for k := range s.requests {
+			if !active[k] {
+				delete(s.requests, k)
+			}
+		}
+	}
+	return purged
+}
+
+// handleMgmtBatch runs the batch operation (POST only)
+func (s *Server) handleMgmtBatch(op string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		b := &MgmtBatch{}
+		if err := json.NewDecoder(r.Body).Decode(b); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var report *MgmtBatchReport
+		var err error
+		switch op {
+		case "expire":
+			report, err = s.batchExpire(b)
+		case "regrant":
+			report, err = s.batchRegrant(b)
+		case "purge":
+			report = s.batchPurge(b)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mgmtReply(w, r, report)
+	}
+}
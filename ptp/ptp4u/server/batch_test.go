@@ -0,0 +1,133 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/drain"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// batchTestServer runs sync and announce subscriptions of 192.168.0.10 and 10.0.0.1,
+// and a finished delay_resp subscription
+func batchTestServer() *Server {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{SendWorkers: 1, QueueSize: 10},
+		DynamicConfig: DynamicConfig{MinSubInterval: 100 * time.Millisecond},
+	}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st, manualDrain: &drain.ManualDrain{}, blocklist: newBlocklist("", nil)}
+	w := newSendWorker(0, c, st)
+	s.sw = []*sendWorker{w}
+
+	for i, ip := range []string{"192.168.0.10", "10.0.0.1"} {
+		sa := timestamp.IPToSockaddr(net.ParseIP(ip), 319)
+		clientID := ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(i), PortNumber: 1}
+		for _, mt := range []ptp.MessageType{ptp.MessageSync, ptp.MessageAnnounce} {
+			sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, mt, c, time.Second, time.Now().Add(time.Minute))
+			sc.setRunning(true)
+			w.RegisterSubscription(clientID, mt, sc)
+		}
+		w.clientRequest(clientID)
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("10.0.0.2"), 319)
+	stopped := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Now())
+	w.RegisterSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(2)}, ptp.MessageDelayResp, stopped)
+	w.clientRequest(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(2)})
+	return s
+}
+
+func TestMgmtBatchExpire(t *testing.T) {
+	s := batchTestServer()
+	r := &MgmtBatchReport{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/batch/expire", `{"prefix":"10.0.0.0/8","dry_run":true}`, r))
+	require.True(t, r.DryRun)
+	require.Len(t, r.Subscriptions, 2)
+	require.Equal(t, "10.0.0.1", r.Subscriptions[0].Address)
+	require.Len(t, s.subscriptions("", "10.0.0.1", ""), 2)
+	sc := s.sw[0].FindSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(1), PortNumber: 1}, ptp.MessageSync)
+	require.False(t, sc.Expired())
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/batch/expire", `{"prefix":"10.0.0.0/8"}`, r))
+	require.False(t, r.DryRun)
+	require.Len(t, r.Subscriptions, 2)
+	require.True(t, sc.Expired())
+	require.Len(t, sc.stop, 1)
+	// other clients are untouched
+	require.False(t, s.sw[0].FindSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(0), PortNumber: 1}, ptp.MessageSync).Expired())
+
+	require.Equal(t, http.StatusBadRequest, mgmtRequest(t, s, http.MethodPost, "/batch/expire", `{"prefix":"nope"}`, r))
+	require.Equal(t, http.StatusMethodNotAllowed, mgmtRequest(t, s, http.MethodGet, "/batch/expire", "", r))
+}
+
+func TestMgmtBatchRegrant(t *testing.T) {
+	s := batchTestServer()
+	r := &MgmtBatchReport{}
+	body := `{"clients":["10.0.0.1","192.168.0.99"],"interval":250000000,"dry_run":true}`
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/batch/regrant", body, r))
+	require.Len(t, r.Subscriptions, 2)
+	require.Equal(t, []string{"192.168.0.99"}, r.NotFound)
+	require.Equal(t, time.Second, r.Subscriptions[0].Interval)
+	require.Len(t, s.sw[0].signalingQueue, 0)
+
+	body = `{"clients":["10.0.0.1"],"interval":250000000}`
+	r = &MgmtBatchReport{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/batch/regrant", body, r))
+	require.Len(t, r.Subscriptions, 2)
+	require.Empty(t, r.NotFound)
+	require.Equal(t, 250*time.Millisecond, r.Subscriptions[0].Interval)
+	require.Len(t, s.sw[0].signalingQueue, 2)
+
+	sc := <-s.sw[0].signalingQueue
+	require.Equal(t, 250*time.Millisecond, sc.Interval())
+	grant := sc.Signaling().TLVs[0].(*ptp.GrantUnicastTransmissionTLV)
+	require.Equal(t, ptp.LogInterval(-2), grant.LogInterMessagePeriod)
+	require.InDelta(t, 60, grant.DurationField, 1)
+	require.Equal(t, sc.subscriptionType, grant.MsgTypeAndReserved.MsgType())
+
+	// the other client keeps its interval
+	require.Equal(t, time.Second, s.sw[0].FindSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(0), PortNumber: 1}, ptp.MessageSync).Interval())
+
+	require.Equal(t, http.StatusBadRequest, mgmtRequest(t, s, http.MethodPost, "/batch/regrant", `{"clients":["10.0.0.1"],"interval":1000}`, r))
+	require.Equal(t, http.StatusBadRequest, mgmtRequest(t, s, http.MethodPost, "/batch/regrant", `{"interval":1000000000}`, r))
+}
+
+func TestMgmtBatchPurge(t *testing.T) {
+	s := batchTestServer()
+	r := &MgmtBatchReport{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/batch/purge", `{"dry_run":true}`, r))
+	require.Len(t, r.Subscriptions, 1)
+	require.Equal(t, "10.0.0.2", r.Subscriptions[0].Address)
+	require.NotNil(t, s.sw[0].FindSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(2)}, ptp.MessageDelayResp))
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/batch/purge", "", r))
+	require.Len(t, r.Subscriptions, 1)
+	require.Nil(t, s.sw[0].FindSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(2)}, ptp.MessageDelayResp))
+	require.Len(t, s.sw[0].requests, 2)
+	require.Len(t, s.subscriptions("", "", ""), 4)
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/batch/purge", "", r))
+	require.Empty(t, r.Subscriptions)
+}
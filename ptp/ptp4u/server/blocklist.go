@@ -0,0 +1,239 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// BlockEntry is a blocked client address or network
+type BlockEntry struct {
+	// Prefix is a client IP or network in CIDR notation
+	Prefix string `json:"prefix"`
+	// Expire is when the entry is lifted. Zero never expires
+	Expire time.Time `json:"expire"`
+	// Reason is a free form note of the operator
+	Reason string `json:"reason,omitempty"`
+	// Dropped is the number of packets dropped since the entry was loaded
+	Dropped uint64 `json:"dropped" yaml:"-"`
+
+	net *net.IPNet
+}
+
+// parseBlockPrefix parses the IP or CIDR. Single IP is a full length prefix
+func parseBlockPrefix(prefix string) (*net.IPNet, error) {
+	if ip := net.ParseIP(prefix); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			bits = 8 * net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(prefix)
+	return n, err
+}
+
+// ReadBlocklist reads blocked clients from the file. Missing file is an empty blocklist
+func ReadBlocklist(path string) ([]*BlockEntry, error) {
+	entries := []*BlockEntry{}
+	cData, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(cData, &entries); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		n, err := parseBlockPrefix(e.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("blocked prefix %q: %w", e.Prefix, err)
+		}
+		e.net = n
+		e.Prefix = n.String()
+	}
+	return entries, nil
+}
+
+// blocklist drops requests of the blocked clients.
+// Changes made via the management API are written back to the file, if any
+type blocklist struct {
+	sync.RWMutex
+	path    string
+	entries []*BlockEntry
+	// number of entries, so the empty blocklist costs no locking on the hot path
+	size int32
+}
+
+func newBlocklist(path string, entries []*BlockEntry) *blocklist {
+	b := &blocklist{path: path}
+	b.update(entries)
+	return b
+}
+
+// update replaces the entries
+func (b *blocklist) update(entries []*BlockEntry) {
+	b.Lock()
+	defer b.Unlock()
+	b.entries = entries
+	atomic.StoreInt32(&b.size, int32(len(entries)))
+}
+
+// Blocked checks if requests of the client should be dropped
+func (b *blocklist) Blocked(ip net.IP) bool {
+	if b == nil || atomic.LoadInt32(&b.size) == 0 {
+		return false
+	}
+	now := time.Now()
+	b.RLock()
+	defer b.RUnlock()
+	for _, e := range b.entries {
+		if (e.Expire.IsZero() || now.Before(e.Expire)) && e.net.Contains(ip) {
+			atomic.AddUint64(&e.Dropped, 1)
+			return true
+		}
+	}
+	return false
+}
+
+// Add blocks the client prefix for ttl. Zero ttl blocks until removed.
+// Entry of the same prefix is replaced
+func (b *blocklist) Add(prefix string, ttl time.Duration, reason string) (*BlockEntry, error) {
+	n, err := parseBlockPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	e := &BlockEntry{Prefix: n.String(), Reason: reason, net: n}
+	if ttl > 0 {
+		e.Expire = time.Now().Add(ttl)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	entries := []*BlockEntry{e}
+	for _, old := range b.entries {
+		if old.Prefix != e.Prefix {
+			entries = append(entries, old)
+		}
+	}
+	b.entries = entries
+	atomic.StoreInt32(&b.size, int32(len(entries)))
+	return e, b.save()
+}
+
+// Remove unblocks the client prefix. Returns false if it wasn't blocked
+func (b *blocklist) Remove(prefix string) (bool, error) {
+	n, err := parseBlockPrefix(prefix)
+	if err != nil {
+		return false, err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	entries := []*BlockEntry{}
+	for _, e := range b.entries {
+		if e.Prefix != n.String() {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == len(b.entries) {
+		return false, nil
+	}
+	b.entries = entries
+	atomic.StoreInt32(&b.size, int32(len(entries)))
+	return true, b.save()
+}
+
+// Expire removes entries with TTL passed and returns the number of remaining ones
+func (b *blocklist) Expire(now time.Time) (int, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.Lock()
+	defer b.Unlock()
+	entries := []*BlockEntry{}
+	for _, e := range b.entries {
+		if e.Expire.IsZero() || now.Before(e.Expire) {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == len(b.entries) {
+		return len(entries), nil
+	}
+	b.entries = entries
+	atomic.StoreInt32(&b.size, int32(len(entries)))
+	return len(entries), b.save()
+}
+
+// List returns copies of the entries sorted by prefix
+func (b *blocklist) List() []BlockEntry {
+	list := []BlockEntry{}
+	if b == nil {
+		return list
+	}
+	b.RLock()
+	defer b.RUnlock()
+	for _, e := range b.entries {
+		list = append(list, BlockEntry{
+			Prefix:  e.Prefix,
+			Expire:  e.Expire,
+			Reason:  e.Reason,
+			Dropped: atomic.LoadUint64(&e.Dropped),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Prefix < list[j].Prefix })
+	return list
+}
+
+// save writes the entries to the file. Must be called with the lock held
+func (b *blocklist) save() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(b.entries)
+	if err != nil {
+		return err
+	}
+	// write and rename, so a crash never leaves a partial blocklist behind
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBlockPrefix(t *testing.T) {
+	n, err := parseBlockPrefix("192.168.0.10")
+	require.NoError(t, err)
+	require.Equal(t, "192.168.0.10/32", n.String())
+
+	n, err = parseBlockPrefix("2001:db8::1")
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::1/128", n.String())
+
+	n, err = parseBlockPrefix("10.1.2.3/8")
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.0/8", n.String())
+
+	_, err = parseBlockPrefix("nope")
+	require.Error(t, err)
+}
+
+func TestReadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist")
+	entries, err := ReadBlocklist(path)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(entries))
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+- prefix: 2001:db8:1::/48
+  reason: broken firmware
+- prefix: 192.168.0.10
+  expire: 2022-05-26T14:16:29Z
+`), 0644))
+	entries, err = ReadBlocklist(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "2001:db8:1::/48", entries[0].Prefix)
+	require.Equal(t, "broken firmware", entries[0].Reason)
+	require.True(t, entries[0].Expire.IsZero())
+	require.Equal(t, "192.168.0.10/32", entries[1].Prefix)
+	require.Equal(t, time.Date(2022, 5, 26, 14, 16, 29, 0, time.UTC), entries[1].Expire)
+
+	require.NoError(t, os.WriteFile(path, []byte("- prefix: 300.0.0.1\n"), 0644))
+	_, err = ReadBlocklist(path)
+	require.Error(t, err)
+}
+
+func TestBlocklistBlocked(t *testing.T) {
+	var b *blocklist
+	require.False(t, b.Blocked(net.ParseIP("192.168.0.10")))
+
+	b = newBlocklist("", nil)
+	require.False(t, b.Blocked(net.ParseIP("192.168.0.10")))
+
+	_, err := b.Add("192.168.0.0/24", 0, "")
+	require.NoError(t, err)
+	_, err = b.Add("2001:db8::/32", time.Minute, "")
+	require.NoError(t, err)
+	require.True(t, b.Blocked(net.ParseIP("192.168.0.10")))
+	require.True(t, b.Blocked(net.ParseIP("192.168.0.10").To4()))
+	require.True(t, b.Blocked(net.ParseIP("2001:db8::1")))
+	require.False(t, b.Blocked(net.ParseIP("192.168.1.10")))
+
+	list := b.List()
+	require.Equal(t, 2, len(list))
+	require.Equal(t, "192.168.0.0/24", list[0].Prefix)
+	require.Equal(t, uint64(2), list[0].Dropped)
+	require.Equal(t, uint64(1), list[1].Dropped)
+
+	found, err := b.Remove("192.168.0.0/24")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.False(t, b.Blocked(net.ParseIP("192.168.0.10")))
+	found, err = b.Remove("192.168.0.0/24")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestBlocklistExpire(t *testing.T) {
+	b := newBlocklist("", nil)
+	_, err := b.Add("192.168.0.10", time.Minute, "")
+	require.NoError(t, err)
+	_, err = b.Add("192.168.0.11", 0, "")
+	require.NoError(t, err)
+
+	// expired entries are skipped before they are removed
+	future := time.Now().Add(2 * time.Minute)
+	b.entries[1].Expire = time.Now().Add(-time.Second)
+	require.False(t, b.Blocked(net.ParseIP("192.168.0.10")))
+
+	n, err := b.Expire(future)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, "192.168.0.11/32", b.List()[0].Prefix)
+}
+
+func TestBlocklistPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist")
+	b := newBlocklist(path, nil)
+	e, err := b.Add("192.168.0.10", time.Hour, "flood")
+	require.NoError(t, err)
+	// same prefix replaces the entry
+	_, err = b.Add("192.168.0.10/32", time.Hour, "flood again")
+	require.NoError(t, err)
+	_, err = b.Add("10.0.0.0/8", 0, "")
+	require.NoError(t, err)
+
+	entries, err := ReadBlocklist(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "10.0.0.0/8", entries[0].Prefix)
+	require.Equal(t, "192.168.0.10/32", entries[1].Prefix)
+	require.Equal(t, "flood again", entries[1].Reason)
+	require.WithinDuration(t, e.Expire, entries[1].Expire, time.Second)
+
+	_, err = b.Remove("10.0.0.0/8")
+	require.NoError(t, err)
+	entries, err = ReadBlocklist(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+}
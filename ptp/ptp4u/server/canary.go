@@ -0,0 +1,225 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// CanarySelf is the canary target sending to sockets of the server itself
+const CanarySelf = "self"
+
+// canaryProbe is an internal Sync subscription measuring the end-to-end behavior of the send path
+// independently of the real clients
+type canaryProbe struct {
+	target   string
+	interval time.Duration
+	sc       *SubscriptionClient
+	// sockets receiving the canary traffic of the self target. Nil for remote targets
+	sink []*net.UDPConn
+
+	mux sync.Mutex
+	// previous send. Zero after launch
+	lastSend time.Time
+	// measurements since the previous check
+	window stats.CanaryStats
+	// whether the subscription was running at the previous check
+	running bool
+	alarm   bool
+}
+
+// sent records the Sync sent at the given time and the result of reading its TX timestamp. Called by the send worker
+func (p *canaryProbe) sent(at time.Time, latency time.Duration, err error) {
+	if p == nil {
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.window.Sends++
+	if err != nil {
+		p.window.TXTSFailures++
+	}
+	if latency > p.window.MaxTXTSLatency {
+		p.window.MaxTXTSLatency = latency
+	}
+	if !p.lastSend.IsZero() {
+		cadenceError := at.Sub(p.lastSend) - p.interval
+		if cadenceError < 0 {
+			cadenceError = -cadenceError
+		}
+		if cadenceError > p.window.MaxCadenceError {
+			p.window.MaxCadenceError = cadenceError
+		}
+	}
+	p.lastSend = at
+}
+
+// check returns the measurements since the previous check with the alarm raised if they exceed the budgets.
+// Zero budget is not checked. Subscription running through the whole window must have sent something
+func (p *canaryProbe) check(running bool, txtsBudget, cadenceBudget time.Duration) stats.CanaryStats {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	w := p.window
+	p.window = stats.CanaryStats{}
+	w.Alarm = w.TXTSFailures > 0 ||
+		(txtsBudget > 0 && w.MaxTXTSLatency > txtsBudget) ||
+		(cadenceBudget > 0 && w.MaxCadenceError > cadenceBudget) ||
+		(running && p.running && w.Sends == 0)
+	p.running = running
+	if w.Alarm != p.alarm {
+		if w.Alarm {
+			log.Warningf("Canary %s over budget: %d sends, %d TX timestamp failures, max TX timestamp latency %v, max cadence error %v", p.target, w.Sends, w.TXTSFailures, w.MaxTXTSLatency, w.MaxCadenceError)
+		} else {
+			log.Infof("Canary %s is within budget again", p.target)
+		}
+	}
+	p.alarm = w.Alarm
+	return w
+}
+
+// alarmState returns 1 if the alarm was raised at the last check
+func (p *canaryProbe) alarmState() int64 {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.alarm {
+		return 1
+	}
+	return 0
+}
+
+// launch starts the canary subscription, which must not be running
+func (p *canaryProbe) launch(ctx context.Context) {
+	p.mux.Lock()
+	p.lastSend = time.Time{}
+	p.mux.Unlock()
+	p.sc.SetExpire(p.sc.serverConfig.Clock().Now().Add(subscriptionDuration))
+	p.sc.launch(ctx)
+}
+
+// close closes the sink sockets
+func (p *canaryProbe) close() {
+	for _, conn := range p.sink {
+		conn.Close()
+	}
+}
+
+// newCanarySink returns a socket on the IP discarding everything it receives
+func newCanarySink(ip net.IP) (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return conn, nil
+}
+
+// canaryAddress returns the IP the canary sends to the target at
+func canaryAddress(l *listener, target string) (net.IP, error) {
+	if target == CanarySelf {
+		if l.IP != nil && !l.IP.IsUnspecified() {
+			return l.IP, nil
+		}
+		if l.IP == nil || l.IP.To4() != nil {
+			return net.IPv4(127, 0, 0, 1), nil
+		}
+		return net.IPv6loopback, nil
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		return ip, nil
+	}
+	ips, err := net.LookupIP(target)
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+// newCanary returns the canary subscription to the target served by the worker from the primary listener
+func (s *Server) newCanary(target string, w *sendWorker) (*canaryProbe, error) {
+	l := s.Config.listeners[0]
+	ip, err := canaryAddress(l, target)
+	if err != nil {
+		return nil, err
+	}
+	p := &canaryProbe{target: target, interval: s.Config.CanaryInterval}
+	var eclisa, gclisa unix.Sockaddr
+	if target == CanarySelf {
+		for _, port := range []*unix.Sockaddr{&eclisa, &gclisa} {
+			conn, err := newCanarySink(ip)
+			if err != nil {
+				p.close()
+				return nil, err
+			}
+			p.sink = append(p.sink, conn)
+			*port = l.clientSockaddr(ip, conn.LocalAddr().(*net.UDPAddr).Port)
+		}
+	} else {
+		eclisa = l.clientSockaddr(ip, ptp.PortEvent)
+		gclisa = l.clientSockaddr(ip, ptp.PortGeneral)
+	}
+	p.sc = NewSubscriptionClient(w.queue, w.signalingQueue, eclisa, gclisa, ptp.MessageSync, s.Config, p.interval, s.Config.Clock().Now().Add(subscriptionDuration))
+	p.sc.listener = l.id
+	p.sc.canary = p
+	return p, nil
+}
+
+// startCanaries launches the canary subscriptions to the configured targets, spread over the workers
+func (s *Server) startCanaries() error {
+	for i, target := range s.Config.CanaryTargets {
+		p, err := s.newCanary(target, s.sw[i%len(s.sw)])
+		if err != nil {
+			return fmt.Errorf("starting canary %s: %w", target, err)
+		}
+		log.Infof("Starting canary subscription to %s every %v", target, p.interval)
+		s.canaries = append(s.canaries, p)
+		p.launch(s.ctx)
+	}
+	return nil
+}
+
+// checkCanaries reports the canary measurements of the metric interval and keeps the canaries running.
+// Canaries stopped by drain are launched again once the server is undrained
+func (s *Server) checkCanaries() {
+	for _, p := range s.canaries {
+		running := p.sc.Running()
+		s.Stats.SetCanary(p.target, p.check(running, s.Config.CanaryTXTSBudget, s.Config.CanaryCadenceBudget))
+		if running {
+			p.sc.SetExpire(s.Config.Clock().Now().Add(subscriptionDuration))
+			continue
+		}
+		if s.ctx.Err() == nil && atomic.LoadInt32(&s.shuttingDown) == 0 {
+			p.launch(s.ctx)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestCanaryProbeCheck(t *testing.T) {
+	p := &canaryProbe{target: CanarySelf, interval: time.Second}
+	start := time.Unix(1700000000, 0)
+
+	p.sent(start, 10*time.Microsecond, nil)
+	p.sent(start.Add(time.Second+time.Millisecond), 30*time.Microsecond, nil)
+	p.sent(start.Add(2*time.Second), 20*time.Microsecond, nil)
+	require.Equal(t, stats.CanaryStats{Sends: 3, MaxTXTSLatency: 30 * time.Microsecond, MaxCadenceError: time.Millisecond}, p.check(true, time.Millisecond, 10*time.Millisecond))
+
+	// late send
+	p.sent(start.Add(3500*time.Millisecond), 20*time.Microsecond, nil)
+	w := p.check(true, time.Millisecond, 10*time.Millisecond)
+	require.Equal(t, 500*time.Millisecond, w.MaxCadenceError)
+	require.True(t, w.Alarm)
+
+	// zero budget isn't checked
+	p.sent(start.Add(4500*time.Millisecond), 2*time.Millisecond, nil)
+	require.False(t, p.check(true, 0, 0).Alarm)
+
+	p.sent(start.Add(5500*time.Millisecond), 0, errors.New("timeout"))
+	w = p.check(true, time.Millisecond, 10*time.Millisecond)
+	require.Equal(t, int64(1), w.TXTSFailures)
+	require.True(t, w.Alarm)
+
+	// running subscription sends nothing
+	require.True(t, p.check(true, time.Millisecond, 10*time.Millisecond).Alarm)
+	// stopped one is not expected to
+	require.False(t, p.check(false, time.Millisecond, 10*time.Millisecond).Alarm)
+	require.False(t, p.check(true, time.Millisecond, 10*time.Millisecond).Alarm)
+
+	// client subscriptions have no canary
+	var none *canaryProbe
+	none.sent(start, 0, nil)
+}
+
+func TestCanaryAddress(t *testing.T) {
+	ip, err := canaryAddress(&listener{Listener: Listener{IP: net.ParseIP("10.0.0.1")}}, CanarySelf)
+	require.NoError(t, err)
+	require.Equal(t, net.ParseIP("10.0.0.1"), ip)
+
+	ip, err = canaryAddress(&listener{Listener: Listener{IP: net.ParseIP("::")}}, CanarySelf)
+	require.NoError(t, err)
+	require.Equal(t, net.IPv6loopback, ip)
+
+	ip, err = canaryAddress(&listener{Listener: Listener{IP: net.ParseIP("::")}}, "2001:db8::1")
+	require.NoError(t, err)
+	require.Equal(t, net.ParseIP("2001:db8::1"), ip)
+}
+
+func TestServerCanaries(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			CanaryInterval: time.Hour,
+			CanaryTargets:  []string{CanarySelf, "192.168.0.10"},
+			IP:             net.ParseIP("127.0.0.1"),
+			QueueSize:      10,
+		},
+	}
+	c.timeSrc = &SysClockTimeSource{config: c}
+	require.NoError(t, c.initListeners())
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	s.sw = []*sendWorker{newSendWorker(0, c, st)}
+	w := s.sw[0]
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	require.NoError(t, s.startCanaries())
+	require.Len(t, s.canaries, 2)
+	defer s.canaries[0].close()
+
+	// the first Syncs are queued right away
+	for i := 0; i < 2; i++ {
+		select {
+		case sc := <-w.queue:
+			require.NotNil(t, sc.canary)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for canary Sync")
+		}
+	}
+	self := s.canaries[0].sc
+	require.Equal(t, s.canaries[0].sink[0].LocalAddr().(*net.UDPAddr).Port, self.eclisa.(*unix.SockaddrInet4).Port)
+	require.Equal(t, ptp.PortEvent, s.canaries[1].sc.eclisa.(*unix.SockaddrInet4).Port)
+	// canaries are not clients
+	require.Zero(t, w.inventoryClients())
+
+	// drained canaries are launched again on undrain
+	s.cancel()
+	require.Eventually(t, func() bool { return !self.Running() }, time.Second, 10*time.Millisecond)
+	s.checkCanaries()
+	require.False(t, self.Running())
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.checkCanaries()
+	require.True(t, self.Running())
+}
@@ -0,0 +1,156 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"math"
+	"runtime/metrics"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+)
+
+// churnSampleEvery is how often heap allocations of subscription creation are measured.
+// Reading runtime metrics takes a few microseconds, too much for every request of a churn storm
+const churnSampleEvery = 16
+
+const (
+	metricAllocBytes   = "/gc/heap/allocs:bytes"
+	metricAllocObjects = "/gc/heap/allocs:objects"
+	metricGCCycles     = "/gc/cycles/total:gc-cycles"
+	metricGCPauses     = "/gc/pauses:seconds"
+)
+
+// churnSampler attributes heap allocations to subscription creation.
+// Every churnSampleEvery-th creation is measured and the rest is accounted with the last measurement.
+// Heap counters are process wide, so allocations of other goroutines leak into the measurement
+// and make it an upper estimate. Not safe for concurrent use, every receive loop has its own
+type churnSampler struct {
+	stats    stats.Stats
+	samples  []metrics.Sample
+	created  int64
+	sampling bool
+	// counters read at the start of the measured creation
+	startBytes   uint64
+	startObjects uint64
+	// allocations of the last measured creation
+	bytes   int64
+	objects int64
+}
+
+func newChurnSampler(st stats.Stats) *churnSampler {
+	return &churnSampler{
+		stats:   st,
+		samples: []metrics.Sample{{Name: metricAllocBytes}, {Name: metricAllocObjects}},
+	}
+}
+
+// read returns heap allocation counters, zero if the runtime doesn't support them
+func (c *churnSampler) read() (uint64, uint64) {
+	metrics.Read(c.samples)
+	var bytes, objects uint64
+	if c.samples[0].Value.Kind() == metrics.KindUint64 {
+		bytes = c.samples[0].Value.Uint64()
+	}
+	if c.samples[1].Value.Kind() == metrics.KindUint64 {
+		objects = c.samples[1].Value.Uint64()
+	}
+	return bytes, objects
+}
+
+// begin is called before a subscription is created
+func (c *churnSampler) begin() {
+	c.sampling = c.created%churnSampleEvery == 0
+	if c.sampling {
+		c.startBytes, c.startObjects = c.read()
+	}
+}
+
+// done accounts the subscription created since begin
+func (c *churnSampler) done() {
+	if c.sampling {
+		bytes, objects := c.read()
+		c.bytes, c.objects = int64(bytes-c.startBytes), int64(objects-c.startObjects)
+		c.sampling = false
+	}
+	c.created++
+	c.stats.IncSubscriptionCreated()
+	c.stats.AddChurnAllocs(c.bytes, c.objects)
+}
+
+// gcSampler reports the garbage collector activity between calls
+type gcSampler struct {
+	samples []metrics.Sample
+	last    stats.GCStats
+	// pause histogram counts of the previous call
+	pauses []uint64
+}
+
+func newGCSampler() *gcSampler {
+	g := &gcSampler{
+		samples: []metrics.Sample{{Name: metricGCCycles}, {Name: metricGCPauses}, {Name: metricAllocBytes}},
+	}
+	// the first interval starts now, not at the process start
+	g.sample()
+	return g
+}
+
+// sample returns the GC activity since the previous call
+func (g *gcSampler) sample() stats.GCStats {
+	metrics.Read(g.samples)
+	var now stats.GCStats
+	if g.samples[0].Value.Kind() == metrics.KindUint64 {
+		now.Cycles = int64(g.samples[0].Value.Uint64())
+	}
+	if g.samples[2].Value.Kind() == metrics.KindUint64 {
+		now.HeapAllocBytes = int64(g.samples[2].Value.Uint64())
+	}
+	delta := stats.GCStats{
+		Cycles:         now.Cycles - g.last.Cycles,
+		HeapAllocBytes: now.HeapAllocBytes - g.last.HeapAllocBytes,
+	}
+	g.last = now
+	if g.samples[1].Value.Kind() == metrics.KindFloat64Histogram {
+		delta.PauseNs, delta.MaxPauseNs = g.pausesSince(g.samples[1].Value.Float64Histogram())
+	}
+	return delta
+}
+
+// pausesSince estimates total and longest pause from the histogram buckets filled since the previous call.
+// Pauses are taken at the bucket midpoint, the longest one at the upper bound of its bucket
+func (g *gcSampler) pausesSince(h *metrics.Float64Histogram) (int64, int64) {
+	var total, longest float64
+	for i, count := range h.Counts {
+		var prev uint64
+		if i < len(g.pauses) {
+			prev = g.pauses[i]
+		}
+		if count <= prev {
+			continue
+		}
+		low, high := h.Buckets[i], h.Buckets[i+1]
+		if math.IsInf(low, -1) {
+			low = 0
+		}
+		if math.IsInf(high, 1) {
+			high = low
+		}
+		total += float64(count-prev) * (low + high) / 2
+		longest = high
+	}
+	g.pauses = append(g.pauses[:0], h.Counts...)
+	return int64(total * 1e9), int64(longest * 1e9)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+// churnStats records the churn accounting
+type churnStats struct {
+	*stats.JSONStats
+	created int64
+	bytes   int64
+	objects int64
+}
+
+func (s *churnStats) IncSubscriptionCreated() { s.created++ }
+
+func (s *churnStats) AddChurnAllocs(bytes, objects int64) {
+	s.bytes += bytes
+	s.objects += objects
+}
+
+var churnSink [][]byte
+
+func TestChurnSampler(t *testing.T) {
+	st := &churnStats{JSONStats: stats.NewJSONStats()}
+	c := newChurnSampler(st)
+
+	c.begin()
+	churnSink = append(churnSink, make([]byte, 1<<20))
+	c.done()
+	require.Equal(t, int64(1), st.created)
+	require.GreaterOrEqual(t, st.bytes, int64(1<<20))
+	require.GreaterOrEqual(t, st.objects, int64(1))
+
+	// unmeasured creations are accounted with the last measurement
+	measured := st.bytes
+	for i := 1; i < churnSampleEvery; i++ {
+		c.begin()
+		c.done()
+	}
+	require.Equal(t, int64(churnSampleEvery), st.created)
+	require.Equal(t, measured*churnSampleEvery, st.bytes)
+
+	// the next one is measured again
+	c.begin()
+	c.done()
+	require.Less(t, st.bytes-measured*churnSampleEvery, int64(1<<20))
+	churnSink = nil
+}
+
+func TestGCSampler(t *testing.T) {
+	g := newGCSampler()
+	churnSink = append(churnSink, make([]byte, 1<<20))
+	runtime.GC()
+	gc := g.sample()
+	require.GreaterOrEqual(t, gc.Cycles, int64(1))
+	require.GreaterOrEqual(t, gc.HeapAllocBytes, int64(1<<20))
+	require.Greater(t, gc.PauseNs, int64(0))
+	require.Greater(t, gc.MaxPauseNs, int64(0))
+
+	// only activity since the previous sample is reported
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	gc = g.sample()
+	require.Less(t, gc.Cycles, int64(ms.NumGC))
+	churnSink = nil
+}
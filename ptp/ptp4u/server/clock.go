@@ -0,0 +1,105 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+)
+
+// Clock is the time the schedulers and expiry logic of the server run on.
+// Timers and tickers always run on the wall clock, Clock maps between the two
+type Clock interface {
+	// Now returns current time of the clock
+	Now() time.Time
+	// Wall returns the wall clock duration passing while the clock advances by d
+	Wall(d time.Duration) time.Duration
+	// At projects the wall clock time, e.g. of a ticker or socket timestamp, onto the clock
+	At(wall time.Time) time.Time
+}
+
+// wallClock is the system clock
+type wallClock struct{}
+
+// Now returns current system time
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// Wall returns d as is
+func (wallClock) Wall(d time.Duration) time.Duration {
+	return d
+}
+
+// At returns wall as is
+func (wallClock) At(wall time.Time) time.Time {
+	return wall
+}
+
+// AcceleratedClock is the virtual time which starts at the epoch and advances rate times faster
+// than the monotonic clock. It lets long-horizon tests cover days of grant renewals, leap second
+// windows and clock class dwells in minutes of wall time
+type AcceleratedClock struct {
+	epoch time.Time
+	start time.Time
+	rate  float64
+}
+
+// NewAcceleratedClock returns a clock starting at epoch advancing rate times faster than the wall clock.
+// Zero epoch starts the clock at the current system time, rate of up to 0 runs it at the wall clock rate
+func NewAcceleratedClock(epoch time.Time, rate float64) *AcceleratedClock {
+	start := time.Now()
+	if epoch.IsZero() {
+		epoch = start
+	}
+	if rate <= 0 {
+		rate = 1
+	}
+	return &AcceleratedClock{epoch: epoch, start: start, rate: rate}
+}
+
+// Rate returns how many times faster than the wall clock the clock advances
+func (c *AcceleratedClock) Rate() float64 {
+	return c.rate
+}
+
+// Shifted returns the clock running the same virtual timeline offset by d
+func (c *AcceleratedClock) Shifted(d time.Duration) *AcceleratedClock {
+	return &AcceleratedClock{epoch: c.epoch.Add(d), start: c.start, rate: c.rate}
+}
+
+// Now returns current virtual time
+func (c *AcceleratedClock) Now() time.Time {
+	return c.At(time.Now())
+}
+
+// Wall returns the wall clock duration the virtual time needs to advance by d
+func (c *AcceleratedClock) Wall(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	w := time.Duration(float64(d) / c.rate)
+	if w <= 0 {
+		return 1
+	}
+	return w
+}
+
+// At projects the wall clock time onto the virtual timeline. Socket timestamps carry
+// no monotonic reading, for them the wall clock reading of the start is used
+func (c *AcceleratedClock) At(wall time.Time) time.Time {
+	return c.epoch.Add(time.Duration(float64(wall.Sub(c.start)) * c.rate))
+}
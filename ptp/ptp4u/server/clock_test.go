@@ -0,0 +1,133 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWallClock(t *testing.T) {
+	var c Clock = wallClock{}
+	require.InDelta(t, 0, time.Since(c.Now()), float64(time.Second))
+	require.Equal(t, time.Minute, c.Wall(time.Minute))
+	ts := time.Unix(1700000000, 0)
+	require.Equal(t, ts, c.At(ts))
+}
+
+func TestAcceleratedClock(t *testing.T) {
+	epoch := time.Date(2016, 12, 31, 23, 0, 0, 0, time.UTC)
+	c := NewAcceleratedClock(epoch, 3600)
+	require.Equal(t, float64(3600), c.Rate())
+	require.InDelta(t, 0, c.Now().Sub(epoch), float64(time.Hour))
+
+	// a virtual hour passes every wall clock second
+	require.Equal(t, time.Second, c.Wall(time.Hour))
+	require.Equal(t, time.Duration(1), c.Wall(time.Nanosecond))
+	require.Equal(t, time.Duration(0), c.Wall(0))
+	require.InDelta(t, 10*time.Hour, c.At(time.Now().Add(10*time.Second)).Sub(epoch), float64(time.Hour))
+	// socket timestamps carry no monotonic reading
+	require.InDelta(t, 10*time.Hour, c.At(time.Now().Add(10*time.Second).Round(0)).Sub(epoch), float64(time.Hour))
+
+	before := c.Now()
+	time.Sleep(10 * time.Millisecond)
+	require.GreaterOrEqual(t, c.Now().Sub(before), 36*time.Second)
+
+	shifted := c.Shifted(-37 * time.Second)
+	require.InDelta(t, -37*time.Second, shifted.At(before).Sub(c.At(before)), 0)
+
+	// zero epoch starts now, up to 0 rate runs at the wall clock rate
+	c = NewAcceleratedClock(time.Time{}, 0)
+	require.Equal(t, float64(1), c.Rate())
+	require.InDelta(t, 0, time.Since(c.Now()), float64(time.Second))
+}
+
+func TestAcceleratedTimeSource(t *testing.T) {
+	epoch := time.Date(2016, 12, 31, 23, 0, 0, 0, time.UTC)
+	ts := NewAcceleratedTimeSource(epoch, 1000)
+
+	now, err := ts.Now()
+	require.NoError(t, err)
+	require.InDelta(t, 0, now.Sub(epoch), float64(time.Minute))
+	require.InDelta(t, 10000*time.Second, ts.RXTimestamp(time.Now().Add(10*time.Second)).Sub(epoch), float64(time.Minute))
+
+	// schedulers run on UTC
+	clock := ts.Clock(37 * time.Second)
+	tai, err := ts.Now()
+	require.NoError(t, err)
+	require.InDelta(t, 37*time.Second, tai.Sub(clock.Now()), float64(time.Second))
+}
+
+func TestConfigClock(t *testing.T) {
+	var c *Config
+	require.Equal(t, wallClock{}, c.Clock())
+	c = &Config{}
+	require.Equal(t, wallClock{}, c.Clock())
+	clock := NewAcceleratedClock(time.Time{}, 10)
+	c.clock = clock
+	require.Equal(t, clock, c.Clock())
+}
+
+func TestSubscriptionAcceleratedTime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// a day long grant sending every hour completes in under a second
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), clock: NewAcceleratedClock(time.Time{}, 100000)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(make(chan *SubscriptionClient, 100), make(chan *SubscriptionClient, 100), sa, sa, ptp.MessageSync, c, time.Hour, c.Clock().Now().Add(24*time.Hour))
+	sends := 0
+	go sc.Start(ctx)
+	require.Eventually(t, sc.Running, time.Second, time.Millisecond)
+	for sc.Running() {
+		select {
+		case <-sc.queue:
+			sends++
+			atomic.StoreInt32(&sc.queued, 0)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	require.True(t, sc.Expired())
+	require.InDelta(t, 24, sends, 4)
+	// and is cancelled on expiry
+	require.Len(t, sc.signalingQueue, 1)
+}
+
+func TestIdleSchedulerAcceleratedTime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := NewAcceleratedClock(time.Time{}, 100000)
+	idle := newIdleScheduler(clock)
+	go idle.Start(ctx)
+
+	sc := newIdleSubscription(ptp.MessageDelayResp, idle, time.Hour, 0)
+	sc.serverConfig.clock = clock
+	sc.SetExpire(clock.Now().Add(24 * time.Hour))
+	start := time.Now()
+	go sc.Start(ctx)
+	require.Eventually(t, sc.Running, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return !sc.Running() }, 5*time.Second, time.Millisecond)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, 0, idle.Len())
+}
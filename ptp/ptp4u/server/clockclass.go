@@ -0,0 +1,101 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// clockClassLadder is the order clock class degrades in, from best to worst
+var clockClassLadder = []ptp.ClockClass{
+	ptp.ClockClass6,
+	ptp.ClockClass7,
+	ptp.ClockClass52,
+	ptp.ClockClass187,
+	248, // default
+}
+
+// nextDegradation returns the next class on the ladder from published towards raw
+func nextDegradation(published, raw ptp.ClockClass) ptp.ClockClass {
+	for _, c := range clockClassLadder {
+		if c > published {
+			if c < raw {
+				return c
+			}
+			break
+		}
+	}
+	return raw
+}
+
+// clockClassFilter debounces clock class changes, so a transient glitch doesn't make
+// every client re-run BMCA. Published class is held for at least dwell. Improvements
+// are published once the raw class was stable for dwell, degradations are ramped
+// one step of the ladder per dwell
+type clockClassFilter struct {
+	sync.Mutex
+	dwell    time.Duration
+	raw      ptp.ClockClass
+	rawSince time.Time
+	// published is read on every announce, so it's accessed atomically
+	published   int32
+	publishedAt time.Time
+}
+
+func newClockClassFilter(dwell time.Duration, class ptp.ClockClass, now time.Time) *clockClassFilter {
+	return &clockClassFilter{
+		dwell:       dwell,
+		raw:         class,
+		rawSince:    now,
+		published:   int32(class),
+		publishedAt: now,
+	}
+}
+
+// update feeds the raw class observed at now and returns the class to publish
+func (f *clockClassFilter) update(raw ptp.ClockClass, now time.Time) ptp.ClockClass {
+	f.Lock()
+	defer f.Unlock()
+	if raw != f.raw {
+		f.raw = raw
+		f.rawSince = now
+	}
+	published := f.Published()
+	if raw == published || now.Sub(f.publishedAt) < f.dwell {
+		return published
+	}
+	next := raw
+	if raw > published {
+		next = nextDegradation(published, raw)
+	} else if now.Sub(f.rawSince) < f.dwell {
+		return published
+	}
+	log.Infof("Publishing clock class %d (raw %d), was %d", next, raw, published)
+	atomic.StoreInt32(&f.published, int32(next))
+	f.publishedAt = now
+	return next
+}
+
+// Published returns the class to announce
+func (f *clockClassFilter) Published() ptp.ClockClass {
+	return ptp.ClockClass(atomic.LoadInt32(&f.published))
+}
@@ -0,0 +1,73 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextDegradation(t *testing.T) {
+	require.Equal(t, ptp.ClockClass7, nextDegradation(ptp.ClockClass6, 248))
+	require.Equal(t, ptp.ClockClass52, nextDegradation(ptp.ClockClass7, 248))
+	require.Equal(t, ptp.ClockClass187, nextDegradation(ptp.ClockClass52, 248))
+	require.Equal(t, ptp.ClockClass(248), nextDegradation(ptp.ClockClass187, 248))
+	require.Equal(t, ptp.ClockClass7, nextDegradation(ptp.ClockClass6, ptp.ClockClass7))
+	require.Equal(t, ptp.ClockClass13, nextDegradation(ptp.ClockClass7, ptp.ClockClass13))
+	require.Equal(t, ptp.ClockClassSlaveOnly, nextDegradation(248, ptp.ClockClassSlaveOnly))
+}
+
+func TestClockClassFilterGlitch(t *testing.T) {
+	now := time.Now()
+	f := newClockClassFilter(10*time.Second, ptp.ClockClass6, now.Add(-time.Minute))
+
+	// transient glitch is published as a single step of degradation
+	require.Equal(t, ptp.ClockClass7, f.update(248, now.Add(time.Second)))
+	require.Equal(t, ptp.ClockClass7, f.update(ptp.ClockClass6, now.Add(2*time.Second)))
+	// recovery is published once the dwell time passed
+	require.Equal(t, ptp.ClockClass7, f.update(ptp.ClockClass6, now.Add(11*time.Second)))
+	require.Equal(t, ptp.ClockClass6, f.update(ptp.ClockClass6, now.Add(12*time.Second)))
+	require.Equal(t, ptp.ClockClass6, f.Published())
+}
+
+func TestClockClassFilterRamp(t *testing.T) {
+	now := time.Now()
+	f := newClockClassFilter(10*time.Second, ptp.ClockClass6, now)
+
+	require.Equal(t, ptp.ClockClass6, f.update(248, now.Add(5*time.Second)))
+	require.Equal(t, ptp.ClockClass7, f.update(248, now.Add(10*time.Second)))
+	require.Equal(t, ptp.ClockClass7, f.update(248, now.Add(15*time.Second)))
+	require.Equal(t, ptp.ClockClass52, f.update(248, now.Add(20*time.Second)))
+	require.Equal(t, ptp.ClockClass187, f.update(248, now.Add(30*time.Second)))
+	require.Equal(t, ptp.ClockClass(248), f.update(248, now.Add(40*time.Second)))
+	require.Equal(t, ptp.ClockClass(248), f.update(248, now.Add(50*time.Second)))
+}
+
+func TestClockClassFilterFlapping(t *testing.T) {
+	now := time.Now()
+	f := newClockClassFilter(10*time.Second, ptp.ClockClass7, now.Add(-time.Minute))
+
+	// raw class improving for less than the dwell time each time is never published
+	for i := 0; i < 10; i++ {
+		base := now.Add(time.Duration(i) * 10 * time.Second)
+		require.Equal(t, ptp.ClockClass7, f.update(ptp.ClockClass6, base))
+		require.Equal(t, ptp.ClockClass7, f.update(ptp.ClockClass7, base.Add(5*time.Second)))
+	}
+}
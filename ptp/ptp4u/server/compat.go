@@ -0,0 +1,131 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// Compatibility modes working around known deviations of third-party clients.
+// A mode version never changes its behavior, fixes ship as a new version, so the config keeps doing what it did
+const (
+	// CompatEchoDuration grants exactly the requested duration, for clients rejecting grants of any other.
+	// Grant hints are not honored
+	CompatEchoDuration = "echo-duration.v1"
+	// CompatFirstTLV handles only the first unicast negotiation TLV of a signaling message,
+	// for clients appending stale or malformed negotiation TLVs after it
+	CompatFirstTLV = "first-tlv.v1"
+)
+
+// CompatModes are all supported compatibility modes
+var CompatModes = []string{CompatEchoDuration, CompatFirstTLV}
+
+// CompatRule enables the compatibility modes for the clients of the prefixes
+type CompatRule struct {
+	// Prefixes are client networks in CIDR notation
+	Prefixes []string
+	// Modes are the versioned compatibility modes, e.g. echo-duration.v1
+	Modes []string
+}
+
+// validateCompat checks the compatibility rules have prefixes and known modes
+func (dc *DynamicConfig) validateCompat() error {
+	for i, r := range dc.Compat {
+		if len(r.Prefixes) == 0 {
+			return fmt.Errorf("compat rule %d has no prefixes", i)
+		}
+		for _, p := range r.Prefixes {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				return fmt.Errorf("compat rule %d: %w", i, err)
+			}
+		}
+		if len(r.Modes) == 0 {
+			return fmt.Errorf("compat rule %d has no modes", i)
+		}
+		for _, m := range r.Modes {
+			if !knownCompatMode(m) {
+				return fmt.Errorf("compat rule %d: unsupported mode %q", i, m)
+			}
+		}
+	}
+	return nil
+}
+
+func knownCompatMode(mode string) bool {
+	for _, m := range CompatModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// compatEnabled reports whether any compatibility rule matching the client enables the mode
+func (dc *DynamicConfig) compatEnabled(ip net.IP, mode string) bool {
+	for _, r := range dc.Compat {
+		if !r.has(mode) {
+			continue
+		}
+		for _, p := range r.Prefixes {
+			if _, n, err := net.ParseCIDR(p); err == nil && n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *CompatRule) has(mode string) bool {
+	for _, m := range r.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// compatTLVs returns the TLVs of the signaling message from the client to handle
+func (s *Server) compatTLVs(ip net.IP, tlvs []ptp.TLV) []ptp.TLV {
+	if !s.Config.compatEnabled(ip, CompatFirstTLV) {
+		return tlvs
+	}
+	res := make([]ptp.TLV, 0, len(tlvs))
+	negotiated := false
+	for _, tlv := range tlvs {
+		if negotiationTLV(tlv) {
+			if negotiated {
+				s.Stats.IncCompat(CompatFirstTLV)
+				continue
+			}
+			negotiated = true
+		}
+		res = append(res, tlv)
+	}
+	return res
+}
+
+// negotiationTLV reports whether the TLV requests, cancels or acknowledges a unicast transmission
+func negotiationTLV(tlv ptp.TLV) bool {
+	switch tlv.(type) {
+	case *ptp.RequestUnicastTransmissionTLV, *ptp.CancelUnicastTransmissionTLV, *ptp.AcknowledgeCancelUnicastTransmissionTLV:
+		return true
+	}
+	return false
+}
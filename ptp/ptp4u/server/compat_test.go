@@ -0,0 +1,106 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCompat(t *testing.T) {
+	dc := DefaultDynamicConfig()
+	dc.Compat = []CompatRule{{Prefixes: []string{"10.0.0.0/8", "2001:db8::/32"}, Modes: CompatModes}}
+	require.NoError(t, dc.Validate())
+
+	for _, r := range []CompatRule{
+		{Modes: []string{CompatFirstTLV}},
+		{Prefixes: []string{"10.0.0.0/8"}},
+		{Prefixes: []string{"lolwut"}, Modes: []string{CompatFirstTLV}},
+		{Prefixes: []string{"10.0.0.0/8"}, Modes: []string{"first-tlv.v0"}},
+	} {
+		dc.Compat = []CompatRule{r}
+		require.Error(t, dc.Validate(), r)
+	}
+}
+
+func TestParseDynamicConfigCompat(t *testing.T) {
+	dc, err := ParseDynamicConfig([]byte(`utcoffset: 37s
+compat:
+- prefixes: ["10.1.0.0/16"]
+  modes: ["echo-duration.v1"]
+`))
+	require.NoError(t, err)
+	require.Equal(t, []CompatRule{{Prefixes: []string{"10.1.0.0/16"}, Modes: []string{CompatEchoDuration}}}, dc.Compat)
+}
+
+func TestCompatEnabled(t *testing.T) {
+	dc := &DynamicConfig{Compat: []CompatRule{
+		{Prefixes: []string{"10.0.0.0/8"}, Modes: []string{CompatFirstTLV}},
+		{Prefixes: []string{"10.1.0.0/16", "2001:db8::/32"}, Modes: []string{CompatEchoDuration}},
+	}}
+	require.True(t, dc.compatEnabled(net.ParseIP("10.1.2.3"), CompatFirstTLV))
+	require.True(t, dc.compatEnabled(net.ParseIP("10.1.2.3"), CompatEchoDuration))
+	require.True(t, dc.compatEnabled(net.ParseIP("10.2.2.3"), CompatFirstTLV))
+	require.False(t, dc.compatEnabled(net.ParseIP("10.2.2.3"), CompatEchoDuration))
+	require.True(t, dc.compatEnabled(net.ParseIP("2001:db8::1"), CompatEchoDuration))
+	require.False(t, dc.compatEnabled(net.ParseIP("192.168.0.1"), CompatFirstTLV))
+	require.False(t, (&DynamicConfig{}).compatEnabled(net.ParseIP("10.1.2.3"), CompatFirstTLV))
+}
+
+func TestCompatTLVs(t *testing.T) {
+	c := &Config{DynamicConfig: DynamicConfig{Compat: []CompatRule{{Prefixes: []string{"10.0.0.0/8"}, Modes: []string{CompatFirstTLV}}}}}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	sync := &ptp.RequestUnicastTransmissionTLV{MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0)}
+	announce := &ptp.RequestUnicastTransmissionTLV{MsgTypeAndReserved: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageAnnounce, 0)}
+	cancel := &ptp.CancelUnicastTransmissionTLV{MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0)}
+	auth := &ptp.AuthenticationTLV{}
+	tlvs := []ptp.TLV{sync, auth, announce, cancel}
+
+	require.Equal(t, tlvs, s.compatTLVs(net.ParseIP("192.168.0.1"), tlvs))
+	require.Equal(t, []ptp.TLV{sync, auth}, s.compatTLVs(net.ParseIP("10.0.0.1"), tlvs))
+	require.Equal(t, int64(2), st.Live()["compat.first-tlv.v1"])
+}
+
+func TestGrantDurationEchoCompat(t *testing.T) {
+	c := &Config{
+		StaticConfig: StaticConfig{GrantHints: true, GrantHintMinAge: time.Minute},
+		DynamicConfig: DynamicConfig{
+			MaxSubDuration: time.Hour,
+			Compat:         []CompatRule{{Prefixes: []string{"10.0.0.0/8"}, Modes: []string{CompatEchoDuration}}},
+		},
+	}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	ip := net.ParseIP("10.0.0.1")
+	sa := timestamp.IPToSockaddr(ip, 319)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	sc.setRunning(true)
+	sc.created = time.Now().Add(-2 * time.Minute)
+	fixed := ptp.GrantHint{Duration: 1800, Strategy: ptp.GrantHintFixed}
+
+	require.Equal(t, uint32(300), s.grantDuration(sc, ip, 300, fixed, true))
+	require.Equal(t, uint32(1800), s.grantDuration(sc, net.ParseIP("192.168.0.1"), 300, fixed, true))
+	require.Equal(t, int64(1), st.Live()["compat.echo-duration.v1"])
+	require.Equal(t, int64(1), st.Live()["granthint.honored"])
+}
@@ -27,35 +27,158 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
 	"golang.org/x/sys/unix"
 	yaml "gopkg.in/yaml.v2"
 )
 
 var errInsaneUTCoffset = errors.New("UTC offset is outside of sane range")
 
+const (
+	// AssignmentHash assigns a client to a worker based on the client identity hash
+	AssignmentHash = "hash"
+	// AssignmentLoad assigns a client to the least loaded of two hash candidates
+	AssignmentLoad = "load"
+)
+
 // dcMux is a dynamic config mutex
 var dcMux = sync.Mutex{}
 
 // StaticConfig is a set of static options which require a server restart
 type StaticConfig struct {
-	ConfigFile      string
-	DebugAddr       string
-	DomainNumber    uint
-	DrainFileName   string
-	DSCP            int
-	Interface       string
-	IP              net.IP
-	LogLevel        string
-	MonitoringPort  int
-	PidFile         string
-	QueueSize       int
-	RecvWorkers     int
-	SendWorkers     int
-	TimestampType   string
-	UndrainFileName string
+	ACLFile                string
+	AltTimeZone            string
+	AltTimeZoneInterval    time.Duration
+	AuthFile               string
+	BlocklistFile          string
+	CanaryCadenceBudget    time.Duration
+	CanaryInterval         time.Duration
+	CanaryTargets          []string
+	CanaryTXTSBudget       time.Duration
+	ClientStatsLimit       int
+	ClockClassDwell        time.Duration
+	ConfigFile             string
+	ConfigTokenFile        string
+	ConfigWatchInterval    time.Duration
+	DebugAddr              string
+	DebugTapFile           string
+	DebugTapMaxSize        int64
+	DebugTapSample         int
+	DefaultPriority1       uint8
+	DefaultPriority2       uint8
+	DomainNumber           uint
+	DrainFileName          string
+	DSCP                   int
+	DualStackPolicy        string
+	ECN                    bool
+	EventFlowLabel         uint32
+	EventHopLimit          int
+	EventsBatchSize        int
+	EventsFlushInterval    time.Duration
+	EventsURL              string
+	ExpectedSubscriptions  int
+	FollowUpBudget         time.Duration
+	FollowUpPolicy         string
+	FPSCaps                map[ptp.MessageType]int
+	FPSGlobalCap           int
+	GrantHintMinAge        time.Duration
+	GrantHints             bool
+	GeneralFlowLabel       uint32
+	GeneralHopLimit        int
+	GNMIPort               int
+	GNMITLSCert            string
+	GNMITLSKey             string
+	IdleSubscriptions      int
+	Interface              string
+	IP                     net.IP
+	KernelTXTrace          bool
+	LeapFile               string
+	LeapInterval           time.Duration
+	LeapSmear              time.Duration
+	Listeners              []Listener
+	LogBurst               int
+	LogLevel               string
+	LogRate                float64
+	MgmtSocket             string
+	MonitoringBackend      string
+	MonitoringPort         int
+	MTU                    int
+	PathDelay              bool
+	PathDelayPrefix4       int
+	PathDelayPrefix6       int
+	NTPCheckInterval       time.Duration
+	NTPMaxOffset           time.Duration
+	NTPServers             []string
+	PeerInterval           time.Duration
+	PeerKeyFile            string
+	PeerMaxOffset          time.Duration
+	PeerPort               int
+	Peers                  []string
+	PidFile                string
+	PolicyFile             string
+	QueueSize              int
+	QuirksFile             string
+	RcvBufMax              int
+	RecvWorkers            int
+	ReportIntervals        stats.ReportIntervals
+	RollbackWindow         time.Duration
+	Seccomp                string
+	SendWorkers            int
+	ShmStatsFile           string
+	ShmStatsInterval       time.Duration
+	ShutdownCancelRate     int
+	ShutdownTimeout        time.Duration
+	SimulatedEpoch         time.Time
+	Standby                bool
+	StatsD                 stats.StatsDConfig
+	StatsHistory           int
+	SubscriptionsPerWorker int
+	TenantsFile            string
+	TimeRate               float64
+	TimeSource             string
+	TimelineSize           int
+	TimestampType          string
+	TunnelCertFile         string
+	TunnelKeyFile          string
+	TunnelPort             int
+	UndrainFileName        string
+	UpstreamDomain         uint
+	UpstreamInterval       time.Duration
+	UpstreamSocket         string
+	UTCOffsetCheckInterval time.Duration
+	WorkerAssignment       string
+	WorkerCPUStats         bool
+}
+
+// DefaultStaticConfig returns the defaults of the static config which differ from the zero values
+func DefaultStaticConfig() StaticConfig {
+	return StaticConfig{
+		DefaultPriority1: 128,
+		DefaultPriority2: 128,
+	}
+}
+
+// FeatureFlags gate risky behaviors so they can be rolled out gradually
+type FeatureFlags struct {
+	// ShadowScheduler runs the drift-free grid scheduler in shadow mode and records its divergence
+	ShadowScheduler bool
+	// TimeSequence derives the first sequence ID of Sync and Announce subscriptions from time
+	TimeSequence bool
+}
+
+// Enabled reports whether the feature is turned on
+func (f FeatureFlags) Enabled(feature stats.Feature) bool {
+	switch feature {
+	case stats.FeatureShadowScheduler:
+		return f.ShadowScheduler
+	case stats.FeatureTimeSequence:
+		return f.TimeSequence
+	}
+	return false
 }
 
 // DynamicConfig is a set of dynamic options which don't need a server restart
@@ -64,24 +187,144 @@ type DynamicConfig struct {
 	ClockAccuracy ptp.ClockAccuracy
 	// ClockClass to report via announce messages. 6 - Locked with Primary Reference Clock
 	ClockClass ptp.ClockClass
+	// Compat are the compatibility modes of third-party clients by prefix
+	Compat []CompatRule `yaml:",omitempty"`
 	// DrainInterval is an interval for drain checks
 	DrainInterval time.Duration
+	// Features are the runtime feature flags. All disabled by default
+	Features FeatureFlags `yaml:",omitempty"`
 	// MaxSubDuration is a maximum sync/announce/delay_resp subscription duration
 	MaxSubDuration time.Duration
 	// MetricInterval is an interval of resetting metrics
 	MetricInterval time.Duration
 	// MinSubInterval is a minimum interval of the sync/announce subscription messages
 	MinSubInterval time.Duration
+	// Priority1 to report via announce messages, overriding DefaultPriority1 if set
+	Priority1 *uint8 `yaml:",omitempty"`
+	// Priority2 to report via announce messages, overriding DefaultPriority2 if set
+	Priority2 *uint8 `yaml:",omitempty"`
+	// Schedule are changes of this config applied at a future time
+	Schedule []ScheduledChange `yaml:",omitempty"`
 	// UTCOffset is a current UTC offset.
 	UTCOffset time.Duration
 }
 
+// DefaultDynamicConfig returns reasonable defaults for the dynamic config
+func DefaultDynamicConfig() DynamicConfig {
+	return DynamicConfig{
+		ClockAccuracy:  0x21,
+		ClockClass:     6,
+		DrainInterval:  30 * time.Second,
+		MaxSubDuration: 1 * time.Hour,
+		MetricInterval: 1 * time.Minute,
+		MinSubInterval: 1 * time.Second,
+		UTCOffset:      37 * time.Second,
+	}
+}
+
 // Config is a server config structure
 type Config struct {
 	StaticConfig
 	DynamicConfig
 
 	clockIdentity ptp.ClockIdentity
+	timeSrc       TimeSource
+	// clock the schedulers and expiry logic run on. System clock if nil
+	clock Clock
+	// degraded is set when the server drifted away from its peers
+	degraded int32
+	tenants  *tenantSet
+	// acl limits which clients may subscribe and how much. Everyone is allowed if nil
+	acl *accessControl
+	// policy decides grant requests by the operator rules. Everyone is allowed if nil
+	policy *grantPolicy
+	// auth authenticates sent and verifies received messages. Disabled if nil
+	auth *messageAuth
+	// maxPacketSize is the largest UDP payload sent without fragmentation. 0 means unlimited
+	maxPacketSize int
+	// clockClass debounces announced clock class changes. No debouncing if nil
+	clockClass *clockClassFilter
+	// leap announces leap seconds of the leap second file. UTC offset is static if nil
+	leap *leapSeconds
+	// altTime is the alternate time offset announced. Not announced if nil
+	altTime *altTimeOffset
+	// tap writes sampled requests and responses. Disabled if nil
+	tap *debugTap
+	// listeners the server serves on, the primary one first
+	listeners []*listener
+	// upstream is the grandmaster followed in boundary mode. Server is the grandmaster if nil
+	upstream *upstream
+}
+
+// Clock returns the clock the schedulers and expiry logic run on
+func (c *Config) Clock() Clock {
+	if c == nil || c.clock == nil {
+		return wallClock{}
+	}
+	return c.clock
+}
+
+// ClockQuality returns clock class and accuracy to announce.
+// Degraded server announces itself as uncalibrated
+func (c *Config) ClockQuality() (ptp.ClockClass, ptp.ClockAccuracy) {
+	return c.TenantClockQuality("")
+}
+
+// TenantClockQuality returns clock class and accuracy to announce to the tenant.
+// Degradation and pending class changes take precedence over the tenant overrides
+func (c *Config) TenantClockQuality(tenant string) (ptp.ClockClass, ptp.ClockAccuracy) {
+	class, accuracy := c.RawClockQuality()
+	if c.clockClass != nil {
+		class = c.clockClass.Published()
+	}
+	if atomic.LoadInt32(&c.degraded) == 1 || class != c.ClockClass || c.upstream.Grandmaster() != nil {
+		return class, accuracy
+	}
+	return c.tenants.ClockQuality(tenant, c.ClockClass, c.ClockAccuracy)
+}
+
+// Grandmaster returns the grandmaster to announce to the tenant.
+// In boundary mode it's the upstream grandmaster, unless the server is degraded
+func (c *Config) Grandmaster(tenant string) Grandmaster {
+	class, accuracy := c.TenantClockQuality(tenant)
+	if gm := c.upstream.Grandmaster(); gm != nil && atomic.LoadInt32(&c.degraded) == 0 {
+		g := *gm
+		g.ClockClass, g.ClockAccuracy = class, accuracy
+		return g
+	}
+	priority1, priority2 := c.Priorities()
+	return Grandmaster{
+		Identity:                c.clockIdentity,
+		Priority1:               priority1,
+		Priority2:               priority2,
+		ClockClass:              class,
+		ClockAccuracy:           accuracy,
+		OffsetScaledLogVariance: 23008,
+	}
+}
+
+// Priorities returns priority1 and priority2 to announce when the server is the grandmaster.
+// Dynamic config overrides the static defaults
+func (c *Config) Priorities() (uint8, uint8) {
+	priority1, priority2 := c.DefaultPriority1, c.DefaultPriority2
+	if c.DynamicConfig.Priority1 != nil {
+		priority1 = *c.DynamicConfig.Priority1
+	}
+	if c.DynamicConfig.Priority2 != nil {
+		priority2 = *c.DynamicConfig.Priority2
+	}
+	return priority1, priority2
+}
+
+// RawClockQuality returns clock class and accuracy before debouncing and tenant overrides
+func (c *Config) RawClockQuality() (ptp.ClockClass, ptp.ClockAccuracy) {
+	if atomic.LoadInt32(&c.degraded) == 1 {
+		return ptp.ClockClass52, ptp.ClockAccuracyUnknown
+	}
+	if gm := c.upstream.Grandmaster(); gm != nil {
+		return gm.ClockClass, gm.ClockAccuracy
+	}
+	return c.ClockClass, c.ClockAccuracy
 }
 
 // UTCOffsetSanity checks if UTC offset value has an adequate value
@@ -95,13 +338,18 @@ func (dc *DynamicConfig) UTCOffsetSanity() error {
 
 // ReadDynamicConfig reads dynamic config from the file
 func ReadDynamicConfig(path string) (*DynamicConfig, error) {
-	dc := &DynamicConfig{}
 	cData, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	err = yaml.Unmarshal(cData, &dc)
+	return ParseDynamicConfig(cData)
+}
+
+// ParseDynamicConfig parses dynamic config from YAML
+func ParseDynamicConfig(cData []byte) (*DynamicConfig, error) {
+	dc := &DynamicConfig{}
+	err := yaml.Unmarshal(cData, &dc)
 	if err != nil {
 		return nil, err
 	}
@@ -125,18 +373,7 @@ func (dc *DynamicConfig) Write(path string) error {
 
 // IfaceHasIP checks if selected IP is on interface
 func (c *Config) IfaceHasIP() (bool, error) {
-	ips, err := ifaceIPs(c.Interface)
-	if err != nil {
-		return false, err
-	}
-
-	for _, ip := range ips {
-		if c.IP.Equal(ip) {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return c.primary().HasIP()
 }
 
 // CreatePidFile creates a pid file in a defined location
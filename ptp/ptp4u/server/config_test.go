@@ -22,6 +22,8 @@ import (
 	"testing"
 	"time"
 
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
 )
@@ -98,6 +100,15 @@ utcoffset: "37s"
 	require.Equal(t, expected, dc)
 }
 
+func TestParseDynamicConfig(t *testing.T) {
+	dc, err := ParseDynamicConfig([]byte("clockclass: 7\nutcoffset: \"37s\"\n"))
+	require.NoError(t, err)
+	require.Equal(t, &DynamicConfig{ClockClass: 7, UTCOffset: 37 * time.Second}, dc)
+
+	_, err = ParseDynamicConfig([]byte("utcoffset: \"7s\"\n"))
+	require.ErrorIs(t, err, errInsaneUTCoffset)
+}
+
 func TestReadDynamicConfigInvalid(t *testing.T) {
 	config := `clockaccuracy: 1
 clockclass: 2
@@ -166,6 +177,26 @@ utcoffset: 37s
 	require.Equal(t, expected, string(rl))
 }
 
+func TestReadDynamicConfigFeatures(t *testing.T) {
+	config := `utcoffset: "37s"
+features:
+  shadowscheduler: true
+  timesequence: false
+`
+	cfg, err := os.CreateTemp("", "ptp4u")
+	require.NoError(t, err)
+	defer os.Remove(cfg.Name())
+
+	_, err = cfg.WriteString(config)
+	require.NoError(t, err)
+
+	dc, err := ReadDynamicConfig(cfg.Name())
+	require.NoError(t, err)
+	require.Equal(t, FeatureFlags{ShadowScheduler: true}, dc.Features)
+	require.True(t, dc.Features.Enabled(stats.FeatureShadowScheduler))
+	require.False(t, dc.Features.Enabled(stats.FeatureTimeSequence))
+}
+
 func TestUTCOffsetSanity(t *testing.T) {
 	dc := &DynamicConfig{}
 	dc.UTCOffset = 10 * time.Second
@@ -202,3 +233,57 @@ func TestPidFile(t *testing.T) {
 	require.NoError(t, err)
 	require.NoFileExists(t, c.PidFile)
 }
+
+func TestConfigClockQuality(t *testing.T) {
+	c := &Config{DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100}}
+
+	class, accuracy := c.ClockQuality()
+	require.Equal(t, ptp.ClockClass6, class)
+	require.Equal(t, ptp.ClockAccuracyNanosecond100, accuracy)
+
+	c.degraded = 1
+	class, accuracy = c.ClockQuality()
+	require.Equal(t, ptp.ClockClass52, class)
+	require.Equal(t, ptp.ClockAccuracyUnknown, accuracy)
+}
+
+func TestDefaultStaticConfig(t *testing.T) {
+	c := &Config{StaticConfig: DefaultStaticConfig()}
+	priority1, priority2 := c.Priorities()
+	require.Equal(t, uint8(128), priority1)
+	require.Equal(t, uint8(128), priority2)
+}
+
+func TestConfigPriorities(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{DefaultPriority1: 128, DefaultPriority2: 127}}
+
+	priority1, priority2 := c.Priorities()
+	require.Equal(t, uint8(128), priority1)
+	require.Equal(t, uint8(127), priority2)
+
+	p1, p2 := uint8(10), uint8(20)
+	c.DynamicConfig.Priority1 = &p1
+	priority1, priority2 = c.Priorities()
+	require.Equal(t, uint8(10), priority1)
+	require.Equal(t, uint8(127), priority2)
+
+	c.DynamicConfig.Priority2 = &p2
+	require.Equal(t, Grandmaster{Priority1: 10, Priority2: 20, ClockClass: 0, OffsetScaledLogVariance: 23008}, c.Grandmaster(""))
+}
+
+func TestConfigClockQualityDebounced(t *testing.T) {
+	now := time.Now()
+	c := &Config{DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100}}
+	c.clockClass = newClockClassFilter(time.Minute, ptp.ClockClass6, now)
+
+	c.ClockClass = ptp.ClockClass7
+	class, accuracy := c.ClockQuality()
+	require.Equal(t, ptp.ClockClass6, class)
+	require.Equal(t, ptp.ClockAccuracyNanosecond100, accuracy)
+	raw, _ := c.RawClockQuality()
+	require.Equal(t, ptp.ClockClass7, raw)
+
+	c.clockClass.update(raw, now.Add(time.Minute))
+	class, _ = c.ClockQuality()
+	require.Equal(t, ptp.ClockClass7, class)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"container/heap"
+	"sync/atomic"
+)
+
+// deadlineEntry is a send waiting in the worker queue
+type deadlineEntry struct {
+	c *SubscriptionClient
+	// deadline of the periodic send, arrival time of the send on request which has no interval to miss
+	deadline int64
+	// send on request, answering the latest request of the client
+	onRequest bool
+	// arrival order, breaks ties between equal deadlines
+	seq uint64
+}
+
+// deadlineQueue is a min heap of sends by the deadline
+type deadlineQueue []deadlineEntry
+
+func (q deadlineQueue) Len() int { return len(q) }
+func (q deadlineQueue) Less(i, j int) bool {
+	if q[i].deadline != q[j].deadline {
+		return q[i].deadline < q[j].deadline
+	}
+	return q[i].seq < q[j].seq
+}
+func (q deadlineQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *deadlineQueue) Push(x interface{}) {
+	*q = append(*q, x.(deadlineEntry))
+}
+
+func (q *deadlineQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = deadlineEntry{}
+	*q = old[:len(old)-1]
+	return e
+}
+
+// ready is a closed channel, receiving from it never blocks
+var ready = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// pendingFull reports the deadline heap holds QueueSize sends. The rest waits on the channel,
+// so a full worker keeps pushing back on the receive workers
+func (s *sendWorker) pendingFull() bool {
+	limit := s.config.QueueSize
+	if limit < 1 {
+		limit = 1
+	}
+	return len(s.pending) >= limit
+}
+
+// pendingQueue returns the channel to take the sends from, nil while the deadline heap is full
+func (s *sendWorker) pendingQueue() <-chan *SubscriptionClient {
+	if s.pendingFull() {
+		return nil
+	}
+	return s.queue
+}
+
+// pendingReady unblocks the worker loop while there are sends taken off the channel
+func (s *sendWorker) pendingReady() <-chan struct{} {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	return ready
+}
+
+// addPending moves the send into the deadline heap.
+// Sends on request are due when they arrive, so they go before the periodic sends which still have time,
+// but can't push the ones about to miss their interval back. They answer the latest request of the client,
+// so the repeated ones are dropped while the first one waits
+func (s *sendWorker) addPending(c *SubscriptionClient) {
+	e := deadlineEntry{c: c}
+	if atomic.LoadInt32(&c.queued) == 1 {
+		e.deadline = atomic.LoadInt64(&c.deadline)
+	} else {
+		if s.requested == nil {
+			s.requested = map[*SubscriptionClient]bool{}
+		}
+		if s.requested[c] {
+			return
+		}
+		s.requested[c] = true
+		e.onRequest = true
+		e.deadline = s.config.Clock().Now().UnixNano()
+	}
+	s.pendingSeq++
+	e.seq = s.pendingSeq
+	heap.Push(&s.pending, e)
+	atomic.StoreInt64(&s.pendingLen, int64(len(s.pending)))
+}
+
+// nextDue drains the channel into the deadline heap, up to QueueSize sends, and returns the send closest to its deadline
+func (s *sendWorker) nextDue() *SubscriptionClient {
+	for drained := false; !drained && !s.pendingFull(); {
+		select {
+		case c := <-s.queue:
+			s.addPending(c)
+		default:
+			drained = true
+		}
+	}
+	if len(s.pending) == 0 {
+		return nil
+	}
+	e := heap.Pop(&s.pending).(deadlineEntry)
+	atomic.StoreInt64(&s.pendingLen, int64(len(s.pending)))
+	if e.onRequest {
+		delete(s.requested, e.c)
+	}
+	return e.c
+}
+
+// backlog is the number of sends waiting for the worker, on the channel and in the deadline heap
+func (s *sendWorker) backlog() int {
+	return len(s.queue) + int(atomic.LoadInt64(&s.pendingLen))
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DualStackMerge keeps a single subscription per client identity which follows the address the client uses last
+	DualStackMerge = "merge"
+	// DualStackFirst keeps the subscription on the address the client subscribed from and denies requests from the other IP family
+	DualStackFirst = "first"
+)
+
+// sameFamily checks both IPs are either IPv4 or IPv6. IPv4-mapped IPv6 addresses are IPv4
+func sameFamily(a, b net.IP) bool {
+	return (a.To4() != nil) == (b.To4() != nil)
+}
+
+// clientSockaddr returns the client socket address usable with the sockets of the primary listener
+func (c *Config) clientSockaddr(ip net.IP, port int) unix.Sockaddr {
+	return c.primary().clientSockaddr(ip, port)
+}
+
+// address returns the client IP the subscription sends to
+func (sc *SubscriptionClient) address() net.IP {
+	sc.Lock()
+	defer sc.Unlock()
+	return timestamp.SockaddrToIP(sc.eclisa)
+}
+
+// AltAddress returns the last client IP of the other IP family the subscription was requested from. Nil if none
+func (sc *SubscriptionClient) AltAddress() net.IP {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.altAddress
+}
+
+// moveTo switches the subscription to the client addresses of the other IP family served by the listener
+func (sc *SubscriptionClient) moveTo(eclisa, gclisa unix.Sockaddr, listener int) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.altAddress = timestamp.SockaddrToIP(sc.eclisa)
+	sc.eclisa = eclisa
+	sc.gclisa = gclisa
+	sc.listener = listener
+}
+
+// useListener switches the subscription to the listener of the same IP family
+func (sc *SubscriptionClient) useListener(listener int) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.listener = listener
+}
+
+// seenFrom records the client IP of the other IP family without switching to it
+func (sc *SubscriptionClient) seenFrom(ip net.IP) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.altAddress = ip
+}
+
+// dualStackRequest applies the dual-stack policy to the request for the running subscription coming from ip on the listener.
+// Returns false if the request must be denied
+func (s *Server) dualStackRequest(sc *SubscriptionClient, ip net.IP, l *listener) bool {
+	current := sc.address()
+	if sameFamily(current, ip) {
+		// clients reaching the server over another uplink are served from there
+		sc.useListener(l.id)
+		return true
+	}
+	if s.Config.DualStackPolicy == DualStackFirst {
+		sc.seenFrom(ip)
+		return false
+	}
+	log.Infof("%s subscription moves from %s to %s", sc.subscriptionType, current, ip)
+	sc.moveTo(l.clientSockaddr(ip, ptp.PortEvent), l.clientSockaddr(ip, ptp.PortGeneral), l.id)
+	return true
+}
@@ -0,0 +1,93 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestSameFamily(t *testing.T) {
+	require.True(t, sameFamily(net.ParseIP("192.168.0.10"), net.ParseIP("10.0.0.1").To4()))
+	require.True(t, sameFamily(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")))
+	require.False(t, sameFamily(net.ParseIP("192.168.0.10"), net.ParseIP("2001:db8::1")))
+}
+
+func TestConfigClientSockaddr(t *testing.T) {
+	ip4 := net.ParseIP("192.168.0.10")
+	ip6 := net.ParseIP("2001:db8::1")
+
+	c := &Config{StaticConfig: StaticConfig{IP: net.ParseIP("10.0.0.1")}}
+	require.Equal(t, &unix.SockaddrInet4{Port: 319, Addr: [4]byte{192, 168, 0, 10}}, c.clientSockaddr(ip4, 319))
+
+	// dual-stack server addresses IPv4 clients by IPv4-mapped addresses
+	c = &Config{StaticConfig: StaticConfig{IP: net.ParseIP("::")}}
+	sa := c.clientSockaddr(ip4, 320)
+	sa6, ok := sa.(*unix.SockaddrInet6)
+	require.True(t, ok)
+	require.Equal(t, 320, sa6.Port)
+	require.True(t, ip4.Equal(timestamp.SockaddrToIP(sa)))
+	require.Equal(t, timestamp.IPToSockaddr(ip6, 319), c.clientSockaddr(ip6, 319))
+}
+
+func TestDualStackRequest(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{IP: net.ParseIP("::")}}
+	s := &Server{Config: c}
+	l := c.serving()[0]
+	ip4 := net.ParseIP("192.168.0.10")
+	ip6 := net.ParseIP("2001:db8::1")
+	sa := c.clientSockaddr(ip4, ptp.PortEvent)
+	sc := NewSubscriptionClient(nil, nil, sa, c.clientSockaddr(ip4, ptp.PortGeneral), ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+
+	require.True(t, s.dualStackRequest(sc, ip4, l))
+	require.Nil(t, sc.AltAddress())
+
+	// merge follows the client to the other IP family
+	require.True(t, s.dualStackRequest(sc, ip6, l))
+	require.True(t, ip6.Equal(sc.address()))
+	require.True(t, ip4.Equal(sc.AltAddress()))
+	require.Equal(t, timestamp.IPToSockaddr(ip6, ptp.PortGeneral), sc.gclisa)
+	// per client stats stay with the original address
+	require.Equal(t, "192.168.0.10", sc.client)
+
+	// first keeps the subscription where it is
+	c.DualStackPolicy = DualStackFirst
+	require.False(t, s.dualStackRequest(sc, ip4, l))
+	require.True(t, ip6.Equal(sc.address()))
+	require.True(t, ip4.Equal(sc.AltAddress()))
+	require.True(t, s.dualStackRequest(sc, ip6, l))
+}
+
+func TestDualStackMgmtSubscription(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{IP: net.ParseIP("::")}}
+	ip4 := net.ParseIP("192.168.0.10")
+	sc := NewSubscriptionClient(nil, nil, c.clientSockaddr(ip4, ptp.PortEvent), c.clientSockaddr(ip4, ptp.PortGeneral), ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	info := sc.info(0, ptp.PortIdentity{})
+	require.Equal(t, "192.168.0.10", info.Address)
+	require.False(t, info.DualStack)
+
+	sc.seenFrom(net.ParseIP("2001:db8::1"))
+	info = sc.info(0, ptp.PortIdentity{})
+	require.True(t, info.DualStack)
+	require.Equal(t, "2001:db8::1", info.AltAddress)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/events"
+)
+
+// eventState is what was last reported via events
+type eventState struct {
+	initialized   bool
+	subscriptions int64
+	clockClass    ptp.ClockClass
+	clockAccuracy ptp.ClockAccuracy
+	alarms        map[string]int64
+}
+
+// record adds the event to the timeline and publishes it to the webhook
+func (s *Server) record(e *events.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.timeline.Add(e)
+	s.events.Publish(e)
+}
+
+// alarms returns current state of the server alarms
+func (s *Server) alarms() map[string]int64 {
+	alarms := map[string]int64{}
+	if s.ntpCheck != nil {
+		alarms["ntp"] = s.ntpCheck.Alarm()
+	}
+	if s.peers != nil {
+		alarms["peer_drift"] = int64(s.Config.degraded)
+	}
+	if s.utcOffsetCheck != nil {
+		alarms["utc_offset"] = s.utcOffsetCheck.Alarm()
+	}
+	for _, p := range s.canaries {
+		alarms["canary_"+p.target] = p.alarmState()
+	}
+	return alarms
+}
+
+// publishEvents publishes changes since the last metric interval
+func (s *Server) publishEvents(subscriptions int64) {
+	if s.events == nil && s.timeline == nil {
+		return
+	}
+	class, accuracy := s.Config.ClockQuality()
+	alarms := s.alarms()
+	prev := s.eventState
+	s.eventState = eventState{
+		initialized:   true,
+		subscriptions: subscriptions,
+		clockClass:    class,
+		clockAccuracy: accuracy,
+		alarms:        alarms,
+	}
+	if !prev.initialized {
+		return
+	}
+
+	if class != prev.clockClass || accuracy != prev.clockAccuracy {
+		s.record(&events.Event{
+			Type:    events.TypeClockQuality,
+			Message: fmt.Sprintf("clock class %d -> %d, clock accuracy %d -> %d", prev.clockClass, class, prev.clockAccuracy, accuracy),
+			Fields:  map[string]int64{"clockclass": int64(class), "clockaccuracy": int64(accuracy)},
+		})
+	}
+	for name, alarm := range alarms {
+		if alarm == prev.alarms[name] {
+			continue
+		}
+		state := "cleared"
+		if alarm != 0 {
+			state = "raised"
+		}
+		s.record(&events.Event{
+			Type:    events.TypeAlarm,
+			Message: fmt.Sprintf("%s alarm %s", name, state),
+			Fields:  map[string]int64{name: alarm},
+		})
+	}
+	if delta := subscriptions - prev.subscriptions; delta != 0 {
+		s.record(&events.Event{
+			Type:    events.TypeSubscriptions,
+			Message: fmt.Sprintf("%d running subscriptions, %+d over the metric interval", subscriptions, delta),
+			Fields:  map[string]int64{"subscriptions": subscriptions, "delta": delta},
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/events"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishEvents(t *testing.T) {
+	received := make(chan []events.Event, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []events.Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		received <- batch
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Server{Config: &Config{DynamicConfig: DynamicConfig{ClockClass: 6, ClockAccuracy: 33}}}
+	s.events = events.NewWebhook(ts.URL, 10, 50*time.Millisecond)
+	go s.events.Run(ctx)
+
+	// first call only sets the baseline
+	s.publishEvents(10)
+	// nothing changed
+	s.publishEvents(10)
+
+	s.Config.ClockClass = 7
+	s.publishEvents(12)
+
+	var got []events.Event
+	for len(got) < 2 {
+		select {
+		case batch := <-received:
+			got = append(got, batch...)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for events")
+		}
+	}
+	require.Len(t, got, 2)
+	require.Equal(t, events.TypeClockQuality, got[0].Type)
+	require.Equal(t, int64(7), got[0].Fields["clockclass"])
+	require.Equal(t, events.TypeSubscriptions, got[1].Type)
+	require.Equal(t, int64(2), got[1].Fields["delta"])
+}
+
+func TestPublishEventsDisabled(t *testing.T) {
+	s := &Server{Config: &Config{}}
+	s.publishEvents(10)
+	require.False(t, s.eventState.initialized)
+}
+
+func TestTimelineEvents(t *testing.T) {
+	c := &Config{DynamicConfig: DynamicConfig{
+		ClockClass:     6,
+		ClockAccuracy:  33,
+		DrainInterval:  30 * time.Second,
+		MaxSubDuration: time.Hour,
+		MetricInterval: time.Minute,
+		MinSubInterval: time.Second,
+		UTCOffset:      37 * time.Second,
+	}}
+	s := &Server{Config: c, Stats: stats.NewJSONStats()}
+	s.timeline = events.NewTimeline(10)
+
+	s.GracefulDrain(false)
+	s.GracefulUndrain()
+	dc := s.Config.DynamicConfig
+	dc.ClockClass = 7
+	require.NoError(t, s.applyDynamicConfig(&dc))
+	s.publishEvents(0)
+	s.publishEvents(0)
+
+	got := s.timeline.Events(time.Time{}, "", 0)
+	require.Len(t, got, 3)
+	require.Equal(t, "graceful drain engaged", got[0].Message)
+	require.Equal(t, "graceful drain released", got[1].Message)
+	require.Equal(t, events.TypeConfig, got[2].Type)
+	require.Equal(t, int64(1), got[2].Fields["generation"])
+	require.False(t, got[2].Time.Before(got[0].Time))
+}
@@ -0,0 +1,128 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+)
+
+const (
+	// FollowUpSkip drops the Follow_Up when the TX timestamp misses the budget
+	FollowUpSkip = "skip"
+	// FollowUpSoftware sends the Follow_Up with a software timestamp flagged by an ORGANIZATION_EXTENSION TLV
+	FollowUpSoftware = "software"
+	// FollowUpResend sends the Sync again and drops the Follow_Up only if the second TX timestamp misses the budget too
+	FollowUpResend = "resend"
+)
+
+// outcomes of the Follow_Up budget counted in stats
+const (
+	followUpOnTime   = "ontime"
+	followUpSkipped  = "skipped"
+	followUpSoftware = "software"
+	followUpResent   = "resent"
+)
+
+// errFollowUpSkipped means the Follow_Up is not sent as its TX timestamp missed the budget
+var errFollowUpSkipped = errors.New("TX timestamp missed the Follow_Up budget")
+
+// SoftwareTimestampTLV flags the message carrying a software timestamp taken after the TX timestamp missed the budget.
+// Clients unaware of the extension organization ignore the TLV
+var SoftwareTimestampTLV = &ptp.OrganizationExtensionTLV{
+	TLVHead: ptp.TLVHead{
+		TLVType:     ptp.TLVOrganizationExtension,
+		LengthField: 6,
+	},
+	OrganizationID:      ptp.ExtensionOrganizationID,
+	OrganizationSubType: [3]byte{0x00, 0x00, 0x01},
+}
+
+// readTXTimestamp reads TX timestamp of the Sync just sent, waiting no longer than the Follow_Up budget
+func (s *sendWorker) readTXTimestamp(eFd int, oob, toob []byte) (time.Time, error) {
+	start := time.Now()
+	var deadline time.Time
+	if s.config.FollowUpBudget > 0 {
+		deadline = start.Add(s.config.FollowUpBudget)
+	}
+	txTS, attempts, err := timestamp.ReadTXtimestampBufDeadline(eFd, oob, toob, deadline)
+	s.stats.ObserveTXTSLatency(time.Since(start))
+	s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
+	s.txtsAttempts = attempts
+	return txTS, err
+}
+
+// followUpTimestamp returns the timestamp of the Sync sent to the client for its Follow_Up and whether it is a software one.
+// When the TX timestamp misses the Follow_Up budget the policy applies, errFollowUpSkipped means no Follow_Up is to be sent.
+// Without the budget the TX timestamp read error is returned
+func (s *sendWorker) followUpTimestamp(l *listener, eFd int, c *SubscriptionClient, sync, oob, toob []byte) (time.Time, bool, error) {
+	sent := time.Now()
+	txTS, err := s.readTXTimestamp(eFd, oob, toob)
+	c.canary.sent(sent, time.Since(sent), err)
+	if err == nil {
+		if s.config.FollowUpBudget > 0 {
+			s.stats.IncFollowUpOutcome(followUpOnTime)
+		}
+		return l.timeSrc.TXTimestamp(txTS), false, nil
+	}
+	if s.config.FollowUpBudget <= 0 {
+		return time.Time{}, false, err
+	}
+
+	switch s.config.FollowUpPolicy {
+	case FollowUpSoftware:
+		// the Sync left about the time the read started
+		elapsed := time.Since(sent)
+		now, nerr := l.timeSrc.Now()
+		if nerr != nil {
+			break
+		}
+		s.stats.IncFollowUpOutcome(followUpSoftware)
+		return now.Add(-elapsed), true, nil
+	case FollowUpResend:
+		if serr := sendTo(eFd, sync, c.eclisa, s.config.EventFlowLabel); serr != nil {
+			break
+		}
+		s.incTX(l, ptp.MessageSync)
+		s.stats.IncClientTX(c.client, ptp.MessageSync)
+		if txTS, err = s.readTXTimestamp(eFd, oob, toob); err == nil {
+			s.stats.IncFollowUpOutcome(followUpResent)
+			return l.timeSrc.TXTimestamp(txTS), false, nil
+		}
+	}
+	s.stats.IncFollowUpOutcome(followUpSkipped)
+	return time.Time{}, false, fmt.Errorf("%w: %v", errFollowUpSkipped, err)
+}
+
+// followUpBytesTo serializes and signs the message carrying the Sync timestamp, flagging software timestamps
+func (s *sendWorker) followUpBytesTo(p ptp.BinaryMarshalerTo, buf []byte, software bool) (int, error) {
+	if !software {
+		return s.bytesTo(p, buf)
+	}
+	n, err := ptp.BytesTo(p, buf)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = ptp.AppendTLV(buf, n, SoftwareTimestampTLV); err != nil {
+		return 0, err
+	}
+	return s.config.auth.sign(buf, n)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// followUpStats records the Follow_Up budget outcomes
+type followUpStats struct {
+	*stats.JSONStats
+	outcomes map[string]int
+}
+
+func (s *followUpStats) IncFollowUpOutcome(outcome string) { s.outcomes[outcome]++ }
+
+// newFollowUpWorker returns a send worker with a software timestamped event socket and a peer receiving its Syncs
+func newFollowUpWorker(t *testing.T, policy string) (*sendWorker, *followUpStats, int, *SubscriptionClient, *net.UDPConn) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	t.Cleanup(func() { peer.Close() })
+
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 100, FollowUpBudget: time.Millisecond, FollowUpPolicy: policy},
+	}
+	c.timeSrc = &SysClockTimeSource{config: c}
+	fd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, c.timeSrc.EnableTimestamps(fd))
+
+	st := &followUpStats{JSONStats: stats.NewJSONStats(), outcomes: map[string]int{}}
+	w := newSendWorker(0, c, st)
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), peer.LocalAddr().(*net.UDPAddr).Port)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	return w, st, fd, sc, peer
+}
+
+func TestFollowUpTimestampOnTime(t *testing.T) {
+	w, st, fd, sc, _ := newFollowUpWorker(t, FollowUpSkip)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+	sync := []byte{1, 2, 3, 4}
+
+	w.config.FollowUpBudget = time.Second
+	require.NoError(t, sendTo(fd, sync, sc.eclisa, 0))
+	ts, software, err := w.followUpTimestamp(w.config.serving()[0], fd, sc, sync, oob, toob)
+	require.NoError(t, err)
+	require.False(t, software)
+	require.WithinDuration(t, time.Now(), ts, time.Second)
+	require.Equal(t, map[string]int{followUpOnTime: 1}, st.outcomes)
+}
+
+func TestFollowUpTimestampSkip(t *testing.T) {
+	w, st, fd, sc, _ := newFollowUpWorker(t, FollowUpSkip)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+
+	_, _, err := w.followUpTimestamp(w.config.serving()[0], fd, sc, []byte{1, 2, 3, 4}, oob, toob)
+	require.True(t, errors.Is(err, errFollowUpSkipped))
+	require.Equal(t, map[string]int{followUpSkipped: 1}, st.outcomes)
+}
+
+func TestFollowUpTimestampSoftware(t *testing.T) {
+	w, st, fd, sc, _ := newFollowUpWorker(t, FollowUpSoftware)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+
+	before := time.Now()
+	ts, software, err := w.followUpTimestamp(w.config.serving()[0], fd, sc, []byte{1, 2, 3, 4}, oob, toob)
+	require.NoError(t, err)
+	require.True(t, software)
+	require.False(t, ts.Before(before.Round(0)))
+	require.False(t, ts.After(time.Now()))
+	require.Equal(t, map[string]int{followUpSoftware: 1}, st.outcomes)
+}
+
+func TestFollowUpTimestampResend(t *testing.T) {
+	w, st, fd, sc, peer := newFollowUpWorker(t, FollowUpResend)
+	oob := make([]byte, timestamp.ControlSizeBytes)
+	toob := make([]byte, timestamp.ControlSizeBytes)
+	sync := []byte{1, 2, 3, 4}
+
+	w.config.FollowUpBudget = 50 * time.Millisecond
+	ts, software, err := w.followUpTimestamp(w.config.serving()[0], fd, sc, sync, oob, toob)
+	require.NoError(t, err)
+	require.False(t, software)
+	require.WithinDuration(t, time.Now(), ts, time.Second)
+	require.Equal(t, map[string]int{followUpResent: 1}, st.outcomes)
+
+	// the Sync is sent again to the client
+	buf := make([]byte, 16)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, sync, buf[:n])
+}
+
+func TestFollowUpBytesToSoftware(t *testing.T) {
+	w, _, _, sc, _ := newFollowUpWorker(t, FollowUpSoftware)
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+
+	sc.UpdateFollowup(time.Now())
+	n, err := w.followUpBytesTo(sc.Followup(), buf, false)
+	require.NoError(t, err)
+	require.Equal(t, 46, n)
+
+	n, err = w.followUpBytesTo(sc.Followup(), buf, true)
+	require.NoError(t, err)
+	require.Equal(t, 56, n)
+	require.Equal(t, uint16(54), binary.BigEndian.Uint16(buf[2:]))
+	got := &ptp.OrganizationExtensionTLV{}
+	require.NoError(t, got.UnmarshalBinary(buf[44:54]))
+	require.Equal(t, SoftwareTimestampTLV.TLVHead, got.TLVHead)
+	require.Equal(t, SoftwareTimestampTLV.OrganizationID, got.OrganizationID)
+	require.Equal(t, SoftwareTimestampTLV.OrganizationSubType, got.OrganizationSubType)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// fpsCheckInterval is how often the send rate of the subscriptions is checked against the FPS caps
+const fpsCheckInterval = time.Second
+
+// fpsTypes are the message types sent periodically, whose intervals can be stretched
+var fpsTypes = map[string]ptp.MessageType{
+	"sync":     ptp.MessageSync,
+	"announce": ptp.MessageAnnounce,
+}
+
+// ParseFPSCaps parses comma separated list of type:pps caps, e.g. sync:50000,announce:10000
+func ParseFPSCaps(s string) (map[ptp.MessageType]int, error) {
+	res := map[ptp.MessageType]int{}
+	if s == "" {
+		return res, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("FPS cap %q is not type:pps", entry)
+		}
+		t, ok := fpsTypes[strings.ToLower(parts[0])]
+		if !ok {
+			return nil, fmt.Errorf("FPS cap %q has unsupported message type %q", entry, parts[0])
+		}
+		v, err := strconv.Atoi(parts[1])
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("FPS cap %q has invalid rate %q", entry, parts[1])
+		}
+		res[t] = v
+	}
+	return res, nil
+}
+
+// packetsPerSend is the number of packets a periodic send of the message type consists of
+func packetsPerSend(t ptp.MessageType) float64 {
+	if t == ptp.MessageSync {
+		// Sync and its Follow_Up
+		return 2
+	}
+	return 1
+}
+
+// fpsStretch returns the factors the intervals of the message types are stretched by so the demand fits the caps.
+// Every type is stretched to fit its own cap first, then all of them proportionally to fit the global cap of all packets.
+// Zero cap means no limit
+func fpsStretch(demand map[ptp.MessageType]float64, caps map[ptp.MessageType]int, global int) map[ptp.MessageType]float64 {
+	stretch := map[ptp.MessageType]float64{}
+	var total float64
+	for t, pps := range demand {
+		stretch[t] = 1
+		if limit := float64(caps[t]); limit > 0 && pps > limit {
+			stretch[t] = pps / limit
+		}
+		total += pps / stretch[t] * packetsPerSend(t)
+	}
+	if limit := float64(global); limit > 0 && total > limit {
+		for t := range stretch {
+			stretch[t] *= total / limit
+		}
+	}
+	return stretch
+}
+
+// fpsLimiter keeps the send rate of the subscriptions under the FPS caps
+type fpsLimiter struct {
+	sync.Mutex
+	// last measured demand and the applied stretch
+	demand  map[ptp.MessageType]float64
+	stretch map[ptp.MessageType]float64
+}
+
+// limitFPS stretches the intervals of the running subscriptions to fit the FPS caps
+func (s *Server) limitFPS() {
+	subs := s.runningSubscriptions()
+	demand := map[ptp.MessageType]float64{}
+	for _, sc := range subs {
+		if sc.subscriptionType != ptp.MessageSync && sc.subscriptionType != ptp.MessageAnnounce {
+			continue
+		}
+		if interval := sc.Interval(); interval > 0 {
+			demand[sc.subscriptionType] += float64(time.Second) / float64(interval)
+		}
+	}
+	stretch := fpsStretch(demand, s.Config.FPSCaps, s.Config.FPSGlobalCap)
+	for _, sc := range subs {
+		sc.SetStretch(stretch[sc.subscriptionType])
+	}
+
+	s.fps.Lock()
+	defer s.fps.Unlock()
+	for t, f := range stretch {
+		if prev := s.fps.stretch[t]; f > 1 && prev <= 1 {
+			log.Warningf("%s demand of %.0f pps is over the FPS caps, stretching the intervals %.2f times", t, demand[t], f)
+		} else if f <= 1 && prev > 1 {
+			log.Infof("%s demand of %.0f pps fits the FPS caps again", t, demand[t])
+		}
+	}
+	s.fps.demand, s.fps.stretch = demand, stretch
+}
+
+// startFPSLimiter checks the subscriptions against the FPS caps every fpsCheckInterval
+func (s *Server) startFPSLimiter() {
+	for range time.Tick(fpsCheckInterval) {
+		s.limitFPS()
+	}
+}
+
+// reportFPS reports the last measured demand and the applied stretch
+func (s *Server) reportFPS() {
+	s.fps.Lock()
+	defer s.fps.Unlock()
+	types := make([]int, 0, len(s.fps.demand))
+	for t := range s.fps.demand {
+		types = append(types, int(t))
+	}
+	sort.Ints(types)
+	for _, i := range types {
+		t := ptp.MessageType(i)
+		s.Stats.SetFPSDemand(t, int64(s.fps.demand[t]))
+		s.Stats.SetFPSStretch(t, int64(s.fps.stretch[t]*100))
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFPSCaps(t *testing.T) {
+	caps, err := ParseFPSCaps("")
+	require.NoError(t, err)
+	require.Empty(t, caps)
+
+	caps, err = ParseFPSCaps("sync:50000, Announce:1000")
+	require.NoError(t, err)
+	require.Equal(t, map[ptp.MessageType]int{ptp.MessageSync: 50000, ptp.MessageAnnounce: 1000}, caps)
+
+	for _, s := range []string{"sync", "delay_resp:10", "sync:0", "sync:fast"} {
+		_, err = ParseFPSCaps(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestFPSStretch(t *testing.T) {
+	demand := map[ptp.MessageType]float64{ptp.MessageSync: 2000, ptp.MessageAnnounce: 100}
+
+	require.Equal(t, map[ptp.MessageType]float64{ptp.MessageSync: 1, ptp.MessageAnnounce: 1}, fpsStretch(demand, nil, 0))
+
+	// per type cap
+	caps := map[ptp.MessageType]int{ptp.MessageSync: 1000}
+	require.Equal(t, map[ptp.MessageType]float64{ptp.MessageSync: 2, ptp.MessageAnnounce: 1}, fpsStretch(demand, caps, 0))
+
+	// 1000 Syncs with their Follow_Ups and 100 Announces are stretched to fit 1050 packets
+	require.Equal(t, map[ptp.MessageType]float64{ptp.MessageSync: 4, ptp.MessageAnnounce: 2}, fpsStretch(demand, caps, 1050))
+}
+
+func TestServerLimitFPS(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			FPSCaps:   map[ptp.MessageType]int{ptp.MessageSync: 2},
+			QueueSize: 10,
+		},
+	}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	s.sw = []*sendWorker{newSendWorker(0, c, st)}
+	w := s.sw[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.10"), 319)
+	for i, mt := range []ptp.MessageType{ptp.MessageSync, ptp.MessageSync, ptp.MessageAnnounce} {
+		sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, mt, c, 500*time.Millisecond, time.Now().Add(time.Minute))
+		w.RegisterSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(i)}, mt, sc)
+		sc.launch(ctx)
+	}
+
+	s.limitFPS()
+	require.Equal(t, map[ptp.MessageType]float64{ptp.MessageSync: 4, ptp.MessageAnnounce: 2}, s.fps.demand)
+	require.Equal(t, map[ptp.MessageType]float64{ptp.MessageSync: 2, ptp.MessageAnnounce: 1}, s.fps.stretch)
+	for _, sc := range s.runningSubscriptions() {
+		if sc.subscriptionType == ptp.MessageSync {
+			require.Equal(t, time.Second, sc.sendInterval())
+		} else {
+			require.Equal(t, 500*time.Millisecond, sc.sendInterval())
+		}
+		// clients are still told the granted interval
+		require.Equal(t, 500*time.Millisecond, sc.Interval())
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/facebook/time/ptp/ptp4u/gnmi"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// listenGNMI sets up the gNMI server of the stats reported every metric interval
+func (s *Server) listenGNMI() (*grpc.Server, net.Listener, error) {
+	var opts []grpc.ServerOption
+	if s.Config.GNMITLSCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(s.Config.GNMITLSCert, s.Config.GNMITLSKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading gNMI TLS certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Config.GNMIPort))
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening for gNMI: %w", err)
+	}
+	g := grpc.NewServer(opts...)
+	gpb.RegisterGNMIServer(g, gnmi.NewServer(s.Stats.Report, s.Config.MetricInterval))
+	log.Infof("Starting gNMI server on %s", l.Addr())
+	return g, l, nil
+}
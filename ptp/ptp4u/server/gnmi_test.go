@@ -0,0 +1,57 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestListenGNMI(t *testing.T) {
+	st := stats.NewJSONStats()
+	st.SetClockClass(6)
+	st.Snapshot()
+	s := &Server{
+		Config: &Config{DynamicConfig: DynamicConfig{MetricInterval: time.Second}},
+		Stats:  st,
+	}
+	g, l, err := s.listenGNMI()
+	require.NoError(t, err)
+	go func() { _ = g.Serve(l) }()
+	defer g.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	res, err := gpb.NewGNMIClient(conn).Get(context.Background(), &gpb.GetRequest{
+		Path:     []*gpb.Path{{Elem: []*gpb.PathElem{{Name: "clockclass"}}}},
+		Encoding: gpb.Encoding_PROTO,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(6), res.Notification[0].Update[0].Val.GetIntVal())
+
+	s.Config.GNMITLSCert = "/does/not/exist"
+	_, _, err = s.listenGNMI()
+	require.Error(t, err)
+}
@@ -0,0 +1,198 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden wire format vectors in testdata/wire")
+
+// wireConfig is a config permutation the wire format vectors are recorded for
+type wireConfig struct {
+	name   string
+	config DynamicConfig
+	domain uint
+	tenant *Tenant
+}
+
+var wireConfigs = []wireConfig{
+	{
+		name:   "default",
+		config: DynamicConfig{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100, UTCOffset: 37 * time.Second},
+	},
+	{
+		name:   "domain24_holdover",
+		config: DynamicConfig{ClockClass: ptp.ClockClass7, ClockAccuracy: ptp.ClockAccuracyMicrosecond1, UTCOffset: 37 * time.Second},
+		domain: 24,
+	},
+	{
+		name:   "tenant_override",
+		config: DynamicConfig{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100, UTCOffset: 37 * time.Second},
+		tenant: &Tenant{Name: "tenant", ClockClass: ptp.ClockClass52, ClockAccuracy: ptp.ClockAccuracyMicrosecond25},
+	},
+}
+
+var (
+	wireTime   = time.Unix(1700000000, 123456789)
+	wireClient = ptp.PortIdentity{ClockIdentity: 0xc42a1fffe6d7ca6, PortNumber: 1}
+)
+
+func wireSubscription(wc wireConfig, st ptp.MessageType) *SubscriptionClient {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(0x248a07fffe4a2b8c),
+		StaticConfig:  StaticConfig{DomainNumber: wc.domain, DefaultPriority1: 128, DefaultPriority2: 128},
+		DynamicConfig: wc.config,
+	}
+	var tenants []*Tenant
+	if wc.tenant != nil {
+		tenants = append(tenants, wc.tenant)
+	}
+	c.tenants = newTenantSet(tenants)
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, st, c, time.Second, wireTime)
+	if wc.tenant != nil {
+		sc.tenant = wc.tenant.Name
+	}
+	sc.sequenceID = 42
+	return sc
+}
+
+func wireRequest(t ptp.MessageType, domain uint) *ptp.Signaling {
+	return &ptp.Signaling{
+		Header: ptp.Header{
+			SdoIDAndMsgType:    ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0),
+			Version:            ptp.Version,
+			DomainNumber:       uint8(domain),
+			SequenceID:         7,
+			SourcePortIdentity: wireClient,
+			LogMessageInterval: 0x7f,
+		},
+		TLVs: []ptp.TLV{
+			&ptp.RequestUnicastTransmissionTLV{
+				TLVHead:               ptp.TLVHead{TLVType: ptp.TLVRequestUnicastTransmission},
+				MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(t, 0),
+				LogInterMessagePeriod: 0,
+				DurationField:         300,
+			},
+		},
+	}
+}
+
+// wireMessages returns the messages sent for the config permutation in sorted order
+func wireMessages(t *testing.T, wc wireConfig) [][2]string {
+	var msgs [][2]string
+	add := func(name string, p ptp.Packet) {
+		b, err := ptp.Bytes(p)
+		require.NoError(t, err)
+		msgs = append(msgs, [2]string{name, hex.EncodeToString(b)})
+	}
+
+	sc := wireSubscription(wc, ptp.MessageAnnounce)
+	sc.UpdateAnnounce()
+	add("announce", sc.Announce())
+
+	sc = wireSubscription(wc, ptp.MessageSync)
+	sc.UpdateSync()
+	add("sync", sc.Sync())
+	sc.UpdateFollowup(wireTime)
+	add("follow_up", sc.Followup())
+
+	sc = wireSubscription(wc, ptp.MessageDelayResp)
+	sc.UpdateDelayResp(&ptp.Header{SequenceID: 9, CorrectionField: ptp.NewCorrection(1500), SourcePortIdentity: wireClient}, wireTime)
+	add("delay_resp", sc.DelayResp())
+
+	// unicast DelayReq mode answering every DelayReq with Sync and Announce
+	sc = wireSubscription(wc, ptp.MessageDelayReq)
+	sc.UpdateSyncDelayReq(wireTime, 11)
+	add("delay_req.sync", sc.Sync())
+	sc.UpdateAnnounceDelayReq(ptp.NewCorrection(250), 11)
+	sc.UpdateAnnounceFollowUp(wireTime)
+	add("delay_req.announce", sc.Announce())
+
+	for _, st := range []ptp.MessageType{ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp} {
+		sc = wireSubscription(wc, st)
+		sc.UpdateSignalingGrant(wireRequest(st, wc.domain), ptp.NewUnicastMsgTypeAndFlags(st, 0), 0, 300)
+		add(fmt.Sprintf("signaling.grant.%s", strings.ToLower(st.String())), sc.Signaling())
+		sc.UpdateSignalingCancel()
+		add(fmt.Sprintf("signaling.cancel.%s", strings.ToLower(st.String())), sc.Signaling())
+	}
+	return msgs
+}
+
+func readGolden(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var msgs [][2]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		msgs = append(msgs, [2]string{fields[0], fields[1]})
+	}
+	return msgs, scanner.Err()
+}
+
+func writeGolden(path string, msgs [][2]string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by go test -run TestWireFormatGolden -update. Review every change\n")
+	for _, m := range msgs {
+		fmt.Fprintf(&b, "%s %s\n", m[0], m[1])
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// TestWireFormatGolden protects the encoding of the messages ptp4u sends from unintended changes
+func TestWireFormatGolden(t *testing.T) {
+	for _, wc := range wireConfigs {
+		t.Run(wc.name, func(t *testing.T) {
+			path := filepath.Join("testdata", "wire", wc.name+".golden")
+			msgs := wireMessages(t, wc)
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, writeGolden(path, msgs))
+				return
+			}
+			golden, err := readGolden(path)
+			require.NoError(t, err, "run go test -run TestWireFormatGolden -update to record the vectors")
+			require.Equal(t, golden, msgs, "wire format changed. Rerun with -update if the change is intended")
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// MgmtDrain is the graceful drain state reported by the drain API
+type MgmtDrain struct {
+	Drained       bool `json:"drained"`
+	Subscriptions int  `json:"subscriptions"`
+}
+
+// runningSubscriptions returns subscriptions of all workers which are sending now
+func (s *Server) runningSubscriptions() []*SubscriptionClient {
+	subs := []*SubscriptionClient{}
+	for _, w := range s.sw {
+		w.mux.Lock()
+		for _, clients := range w.clients {
+			for _, sc := range clients {
+				if sc.Running() {
+					subs = append(subs, sc)
+				}
+			}
+		}
+		w.mux.Unlock()
+	}
+	return subs
+}
+
+// Drained reports if the server is gracefully drained
+func (s *Server) Drained() bool {
+	return atomic.LoadInt32(&s.gracefulDrain) == 1
+}
+
+// GracefulDrain stops granting subscriptions, including renewals, so the running ones expire on their own.
+// With cancel running subscriptions are stopped at ShutdownCancelRate per second, sending CANCEL_UNICAST_TRANSMISSION to the clients
+func (s *Server) GracefulDrain(cancel bool) {
+	if atomic.SwapInt32(&s.gracefulDrain, 1) == 0 {
+		log.Warningf("Graceful drain engaged, rejecting new subscriptions")
+		s.Stats.SetDrained(1)
+		s.record(&events.Event{Type: events.TypeDrain, Message: "graceful drain engaged"})
+	}
+	if !cancel {
+		return
+	}
+	var pace time.Duration
+	if s.Config.ShutdownCancelRate > 0 {
+		pace = time.Second / time.Duration(s.Config.ShutdownCancelRate)
+	}
+	subs := s.runningSubscriptions()
+	log.Warningf("Cancelling %d subscriptions", len(subs))
+	for _, sc := range subs {
+		// undrain stops the cancellation
+		if !s.Drained() {
+			return
+		}
+		sc.Stop()
+		time.Sleep(pace)
+	}
+}
+
+// GracefulUndrain resumes granting subscriptions
+func (s *Server) GracefulUndrain() {
+	if atomic.SwapInt32(&s.gracefulDrain, 0) == 1 {
+		log.Warningf("Graceful drain released, granting subscriptions")
+		s.Stats.SetDrained(0)
+		s.record(&events.Event{Type: events.TypeDrain, Message: "graceful drain released"})
+	}
+}
+
+// handleDrain engages (POST) or releases (DELETE) the graceful drain.
+// POST with cancel=true also cancels running subscriptions in the background
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		if !s.authorized(r) {
+			log.Warningf("Unauthorized drain change from %s", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			s.GracefulUndrain()
+			break
+		}
+		log.Warningf("Graceful drain requested from %s", r.RemoteAddr)
+		s.GracefulDrain(false)
+		if r.URL.Query().Get("cancel") == "true" {
+			go s.GracefulDrain(true)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mgmtReply(w, r, &MgmtDrain{Drained: s.Drained(), Subscriptions: len(s.runningSubscriptions())})
+}
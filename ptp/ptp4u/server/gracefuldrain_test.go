@@ -0,0 +1,107 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGracefulDrain(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 10, ShutdownCancelRate: 1000},
+	}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	s.sw = []*sendWorker{newSendWorker(0, c, st)}
+	w := s.sw[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.10"), 319)
+	for i := 0; i < 2; i++ {
+		sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Now().Add(time.Minute))
+		w.RegisterSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(i)}, ptp.MessageDelayResp, sc)
+		go sc.Start(ctx)
+	}
+	require.Eventually(t, func() bool { return len(s.runningSubscriptions()) == 2 }, time.Second, 10*time.Millisecond)
+
+	// running subscriptions are kept
+	s.GracefulDrain(false)
+	require.True(t, s.Drained())
+	require.Equal(t, ptp.PortStateDisabled, s.ptpMgmtPortState())
+	require.Len(t, s.runningSubscriptions(), 2)
+
+	s.GracefulDrain(true)
+	for i := 0; i < 2; i++ {
+		select {
+		case sc := <-w.signalingQueue:
+			require.IsType(t, &ptp.CancelUnicastTransmissionTLV{}, sc.Signaling().TLVs[0])
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for cancel")
+		}
+	}
+
+	s.GracefulUndrain()
+	require.False(t, s.Drained())
+	require.Equal(t, ptp.PortStateMaster, s.ptpMgmtPortState())
+}
+
+func TestHandleDrain(t *testing.T) {
+	s := &Server{Config: &Config{}, Stats: stats.NewJSONStats(), configToken: "secret"}
+
+	call := func(method, url, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.handleDrain(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusMethodNotAllowed, call(http.MethodPut, "/drain", "secret").Code)
+	require.Equal(t, http.StatusUnauthorized, call(http.MethodPost, "/drain", "").Code)
+	require.Equal(t, http.StatusUnauthorized, call(http.MethodDelete, "/drain", "wrong").Code)
+	require.False(t, s.Drained())
+
+	res := call(http.MethodPost, "/drain?cancel=true", "secret")
+	require.Equal(t, http.StatusOK, res.Code)
+	reply := &MgmtDrain{}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), reply))
+	require.True(t, reply.Drained)
+	require.True(t, s.Drained())
+
+	res = call(http.MethodGet, "/drain", "")
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), reply))
+	require.True(t, reply.Drained)
+
+	require.Equal(t, http.StatusOK, call(http.MethodDelete, "/drain", "secret").Code)
+	require.False(t, s.Drained())
+}
@@ -0,0 +1,64 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// grantDuration returns the duration in seconds to grant to the request.
+// Grant hint of the client extends the renewals of subscriptions running for at least GrantHintMinAge
+// up to MaxSubDuration. Clients which keep resubscribing never get that old and keep the requested duration,
+// same as the clients of the echo-duration compatibility mode
+func (s *Server) grantDuration(sc *SubscriptionClient, ip net.IP, requested uint32, hint ptp.GrantHint, hinted bool) uint32 {
+	if !hinted || !s.Config.GrantHints || requested == 0 || hint.Duration <= requested || !sc.Running() {
+		return requested
+	}
+	if sc.Age(s.Config.Clock().Now()) < s.Config.GrantHintMinAge {
+		return requested
+	}
+	target := hint.Duration
+	if limit := uint32(s.Config.MaxSubDuration / time.Second); target > limit {
+		target = limit
+	}
+	if target <= requested {
+		return requested
+	}
+
+	if hint.Strategy != ptp.GrantHintFixed && hint.Strategy != ptp.GrantHintBackoff {
+		return requested
+	}
+
+	granted := target
+	renewals := sc.hintRenewal()
+	if hint.Strategy == ptp.GrantHintBackoff {
+		// double the requested duration with every extended renewal
+		g := uint64(requested) << (renewals + 1)
+		if renewals < 32 && g < uint64(target) {
+			granted = uint32(g)
+		}
+	}
+	if s.Config.compatEnabled(ip, CompatEchoDuration) {
+		s.Stats.IncCompat(CompatEchoDuration)
+		return requested
+	}
+	s.Stats.IncGrantHintHonored()
+	return granted
+}
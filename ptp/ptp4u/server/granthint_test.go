@@ -0,0 +1,71 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantDuration(t *testing.T) {
+	c := &Config{
+		StaticConfig:  StaticConfig{GrantHints: true, GrantHintMinAge: time.Minute},
+		DynamicConfig: DynamicConfig{MaxSubDuration: time.Hour},
+	}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.10"), 319)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	fixed := ptp.GrantHint{Duration: 1800, Strategy: ptp.GrantHintFixed}
+
+	// new subscription keeps the requested duration
+	require.Equal(t, uint32(300), s.grantDuration(sc, nil, 300, fixed, true))
+	sc.setRunning(true)
+	require.Equal(t, uint32(300), s.grantDuration(sc, nil, 300, fixed, true))
+
+	// stable subscription gets the hint
+	sc.created = time.Now().Add(-2 * time.Minute)
+	require.Equal(t, uint32(300), s.grantDuration(sc, nil, 300, fixed, false))
+	require.Equal(t, uint32(1800), s.grantDuration(sc, nil, 300, fixed, true))
+	// but never more than the max subscription duration
+	require.Equal(t, uint32(3600), s.grantDuration(sc, nil, 300, ptp.GrantHint{Duration: 86400}, true))
+	// nor less than requested
+	require.Equal(t, uint32(600), s.grantDuration(sc, nil, 600, ptp.GrantHint{Duration: 60}, true))
+	// unknown strategies are ignored
+	require.Equal(t, uint32(300), s.grantDuration(sc, nil, 300, ptp.GrantHint{Duration: 1800, Strategy: 42}, true))
+
+	// backoff doubles the grant on every renewal
+	sc.hintRenewals = 0
+	backoff := ptp.GrantHint{Duration: 1000, Strategy: ptp.GrantHintBackoff}
+	require.Equal(t, uint32(200), s.grantDuration(sc, nil, 100, backoff, true))
+	require.Equal(t, uint32(400), s.grantDuration(sc, nil, 100, backoff, true))
+	require.Equal(t, uint32(800), s.grantDuration(sc, nil, 100, backoff, true))
+	require.Equal(t, uint32(1000), s.grantDuration(sc, nil, 100, backoff, true))
+	require.Equal(t, uint32(1000), s.grantDuration(sc, nil, 100, backoff, true))
+
+	// disabled hints
+	c.GrantHints = false
+	require.Equal(t, uint32(300), s.grantDuration(sc, nil, 300, fixed, true))
+
+	require.Equal(t, int64(7), st.Live()["granthint.honored"])
+}
@@ -0,0 +1,193 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// idleEntry is a subscription waiting for its next wakeup in the idle scheduler
+type idleEntry struct {
+	sc       *SubscriptionClient
+	next     time.Time
+	interval time.Duration
+	index    int
+	removed  bool
+	// closed by the scheduler when the subscription expired
+	done chan struct{}
+}
+
+// idleQueue is a min heap of entries by the next wakeup
+type idleQueue []*idleEntry
+
+func (q idleQueue) Len() int           { return len(q) }
+func (q idleQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q idleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *idleQueue) Push(x interface{}) {
+	e := x.(*idleEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *idleQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
+
+// idleScheduler wakes up subscriptions from a single goroutine instead of a ticker per subscription.
+// The goroutine sleeps on a condition variable while there is nothing to wake, and a single timer
+// is armed for the earliest wakeup otherwise, so a server with few clients is idle between sends.
+// Subscriptions without periodic sends are only woken up to check the expiry
+type idleScheduler struct {
+	mux   sync.Mutex
+	cond  *sync.Cond
+	queue idleQueue
+	timer *time.Timer
+	clock Clock
+	// subscriptions served, including the ones being woken up right now
+	count int
+}
+
+func newIdleScheduler(clock Clock) *idleScheduler {
+	s := &idleScheduler{clock: clock}
+	s.cond = sync.NewCond(&s.mux)
+	s.timer = time.AfterFunc(time.Hour, s.wakeup)
+	s.timer.Stop()
+	return s
+}
+
+// wakeup wakes the scheduler goroutine up. The lock prevents the wakeup
+// from getting lost between the deadline check and the wait
+func (s *idleScheduler) wakeup() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.cond.Broadcast()
+}
+
+// Len returns the number of subscriptions served by the scheduler
+func (s *idleScheduler) Len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.count
+}
+
+// add schedules the first wakeup of the subscription one interval from now
+func (s *idleScheduler) add(sc *SubscriptionClient, interval time.Duration) *idleEntry {
+	e := &idleEntry{sc: sc, next: s.clock.Now().Add(interval), interval: interval, done: make(chan struct{})}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	heap.Push(&s.queue, e)
+	s.count++
+	s.cond.Broadcast()
+	return e
+}
+
+// remove stops waking up the subscription
+func (s *idleScheduler) remove(e *idleEntry) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if e.index >= 0 {
+		heap.Remove(&s.queue, e.index)
+	}
+	e.removed = true
+	s.count--
+}
+
+// wait blocks the subscription until it expires, is stopped or ctx is done
+func (s *idleScheduler) wait(ctx context.Context, sc *SubscriptionClient, interval time.Duration) {
+	e := s.add(sc, interval)
+	defer s.remove(e)
+	select {
+	case <-ctx.Done():
+	case <-sc.stop:
+	case <-e.done:
+	}
+}
+
+// next blocks until the earliest entry is due and takes it off the queue
+func (s *idleScheduler) next(ctx context.Context) *idleEntry {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for ctx.Err() == nil {
+		if len(s.queue) == 0 {
+			s.cond.Wait()
+			continue
+		}
+		wait := s.queue[0].next.Sub(s.clock.Now())
+		if wait <= 0 {
+			return heap.Pop(&s.queue).(*idleEntry)
+		}
+		s.timer.Reset(s.clock.Wall(wait))
+		s.cond.Wait()
+	}
+	return nil
+}
+
+// reschedule puts the entry back to the queue for its next wakeup
+func (s *idleScheduler) reschedule(e *idleEntry) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if e.removed || e.interval <= 0 {
+		return
+	}
+	e.next = e.next.Add(e.interval)
+	// skip the wakeups we are too late for instead of bursting
+	if now := s.clock.Now(); !e.next.After(now) {
+		e.next = now.Add(e.interval)
+	}
+	heap.Push(&s.queue, e)
+}
+
+// Start wakes up the subscriptions until ctx is done.
+// A full worker queue delays the wakeups of all the subscriptions
+func (s *idleScheduler) Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.wakeup()
+	}()
+	for {
+		e := s.next(ctx)
+		if e == nil {
+			return
+		}
+		sc := e.sc
+		if sc.Expired() {
+			close(e.done)
+			continue
+		}
+		// pick up the renegotiated or stretched interval
+		e.interval = sc.sendInterval()
+		if sc.subscriptionType != ptp.MessageDelayResp && sc.subscriptionType != ptp.MessageDelayReq {
+			sc.Due(e.next, e.interval)
+		}
+		s.reschedule(e)
+	}
+}
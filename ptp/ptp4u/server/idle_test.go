@@ -0,0 +1,119 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newIdleSubscription(st ptp.MessageType, idle *idleScheduler, interval, duration time.Duration) *SubscriptionClient {
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(make(chan *SubscriptionClient, 100), make(chan *SubscriptionClient, 100), sa, sa, st, c, interval, time.Now().Add(duration))
+	sc.idle = idle
+	return sc
+}
+
+func TestIdleSchedulerWakeups(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idle := newIdleScheduler(wallClock{})
+	go idle.Start(ctx)
+
+	sc := newIdleSubscription(ptp.MessageSync, idle, 10*time.Millisecond, time.Minute)
+	go sc.Start(ctx)
+	// first send right away and then every interval
+	for i := 0; i < 4; i++ {
+		select {
+		case got := <-sc.queue:
+			require.Equal(t, sc, got)
+			// serviced, as the worker would
+			atomic.StoreInt32(&got.queued, 0)
+		case <-time.After(time.Second):
+			require.Fail(t, "no wakeup", "wakeup %d", i)
+		}
+	}
+	require.Equal(t, 1, idle.Len())
+
+	sc.Stop()
+	require.Eventually(t, func() bool { return !sc.Running() }, time.Second, time.Millisecond)
+	require.Equal(t, 0, idle.Len())
+}
+
+func TestIdleSchedulerExpire(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idle := newIdleScheduler(wallClock{})
+	go idle.Start(ctx)
+
+	sc := newIdleSubscription(ptp.MessageDelayResp, idle, 10*time.Millisecond, 50*time.Millisecond)
+	go sc.Start(ctx)
+	require.Eventually(t, sc.Running, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return !sc.Running() }, time.Second, time.Millisecond)
+	require.Equal(t, 0, idle.Len())
+	// delay response subscriptions are only woken up to check the expiry
+	require.Len(t, sc.queue, 0)
+	// and cancelled on expiry
+	require.Len(t, sc.signalingQueue, 1)
+}
+
+func TestIdleSchedulerOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idle := newIdleScheduler(wallClock{})
+	go idle.Start(ctx)
+
+	queue := make(chan *SubscriptionClient, 100)
+	slow := newIdleSubscription(ptp.MessageAnnounce, idle, time.Hour, time.Hour)
+	slow.queue = queue
+	fast := newIdleSubscription(ptp.MessageAnnounce, idle, 20*time.Millisecond, time.Hour)
+	fast.queue = queue
+	go idle.wait(ctx, slow, slow.interval)
+	go idle.wait(ctx, fast, fast.interval)
+
+	// the fast subscription isn't stuck behind the slow one
+	select {
+	case got := <-queue:
+		require.Equal(t, fast, got)
+	case <-time.After(time.Second):
+		require.Fail(t, "no wakeup")
+	}
+	require.Equal(t, 2, idle.Len())
+
+	cancel()
+	require.Eventually(t, func() bool { return idle.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestIdleFor(t *testing.T) {
+	s := Server{Config: &Config{StaticConfig: StaticConfig{IdleSubscriptions: 1}}}
+	require.Nil(t, s.idleFor())
+
+	s.idle = newIdleScheduler(wallClock{})
+	require.Equal(t, s.idle, s.idleFor())
+
+	s.idle.add(&SubscriptionClient{}, time.Hour)
+	require.Nil(t, s.idleFor())
+}
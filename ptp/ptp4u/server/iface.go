@@ -0,0 +1,77 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/facebook/time/phc"
+)
+
+// IfaceAuto picks the interface to serve on automatically
+const IfaceAuto = "auto"
+
+// ifaceCandidate is an interface considered by the autodetection
+type ifaceCandidate struct {
+	name  string
+	flags net.Flags
+	ips   []net.IP
+	phc   bool
+}
+
+// pickIface returns the first interface which is up, isn't a loopback and has a global unicast IP.
+// If PHC is required the interface must have one
+func pickIface(candidates []ifaceCandidate, needPHC bool) (string, error) {
+	for _, c := range candidates {
+		if c.flags&net.FlagUp == 0 || c.flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if needPHC && !c.phc {
+			continue
+		}
+		for _, ip := range c.ips {
+			if ip.IsGlobalUnicast() {
+				return c.name, nil
+			}
+		}
+	}
+	if needPHC {
+		return "", fmt.Errorf("no interface with a PHC and a global unicast IP found")
+	}
+	return "", fmt.Errorf("no interface with a global unicast IP found")
+}
+
+// DetectIface returns the interface to serve on. PHC is required for the hardware timestamps
+func DetectIface(needPHC bool) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	candidates := make([]ifaceCandidate, 0, len(ifaces))
+	for _, iface := range ifaces {
+		c := ifaceCandidate{name: iface.Name, flags: iface.Flags}
+		if c.ips, err = ifaceIPs(iface.Name); err != nil {
+			return "", err
+		}
+		if _, err := phc.IfaceToPHCDevice(iface.Name); err == nil {
+			c.phc = true
+		}
+		candidates = append(candidates, c)
+	}
+	return pickIface(candidates, needPHC)
+}
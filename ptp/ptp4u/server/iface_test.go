@@ -0,0 +1,50 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickIface(t *testing.T) {
+	global := []net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::1")}
+	linkLocal := []net.IP{net.ParseIP("fe80::1"), net.IPv6zero}
+	candidates := []ifaceCandidate{
+		{name: "lo", flags: net.FlagUp | net.FlagLoopback, ips: []net.IP{net.ParseIP("127.0.0.1")}, phc: false},
+		{name: "eth0", flags: 0, ips: global, phc: true},
+		{name: "eth1", flags: net.FlagUp, ips: linkLocal, phc: true},
+		{name: "eth2", flags: net.FlagUp, ips: global, phc: false},
+		{name: "eth3", flags: net.FlagUp, ips: global, phc: true},
+	}
+
+	iface, err := pickIface(candidates, false)
+	require.NoError(t, err)
+	require.Equal(t, "eth2", iface)
+
+	iface, err = pickIface(candidates, true)
+	require.NoError(t, err)
+	require.Equal(t, "eth3", iface)
+
+	_, err = pickIface(candidates[:4], true)
+	require.EqualError(t, err, "no interface with a PHC and a global unicast IP found")
+
+	_, err = pickIface(candidates[:2], false)
+	require.EqualError(t, err, "no interface with a global unicast IP found")
+}
@@ -0,0 +1,76 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// MaxFlowLabel is the largest IPv6 flow label
+const MaxFlowLabel = 0xfffff
+
+// ipv6FlowInfoSend is IPV6_FLOWINFO_SEND from linux/in6.h, missing in x/sys
+const ipv6FlowInfoSend = 33
+
+// enableHopLimit sets the hop limit of unicast packets sent from the IPv6 socket. 0 keeps the system default
+func enableHopLimit(fd int, localAddr net.IP, hops int) error {
+	if hops == 0 || localAddr.To4() != nil {
+		return nil
+	}
+	return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS, hops)
+}
+
+// enableFlowLabel makes the IPv6 socket take the flow label from the destination address. 0 keeps the kernel assigned labels
+func enableFlowLabel(fd int, localAddr net.IP, label uint32) error {
+	if label == 0 || localAddr.To4() != nil {
+		return nil
+	}
+	if label > MaxFlowLabel {
+		return fmt.Errorf("flow label %#x is out of range", label)
+	}
+	return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, ipv6FlowInfoSend, 1)
+}
+
+// sendTo sends the packet and sets the flow label of IPv6 packets.
+// unix.SockaddrInet6 has no flow info, so sendto is called with the raw address
+func sendTo(fd int, p []byte, sa unix.Sockaddr, label uint32) error {
+	sa6, ok := sa.(*unix.SockaddrInet6)
+	if label == 0 || !ok || len(p) == 0 {
+		return unix.Sendto(fd, p, 0, sa)
+	}
+	rsa := unix.RawSockaddrInet6{
+		Family:   unix.AF_INET6,
+		Addr:     sa6.Addr,
+		Scope_id: sa6.ZoneId,
+	}
+	// port and flow info are in network byte order
+	port := (*[2]byte)(unsafe.Pointer(&rsa.Port))
+	port[0], port[1] = byte(sa6.Port>>8), byte(sa6.Port)
+	flow := (*[4]byte)(unsafe.Pointer(&rsa.Flowinfo))
+	label &= MaxFlowLabel
+	flow[0], flow[1], flow[2], flow[3] = 0, byte(label>>16), byte(label>>8), byte(label)
+
+	_, _, errno := unix.Syscall6(unix.SYS_SENDTO, uintptr(fd), uintptr(unsafe.Pointer(&p[0])), uintptr(len(p)), 0, uintptr(unsafe.Pointer(&rsa)), unix.SizeofSockaddrInet6)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
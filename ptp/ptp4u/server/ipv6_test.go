@@ -0,0 +1,87 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestEnableHopLimit(t *testing.T) {
+	conn6, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: 0})
+	require.NoError(t, err)
+	defer conn6.Close()
+	fd6, err := timestamp.ConnFd(conn6)
+	require.NoError(t, err)
+
+	require.NoError(t, enableHopLimit(fd6, net.ParseIP("::"), 7))
+	hops, err := unix.GetsockoptInt(fd6, unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS)
+	require.NoError(t, err)
+	require.Equal(t, 7, hops)
+
+	// IPv4 sockets are left alone
+	conn4, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	defer conn4.Close()
+	fd4, err := timestamp.ConnFd(conn4)
+	require.NoError(t, err)
+	require.NoError(t, enableHopLimit(fd4, net.ParseIP("127.0.0.1"), 7))
+}
+
+func TestEnableFlowLabel(t *testing.T) {
+	conn6, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: 0})
+	require.NoError(t, err)
+	defer conn6.Close()
+	fd6, err := timestamp.ConnFd(conn6)
+	require.NoError(t, err)
+
+	require.NoError(t, enableFlowLabel(fd6, net.ParseIP("::"), 0x12345))
+	require.Error(t, enableFlowLabel(fd6, net.ParseIP("::"), MaxFlowLabel+1))
+}
+
+func TestSendToFlowLabel(t *testing.T) {
+	dst, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::1"), Port: 0})
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	defer dst.Close()
+	src, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::1"), Port: 0})
+	require.NoError(t, err)
+	defer src.Close()
+	fd, err := timestamp.ConnFd(src)
+	require.NoError(t, err)
+	require.NoError(t, enableFlowLabel(fd, net.ParseIP("::1"), 0x12345))
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("::1"), dst.LocalAddr().(*net.UDPAddr).Port)
+	require.NoError(t, sendTo(fd, []byte("hello"), sa, 0x12345))
+	// unlabeled packets take the regular path
+	require.NoError(t, sendTo(fd, []byte("world"), sa, 0))
+
+	buf := make([]byte, 16)
+	require.NoError(t, dst.SetReadDeadline(time.Now().Add(time.Second)))
+	for _, want := range []string{"hello", "world"} {
+		n, addr, err := dst.ReadFromUDP(buf)
+		require.NoError(t, err)
+		require.Equal(t, want, string(buf[:n]))
+		require.Equal(t, src.LocalAddr().(*net.UDPAddr).Port, addr.Port)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/leapsectz"
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// leapAnnounceWindow is how long before a leap second it is announced with the leap flags
+const leapAnnounceWindow = 24 * time.Hour
+
+// leapSmear is the ramp of the served time from TAI towards TAI minus delta, in unix nanoseconds
+type leapSmear struct {
+	start int64
+	end   int64
+	delta int64
+}
+
+// leapSeconds follows the leap second file. Upcoming leap second is either announced with
+// the leap flags and stepped by flipping the UTC offset when it occurs, or smeared into the
+// served time so the UTC of the clients never repeats or skips a second
+type leapSeconds struct {
+	file  string
+	smear time.Duration
+
+	sync.Mutex
+	list []leapsectz.LeapSecond
+
+	// announced leap flags
+	leapFlags uint32
+	// upcoming leap second, 1 inserted, -1 deleted, 0 none
+	pendingLeap int64
+	// current smear, leapSmear
+	smearing atomic.Value
+}
+
+func newLeapSeconds(file string, smear time.Duration) *leapSeconds {
+	l := &leapSeconds{file: file, smear: smear}
+	l.smearing.Store(leapSmear{})
+	return l
+}
+
+// load re-reads the leap second file
+func (l *leapSeconds) load() error {
+	list, err := leapsectz.Parse(l.file)
+	if err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time().Before(list[j].Time()) })
+	l.Lock()
+	l.list = list
+	l.Unlock()
+	return nil
+}
+
+// state returns TAI-UTC offset at now, time of the upcoming leap second and how it changes the offset
+func (l *leapSeconds) state(now time.Time) (time.Duration, time.Time, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	// offset was 10 seconds before leap seconds were introduced
+	offset := 10 * time.Second
+	for _, ls := range l.list {
+		o := time.Duration(10+ls.Nleap) * time.Second
+		if ls.Time().After(now) {
+			return offset, ls.Time(), o - offset
+		}
+		offset = o
+	}
+	return offset, time.Time{}, 0
+}
+
+// update recomputes the leap flags and the smear at now and returns UTC offset to announce
+func (l *leapSeconds) update(now time.Time) time.Duration {
+	offset, next, delta := l.state(now)
+	var flags uint16
+	var pending int64
+	smear := leapSmear{}
+	if delta != 0 {
+		if l.smear > 0 {
+			smear = leapSmear{start: next.Add(-l.smear).UnixNano(), end: next.UnixNano(), delta: int64(delta)}
+			if now.UnixNano() >= smear.start {
+				pending = int64(delta / time.Second)
+			}
+		} else if next.Sub(now) <= leapAnnounceWindow {
+			pending = int64(delta / time.Second)
+			flags = ptp.FlagLeap61
+			if delta < 0 {
+				flags = ptp.FlagLeap59
+			}
+		}
+	}
+	atomic.StoreUint32(&l.leapFlags, uint32(flags))
+	atomic.StoreInt64(&l.pendingLeap, pending)
+	l.smearing.Store(smear)
+	return offset
+}
+
+// flags returns the leap flags to announce
+func (l *leapSeconds) flags() uint16 {
+	if l == nil {
+		return 0
+	}
+	return uint16(atomic.LoadUint32(&l.leapFlags))
+}
+
+// pending returns the upcoming leap second, 1 inserted, -1 deleted, 0 none
+func (l *leapSeconds) pending() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.pendingLeap)
+}
+
+// shift returns how much the served time is behind TAI because of the smear at now.
+// The whole delta is kept past the end of the smear until update flips the UTC offset,
+// otherwise the clients would see UTC a second off in between
+func (l *leapSeconds) shift(now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	smear := l.smearing.Load().(leapSmear)
+	n := now.UnixNano()
+	if smear.delta == 0 || n < smear.start {
+		return 0
+	}
+	if n >= smear.end {
+		return time.Duration(smear.delta)
+	}
+	return time.Duration(float64(smear.delta) * float64(n-smear.start) / float64(smear.end-smear.start))
+}
+
+// smearTimeSource shifts the time of the source by the leap second smear
+type smearTimeSource struct {
+	TimeSource
+	leap *leapSeconds
+	// clock the smear window is tracked on. System clock if nil
+	clock Clock
+}
+
+// shift returns the current smear shift
+func (s *smearTimeSource) shift() time.Duration {
+	if s.clock == nil {
+		return s.leap.shift(time.Now())
+	}
+	return s.leap.shift(s.clock.Now())
+}
+
+// unwrapTimeSource returns the time source shifted by the smear, if any
+func unwrapTimeSource(src TimeSource) TimeSource {
+	if smear, ok := src.(*smearTimeSource); ok {
+		return smear.TimeSource
+	}
+	return src
+}
+
+// RXTimestamp returns RX timestamp of the source shifted by the smear
+func (s *smearTimeSource) RXTimestamp(ts time.Time) time.Time {
+	return s.TimeSource.RXTimestamp(ts).Add(-s.shift())
+}
+
+// TXTimestamp returns TX timestamp of the source shifted by the smear
+func (s *smearTimeSource) TXTimestamp(ts time.Time) time.Time {
+	return s.TimeSource.TXTimestamp(ts).Add(-s.shift())
+}
+
+// Now returns current time of the source shifted by the smear
+func (s *smearTimeSource) Now() (time.Time, error) {
+	now, err := s.TimeSource.Now()
+	return now.Add(-s.shift()), err
+}
+
+// applyLeapSeconds updates the leap second state and announces the UTC offset of the leap second file
+func (s *Server) applyLeapSeconds(now time.Time) {
+	offset := s.Config.leap.update(now)
+	dcMux.Lock()
+	defer dcMux.Unlock()
+	if s.Config.UTCOffset != offset {
+		log.Warningf("UTC offset changed from %v to %v by the leap second file", s.Config.UTCOffset, offset)
+		s.Config.UTCOffset = offset
+	}
+}
+
+// startLeapSeconds re-reads the leap second file every leap interval and applies it every second,
+// so the UTC offset flips as soon as the leap second occurs. Leap seconds occur at whole seconds
+func (s *Server) startLeapSeconds() {
+	clock := s.Config.Clock()
+	loaded := time.Now()
+	for {
+		if time.Since(loaded) >= s.Config.LeapInterval {
+			if err := s.Config.leap.load(); err != nil {
+				log.Errorf("Failed to read leap second file: %v", err)
+			}
+			loaded = time.Now()
+		}
+		now := clock.Now()
+		s.applyLeapSeconds(now)
+		time.Sleep(clock.Wall(now.Truncate(time.Second).Add(time.Second).Sub(now)))
+	}
+}
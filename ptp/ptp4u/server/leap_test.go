@@ -0,0 +1,134 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+// leap is the fake leap second of the tests
+var leap = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// writeLeapSecondsList writes leap-seconds.list with the last real leap second and the fake one changing the offset to offset
+func writeLeapSecondsList(t *testing.T, offset int) string {
+	path := filepath.Join(t.TempDir(), "leap-seconds.list")
+	ntp := func(t time.Time) int64 { return t.Unix() + 2208988800 }
+	list := fmt.Sprintf("# test\n%d\t10\n%d\t37\t# 1 Jan 2017\n%d\t%d\t# 1 Jan 2030\n",
+		ntp(time.Date(1972, 1, 1, 0, 0, 0, 0, time.UTC)), ntp(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)), ntp(leap), offset)
+	require.NoError(t, os.WriteFile(path, []byte(list), 0644))
+	return path
+}
+
+func TestLeapSecondsStep(t *testing.T) {
+	for _, tt := range []struct {
+		offset int
+		flags  uint16
+	}{
+		{38, ptp.FlagLeap61},
+		{36, ptp.FlagLeap59},
+	} {
+		l := newLeapSeconds(writeLeapSecondsList(t, tt.offset), 0)
+		require.NoError(t, l.load())
+
+		require.Equal(t, 37*time.Second, l.update(leap.Add(-25*time.Hour)))
+		require.Equal(t, uint16(0), l.flags())
+		require.Equal(t, int64(0), l.pending())
+
+		require.Equal(t, 37*time.Second, l.update(leap.Add(-time.Second)))
+		require.Equal(t, tt.flags, l.flags())
+		require.Equal(t, int64(tt.offset-37), l.pending())
+		require.Equal(t, time.Duration(0), l.shift(leap.Add(-time.Second)))
+
+		require.Equal(t, time.Duration(tt.offset)*time.Second, l.update(leap))
+		require.Equal(t, uint16(0), l.flags())
+		require.Equal(t, int64(0), l.pending())
+	}
+}
+
+func TestLeapSecondsSmear(t *testing.T) {
+	l := newLeapSeconds(writeLeapSecondsList(t, 38), 10*time.Hour)
+	require.NoError(t, l.load())
+
+	require.Equal(t, 37*time.Second, l.update(leap.Add(-20*time.Hour)))
+	require.Equal(t, int64(0), l.pending())
+	require.Equal(t, time.Duration(0), l.shift(leap.Add(-20*time.Hour)))
+
+	require.Equal(t, 37*time.Second, l.update(leap.Add(-5*time.Hour)))
+	require.Equal(t, uint16(0), l.flags())
+	require.Equal(t, int64(1), l.pending())
+	require.Equal(t, 500*time.Millisecond, l.shift(leap.Add(-5*time.Hour)))
+	require.Equal(t, 900*time.Millisecond, l.shift(leap.Add(-time.Hour)))
+
+	// the smear is over, but until the offset flips the served time stays a whole second behind
+	require.Equal(t, 37*time.Second, l.update(leap.Add(-time.Nanosecond)))
+	require.Equal(t, time.Second, l.shift(leap))
+	require.Equal(t, time.Second, l.shift(leap.Add(999*time.Millisecond)))
+
+	require.Equal(t, 38*time.Second, l.update(leap))
+	require.Equal(t, time.Duration(0), l.shift(leap))
+	require.Equal(t, int64(0), l.pending())
+}
+
+func TestLeapSecondsNil(t *testing.T) {
+	var l *leapSeconds
+	require.Equal(t, uint16(0), l.flags())
+	require.Equal(t, int64(0), l.pending())
+	require.Equal(t, time.Duration(0), l.shift(time.Now()))
+}
+
+func TestApplyLeapSeconds(t *testing.T) {
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234), DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+	c.leap = newLeapSeconds(writeLeapSecondsList(t, 38), 0)
+	require.NoError(t, c.leap.load())
+	s := &Server{Config: c}
+
+	s.applyLeapSeconds(leap.Add(-time.Hour))
+	require.Equal(t, 37*time.Second, c.UTCOffset)
+	w := &sendWorker{}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale|ptp.FlagLeap61, sc.Announce().Header.FlagField)
+	require.Equal(t, int16(37), sc.Announce().CurrentUTCOffset)
+
+	s.applyLeapSeconds(leap)
+	require.Equal(t, 38*time.Second, c.UTCOffset)
+	sc.UpdateAnnounce()
+	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale, sc.Announce().Header.FlagField)
+	require.Equal(t, int16(38), sc.Announce().CurrentUTCOffset)
+}
+
+func TestSmearTimeSource(t *testing.T) {
+	l := newLeapSeconds(writeLeapSecondsList(t, 38), 0)
+	require.NoError(t, l.load())
+	src := &smearTimeSource{TimeSource: NewSimulatedTimeSource(time.Time{}), leap: l}
+	now := time.Now()
+	l.smearing.Store(leapSmear{start: now.Add(-time.Hour).UnixNano(), end: now.Add(time.Hour).UnixNano(), delta: int64(time.Second)})
+
+	ts := time.Unix(1700000000, 0)
+	require.InDelta(t, float64(ts.Add(-500*time.Millisecond).UnixNano()), float64(src.RXTimestamp(ts).UnixNano()), float64(time.Millisecond))
+	require.InDelta(t, float64(ts.Add(-500*time.Millisecond).UnixNano()), float64(src.TXTimestamp(ts).UnixNano()), float64(time.Millisecond))
+}
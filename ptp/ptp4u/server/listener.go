@@ -0,0 +1,148 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/facebook/time/timestamp"
+	"golang.org/x/sys/unix"
+)
+
+// Listener is an interface address the server binds the event and general ports on
+type Listener struct {
+	Interface string
+	IP        net.IP
+	// DSCP of the packets sent to the clients of the listener
+	DSCP int
+}
+
+func (l Listener) String() string {
+	return fmt.Sprintf("%s/%s", l.Interface, l.IP)
+}
+
+// ParseListeners parses comma separated list of interface/ip[/dscp] listeners. DSCP defaults to dscp
+func ParseListeners(s string, dscp int) ([]Listener, error) {
+	res := []Listener{}
+	if s == "" {
+		return res, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("listener %q is not interface/ip[/dscp]", entry)
+		}
+		l := Listener{Interface: parts[0], IP: net.ParseIP(parts[1]), DSCP: dscp}
+		if l.IP == nil {
+			return nil, fmt.Errorf("listener %q has invalid IP %q", entry, parts[1])
+		}
+		if len(parts) == 3 {
+			v, err := strconv.Atoi(parts[2])
+			if err != nil || v < 0 || v > 63 {
+				return nil, fmt.Errorf("listener %q has unsupported DSCP value %q", entry, parts[2])
+			}
+			l.DSCP = v
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// HasIP checks the listener IP is assigned to the interface
+func (l Listener) HasIP() (bool, error) {
+	ips, err := ifaceIPs(l.Interface)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ip := range ips {
+		if l.IP.Equal(ip) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// clientSockaddr returns the client socket address usable with the listener sockets.
+// Listener on IPv6 is dual-stack, so IPv4 clients are addressed by IPv4-mapped IPv6 addresses
+func (l Listener) clientSockaddr(ip net.IP, port int) unix.Sockaddr {
+	if l.IP == nil || l.IP.To4() != nil {
+		return timestamp.IPToSockaddr(ip, port)
+	}
+	sa := &unix.SockaddrInet6{Port: port}
+	copy(sa.Addr[:], ip.To16())
+	return sa
+}
+
+// listener is a Listener the server serves on
+type listener struct {
+	Listener
+	// id is the position of the listener, 0 is the primary one of Interface and IP
+	id int
+	// timeSrc converts timestamps of the listener sockets
+	timeSrc TimeSource
+
+	// sockets receiving on the event and general ports
+	eFd int
+	gFd int
+}
+
+// socketName returns the name of the listener socket of the kind in stats
+func (l *listener) socketName(kind string) string {
+	if l.id == 0 {
+		return kind
+	}
+	return fmt.Sprintf("%s.%d", kind, l.id)
+}
+
+// primary returns the listener of Interface, IP and DSCP
+func (c *Config) primary() Listener {
+	return Listener{Interface: c.Interface, IP: c.IP, DSCP: c.DSCP}
+}
+
+// initListeners sets up the primary listener followed by the additional Listeners.
+// Listeners on other interfaces get the time source of their own PHC, other time sources are shared
+func (c *Config) initListeners() error {
+	c.listeners = []*listener{{Listener: c.primary(), timeSrc: c.timeSrc}}
+	for i, l := range c.Listeners {
+		src := c.timeSrc
+		if p, ok := unwrapTimeSource(src).(*PHCTimeSource); ok && p.Interface != l.Interface {
+			phc, err := newPHCTimeSource(c, l.Interface)
+			if err != nil {
+				return fmt.Errorf("listener %s: %w", l, err)
+			}
+			src = phc
+			if smear, ok := c.timeSrc.(*smearTimeSource); ok {
+				src = &smearTimeSource{TimeSource: phc, leap: smear.leap, clock: smear.clock}
+			}
+		}
+		c.listeners = append(c.listeners, &listener{Listener: l, id: i + 1, timeSrc: src})
+	}
+	return nil
+}
+
+// serving returns the listeners of the server. Until they are set up it's just the primary one
+func (c *Config) serving() []*listener {
+	if len(c.listeners) == 0 {
+		return []*listener{{Listener: c.primary(), timeSrc: c.timeSrc}}
+	}
+	return c.listeners
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListeners(t *testing.T) {
+	listeners, err := ParseListeners("", 35)
+	require.NoError(t, err)
+	require.Empty(t, listeners)
+
+	listeners, err = ParseListeners("eth1/10.0.0.1, eth2/2001:db8::1/46", 35)
+	require.NoError(t, err)
+	require.Equal(t, []Listener{
+		{Interface: "eth1", IP: net.ParseIP("10.0.0.1"), DSCP: 35},
+		{Interface: "eth2", IP: net.ParseIP("2001:db8::1"), DSCP: 46},
+	}, listeners)
+	require.Equal(t, "eth2/2001:db8::1", listeners[1].String())
+
+	for _, bad := range []string{"eth1", "/10.0.0.1", "eth1/10.0.0", "eth1/10.0.0.1/64", "eth1/10.0.0.1/af41", "eth1/10.0.0.1/1/2"} {
+		_, err = ParseListeners(bad, 0)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestListenerSocketName(t *testing.T) {
+	require.Equal(t, "event", (&listener{}).socketName("event"))
+	require.Equal(t, "general.2", (&listener{id: 2}).socketName("general"))
+}
+
+func TestInitListeners(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{
+		Interface: "eth0",
+		IP:        net.ParseIP("10.0.0.1"),
+		DSCP:      35,
+		Listeners: []Listener{
+			{Interface: "eth0", IP: net.ParseIP("2001:db8::1"), DSCP: 35},
+			{Interface: "eth1", IP: net.ParseIP("10.0.1.1"), DSCP: 46},
+		},
+	}}
+	// before the setup only the primary listener is served
+	require.Equal(t, []*listener{{Listener: c.primary()}}, c.serving())
+
+	// software timestamps don't depend on the interface
+	c.timeSrc = &SysClockTimeSource{config: c}
+	require.NoError(t, c.initListeners())
+	require.Len(t, c.serving(), 3)
+	for i, l := range c.serving() {
+		require.Equal(t, i, l.id)
+		require.Equal(t, c.timeSrc, l.timeSrc)
+	}
+	require.Equal(t, Listener{Interface: "eth0", IP: net.ParseIP("10.0.0.1"), DSCP: 35}, c.serving()[0].Listener)
+	require.Equal(t, c.Listeners[1], c.serving()[2].Listener)
+
+	// hardware timestamps of other interfaces come from their own PHC
+	c.timeSrc = &PHCTimeSource{Interface: "eth0"}
+	require.NoError(t, c.initListeners())
+	require.Equal(t, c.timeSrc, c.listeners[1].timeSrc)
+	require.Equal(t, &PHCTimeSource{Interface: "eth1"}, c.listeners[2].timeSrc)
+
+	leap := newLeapSeconds("", time.Hour)
+	c.timeSrc = &smearTimeSource{TimeSource: &PHCTimeSource{Interface: "eth0"}, leap: leap}
+	require.NoError(t, c.initListeners())
+	require.Equal(t, &smearTimeSource{TimeSource: &PHCTimeSource{Interface: "eth1"}, leap: leap}, c.listeners[2].timeSrc)
+}
+
+func TestDualStackRequestListeners(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{
+		Interface: "eth0",
+		IP:        net.ParseIP("10.0.0.1"),
+		Listeners: []Listener{
+			{Interface: "eth1", IP: net.ParseIP("10.0.1.1")},
+			{Interface: "eth2", IP: net.ParseIP("2001:db8::1")},
+		},
+	}}
+	c.timeSrc = &SysClockTimeSource{config: c}
+	require.NoError(t, c.initListeners())
+	s := &Server{Config: c}
+	ip4 := net.ParseIP("192.168.0.10")
+	ip6 := net.ParseIP("2001:db8::10")
+	sc := NewSubscriptionClient(nil, nil, c.clientSockaddr(ip4, ptp.PortEvent), c.clientSockaddr(ip4, ptp.PortGeneral), ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+
+	// the client reaching the server over another uplink is served from there
+	require.True(t, s.dualStackRequest(sc, ip4, c.listeners[1]))
+	require.Equal(t, 1, sc.listener)
+	require.Nil(t, sc.AltAddress())
+
+	// the other IP family is served by the listener of that family
+	require.True(t, s.dualStackRequest(sc, ip6, c.listeners[2]))
+	require.Equal(t, 2, sc.listener)
+	require.Equal(t, timestamp.IPToSockaddr(ip6, ptp.PortEvent), sc.eclisa)
+	require.True(t, ip4.Equal(sc.AltAddress()))
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// classes of per-client errors which are rate limited independently
+const (
+	logClassProbe       = "probe"
+	logClassDecode      = "decode"
+	logClassUnsupported = "unsupported"
+	logClassNoSub       = "no_subscription"
+)
+
+type logKey struct {
+	ip    string
+	class string
+}
+
+// logBucket is a token bucket of a single client and error class
+type logBucket struct {
+	tokens     float64
+	last       time.Time
+	suppressed int64
+}
+
+// logLimiter rate limits per-client log lines so a single broken client can't flood the log.
+// nil logLimiter allows everything
+type logLimiter struct {
+	sync.Mutex
+
+	rate    float64
+	burst   float64
+	buckets map[logKey]*logBucket
+	now     func() time.Time
+}
+
+// newLogLimiter returns limiter allowing rate lines per second with bursts of up to burst lines per client and error class
+func newLogLimiter(rate float64, burst int) *logLimiter {
+	return &logLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[logKey]*logBucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow reports whether a line of the error class from the client may be logged
+func (l *logLimiter) Allow(sa unix.Sockaddr, class string) bool {
+	if l == nil {
+		return true
+	}
+	key := logKey{ip: timestamp.SockaddrToIP(sa).String(), class: class}
+	now := l.now()
+
+	l.Lock()
+	defer l.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &logBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		b.suppressed++
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Summarize logs the number of suppressed lines since the previous summary and forgets idle clients
+func (l *logLimiter) Summarize() {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	for key, b := range l.buckets {
+		if b.suppressed == 0 {
+			delete(l.buckets, key)
+			continue
+		}
+		log.Warningf("Suppressed %d %s error lines from %s", b.suppressed, key.class, key.ip)
+		b.suppressed = 0
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLimiter(t *testing.T) {
+	now := time.Unix(1653574589, 0)
+	l := newLogLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	sa1 := timestamp.IPToSockaddr(net.ParseIP("192.168.0.1"), 319)
+	sa2 := timestamp.IPToSockaddr(net.ParseIP("192.168.0.2"), 319)
+
+	// burst
+	require.True(t, l.Allow(sa1, logClassProbe))
+	require.True(t, l.Allow(sa1, logClassProbe))
+	require.False(t, l.Allow(sa1, logClassProbe))
+	require.False(t, l.Allow(sa1, logClassProbe))
+
+	// other client and other class are independent
+	require.True(t, l.Allow(sa2, logClassProbe))
+	require.True(t, l.Allow(sa1, logClassDecode))
+
+	// refill
+	now = now.Add(time.Second)
+	require.True(t, l.Allow(sa1, logClassProbe))
+	require.False(t, l.Allow(sa1, logClassProbe))
+
+	key := logKey{ip: "192.168.0.1", class: logClassProbe}
+	require.Equal(t, int64(3), l.buckets[key].suppressed)
+
+	l.Summarize()
+	require.Equal(t, int64(0), l.buckets[key].suppressed)
+	require.Len(t, l.buckets, 1)
+	l.Summarize()
+	require.Len(t, l.buckets, 0)
+}
+
+func TestLogLimiterNil(t *testing.T) {
+	var l *logLimiter
+	require.True(t, l.Allow(timestamp.IPToSockaddr(net.ParseIP("::1"), 319), logClassProbe))
+	l.Summarize()
+}
@@ -0,0 +1,306 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// MgmtStatus is the server state reported by the management API
+type MgmtStatus struct {
+	ClockIdentity    string            `json:"clock_identity"`
+	ClockClass       ptp.ClockClass    `json:"clock_class"`
+	ClockAccuracy    ptp.ClockAccuracy `json:"clock_accuracy"`
+	UTCOffset        time.Duration     `json:"utc_offset"`
+	Drained          bool              `json:"drained"`
+	ManualDrain      bool              `json:"manual_drain"`
+	GracefulDrain    bool              `json:"graceful_drain"`
+	Degraded         bool              `json:"degraded"`
+	ConfigGeneration int64             `json:"config_generation"`
+	Subscriptions    int               `json:"subscriptions"`
+	Workers          int               `json:"workers"`
+}
+
+// MgmtSubscription is a single subscription reported by the management API
+type MgmtSubscription struct {
+	Worker     int           `json:"worker"`
+	Client     string        `json:"client"`
+	Address    string        `json:"address"`
+	Type       string        `json:"type"`
+	Interval   time.Duration `json:"interval"`
+	Expire     time.Time     `json:"expire"`
+	Tenant     string        `json:"tenant,omitempty"`
+	DualStack  bool          `json:"dual_stack"`
+	AltAddress string        `json:"alt_address,omitempty"`
+}
+
+// MgmtLogLevel is the log level reported and accepted by the management API
+type MgmtLogLevel struct {
+	Level string `json:"level"`
+}
+
+// MgmtBlock is a blocklist change accepted by the management API
+type MgmtBlock struct {
+	Prefix string        `json:"prefix"`
+	TTL    time.Duration `json:"ttl"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+// info returns the management view of the subscription
+func (sc *SubscriptionClient) info(worker int, clientID ptp.PortIdentity) *MgmtSubscription {
+	sc.Lock()
+	defer sc.Unlock()
+	info := &MgmtSubscription{
+		Worker:   worker,
+		Client:   clientID.String(),
+		Address:  timestamp.SockaddrToIP(sc.eclisa).String(),
+		Type:     sc.subscriptionType.String(),
+		Interval: sc.interval,
+		Expire:   sc.expire,
+		Tenant:   sc.tenant,
+	}
+	if sc.altAddress != nil {
+		info.AltAddress = sc.altAddress.String()
+		info.DualStack = true
+	}
+	return info
+}
+
+// subscriptions lists running subscriptions matching the non-empty filters
+func (s *Server) subscriptions(msgType, address, tenant string) []*MgmtSubscription {
+	subs := []*MgmtSubscription{}
+	for _, w := range s.sw {
+		w.mux.Lock()
+		for _, clients := range w.clients {
+			for clientID, sc := range clients {
+				if !sc.Running() {
+					continue
+				}
+				info := sc.info(w.id, clientID)
+				if msgType != "" && !strings.EqualFold(info.Type, msgType) {
+					continue
+				}
+				if address != "" && info.Address != address && info.AltAddress != address {
+					continue
+				}
+				if tenant != "" && info.Tenant != tenant {
+					continue
+				}
+				subs = append(subs, info)
+			}
+		}
+		w.mux.Unlock()
+	}
+	sort.Slice(subs, func(i, j int) bool { return mgmtSubscriptionLess(subs[i], subs[j]) })
+	return subs
+}
+
+// mgmtSubscriptionLess orders subscriptions by client address and type
+func mgmtSubscriptionLess(a, b *MgmtSubscription) bool {
+	if a.Address != b.Address {
+		return a.Address < b.Address
+	}
+	return a.Type < b.Type
+}
+
+// status returns the current server state
+func (s *Server) status() *MgmtStatus {
+	clockClass, clockAccuracy := s.Config.ClockQuality()
+	dcMux.Lock()
+	utcOffset := s.Config.UTCOffset
+	dcMux.Unlock()
+	return &MgmtStatus{
+		ClockIdentity:    s.Config.clockIdentity.String(),
+		ClockClass:       clockClass,
+		ClockAccuracy:    clockAccuracy,
+		UTCOffset:        utcOffset,
+		Drained:          atomic.LoadInt32(&s.drained) == 1,
+		ManualDrain:      s.manualDrain != nil && s.manualDrain.Check(),
+		GracefulDrain:    s.Drained(),
+		Degraded:         atomic.LoadInt32(&s.Config.degraded) == 1,
+		ConfigGeneration: s.ConfigGeneration(),
+		Subscriptions:    len(s.subscriptions("", "", "")),
+		Workers:          len(s.sw),
+	}
+}
+
+// handleMgmtStatus reports the server state
+func (s *Server) handleMgmtStatus(w http.ResponseWriter, r *http.Request) {
+	mgmtReply(w, r, s.status())
+}
+
+// handleMgmtSubscriptions lists subscriptions, optionally filtered by type, address and tenant
+func (s *Server) handleMgmtSubscriptions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	mgmtReply(w, r, s.subscriptions(q.Get("type"), q.Get("address"), q.Get("tenant")))
+}
+
+// handleMgmtDrain engages (POST) or releases (DELETE) the manual drain
+func (s *Server) handleMgmtDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		log.Warningf("Manual drain requested via management API")
+		s.manualDrain.Set(true)
+	case http.MethodDelete:
+		log.Warningf("Manual drain released via management API")
+		s.manualDrain.Set(false)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// actual drain happens on the next drain check
+	mgmtReply(w, r, s.status())
+}
+
+// handleMgmtLogLevel reports (GET) or changes (PUT) the log level
+func (s *Server) handleMgmtLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var l MgmtLogLevel
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level, err := log.ParseLevel(l.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Warningf("Log level set to %s via management API", level)
+		log.SetLevel(level)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mgmtReply(w, r, &MgmtLogLevel{Level: log.GetLevel().String()})
+}
+
+// handleMgmtBlocklist lists (GET), adds (POST) or removes (DELETE with the prefix query) blocked clients
+func (s *Server) handleMgmtBlocklist(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var b MgmtBlock
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, perr := parseBlockPrefix(b.Prefix); perr != nil {
+			http.Error(w, perr.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Warningf("Blocking %s for %v via management API: %s", b.Prefix, b.TTL, b.Reason)
+		_, err = s.blocklist.Add(b.Prefix, b.TTL, b.Reason)
+	case http.MethodDelete:
+		prefix := r.URL.Query().Get("prefix")
+		if _, perr := parseBlockPrefix(prefix); perr != nil {
+			http.Error(w, perr.Error(), http.StatusBadRequest)
+			return
+		}
+		var found bool
+		found, err = s.blocklist.Remove(prefix)
+		if err == nil && !found {
+			http.Error(w, fmt.Sprintf("%s is not blocked", prefix), http.StatusNotFound)
+			return
+		}
+		log.Warningf("Unblocking %s via management API", prefix)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		// the change is applied, but won't survive the restart
+		http.Error(w, fmt.Sprintf("saving blocklist: %v", err), http.StatusInternalServerError)
+		return
+	}
+	mgmtReply(w, r, s.blocklist.List())
+}
+
+// handleMgmtConfig dumps the running config
+func (s *Server) handleMgmtConfig(w http.ResponseWriter, r *http.Request) {
+	dcMux.Lock()
+	c := struct {
+		StaticConfig
+		DynamicConfig
+	}{s.Config.StaticConfig, s.Config.DynamicConfig}
+	dcMux.Unlock()
+	mgmtReply(w, r, &c)
+}
+
+func mgmtReply(w http.ResponseWriter, r *http.Request, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// subscription dumps of busy servers run into megabytes
+	if err := stats.WriteCompressed(w, r, js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
+
+// mgmtHandler routes the management API requests
+func (s *Server) mgmtHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleMgmtStatus)
+	mux.HandleFunc("/subscriptions", s.handleMgmtSubscriptions)
+	mux.HandleFunc("/drain", s.handleMgmtDrain)
+	mux.HandleFunc("/loglevel", s.handleMgmtLogLevel)
+	mux.HandleFunc("/config", s.handleMgmtConfig)
+	mux.HandleFunc("/blocklist", s.handleMgmtBlocklist)
+	mux.HandleFunc("/schedule", s.handleMgmtSchedule)
+	mux.HandleFunc("/batch/expire", s.handleMgmtBatch("expire"))
+	mux.HandleFunc("/batch/regrant", s.handleMgmtBatch("regrant"))
+	mux.HandleFunc("/batch/purge", s.handleMgmtBatch("purge"))
+	return mux
+}
+
+// startMgmtListener serves the management API on the unix socket
+func (s *Server) startMgmtListener() {
+	// remove the socket left behind by the previous instance
+	if err := os.Remove(s.Config.MgmtSocket); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Failed to remove stale management socket: %v", err)
+	}
+	l, err := net.Listen("unix", s.Config.MgmtSocket)
+	if err != nil {
+		log.Fatalf("Listening error: %s", err)
+	}
+	defer l.Close()
+	// management API can drain the server, so only the owner can use it
+	if err := os.Chmod(s.Config.MgmtSocket, 0600); err != nil {
+		log.Fatalf("Failed to restrict management socket: %v", err)
+	}
+	log.Infof("Serving management API on %s", s.Config.MgmtSocket)
+	log.Error(http.Serve(l, s.mgmtHandler()))
+}
@@ -0,0 +1,169 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/drain"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func mgmtTestServer() *Server {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{SendWorkers: 1},
+		DynamicConfig: DynamicConfig{ClockClass: 6, ClockAccuracy: 33, UTCOffset: 37 * time.Second},
+	}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st, manualDrain: &drain.ManualDrain{}, blocklist: newBlocklist("", nil)}
+	s.sw = []*sendWorker{newSendWorker(0, c, st)}
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.10"), 319)
+	for i, mt := range []ptp.MessageType{ptp.MessageSync, ptp.MessageAnnounce} {
+		sc := NewSubscriptionClient(nil, nil, sa, sa, mt, c, time.Second, time.Now().Add(time.Minute))
+		sc.setRunning(true)
+		s.sw[0].RegisterSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(i), PortNumber: 1}, mt, sc)
+	}
+	stopped := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Now().Add(time.Minute))
+	s.sw[0].RegisterSubscription(ptp.PortIdentity{}, ptp.MessageDelayResp, stopped)
+	return s
+}
+
+func mgmtRequest(t *testing.T, s *Server, method, path, body string, v interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.mgmtHandler().ServeHTTP(w, r)
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w.Code
+}
+
+func TestMgmtStatus(t *testing.T) {
+	s := mgmtTestServer()
+	st := &MgmtStatus{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodGet, "/status", "", st))
+	require.Equal(t, ptp.ClockClass(6), st.ClockClass)
+	require.Equal(t, 37*time.Second, st.UTCOffset)
+	require.Equal(t, 2, st.Subscriptions)
+	require.Equal(t, 1, st.Workers)
+	require.False(t, st.Drained)
+}
+
+func TestMgmtSubscriptions(t *testing.T) {
+	s := mgmtTestServer()
+	subs := []*MgmtSubscription{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodGet, "/subscriptions", "", &subs))
+	require.Len(t, subs, 2)
+	require.Equal(t, "192.168.0.10", subs[0].Address)
+	require.Equal(t, "ANNOUNCE", subs[0].Type)
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodGet, "/subscriptions?type=sync", "", &subs))
+	require.Len(t, subs, 1)
+	require.Equal(t, "SYNC", subs[0].Type)
+	require.Equal(t, time.Second, subs[0].Interval)
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodGet, "/subscriptions?address=192.168.0.11", "", &subs))
+	require.Len(t, subs, 0)
+}
+
+func TestMgmtSubscriptionsCompressed(t *testing.T) {
+	s := mgmtTestServer()
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.11"), 319)
+	for i := 0; i < 100; i++ {
+		sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageSync, s.Config, time.Second, time.Now().Add(time.Minute))
+		sc.setRunning(true)
+		s.sw[0].RegisterSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(100 + i), PortNumber: 1}, ptp.MessageSync, sc)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/subscriptions", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.mgmtHandler().ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	subs := []*MgmtSubscription{}
+	require.NoError(t, json.NewDecoder(gz).Decode(&subs))
+	require.Len(t, subs, 102)
+}
+
+func TestMgmtDrain(t *testing.T) {
+	s := mgmtTestServer()
+	st := &MgmtStatus{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/drain", "", st))
+	require.True(t, st.ManualDrain)
+	require.True(t, s.manualDrain.Check())
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodDelete, "/drain", "", st))
+	require.False(t, st.ManualDrain)
+
+	require.Equal(t, http.StatusMethodNotAllowed, mgmtRequest(t, s, http.MethodPatch, "/drain", "", st))
+}
+
+func TestMgmtLogLevel(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	s := mgmtTestServer()
+	l := &MgmtLogLevel{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPut, "/loglevel", `{"level":"debug"}`, l))
+	require.Equal(t, "debug", l.Level)
+	require.Equal(t, log.DebugLevel, log.GetLevel())
+
+	require.Equal(t, http.StatusBadRequest, mgmtRequest(t, s, http.MethodPut, "/loglevel", `{"level":"loud"}`, l))
+}
+
+func TestMgmtConfig(t *testing.T) {
+	s := mgmtTestServer()
+	c := map[string]interface{}{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodGet, "/config", "", &c))
+	require.Equal(t, float64(6), c["ClockClass"])
+	require.Equal(t, float64(1), c["SendWorkers"])
+}
+
+func TestMgmtBlocklist(t *testing.T) {
+	s := mgmtTestServer()
+	list := []BlockEntry{}
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/blocklist", `{"prefix":"192.168.0.10","ttl":60000000000,"reason":"flood"}`, &list))
+	require.Equal(t, 1, len(list))
+	require.Equal(t, "192.168.0.10/32", list[0].Prefix)
+	require.Equal(t, "flood", list[0].Reason)
+	require.True(t, s.blocklist.Blocked(net.ParseIP("192.168.0.10")))
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodGet, "/blocklist", "", &list))
+	require.Equal(t, 1, len(list))
+	require.Equal(t, uint64(1), list[0].Dropped)
+
+	require.Equal(t, http.StatusBadRequest, mgmtRequest(t, s, http.MethodPost, "/blocklist", `{"prefix":"nope"}`, &list))
+	require.Equal(t, http.StatusNotFound, mgmtRequest(t, s, http.MethodDelete, "/blocklist?prefix=10.0.0.1", "", &list))
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodDelete, "/blocklist?prefix=192.168.0.10", "", &list))
+	require.Equal(t, 0, len(list))
+	require.False(t, s.blocklist.Blocked(net.ParseIP("192.168.0.10")))
+}
@@ -0,0 +1,66 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// IP and UDP header sizes without options
+const (
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+)
+
+// maxPacketSize returns the largest UDP payload which is sent from ip without fragmentation
+func maxPacketSize(mtu int, ip net.IP) int {
+	if ip.To4() != nil {
+		return mtu - ipv4HeaderSize - udpHeaderSize
+	}
+	return mtu - ipv6HeaderSize - udpHeaderSize
+}
+
+// fits checks the packet of n bytes is sent without fragmentation.
+// Fragmented PTP packets are dropped by some switches, so oversized ones are not sent at all
+func (s *sendWorker) fits(n int, t ptp.MessageType) bool {
+	if s.config.maxPacketSize <= 0 || n <= s.config.maxPacketSize {
+		return true
+	}
+	log.Errorf("Not sending %s packet of %d bytes, path MTU allows %d", t, n, s.config.maxPacketSize)
+	s.stats.IncTXOversize(t)
+	return false
+}
+
+// signalingParts splits the signaling message of n bytes into messages sent without fragmentation
+func (s *sendWorker) signalingParts(sg *ptp.Signaling, n int) []*ptp.Signaling {
+	if s.config.maxPacketSize <= 0 || n <= s.config.maxPacketSize {
+		return []*ptp.Signaling{sg}
+	}
+	// BytesTo adds 2 trailing bytes for the UDPv6 checksum, each part is authenticated separately
+	parts, err := ptp.SplitSignaling(sg, s.config.maxPacketSize-2-s.config.auth.size())
+	if err != nil {
+		log.Errorf("Not sending signaling packet of %d bytes: %v", n, err)
+		s.stats.IncTXOversize(ptp.MessageSignaling)
+		return nil
+	}
+	s.stats.IncTXSignalingSplit()
+	return parts
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxPacketSize(t *testing.T) {
+	require.Equal(t, 1472, maxPacketSize(1500, net.ParseIP("192.168.0.1")))
+	require.Equal(t, 1452, maxPacketSize(1500, net.ParseIP("::1")))
+}
+
+func TestFits(t *testing.T) {
+	c := &Config{}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	require.True(t, w.fits(9000, ptp.MessageSync))
+
+	c.maxPacketSize = 100
+	require.True(t, w.fits(100, ptp.MessageSync))
+	require.False(t, w.fits(101, ptp.MessageSync))
+}
+
+func TestSignalingParts(t *testing.T) {
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(nil, nil, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	sg := &ptp.Signaling{}
+	sc.UpdateSignalingGrant(sg, ptp.NewUnicastMsgTypeAndFlags(ptp.MessageSync, 0), 0, 60)
+	sc.Signaling().TLVs = append(sc.Signaling().TLVs, sc.Signaling().TLVs[0])
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	n, err := ptp.BytesTo(sc.Signaling(), buf)
+	require.NoError(t, err)
+
+	// unlimited
+	require.Equal(t, []*ptp.Signaling{sc.Signaling()}, w.signalingParts(sc.Signaling(), n))
+
+	// fits
+	c.maxPacketSize = n
+	require.Equal(t, []*ptp.Signaling{sc.Signaling()}, w.signalingParts(sc.Signaling(), n))
+
+	// a TLV per message
+	c.maxPacketSize = n - 1
+	parts := w.signalingParts(sc.Signaling(), n)
+	require.Len(t, parts, 2)
+	for _, p := range parts {
+		require.Len(t, p.TLVs, 1)
+		pn, err := ptp.BytesTo(p, buf)
+		require.NoError(t, err)
+		require.LessOrEqual(t, pn, c.maxPacketSize)
+	}
+
+	// nothing fits
+	c.maxPacketSize = 10
+	require.Empty(t, w.signalingParts(sc.Signaling(), n))
+}
@@ -0,0 +1,163 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ntpPort    = "123"
+	ntpTimeout = time.Second
+	// NTP v4 client request
+	ntpRequestSettings = 0x23
+)
+
+// ntpChecker compares served time to NTP servers to catch gross failures
+// like a wrong UTC offset or a misconfigured PHC
+type ntpChecker struct {
+	servers   []string
+	maxOffset time.Duration
+	timeout   time.Duration
+	// served returns currently served time in UTC
+	served func() (time.Time, error)
+
+	offset int64
+	alarm  int64
+}
+
+func newNTPChecker(servers []string, maxOffset time.Duration, served func() (time.Time, error)) *ntpChecker {
+	return &ntpChecker{
+		servers:   servers,
+		maxOffset: maxOffset,
+		timeout:   ntpTimeout,
+		served:    served,
+	}
+}
+
+// query returns offset of the served time from the NTP server
+func (n *ntpChecker) query(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, ntpPort)
+	}
+	conn, err := net.DialTimeout("udp", server, n.timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(n.timeout)); err != nil {
+		return 0, err
+	}
+
+	t1 := time.Now()
+	sec, frac := ntp.Time(t1)
+	request := &ntp.Packet{Settings: ntpRequestSettings, TxTimeSec: sec, TxTimeFrac: frac}
+	b, err := request.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(b); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, ntp.PacketSizeBytes)
+	if _, err := conn.Read(buf); err != nil {
+		return 0, err
+	}
+	t4 := time.Now()
+	served, err := n.served()
+	if err != nil {
+		return 0, err
+	}
+	response, err := ntp.BytesToPacket(buf)
+	if err != nil {
+		return 0, err
+	}
+	if response.OrigTimeSec != sec || response.OrigTimeFrac != frac {
+		return 0, fmt.Errorf("origin timestamp mismatch")
+	}
+	if response.Stratum == 0 {
+		return 0, fmt.Errorf("kiss of death")
+	}
+
+	t2 := ntp.Unix(response.RxTimeSec, response.RxTimeFrac)
+	t3 := ntp.Unix(response.TxTimeSec, response.TxTimeFrac)
+	ntpTime := ntp.CorrectTime(t4, ntp.Offset(t1, t2, t3, t4))
+	return served.Sub(ntpTime), nil
+}
+
+// check queries all servers and raises the alarm if the median offset is out of bounds
+func (n *ntpChecker) check() {
+	offsets := []time.Duration{}
+	for _, server := range n.servers {
+		offset, err := n.query(server)
+		if err != nil {
+			log.Warningf("NTP check against %s failed: %v", server, err)
+			continue
+		}
+		log.Debugf("NTP check against %s: offset %v", server, offset)
+		offsets = append(offsets, offset)
+	}
+	if len(offsets) == 0 {
+		// Nothing to compare with is not a reason to alarm
+		atomic.StoreInt64(&n.alarm, 0)
+		return
+	}
+
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	offset := offsets[len(offsets)/2]
+	atomic.StoreInt64(&n.offset, int64(offset))
+	if offset > n.maxOffset || offset < -n.maxOffset {
+		log.Errorf("Served time is %v away from NTP, check UTC offset and PHC", offset)
+		atomic.StoreInt64(&n.alarm, 1)
+		return
+	}
+	atomic.StoreInt64(&n.alarm, 0)
+}
+
+// Offset returns the last median offset of the served time from NTP
+func (n *ntpChecker) Offset() int64 {
+	return atomic.LoadInt64(&n.offset)
+}
+
+// Alarm returns 1 if served time is off from NTP
+func (n *ntpChecker) Alarm() int64 {
+	return atomic.LoadInt64(&n.alarm)
+}
+
+// startNTPCheck periodically cross checks served time against NTP
+func (s *Server) startNTPCheck() {
+	for ; true; <-time.After(s.Config.NTPCheckInterval) {
+		s.ntpCheck.check()
+	}
+}
+
+// servedUTC returns currently served time in UTC
+func (s *Server) servedUTC() (time.Time, error) {
+	now, err := s.Config.timeSrc.Now()
+	if err != nil {
+		return now, err
+	}
+	return now.Add(-s.Config.UTCOffset), nil
+}
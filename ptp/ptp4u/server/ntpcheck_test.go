@@ -0,0 +1,92 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ntp "github.com/facebook/time/ntp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNTPServer replies to NTP requests with local time shifted by offset
+func fakeNTPServer(t *testing.T, offset time.Duration) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		for {
+			request, addr, err := ntp.ReadNTPPacket(conn)
+			if err != nil {
+				return
+			}
+			sec, frac := ntp.Time(time.Now().Add(offset))
+			response := &ntp.Packet{
+				Settings:     0x24,
+				Stratum:      1,
+				OrigTimeSec:  request.TxTimeSec,
+				OrigTimeFrac: request.TxTimeFrac,
+				RxTimeSec:    sec,
+				RxTimeFrac:   frac,
+				TxTimeSec:    sec,
+				TxTimeFrac:   frac,
+			}
+			b, _ := response.Bytes()
+			_, _ = conn.WriteTo(b, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTPCheckerQuery(t *testing.T) {
+	addr := fakeNTPServer(t, time.Hour)
+	n := newNTPChecker(nil, time.Second, func() (time.Time, error) { return time.Now(), nil })
+
+	offset, err := n.query(addr)
+	require.NoError(t, err)
+	require.InDelta(t, float64(-time.Hour), float64(offset), float64(10*time.Millisecond))
+}
+
+func TestNTPCheckerAlarm(t *testing.T) {
+	good := fakeNTPServer(t, 0)
+	bad := fakeNTPServer(t, 37*time.Second)
+	served := func() (time.Time, error) { return time.Now(), nil }
+
+	n := newNTPChecker([]string{good, bad, good}, 100*time.Millisecond, served)
+	n.check()
+	require.Equal(t, int64(0), n.Alarm())
+
+	n = newNTPChecker([]string{bad, good, bad}, 100*time.Millisecond, served)
+	n.check()
+	require.Equal(t, int64(1), n.Alarm())
+	require.InDelta(t, float64(-37*time.Second), float64(n.Offset()), float64(10*time.Millisecond))
+}
+
+func TestNTPCheckerNoResponse(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	n := newNTPChecker([]string{conn.LocalAddr().String()}, time.Second, func() (time.Time, error) { return time.Now(), nil })
+	n.timeout = 10 * time.Millisecond
+	n.alarm = 1
+	n.check()
+	require.Equal(t, int64(0), n.Alarm())
+}
@@ -0,0 +1,136 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// pathDelayMaxSamples is the number of the latest samples kept per prefix within the metric interval
+const pathDelayMaxSamples = 1000
+
+// pathDelayMax is the delay above which the client is considered not synchronized and the sample is discarded
+const pathDelayMax = time.Second
+
+// pathDelayPercentiles are the exported percentiles of the per prefix delay distribution
+var pathDelayPercentiles = []int{50, 90, 99}
+
+// delaySamples is a ring of the latest delay samples
+type delaySamples struct {
+	samples []time.Duration
+	next    int
+}
+
+func (d *delaySamples) add(delay time.Duration) {
+	if len(d.samples) < pathDelayMaxSamples {
+		d.samples = append(d.samples, delay)
+		return
+	}
+	d.samples[d.next] = delay
+	d.next = (d.next + 1) % pathDelayMaxSamples
+}
+
+// pathDelays estimates the client to server delay from the DelayReqs of the clients synchronized
+// to this server, which fill the origin timestamp with the transmit time, and aggregates them per client prefix
+type pathDelays struct {
+	sync.Mutex
+	v4Mask   net.IPMask
+	v6Mask   net.IPMask
+	prefixes map[string]*delaySamples
+}
+
+func newPathDelays(v4Len, v6Len int) *pathDelays {
+	return &pathDelays{
+		v4Mask:   net.CIDRMask(v4Len, 8*net.IPv4len),
+		v6Mask:   net.CIDRMask(v6Len, 8*net.IPv6len),
+		prefixes: make(map[string]*delaySamples),
+	}
+}
+
+// prefix returns the client prefix the delay is aggregated by
+func (p *pathDelays) prefix(ip net.IP) string {
+	mask := p.v6Mask
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, p.v4Mask
+	}
+	n := net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	return n.String()
+}
+
+// oneWayDelay returns the client to server delay of the DelayReq received at rxTS
+func oneWayDelay(dReq *ptp.SyncDelayReq, rxTS time.Time) (time.Duration, bool) {
+	if dReq.OriginTimestamp.Empty() {
+		return 0, false
+	}
+	delay := rxTS.Sub(dReq.OriginTimestamp.Time())
+	if !dReq.CorrectionField.TooBig() {
+		delay -= time.Duration(dReq.CorrectionField.Nanoseconds())
+	}
+	if delay < 0 || delay > pathDelayMax {
+		return 0, false
+	}
+	return delay, true
+}
+
+// observe records the delay of the DelayReq from the client
+func (p *pathDelays) observe(ip net.IP, dReq *ptp.SyncDelayReq, rxTS time.Time) {
+	delay, ok := oneWayDelay(dReq, rxTS)
+	if !ok {
+		return
+	}
+	prefix := p.prefix(ip)
+	p.Lock()
+	defer p.Unlock()
+	d, ok := p.prefixes[prefix]
+	if !ok {
+		d = &delaySamples{}
+		p.prefixes[prefix] = d
+	}
+	d.add(delay)
+}
+
+// percentile returns the p-th percentile of the sorted samples
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// flush returns the delay percentiles per prefix and starts a new interval
+func (p *pathDelays) flush() map[string]map[int]time.Duration {
+	p.Lock()
+	prefixes := p.prefixes
+	p.prefixes = make(map[string]*delaySamples)
+	p.Unlock()
+
+	res := make(map[string]map[int]time.Duration, len(prefixes))
+	for prefix, d := range prefixes {
+		sort.Slice(d.samples, func(i, j int) bool { return d.samples[i] < d.samples[j] })
+		res[prefix] = make(map[int]time.Duration, len(pathDelayPercentiles))
+		for _, pc := range pathDelayPercentiles {
+			res[prefix][pc] = percentile(d.samples, pc)
+		}
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+
+	"github.com/stretchr/testify/require"
+)
+
+func delayReqSentAt(ts time.Time) *ptp.SyncDelayReq {
+	return &ptp.SyncDelayReq{SyncDelayReqBody: ptp.SyncDelayReqBody{OriginTimestamp: ptp.NewTimestamp(ts)}}
+}
+
+func TestPathDelaysPrefix(t *testing.T) {
+	p := newPathDelays(24, 64)
+	require.Equal(t, "192.168.1.0/24", p.prefix(net.ParseIP("192.168.1.42")))
+	require.Equal(t, "2001:db8:0:1::/64", p.prefix(net.ParseIP("2001:db8:0:1::42")))
+}
+
+func TestOneWayDelay(t *testing.T) {
+	rxTS := time.Now()
+
+	delay, ok := oneWayDelay(delayReqSentAt(rxTS.Add(-10*time.Microsecond)), rxTS)
+	require.True(t, ok)
+	require.Equal(t, 10*time.Microsecond, delay)
+
+	dReq := delayReqSentAt(rxTS.Add(-10 * time.Microsecond))
+	dReq.CorrectionField = ptp.NewCorrection(4000)
+	delay, ok = oneWayDelay(dReq, rxTS)
+	require.True(t, ok)
+	require.Equal(t, 6*time.Microsecond, delay)
+
+	// most clients don't fill the origin timestamp
+	_, ok = oneWayDelay(&ptp.SyncDelayReq{}, rxTS)
+	require.False(t, ok)
+	// clients not synchronized to this server
+	_, ok = oneWayDelay(delayReqSentAt(rxTS.Add(time.Millisecond)), rxTS)
+	require.False(t, ok)
+	_, ok = oneWayDelay(delayReqSentAt(rxTS.Add(-2*time.Second)), rxTS)
+	require.False(t, ok)
+}
+
+func TestPathDelaysFlush(t *testing.T) {
+	p := newPathDelays(24, 64)
+	rxTS := time.Now()
+	for i := 1; i <= 100; i++ {
+		p.observe(net.ParseIP("10.0.0.1"), delayReqSentAt(rxTS.Add(-time.Duration(i)*time.Microsecond)), rxTS)
+	}
+	p.observe(net.ParseIP("10.0.1.1"), delayReqSentAt(rxTS.Add(-time.Millisecond)), rxTS)
+	p.observe(net.ParseIP("10.0.2.1"), &ptp.SyncDelayReq{}, rxTS)
+
+	require.Equal(t, map[string]map[int]time.Duration{
+		"10.0.0.0/24": {50: 50 * time.Microsecond, 90: 90 * time.Microsecond, 99: 99 * time.Microsecond},
+		"10.0.1.0/24": {50: time.Millisecond, 90: time.Millisecond, 99: time.Millisecond},
+	}, p.flush())
+	require.Empty(t, p.flush())
+}
+
+func TestDelaySamplesRing(t *testing.T) {
+	d := &delaySamples{}
+	for i := 0; i < pathDelayMaxSamples+10; i++ {
+		d.add(time.Duration(i))
+	}
+	require.Len(t, d.samples, pathDelayMaxSamples)
+	require.Equal(t, time.Duration(pathDelayMaxSamples), d.samples[0])
+	require.Equal(t, time.Duration(10), d.samples[10])
+}
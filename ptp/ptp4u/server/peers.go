@@ -0,0 +1,87 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/peer"
+	log "github.com/sirupsen/logrus"
+)
+
+// newPeerMonitor creates the monitor of the cooperating ptp4u instances
+func (s *Server) newPeerMonitor() (*peer.Monitor, error) {
+	key, err := os.ReadFile(s.Config.PeerKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading peer key: %w", err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("peer key %s is empty", s.Config.PeerKeyFile)
+	}
+
+	pc := &peer.Config{
+		Peers:     s.Config.Peers,
+		Key:       key,
+		Interval:  s.Config.PeerInterval,
+		MaxOffset: s.Config.PeerMaxOffset,
+	}
+	quality := func() (ptp.ClockClass, ptp.ClockAccuracy) {
+		// Peers need to know what we would announce if we trusted ourselves
+		return s.Config.ClockClass, s.Config.ClockAccuracy
+	}
+	return peer.NewMonitor(pc, s.Config.clockIdentity, s.Config.timeSrc.Now, quality), nil
+}
+
+// startPeerListener exchanges statements with peers
+func (s *Server) startPeerListener() {
+	addr := net.JoinHostPort(s.Config.IP.String(), strconv.Itoa(s.Config.PeerPort))
+	log.Infof("Binding on %s for peer statements", addr)
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		log.Fatalf("Listening error: %s", err)
+	}
+	// Peer exchange keeps running while drained, hence own context
+	if err := s.peers.Run(context.Background(), conn); err != nil {
+		log.Errorf("Peer monitor failed: %v", err)
+	}
+}
+
+// checkPeers degrades the server if it drifted away from its peers
+func (s *Server) checkPeers() {
+	if s.peers == nil {
+		return
+	}
+	if s.peers.Drifted() {
+		if atomic.SwapInt32(&s.Config.degraded, 1) == 0 {
+			log.Errorf("Drifted away from peers %v, degrading", s.peers.Offsets())
+		}
+		s.Stats.SetDegraded(1)
+		return
+	}
+	if atomic.SwapInt32(&s.Config.degraded, 0) == 1 {
+		log.Warningf("Back in agreement with peers, restoring clock quality")
+	}
+	s.Stats.SetDegraded(0)
+}
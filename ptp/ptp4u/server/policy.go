@@ -0,0 +1,80 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/facebook/time/ptp/policy"
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// grantPolicy holds the policy evaluated on grant requests. nil grantPolicy allows everything
+type grantPolicy struct {
+	sync.RWMutex
+	policy *policy.Policy
+}
+
+// update replaces the policy
+func (g *grantPolicy) update(p *policy.Policy) {
+	g.Lock()
+	defer g.Unlock()
+	g.policy = p
+}
+
+// Denied returns the name of the rule denying the request, empty if the request may proceed.
+// Rules failing to evaluate are logged and skipped
+func (g *grantPolicy) Denied(r *policy.GrantRequest) string {
+	if g == nil {
+		return ""
+	}
+	g.RLock()
+	defer g.RUnlock()
+	rule, err := g.policy.DecideGrant(r)
+	if err != nil {
+		log.Errorf("Evaluating grant policy: %v", err)
+	}
+	if rule == nil || rule.Action != policy.ActionDeny {
+		return ""
+	}
+	return rule.Name
+}
+
+// policyDenied checks the grant request of the client against the policy.
+// Returns the reason of the denial, empty if the request may proceed
+func (s *Server) policyDenied(ip net.IP, signaling *ptp.Signaling, tlv *ptp.RequestUnicastTransmissionTLV) string {
+	if s.Config.policy == nil {
+		return ""
+	}
+	r := &policy.GrantRequest{
+		IP:       ip.String(),
+		Type:     tlv.MsgTypeAndReserved.MsgType().String(),
+		Interval: int8(tlv.LogInterMessagePeriod),
+		Duration: tlv.DurationField,
+		Domain:   signaling.Header.DomainNumber,
+		Tenant:   s.Config.tenants.Match(ip, signaling.Header.DomainNumber),
+	}
+	rule := s.Config.policy.Denied(r)
+	if rule == "" {
+		return ""
+	}
+	log.Debugf("Grant request of %s for %s denied by policy rule %q", r.IP, r.Type, rule)
+	s.Stats.IncDeniedPolicy()
+	return "policy"
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/facebook/time/ptp/policy"
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyDenied(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+grant:
+  - name: lab-fast-sync
+    when: "in_prefix(ip, '10.1.0.0/16') && type == 'SYNC' && interval < -4"
+    action: deny
+`))
+	require.NoError(t, err)
+	s := &Server{Config: &Config{policy: &grantPolicy{policy: p}}, Stats: stats.NewJSONStats()}
+	request := func(t ptp.MessageType, interval ptp.LogInterval) *ptp.RequestUnicastTransmissionTLV {
+		return &ptp.RequestUnicastTransmissionTLV{
+			MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(t, 0),
+			LogInterMessagePeriod: interval,
+			DurationField:         300,
+		}
+	}
+	signaling := &ptp.Signaling{}
+
+	require.Equal(t, "policy", s.policyDenied(net.ParseIP("10.1.0.1"), signaling, request(ptp.MessageSync, -5)))
+	require.Equal(t, "", s.policyDenied(net.ParseIP("10.1.0.1"), signaling, request(ptp.MessageSync, -4)))
+	require.Equal(t, "", s.policyDenied(net.ParseIP("10.1.0.1"), signaling, request(ptp.MessageAnnounce, -5)))
+	require.Equal(t, "", s.policyDenied(net.ParseIP("10.2.0.1"), signaling, request(ptp.MessageSync, -5)))
+
+	// no policy allows everything
+	s.Config.policy = nil
+	require.Equal(t, "", s.policyDenied(net.ParseIP("10.1.0.1"), signaling, request(ptp.MessageSync, -5)))
+}
+
+func TestPolicyReload(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "ptp4u.yaml")
+	require.NoError(t, (&DynamicConfig{
+		DrainInterval:  1,
+		MetricInterval: 1,
+		MinSubInterval: 1,
+		MaxSubDuration: 1,
+		UTCOffset:      37e9,
+	}).Write(config))
+	path := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("grant: [{name: all, when: 'true', action: deny}]"), 0644))
+	p, err := policy.Read(path)
+	require.NoError(t, err)
+	s := &Server{
+		Config: &Config{StaticConfig: StaticConfig{ConfigFile: config, PolicyFile: path}, policy: &grantPolicy{policy: p}},
+		Stats:  stats.NewJSONStats(),
+	}
+	require.Equal(t, "all", s.Config.policy.Denied(&policy.GrantRequest{}))
+
+	require.NoError(t, os.WriteFile(path, []byte("grant: [{name: all, when: 'true', action: allow}]"), 0644))
+	require.NoError(t, s.reloadConfig())
+	require.Equal(t, "", s.Config.policy.Denied(&policy.GrantRequest{}))
+
+	// broken policy keeps the old one
+	require.NoError(t, os.WriteFile(path, []byte("grant: [{name: all, when: 'true', action: drop}]"), 0644))
+	require.NoError(t, s.reloadConfig())
+	require.Equal(t, "", s.Config.policy.Denied(&policy.GrantRequest{}))
+}
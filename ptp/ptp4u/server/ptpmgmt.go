@@ -0,0 +1,235 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// ptpMgmtRequest is the part of the PTP management message needed to answer it.
+// Data of GET requests is ignored, so requests carrying only the managementId are accepted too
+type ptpMgmtRequest struct {
+	ptp.ManagementMsgHead
+	ptp.ManagementTLVHead
+}
+
+// parsePTPMgmtRequest decodes head of the PTP management message
+func parsePTPMgmtRequest(b []byte) (*ptpMgmtRequest, error) {
+	req := &ptpMgmtRequest{}
+	if err := binary.Read(bytes.NewReader(b), binary.BigEndian, req); err != nil {
+		return nil, fmt.Errorf("reading management message: %w", err)
+	}
+	if req.TLVType != ptp.TLVManagement {
+		return nil, fmt.Errorf("got TLV type %s instead of %s in management message", req.TLVType, ptp.TLVManagement)
+	}
+	return req, nil
+}
+
+// ptpMgmtTarget checks the request is addressed to the server port
+func (s *Server) ptpMgmtTarget(target ptp.PortIdentity) bool {
+	if target.ClockIdentity != ptp.DefaultTargetPortIdentity.ClockIdentity && target.ClockIdentity != s.Config.clockIdentity {
+		return false
+	}
+	return target.PortNumber == ptp.DefaultTargetPortIdentity.PortNumber || target.PortNumber == 1
+}
+
+// ptpMgmtTLVHead returns head of the management TLV of the given type
+func ptpMgmtTLVHead(id ptp.ManagementID, tlv interface{}) ptp.ManagementTLVHead {
+	return ptp.ManagementTLVHead{
+		TLVHead: ptp.TLVHead{
+			TLVType:     ptp.TLVManagement,
+			LengthField: uint16(binary.Size(tlv) - binary.Size(ptp.TLVHead{})),
+		},
+		ManagementID: id,
+	}
+}
+
+// ptpMgmtHead returns head of the response to the request
+func (s *Server) ptpMgmtHead(req *ptpMgmtRequest, length int) ptp.ManagementMsgHead {
+	hops := req.StartingBoundaryHops - req.BoundaryHops
+	return ptp.ManagementMsgHead{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageManagement, 0),
+			Version:         ptp.Version,
+			MessageLength:   uint16(binary.Size(ptp.ManagementMsgHead{}) + length),
+			DomainNumber:    uint8(s.Config.DomainNumber),
+			FlagField:       ptp.FlagUnicast,
+			SequenceID:      req.SequenceID,
+			SourcePortIdentity: ptp.PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: s.Config.clockIdentity,
+			},
+			ControlField:       4,
+			LogMessageInterval: ptp.MgmtLogMessageInterval,
+		},
+		TargetPortIdentity:   req.SourcePortIdentity,
+		StartingBoundaryHops: hops,
+		BoundaryHops:         hops,
+		ActionField:          ptp.RESPONSE,
+	}
+}
+
+// ptpMgmtError returns MANAGEMENT_ERROR_STATUS response to the request
+func (s *Server) ptpMgmtError(req *ptpMgmtRequest, errID ptp.ManagementErrorID) *ptp.ManagementMsgErrorStatus {
+	tlv := ptp.ManagementErrorStatusTLV{
+		TLVHead: ptp.TLVHead{
+			TLVType: ptp.TLVManagementErrorStatus,
+		},
+		ManagementErrorID: errID,
+		ManagementID:      req.ManagementID,
+	}
+	// DisplayData is not sent
+	size := binary.Size(tlv.TLVHead) + binary.Size(tlv.ManagementErrorID) + binary.Size(tlv.ManagementID) + binary.Size(tlv.Reserved)
+	tlv.LengthField = uint16(size - binary.Size(tlv.TLVHead))
+	return &ptp.ManagementMsgErrorStatus{
+		ManagementMsgHead:        s.ptpMgmtHead(req, size),
+		ManagementErrorStatusTLV: tlv,
+	}
+}
+
+// ptpMgmtPortState returns state of the server port. Drained server doesn't grant subscriptions
+func (s *Server) ptpMgmtPortState() ptp.PortState {
+	if (s.ctx != nil && s.ctx.Err() != nil) || atomic.LoadInt32(&s.shuttingDown) == 1 || s.Drained() {
+		return ptp.PortStateDisabled
+	}
+	return ptp.PortStateMaster
+}
+
+// ptpMgmtResponse returns response to the management request of the client
+func (s *Server) ptpMgmtResponse(req *ptpMgmtRequest, ip net.IP) ptp.Packet {
+	if req.Action() != ptp.GET {
+		return s.ptpMgmtError(req, ptp.ErrorNotSupported)
+	}
+
+	dcMux.Lock()
+	utcOffset := s.Config.UTCOffset
+	minInterval := s.Config.MinSubInterval
+	priority1, priority2 := s.Config.Priorities()
+	dcMux.Unlock()
+	gm := s.Config.Grandmaster(s.Config.tenants.Match(ip, req.DomainNumber))
+	// same values as advertised in Announce messages
+	clockQuality := ptp.ClockQuality{
+		ClockClass:              gm.ClockClass,
+		ClockAccuracy:           gm.ClockAccuracy,
+		OffsetScaledLogVariance: gm.OffsetScaledLogVariance,
+	}
+	interval, _ := ptp.NewLogInterval(minInterval)
+
+	var tlv ptp.ManagementTLV
+	switch req.ManagementID {
+	case ptp.IDDefaultDataSet:
+		tlv = &ptp.DefaultDataSetTLV{
+			ManagementTLVHead: ptpMgmtTLVHead(req.ManagementID, ptp.DefaultDataSetTLV{}),
+			// two step, not slave only
+			SoTSC:         1,
+			NumberPorts:   1,
+			Priority1:     priority1,
+			ClockQuality:  clockQuality,
+			Priority2:     priority2,
+			ClockIdentity: s.Config.clockIdentity,
+			DomainNumber:  uint8(s.Config.DomainNumber),
+		}
+	case ptp.IDCurrentDataSet:
+		// the server is the grandmaster or shares the clock with its upstream ptp4l
+		tlv = &ptp.CurrentDataSetTLV{
+			ManagementTLVHead: ptpMgmtTLVHead(req.ManagementID, ptp.CurrentDataSetTLV{}),
+			StepsRemoved:      gm.StepsRemoved,
+		}
+	case ptp.IDParentDataSet:
+		tlv = &ptp.ParentDataSetTLV{
+			ManagementTLVHead: ptpMgmtTLVHead(req.ManagementID, ptp.ParentDataSetTLV{}),
+			ParentPortIdentity: ptp.PortIdentity{
+				ClockIdentity: s.Config.clockIdentity,
+			},
+			ObservedParentOffsetScaledLogVariance: 0xffff,
+			ObservedParentClockPhaseChangeRate:    0x7fffffff,
+			GrandmasterPriority1:                  gm.Priority1,
+			GrandmasterClockQuality:               clockQuality,
+			GrandmasterPriority2:                  gm.Priority2,
+			GrandmasterIdentity:                   gm.Identity,
+		}
+	case ptp.IDTimePropertiesDataSet:
+		tlv = &ptp.TimePropertiesDataSetTLV{
+			ManagementTLVHead: ptpMgmtTLVHead(req.ManagementID, ptp.TimePropertiesDataSetTLV{}),
+			CurrentUTCOffset:  int16(utcOffset.Seconds()),
+			Flags:             uint8(ptp.FlagPTPTimescale | s.Config.leap.flags()),
+			TimeSource:        ptp.TimeSourceGNSS,
+		}
+	case ptp.IDPortDataSet:
+		tlv = &ptp.PortDataSetTLV{
+			ManagementTLVHead: ptpMgmtTLVHead(req.ManagementID, ptp.PortDataSetTLV{}),
+			PortIdentity: ptp.PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: s.Config.clockIdentity,
+			},
+			PortState:              s.ptpMgmtPortState(),
+			LogMinDelayReqInterval: interval,
+			LogAnnounceInterval:    interval,
+			AnnounceReceiptTimeout: 3,
+			LogSyncInterval:        interval,
+			// end to end
+			DelayMechanism: 1,
+			VersionNumber:  ptp.Version,
+		}
+	default:
+		return s.ptpMgmtError(req, ptp.ErrorNoSuchID)
+	}
+	return &ptp.Management{
+		ManagementMsgHead: s.ptpMgmtHead(req, binary.Size(tlv)),
+		TLV:               tlv,
+	}
+}
+
+// handlePTPManagement answers PTP management request received on the general port, replying from gFd
+func (s *Server) handlePTPManagement(gFd int, b []byte, gclisa unix.Sockaddr) {
+	req, err := parsePTPMgmtRequest(b)
+	if err != nil {
+		if s.logLimit.Allow(gclisa, logClassDecode) {
+			log.Error(err)
+		}
+		return
+	}
+	if !s.ptpMgmtTarget(req.TargetPortIdentity) {
+		return
+	}
+	if s.Config.Standby {
+		s.Stats.IncStandbySuppressed(ptp.MessageManagement)
+		return
+	}
+	ip := timestamp.SockaddrToIP(gclisa)
+	log.Debugf("Got management %d request for 0x%04x from %s", req.Action(), req.ManagementID, ip)
+	resp, err := ptp.Bytes(s.ptpMgmtResponse(req, ip))
+	if err == nil {
+		resp, err = s.Config.auth.signBytes(resp)
+	}
+	if err != nil {
+		log.Errorf("Failed to generate the management response: %v", err)
+		return
+	}
+	if err := sendTo(gFd, resp, gclisa, s.Config.GeneralFlowLabel); err != nil {
+		log.Errorf("Failed to send the management response: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func ptpMgmtTestServer() *Server {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{DomainNumber: 24},
+		DynamicConfig: DynamicConfig{ClockClass: 6, ClockAccuracy: 33, MinSubInterval: time.Second, UTCOffset: 37 * time.Second},
+	}
+	return &Server{Config: c}
+}
+
+// ptpMgmtExchange passes the request through the wire format and decodes the response
+func ptpMgmtExchange(t *testing.T, s *Server, req *ptp.Management) ptp.Packet {
+	b, err := ptp.Bytes(req)
+	require.NoError(t, err)
+	r, err := parsePTPMgmtRequest(b)
+	require.NoError(t, err)
+	resp, err := ptp.Bytes(s.ptpMgmtResponse(r, net.ParseIP("192.168.0.10")))
+	require.NoError(t, err)
+	p, err := ptp.DecodePacket(resp)
+	require.NoError(t, err)
+	return p
+}
+
+func TestParsePTPMgmtRequest(t *testing.T) {
+	b, err := ptp.Bytes(ptp.PortDataSetRequest())
+	require.NoError(t, err)
+	req, err := parsePTPMgmtRequest(b)
+	require.NoError(t, err)
+	require.Equal(t, ptp.GET, req.Action())
+	require.Equal(t, ptp.IDPortDataSet, req.ManagementID)
+
+	// GET without the data field
+	req, err = parsePTPMgmtRequest(b[:binary.Size(ptpMgmtRequest{})])
+	require.NoError(t, err)
+	require.Equal(t, ptp.IDPortDataSet, req.ManagementID)
+
+	_, err = parsePTPMgmtRequest(b[:20])
+	require.Error(t, err)
+
+	signaling, err := ptp.Bytes(&ptp.Signaling{TLVs: []ptp.TLV{&ptp.CancelUnicastTransmissionTLV{TLVHead: ptp.TLVHead{TLVType: ptp.TLVCancelUnicastTransmission}}}})
+	require.NoError(t, err)
+	_, err = parsePTPMgmtRequest(signaling)
+	require.Error(t, err)
+}
+
+func TestPTPMgmtTarget(t *testing.T) {
+	s := ptpMgmtTestServer()
+	require.True(t, s.ptpMgmtTarget(ptp.DefaultTargetPortIdentity))
+	require.True(t, s.ptpMgmtTarget(ptp.PortIdentity{ClockIdentity: 1234, PortNumber: 1}))
+	require.True(t, s.ptpMgmtTarget(ptp.PortIdentity{ClockIdentity: 1234, PortNumber: 0xffff}))
+	require.False(t, s.ptpMgmtTarget(ptp.PortIdentity{ClockIdentity: 1234, PortNumber: 2}))
+	require.False(t, s.ptpMgmtTarget(ptp.PortIdentity{ClockIdentity: 4321, PortNumber: 1}))
+}
+
+func TestHandlePTPManagementStandby(t *testing.T) {
+	s := ptpMgmtTestServer()
+	s.Config.Standby = true
+	st := stats.NewJSONStats()
+	s.Stats = st
+	b, err := ptp.Bytes(ptp.DefaultDataSetRequest())
+	require.NoError(t, err)
+
+	// nothing is sent, so the invalid socket is never used
+	s.handlePTPManagement(-1, b, timestamp.IPToSockaddr(net.ParseIP("192.168.0.10"), ptp.PortGeneral))
+	require.Equal(t, int64(1), st.Live()["standby.suppressed.management"])
+}
+
+func TestPTPMgmtDefaultDataSet(t *testing.T) {
+	s := ptpMgmtTestServer()
+	req := ptp.DefaultDataSetRequest()
+	req.SequenceID = 42
+	p := ptpMgmtExchange(t, s, req)
+	resp, ok := p.(*ptp.Management)
+	require.True(t, ok)
+	require.Equal(t, ptp.RESPONSE, resp.Action())
+	require.Equal(t, uint16(42), resp.SequenceID)
+	require.Equal(t, req.SourcePortIdentity, resp.TargetPortIdentity)
+	require.Equal(t, uint8(24), resp.DomainNumber)
+
+	tlv, ok := resp.TLV.(*ptp.DefaultDataSetTLV)
+	require.True(t, ok)
+	require.Equal(t, ptp.ClockIdentity(1234), tlv.ClockIdentity)
+	require.Equal(t, ptp.ClockClass(6), tlv.ClockQuality.ClockClass)
+	require.Equal(t, ptp.ClockAccuracy(33), tlv.ClockQuality.ClockAccuracy)
+	require.Equal(t, uint16(1), tlv.NumberPorts)
+	require.Equal(t, uint8(24), tlv.DomainNumber)
+}
+
+func TestPTPMgmtCurrentDataSet(t *testing.T) {
+	s := ptpMgmtTestServer()
+	resp := ptpMgmtExchange(t, s, ptp.CurrentDataSetRequest()).(*ptp.Management)
+	tlv, ok := resp.TLV.(*ptp.CurrentDataSetTLV)
+	require.True(t, ok)
+	require.Equal(t, uint16(0), tlv.StepsRemoved)
+}
+
+func TestPTPMgmtParentDataSet(t *testing.T) {
+	s := ptpMgmtTestServer()
+	s.Config.degraded = 1
+	resp := ptpMgmtExchange(t, s, ptp.ParentDataSetRequest()).(*ptp.Management)
+	tlv, ok := resp.TLV.(*ptp.ParentDataSetTLV)
+	require.True(t, ok)
+	require.Equal(t, ptp.ClockIdentity(1234), tlv.GrandmasterIdentity)
+	require.Equal(t, ptp.ClockIdentity(1234), tlv.ParentPortIdentity.ClockIdentity)
+	require.Equal(t, ptp.ClockClass52, tlv.GrandmasterClockQuality.ClockClass)
+}
+
+func TestPTPMgmtTimePropertiesDataSet(t *testing.T) {
+	s := ptpMgmtTestServer()
+	resp := ptpMgmtExchange(t, s, ptp.TimePropertiesDataSetRequest()).(*ptp.Management)
+	tlv, ok := resp.TLV.(*ptp.TimePropertiesDataSetTLV)
+	require.True(t, ok)
+	require.Equal(t, int16(37), tlv.CurrentUTCOffset)
+	require.Equal(t, uint8(ptp.FlagPTPTimescale), tlv.Flags)
+	require.Equal(t, ptp.TimeSourceGNSS, tlv.TimeSource)
+}
+
+func TestPTPMgmtPortDataSet(t *testing.T) {
+	s := ptpMgmtTestServer()
+	resp := ptpMgmtExchange(t, s, ptp.PortDataSetRequest()).(*ptp.Management)
+	tlv, ok := resp.TLV.(*ptp.PortDataSetTLV)
+	require.True(t, ok)
+	require.Equal(t, ptp.PortIdentity{ClockIdentity: 1234, PortNumber: 1}, tlv.PortIdentity)
+	require.Equal(t, ptp.PortStateMaster, tlv.PortState)
+	require.Equal(t, ptp.LogInterval(0), tlv.LogSyncInterval)
+	require.Equal(t, uint8(1), tlv.DelayMechanism)
+
+	s.shuttingDown = 1
+	resp = ptpMgmtExchange(t, s, ptp.PortDataSetRequest()).(*ptp.Management)
+	require.Equal(t, ptp.PortStateDisabled, resp.TLV.(*ptp.PortDataSetTLV).PortState)
+}
+
+func TestPTPMgmtError(t *testing.T) {
+	s := ptpMgmtTestServer()
+	req := ptp.ClockAccuracyRequest()
+	p := ptpMgmtExchange(t, s, req)
+	resp, ok := p.(*ptp.ManagementMsgErrorStatus)
+	require.True(t, ok)
+	require.Equal(t, ptp.ErrorNoSuchID, resp.ManagementErrorID)
+	require.Equal(t, ptp.IDClockAccuracy, resp.ManagementErrorStatusTLV.ManagementID)
+
+	req = ptp.DefaultDataSetRequest()
+	req.ActionField = ptp.SET
+	resp, ok = ptpMgmtExchange(t, s, req).(*ptp.ManagementMsgErrorStatus)
+	require.True(t, ok)
+	require.Equal(t, ptp.ErrorNotSupported, resp.ManagementErrorID)
+}
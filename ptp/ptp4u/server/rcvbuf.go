@@ -0,0 +1,132 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// layout of the SO_MEMINFO reply: SK_MEMINFO_VARS counters, SK_MEMINFO_DROPS among them
+const (
+	skMemInfoVars  = 9
+	skMemInfoDrops = 8
+)
+
+// rcvBufTuner grows SO_RCVBUF of a socket while the kernel drops packets on it
+type rcvBufTuner struct {
+	name      string
+	fd        int
+	max       int
+	lastDrops uint32
+}
+
+// socketDrops returns the number of packets dropped by the kernel on the socket since it was created
+func socketDrops(fd int) (uint32, error) {
+	var meminfo [skMemInfoVars]uint32
+	l := uint32(unsafe.Sizeof(meminfo))
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_SOCKET, unix.SO_MEMINFO, uintptr(unsafe.Pointer(&meminfo)), uintptr(unsafe.Pointer(&l)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return meminfo[skMemInfoDrops], nil
+}
+
+func newRcvBufTuner(name string, fd int, max int) (*rcvBufTuner, error) {
+	drops, err := socketDrops(fd)
+	if err != nil {
+		return nil, err
+	}
+	return &rcvBufTuner{name: name, fd: fd, max: max, lastDrops: drops}, nil
+}
+
+// tune doubles the receive buffer up to max if there were drops since the last call.
+// It returns the current buffer size and the number of drops since the last call
+func (r *rcvBufTuner) tune() (int, int64, error) {
+	drops, err := socketDrops(r.fd)
+	if err != nil {
+		return 0, 0, err
+	}
+	// uint32 arithmetic survives the kernel counter wrapping around
+	delta := int64(drops - r.lastDrops)
+	r.lastDrops = drops
+
+	size, err := unix.GetsockoptInt(r.fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	if err != nil {
+		return 0, delta, err
+	}
+	if delta == 0 || size >= r.max {
+		return size, delta, nil
+	}
+
+	target := size * 2
+	if target > r.max {
+		target = r.max
+	}
+	// kernel doubles the requested value to account for the bookkeeping overhead.
+	// SO_RCVBUFFORCE ignores net.core.rmem_max but needs CAP_NET_ADMIN
+	if err := unix.SetsockoptInt(r.fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, target/2); err != nil {
+		if err := unix.SetsockoptInt(r.fd, unix.SOL_SOCKET, unix.SO_RCVBUF, target/2); err != nil {
+			return size, delta, err
+		}
+	}
+	newSize, err := unix.GetsockoptInt(r.fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	if err != nil {
+		return size, delta, err
+	}
+	if newSize <= size {
+		log.Warningf("%d packets dropped on %s socket, but receive buffer can't grow past %d bytes. Check net.core.rmem_max", delta, r.name, size)
+		return size, delta, nil
+	}
+	log.Warningf("%d packets dropped on %s socket, receive buffer grown from %d to %d bytes", delta, r.name, size, newSize)
+	return newSize, delta, nil
+}
+
+// rcvBufs is a set of the receive buffer tuners of the server sockets
+type rcvBufs struct {
+	sync.Mutex
+	tuners []*rcvBufTuner
+}
+
+// registerRcvBuf starts monitoring and tuning of the socket receive buffer
+func (s *Server) registerRcvBuf(name string, fd int) {
+	t, err := newRcvBufTuner(name, fd, s.Config.RcvBufMax)
+	if err != nil {
+		log.Errorf("Failed to monitor drops on %s socket: %v", name, err)
+		return
+	}
+	s.rcvBufs.Lock()
+	s.rcvBufs.tuners = append(s.rcvBufs.tuners, t)
+	s.rcvBufs.Unlock()
+}
+
+// tuneRcvBufs grows receive buffers of the sockets dropping packets and reports their state
+func (s *Server) tuneRcvBufs() {
+	s.rcvBufs.Lock()
+	defer s.rcvBufs.Unlock()
+	for _, t := range s.rcvBufs.tuners {
+		size, drops, err := t.tune()
+		if err != nil {
+			log.Errorf("Failed to tune %s socket receive buffer: %v", t.name, err)
+		}
+		s.Stats.SetSocketRcvBuf(t.name, int64(size))
+		s.Stats.AddSocketDrops(t.name, drops)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// overflow fills the receive buffer of the connection until the kernel drops packets
+func overflow(t *testing.T, conn *net.UDPConn) {
+	sender, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer sender.Close()
+	buf := make([]byte, 1000)
+	for i := 0; i < 1000; i++ {
+		_, err := sender.Write(buf)
+		require.NoError(t, err)
+	}
+}
+
+func TestRcvBufTuner(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+	fd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 4096))
+	initial, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	require.NoError(t, err)
+
+	r, err := newRcvBufTuner("event", fd, 1<<20)
+	require.NoError(t, err)
+
+	// no drops, no growth
+	size, drops, err := r.tune()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), drops)
+	require.Equal(t, initial, size)
+
+	overflow(t, conn)
+	size, drops, err = r.tune()
+	require.NoError(t, err)
+	require.Greater(t, drops, int64(0))
+	require.Greater(t, size, initial)
+	require.LessOrEqual(t, size, 1<<20)
+
+	// drops are counted since the previous call
+	_, drops, err = r.tune()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), drops)
+}
+
+func TestRcvBufTunerDisabled(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+	fd, err := timestamp.ConnFd(conn)
+	require.NoError(t, err)
+	require.NoError(t, unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 4096))
+	initial, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	require.NoError(t, err)
+
+	r, err := newRcvBufTuner("general", fd, 0)
+	require.NoError(t, err)
+
+	overflow(t, conn)
+	size, drops, err := r.tune()
+	require.NoError(t, err)
+	require.Greater(t, drops, int64(0))
+	require.Equal(t, initial, size)
+}
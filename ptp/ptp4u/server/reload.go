@@ -0,0 +1,361 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/ptp/policy"
+	"github.com/facebook/time/ptp/ptp4u/drain"
+	"github.com/facebook/time/ptp/ptp4u/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// rollbackCheckInterval is how often health is checked after the config change
+var rollbackCheckInterval = time.Second
+
+// maxConfigSize limits the config accepted over HTTP
+const maxConfigSize = 1 << 20
+
+// Validate checks the dynamic config can be applied
+func (dc *DynamicConfig) Validate() error {
+	if err := dc.UTCOffsetSanity(); err != nil {
+		return err
+	}
+	if dc.DrainInterval <= 0 {
+		return fmt.Errorf("drain interval must be positive")
+	}
+	if dc.MetricInterval <= 0 {
+		return fmt.Errorf("metric interval must be positive")
+	}
+	if dc.MinSubInterval <= 0 {
+		return fmt.Errorf("min subscription interval must be positive")
+	}
+	if dc.MaxSubDuration <= 0 {
+		return fmt.Errorf("max subscription duration must be positive")
+	}
+	// 255 is reserved for clocks which never become the grandmaster
+	if dc.Priority1 != nil && *dc.Priority1 == 255 {
+		return fmt.Errorf("priority1 255 is reserved for slave-only clocks")
+	}
+	if err := dc.validateCompat(); err != nil {
+		return err
+	}
+	return dc.validateSchedule()
+}
+
+// applyDynamicConfig validates and atomically applies the dynamic config.
+// If health checks fail within the rollback window the previous config is restored
+func (s *Server) applyDynamicConfig(dc *DynamicConfig) error {
+	if err := dc.Validate(); err != nil {
+		return err
+	}
+
+	dcMux.Lock()
+	prev := s.Config.DynamicConfig
+	s.Config.DynamicConfig = *dc
+	gen := atomic.AddInt64(&s.configGeneration, 1)
+	dcMux.Unlock()
+	log.Infof("Applied config generation %d", gen)
+	s.auditPriorities(&prev, dc, gen)
+	s.record(&events.Event{
+		Type:    events.TypeConfig,
+		Message: fmt.Sprintf("config generation %d applied", gen),
+		Fields:  map[string]int64{"generation": gen},
+	})
+
+	if s.Config.RollbackWindow > 0 {
+		go s.watchHealth(gen, prev)
+	}
+	return nil
+}
+
+// auditPriorities logs and records changes of the announced priorities, which move clients between grandmasters
+func (s *Server) auditPriorities(prev, next *DynamicConfig, gen int64) {
+	c := Config{StaticConfig: s.Config.StaticConfig}
+	c.DynamicConfig = *prev
+	prev1, prev2 := c.Priorities()
+	c.DynamicConfig = *next
+	next1, next2 := c.Priorities()
+	if prev1 == next1 && prev2 == next2 {
+		return
+	}
+	log.Warningf("Announced priorities changed from %d/%d to %d/%d by config generation %d", prev1, prev2, next1, next2, gen)
+	s.record(&events.Event{
+		Type:    events.TypeConfig,
+		Message: fmt.Sprintf("priorities changed from %d/%d to %d/%d", prev1, prev2, next1, next2),
+		Fields:  map[string]int64{"generation": gen, "priority1": int64(next1), "priority2": int64(next2)},
+	})
+}
+
+// watchHealth rolls back to prev if the server becomes unhealthy within the rollback window
+func (s *Server) watchHealth(gen int64, prev DynamicConfig) {
+	deadline := time.Now().Add(s.Config.RollbackWindow)
+	for time.Now().Before(deadline) {
+		time.Sleep(rollbackCheckInterval)
+		err := s.healthCheck()
+		if err == nil {
+			continue
+		}
+
+		dcMux.Lock()
+		defer dcMux.Unlock()
+		// Newer config is someone else's responsibility
+		if atomic.LoadInt64(&s.configGeneration) != gen {
+			return
+		}
+		failed := s.Config.DynamicConfig
+		s.Config.DynamicConfig = prev
+		gen = atomic.AddInt64(&s.configGeneration, 1)
+		log.Errorf("Health check failed after config change: %v. Rolled back as generation %d", err, gen)
+		s.auditPriorities(&failed, &prev, gen)
+		s.Stats.IncConfigRollback()
+		s.record(&events.Event{
+			Type:    events.TypeConfig,
+			Message: fmt.Sprintf("config rolled back as generation %d: %v", gen, err),
+			Fields:  map[string]int64{"generation": gen},
+		})
+		// the failed config may be persisted already, it must not come back with the restart
+		if err := s.persistDynamicConfig(&prev); err != nil {
+			log.Errorf("Failed to persist the rolled back config: %v", err)
+		}
+		return
+	}
+}
+
+// healthCheck returns an error if server is not healthy.
+// The drain file and the manual drain are operator decisions rather than failures, so they don't count
+func (s *Server) healthCheck() error {
+	for _, check := range s.Checks {
+		switch check.(type) {
+		case *drain.FileDrain, *drain.ManualDrain:
+			continue
+		}
+		if check.Check() {
+			return fmt.Errorf("%T engaged", check)
+		}
+	}
+	if s.Config.timeSrc != nil {
+		if _, err := s.Config.timeSrc.Now(); err != nil {
+			return fmt.Errorf("reading time source: %w", err)
+		}
+	}
+	return nil
+}
+
+// reloadConfig applies the dynamic config from the config file and reloads tenants, acl, auth keys and blocklist
+func (s *Server) reloadConfig() error {
+	dc, err := ReadDynamicConfig(s.Config.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+	if err := s.applyDynamicConfig(dc); err != nil {
+		return fmt.Errorf("failed to apply config: %w", err)
+	}
+
+	if s.Config.tenants != nil {
+		tenants, err := ReadTenants(s.Config.TenantsFile)
+		if err != nil {
+			log.Errorf("Failed to reload tenants: %v. Keeping the old ones", err)
+		} else {
+			s.Config.tenants.update(tenants)
+		}
+	}
+
+	if s.Config.acl != nil {
+		acl, err := ReadACL(s.Config.ACLFile)
+		if err != nil {
+			log.Errorf("Failed to reload acl: %v. Keeping the old one", err)
+		} else {
+			s.Config.acl.update(acl)
+		}
+	}
+
+	if s.Config.policy != nil {
+		p, err := policy.Read(s.Config.PolicyFile)
+		if err != nil {
+			log.Errorf("Failed to reload policy: %v. Keeping the old one", err)
+		} else {
+			s.Config.policy.update(p)
+		}
+	}
+
+	if s.Config.auth != nil {
+		ac, err := ReadAuthConfig(s.Config.AuthFile)
+		if err != nil {
+			log.Errorf("Failed to reload auth config: %v. Keeping the old one", err)
+		} else {
+			s.Config.auth.update(ac)
+		}
+	}
+
+	if s.Config.BlocklistFile != "" {
+		blocked, err := ReadBlocklist(s.Config.BlocklistFile)
+		if err != nil {
+			log.Errorf("Failed to reload blocklist: %v. Keeping the old one", err)
+		} else {
+			s.blocklist.update(blocked)
+		}
+	}
+
+	s.Stats.IncReload()
+	return nil
+}
+
+// configWatcher detects changes of the config file content.
+// Content rather than mtime is compared, so rolled back config is not reapplied until the file changes again
+type configWatcher struct {
+	sync.Mutex
+	path string
+	last []byte
+}
+
+func newConfigWatcher(path string) *configWatcher {
+	w := &configWatcher{path: path}
+	w.last, _ = os.ReadFile(path)
+	return w
+}
+
+// changed checks if the file content differs from the last seen one
+func (w *configWatcher) changed() (bool, error) {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return false, err
+	}
+	w.Lock()
+	defer w.Unlock()
+	if bytes.Equal(data, w.last) {
+		return false, nil
+	}
+	w.last = data
+	return true, nil
+}
+
+// seen marks the file content written by ptp4u itself as known
+func (w *configWatcher) seen(data []byte) {
+	w.Lock()
+	defer w.Unlock()
+	w.last = data
+}
+
+// watchConfig reloads the config when the config file changes
+func (s *Server) watchConfig() {
+	log.Infof("Watching %s for changes every %v", s.Config.ConfigFile, s.Config.ConfigWatchInterval)
+	for range time.Tick(s.Config.ConfigWatchInterval) {
+		changed, err := s.configWatch.changed()
+		if err != nil {
+			log.Errorf("Failed to check config: %v", err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		log.Info("Config file changed, reloading config")
+		if err := s.reloadConfig(); err != nil {
+			log.Errorf("%v. Moving on", err)
+		}
+	}
+}
+
+// ReadConfigToken reads the token authorizing config changes over HTTP
+func ReadConfigToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty config token in %s", path)
+	}
+	return token, nil
+}
+
+// authorized checks the request carries the config token
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return s.configToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.configToken)) == 1
+}
+
+// handleConfig applies the dynamic config POSTed with the bearer token.
+// Applied config is written to the config file, so it survives the restart
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		log.Warningf("Unauthorized config change from %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dc, err := ParseDynamicConfig(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.applyDynamicConfig(dc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Warningf("Config generation %d applied via HTTP from %s", s.ConfigGeneration(), r.RemoteAddr)
+	s.Stats.IncReload()
+
+	if err := s.persistDynamicConfig(dc); err != nil {
+		// the config is applied, but won't survive the restart
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "applied config generation %d\n", s.ConfigGeneration())
+}
+
+// CurrentDynamicConfig returns a copy of the applied dynamic config
+func (s *Server) CurrentDynamicConfig() *DynamicConfig {
+	dcMux.Lock()
+	defer dcMux.Unlock()
+	dc := s.Config.DynamicConfig
+	dc.Schedule = append([]ScheduledChange(nil), dc.Schedule...)
+	return &dc
+}
+
+// UpdateDynamicConfig applies the dynamic config computed in the same process, e.g. by the clock quality
+// calculator of the unified daemon. Applied config is written to the config file, so it survives the restart
+func (s *Server) UpdateDynamicConfig(dc *DynamicConfig) error {
+	if err := s.applyDynamicConfig(dc); err != nil {
+		return err
+	}
+	s.Stats.IncReload()
+	return s.persistDynamicConfig(dc)
+}
+
+// ConfigGeneration returns the generation of the applied dynamic config
+func (s *Server) ConfigGeneration() int64 {
+	return atomic.LoadInt64(&s.configGeneration)
+}
@@ -0,0 +1,256 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/drain"
+	"github.com/facebook/time/ptp/ptp4u/events"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+type testCheck struct {
+	engaged int32
+}
+
+func (c *testCheck) Check() bool {
+	return atomic.LoadInt32(&c.engaged) == 1
+}
+
+func validDynamicConfig() *DynamicConfig {
+	return &DynamicConfig{
+		ClockClass:     6,
+		DrainInterval:  time.Second,
+		MaxSubDuration: time.Hour,
+		MetricInterval: time.Minute,
+		MinSubInterval: time.Second,
+		UTCOffset:      37 * time.Second,
+	}
+}
+
+func TestDynamicConfigValidate(t *testing.T) {
+	dc := validDynamicConfig()
+	require.NoError(t, dc.Validate())
+
+	dc.MetricInterval = 0
+	require.Error(t, dc.Validate())
+
+	dc = validDynamicConfig()
+	dc.UTCOffset = 0
+	require.ErrorIs(t, dc.Validate(), errInsaneUTCoffset)
+
+	dc = validDynamicConfig()
+	p := uint8(255)
+	dc.Priority1 = &p
+	require.Error(t, dc.Validate())
+	dc.Priority1, dc.Priority2 = nil, &p
+	require.NoError(t, dc.Validate())
+}
+
+func TestApplyDynamicConfigPriorities(t *testing.T) {
+	s := &Server{
+		Config:   &Config{DynamicConfig: *validDynamicConfig(), StaticConfig: StaticConfig{DefaultPriority1: 128, DefaultPriority2: 128}},
+		Stats:    stats.NewJSONStats(),
+		timeline: events.NewTimeline(10),
+	}
+
+	dc := validDynamicConfig()
+	dc.ClockClass = 7
+	require.NoError(t, s.applyDynamicConfig(dc))
+	require.Len(t, s.timeline.Events(time.Time{}, events.TypeConfig, 0), 1)
+
+	dc = validDynamicConfig()
+	p := uint8(100)
+	dc.Priority1 = &p
+	require.NoError(t, s.applyDynamicConfig(dc))
+	priority1, priority2 := s.Config.Priorities()
+	require.Equal(t, uint8(100), priority1)
+	require.Equal(t, uint8(128), priority2)
+
+	var audit []events.Event
+	for _, e := range s.timeline.Events(time.Time{}, events.TypeConfig, 0) {
+		if strings.HasPrefix(e.Message, "priorities") {
+			audit = append(audit, e)
+		}
+	}
+	require.Len(t, audit, 1)
+	require.Equal(t, "priorities changed from 128/128 to 100/128", audit[0].Message)
+	require.Equal(t, int64(2), audit[0].Fields["generation"])
+}
+
+func TestApplyDynamicConfig(t *testing.T) {
+	s := &Server{Config: &Config{DynamicConfig: *validDynamicConfig()}, Stats: stats.NewJSONStats()}
+
+	dc := validDynamicConfig()
+	dc.ClockClass = 7
+	require.NoError(t, s.applyDynamicConfig(dc))
+	require.Equal(t, *dc, s.Config.DynamicConfig)
+	require.Equal(t, int64(1), s.ConfigGeneration())
+
+	dc = validDynamicConfig()
+	dc.MinSubInterval = 0
+	require.Error(t, s.applyDynamicConfig(dc))
+	require.Equal(t, int64(1), s.ConfigGeneration())
+}
+
+func TestApplyDynamicConfigRollback(t *testing.T) {
+	rollbackCheckInterval = time.Millisecond
+	check := &testCheck{}
+	prev := validDynamicConfig()
+	path := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	s := &Server{
+		Config: &Config{DynamicConfig: *prev, StaticConfig: StaticConfig{RollbackWindow: time.Second, ConfigFile: path}},
+		Stats:  stats.NewJSONStats(),
+		Checks: []drain.Drain{check},
+	}
+
+	dc := validDynamicConfig()
+	dc.ClockClass = 7
+	require.NoError(t, s.UpdateDynamicConfig(dc))
+	atomic.StoreInt32(&check.engaged, 1)
+
+	require.Eventually(t, func() bool {
+		return s.ConfigGeneration() == 2
+	}, time.Second, time.Millisecond)
+	dcMux.Lock()
+	require.Equal(t, *prev, s.Config.DynamicConfig)
+	dcMux.Unlock()
+
+	// restart doesn't apply the failed config again
+	persisted, err := ReadDynamicConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, prev.ClockClass, persisted.ClockClass)
+}
+
+func TestHealthCheckFileDrain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "drain")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	check := &testCheck{}
+	manual := &drain.ManualDrain{}
+	manual.Set(true)
+	s := &Server{
+		Config: &Config{},
+		Checks: []drain.Drain{&drain.FileDrain{FileName: file}, manual, check},
+	}
+
+	// drained on purpose, by the file or the manual drain, is healthy
+	require.NoError(t, s.healthCheck())
+
+	atomic.StoreInt32(&check.engaged, 1)
+	require.Error(t, s.healthCheck())
+}
+
+func TestConfigWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	require.NoError(t, validDynamicConfig().Write(path))
+
+	w := newConfigWatcher(path)
+	changed, err := w.changed()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	dc := validDynamicConfig()
+	dc.ClockClass = 7
+	require.NoError(t, dc.Write(path))
+	changed, err = w.changed()
+	require.NoError(t, err)
+	require.True(t, changed)
+	changed, err = w.changed()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	dc.ClockClass = 52
+	require.NoError(t, dc.Write(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	w.seen(data)
+	changed, err = w.changed()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	require.NoError(t, os.Remove(path))
+	_, err = w.changed()
+	require.Error(t, err)
+}
+
+func TestReadConfigToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0600))
+	token, err := ReadConfigToken(path)
+	require.NoError(t, err)
+	require.Equal(t, "secret", token)
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0600))
+	_, err = ReadConfigToken(path)
+	require.Error(t, err)
+}
+
+func TestHandleConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	require.NoError(t, validDynamicConfig().Write(path))
+	s := &Server{
+		Config:      &Config{DynamicConfig: *validDynamicConfig(), StaticConfig: StaticConfig{ConfigFile: path}},
+		Stats:       stats.NewJSONStats(),
+		configToken: "secret",
+		configWatch: newConfigWatcher(path),
+	}
+
+	dc := validDynamicConfig()
+	dc.ClockClass = 7
+	require.NoError(t, dc.Write(path))
+	body, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, validDynamicConfig().Write(path))
+
+	post := func(method, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/config", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.handleConfig(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusMethodNotAllowed, post(http.MethodGet, "secret", "").Code)
+	require.Equal(t, http.StatusUnauthorized, post(http.MethodPost, "", string(body)).Code)
+	require.Equal(t, http.StatusUnauthorized, post(http.MethodPost, "wrong", string(body)).Code)
+	require.Equal(t, http.StatusBadRequest, post(http.MethodPost, "secret", "clockclass: [").Code)
+	require.Equal(t, int64(0), s.ConfigGeneration())
+
+	w := post(http.MethodPost, "secret", string(body))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "generation 1")
+	require.Equal(t, *dc, s.Config.DynamicConfig)
+
+	// written config is persisted and not picked up by the watcher again
+	written, err := ReadDynamicConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, dc, written)
+	changed, err := s.configWatch.changed()
+	require.NoError(t, err)
+	require.False(t, changed)
+}
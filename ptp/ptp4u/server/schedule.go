@@ -0,0 +1,337 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduleCheckInterval is how often the schedule is checked for due changes
+var scheduleCheckInterval = time.Second
+
+// ScheduledChange is a dynamic config change applied at the given time.
+// Unset fields are left as they are at that time
+type ScheduledChange struct {
+	// ID identifies the change for cancellation
+	ID string `json:"id"`
+	// At is when the change is applied
+	At            time.Time          `json:"at"`
+	ClockAccuracy *ptp.ClockAccuracy `json:"clock_accuracy,omitempty" yaml:",omitempty"`
+	ClockClass    *ptp.ClockClass    `json:"clock_class,omitempty" yaml:",omitempty"`
+	// Drain engages (true) or releases (false) the graceful drain
+	Drain          *bool          `json:"drain,omitempty" yaml:",omitempty"`
+	MaxSubDuration *time.Duration `json:"max_sub_duration,omitempty" yaml:",omitempty"`
+	MinSubInterval *time.Duration `json:"min_sub_interval,omitempty" yaml:",omitempty"`
+	Priority1      *uint8         `json:"priority1,omitempty" yaml:",omitempty"`
+	Priority2      *uint8         `json:"priority2,omitempty" yaml:",omitempty"`
+	UTCOffset      *time.Duration `json:"utc_offset,omitempty" yaml:",omitempty"`
+}
+
+// scheduledKey identifies the applied change
+type scheduledKey struct {
+	id string
+	at int64
+}
+
+func (c *ScheduledChange) key() scheduledKey {
+	return scheduledKey{id: c.ID, at: c.At.UnixNano()}
+}
+
+// apply returns the config with the change applied, without the change in the schedule
+func (c *ScheduledChange) apply(dc DynamicConfig) DynamicConfig {
+	if c.ClockAccuracy != nil {
+		dc.ClockAccuracy = *c.ClockAccuracy
+	}
+	if c.ClockClass != nil {
+		dc.ClockClass = *c.ClockClass
+	}
+	if c.MaxSubDuration != nil {
+		dc.MaxSubDuration = *c.MaxSubDuration
+	}
+	if c.MinSubInterval != nil {
+		dc.MinSubInterval = *c.MinSubInterval
+	}
+	if c.Priority1 != nil {
+		dc.Priority1 = c.Priority1
+	}
+	if c.Priority2 != nil {
+		dc.Priority2 = c.Priority2
+	}
+	if c.UTCOffset != nil {
+		dc.UTCOffset = *c.UTCOffset
+	}
+	dc.Schedule = withoutChange(dc.Schedule, c.ID)
+	return dc
+}
+
+// validateSchedule checks the scheduled changes have unique IDs and produce a valid config
+func (dc *DynamicConfig) validateSchedule() error {
+	ids := map[string]bool{}
+	for i := range dc.Schedule {
+		c := &dc.Schedule[i]
+		if c.ID == "" {
+			return fmt.Errorf("scheduled change at %v has no id", c.At)
+		}
+		if ids[c.ID] {
+			return fmt.Errorf("duplicate scheduled change id %q", c.ID)
+		}
+		ids[c.ID] = true
+		if c.At.IsZero() {
+			return fmt.Errorf("scheduled change %s has no time", c.ID)
+		}
+		if c.ClockAccuracy == nil && c.ClockClass == nil && c.Drain == nil &&
+			c.MaxSubDuration == nil && c.MinSubInterval == nil && c.Priority1 == nil && c.Priority2 == nil && c.UTCOffset == nil {
+			return fmt.Errorf("scheduled change %s changes nothing", c.ID)
+		}
+		next := c.apply(*dc)
+		next.Schedule = nil
+		if err := next.Validate(); err != nil {
+			return fmt.Errorf("scheduled change %s: %w", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// withoutChange returns a copy of the schedule without the change
+func withoutChange(schedule []ScheduledChange, id string) []ScheduledChange {
+	var rest []ScheduledChange
+	for _, c := range schedule {
+		if c.ID != id {
+			rest = append(rest, c)
+		}
+	}
+	return rest
+}
+
+// dueChange returns the earliest change due at now
+func dueChange(schedule []ScheduledChange, now time.Time) (*ScheduledChange, bool) {
+	var due *ScheduledChange
+	for i := range schedule {
+		c := &schedule[i]
+		if c.At.After(now) {
+			continue
+		}
+		if due == nil || c.At.Before(due.At) {
+			due = c
+		}
+	}
+	return due, due != nil
+}
+
+// pendingChanges returns the scheduled changes ordered by time
+func (s *Server) pendingChanges() []ScheduledChange {
+	dcMux.Lock()
+	pending := append([]ScheduledChange{}, s.Config.Schedule...)
+	dcMux.Unlock()
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].At.Before(pending[j].At) })
+	return pending
+}
+
+// updateSchedule applies the config with the schedule changed by update and persists it
+func (s *Server) updateSchedule(update func(dc *DynamicConfig) error) error {
+	dcMux.Lock()
+	dc := s.Config.DynamicConfig
+	dcMux.Unlock()
+	dc.Schedule = append([]ScheduledChange{}, dc.Schedule...)
+	if err := update(&dc); err != nil {
+		return err
+	}
+	if err := s.applyDynamicConfig(&dc); err != nil {
+		return err
+	}
+	return s.persistDynamicConfig(&dc)
+}
+
+// applyDueChanges applies the changes due at now in their order
+func (s *Server) applyDueChanges(now time.Time) {
+	s.scheduleMux.Lock()
+	defer s.scheduleMux.Unlock()
+	for {
+		dcMux.Lock()
+		change, ok := dueChange(s.Config.Schedule, now)
+		dcMux.Unlock()
+		if !ok {
+			return
+		}
+		c := *change
+		if s.appliedChanges[c.key()] {
+			// config with the change failed health checks and was rolled back
+			log.Warningf("Scheduled change %s was rolled back, dropping it", c.ID)
+			dcMux.Lock()
+			s.Config.Schedule = withoutChange(s.Config.Schedule, c.ID)
+			dcMux.Unlock()
+			// the rollback persisted the schedule with the change still pending
+			if err := s.persistDynamicConfig(s.CurrentDynamicConfig()); err != nil {
+				log.Errorf("Failed to persist the schedule without change %s: %v", c.ID, err)
+			}
+			continue
+		}
+		s.appliedChanges[c.key()] = true
+		err := s.updateSchedule(func(dc *DynamicConfig) error {
+			*dc = c.apply(*dc)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("Failed to apply scheduled change %s: %v", c.ID, err)
+		}
+		if s.changePending(c.ID) {
+			// invalid change is dropped so it's not retried forever
+			dcMux.Lock()
+			s.Config.Schedule = withoutChange(s.Config.Schedule, c.ID)
+			dcMux.Unlock()
+			continue
+		}
+		log.Warningf("Applied scheduled change %s due at %v as config generation %d", c.ID, c.At, s.ConfigGeneration())
+		if c.Drain != nil {
+			if *c.Drain {
+				s.GracefulDrain(false)
+			} else {
+				s.GracefulUndrain()
+			}
+		}
+	}
+}
+
+// changePending checks the change is in the running schedule
+func (s *Server) changePending(id string) bool {
+	dcMux.Lock()
+	defer dcMux.Unlock()
+	for _, c := range s.Config.Schedule {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// startSchedule applies scheduled changes when they are due
+func (s *Server) startSchedule() {
+	clock := s.Config.Clock()
+	for now := range time.Tick(clock.Wall(scheduleCheckInterval)) {
+		s.applyDueChanges(clock.At(now))
+	}
+}
+
+// scheduleChange adds the change to the schedule. Empty ID is generated
+func (s *Server) scheduleChange(c ScheduledChange) (ScheduledChange, error) {
+	s.scheduleMux.Lock()
+	defer s.scheduleMux.Unlock()
+	err := s.updateSchedule(func(dc *DynamicConfig) error {
+		if c.ID == "" {
+			c.ID = nextChangeID(dc.Schedule, c.At)
+		}
+		dc.Schedule = append(dc.Schedule, c)
+		return nil
+	})
+	return c, err
+}
+
+// cancelChange removes the pending change from the schedule
+func (s *Server) cancelChange(id string) (bool, error) {
+	s.scheduleMux.Lock()
+	defer s.scheduleMux.Unlock()
+	found := false
+	err := s.updateSchedule(func(dc *DynamicConfig) error {
+		rest := withoutChange(dc.Schedule, id)
+		found = len(rest) != len(dc.Schedule)
+		if !found {
+			return fmt.Errorf("no scheduled change %s", id)
+		}
+		dc.Schedule = rest
+		return nil
+	})
+	if !found {
+		return false, nil
+	}
+	return true, err
+}
+
+// nextChangeID returns an unused ID derived from the change time
+func nextChangeID(schedule []ScheduledChange, at time.Time) string {
+	base := at.UTC().Format("20060102T150405Z")
+	for i := 0; ; i++ {
+		id := base
+		if i > 0 {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		if len(withoutChange(schedule, id)) == len(schedule) {
+			return id
+		}
+	}
+}
+
+// handleMgmtSchedule lists (GET), adds (POST) or cancels (DELETE with the id query) scheduled config changes
+func (s *Server) handleMgmtSchedule(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var c ScheduledChange
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !c.At.After(s.Config.Clock().Now()) {
+			http.Error(w, fmt.Sprintf("scheduled time %v is not in the future", c.At), http.StatusBadRequest)
+			return
+		}
+		c, err := s.scheduleChange(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Warningf("Change %s scheduled at %v via management API", c.ID, c.At)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		found, err := s.cancelChange(id)
+		if !found {
+			http.Error(w, fmt.Sprintf("no scheduled change %s", id), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Warningf("Scheduled change %s cancelled via management API", id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mgmtReply(w, r, s.pendingChanges())
+}
+
+// persistDynamicConfig writes the applied config to the config file, so it survives the restart
+func (s *Server) persistDynamicConfig(dc *DynamicConfig) error {
+	if s.Config.ConfigFile == "" {
+		return nil
+	}
+	if err := dc.Write(s.Config.ConfigFile); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+	if s.configWatch != nil {
+		written, _ := os.ReadFile(s.Config.ConfigFile)
+		s.configWatch.seen(written)
+	}
+	return nil
+}
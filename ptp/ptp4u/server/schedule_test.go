@@ -0,0 +1,135 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	offset := 38 * time.Second
+	dc := validDynamicConfig()
+	dc.Schedule = []ScheduledChange{{ID: "leap", At: time.Now(), UTCOffset: &offset}}
+	require.NoError(t, dc.Validate())
+
+	dc.Schedule = append(dc.Schedule, ScheduledChange{ID: "leap", At: time.Now(), UTCOffset: &offset})
+	require.Error(t, dc.Validate())
+
+	dc.Schedule = []ScheduledChange{{At: time.Now(), UTCOffset: &offset}}
+	require.Error(t, dc.Validate())
+
+	dc.Schedule = []ScheduledChange{{ID: "noop", At: time.Now()}}
+	require.Error(t, dc.Validate())
+
+	insane := time.Second
+	dc.Schedule = []ScheduledChange{{ID: "insane", At: time.Now(), UTCOffset: &insane}}
+	require.ErrorIs(t, dc.Validate(), errInsaneUTCoffset)
+}
+
+func TestScheduleParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	offset := 38 * time.Second
+	class := ptp.ClockClass7
+	drain := true
+	dc := validDynamicConfig()
+	dc.Schedule = []ScheduledChange{
+		{ID: "leap", At: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), UTCOffset: &offset},
+		{ID: "maintenance", At: time.Date(2027, 1, 2, 2, 0, 0, 0, time.UTC), ClockClass: &class, Drain: &drain},
+	}
+	require.NoError(t, dc.Write(path))
+	read, err := ReadDynamicConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, dc, read)
+}
+
+func TestApplyDueChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ptp4u.yaml")
+	now := time.Now().UTC().Round(0)
+	offset := 38 * time.Second
+	drain := true
+	dc := validDynamicConfig()
+	dc.Schedule = []ScheduledChange{
+		{ID: "drain", At: now.Add(time.Minute), Drain: &drain},
+		{ID: "leap", At: now, UTCOffset: &offset},
+	}
+	s := &Server{
+		Config:         &Config{DynamicConfig: *dc, StaticConfig: StaticConfig{ConfigFile: path}},
+		Stats:          stats.NewJSONStats(),
+		appliedChanges: map[scheduledKey]bool{},
+	}
+
+	s.applyDueChanges(now.Add(-time.Second))
+	require.Equal(t, int64(0), s.ConfigGeneration())
+
+	s.applyDueChanges(now)
+	require.Equal(t, int64(1), s.ConfigGeneration())
+	require.Equal(t, offset, s.Config.UTCOffset)
+	require.Equal(t, []ScheduledChange{dc.Schedule[0]}, s.pendingChanges())
+	require.False(t, s.Drained())
+	written, err := ReadDynamicConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, s.Config.DynamicConfig, *written)
+
+	s.applyDueChanges(now.Add(time.Minute))
+	require.Equal(t, int64(2), s.ConfigGeneration())
+	require.True(t, s.Drained())
+	require.Empty(t, s.pendingChanges())
+
+	// rolled back config brings the applied change back
+	dcMux.Lock()
+	s.Config.DynamicConfig = *dc
+	dcMux.Unlock()
+	s.applyDueChanges(now.Add(time.Minute))
+	require.Equal(t, int64(2), s.ConfigGeneration())
+	require.Empty(t, s.pendingChanges())
+	require.Equal(t, dc.UTCOffset, s.Config.UTCOffset)
+}
+
+func TestMgmtSchedule(t *testing.T) {
+	s := mgmtTestServer()
+	s.Config.DynamicConfig = *validDynamicConfig()
+	at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	pending := []ScheduledChange{}
+	body := `{"at":"` + at.Format(time.RFC3339) + `","utc_offset":38000000000}`
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/schedule", body, &pending))
+	require.Equal(t, 1, len(pending))
+	id := at.Format("20060102T150405Z")
+	require.Equal(t, id, pending[0].ID)
+	require.Equal(t, 38*time.Second, *pending[0].UTCOffset)
+
+	// same time gets a different ID
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodPost, "/schedule", `{"at":"`+at.Format(time.RFC3339)+`","drain":true}`, &pending))
+	require.Equal(t, 2, len(pending))
+	require.Equal(t, id+"-1", pending[1].ID)
+
+	require.Equal(t, http.StatusBadRequest, mgmtRequest(t, s, http.MethodPost, "/schedule", `{"at":"2020-01-01T00:00:00Z","drain":true}`, &pending))
+	require.Equal(t, http.StatusBadRequest, mgmtRequest(t, s, http.MethodPost, "/schedule", `{"at":"`+at.Format(time.RFC3339)+`","utc_offset":1}`, &pending))
+	require.Equal(t, http.StatusNotFound, mgmtRequest(t, s, http.MethodDelete, "/schedule?id=nope", "", &pending))
+
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodDelete, "/schedule?id="+id, "", &pending))
+	require.Equal(t, 1, len(pending))
+	require.Equal(t, id+"-1", pending[0].ID)
+	require.Equal(t, http.StatusOK, mgmtRequest(t, s, http.MethodGet, "/schedule", "", &pending))
+	require.Equal(t, 1, len(pending))
+}
@@ -24,12 +24,21 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/facebook/time/ptp/policy"
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/ptp/ptp4u/drain"
+	"github.com/facebook/time/ptp/ptp4u/events"
+	"github.com/facebook/time/ptp/ptp4u/ktrace"
+	"github.com/facebook/time/ptp/ptp4u/peer"
+	"github.com/facebook/time/ptp/ptp4u/seccomp"
+	"github.com/facebook/time/ptp/ptp4u/shmstats"
 	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
 	log "github.com/sirupsen/logrus"
@@ -41,11 +50,87 @@ type Server struct {
 	Config *Config
 	Stats  stats.Stats
 	Checks []drain.Drain
-	sw     []*sendWorker
+	// Tracer receives spans of signaling request traces. Nil disables spans
+	Tracer Tracer
+	// SeccompProbes exercise the periodic paths running next to the server in the seccomp self test
+	SeccompProbes []seccomp.Probe
 
-	// server source fds
-	eFd int
-	gFd int
+	sw []*sendWorker
+	// send worker of every client in the load assignment, assigned on the first lookup.
+	// Lookups of assigned clients don't lock, assignMux serializes the new assignments only
+	assignMux sync.Mutex
+	assigned  sync.Map
+
+	// last assigned signaling request ID
+	requestIDs uint64
+
+	// single scheduler used instead of per subscription tickers while there are few subscriptions
+	idle *idleScheduler
+
+	// client to server delay distribution per client prefix
+	pathDelays *pathDelays
+
+	// internal subscriptions measuring the send path
+	canaries []*canaryProbe
+
+	// send rate of the subscriptions against the FPS caps
+	fps fpsLimiter
+
+	// per-client error log rate limiter
+	logLimit *logLimiter
+
+	// clients whose requests are dropped
+	blocklist *blocklist
+
+	// cooperating ptp4u instances
+	peers *peer.Monitor
+
+	// NTP cross-check of the served time
+	ntpCheck *ntpChecker
+
+	// UTC offset consistency check
+	utcOffsetCheck *utcOffsetChecker
+
+	// generation of the applied dynamic config
+	configGeneration int64
+	// changes of the config file
+	configWatch *configWatcher
+	// token authorizing config changes over HTTP
+	configToken string
+	// serializes changes of the config schedule
+	scheduleMux sync.Mutex
+	// scheduled changes applied so far, so they are not applied again after a rollback
+	appliedChanges map[scheduledKey]bool
+
+	// drain requested via management API
+	manualDrain *drain.ManualDrain
+	drained     int32
+	// graceful drain requested via monitoring API
+	gracefulDrain int32
+	// last reported timestamping mode and NIC
+	timestamping stats.TimestampingInfo
+	// how the worker pool was sized at start
+	sizing stats.WorkerSizing
+
+	// receive buffers of the event and general sockets
+	rcvBufs rcvBufs
+
+	// graceful shutdown progress
+	shuttingDown      int32
+	shutdownPending   int64
+	shutdownCancelled int64
+
+	// event export
+	events     *events.Webhook
+	eventState eventState
+	// recent significant events served on the monitoring port
+	timeline *events.Timeline
+
+	// metric epochs, run periodically and on demand of the monitoring backend
+	epochMux       sync.Mutex
+	lastEpoch      time.Time
+	reportInterval time.Duration
+	gc             *gcSampler
 
 	// drain logic
 	cancel context.CancelFunc
@@ -71,6 +156,164 @@ func (s *Server) Start() error {
 		return fmt.Errorf("unable to get the Clock Identity (EUI-64 address) of the interface: %w", err)
 	}
 
+	// Path MTU may be lower than the interface one, e.g. because of tunnels
+	mtu := iface.MTU
+	if s.Config.MTU > 0 {
+		mtu = s.Config.MTU
+	}
+	s.Config.maxPacketSize = maxPacketSize(mtu, s.Config.IP)
+	log.Infof("Sending packets of up to %d bytes", s.Config.maxPacketSize)
+
+	// Set time source
+	s.Config.timeSrc, err = NewTimeSource(s.Config)
+	if err != nil {
+		return err
+	}
+	if sim, ok := s.Config.timeSrc.(*SimulatedTimeSource); ok && sim.clock.Rate() != 1 {
+		log.Warningf("Simulated time runs %v times faster than the wall clock, schedulers and expiry follow it", sim.clock.Rate())
+		s.Config.clock = sim.Clock(s.Config.UTCOffset)
+	}
+
+	if s.Config.LeapInterval > 0 {
+		s.Config.leap = newLeapSeconds(s.Config.LeapFile, s.Config.LeapSmear)
+		if err := s.Config.leap.load(); err != nil {
+			return fmt.Errorf("reading leap second file: %w", err)
+		}
+		s.applyLeapSeconds(s.Config.Clock().Now())
+		if s.Config.LeapSmear > 0 {
+			s.Config.timeSrc = &smearTimeSource{TimeSource: s.Config.timeSrc, leap: s.Config.leap, clock: s.Config.Clock()}
+		}
+	}
+
+	if s.Config.AltTimeZone != "" {
+		if s.Config.altTime, err = newAltTimeOffset(s.Config.AltTimeZone); err != nil {
+			return err
+		}
+		s.Config.altTime.update(s.Config.Clock().Now(), s.Config.UTCOffset)
+	}
+
+	if err := s.Config.initListeners(); err != nil {
+		return err
+	}
+
+	if s.Config.LogRate > 0 {
+		s.logLimit = newLogLimiter(s.Config.LogRate, s.Config.LogBurst)
+	}
+
+	if s.Config.PeerPort != 0 {
+		s.peers, err = s.newPeerMonitor()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.Config.NTPServers) > 0 {
+		s.ntpCheck = newNTPChecker(s.Config.NTPServers, s.Config.NTPMaxOffset, s.servedUTC)
+	}
+
+	if s.Config.UpstreamSocket != "" {
+		if s.Config.UpstreamDomain != s.Config.DomainNumber {
+			log.Infof("Translating upstream domain %d into domain %d", s.Config.UpstreamDomain, s.Config.DomainNumber)
+		}
+		s.Config.upstream = newUpstream(s.Config.UpstreamSocket, uint8(s.Config.UpstreamDomain), s.Config.UpstreamInterval/2)
+	}
+
+	if s.Config.ClockClassDwell > 0 {
+		rawClass, _ := s.Config.RawClockQuality()
+		s.Config.clockClass = newClockClassFilter(s.Config.ClockClassDwell, rawClass, s.Config.Clock().Now())
+	}
+
+	if s.Config.UTCOffsetCheckInterval > 0 {
+		s.utcOffsetCheck = newUTCOffsetChecker(s.Config.LeapFile, s.advertisedUTCOffset)
+	}
+
+	if s.Config.TenantsFile != "" {
+		tenants, err := ReadTenants(s.Config.TenantsFile)
+		if err != nil {
+			return fmt.Errorf("reading tenants: %w", err)
+		}
+		s.Config.tenants = newTenantSet(tenants)
+	}
+
+	if s.Config.ACLFile != "" {
+		acl, err := ReadACL(s.Config.ACLFile)
+		if err != nil {
+			return fmt.Errorf("reading acl: %w", err)
+		}
+		s.Config.acl = newAccessControl(acl)
+	}
+
+	if s.Config.PolicyFile != "" {
+		p, err := policy.Read(s.Config.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("reading policy: %w", err)
+		}
+		s.Config.policy = &grantPolicy{policy: p}
+	}
+
+	if s.Config.AuthFile != "" {
+		ac, err := ReadAuthConfig(s.Config.AuthFile)
+		if err != nil {
+			return fmt.Errorf("reading auth config: %w", err)
+		}
+		s.Config.auth = newMessageAuth(ac)
+	}
+
+	blocked := []*BlockEntry{}
+	if s.Config.BlocklistFile != "" {
+		blocked, err = ReadBlocklist(s.Config.BlocklistFile)
+		if err != nil {
+			return fmt.Errorf("reading blocklist: %w", err)
+		}
+	}
+	s.blocklist = newBlocklist(s.Config.BlocklistFile, blocked)
+
+	if s.Config.ConfigFile != "" && s.Config.ConfigWatchInterval > 0 {
+		s.configWatch = newConfigWatcher(s.Config.ConfigFile)
+		go s.watchConfig()
+	}
+
+	if s.Config.ConfigTokenFile != "" {
+		s.configToken, err = ReadConfigToken(s.Config.ConfigTokenFile)
+		if err != nil {
+			return fmt.Errorf("reading config token: %w", err)
+		}
+		s.Stats.Handle("/config", http.HandlerFunc(s.handleConfig))
+		s.Stats.Handle("/drain", http.HandlerFunc(s.handleDrain))
+	}
+
+	if s.Config.TimelineSize > 0 {
+		s.timeline = events.NewTimeline(s.Config.TimelineSize)
+		s.Stats.Handle("/timeline", s.timeline)
+	}
+
+	if s.Config.EventsURL != "" {
+		s.events = events.NewWebhook(s.Config.EventsURL, s.Config.EventsBatchSize, s.Config.EventsFlushInterval)
+		go s.events.Run(context.Background())
+	}
+
+	if s.Config.IdleSubscriptions > 0 {
+		s.idle = newIdleScheduler(s.Config.Clock())
+		go s.idle.Start(context.Background())
+	}
+
+	if s.Config.PathDelay {
+		s.pathDelays = newPathDelays(s.Config.PathDelayPrefix4, s.Config.PathDelayPrefix6)
+	}
+
+	if s.Config.DebugTapFile != "" {
+		s.Config.tap, err = newDebugTap(s.Config.DebugTapFile, s.Config.DebugTapSample, s.Config.DebugTapMaxSize)
+		if err != nil {
+			return fmt.Errorf("starting debug tap: %w", err)
+		}
+		defer s.Config.tap.Close()
+	}
+
+	if s.Config.MgmtSocket != "" {
+		s.manualDrain = &drain.ManualDrain{}
+		s.Checks = append(s.Checks, s.manualDrain)
+	}
+
 	// initialize the context for the subscriptions
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 
@@ -80,24 +323,143 @@ func (s *Server) Start() error {
 	fail := make(chan bool)
 
 	// start X workers
+	s.sizeWorkers(readTopology(s.Config.Interface))
 	s.sw = make([]*sendWorker, s.Config.SendWorkers)
 	for i := 0; i < s.Config.SendWorkers; i++ {
 		// Each worker to monitor own queue
-		s.sw[i] = newSendWorker(i, s.Config, s.Stats)
+		s.sw[i] = newSendWorker(i, s.Config, s.Stats.Shard())
 		go func(i int) {
 			s.sw[i].Start()
+			s.record(&events.Event{
+				Type:    events.TypeWorker,
+				Message: fmt.Sprintf("send worker %d stopped", i),
+				Fields:  map[string]int64{"worker": int64(i)},
+			})
 			fail <- true
 		}(i)
 	}
 
+	for _, l := range s.Config.listeners {
+		go func(l *listener) {
+			s.startGeneralListener(l)
+			fail <- true
+		}(l)
+		go func(l *listener) {
+			s.startEventListener(l)
+			fail <- true
+		}(l)
+	}
+	if s.Config.Standby {
+		log.Warning("Standby mode: traffic is received and processed, but nothing is sent")
+	}
+	if len(s.Config.FPSCaps) > 0 || s.Config.FPSGlobalCap > 0 {
+		go s.startFPSLimiter()
+	}
+	if len(s.Config.CanaryTargets) > 0 && !s.Config.Standby {
+		if err := s.startCanaries(); err != nil {
+			return err
+		}
+	}
+	if s.Config.TunnelPort != 0 && !s.Config.Standby {
+		go func() {
+			s.startTunnelListener()
+			fail <- true
+		}()
+	}
+	if s.peers != nil {
+		go func() {
+			s.startPeerListener()
+			fail <- true
+		}()
+	}
+	if s.ntpCheck != nil {
+		go func() {
+			s.startNTPCheck()
+			fail <- true
+		}()
+	}
+	if s.utcOffsetCheck != nil {
+		go func() {
+			s.startUTCOffsetCheck()
+			fail <- true
+		}()
+	}
+	if s.Config.upstream != nil {
+		go func() {
+			s.startUpstreamCheck()
+			fail <- true
+		}()
+	}
+	if s.Config.leap != nil {
+		go func() {
+			s.startLeapSeconds()
+			fail <- true
+		}()
+	}
+	if s.Config.altTime != nil {
+		go func() {
+			s.startAltTimeOffset()
+			fail <- true
+		}()
+	}
+	s.appliedChanges = map[scheduledKey]bool{}
 	go func() {
-		s.startGeneralListener()
-		fail <- true
-	}()
-	go func() {
-		s.startEventListener()
+		s.startSchedule()
 		fail <- true
 	}()
+	if s.Config.MgmtSocket != "" {
+		go func() {
+			s.startMgmtListener()
+			fail <- true
+		}()
+	}
+
+	if s.Config.ShmStatsFile != "" {
+		w, err := shmstats.Create(s.Config.ShmStatsFile, shmstats.DefaultCapacity)
+		if err != nil {
+			return fmt.Errorf("creating shared memory stats: %w", err)
+		}
+		go s.startShmStats(w)
+	}
+
+	if s.Config.GNMIPort != 0 {
+		g, l, err := s.listenGNMI()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := g.Serve(l); err != nil {
+				log.Errorf("gNMI server failed: %v", err)
+			}
+			fail <- true
+		}()
+	}
+
+	// programs are loaded before the seccomp filter forbids the bpf syscall, the ring buffer is read without it
+	if s.Config.KernelTXTrace {
+		t, err := ktrace.New(os.Getpid())
+		if err != nil {
+			return fmt.Errorf("starting kernel TX latency tracer: %w", err)
+		}
+		defer t.Close()
+		go func() {
+			if err := t.Run(s.Stats.ObserveKernelTXLatency); err != nil {
+				log.Errorf("Kernel TX latency tracer failed: %v", err)
+			}
+			fail <- true
+		}()
+	}
+
+	// from here on ptp4u only needs the syscalls allowed by the filter
+	if s.Config.Seccomp != "" {
+		if err := seccomp.Apply(s.Config.Seccomp); err != nil {
+			return fmt.Errorf("applying seccomp filter: %w", err)
+		}
+		if err := seccomp.SelfTest(s.seccompProbes()...); err != nil {
+			return fmt.Errorf("seccomp self test: %w", err)
+		}
+		log.Infof("Seccomp filter applied in %s mode", s.Config.Seccomp)
+	}
 
 	// Drain check
 	go func() {
@@ -120,9 +482,11 @@ func (s *Server) Start() error {
 				log.Warningf("shifting traffic")
 				s.Drain()
 				s.Stats.SetDrain(1)
+				atomic.StoreInt32(&s.drained, 1)
 			} else {
 				s.Undrain()
 				s.Stats.SetDrain(0)
+				atomic.StoreInt32(&s.drained, 0)
 			}
 		}
 		fail <- true
@@ -140,18 +504,19 @@ func (s *Server) Start() error {
 		done <- true
 	}()
 
-	// Run active metric reporting
-	go func() {
-		for ; true; <-time.After(s.Config.MetricInterval) {
-			for _, w := range s.sw {
-				w.inventoryClients()
-			}
-			s.Stats.SetUTCOffsetSec(int64(s.Config.UTCOffset.Seconds()))
-			s.Stats.SetClockAccuracy(int64(s.Config.ClockAccuracy))
-			s.Stats.SetClockClass(int64(s.Config.ClockClass))
+	s.record(&events.Event{
+		Type:    events.TypeLifecycle,
+		Message: fmt.Sprintf("ptp4u started with %d send workers", s.Config.SendWorkers),
+		Fields:  map[string]int64{"workers": int64(s.Config.SendWorkers)},
+	})
 
-			s.Stats.Snapshot()
-			s.Stats.Reset()
+	// Run active metric reporting. The monitoring backend may want epochs at its own interval, or on demand
+	s.lastEpoch = time.Now()
+	s.gc = newGCSampler()
+	s.reportInterval = s.Stats.Schedule(s.metricEpoch)
+	go func() {
+		for ; true; <-time.After(s.metricInterval()) {
+			s.metricEpoch()
 		}
 		fail <- true
 	}()
@@ -165,37 +530,129 @@ func (s *Server) Start() error {
 	}
 }
 
+// seccompProbes returns the periodic paths the seccomp self test exercises: the UTC offset check
+// reading the kernel TAI offset and the ones registered next to the server
+func (s *Server) seccompProbes() []seccomp.Probe {
+	probes := append([]seccomp.Probe{}, s.SeccompProbes...)
+	if s.utcOffsetCheck != nil {
+		probes = append(probes, seccomp.Probe{Name: "UTC offset check", Run: func() error {
+			_, err := s.utcOffsetCheck.kernel()
+			return err
+		}})
+	}
+	return probes
+}
+
+// metricInterval returns the interval of the periodic metric epochs
+func (s *Server) metricInterval() time.Duration {
+	if s.reportInterval > 0 {
+		return s.reportInterval
+	}
+	return s.Config.MetricInterval
+}
+
+// metricEpoch collects the server state into the stats, snapshots and resets them
+func (s *Server) metricEpoch() {
+	s.epochMux.Lock()
+	defer s.epochMux.Unlock()
+	var subscriptions int64
+	now := time.Now()
+	for _, w := range s.sw {
+		subscriptions += w.inventoryClients()
+		w.updatePPS(now.Sub(s.lastEpoch))
+		w.reportCPUUsage()
+	}
+	s.pruneAssignments()
+	s.tuneRcvBufs()
+	s.reportWorkerSizing(subscriptions)
+	if s.Config.Standby {
+		s.Stats.SetStandby(1)
+	}
+	s.checkPeers()
+	s.reportTimestamping()
+	if s.ntpCheck != nil {
+		s.Stats.SetNTPOffset(s.ntpCheck.Offset())
+		s.Stats.SetNTPAlarm(s.ntpCheck.Alarm())
+	}
+	if s.utcOffsetCheck != nil {
+		s.Stats.SetUTCOffsetAlarm(s.utcOffsetCheck.Alarm())
+	}
+	rawClass, _ := s.Config.RawClockQuality()
+	if s.Config.clockClass != nil {
+		s.Config.clockClass.update(rawClass, s.Config.Clock().Now())
+	}
+	s.Stats.SetClockClassRaw(int64(rawClass))
+	clockClass, clockAccuracy := s.Config.ClockQuality()
+	s.Stats.SetUTCOffsetSec(int64(s.Config.UTCOffset.Seconds()))
+	s.Stats.SetLeapPending(s.Config.leap.pending())
+	s.Stats.SetLeapSmear(int64(s.Config.leap.shift(s.Config.Clock().Now())))
+	s.Stats.SetClockAccuracy(int64(clockAccuracy))
+	s.Stats.SetClockClass(int64(clockClass))
+	for _, f := range stats.Features {
+		if s.Config.Features.Enabled(f) {
+			s.Stats.SetFeature(f, 1)
+		} else {
+			s.Stats.SetFeature(f, 0)
+		}
+	}
+	for tenant, subs := range s.Config.tenants.Subscriptions() {
+		s.Stats.SetTenantSubscriptions(tenant, subs)
+	}
+	s.Stats.SetConfigGeneration(s.ConfigGeneration())
+	blocked, err := s.blocklist.Expire(time.Now())
+	if err != nil {
+		log.Errorf("Failed to save blocklist: %v", err)
+	}
+	s.Stats.SetBlocklistEntries(int64(blocked))
+	if s.pathDelays != nil {
+		for prefix, percentiles := range s.pathDelays.flush() {
+			for p, delay := range percentiles {
+				s.Stats.SetPathDelay(prefix, p, delay)
+			}
+		}
+	}
+	s.checkCanaries()
+	s.reportFPS()
+	s.publishEvents(subscriptions)
+	s.reportShutdownProgress()
+	s.logLimit.Summarize()
+	s.Config.acl.prune()
+	s.Stats.SetGCStats(s.gc.sample())
+
+	s.Stats.Snapshot()
+	s.Stats.Reset()
+	s.lastEpoch = now
+}
+
 // startEventListener launches the listener which listens to subscription requests
-func (s *Server) startEventListener() {
+func (s *Server) startEventListener(l *listener) {
 	var err error
-	log.Infof("Binding on %s %d", s.Config.IP, ptp.PortEvent)
-	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.Config.IP, Port: ptp.PortEvent})
+	log.Infof("Binding on %s %s %d", l.Interface, l.IP, ptp.PortEvent)
+	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: l.IP, Port: ptp.PortEvent})
 	if err != nil {
 		log.Fatalf("Listening error: %s", err)
 	}
 	defer eventConn.Close()
 
 	// get connection file descriptor
-	s.eFd, err = timestamp.ConnFd(eventConn)
+	l.eFd, err = timestamp.ConnFd(eventConn)
 	if err != nil {
 		log.Fatalf("Getting event connection FD: %s", err)
 	}
 
 	// Enable RX timestamps. Delay requests need to be timestamped by ptp4u on receipt
-	switch s.Config.TimestampType {
-	case timestamp.HWTIMESTAMP:
-		if err = timestamp.EnableHWTimestamps(s.eFd, s.Config.Interface); err != nil {
-			log.Fatalf("Cannot enable hardware RX timestamps: %v", err)
-		}
-	case timestamp.SWTIMESTAMP:
-		if err = timestamp.EnableSWTimestamps(s.eFd); err != nil {
-			log.Fatalf("Cannot enable software RX timestamps: %v", err)
+	if err = l.timeSrc.EnableTimestamps(l.eFd); err != nil {
+		log.Fatalf("Cannot enable RX timestamps: %v", err)
+	}
+	s.registerRcvBuf(l.socketName("event"), l.eFd)
+
+	if s.Config.ECN {
+		if err = timestamp.EnableRecvTOS(l.eFd, l.IP); err != nil {
+			log.Fatalf("Cannot enable reporting of ECN codepoints: %v", err)
 		}
-	default:
-		log.Fatalf("Unrecognized timestamp type: %s", s.Config.TimestampType)
 	}
 
-	err = unix.SetNonblock(s.eFd, false)
+	err = unix.SetNonblock(l.eFd, false)
 	if err != nil {
 		log.Fatalf("Failed to set socket to blocking: %s", err)
 	}
@@ -203,7 +660,7 @@ func (s *Server) startEventListener() {
 	fail := make(chan bool)
 	for i := 0; i < s.Config.RecvWorkers; i++ {
 		go func() {
-			s.handleEventMessages(eventConn)
+			s.handleEventMessages(l, eventConn)
 			fail <- true
 		}()
 	}
@@ -211,22 +668,23 @@ func (s *Server) startEventListener() {
 }
 
 // startGeneralListener launches the listener which listens to announces
-func (s *Server) startGeneralListener() {
+func (s *Server) startGeneralListener(l *listener) {
 	var err error
-	log.Infof("Binding on %s %d", s.Config.IP, ptp.PortGeneral)
-	generalConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.Config.IP, Port: ptp.PortGeneral})
+	log.Infof("Binding on %s %s %d", l.Interface, l.IP, ptp.PortGeneral)
+	generalConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: l.IP, Port: ptp.PortGeneral})
 	if err != nil {
 		log.Fatalf("Listening error: %s", err)
 	}
 	defer generalConn.Close()
 
 	// get connection file descriptor
-	s.gFd, err = timestamp.ConnFd(generalConn)
+	l.gFd, err = timestamp.ConnFd(generalConn)
 	if err != nil {
 		log.Fatalf("Getting general connection FD: %s", err)
 	}
+	s.registerRcvBuf(l.socketName("general"), l.gFd)
 
-	err = unix.SetNonblock(s.gFd, false)
+	err = unix.SetNonblock(l.gFd, false)
 	if err != nil {
 		log.Fatalf("Failed to set socket to blocking: %s", err)
 	}
@@ -234,7 +692,7 @@ func (s *Server) startGeneralListener() {
 	fail := make(chan bool)
 	for i := 0; i < s.Config.RecvWorkers; i++ {
 		go func() {
-			s.handleGeneralMessages(generalConn)
+			s.handleGeneralMessages(l, generalConn)
 			fail <- true
 		}()
 	}
@@ -250,13 +708,15 @@ func readPacketBuf(connFd int, buf []byte) (int, unix.Sockaddr, error) {
 	return n, saddr, err
 }
 
-// handleEventMessage is a handler which gets called every time Event Message arrives
-func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
+// handleEventMessage is a handler which gets called every time Event Message arrives on the listener
+func (s *Server) handleEventMessages(l *listener, eventConn *net.UDPConn) {
 	buf := make([]byte, timestamp.PayloadSizeBytes)
 	oob := make([]byte, timestamp.ControlSizeBytes)
 	dReq := &ptp.SyncDelayReq{}
 	// Initialize the new random. We will re-seed it every time in findWorker
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	st := s.Stats.Shard()
+	churn := newChurnSampler(st)
 	var msgType ptp.MessageType
 	var worker *sendWorker
 	var sc *SubscriptionClient
@@ -265,42 +725,84 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 	var expire time.Time
 
 	for {
-		bbuf, eclisa, rxTS, err := timestamp.ReadPacketWithRXTimestampBuf(s.eFd, buf, oob)
+		bbuf, eclisa, rxTS, tos, err := timestamp.ReadPacketWithRXTimestampTOSBuf(l.eFd, buf, oob)
 		if err != nil {
 			log.Errorf("Failed to read packet on %s: %v", eventConn.LocalAddr(), err)
 			continue
 		}
-		if s.Config.TimestampType != timestamp.HWTIMESTAMP {
-			rxTS = rxTS.Add(s.Config.UTCOffset)
+		if s.blocklist.Blocked(timestamp.SockaddrToIP(eclisa)) {
+			st.IncRXBlocked()
+			continue
+		}
+		if reason := s.Config.auth.verify(buf[:bbuf]); reason != "" {
+			st.IncAuthFailure(reason)
+			continue
+		}
+		if tos&timestamp.ECNMask == timestamp.ECNCE {
+			st.IncRXECNCE()
 		}
+		rxTS = l.timeSrc.RXTimestamp(rxTS)
 
 		msgType, err = ptp.ProbeMsgType(buf[:bbuf])
 		if err != nil {
-			log.Errorf("Failed to probe the ptp message type: %v", err)
+			if s.logLimit.Allow(eclisa, logClassProbe) {
+				log.Errorf("Failed to probe the ptp message type: %v", err)
+			}
 			continue
 		}
 
-		s.Stats.IncRX(msgType)
+		st.IncRX(msgType)
+		st.IncInterfaceRX(l.Interface, msgType)
+		if domain, err := ptp.ProbeDomainNumber(buf[:bbuf]); err == nil {
+			st.IncRXDomain(domain)
+		}
 
 		switch msgType {
 		case ptp.MessageDelayReq:
 			if err := ptp.FromBytes(buf[:bbuf], dReq); err != nil {
-				log.Errorf("Failed to read the ptp SyncDelayReq: %v", err)
+				if s.logLimit.Allow(eclisa, logClassDecode) {
+					log.Errorf("Failed to read the ptp SyncDelayReq: %v", err)
+				}
 				continue
 			}
 			log.Debugf("Got delay request")
+			if s.pathDelays != nil {
+				s.pathDelays.observe(timestamp.SockaddrToIP(eclisa), dReq, rxTS)
+			}
 			worker = s.findWorker(dReq.Header.SourcePortIdentity, r)
 			if dReq.FlagField == ptp.FlagProfileSpecific1|ptp.FlagUnicast {
-				expire = time.Now().Add(subscriptionDuration)
+				expire = s.Config.Clock().Now().Add(subscriptionDuration)
 				// SYNC DELAY_REQUEST and ANNOUNCE
 				if sc = worker.FindSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayReq); sc == nil {
 					ip = timestamp.SockaddrToIP(eclisa)
-					gclisa = timestamp.IPToSockaddr(ip, ptp.PortGeneral)
+					gclisa = l.clientSockaddr(ip, ptp.PortGeneral)
+					if !s.Config.acl.Allowed(ip) {
+						st.IncDeniedACL()
+						continue
+					}
 					// Create a new subscription
+					churn.begin()
 					sc = NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, ptp.MessageDelayReq, s.Config, subscriptionDuration, expire)
+					sc.listener = l.id
+					sc.tenant = s.Config.tenants.Match(ip, dReq.Header.DomainNumber)
+					if !s.Config.tenants.Acquire(sc.tenant) {
+						st.IncTenantQuotaReject(sc.tenant)
+						continue
+					}
+					var ok bool
+					if sc.aclKey, ok = s.Config.acl.Acquire(ip); !ok {
+						s.Config.tenants.Release(sc.tenant)
+						st.IncDeniedClientLimit()
+						continue
+					}
+					sc.idle = s.idleFor()
 					worker.RegisterSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayReq, sc)
-					go sc.Start(s.ctx)
+					churn.done()
+					sc.launch(s.ctx)
 				} else {
+					if !s.dualStackRequest(sc, timestamp.SockaddrToIP(eclisa), l) {
+						continue
+					}
 					// bump the subscription
 					sc.SetExpire(expire)
 				}
@@ -309,25 +811,34 @@ func (s *Server) handleEventMessages(eventConn *net.UDPConn) {
 			} else {
 				// DELAY_RESPONSE
 				if sc = worker.FindSubscription(dReq.Header.SourcePortIdentity, ptp.MessageDelayResp); sc == nil {
-					log.Infof("Delay request from %s is not in the subscription list", timestamp.SockaddrToIP(eclisa))
+					if s.logLimit.Allow(eclisa, logClassNoSub) {
+						log.Infof("Delay request from %s is not in the subscription list", timestamp.SockaddrToIP(eclisa))
+					}
 					continue
 				}
 				sc.UpdateDelayResp(&dReq.Header, rxTS)
 			}
+			if id := s.Config.tap.sampleRequest(); id != 0 {
+				s.Config.tap.request(id, sc, l, eclisa, buf[:bbuf], rxTS)
+			}
 			sc.Once()
 		default:
-			log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
+			if s.logLimit.Allow(eclisa, logClassUnsupported) {
+				log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
+			}
 		}
 	}
 }
 
-// handleGeneralMessage is a handler which gets called every time General Message arrives
-func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
+// handleGeneralMessage is a handler which gets called every time General Message arrives on the listener
+func (s *Server) handleGeneralMessages(l *listener, generalConn *net.UDPConn) {
 	buf := make([]byte, timestamp.PayloadSizeBytes)
 	signaling := &ptp.Signaling{}
 	zerotlv := []ptp.TLV{}
 	// Initialize the new random. We will re-seed it every time in findWorker
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	st := s.Stats.Shard()
+	churn := newChurnSampler(st)
 
 	var signalingType ptp.MessageType
 	var durationt time.Duration
@@ -337,46 +848,100 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 	var sc *SubscriptionClient
 
 	for {
-		bbuf, gclisa, err := readPacketBuf(s.gFd, buf)
+		bbuf, gclisa, err := readPacketBuf(l.gFd, buf)
 		if err != nil {
 			log.Errorf("Failed to read packet on %s: %v", generalConn.LocalAddr(), err)
 			continue
 		}
 
+		if s.blocklist.Blocked(timestamp.SockaddrToIP(gclisa)) {
+			st.IncRXBlocked()
+			continue
+		}
+		if reason := s.Config.auth.verify(buf[:bbuf]); reason != "" {
+			st.IncAuthFailure(reason)
+			continue
+		}
+
 		msgType, err := ptp.ProbeMsgType(buf[:bbuf])
 		if err != nil {
-			log.Errorf("Failed to probe the ptp message type: %v", err)
+			if s.logLimit.Allow(gclisa, logClassProbe) {
+				log.Errorf("Failed to probe the ptp message type: %v", err)
+			}
 			continue
 		}
+		st.IncInterfaceRX(l.Interface, msgType)
+		if domain, err := ptp.ProbeDomainNumber(buf[:bbuf]); err == nil {
+			st.IncRXDomain(domain)
+		}
 
 		switch msgType {
 		case ptp.MessageSignaling:
 			signaling.TLVs = zerotlv
 			if err := ptp.FromBytes(buf[:bbuf], signaling); err != nil {
-				log.Error(err)
+				if s.logLimit.Allow(gclisa, logClassDecode) {
+					log.Error(err)
+				}
 				continue
 			}
 
-			for _, tlv := range signaling.TLVs {
+			client := timestamp.SockaddrToIP(gclisa).String()
+			hint, hinted := ptp.FindGrantHint(signaling.TLVs)
+			for _, tlv := range s.compatTLVs(timestamp.SockaddrToIP(gclisa), signaling.TLVs) {
 				switch v := tlv.(type) {
 				case *ptp.RequestUnicastTransmissionTLV:
 					signalingType = v.MsgTypeAndReserved.MsgType()
-					s.Stats.IncRXSignalingGrant(signalingType)
-					log.Debugf("Got %s grant request", signalingType)
+					st.IncRXSignalingGrant(signalingType)
+					st.IncClientRXSignaling(client)
+					trace := s.traceRequest(signaling.SourcePortIdentity, signalingType)
 					durationt = time.Duration(v.DurationField) * time.Second
-					expire = time.Now().Add(durationt)
+					expire = s.Config.Clock().Now().Add(durationt)
 					intervalt = v.LogInterMessagePeriod.Duration()
 
 					switch signalingType {
 					case ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp:
 						worker = s.findWorker(signaling.SourcePortIdentity, r)
+						// Reject clients denied by the ACL or over the request rate before any state is created
+						if reason := s.aclDenied(timestamp.SockaddrToIP(gclisa)); reason != "" {
+							trace.grant(0, reason)
+							st.IncClientDenied(client)
+							s.denyRequest(worker, l, gclisa, signaling, v)
+							continue
+						}
+						if reason := s.policyDenied(timestamp.SockaddrToIP(gclisa), signaling, v); reason != "" {
+							trace.grant(0, reason)
+							st.IncClientDenied(client)
+							s.denyRequest(worker, l, gclisa, signaling, v)
+							continue
+						}
 						sc = worker.FindSubscription(signaling.SourcePortIdentity, signalingType)
 						if sc == nil || !sc.Running() {
 							ip := timestamp.SockaddrToIP(gclisa)
-							eclisa := timestamp.IPToSockaddr(ip, ptp.PortEvent)
+							eclisa := l.clientSockaddr(ip, ptp.PortEvent)
+							churn.begin()
 							sc = NewSubscriptionClient(worker.queue, worker.signalingQueue, eclisa, gclisa, signalingType, s.Config, intervalt, expire)
+							sc.listener = l.id
+							sc.tenant = s.Config.tenants.Match(ip, signaling.Header.DomainNumber)
+							sc.request = worker.clientRequest(signaling.SourcePortIdentity)
+							sc.idle = s.idleFor()
+							sc.trace = trace
+							trace.event("subscription.create", "worker", worker.id, "tenant", sc.tenant)
 							worker.RegisterSubscription(signaling.SourcePortIdentity, signalingType, sc)
+							churn.done()
 						} else {
+							ip := timestamp.SockaddrToIP(gclisa)
+							if !s.dualStackRequest(sc, ip, l) {
+								// deny to the requesting address, the subscription stays where it is
+								trace.grant(0, "dual_stack")
+								st.IncClientDenied(client)
+								s.denyRequest(worker, l, gclisa, signaling, v)
+								continue
+							}
+							// A repeated identical request refreshes the running subscription
+							if sc.Interval() == intervalt {
+								st.IncRXSignalingCoalesced(signalingType)
+							}
+							trace.event("subscription.refresh", "interval", intervalt)
 							// Update existing subscription data
 							sc.SetExpire(expire)
 							sc.SetInterval(intervalt)
@@ -385,24 +950,36 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 							sc.SetGclisa(gclisa)
 						}
 
-						// Reject queries out of limit
-						if intervalt < s.Config.MinSubInterval || durationt > s.Config.MaxSubDuration || s.ctx.Err() != nil {
+						if reason := s.admitGrant(st, sc, timestamp.SockaddrToIP(gclisa), intervalt, durationt, !sc.Running()); reason != "" {
+							trace.grant(0, reason)
+							st.IncClientDenied(client)
 							sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, 0)
 							continue
 						}
 
-						// Send confirmation grant
-						sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, v.DurationField)
+						// Send confirmation grant, extended by the client hint if the policy allows
+						granted := s.grantDuration(sc, timestamp.SockaddrToIP(gclisa), v.DurationField, hint, hinted)
+						if granted != v.DurationField {
+							sc.SetExpire(s.Config.Clock().Now().Add(time.Duration(granted) * time.Second))
+						}
+						trace.grant(granted, "")
+						st.IncClientSubscription(client)
+						sc.sendSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, granted)
 
 						if !sc.Running() {
-							go sc.Start(s.ctx)
+							sc.launch(s.ctx)
 						}
 					default:
-						log.Errorf("Got unsupported grant type %s", signalingType)
+						trace.grant(0, "unsupported")
+						st.IncClientDenied(client)
+						if s.logLimit.Allow(gclisa, logClassUnsupported) {
+							log.Errorf("Got unsupported grant type %s", signalingType)
+						}
 					}
 				case *ptp.CancelUnicastTransmissionTLV:
 					signalingType = v.MsgTypeAndFlags.MsgType()
-					s.Stats.IncRXSignalingCancel(signalingType)
+					st.IncRXSignalingCancel(signalingType)
+					st.IncClientRXSignaling(client)
 					log.Debugf("Got %s cancel request", signalingType)
 					worker = s.findWorker(signaling.SourcePortIdentity, r)
 					sc = worker.FindSubscription(signaling.SourcePortIdentity, signalingType)
@@ -411,24 +988,110 @@ func (s *Server) handleGeneralMessages(generalConn *net.UDPConn) {
 					}
 				case *ptp.AcknowledgeCancelUnicastTransmissionTLV:
 					log.Debugf("Got %s acknowledge cancel request", signalingType)
+				case *ptp.AuthenticationTLV:
+					// verified on receipt
 				default:
-					log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
+					if s.logLimit.Allow(gclisa, logClassUnsupported) {
+						log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
+					}
 				}
 			}
+		case ptp.MessageManagement:
+			s.handlePTPManagement(l.gFd, buf[:bbuf], gclisa)
 		}
 	}
 }
 
+// admitGrant checks the grant request of the subscription against the drain state, the limits and the quotas.
+// Subscriptions not holding the quotas yet acquire them when admitted. Returns the reason of the denial, empty if granted
+func (s *Server) admitGrant(st stats.Stats, sc *SubscriptionClient, ip net.IP, intervalt, durationt time.Duration, fresh bool) string {
+	// Let the running subscriptions expire while drained
+	if s.Drained() {
+		return "drained"
+	}
+	// Reject queries out of limit
+	if intervalt < s.Config.MinSubInterval || durationt > s.Config.MaxSubDuration || s.ctx.Err() != nil || atomic.LoadInt32(&s.shuttingDown) == 1 {
+		return "limits"
+	}
+	if !fresh {
+		return ""
+	}
+	// Reject new subscriptions over the tenant quota
+	if !s.Config.tenants.Acquire(sc.tenant) {
+		st.IncTenantQuotaReject(sc.tenant)
+		return "tenant_quota"
+	}
+	// Reject new subscriptions over the per client limit
+	var ok bool
+	if sc.aclKey, ok = s.Config.acl.Acquire(ip); !ok {
+		s.Config.tenants.Release(sc.tenant)
+		st.IncDeniedClientLimit()
+		return "client_limit"
+	}
+	return ""
+}
+
+// denyRequest sends the grant with zero duration to the requesting address on the listener without touching the subscriptions
+func (s *Server) denyRequest(w *sendWorker, l *listener, gclisa unix.Sockaddr, signaling *ptp.Signaling, tlv *ptp.RequestUnicastTransmissionTLV) {
+	ip := timestamp.SockaddrToIP(gclisa)
+	deny := NewSubscriptionClient(w.queue, w.signalingQueue, l.clientSockaddr(ip, ptp.PortEvent), gclisa, tlv.MsgTypeAndReserved.MsgType(), s.Config, tlv.LogInterMessagePeriod.Duration(), s.Config.Clock().Now())
+	deny.listener = l.id
+	deny.sendSignalingGrant(signaling, tlv.MsgTypeAndReserved, tlv.LogInterMessagePeriod, 0)
+}
+
 func (s *Server) findWorker(clientID ptp.PortIdentity, r *rand.Rand) *sendWorker {
-	// Seeding random with the same value will produce the same number
+	if s.Config.WorkerAssignment != AssignmentLoad {
+		// Seeding random with the same value will produce the same number
+		r.Seed(int64(clientID.ClockIdentity) + int64(clientID.PortNumber))
+		return s.sw[r.Intn(s.Config.SendWorkers)]
+	}
+
+	if w, ok := s.assigned.Load(clientID); ok {
+		return w.(*sendWorker)
+	}
+	// Receive workers look up new clients concurrently, the assignment must happen once
+	s.assignMux.Lock()
+	defer s.assignMux.Unlock()
+	if w, ok := s.assigned.Load(clientID); ok {
+		return w.(*sendWorker)
+	}
+
 	r.Seed(int64(clientID.ClockIdentity) + int64(clientID.PortNumber))
-	return s.sw[r.Intn(s.Config.SendWorkers)]
+	w := s.sw[r.Intn(s.Config.SendWorkers)]
+	// Second draw from the same seed is as deterministic as the first one
+	alt := s.sw[r.Intn(s.Config.SendWorkers)]
+	if w != alt && !w.hasClient(clientID) && (alt.hasClient(clientID) || !w.lessLoaded(alt)) {
+		w = alt
+	}
+	s.assigned.Store(clientID, w)
+	return w
+}
+
+// pruneAssignments forgets the clients without subscriptions, they get a new assignment when they come back
+func (s *Server) pruneAssignments() {
+	s.assignMux.Lock()
+	defer s.assignMux.Unlock()
+	s.assigned.Range(func(clientID, w interface{}) bool {
+		if !w.(*sendWorker).hasClient(clientID.(ptp.PortIdentity)) {
+			s.assigned.Delete(clientID)
+		}
+		return true
+	})
+}
+
+// idleFor returns the idle scheduler for a new subscription, or nil if it should run own ticker
+func (s *Server) idleFor() *idleScheduler {
+	if s.idle == nil || s.idle.Len() >= s.Config.IdleSubscriptions {
+		return nil
+	}
+	return s.idle
 }
 
 // Drain traffic
 func (s *Server) Drain() {
 	if s.ctx != nil && s.ctx.Err() == nil {
 		s.cancel()
+		s.record(&events.Event{Type: events.TypeDrain, Message: "drained, subscriptions stopped"})
 	}
 
 	// Wait for drain to complete for up to 10 seconds
@@ -451,6 +1114,7 @@ func (s *Server) Drain() {
 func (s *Server) Undrain() {
 	if s.ctx != nil && s.ctx.Err() != nil {
 		s.ctx, s.cancel = context.WithCancel(context.Background())
+		s.record(&events.Event{Type: events.TypeDrain, Message: "undrained"})
 	}
 }
 
@@ -461,16 +1125,9 @@ func (s *Server) handleSighup() {
 	signal.Notify(sigchan, unix.SIGHUP)
 	for range sigchan {
 		log.Info("SIGHUP received, reloading config")
-		dc, err := ReadDynamicConfig(s.Config.ConfigFile)
-		if err != nil {
-			log.Errorf("Failed to reload config: %v. Moving on", err)
-			continue
+		if err := s.reloadConfig(); err != nil {
+			log.Errorf("%v. Moving on", err)
 		}
-		dcMux.Lock()
-		s.Config.DynamicConfig = *dc
-		dcMux.Unlock()
-
-		s.Stats.IncReload()
 	}
 }
 
@@ -481,9 +1138,7 @@ func (s *Server) handleSigterm() {
 	signal.Notify(sigchan, unix.SIGTERM, unix.SIGINT)
 	<-sigchan
 	log.Warning("Shutting down ptp4u")
-
-	log.Info("Initiating drain")
-	s.Drain()
+	s.shutdown()
 
 	log.Info("Removing pid")
 	if err := s.Config.DeletePidFile(); err != nil {
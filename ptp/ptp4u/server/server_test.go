@@ -21,6 +21,8 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -72,6 +74,107 @@ func TestFindWorker(t *testing.T) {
 
 	require.Equal(t, 3, s.findWorker(clipi2, r).id)
 	require.Equal(t, 1, s.findWorker(clipi3, r).id)
+
+	// Only the first subscription of the client is an assignment
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	w := s.findWorker(clipi1, r)
+	w.RegisterSubscription(clipi1, ptp.MessageSync, NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute)))
+	w.RegisterSubscription(clipi1, ptp.MessageAnnounce, NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute)))
+	require.Equal(t, int64(1), s.Stats.Live()["worker.0.assignments"])
+	require.Equal(t, int64(0), s.Stats.Live()["worker.3.assignments"])
+}
+
+func TestFindWorkerLoad(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			TimestampType:    timestamp.SWTIMESTAMP,
+			SendWorkers:      10,
+			QueueSize:        10,
+			WorkerAssignment: AssignmentLoad,
+		},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     make([]*sendWorker, c.SendWorkers),
+	}
+
+	for i := 0; i < s.Config.SendWorkers; i++ {
+		s.sw[i] = newSendWorker(i, c, s.Stats)
+	}
+
+	clipi := ptp.PortIdentity{
+		PortNumber:    2,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+
+	// Hash candidates are 3 and 5
+	require.Equal(t, 3, s.findWorker(clipi, r).id)
+
+	// Assigned client sticks to the worker until it's pruned without subscriptions
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(s.sw[3].queue, s.sw[3].signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	s.sw[3].queue <- sc
+	require.Equal(t, 3, s.findWorker(clipi, r).id)
+	s.pruneAssignments()
+
+	// Busy worker is avoided
+	w := s.findWorker(clipi, r)
+	require.Equal(t, 5, w.id)
+
+	// Once registered, client sticks to the worker regardless of the load
+	w.RegisterSubscription(clipi, ptp.MessageSync, sc)
+	s.pruneAssignments()
+	s.sw[5].queue <- sc
+	s.sw[5].queue <- sc
+	require.Equal(t, 5, s.findWorker(clipi, r).id)
+	s.assigned.Delete(clipi)
+	require.Equal(t, 5, s.findWorker(clipi, r).id)
+
+	require.Equal(t, int64(0), s.Stats.Live()["worker.3.assignments"])
+	require.Equal(t, int64(1), s.Stats.Live()["worker.5.assignments"])
+}
+
+func TestFindWorkerConcurrent(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig: StaticConfig{
+			TimestampType:    timestamp.SWTIMESTAMP,
+			SendWorkers:      10,
+			QueueSize:        10,
+			WorkerAssignment: AssignmentLoad,
+		},
+	}
+	s := Server{
+		Config: c,
+		Stats:  stats.NewJSONStats(),
+		sw:     make([]*sendWorker, c.SendWorkers),
+	}
+	for i := 0; i < s.Config.SendWorkers; i++ {
+		s.sw[i] = newSendWorker(i, c, s.Stats)
+	}
+	clipi := ptp.PortIdentity{
+		PortNumber:    2,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+
+	// Receive workers looking up a new client at once agree on the worker
+	found := make([]*sendWorker, 8)
+	var wg sync.WaitGroup
+	for i := range found {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(i)))
+			found[i] = s.findWorker(clipi, r)
+		}(i)
+	}
+	wg.Wait()
+	for _, w := range found {
+		require.Same(t, found[0], w)
+	}
 }
 
 func TestStartEventListener(t *testing.T) {
@@ -85,12 +188,13 @@ func TestStartEventListener(t *testing.T) {
 			IP:            net.ParseIP("127.0.0.1"),
 		},
 	}
+	c.timeSrc = &SysClockTimeSource{config: c}
 	s := Server{
 		Config: c,
 		Stats:  stats.NewJSONStats(),
 		sw:     make([]*sendWorker, c.SendWorkers),
 	}
-	go s.startEventListener()
+	go s.startEventListener(c.serving()[0])
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -105,12 +209,13 @@ func TestStartGeneralListener(t *testing.T) {
 			IP:            net.ParseIP("127.0.0.1"),
 		},
 	}
+	c.timeSrc = &SysClockTimeSource{config: c}
 	s := Server{
 		Config: c,
 		Stats:  stats.NewJSONStats(),
 		sw:     make([]*sendWorker, c.SendWorkers),
 	}
-	go s.startGeneralListener()
+	go s.startGeneralListener(c.serving()[0])
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -243,3 +348,24 @@ func TestHandleSigterm(t *testing.T) {
 	s.handleSigterm()
 	require.NoFileExists(t, cfg.Name())
 }
+
+func TestMetricInterval(t *testing.T) {
+	s := &Server{Config: &Config{DynamicConfig: DynamicConfig{MetricInterval: time.Minute}}}
+	require.Equal(t, time.Minute, s.metricInterval())
+
+	s.reportInterval = 10 * time.Second
+	require.Equal(t, 10*time.Second, s.metricInterval())
+}
+
+func TestMetricEpoch(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{QueueSize: 10}}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st, blocklist: newBlocklist("", nil), logLimit: newLogLimiter(0, 0), gc: newGCSampler()}
+	s.sw = []*sendWorker{newSendWorker(0, c, st)}
+	s.lastEpoch = time.Now().Add(-time.Second)
+	atomic.StoreInt64(&s.sw[0].txCount, 100)
+
+	s.metricEpoch()
+	require.InDelta(t, 100, atomic.LoadInt64(&s.sw[0].pps), 5)
+	require.WithinDuration(t, time.Now(), s.lastEpoch, time.Second)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+)
+
+// shadowPruneInterval is how often finished subscriptions are dropped from the shadow schedule
+const shadowPruneInterval = time.Minute
+
+type shadowSlot struct {
+	next     time.Time
+	interval time.Duration
+}
+
+// shadowScheduler is a drift-free scheduler which sends every subscription on a fixed
+// grid anchored at its first transmission. It runs next to the active ticker based scheduler
+// computing intended send times without sending anything, so the divergence of the two
+// can be measured before it replaces the ticker. It's owned by a single send worker and is not thread safe
+type shadowScheduler struct {
+	slots     map[*SubscriptionClient]*shadowSlot
+	lastPrune time.Time
+}
+
+func newShadowScheduler() *shadowScheduler {
+	return &shadowScheduler{
+		slots: make(map[*SubscriptionClient]*shadowSlot),
+	}
+}
+
+// observe takes the time the active scheduler sent the subscription at
+// and returns how far it is from the time the shadow scheduler intended to
+func (s *shadowScheduler) observe(sc *SubscriptionClient, sent time.Time, interval time.Duration) (time.Duration, bool) {
+	s.prune(sent)
+	slot, ok := s.slots[sc]
+	if !ok || slot.interval != interval || interval <= 0 {
+		// new subscription or interval renegotiated, anchor the grid here
+		s.slots[sc] = &shadowSlot{next: sent.Add(interval), interval: interval}
+		return 0, false
+	}
+	divergence := sent.Sub(slot.next)
+	slot.next = slot.next.Add(interval)
+	// shadow scheduler skips the slots it's too late for instead of bursting
+	if behind := sent.Sub(slot.next); behind >= 0 {
+		slot.next = slot.next.Add((behind/interval + 1) * interval)
+	}
+	return divergence, true
+}
+
+// prune drops subscriptions which missed a few of their slots
+func (s *shadowScheduler) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < shadowPruneInterval {
+		return
+	}
+	s.lastPrune = now
+	for sc, slot := range s.slots {
+		if now.Sub(slot.next) > 3*slot.interval {
+			delete(s.slots, sc)
+		}
+	}
+}
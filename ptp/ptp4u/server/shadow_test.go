@@ -0,0 +1,70 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowScheduler(t *testing.T) {
+	s := newShadowScheduler()
+	sc := &SubscriptionClient{}
+	start := time.Unix(1653574589, 0)
+
+	// first send anchors the grid
+	_, ok := s.observe(sc, start, time.Second)
+	require.False(t, ok)
+
+	// late
+	d, ok := s.observe(sc, start.Add(time.Second+10*time.Millisecond), time.Second)
+	require.True(t, ok)
+	require.Equal(t, 10*time.Millisecond, d)
+
+	// early. Grid doesn't drift with the active scheduler
+	d, ok = s.observe(sc, start.Add(2*time.Second-5*time.Millisecond), time.Second)
+	require.True(t, ok)
+	require.Equal(t, -5*time.Millisecond, d)
+
+	// missed slots are skipped
+	d, ok = s.observe(sc, start.Add(5*time.Second+time.Millisecond), time.Second)
+	require.True(t, ok)
+	require.Equal(t, 2*time.Second+time.Millisecond, d)
+	require.Equal(t, start.Add(6*time.Second), s.slots[sc].next)
+
+	// interval change re-anchors
+	_, ok = s.observe(sc, start.Add(6*time.Second), 2*time.Second)
+	require.False(t, ok)
+	require.Equal(t, start.Add(8*time.Second), s.slots[sc].next)
+}
+
+func TestShadowSchedulerPrune(t *testing.T) {
+	s := newShadowScheduler()
+	gone := &SubscriptionClient{}
+	alive := &SubscriptionClient{}
+	start := time.Unix(1653574589, 0)
+
+	s.observe(gone, start, time.Second)
+	s.observe(alive, start, time.Second)
+	require.Len(t, s.slots, 2)
+
+	s.observe(alive, start.Add(shadowPruneInterval), time.Second)
+	require.Len(t, s.slots, 1)
+	require.Contains(t, s.slots, alive)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/ptp/ptp4u/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// shutdown stops granting, notifies all clients their subscriptions are over and drains the server.
+// Clients can fail over right away instead of waiting for their grants to expire
+func (s *Server) shutdown() {
+	deadline := time.Now().Add(s.Config.ShutdownTimeout)
+	log.Info("Rejecting new subscriptions")
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	s.record(&events.Event{Type: events.TypeLifecycle, Message: "shutting down"})
+
+	s.cancelSubscriptions(deadline)
+	s.waitSignaling(deadline)
+
+	log.Info("Initiating drain")
+	s.Drain()
+
+	// make the final state visible to the stats collection
+	s.Stats.Snapshot()
+	log.Infof("Cancelled %d of %d subscriptions", atomic.LoadInt64(&s.shutdownCancelled), atomic.LoadInt64(&s.shutdownCancelled)+atomic.LoadInt64(&s.shutdownPending))
+}
+
+// cancelSubscriptions stops running subscriptions at ShutdownCancelRate per second,
+// each stopped subscription sends CANCEL_UNICAST_TRANSMISSION to its client
+func (s *Server) cancelSubscriptions(deadline time.Time) {
+	subs := s.runningSubscriptions()
+	total := int64(len(subs))
+	s.setShutdownProgress(total, 0)
+	log.Warningf("Cancelling %d subscriptions", total)
+
+	var pace time.Duration
+	if s.Config.ShutdownCancelRate > 0 {
+		pace = time.Second / time.Duration(s.Config.ShutdownCancelRate)
+	}
+	lastLog := time.Now()
+	for i, sc := range subs {
+		if time.Now().After(deadline) {
+			log.Errorf("Shutdown timeout, %d subscriptions are not cancelled", total-int64(i))
+			return
+		}
+		sc.Stop()
+		cancelled := int64(i + 1)
+		s.setShutdownProgress(total-cancelled, cancelled)
+		if time.Since(lastLog) >= time.Second {
+			log.Infof("Cancelled %d/%d subscriptions", cancelled, total)
+			lastLog = time.Now()
+		}
+		time.Sleep(pace)
+	}
+}
+
+// waitSignaling waits for the workers to send out the queued signaling messages
+func (s *Server) waitSignaling(deadline time.Time) {
+	for _, w := range s.sw {
+		for len(w.signalingQueue) > 0 {
+			if time.Now().After(deadline) {
+				log.Errorf("Shutdown timeout, %d signaling messages are not sent by worker %d", len(w.signalingQueue), w.id)
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// setShutdownProgress records the progress of the subscription cancellation
+func (s *Server) setShutdownProgress(pending, cancelled int64) {
+	atomic.StoreInt64(&s.shutdownPending, pending)
+	atomic.StoreInt64(&s.shutdownCancelled, cancelled)
+	s.reportShutdownProgress()
+}
+
+// reportShutdownProgress exports the progress of the subscription cancellation
+func (s *Server) reportShutdownProgress() {
+	s.Stats.SetShutdownPending(atomic.LoadInt64(&s.shutdownPending))
+	s.Stats.SetShutdownCancelled(atomic.LoadInt64(&s.shutdownCancelled))
+}
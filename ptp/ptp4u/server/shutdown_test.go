@@ -0,0 +1,81 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelSubscriptions(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 10, ShutdownCancelRate: 1000},
+	}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	s.sw = []*sendWorker{newSendWorker(0, c, st)}
+	w := s.sw[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.10"), 319)
+	for i := 0; i < 3; i++ {
+		sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Now().Add(time.Minute))
+		w.RegisterSubscription(ptp.PortIdentity{ClockIdentity: ptp.ClockIdentity(i)}, ptp.MessageDelayResp, sc)
+		go sc.Start(ctx)
+	}
+	require.Eventually(t, func() bool { return w.inventoryClients() == 3 }, time.Second, 10*time.Millisecond)
+
+	s.cancelSubscriptions(time.Now().Add(time.Minute))
+	require.Equal(t, int64(0), s.shutdownPending)
+	require.Equal(t, int64(3), s.shutdownCancelled)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case sc := <-w.signalingQueue:
+			require.IsType(t, &ptp.CancelUnicastTransmissionTLV{}, sc.Signaling().TLVs[0])
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for cancel")
+		}
+	}
+}
+
+func TestCancelSubscriptionsTimeout(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{QueueSize: 10}}
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st}
+	s.sw = []*sendWorker{newSendWorker(0, c, st)}
+	w := s.sw[0]
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("192.168.0.10"), 319)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Now().Add(time.Minute))
+	sc.setRunning(true)
+	w.RegisterSubscription(ptp.PortIdentity{}, ptp.MessageDelayResp, sc)
+
+	// deadline in the past cancels nothing
+	s.cancelSubscriptions(time.Now().Add(-time.Second))
+	require.Equal(t, int64(1), s.shutdownPending)
+	require.Equal(t, int64(0), s.shutdownCancelled)
+}
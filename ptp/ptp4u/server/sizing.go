@@ -0,0 +1,194 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSubscriptionsPerWorker is how many subscriptions a send worker is sized for
+const DefaultSubscriptionsPerWorker = 1000
+
+// sysfs is where the CPU and NIC topology is read from
+var sysfs = "/sys"
+
+// topology is the part of the host the worker pool is sized for
+type topology struct {
+	cpus     int
+	rxQueues int
+	txQueues int
+}
+
+// readTopology returns the CPUs local to the NIC and its queues. CPUs fall back to
+// all usable ones when the NUMA node of the NIC is unknown, queues are 0 if unknown
+func readTopology(iface string) topology {
+	t := topology{cpus: runtime.NumCPU()}
+	if iface == "" {
+		return t
+	}
+	t.rxQueues, t.txQueues = nicQueues(iface)
+	if cpus, err := numaCPUs(iface); err == nil && cpus > 0 && cpus < t.cpus {
+		t.cpus = cpus
+	}
+	return t
+}
+
+// nicQueues counts the receive and transmit queues of the interface
+func nicQueues(iface string) (rx, tx int) {
+	entries, err := os.ReadDir(filepath.Join(sysfs, "class/net", iface, "queues"))
+	if err != nil {
+		return 0, 0
+	}
+	for _, e := range entries {
+		switch {
+		case strings.HasPrefix(e.Name(), "rx-"):
+			rx++
+		case strings.HasPrefix(e.Name(), "tx-"):
+			tx++
+		}
+	}
+	return rx, tx
+}
+
+// numaCPUs counts the CPUs of the NUMA node the interface is attached to
+func numaCPUs(iface string) (int, error) {
+	b, err := os.ReadFile(filepath.Join(sysfs, "class/net", iface, "device/numa_node"))
+	if err != nil {
+		return 0, err
+	}
+	node, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, err
+	}
+	if node < 0 {
+		return 0, fmt.Errorf("no NUMA node of %s", iface)
+	}
+	b, err = os.ReadFile(filepath.Join(sysfs, fmt.Sprintf("devices/system/node/node%d/cpulist", node)))
+	if err != nil {
+		return 0, err
+	}
+	return parseCPUList(strings.TrimSpace(string(b)))
+}
+
+// parseCPUList counts the CPUs of a list like 0-15,32-47
+func parseCPUList(list string) (int, error) {
+	var n int
+	for _, r := range strings.Split(list, ",") {
+		if r == "" {
+			continue
+		}
+		from, to := r, r
+		if i := strings.Index(r, "-"); i >= 0 {
+			from, to = r[:i], r[i+1:]
+		}
+		f, err := strconv.Atoi(from)
+		if err != nil {
+			return 0, fmt.Errorf("parsing CPU list %q: %w", list, err)
+		}
+		t, err := strconv.Atoi(to)
+		if err != nil {
+			return 0, fmt.Errorf("parsing CPU list %q: %w", list, err)
+		}
+		if t < f {
+			return 0, fmt.Errorf("parsing CPU list %q: invalid range %s", list, r)
+		}
+		n += t - f + 1
+	}
+	return n, nil
+}
+
+// sendWorkersFor returns the send workers for the topology and the subscriptions:
+// one per CPU or TX queue, whichever is more, and enough to keep every worker within perWorker subscriptions
+func sendWorkersFor(t topology, subscriptions, perWorker int) int {
+	n := t.cpus
+	if t.txQueues > n {
+		n = t.txQueues
+	}
+	if perWorker > 0 {
+		if load := (subscriptions + perWorker - 1) / perWorker; load > n {
+			n = load
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// recvWorkersFor returns the receive workers for the topology: one per RX queue, at most one per CPU
+func recvWorkersFor(t topology) int {
+	n := t.rxQueues
+	if n == 0 || n > t.cpus {
+		n = t.cpus
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// sizeWorkers sets the send and receive workers left at 0 in the config from the host topology
+// and the expected subscriptions
+func (s *Server) sizeWorkers(t topology) {
+	s.sizing = stats.WorkerSizing{
+		CPUs:          int64(t.cpus),
+		RXQueues:      int64(t.rxQueues),
+		TXQueues:      int64(t.txQueues),
+		Subscriptions: int64(s.Config.ExpectedSubscriptions),
+	}
+	if s.Config.SendWorkers <= 0 {
+		s.Config.SendWorkers = sendWorkersFor(t, s.Config.ExpectedSubscriptions, s.Config.SubscriptionsPerWorker)
+		s.sizing.Auto = true
+	}
+	if s.Config.RecvWorkers <= 0 {
+		s.Config.RecvWorkers = recvWorkersFor(t)
+		s.sizing.Auto = true
+	}
+	s.sizing.SendWorkers = int64(s.Config.SendWorkers)
+	s.sizing.RecvWorkers = int64(s.Config.RecvWorkers)
+	s.sizing.RecommendedSendWorkers = s.sizing.SendWorkers
+	log.Infof("Running %d send and %d receive workers for %d CPUs, %d RX and %d TX queues of %q and %d expected subscriptions (auto sizing %v)",
+		s.Config.SendWorkers, s.Config.RecvWorkers, t.cpus, t.rxQueues, t.txQueues, s.Config.Interface, s.Config.ExpectedSubscriptions, s.sizing.Auto)
+}
+
+// reportWorkerSizing exports the worker sizing along with the send workers recommended for the running subscriptions.
+// The pool isn't resized at runtime as clients are pinned to their workers, a warning tells a restart is due.
+// Called by the metric reporting only
+func (s *Server) reportWorkerSizing(subscriptions int64) {
+	if s.sizing.SendWorkers == 0 {
+		return
+	}
+	load := s.sizing.Subscriptions
+	if subscriptions > load {
+		load = subscriptions
+	}
+	t := topology{cpus: int(s.sizing.CPUs), rxQueues: int(s.sizing.RXQueues), txQueues: int(s.sizing.TXQueues)}
+	recommended := int64(sendWorkersFor(t, int(load), s.Config.SubscriptionsPerWorker))
+	if recommended > s.sizing.SendWorkers && recommended > s.sizing.RecommendedSendWorkers {
+		log.Warningf("Serving %d subscriptions, %d send workers recommended instead of %d. Restart with -expectedsubscriptions %d to resize", subscriptions, recommended, s.sizing.SendWorkers, subscriptions)
+	}
+	s.sizing.RecommendedSendWorkers = recommended
+	s.Stats.SetWorkerSizing(s.sizing)
+}
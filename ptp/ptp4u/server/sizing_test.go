@@ -0,0 +1,126 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSysfs lays out the queues and the NUMA node of eth0 under a temporary sysfs
+func fakeSysfs(t *testing.T, rx, tx int, node, cpulist string) {
+	dir := t.TempDir()
+	queues := filepath.Join(dir, "class/net/eth0/queues")
+	for i := 0; i < rx; i++ {
+		require.NoError(t, os.MkdirAll(filepath.Join(queues, "rx-"+string(rune('0'+i))), 0755))
+	}
+	for i := 0; i < tx; i++ {
+		require.NoError(t, os.MkdirAll(filepath.Join(queues, "tx-"+string(rune('0'+i))), 0755))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "class/net/eth0/device"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "class/net/eth0/device/numa_node"), []byte(node+"\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "devices/system/node/node0"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "devices/system/node/node0/cpulist"), []byte(cpulist+"\n"), 0644))
+
+	old := sysfs
+	sysfs = dir
+	t.Cleanup(func() { sysfs = old })
+}
+
+func TestParseCPUList(t *testing.T) {
+	for list, want := range map[string]int{"0": 1, "0-15": 16, "0-15,32-47": 32, "0,2,4-5": 4, "": 0} {
+		got, err := parseCPUList(list)
+		require.NoError(t, err, list)
+		require.Equal(t, want, got, list)
+	}
+	for _, list := range []string{"a", "0-b", "5-1"} {
+		_, err := parseCPUList(list)
+		require.Error(t, err, list)
+	}
+}
+
+func TestReadTopology(t *testing.T) {
+	fakeSysfs(t, 4, 8, "0", "0")
+	require.Equal(t, topology{cpus: 1, rxQueues: 4, txQueues: 8}, readTopology("eth0"))
+
+	// unknown NUMA node falls back to all CPUs
+	fakeSysfs(t, 2, 2, "-1", "0")
+	require.Equal(t, topology{cpus: runtime.NumCPU(), rxQueues: 2, txQueues: 2}, readTopology("eth0"))
+
+	require.Equal(t, topology{cpus: runtime.NumCPU()}, readTopology("lolwut"))
+	require.Equal(t, topology{cpus: runtime.NumCPU()}, readTopology(""))
+}
+
+func TestWorkersFor(t *testing.T) {
+	top := topology{cpus: 16, rxQueues: 8, txQueues: 32}
+	require.Equal(t, 32, sendWorkersFor(top, 0, 1000))
+	require.Equal(t, 32, sendWorkersFor(top, 20000, 1000))
+	require.Equal(t, 50, sendWorkersFor(top, 49001, 1000))
+	require.Equal(t, 32, sendWorkersFor(top, 100000, 0))
+	require.Equal(t, 1, sendWorkersFor(topology{}, 0, 1000))
+
+	require.Equal(t, 8, recvWorkersFor(top))
+	require.Equal(t, 16, recvWorkersFor(topology{cpus: 16, rxQueues: 64}))
+	require.Equal(t, 16, recvWorkersFor(topology{cpus: 16}))
+	require.Equal(t, 1, recvWorkersFor(topology{}))
+}
+
+func TestSizeWorkers(t *testing.T) {
+	top := topology{cpus: 16, rxQueues: 8, txQueues: 8}
+	c := &Config{StaticConfig: StaticConfig{ExpectedSubscriptions: 40000, SubscriptionsPerWorker: 1000}}
+	s := &Server{Config: c, Stats: stats.NewJSONStats()}
+	s.sizeWorkers(top)
+	require.Equal(t, 40, c.SendWorkers)
+	require.Equal(t, 8, c.RecvWorkers)
+	require.Equal(t, stats.WorkerSizing{CPUs: 16, RXQueues: 8, TXQueues: 8, Subscriptions: 40000, SendWorkers: 40, RecvWorkers: 8, RecommendedSendWorkers: 40, Auto: true}, s.sizing)
+
+	// configured workers are kept
+	c = &Config{StaticConfig: StaticConfig{SendWorkers: 100, RecvWorkers: 10, SubscriptionsPerWorker: 1000}}
+	s = &Server{Config: c, Stats: stats.NewJSONStats()}
+	s.sizeWorkers(top)
+	require.Equal(t, 100, c.SendWorkers)
+	require.Equal(t, 10, c.RecvWorkers)
+	require.False(t, s.sizing.Auto)
+}
+
+func TestReportWorkerSizing(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{ExpectedSubscriptions: 10000, SubscriptionsPerWorker: 1000}}
+	s := &Server{Config: c, Stats: stats.NewJSONStats()}
+
+	// not sized yet
+	s.reportWorkerSizing(1)
+	require.Equal(t, int64(0), s.sizing.RecommendedSendWorkers)
+
+	s.sizeWorkers(topology{cpus: 4})
+	require.Equal(t, 10, c.SendWorkers)
+
+	s.reportWorkerSizing(5000)
+	require.Equal(t, int64(10), s.sizing.RecommendedSendWorkers)
+
+	s.reportWorkerSizing(25000)
+	require.Equal(t, int64(25), s.sizing.RecommendedSendWorkers)
+	require.Equal(t, int64(10), s.sizing.SendWorkers)
+
+	// the recommendation follows the load back down to the expected subscriptions
+	s.reportWorkerSizing(0)
+	require.Equal(t, int64(10), s.sizing.RecommendedSendWorkers)
+}
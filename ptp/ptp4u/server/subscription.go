@@ -23,7 +23,9 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
@@ -40,6 +42,29 @@ type SubscriptionClient struct {
 	signalingQueue   chan *SubscriptionClient
 	subscriptionType ptp.MessageType
 	serverConfig     *Config
+	// tenant the client belongs to. Empty if none
+	tenant string
+	// key of the per client subscription slot taken in the ACL. Empty if none
+	aclKey string
+	// client IP the per client stats are kept by
+	client string
+	// negotiation start of the client, used to measure the time to first sync
+	request *clientRequest
+	// idle scheduler waking up the subscription. Nil if it runs own ticker
+	idle *idleScheduler
+	// trace of the grant request which created the subscription. Nil if the subscription is not traced
+	trace *requestTrace
+	// number of sends recorded in the trace
+	tracedSends int
+	// canary measuring the sends. Nil for client subscriptions
+	canary *canaryProbe
+	// creation time, the age grant hints are honored by
+	created time.Time
+	// number of renewals extended by the grant hint
+	hintRenewals int
+	// ID of the sampled request to respond to and when it was queued, accessed atomically. Zero ID if none
+	tapID     uint64
+	tapQueued int64
 
 	interval   time.Duration
 	expire     time.Time
@@ -49,10 +74,26 @@ type SubscriptionClient struct {
 
 	runningInterval time.Duration
 	intervalTicker  *time.Ticker
+	// factor the interval is stretched by to fit the FPS caps. Not stretched if up to 1
+	stretch float64
+
+	// deadline accounting of the periodic sends. queued is set while a send is in the worker queue,
+	// scheduled and deadline are its unix nanoseconds, missed counts the intervals with no send queued
+	queued    int32
+	scheduled int64
+	deadline  int64
+	missed    int64
+	// previous periodic send, only accessed by the goroutine scheduling the subscription
+	lastDue      time.Time
+	lastInterval time.Duration
 
 	// socket addresses
 	eclisa unix.Sockaddr
 	gclisa unix.Sockaddr
+	// last client IP of the other IP family, if the client is dual-stack
+	altAddress net.IP
+	// id of the listener the subscription is served from
+	listener int
 
 	// packets
 	syncP      *ptp.SyncDelayReq
@@ -70,20 +111,37 @@ func NewSubscriptionClient(q chan *SubscriptionClient, gq chan *SubscriptionClie
 		subscriptionType: st,
 		interval:         i,
 		expire:           e,
+		created:          sc.Clock().Now(),
 		queue:            q,
 		signalingQueue:   gq,
 		serverConfig:     sc,
 		stop:             make(chan bool, 1),
 	}
+	if ip := timestamp.SockaddrToIP(eclisa); ip != nil {
+		s.client = ip.String()
+	}
 	s.initSync()
 	s.initFollowup()
 	s.initAnnounce()
 	s.initDelayResp()
 	s.initSignaling()
+	if sc.Features.TimeSequence && (st == ptp.MessageSync || st == ptp.MessageAnnounce) {
+		s.sequenceID = timeSequenceID(sc.Clock().Now(), i)
+	}
 
 	return s
 }
 
+// timeSequenceID returns the number of intervals elapsed since the epoch, truncated to the sequence ID.
+// Subscription sending every interval keeps up with it, so the one a client gets after a server
+// restart continues the sequence of the previous one instead of starting from 0
+func timeSequenceID(now time.Time, interval time.Duration) uint16 {
+	if interval <= 0 {
+		return 0
+	}
+	return uint16(now.UnixNano() / int64(interval))
+}
+
 // Start launches the subscription timers and exit on expire
 func (sc *SubscriptionClient) Start(ctx context.Context) {
 	log.Infof("Starting a new %s subscription for %s", sc.subscriptionType, timestamp.SockaddrToIP(sc.eclisa))
@@ -91,18 +149,28 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 
 	// Send first message right away
 	if sc.subscriptionType != ptp.MessageDelayResp && sc.subscriptionType != ptp.MessageDelayReq {
-		sc.Once()
+		sc.Due(sc.serverConfig.Clock().Now(), sc.sendInterval())
 	}
 
-	sc.runningInterval = sc.interval
-	sc.intervalTicker = time.NewTicker(sc.runningInterval)
+	sc.runningInterval = sc.sendInterval()
 
 	defer log.Infof(fmt.Sprintf("Subscription %s is over for %s", sc.subscriptionType, timestamp.SockaddrToIP(sc.eclisa)))
 	if sc.subscriptionType != ptp.MessageDelayReq {
 		defer sc.sendSignalingCancel()
 	}
-	defer sc.intervalTicker.Stop()
 	defer sc.setRunning(false)
+	defer sc.serverConfig.tenants.Release(sc.tenant)
+	defer sc.serverConfig.acl.Release(sc.aclKey)
+
+	if sc.idle != nil {
+		// Let the idle scheduler wake us up instead of running own ticker
+		sc.idle.wait(ctx, sc, sc.runningInterval)
+		return
+	}
+
+	clock := sc.serverConfig.Clock()
+	sc.intervalTicker = time.NewTicker(clock.Wall(sc.runningInterval))
+	defer sc.intervalTicker.Stop()
 
 	for {
 		select {
@@ -110,29 +178,57 @@ func (sc *SubscriptionClient) Start(ctx context.Context) {
 			return
 		case <-sc.stop:
 			return
-		case <-sc.intervalTicker.C:
+		case tick := <-sc.intervalTicker.C:
 			if sc.Expired() {
 				return
 			}
 
 			// check if interval changed, maybe update our ticker
-			if sc.runningInterval != sc.interval {
-				sc.runningInterval = sc.interval
-				sc.intervalTicker.Reset(sc.runningInterval)
+			if interval := sc.sendInterval(); sc.runningInterval != interval {
+				sc.runningInterval = interval
+				sc.intervalTicker.Reset(clock.Wall(sc.runningInterval))
 			}
 			if sc.subscriptionType != ptp.MessageDelayResp && sc.subscriptionType != ptp.MessageDelayReq {
 				// Add myself to the worker queue
-				sc.Once()
+				sc.Due(clock.At(tick), sc.runningInterval)
 			}
 		}
 	}
 }
 
+// launch starts the subscription in the background. It's running from now on,
+// so requests arriving before the goroutine is scheduled refresh it instead of starting it again
+func (sc *SubscriptionClient) launch(ctx context.Context) {
+	sc.setRunning(true)
+	go sc.Start(ctx)
+}
+
 // Once adds itself to the worker queue once
 func (sc *SubscriptionClient) Once() {
 	sc.queue <- sc
 }
 
+// Due adds the periodic send scheduled at the given time to the worker queue. The send must be
+// serviced before the next interval begins. If the previous send is still queued it isn't serviced in time:
+// the interval is counted as missed and the queued send is kept instead of bursting a second one
+func (sc *SubscriptionClient) Due(scheduled time.Time, interval time.Duration) {
+	// intervals the scheduler itself skipped, e.g. while blocked on the full queue
+	if !sc.lastDue.IsZero() && sc.lastInterval > 0 {
+		if skipped := int64(scheduled.Sub(sc.lastDue)/sc.lastInterval) - 1; skipped > 0 {
+			atomic.AddInt64(&sc.missed, skipped)
+		}
+	}
+	sc.lastDue, sc.lastInterval = scheduled, interval
+
+	if !atomic.CompareAndSwapInt32(&sc.queued, 0, 1) {
+		atomic.AddInt64(&sc.missed, 1)
+		return
+	}
+	atomic.StoreInt64(&sc.scheduled, scheduled.UnixNano())
+	atomic.StoreInt64(&sc.deadline, scheduled.Add(interval).UnixNano())
+	sc.queue <- sc
+}
+
 // OnceSignaling adds itself to the worker signaling queue once
 func (sc *SubscriptionClient) OnceSignaling() {
 	sc.signalingQueue <- sc
@@ -142,7 +238,7 @@ func (sc *SubscriptionClient) OnceSignaling() {
 func (sc *SubscriptionClient) Expired() bool {
 	sc.Lock()
 	defer sc.Unlock()
-	return time.Now().After(sc.expire)
+	return sc.serverConfig.Clock().Now().After(sc.expire)
 }
 
 // Stop stops the subscription
@@ -150,7 +246,7 @@ func (sc *SubscriptionClient) Stop() {
 	sc.Lock()
 	defer sc.Unlock()
 	// Make sure we mark subscription as expired
-	sc.expire = time.Now()
+	sc.expire = sc.serverConfig.Clock().Now()
 	// And demand subscription stop
 	if sc.running {
 		sc.stop <- true
@@ -171,6 +267,21 @@ func (sc *SubscriptionClient) SetExpire(expire time.Time) {
 	sc.expire = expire
 }
 
+// Age atomically gets how long ago the subscription was created
+func (sc *SubscriptionClient) Age(now time.Time) time.Duration {
+	sc.Lock()
+	defer sc.Unlock()
+	return now.Sub(sc.created)
+}
+
+// hintRenewal atomically counts a renewal extended by the grant hint and returns the number of the previous ones
+func (sc *SubscriptionClient) hintRenewal() int {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.hintRenewals++
+	return sc.hintRenewals - 1
+}
+
 // SetInterval atomically sets interval
 func (sc *SubscriptionClient) SetInterval(interval time.Duration) {
 	sc.Lock()
@@ -178,6 +289,30 @@ func (sc *SubscriptionClient) SetInterval(interval time.Duration) {
 	sc.interval = interval
 }
 
+// Interval atomically gets interval
+func (sc *SubscriptionClient) Interval() time.Duration {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.interval
+}
+
+// SetStretch atomically sets the factor the interval is stretched by to fit the FPS caps
+func (sc *SubscriptionClient) SetStretch(stretch float64) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.stretch = stretch
+}
+
+// sendInterval atomically gets the interval the messages are actually sent at, which is the granted one unless stretched
+func (sc *SubscriptionClient) sendInterval() time.Duration {
+	sc.Lock()
+	defer sc.Unlock()
+	if sc.stretch <= 1 {
+		return sc.interval
+	}
+	return time.Duration(float64(sc.interval) * sc.stretch)
+}
+
 // SetGclisa atomically sets gclisa
 func (sc *SubscriptionClient) SetGclisa(gclisa unix.Sockaddr) {
 	sc.Lock()
@@ -305,20 +440,53 @@ func (sc *SubscriptionClient) UpdateAnnounce() {
 	i, _ := ptp.NewLogInterval(sc.interval)
 	sc.announceP.SequenceID = sc.sequenceID
 	sc.announceP.LogMessageInterval = i
+	sc.announceP.FlagField = ptp.FlagUnicast | ptp.FlagPTPTimescale | sc.serverConfig.leap.flags()
 	sc.announceP.CurrentUTCOffset = int16(sc.serverConfig.UTCOffset.Seconds())
-	sc.announceP.GrandmasterClockQuality.ClockClass = sc.serverConfig.ClockClass
-	sc.announceP.GrandmasterClockQuality.ClockAccuracy = sc.serverConfig.ClockAccuracy
+	sc.updateAnnounceGrandmaster()
+	sc.updateAnnounceAltTime()
+}
+
+// updateAnnounceGrandmaster sets the grandmaster fields of the Announce packet
+func (sc *SubscriptionClient) updateAnnounceGrandmaster() {
+	gm := sc.serverConfig.Grandmaster(sc.tenant)
+	sc.announceP.GrandmasterIdentity = gm.Identity
+	sc.announceP.GrandmasterPriority1 = gm.Priority1
+	sc.announceP.GrandmasterPriority2 = gm.Priority2
+	sc.announceP.GrandmasterClockQuality = ptp.ClockQuality{
+		ClockClass:              gm.ClockClass,
+		ClockAccuracy:           gm.ClockAccuracy,
+		OffsetScaledLogVariance: gm.OffsetScaledLogVariance,
+	}
+	sc.announceP.StepsRemoved = gm.StepsRemoved
 }
 
 // UpdateAnnounceDelayReq updates ptp Announce Delay Req payload
 func (sc *SubscriptionClient) UpdateAnnounceDelayReq(cf ptp.Correction, seq uint16) {
 	sc.announceP.SequenceID = seq
+	sc.announceP.FlagField = ptp.FlagUnicast | ptp.FlagPTPTimescale | sc.serverConfig.leap.flags()
 	sc.announceP.CurrentUTCOffset = int16(sc.serverConfig.UTCOffset.Seconds())
-	sc.announceP.GrandmasterClockQuality.ClockClass = sc.serverConfig.ClockClass
-	sc.announceP.GrandmasterClockQuality.ClockAccuracy = sc.serverConfig.ClockAccuracy
+	sc.updateAnnounceGrandmaster()
+	sc.updateAnnounceAltTime()
 	sc.announceP.CorrectionField = cf
 }
 
+// updateAnnounceAltTime attaches the alternate time offset TLV to the Announce packet, if it's served
+func (sc *SubscriptionClient) updateAnnounceAltTime() {
+	length := uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.AnnounceBody{}))
+	tlv := sc.serverConfig.altTime.TLV()
+	if tlv == nil {
+		sc.announceP.TLVs = nil
+		sc.announceP.MessageLength = length
+		return
+	}
+	if len(sc.announceP.TLVs) == 1 {
+		sc.announceP.TLVs[0] = tlv
+	} else {
+		sc.announceP.TLVs = []ptp.TLV{tlv}
+	}
+	sc.announceP.MessageLength = length + uint16(binary.Size(ptp.TLVHead{})) + tlv.LengthField
+}
+
 // UpdateAnnounceFollowUp updates ptp Announce Follow Up payload
 func (sc *SubscriptionClient) UpdateAnnounceFollowUp(transmitted time.Time) {
 	sc.announceP.OriginTimestamp = ptp.NewTimestamp(transmitted)
@@ -59,6 +59,23 @@ func TestSubscriptionStart(t *testing.T) {
 	require.True(t, sc.Running())
 }
 
+func TestSubscriptionLaunch(t *testing.T) {
+	w := &sendWorker{
+		queue:          make(chan *SubscriptionClient, 100),
+		signalingQueue: make(chan *SubscriptionClient, 100),
+	}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Minute, time.Now().Add(time.Minute))
+
+	// running before the goroutine is scheduled, so a repeated request refreshes it
+	sc.launch(context.Background())
+	require.True(t, sc.Running())
+
+	sc.Stop()
+	require.Eventually(t, func() bool { return !sc.Running() }, time.Second, 10*time.Millisecond)
+}
+
 func TestSubscriptionExpire(t *testing.T) {
 	w := &sendWorker{
 		signalingQueue: make(chan *SubscriptionClient, 100),
@@ -149,6 +166,40 @@ func TestSubscriptionflags(t *testing.T) {
 	require.Equal(t, ptp.FlagUnicast|ptp.FlagPTPTimescale, sc.Announce().Header.FlagField)
 }
 
+func TestTimeSequenceID(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	require.Equal(t, uint16(1000000%65536), timeSequenceID(now, time.Second))
+	require.Equal(t, uint16(1000000*8%65536), timeSequenceID(now, time.Second/8))
+	require.Equal(t, uint16(0), timeSequenceID(now, 0))
+
+	// sequence continues across subscriptions
+	require.Equal(t, timeSequenceID(now, time.Second)+1, timeSequenceID(now.Add(time.Second), time.Second))
+}
+
+func TestSubscriptionTimeSequence(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{clockIdentity: ptp.ClockIdentity(1234)}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Time{})
+	require.Equal(t, uint16(0), sc.sequenceID)
+
+	c.Features.TimeSequence = true
+	before := timeSequenceID(time.Now(), time.Second)
+	sc = NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Time{})
+	require.Contains(t, []uint16{before, before + 1}, sc.sequenceID)
+
+	// follows the server clock
+	epoch := time.Unix(1000000, 0)
+	c.clock = NewAcceleratedClock(epoch, 1)
+	sc = NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Time{})
+	require.Contains(t, []uint16{timeSequenceID(epoch, time.Second), timeSequenceID(epoch, time.Second) + 1}, sc.sequenceID)
+	c.clock = nil
+
+	// delay responses echo the sequence of the request
+	sc = NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, time.Second, time.Time{})
+	require.Equal(t, uint16(0), sc.sequenceID)
+}
+
 func TestSyncPacket(t *testing.T) {
 	sequenceID := uint16(42)
 	domainNumber := uint8(13)
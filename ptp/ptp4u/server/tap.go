@@ -0,0 +1,289 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// pcapng block types and options
+const (
+	pcapngSectionHeader    = 0x0a0d0d0a
+	pcapngInterface        = 1
+	pcapngEnhancedPacket   = 6
+	pcapngByteOrderMagic   = 0x1a2b3c4d
+	pcapngOptionEnd        = 0
+	pcapngOptionComment    = 1
+	pcapngOptionTSResol    = 9
+	pcapngLinkTypeRaw      = 101
+	pcapngTSResolNanos     = 9
+	pcapngBlockOverhead    = 12
+	pcapngPacketHeaderSize = 20
+)
+
+var pcapngEndian = binary.LittleEndian
+
+// pcapngWriter writes raw IP packets with comments as pcapng, which pcapgo can't do
+type pcapngWriter struct {
+	w    io.Writer
+	size int64
+}
+
+// newPcapngWriter writes the section header and the single raw IP interface
+func newPcapngWriter(w io.Writer) (*pcapngWriter, error) {
+	p := &pcapngWriter{w: w}
+	shb := make([]byte, 16)
+	pcapngEndian.PutUint32(shb, pcapngByteOrderMagic)
+	pcapngEndian.PutUint16(shb[4:], 1)
+	// unknown section length
+	pcapngEndian.PutUint64(shb[8:], ^uint64(0))
+	if err := p.block(pcapngSectionHeader, shb); err != nil {
+		return nil, err
+	}
+	idb := make([]byte, 8)
+	pcapngEndian.PutUint16(idb, pcapngLinkTypeRaw)
+	idb = pcapngOption(idb, pcapngOptionTSResol, []byte{pcapngTSResolNanos})
+	idb = pcapngOption(idb, pcapngOptionEnd, nil)
+	return p, p.block(pcapngInterface, idb)
+}
+
+// pcapngOption appends the option padded to 32 bits to b
+func pcapngOption(b []byte, code uint16, value []byte) []byte {
+	var h [4]byte
+	pcapngEndian.PutUint16(h[:], code)
+	pcapngEndian.PutUint16(h[2:], uint16(len(value)))
+	b = append(b, h[:]...)
+	return pcapngPad(append(b, value...))
+}
+
+func pcapngPad(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// block writes the block of the type with the body
+func (p *pcapngWriter) block(typ uint32, body []byte) error {
+	total := uint32(len(body) + pcapngBlockOverhead)
+	b := make([]byte, 8, total)
+	pcapngEndian.PutUint32(b, typ)
+	pcapngEndian.PutUint32(b[4:], total)
+	b = append(b, body...)
+	var t [4]byte
+	pcapngEndian.PutUint32(t[:], total)
+	b = append(b, t[:]...)
+	n, err := p.w.Write(b)
+	p.size += int64(n)
+	return err
+}
+
+// WritePacket writes the packet captured at ts with the comment
+func (p *pcapngWriter) WritePacket(ts time.Time, data []byte, comment string) error {
+	body := make([]byte, pcapngPacketHeaderSize, pcapngPacketHeaderSize+len(data)+len(comment)+12)
+	nanos := uint64(ts.UnixNano())
+	pcapngEndian.PutUint32(body[4:], uint32(nanos>>32))
+	pcapngEndian.PutUint32(body[8:], uint32(nanos))
+	pcapngEndian.PutUint32(body[12:], uint32(len(data)))
+	pcapngEndian.PutUint32(body[16:], uint32(len(data)))
+	body = pcapngPad(append(body, data...))
+	if comment != "" {
+		body = pcapngOption(body, pcapngOptionComment, []byte(comment))
+		body = pcapngOption(body, pcapngOptionEnd, nil)
+	}
+	return p.block(pcapngEnhancedPacket, body)
+}
+
+// udpPacket returns the raw IP packet carrying the payload from src to dst
+func udpPacket(src, dst net.IP, srcPort, dstPort int, payload []byte) ([]byte, error) {
+	udp := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(dstPort)}
+	var network gopacket.NetworkLayer
+	if src.To4() != nil && dst.To4() != nil {
+		network = &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: src.To4(), DstIP: dst.To4()}
+	} else {
+		network = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: src.To16(), DstIP: dst.To16()}
+	}
+	if err := udp.SetNetworkLayerForChecksum(network); err != nil {
+		return nil, err
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, network.(gopacket.SerializableLayer), udp, gopacket.Payload(payload)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sockaddrPort returns the port of the socket address
+func sockaddrPort(sa unix.Sockaddr) int {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return sa.Port
+	case *unix.SockaddrInet6:
+		return sa.Port
+	}
+	return 0
+}
+
+// tappedRequest is the sampled request a send worker is responding to
+type tappedRequest struct {
+	id uint64
+	// time from the request being queued until the worker dequeued the response
+	queueDelay time.Duration
+}
+
+// debugTap writes sampled delay requests and the responses to them as pcapng.
+// Comments of the packets carry the server internals, so one capture shows both the network and the server view
+type debugTap struct {
+	sync.Mutex
+	f       *os.File
+	w       *pcapngWriter
+	sample  uint64
+	maxSize int64
+	// delay requests seen so far, the sampled ones get it as the ID
+	requests uint64
+}
+
+// newDebugTap creates the capture file. One in sample delay requests is written until the file reaches maxSize bytes
+func newDebugTap(path string, sample int, maxSize int64) (*debugTap, error) {
+	if sample <= 0 {
+		return nil, fmt.Errorf("debug tap sample must be positive, got %d", sample)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newPcapngWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &debugTap{f: f, w: w, sample: uint64(sample), maxSize: maxSize}, nil
+}
+
+// sampleRequest returns the ID of the delay request if it's sampled, 0 otherwise
+func (t *debugTap) sampleRequest() uint64 {
+	if t == nil {
+		return 0
+	}
+	n := atomic.AddUint64(&t.requests, 1)
+	if n%t.sample != 0 {
+		return 0
+	}
+	return n
+}
+
+// write writes the packet to the capture. The tap is closed once the capture reaches the size limit
+func (t *debugTap) write(src, dst net.IP, srcPort, dstPort int, payload []byte, ts time.Time, comment string) {
+	data, err := udpPacket(src, dst, srcPort, dstPort, payload)
+	if err != nil {
+		log.Errorf("Debug tap: failed to build the packet: %v", err)
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.w == nil {
+		return
+	}
+	if err := t.w.WritePacket(ts, data, comment); err != nil {
+		log.Errorf("Debug tap: failed to write the packet: %v", err)
+	}
+	if t.maxSize > 0 && t.w.size >= t.maxSize {
+		log.Warningf("Debug tap: %s reached %d bytes, stopping", t.f.Name(), t.w.size)
+		t.close()
+	}
+}
+
+// close closes the capture. Called with the lock held
+func (t *debugTap) close() {
+	if t.w == nil {
+		return
+	}
+	t.w = nil
+	if err := t.f.Close(); err != nil {
+		log.Errorf("Debug tap: failed to close %s: %v", t.f.Name(), err)
+	}
+}
+
+// Close stops the tap
+func (t *debugTap) Close() {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.close()
+}
+
+// request writes the sampled delay request from the client received at rxTS and marks the subscription responding to it
+func (t *debugTap) request(id uint64, sc *SubscriptionClient, l *listener, from unix.Sockaddr, b []byte, rxTS time.Time) {
+	client := timestamp.SockaddrToIP(from)
+	t.write(client, tapLocalIP(l.IP, client), sockaddrPort(from), ptp.PortEvent, b, rxTS, fmt.Sprintf("request=%d iface=%s", id, l.Interface))
+	atomic.StoreInt64(&sc.tapQueued, time.Now().UnixNano())
+	atomic.StoreUint64(&sc.tapID, id)
+}
+
+// tapLocalIP returns the listener IP, the unspecified address of the peer family for wildcard listeners
+func tapLocalIP(ip, peer net.IP) net.IP {
+	if ip != nil && !ip.IsUnspecified() {
+		return ip
+	}
+	if peer.To4() != nil {
+		return net.IPv4zero
+	}
+	return net.IPv6unspecified
+}
+
+// tapped returns the sampled request the subscription is about to respond to. Zero ID if none
+func (sc *SubscriptionClient) tapped(now time.Time) tappedRequest {
+	id := atomic.SwapUint64(&sc.tapID, 0)
+	if id == 0 {
+		return tappedRequest{}
+	}
+	return tappedRequest{id: id, queueDelay: now.Sub(time.Unix(0, atomic.LoadInt64(&sc.tapQueued)))}
+}
+
+// tapResponse writes the response to the sampled request sent from the server port with the worker internals.
+// Zero ts means the send time. Retrieval attempts are reported for responses with the TX timestamp read
+func (s *sendWorker) tapResponse(tr tappedRequest, l *listener, port int, to unix.Sockaddr, b []byte, ts time.Time, txts bool) {
+	if tr.id == 0 || s.config.tap == nil {
+		return
+	}
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	comment := fmt.Sprintf("request=%d worker=%d queue_delay=%v", tr.id, s.id, tr.queueDelay)
+	if txts {
+		comment += fmt.Sprintf(" txts_attempts=%d", s.txtsAttempts)
+	}
+	client := timestamp.SockaddrToIP(to)
+	s.config.tap.write(tapLocalIP(l.IP, client), client, port, sockaddrPort(to), b, ts, comment)
+}
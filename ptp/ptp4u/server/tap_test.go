@@ -0,0 +1,170 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPcapngWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newPcapngWriter(&buf)
+	require.NoError(t, err)
+
+	ts := time.Unix(1700000000, 123456789)
+	data, err := udpPacket(net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), 40000, ptp.PortEvent, []byte{1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, w.WritePacket(ts, data, "request=1 worker=2"))
+	require.NoError(t, w.WritePacket(ts.Add(time.Microsecond), data, ""))
+	require.Equal(t, int64(buf.Len()), w.size)
+	require.Contains(t, buf.String(), "request=1 worker=2")
+
+	r, err := pcapgo.NewNgReader(bytes.NewReader(buf.Bytes()), pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	require.Equal(t, layers.LinkTypeRaw, r.LinkType())
+	got, ci, err := r.ReadPacketData()
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	require.True(t, ts.Equal(ci.Timestamp), ci.Timestamp)
+	_, ci, err = r.ReadPacketData()
+	require.NoError(t, err)
+	require.True(t, ts.Add(time.Microsecond).Equal(ci.Timestamp), ci.Timestamp)
+}
+
+func TestUDPPacket(t *testing.T) {
+	for _, ips := range [][2]string{{"192.0.2.1", "192.0.2.2"}, {"2001:db8::1", "2001:db8::2"}} {
+		data, err := udpPacket(net.ParseIP(ips[0]), net.ParseIP(ips[1]), ptp.PortGeneral, 40000, []byte{1, 2, 3})
+		require.NoError(t, err)
+		p := gopacket.NewPacket(data, layers.LayerTypeIPv4, gopacket.Default)
+		if net.ParseIP(ips[0]).To4() == nil {
+			p = gopacket.NewPacket(data, layers.LayerTypeIPv6, gopacket.Default)
+		}
+		require.Nil(t, p.ErrorLayer())
+		require.Equal(t, ips[0], p.NetworkLayer().NetworkFlow().Src().String())
+		udp := p.TransportLayer().(*layers.UDP)
+		require.Equal(t, layers.UDPPort(ptp.PortGeneral), udp.SrcPort)
+		require.Equal(t, layers.UDPPort(40000), udp.DstPort)
+		require.Equal(t, []byte{1, 2, 3}, udp.Payload)
+	}
+}
+
+func TestTapLocalIP(t *testing.T) {
+	require.Equal(t, net.ParseIP("192.0.2.1"), tapLocalIP(net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")))
+	require.Equal(t, net.IPv4zero, tapLocalIP(net.IPv6unspecified, net.ParseIP("192.0.2.1")))
+	require.Equal(t, net.IPv6unspecified, tapLocalIP(nil, net.ParseIP("2001:db8::1")))
+}
+
+func TestDebugTapSample(t *testing.T) {
+	var nilTap *debugTap
+	require.Zero(t, nilTap.sampleRequest())
+	nilTap.Close()
+
+	_, err := newDebugTap(filepath.Join(t.TempDir(), "tap.pcapng"), 0, 0)
+	require.Error(t, err)
+
+	tap, err := newDebugTap(filepath.Join(t.TempDir(), "tap.pcapng"), 3, 0)
+	require.NoError(t, err)
+	defer tap.Close()
+	var sampled []uint64
+	for i := 0; i < 7; i++ {
+		if id := tap.sampleRequest(); id != 0 {
+			sampled = append(sampled, id)
+		}
+	}
+	require.Equal(t, []uint64{3, 6}, sampled)
+}
+
+func TestDebugTapRequestResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tap.pcapng")
+	tap, err := newDebugTap(path, 1, 0)
+	require.NoError(t, err)
+
+	l := &listener{Listener: Listener{Interface: "eth0", IP: net.ParseIP("2001:db8::1")}}
+	client := timestamp.IPToSockaddr(net.ParseIP("2001:db8::2"), 40000)
+	c := &Config{tap: tap}
+	sc := NewSubscriptionClient(nil, nil, client, client, ptp.MessageDelayResp, c, time.Second, time.Now())
+	w := &sendWorker{id: 2, config: c, txtsAttempts: 3}
+
+	require.Zero(t, sc.tapped(time.Now()).id)
+	rxTS := time.Unix(1700000000, 0)
+	tap.request(tap.sampleRequest(), sc, l, client, []byte{1}, rxTS)
+	tr := sc.tapped(time.Now().Add(time.Millisecond))
+	require.Equal(t, uint64(1), tr.id)
+	require.GreaterOrEqual(t, tr.queueDelay, time.Millisecond)
+	require.Zero(t, sc.tapped(time.Now()).id)
+
+	w.tapResponse(tr, l, ptp.PortEvent, client, []byte{2}, rxTS.Add(time.Millisecond), true)
+	w.tapResponse(tappedRequest{}, l, ptp.PortGeneral, client, []byte{3}, time.Time{}, false)
+	tap.Close()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "request=1 iface=eth0")
+	require.Contains(t, string(b), "request=1 worker=2 queue_delay=")
+	require.Contains(t, string(b), "txts_attempts=3")
+
+	r, err := pcapgo.NewNgReader(bytes.NewReader(b), pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	var payloads [][]byte
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		p := gopacket.NewPacket(data, layers.LayerTypeIPv6, gopacket.Default)
+		udp := p.TransportLayer().(*layers.UDP)
+		payloads = append(payloads, udp.Payload)
+		if len(payloads) == 1 {
+			require.True(t, rxTS.Equal(ci.Timestamp))
+			require.Equal(t, layers.UDPPort(ptp.PortEvent), udp.DstPort)
+		}
+	}
+	// untapped response is not written
+	require.Equal(t, [][]byte{{1}, {2}}, payloads)
+}
+
+func TestDebugTapMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tap.pcapng")
+	tap, err := newDebugTap(path, 1, 1)
+	require.NoError(t, err)
+	ip := net.ParseIP("192.0.2.1")
+	tap.write(ip, ip, 1, 2, []byte{1}, time.Now(), "")
+	require.Nil(t, tap.w)
+	tap.write(ip, ip, 1, 2, []byte{1}, time.Now(), "")
+
+	r, err := os.Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	ng, err := pcapgo.NewNgReader(r, pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	_, _, err = ng.ReadPacketData()
+	require.NoError(t, err)
+	_, _, err = ng.ReadPacketData()
+	require.Error(t, err)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Tenant is a logical group of clients with own quota, clock quality and stats namespace
+type Tenant struct {
+	// Name is used as the stats namespace
+	Name string
+	// Prefixes are client networks in CIDR notation
+	Prefixes []string
+	// Domains are PTP domain numbers clients of the tenant request
+	Domains []uint8
+	// MaxSubscriptions limits running subscriptions of the tenant. 0 is unlimited
+	MaxSubscriptions int64
+	// ClockAccuracy overrides the server clock accuracy if set
+	ClockAccuracy ptp.ClockAccuracy
+	// ClockClass overrides the server clock class if set
+	ClockClass ptp.ClockClass
+
+	nets []*net.IPNet
+}
+
+// ReadTenants reads tenants from the file
+func ReadTenants(path string) ([]*Tenant, error) {
+	tenants := []*Tenant{}
+	cData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(cData, &tenants); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, t := range tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("tenant name is required")
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate tenant %s", t.Name)
+		}
+		names[t.Name] = true
+		for _, p := range t.Prefixes {
+			_, n, err := net.ParseCIDR(p)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", t.Name, err)
+			}
+			t.nets = append(t.nets, n)
+		}
+	}
+	return tenants, nil
+}
+
+// tenantSet matches clients to tenants and keeps track of their subscriptions.
+// Subscriptions are counted by tenant name, so they survive the tenants reload
+type tenantSet struct {
+	sync.RWMutex
+	tenants []*Tenant
+	subs    map[string]int64
+}
+
+func newTenantSet(tenants []*Tenant) *tenantSet {
+	return &tenantSet{tenants: tenants, subs: map[string]int64{}}
+}
+
+// update replaces the tenants
+func (ts *tenantSet) update(tenants []*Tenant) {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.tenants = tenants
+}
+
+// find returns tenant by name
+func (ts *tenantSet) find(name string) *Tenant {
+	for _, t := range ts.tenants {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Match returns name of the tenant client belongs to.
+// Prefixes take precedence over domains. Empty name means no tenant
+func (ts *tenantSet) Match(ip net.IP, domain uint8) string {
+	if ts == nil {
+		return ""
+	}
+	ts.RLock()
+	defer ts.RUnlock()
+	for _, t := range ts.tenants {
+		for _, n := range t.nets {
+			if n.Contains(ip) {
+				return t.Name
+			}
+		}
+	}
+	for _, t := range ts.tenants {
+		for _, d := range t.Domains {
+			if d == domain {
+				return t.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Acquire takes a subscription slot of the tenant. Returns false if quota is exhausted
+func (ts *tenantSet) Acquire(name string) bool {
+	if ts == nil || name == "" {
+		return true
+	}
+	ts.Lock()
+	defer ts.Unlock()
+	if t := ts.find(name); t != nil && t.MaxSubscriptions > 0 && ts.subs[name] >= t.MaxSubscriptions {
+		return false
+	}
+	ts.subs[name]++
+	return true
+}
+
+// Release frees a subscription slot of the tenant
+func (ts *tenantSet) Release(name string) {
+	if ts == nil || name == "" {
+		return
+	}
+	ts.Lock()
+	defer ts.Unlock()
+	ts.subs[name]--
+}
+
+// Subscriptions returns number of running subscriptions per tenant
+func (ts *tenantSet) Subscriptions() map[string]int64 {
+	res := map[string]int64{}
+	if ts == nil {
+		return res
+	}
+	ts.RLock()
+	defer ts.RUnlock()
+	for _, t := range ts.tenants {
+		res[t.Name] = ts.subs[t.Name]
+	}
+	return res
+}
+
+// ClockQuality applies tenant overrides to the server clock quality
+func (ts *tenantSet) ClockQuality(name string, class ptp.ClockClass, accuracy ptp.ClockAccuracy) (ptp.ClockClass, ptp.ClockAccuracy) {
+	if ts == nil || name == "" {
+		return class, accuracy
+	}
+	ts.RLock()
+	defer ts.RUnlock()
+	t := ts.find(name)
+	if t == nil {
+		return class, accuracy
+	}
+	if t.ClockClass != 0 {
+		class = t.ClockClass
+	}
+	if t.ClockAccuracy != 0 {
+		accuracy = t.ClockAccuracy
+	}
+	return class, accuracy
+}
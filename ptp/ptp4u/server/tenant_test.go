@@ -0,0 +1,124 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTenants(t *testing.T, content string) string {
+	f, err := os.CreateTemp(t.TempDir(), "tenants")
+	require.NoError(t, err)
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
+
+func TestReadTenants(t *testing.T) {
+	path := writeTenants(t, `
+- name: lab
+  prefixes:
+  - 2001:db8:1::/48
+  - 192.168.0.0/16
+  maxsubscriptions: 2
+  clockclass: 7
+- name: test
+  domains:
+  - 24
+  clockaccuracy: 254
+`)
+	tenants, err := ReadTenants(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(tenants))
+	require.Equal(t, "lab", tenants[0].Name)
+	require.Equal(t, int64(2), tenants[0].MaxSubscriptions)
+	require.Equal(t, ptp.ClockClass7, tenants[0].ClockClass)
+	require.Equal(t, 2, len(tenants[0].nets))
+	require.Equal(t, []uint8{24}, tenants[1].Domains)
+	require.Equal(t, ptp.ClockAccuracyUnknown, tenants[1].ClockAccuracy)
+}
+
+func TestReadTenantsInvalid(t *testing.T) {
+	_, err := ReadTenants(writeTenants(t, "- prefixes: [10.0.0.0/8]"))
+	require.Error(t, err)
+
+	_, err = ReadTenants(writeTenants(t, "- name: a\n- name: a"))
+	require.Error(t, err)
+
+	_, err = ReadTenants(writeTenants(t, "- name: a\n  prefixes: [10.0.0.0]"))
+	require.Error(t, err)
+}
+
+func TestTenantSetMatch(t *testing.T) {
+	_, n, _ := net.ParseCIDR("192.168.0.0/16")
+	ts := newTenantSet([]*Tenant{
+		{Name: "lab", nets: []*net.IPNet{n}, Domains: []uint8{24}},
+		{Name: "test", Domains: []uint8{24, 25}},
+	})
+	require.Equal(t, "lab", ts.Match(net.ParseIP("192.168.1.1"), 0))
+	require.Equal(t, "lab", ts.Match(net.ParseIP("10.0.0.1"), 24))
+	require.Equal(t, "test", ts.Match(net.ParseIP("10.0.0.1"), 25))
+	require.Equal(t, "", ts.Match(net.ParseIP("10.0.0.1"), 0))
+
+	var nilSet *tenantSet
+	require.Equal(t, "", nilSet.Match(net.ParseIP("192.168.1.1"), 0))
+}
+
+func TestTenantSetQuota(t *testing.T) {
+	ts := newTenantSet([]*Tenant{{Name: "lab", MaxSubscriptions: 2}, {Name: "test"}})
+	require.True(t, ts.Acquire("lab"))
+	require.True(t, ts.Acquire("lab"))
+	require.False(t, ts.Acquire("lab"))
+	require.True(t, ts.Acquire("test"))
+	require.True(t, ts.Acquire(""))
+	require.Equal(t, map[string]int64{"lab": 2, "test": 1}, ts.Subscriptions())
+
+	ts.Release("lab")
+	require.True(t, ts.Acquire("lab"))
+
+	// counts survive the reload
+	ts.update([]*Tenant{{Name: "lab", MaxSubscriptions: 3}})
+	require.Equal(t, map[string]int64{"lab": 2}, ts.Subscriptions())
+	require.True(t, ts.Acquire("lab"))
+	require.False(t, ts.Acquire("lab"))
+}
+
+func TestConfigTenantClockQuality(t *testing.T) {
+	c := &Config{
+		DynamicConfig: DynamicConfig{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100},
+		tenants:       newTenantSet([]*Tenant{{Name: "lab", ClockClass: ptp.ClockClass7}}),
+	}
+
+	class, accuracy := c.TenantClockQuality("lab")
+	require.Equal(t, ptp.ClockClass7, class)
+	require.Equal(t, ptp.ClockAccuracyNanosecond100, accuracy)
+
+	class, accuracy = c.TenantClockQuality("")
+	require.Equal(t, ptp.ClockClass6, class)
+	require.Equal(t, ptp.ClockAccuracyNanosecond100, accuracy)
+
+	c.degraded = 1
+	class, accuracy = c.TenantClockQuality("lab")
+	require.Equal(t, ptp.ClockClass52, class)
+	require.Equal(t, ptp.ClockAccuracyUnknown, accuracy)
+}
@@ -0,0 +1,208 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/facebook/time/phc"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// TimeSourcePHC serves time of the NIC PHC using hardware timestamps
+	TimeSourcePHC = "phc"
+	// TimeSourceSysClock serves CLOCK_REALTIME shifted to TAI using software timestamps
+	TimeSourceSysClock = "sysclock"
+	// TimeSourceSimulated serves virtual time starting at the configured epoch using software timestamps
+	TimeSourceSimulated = "simulated"
+)
+
+// TimeSource is where the server's notion of time comes from
+type TimeSource interface {
+	// EnableTimestamps enables RX and TX timestamps of the source on the socket
+	EnableTimestamps(connFd int) error
+	// RXTimestamp converts socket RX timestamp into the PTP timescale of the source
+	RXTimestamp(ts time.Time) time.Time
+	// TXTimestamp converts socket TX timestamp into the PTP timescale of the source
+	TXTimestamp(ts time.Time) time.Time
+	// Now returns current time of the source in the PTP timescale
+	Now() (time.Time, error)
+}
+
+// NewTimeSource returns the time source selected by config.
+// If time source is not set explicitly it's derived from the timestamp type
+func NewTimeSource(c *Config) (TimeSource, error) {
+	source := c.TimeSource
+	if source == "" {
+		switch c.TimestampType {
+		case timestamp.HWTIMESTAMP:
+			source = TimeSourcePHC
+		case timestamp.SWTIMESTAMP:
+			source = TimeSourceSysClock
+		default:
+			return nil, fmt.Errorf("unrecognized timestamp type: %s", c.TimestampType)
+		}
+	}
+
+	switch source {
+	case TimeSourcePHC:
+		return newPHCTimeSource(c, c.Interface)
+	case TimeSourceSysClock:
+		return &SysClockTimeSource{config: c}, nil
+	case TimeSourceSimulated:
+		return NewAcceleratedTimeSource(c.SimulatedEpoch, c.TimeRate), nil
+	default:
+		return nil, fmt.Errorf("unrecognized time source: %s", source)
+	}
+}
+
+// TimestampTypeOf returns the socket timestamps the time source enables, empty if the source is unknown
+func TimestampTypeOf(source string) string {
+	switch source {
+	case TimeSourcePHC:
+		return timestamp.HWTIMESTAMP
+	case TimeSourceSysClock, TimeSourceSimulated:
+		return timestamp.SWTIMESTAMP
+	}
+	return ""
+}
+
+// newPHCTimeSource returns the time source of the PHC of the interface, corrected by the NIC quirks of config
+func newPHCTimeSource(c *Config, iface string) (*PHCTimeSource, error) {
+	p := &PHCTimeSource{Interface: iface}
+	if c.QuirksFile != "" {
+		quirks, err := timestamp.ReadQuirks(c.QuirksFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading NIC quirks: %w", err)
+		}
+		correction, nic, err := timestamp.CorrectionFor(iface, quirks)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("NIC %s (driver %s, firmware %s, device %s) timestamp correction: RX %v, TX %v", iface, nic.Driver, nic.Firmware, nic.Device, correction.RX, correction.TX)
+		p.Correction = correction
+	}
+	return p, nil
+}
+
+// PHCTimeSource serves time of the NIC PHC
+type PHCTimeSource struct {
+	Interface string
+	// Correction of the NIC model specific timestamp latencies
+	Correction timestamp.Correction
+}
+
+// EnableTimestamps enables hardware timestamps on the socket
+func (p *PHCTimeSource) EnableTimestamps(connFd int) error {
+	return timestamp.EnableHWTimestamps(connFd, p.Interface)
+}
+
+// RXTimestamp returns hardware RX timestamp corrected for the NIC latency. PHC is already in TAI
+func (p *PHCTimeSource) RXTimestamp(ts time.Time) time.Time {
+	return p.Correction.RXTimestamp(ts)
+}
+
+// TXTimestamp returns hardware TX timestamp corrected for the NIC latency. PHC is already in TAI
+func (p *PHCTimeSource) TXTimestamp(ts time.Time) time.Time {
+	return p.Correction.TXTimestamp(ts)
+}
+
+// Now returns current PHC time
+func (p *PHCTimeSource) Now() (time.Time, error) {
+	return phc.Time(p.Interface, phc.MethodIoctlSysOffsetExtended)
+}
+
+// SysClockTimeSource serves CLOCK_REALTIME shifted by the configured UTC offset
+type SysClockTimeSource struct {
+	config *Config
+}
+
+// EnableTimestamps enables software timestamps on the socket
+func (s *SysClockTimeSource) EnableTimestamps(connFd int) error {
+	return timestamp.EnableSWTimestamps(connFd)
+}
+
+// timestamp converts UTC software timestamp into TAI
+func (s *SysClockTimeSource) timestamp(ts time.Time) time.Time {
+	return ts.Add(s.config.UTCOffset)
+}
+
+// RXTimestamp converts UTC software RX timestamp into TAI
+func (s *SysClockTimeSource) RXTimestamp(ts time.Time) time.Time {
+	return s.timestamp(ts)
+}
+
+// TXTimestamp converts UTC software TX timestamp into TAI
+func (s *SysClockTimeSource) TXTimestamp(ts time.Time) time.Time {
+	return s.timestamp(ts)
+}
+
+// Now returns current system time in TAI
+func (s *SysClockTimeSource) Now() (time.Time, error) {
+	return s.timestamp(time.Now()), nil
+}
+
+// SimulatedTimeSource serves virtual time which starts at the epoch
+// and advances with the monotonic clock, ignoring system clock steps
+type SimulatedTimeSource struct {
+	clock *AcceleratedClock
+}
+
+// NewSimulatedTimeSource returns a simulated time source starting at epoch.
+// Zero epoch starts the virtual time at the current system time
+func NewSimulatedTimeSource(epoch time.Time) *SimulatedTimeSource {
+	return NewAcceleratedTimeSource(epoch, 1)
+}
+
+// NewAcceleratedTimeSource returns a simulated time source starting at epoch
+// and advancing rate times faster than the wall clock
+func NewAcceleratedTimeSource(epoch time.Time, rate float64) *SimulatedTimeSource {
+	return &SimulatedTimeSource{clock: NewAcceleratedClock(epoch, rate)}
+}
+
+// Clock returns the UTC clock of the virtual time for the schedulers to run on
+func (s *SimulatedTimeSource) Clock(utcOffset time.Duration) *AcceleratedClock {
+	return s.clock.Shifted(-utcOffset)
+}
+
+// EnableTimestamps enables software timestamps on the socket
+func (s *SimulatedTimeSource) EnableTimestamps(connFd int) error {
+	return timestamp.EnableSWTimestamps(connFd)
+}
+
+// timestamp projects software timestamp onto the virtual timeline
+func (s *SimulatedTimeSource) timestamp(ts time.Time) time.Time {
+	return s.clock.At(ts)
+}
+
+// RXTimestamp projects software RX timestamp onto the virtual timeline
+func (s *SimulatedTimeSource) RXTimestamp(ts time.Time) time.Time {
+	return s.timestamp(ts)
+}
+
+// TXTimestamp projects software TX timestamp onto the virtual timeline
+func (s *SimulatedTimeSource) TXTimestamp(ts time.Time) time.Time {
+	return s.timestamp(ts)
+}
+
+// Now returns current virtual time
+func (s *SimulatedTimeSource) Now() (time.Time, error) {
+	return s.clock.Now(), nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTimeSource(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{TimestampType: timestamp.HWTIMESTAMP, Interface: "eth0"}}
+	ts, err := NewTimeSource(c)
+	require.NoError(t, err)
+	require.Equal(t, &PHCTimeSource{Interface: "eth0"}, ts)
+
+	c.QuirksFile = "/does/not/exist"
+	_, err = NewTimeSource(c)
+	require.Error(t, err)
+	c.QuirksFile = ""
+
+	c.TimestampType = timestamp.SWTIMESTAMP
+	ts, err = NewTimeSource(c)
+	require.NoError(t, err)
+	require.Equal(t, &SysClockTimeSource{config: c}, ts)
+
+	// Explicit time source wins
+	c.TimeSource = TimeSourceSimulated
+	ts, err = NewTimeSource(c)
+	require.NoError(t, err)
+	require.IsType(t, &SimulatedTimeSource{}, ts)
+
+	c.TimeSource = "lol"
+	_, err = NewTimeSource(c)
+	require.Error(t, err)
+
+	c.TimeSource = ""
+	c.TimestampType = "lol"
+	_, err = NewTimeSource(c)
+	require.Error(t, err)
+}
+
+func TestTimestampTypeOf(t *testing.T) {
+	require.Equal(t, timestamp.HWTIMESTAMP, TimestampTypeOf(TimeSourcePHC))
+	require.Equal(t, timestamp.SWTIMESTAMP, TimestampTypeOf(TimeSourceSysClock))
+	require.Equal(t, timestamp.SWTIMESTAMP, TimestampTypeOf(TimeSourceSimulated))
+	require.Equal(t, "", TimestampTypeOf(""))
+	require.Equal(t, "", TimestampTypeOf("lol"))
+}
+
+func TestPHCTimeSourceTimestamp(t *testing.T) {
+	ts := &PHCTimeSource{}
+	now := time.Now()
+	require.Equal(t, now, ts.RXTimestamp(now))
+	require.Equal(t, now, ts.TXTimestamp(now))
+
+	// NIC latencies move timestamps to the reference plane
+	ts.Correction = timestamp.Correction{RX: 20 * time.Nanosecond, TX: 30 * time.Nanosecond}
+	require.Equal(t, now.Add(-20*time.Nanosecond), ts.RXTimestamp(now))
+	require.Equal(t, now.Add(30*time.Nanosecond), ts.TXTimestamp(now))
+}
+
+func TestSysClockTimeSource(t *testing.T) {
+	c := &Config{DynamicConfig: DynamicConfig{UTCOffset: 37 * time.Second}}
+	ts := &SysClockTimeSource{config: c}
+
+	now := time.Unix(1653574589, 0)
+	require.Equal(t, now.Add(37*time.Second), ts.RXTimestamp(now))
+	require.Equal(t, now.Add(37*time.Second), ts.TXTimestamp(now))
+
+	sysNow := time.Now()
+	tai, err := ts.Now()
+	require.NoError(t, err)
+	require.InDelta(t, 37*time.Second, tai.Sub(sysNow), float64(time.Second))
+}
+
+func TestSimulatedTimeSource(t *testing.T) {
+	epoch := time.Date(2016, 12, 31, 23, 59, 0, 0, time.UTC)
+	ts := NewSimulatedTimeSource(epoch)
+
+	now, err := ts.Now()
+	require.NoError(t, err)
+	require.InDelta(t, 0, now.Sub(epoch), float64(time.Second))
+
+	// Socket timestamps are projected onto the virtual timeline
+	sockTS := time.Now().Add(10 * time.Second)
+	require.InDelta(t, 10*time.Second, ts.RXTimestamp(sockTS).Sub(epoch), float64(time.Second))
+
+	// Zero epoch starts at current time
+	ts = NewSimulatedTimeSource(time.Time{})
+	now, err = ts.Now()
+	require.NoError(t, err)
+	require.InDelta(t, 0, time.Since(now), float64(time.Second))
+}
@@ -0,0 +1,163 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// tracedSends is the number of first sends of a subscription which are traced
+const tracedSends = 3
+
+// Tracer starts spans of request traces. It mirrors the part of the OpenTelemetry
+// tracer API used by ptp4u, so an OpenTelemetry tracer can be plugged in with a thin adapter
+type Tracer interface {
+	// Start starts a span which is a child of the span in ctx, if any
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+type requestIDKey struct{}
+
+// RequestID returns ID of the signaling request the trace context belongs to
+func RequestID(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(uint64)
+	return id, ok
+}
+
+// requestTrace follows a single signaling request through grant decision,
+// subscription creation and the first sends
+type requestTrace struct {
+	id     uint64
+	tracer Tracer
+	ctx    context.Context
+	span   Span
+}
+
+// traceRequest assigns an ID to the grant request and starts its trace
+func (s *Server) traceRequest(client ptp.PortIdentity, t ptp.MessageType) *requestTrace {
+	id := atomic.AddUint64(&s.requestIDs, 1)
+	tr := &requestTrace{
+		id:  id,
+		ctx: context.WithValue(context.Background(), requestIDKey{}, id),
+	}
+	log.Debugf("Request %d: %s grant request from %s", tr.id, t, client)
+	if s.Tracer == nil {
+		return tr
+	}
+	tr.tracer = s.Tracer
+	tr.ctx, tr.span = s.Tracer.Start(tr.ctx, "request")
+	tr.span.SetAttribute("request_id", tr.id)
+	tr.span.SetAttribute("client", client.String())
+	tr.span.SetAttribute("type", t.String())
+	return tr
+}
+
+// event records an instant child span of the request
+func (t *requestTrace) event(name string, attrs ...interface{}) {
+	if t == nil {
+		return
+	}
+	log.Debugf("Request %d: %s %v", t.id, name, attrs)
+	if t.tracer == nil {
+		return
+	}
+	_, span := t.tracer.Start(t.ctx, name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		span.SetAttribute(fmt.Sprint(attrs[i]), attrs[i+1])
+	}
+	span.End()
+}
+
+// grant records the grant decision and ends the request span. Zero duration means rejection
+func (t *requestTrace) grant(duration uint32, reason string) {
+	if t == nil {
+		return
+	}
+	t.event("grant", "duration", duration, "reason", reason)
+	if t.span != nil {
+		t.span.SetAttribute("granted", duration > 0)
+		t.span.End()
+	}
+}
+
+// traceSent records one of the first sends of the subscription. Called by the send worker only
+func (sc *SubscriptionClient) traceSent(t ptp.MessageType) {
+	if sc.trace == nil || sc.tracedSends >= tracedSends {
+		return
+	}
+	sc.tracedSends++
+	sc.trace.event("send", "type", t.String(), "sequence", sc.sequenceID)
+}
+
+// LogTracer logs finished spans
+type LogTracer struct{}
+
+type logSpanKey struct{}
+
+// logSpan is a span of LogTracer
+type logSpan struct {
+	sync.Mutex
+	name   string
+	parent string
+	ctx    context.Context
+	start  time.Time
+	attrs  map[string]interface{}
+}
+
+// Start starts a span which is logged when it ends
+func (LogTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &logSpan{name: name, ctx: ctx, start: time.Now(), attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(logSpanKey{}).(*logSpan); ok {
+		span.parent = parent.name
+	}
+	return context.WithValue(ctx, logSpanKey{}, span), span
+}
+
+// SetAttribute sets the span attribute
+func (s *logSpan) SetAttribute(key string, value interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.attrs[key] = value
+}
+
+// End logs the span
+func (s *logSpan) End() {
+	s.Lock()
+	defer s.Unlock()
+	attrs := make([]string, 0, len(s.attrs))
+	for k, v := range s.attrs {
+		attrs = append(attrs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(attrs)
+	id, _ := RequestID(s.ctx)
+	log.Infof("trace request=%d span=%s parent=%s duration=%v %s", id, s.name, s.parent, time.Since(s.start), strings.Join(attrs, " "))
+}
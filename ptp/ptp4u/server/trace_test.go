@@ -0,0 +1,138 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	ended  bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) End()                                       { s.ended = true }
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &testSpan{name: name, attrs: map[string]interface{}{}}
+	span.parent, _ = ctx.Value(testSpanKey{}).(*testSpan)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestTraceRequestIDs(t *testing.T) {
+	s := Server{}
+	client := ptp.PortIdentity{PortNumber: 1, ClockIdentity: 42}
+	first := s.traceRequest(client, ptp.MessageSync)
+	second := s.traceRequest(client, ptp.MessageAnnounce)
+	require.Equal(t, uint64(1), first.id)
+	require.Equal(t, uint64(2), second.id)
+
+	id, ok := RequestID(second.ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), id)
+
+	// no tracer, no spans
+	require.Nil(t, first.span)
+	first.event("subscription.create")
+	first.grant(60, "")
+}
+
+func TestTraceRequestSpans(t *testing.T) {
+	tracer := &testTracer{}
+	s := Server{Tracer: tracer}
+	tr := s.traceRequest(ptp.PortIdentity{PortNumber: 1, ClockIdentity: 42}, ptp.MessageSync)
+	tr.event("subscription.create", "worker", 3)
+	tr.grant(60, "")
+
+	require.Len(t, tracer.spans, 3)
+	root := tracer.spans[0]
+	require.Equal(t, "request", root.name)
+	require.Nil(t, root.parent)
+	require.Equal(t, uint64(1), root.attrs["request_id"])
+	require.Equal(t, "SYNC", root.attrs["type"])
+	require.Equal(t, true, root.attrs["granted"])
+	require.True(t, root.ended)
+
+	create := tracer.spans[1]
+	require.Equal(t, "subscription.create", create.name)
+	require.Equal(t, root, create.parent)
+	require.Equal(t, 3, create.attrs["worker"])
+	require.True(t, create.ended)
+
+	grant := tracer.spans[2]
+	require.Equal(t, "grant", grant.name)
+	require.Equal(t, root, grant.parent)
+	require.Equal(t, uint32(60), grant.attrs["duration"])
+}
+
+func TestTraceRequestRejected(t *testing.T) {
+	tracer := &testTracer{}
+	s := Server{Tracer: tracer}
+	tr := s.traceRequest(ptp.PortIdentity{}, ptp.MessageAnnounce)
+	tr.grant(0, "tenant_quota")
+
+	require.Len(t, tracer.spans, 2)
+	require.Equal(t, false, tracer.spans[0].attrs["granted"])
+	require.Equal(t, "tenant_quota", tracer.spans[1].attrs["reason"])
+}
+
+func TestTraceSent(t *testing.T) {
+	tracer := &testTracer{}
+	s := Server{Tracer: tracer}
+	sc := &SubscriptionClient{}
+	// untraced subscriptions are ignored
+	sc.traceSent(ptp.MessageSync)
+
+	sc.trace = s.traceRequest(ptp.PortIdentity{}, ptp.MessageSync)
+	for i := 0; i < tracedSends+2; i++ {
+		sc.sequenceID++
+		sc.traceSent(ptp.MessageSync)
+	}
+	// root span and the first sends only
+	require.Len(t, tracer.spans, 1+tracedSends)
+	require.Equal(t, "send", tracer.spans[1].name)
+	require.Equal(t, uint16(1), tracer.spans[1].attrs["sequence"])
+	require.Equal(t, uint16(tracedSends), tracer.spans[tracedSends].attrs["sequence"])
+}
+
+func TestLogTracer(t *testing.T) {
+	ctx, root := LogTracer{}.Start(context.WithValue(context.Background(), requestIDKey{}, uint64(7)), "request")
+	_, child := LogTracer{}.Start(ctx, "grant")
+	require.Equal(t, "request", child.(*logSpan).parent)
+	child.SetAttribute("duration", 60)
+	require.Equal(t, 60, child.(*logSpan).attrs["duration"])
+	child.End()
+	root.End()
+
+	id, ok := RequestID(child.(*logSpan).ctx)
+	require.True(t, ok)
+	require.Equal(t, uint64(7), id)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"github.com/facebook/time/phc"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// timestampingInfo describes the current timestamping mode and NIC of the server
+func (s *Server) timestampingInfo() stats.TimestampingInfo {
+	info := stats.TimestampingInfo{Mode: stats.TimestampingSoftware, PHCIndex: -1}
+	if _, ok := unwrapTimeSource(s.Config.timeSrc).(*PHCTimeSource); ok {
+		info.Mode = stats.TimestampingHardware
+		if ts, err := phc.IfaceInfo(s.Config.Interface); err == nil {
+			info.PHCIndex = int(ts.PHCIndex)
+		}
+	}
+	if s.Config.Interface != "" {
+		if nic, err := timestamp.NICInfo(s.Config.Interface); err == nil {
+			info.Driver = nic.Driver
+			info.Firmware = nic.Firmware
+		}
+	}
+	return info
+}
+
+// reportTimestamping exports the timestamping info and logs when it changes.
+// Called by the metric reporting only
+func (s *Server) reportTimestamping() {
+	info := s.timestampingInfo()
+	if info != s.timestamping {
+		log.Infof("Timestamping mode %s, PHC index %d, NIC driver %q, firmware %q", info.Mode, info.PHCIndex, info.Driver, info.Firmware)
+		if info.Mode == stats.TimestampingSoftware {
+			log.Warningf("Serving with software timestamps")
+		}
+		s.timestamping = info
+	}
+	s.Stats.SetTimestampingInfo(info)
+}
@@ -0,0 +1,38 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampingInfo(t *testing.T) {
+	c := &Config{}
+	c.timeSrc = &SysClockTimeSource{config: c}
+	s := &Server{Config: c, Stats: stats.NewJSONStats()}
+	require.Equal(t, stats.TimestampingInfo{Mode: stats.TimestampingSoftware, PHCIndex: -1}, s.timestampingInfo())
+
+	c.Interface = "lolwut"
+	c.timeSrc = &PHCTimeSource{Interface: c.Interface}
+	require.Equal(t, stats.TimestampingInfo{Mode: stats.TimestampingHardware, PHCIndex: -1}, s.timestampingInfo())
+
+	s.reportTimestamping()
+	require.Equal(t, stats.TimestampingHardware, s.timestamping.Mode)
+}
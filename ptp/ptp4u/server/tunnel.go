@@ -0,0 +1,394 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
+	log "github.com/sirupsen/logrus"
+)
+
+// TransportTCP and TransportTLS are experimental stream transports.
+// Messages are neither hardware nor kernel timestamped and are subject to
+// TCP retransmissions and buffering, so they give monitoring-grade accuracy only.
+const (
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+)
+
+// tunnelListen opens the tunnel listener, using TLS if certificate and key are configured
+func (s *Server) tunnelListen() (net.Listener, string, error) {
+	addr := net.JoinHostPort(s.Config.IP.String(), strconv.Itoa(s.Config.TunnelPort))
+	if s.Config.TunnelCertFile == "" && s.Config.TunnelKeyFile == "" {
+		l, err := net.Listen("tcp", addr)
+		return l, TransportTCP, err
+	}
+	cert, err := tls.LoadX509KeyPair(s.Config.TunnelCertFile, s.Config.TunnelKeyFile)
+	if err != nil {
+		return nil, "", err
+	}
+	l, err := tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	return l, TransportTLS, err
+}
+
+// startTunnelListener accepts PTP over TCP/TLS connections
+func (s *Server) startTunnelListener() {
+	l, transport, err := s.tunnelListen()
+	if err != nil {
+		log.Fatalf("Listening error: %s", err)
+	}
+	defer l.Close()
+	log.Warningf("Experimental PTP over %s is enabled on %s. It has reduced accuracy and is meant for monitoring only", transport, l.Addr())
+
+	var backoff time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// back off on temporary errors like running out of file descriptors, like net/http does
+			if backoff == 0 {
+				backoff = 5 * time.Millisecond
+			} else if backoff *= 2; backoff > time.Second {
+				backoff = time.Second
+			}
+			log.Errorf("Failed to accept tunnel connection: %v, retrying in %v", err, backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+		if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok && s.blocklist.Blocked(addr.IP) {
+			s.Stats.IncRXBlocked()
+			conn.Close()
+			continue
+		}
+		t := newTunnelSession(s, conn)
+		go t.handle()
+	}
+}
+
+// tunnelSession serves PTP unicast negotiation and messages over a single stream connection
+type tunnelSession struct {
+	// serializes writes to the connection
+	sync.Mutex
+
+	server *Server
+	conn   net.Conn
+	buf    []byte
+	subs   map[ptp.MessageType]*SubscriptionClient
+	// subscriptions holding the tenant and per client quotas, released on expiry or when the session ends
+	held map[ptp.MessageType]bool
+}
+
+func newTunnelSession(s *Server, conn net.Conn) *tunnelSession {
+	return &tunnelSession{
+		server: s,
+		conn:   conn,
+		buf:    make([]byte, timestamp.PayloadSizeBytes),
+		subs:   map[ptp.MessageType]*SubscriptionClient{},
+		held:   map[ptp.MessageType]bool{},
+	}
+}
+
+// ip returns the address of the client, nil if the connection is not over IP
+func (t *tunnelSession) ip() net.IP {
+	if addr, ok := t.conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+// release gives back the quotas held by the subscription
+func (t *tunnelSession) release(signalingType ptp.MessageType) {
+	if !t.held[signalingType] {
+		return
+	}
+	sc := t.subs[signalingType]
+	t.server.Config.tenants.Release(sc.tenant)
+	t.server.Config.acl.Release(sc.aclKey)
+	delete(t.held, signalingType)
+}
+
+// handle reads messages until the connection is closed
+func (t *tunnelSession) handle() {
+	log.Infof("Tunnel connection from %s", t.conn.RemoteAddr())
+	ctx, cancel := context.WithCancel(t.server.ctx)
+	defer cancel()
+	defer t.conn.Close()
+	defer func() {
+		for signalingType := range t.held {
+			t.release(signalingType)
+		}
+	}()
+
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+	signaling := &ptp.Signaling{}
+	dReq := &ptp.SyncDelayReq{}
+	zerotlv := []ptp.TLV{}
+
+	for {
+		n, err := ptp.ReadStreamPacket(t.conn, buf)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Errorf("Failed to read tunnel packet from %s: %v", t.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		// no socket timestamps here, so take the time as soon as possible after reading
+		rxTS, err := t.server.Config.timeSrc.Now()
+		if err != nil {
+			log.Errorf("Failed to get current time: %v", err)
+			return
+		}
+
+		msgType, err := ptp.ProbeMsgType(buf[:n])
+		if err != nil {
+			log.Errorf("Failed to probe the ptp message type: %v", err)
+			continue
+		}
+
+		switch msgType {
+		case ptp.MessageSignaling:
+			signaling.TLVs = zerotlv
+			if err := ptp.FromBytes(buf[:n], signaling); err != nil {
+				log.Error(err)
+				continue
+			}
+			t.handleSignaling(ctx, signaling)
+		case ptp.MessageDelayReq:
+			t.server.Stats.IncRX(msgType)
+			if err := ptp.FromBytes(buf[:n], dReq); err != nil {
+				log.Errorf("Failed to read the ptp SyncDelayReq: %v", err)
+				continue
+			}
+			sc, ok := t.subs[ptp.MessageDelayResp]
+			if !ok || sc.Expired() {
+				log.Infof("Delay request from %s is not in the subscription list", t.conn.RemoteAddr())
+				continue
+			}
+			sc.UpdateDelayResp(&dReq.Header, rxTS)
+			if err := t.write(sc.DelayResp()); err != nil {
+				log.Errorf("Failed to send the delay response: %v", err)
+				return
+			}
+			t.server.Stats.IncTX(ptp.MessageDelayResp)
+		default:
+			log.Errorf("Got unsupported message type %s(%d)", msgType, msgType)
+		}
+	}
+}
+
+// handleSignaling grants or cancels subscriptions requested over the tunnel.
+// Grants go through the same admission as the ones received over UDP
+func (t *tunnelSession) handleSignaling(ctx context.Context, signaling *ptp.Signaling) {
+	s := t.server
+	ip := t.ip()
+	client := ip.String()
+	hint, hinted := ptp.FindGrantHint(signaling.TLVs)
+	for _, tlv := range signaling.TLVs {
+		switch v := tlv.(type) {
+		case *ptp.RequestUnicastTransmissionTLV:
+			signalingType := v.MsgTypeAndReserved.MsgType()
+			s.Stats.IncRXSignalingGrant(signalingType)
+			s.Stats.IncClientRXSignaling(client)
+			log.Debugf("Got %s grant request over tunnel", signalingType)
+			durationt := time.Duration(v.DurationField) * time.Second
+			expire := s.Config.Clock().Now().Add(durationt)
+			intervalt := v.LogInterMessagePeriod.Duration()
+
+			switch signalingType {
+			case ptp.MessageAnnounce, ptp.MessageSync, ptp.MessageDelayResp:
+				// Deny clients refused by the ACL, the request rate or the policy before any state is created
+				reason := s.aclDenied(ip)
+				if reason == "" {
+					reason = s.policyDenied(ip, signaling, v)
+				}
+				if reason != "" {
+					s.Stats.IncClientDenied(client)
+					deny := NewSubscriptionClient(nil, nil, nil, nil, signalingType, s.Config, intervalt, s.Config.Clock().Now())
+					if err := t.grant(deny, signaling, v, 0); err != nil {
+						log.Errorf("Failed to send the unicast signaling: %v", err)
+						return
+					}
+					continue
+				}
+
+				sc, ok := t.subs[signalingType]
+				if !ok {
+					sc = NewSubscriptionClient(nil, nil, nil, nil, signalingType, s.Config, intervalt, expire)
+					sc.tenant = s.Config.tenants.Match(ip, signaling.Header.DomainNumber)
+					t.subs[signalingType] = sc
+				} else {
+					// the previous subscription is over, it gets the quotas again if admitted
+					if sc.Expired() {
+						t.release(signalingType)
+					}
+					sc.SetExpire(expire)
+					sc.SetInterval(intervalt)
+				}
+
+				duration := v.DurationField
+				if reason := s.admitGrant(s.Stats, sc, ip, intervalt, durationt, !t.held[signalingType]); reason != "" {
+					s.Stats.IncClientDenied(client)
+					duration = 0
+					sc.SetExpire(s.Config.Clock().Now())
+					t.release(signalingType)
+				} else {
+					t.held[signalingType] = true
+					duration = s.grantDuration(sc, ip, v.DurationField, hint, hinted)
+					if duration != v.DurationField {
+						sc.SetExpire(s.Config.Clock().Now().Add(time.Duration(duration) * time.Second))
+					}
+					s.Stats.IncClientSubscription(client)
+				}
+				if err := t.grant(sc, signaling, v, duration); err != nil {
+					log.Errorf("Failed to send the unicast signaling: %v", err)
+					return
+				}
+
+				if duration != 0 && signalingType != ptp.MessageDelayResp && !sc.Running() {
+					sc.setRunning(true)
+					go t.runSubscription(ctx, sc)
+				}
+			default:
+				s.Stats.IncClientDenied(client)
+				log.Errorf("Got unsupported grant type %s", signalingType)
+			}
+		case *ptp.CancelUnicastTransmissionTLV:
+			signalingType := v.MsgTypeAndFlags.MsgType()
+			s.Stats.IncRXSignalingCancel(signalingType)
+			log.Debugf("Got %s cancel request over tunnel", signalingType)
+			if sc, ok := t.subs[signalingType]; ok {
+				sc.SetExpire(s.Config.Clock().Now())
+				t.release(signalingType)
+			}
+		case *ptp.AuthenticationTLV:
+			// verified on receipt
+		default:
+			log.Errorf("Got unsupported message type %s(%d)", signaling.MessageType(), signaling.MessageType())
+		}
+	}
+}
+
+// grant sends the grant of the requested duration, nothing in standby
+func (t *tunnelSession) grant(sc *SubscriptionClient, signaling *ptp.Signaling, v *ptp.RequestUnicastTransmissionTLV, duration uint32) error {
+	if t.server.Config.Standby {
+		t.server.Stats.IncStandbySuppressed(ptp.MessageSignaling)
+		return nil
+	}
+	if err := t.writeSignaling(sc, func() { sc.UpdateSignalingGrant(signaling, v.MsgTypeAndReserved, v.LogInterMessagePeriod, duration) }); err != nil {
+		return err
+	}
+	t.server.Stats.IncTXSignalingGrant(v.MsgTypeAndReserved.MsgType())
+	return nil
+}
+
+// runSubscription periodically sends subscribed messages until expiry or connection close
+func (t *tunnelSession) runSubscription(ctx context.Context, sc *SubscriptionClient) {
+	defer sc.setRunning(false)
+	clock := t.server.Config.Clock()
+	runningInterval := sc.Interval()
+	ticker := time.NewTicker(clock.Wall(runningInterval))
+	defer ticker.Stop()
+
+	for {
+		if err := t.sendSubscription(sc); err != nil {
+			log.Errorf("Failed to send %s over tunnel: %v", sc.subscriptionType, err)
+			t.conn.Close()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if sc.Expired() {
+			if err := t.writeSignaling(sc, sc.UpdateSignalingCancel); err == nil {
+				t.server.Stats.IncTXSignalingCancel(sc.subscriptionType)
+			}
+			return
+		}
+		// check if interval changed, maybe update our ticker
+		if interval := sc.Interval(); runningInterval != interval {
+			runningInterval = interval
+			ticker.Reset(clock.Wall(runningInterval))
+		}
+	}
+}
+
+// sendSubscription sends a single round of subscribed messages
+func (t *tunnelSession) sendSubscription(sc *SubscriptionClient) error {
+	switch sc.subscriptionType {
+	case ptp.MessageSync:
+		sc.UpdateSync()
+		if err := t.write(sc.Sync()); err != nil {
+			return err
+		}
+		// best we can do without TX timestamps is the time right after handing the message to the kernel
+		txTS, err := t.server.Config.timeSrc.Now()
+		if err != nil {
+			return err
+		}
+		t.server.Stats.IncTX(ptp.MessageSync)
+		sc.UpdateFollowup(txTS)
+		if err := t.write(sc.Followup()); err != nil {
+			return err
+		}
+		t.server.Stats.IncTX(ptp.MessageFollowUp)
+	case ptp.MessageAnnounce:
+		sc.UpdateAnnounce()
+		if err := t.write(sc.Announce()); err != nil {
+			return err
+		}
+		t.server.Stats.IncTX(ptp.MessageAnnounce)
+	}
+	sc.IncSequenceID()
+	return nil
+}
+
+// writeSignaling updates the signaling packet of the subscription and sends it
+func (t *tunnelSession) writeSignaling(sc *SubscriptionClient, update func()) error {
+	t.Lock()
+	defer t.Unlock()
+	update()
+	return t.writeLocked(sc.Signaling())
+}
+
+// write sends a single packet over the tunnel
+func (t *tunnelSession) write(p ptp.BinaryMarshalerTo) error {
+	t.Lock()
+	defer t.Unlock()
+	return t.writeLocked(p)
+}
+
+func (t *tunnelSession) writeLocked(p ptp.BinaryMarshalerTo) error {
+	n, err := ptp.BytesTo(p, t.buf)
+	if err != nil {
+		return err
+	}
+	return ptp.WriteStreamPacket(t.conn, t.buf[:n])
+}
@@ -0,0 +1,184 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func tunnelRequest(what ptp.MessageType, interval ptp.LogInterval, duration uint32) *ptp.Signaling {
+	return &ptp.Signaling{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0),
+			Version:         ptp.Version,
+			MessageLength:   uint16(binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.RequestUnicastTransmissionTLV{})),
+			FlagField:       ptp.FlagUnicast,
+			SourcePortIdentity: ptp.PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: 5678,
+			},
+		},
+		TLVs: []ptp.TLV{
+			&ptp.RequestUnicastTransmissionTLV{
+				TLVHead: ptp.TLVHead{
+					TLVType:     ptp.TLVRequestUnicastTransmission,
+					LengthField: uint16(binary.Size(ptp.RequestUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
+				},
+				MsgTypeAndReserved:    ptp.NewUnicastMsgTypeAndFlags(what, 0),
+				LogInterMessagePeriod: interval,
+				DurationField:         duration,
+			},
+		},
+	}
+}
+
+func tunnelWrite(t *testing.T, conn net.Conn, p ptp.Packet) {
+	b, err := ptp.Bytes(p)
+	require.NoError(t, err)
+	require.NoError(t, ptp.WriteStreamPacket(conn, b))
+}
+
+func tunnelRead(t *testing.T, conn net.Conn) ptp.Packet {
+	buf := make([]byte, 1024)
+	n, err := ptp.ReadStreamPacket(conn, buf)
+	require.NoError(t, err)
+	p, err := ptp.DecodePacket(buf[:n])
+	require.NoError(t, err)
+	return p
+}
+
+func TestTunnelSession(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{
+			MaxSubDuration: time.Hour,
+			MinSubInterval: time.Second,
+			UTCOffset:      37 * time.Second,
+		},
+	}
+	c.timeSrc = &SysClockTimeSource{config: c}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Server{Config: c, Stats: stats.NewJSONStats(), ctx: ctx}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go newTunnelSession(s, server).handle()
+
+	// sync is granted and sent right away
+	tunnelWrite(t, client, tunnelRequest(ptp.MessageSync, 0, 10))
+	grant := tunnelRead(t, client).(*ptp.Signaling)
+	require.Equal(t, uint32(10), grant.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).DurationField)
+	require.Equal(t, ptp.ClockIdentity(5678), grant.TargetPortIdentity.ClockIdentity)
+	require.Equal(t, ptp.MessageSync, tunnelRead(t, client).MessageType())
+	followup := tunnelRead(t, client).(*ptp.FollowUp)
+	require.WithinDuration(t, time.Now().Add(c.UTCOffset), followup.PreciseOriginTimestamp.Time(), time.Second)
+
+	// delay request is answered only when subscribed
+	tunnelWrite(t, client, tunnelRequest(ptp.MessageDelayResp, 0, 10))
+	grant = tunnelRead(t, client).(*ptp.Signaling)
+	require.Equal(t, uint32(10), grant.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).DurationField)
+
+	dReq := &ptp.SyncDelayReq{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageDelayReq, 0),
+			Version:         ptp.Version,
+			MessageLength:   uint16(binary.Size(ptp.SyncDelayReq{})),
+			SequenceID:      42,
+		},
+	}
+	tunnelWrite(t, client, dReq)
+	dResp := tunnelRead(t, client).(*ptp.DelayResp)
+	require.Equal(t, uint16(42), dResp.SequenceID)
+	require.WithinDuration(t, time.Now().Add(c.UTCOffset), dResp.ReceiveTimestamp.Time(), time.Second)
+}
+
+func TestTunnelSessionReject(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{
+			MaxSubDuration: time.Hour,
+			MinSubInterval: time.Second,
+		},
+	}
+	c.timeSrc = &SysClockTimeSource{config: c}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Server{Config: c, Stats: stats.NewJSONStats(), ctx: ctx}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go newTunnelSession(s, server).handle()
+
+	// interval below the limit
+	tunnelWrite(t, client, tunnelRequest(ptp.MessageAnnounce, -1, 10))
+	grant := tunnelRead(t, client).(*ptp.Signaling)
+	require.Equal(t, uint32(0), grant.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).DurationField)
+}
+
+func TestTunnelSessionAdmission(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{
+			MaxSubDuration: time.Hour,
+			MinSubInterval: time.Second,
+		},
+		acl: newAccessControl(&ACL{MaxSubscriptions: 1}),
+	}
+	c.timeSrc = &SysClockTimeSource{config: c}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	st := stats.NewJSONStats()
+	s := &Server{Config: c, Stats: st, ctx: ctx}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go newTunnelSession(s, server).handle()
+
+	// first subscription of the client is granted
+	tunnelWrite(t, client, tunnelRequest(ptp.MessageDelayResp, 0, 10))
+	grant := tunnelRead(t, client).(*ptp.Signaling)
+	require.Equal(t, uint32(10), grant.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).DurationField)
+
+	// renewal doesn't take another slot
+	tunnelWrite(t, client, tunnelRequest(ptp.MessageDelayResp, 0, 10))
+	grant = tunnelRead(t, client).(*ptp.Signaling)
+	require.Equal(t, uint32(10), grant.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).DurationField)
+
+	// second one is over the per client limit
+	tunnelWrite(t, client, tunnelRequest(ptp.MessageAnnounce, 0, 10))
+	grant = tunnelRead(t, client).(*ptp.Signaling)
+	require.Equal(t, uint32(0), grant.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).DurationField)
+	st.Snapshot()
+	require.Equal(t, int64(1), st.Report()["denied.clientlimit"])
+
+	// nothing is granted while drained, the slot is given back
+	s.GracefulDrain(false)
+	tunnelWrite(t, client, tunnelRequest(ptp.MessageDelayResp, 0, 10))
+	grant = tunnelRead(t, client).(*ptp.Signaling)
+	require.Equal(t, uint32(0), grant.TLVs[0].(*ptp.GrantUnicastTransmissionTLV).DurationField)
+	_, ok := c.acl.Acquire(nil)
+	require.True(t, ok)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/servo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Grandmaster is the grandmaster advertised to clients in Announce messages
+type Grandmaster struct {
+	Identity                ptp.ClockIdentity
+	Priority1               uint8
+	Priority2               uint8
+	ClockClass              ptp.ClockClass
+	ClockAccuracy           ptp.ClockAccuracy
+	OffsetScaledLogVariance uint16
+	StepsRemoved            uint16
+}
+
+// upstreamSync is how well ptp4l is synchronized to its master
+type upstreamSync struct {
+	Offset    time.Duration
+	PathDelay time.Duration
+	State     servo.State
+}
+
+// upstream follows the grandmaster ptp4l is synchronized to in boundary mode,
+// so clients see the real grandmaster instead of ptp4u itself
+type upstream struct {
+	// fetch returns the grandmaster of ptp4l and the sync to it, nil if ptp4l has no upstream
+	fetch func() (*Grandmaster, *upstreamSync, error)
+
+	sync.Mutex
+	gm     *Grandmaster
+	synced *upstreamSync
+}
+
+func newUpstream(socket string, domain uint8, timeout time.Duration) *upstream {
+	return &upstream{
+		fetch: func() (*Grandmaster, *upstreamSync, error) { return fetchUpstream(socket, domain, timeout) },
+	}
+}
+
+// check refreshes the upstream grandmaster. It is forgotten if ptp4l can't be read,
+// so stale upstream is never advertised
+func (u *upstream) check() {
+	gm, us, err := u.fetch()
+	if err != nil {
+		log.Warningf("Upstream check: %v", err)
+		gm, us = nil, nil
+	}
+	if gm == nil {
+		us = nil
+	}
+	u.Lock()
+	defer u.Unlock()
+	if (u.gm == nil) != (gm == nil) || (gm != nil && gm.Identity != u.gm.Identity) {
+		if gm == nil {
+			log.Warningf("Lost upstream grandmaster, announcing ourselves")
+		} else {
+			log.Infof("Upstream grandmaster %s, steps removed %d", gm.Identity, gm.StepsRemoved)
+		}
+	}
+	u.gm = gm
+	u.synced = us
+}
+
+// Grandmaster returns the upstream grandmaster, nil if there is none
+func (u *upstream) Grandmaster() *Grandmaster {
+	if u == nil {
+		return nil
+	}
+	u.Lock()
+	defer u.Unlock()
+	return u.gm
+}
+
+// Sync returns the sync to the upstream grandmaster, nil if there is none
+func (u *upstream) Sync() *upstreamSync {
+	if u == nil {
+		return nil
+	}
+	u.Lock()
+	defer u.Unlock()
+	return u.synced
+}
+
+// fetchUpstream reads the parent, current and port data sets of ptp4l running on the domain over its management socket
+func fetchUpstream(socket string, domain uint8, timeout time.Duration) (*Grandmaster, *upstreamSync, error) {
+	addr, err := net.ResolveUnixAddr("unixgram", socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	local := filepath.Join("/var/run/", fmt.Sprintf("ptp4u.%d.upstream.sock", os.Getpid()))
+	localAddr, _ := net.ResolveUnixAddr("unixgram", local)
+	conn, err := net.DialUnix("unixgram", localAddr, addr)
+	// make sure there is no leftover socket
+	defer os.RemoveAll(local)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to ptp4l: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, nil, err
+	}
+
+	c := &ptp.MgmtClient{Connection: conn, DomainNumber: domain}
+	dds, err := c.DefaultDataSet()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting DEFAULT_DATA_SET from ptp4l: %w", err)
+	}
+	pds, err := c.ParentDataSet()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting PARENT_DATA_SET from ptp4l: %w", err)
+	}
+	cds, err := c.CurrentDataSet()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting CURRENT_DATA_SET from ptp4l: %w", err)
+	}
+	pods, err := c.PortDataSet()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting PORT_DATA_SET from ptp4l: %w", err)
+	}
+	return upstreamGrandmaster(dds, pds, cds), upstreamSyncOf(cds, pods), nil
+}
+
+// upstreamGrandmaster returns the grandmaster of ptp4l data sets, nil if ptp4l is the grandmaster itself.
+// ptp4u shares the clock with ptp4l, so steps removed are announced as seen by ptp4l
+func upstreamGrandmaster(dds *ptp.DefaultDataSetTLV, pds *ptp.ParentDataSetTLV, cds *ptp.CurrentDataSetTLV) *Grandmaster {
+	if pds.GrandmasterIdentity == dds.ClockIdentity {
+		return nil
+	}
+	return &Grandmaster{
+		Identity:                pds.GrandmasterIdentity,
+		Priority1:               pds.GrandmasterPriority1,
+		Priority2:               pds.GrandmasterPriority2,
+		ClockClass:              pds.GrandmasterClockQuality.ClockClass,
+		ClockAccuracy:           pds.GrandmasterClockQuality.ClockAccuracy,
+		OffsetScaledLogVariance: pds.GrandmasterClockQuality.OffsetScaledLogVariance,
+		StepsRemoved:            cds.StepsRemoved,
+	}
+}
+
+// upstreamSyncOf returns the sync of ptp4l to its master. ptp4l doesn't expose the servo,
+// the port state tells whether it is locked or still stepping the clock
+func upstreamSyncOf(cds *ptp.CurrentDataSetTLV, pds *ptp.PortDataSetTLV) *upstreamSync {
+	us := &upstreamSync{
+		Offset:    time.Duration(cds.OffsetFromMaster.Nanoseconds()),
+		PathDelay: time.Duration(cds.MeanPathDelay.Nanoseconds()),
+		State:     servo.StateInit,
+	}
+	switch pds.PortState {
+	case ptp.PortStateSlave:
+		us.State = servo.StateLocked
+	case ptp.PortStateUncalibrated:
+		us.State = servo.StateJump
+	}
+	return us
+}
+
+// startUpstreamCheck periodically refreshes the upstream grandmaster
+func (s *Server) startUpstreamCheck() {
+	for ; true; <-time.After(s.Config.UpstreamInterval) {
+		s.Config.upstream.check()
+		s.setUpstreamStats()
+	}
+}
+
+// setUpstreamStats publishes the sync to the upstream master, so the quality of the served time can be judged
+func (s *Server) setUpstreamStats() {
+	us := s.Config.upstream.Sync()
+	if us == nil {
+		us = &upstreamSync{}
+	}
+	s.Stats.SetUpstreamOffset(int64(us.Offset))
+	s.Stats.SetUpstreamPathDelay(int64(us.PathDelay))
+	s.Stats.SetUpstreamServoState(int64(us.State))
+}
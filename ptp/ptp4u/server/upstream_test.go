@@ -0,0 +1,165 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/ptp4u/stats"
+	"github.com/facebook/time/servo"
+	"github.com/facebook/time/timestamp"
+	"github.com/stretchr/testify/require"
+)
+
+var testUpstreamGM = &Grandmaster{
+	Identity:                ptp.ClockIdentity(0xabcd),
+	Priority1:               100,
+	Priority2:               110,
+	ClockClass:              ptp.ClockClass6,
+	ClockAccuracy:           ptp.ClockAccuracyNanosecond100,
+	OffsetScaledLogVariance: 0x4e5d,
+	StepsRemoved:            2,
+}
+
+func TestUpstreamGrandmaster(t *testing.T) {
+	dds := &ptp.DefaultDataSetTLV{ClockIdentity: ptp.ClockIdentity(1234)}
+	pds := &ptp.ParentDataSetTLV{
+		GrandmasterPriority1: 100,
+		GrandmasterClockQuality: ptp.ClockQuality{
+			ClockClass:              ptp.ClockClass6,
+			ClockAccuracy:           ptp.ClockAccuracyNanosecond100,
+			OffsetScaledLogVariance: 0x4e5d,
+		},
+		GrandmasterPriority2: 110,
+		GrandmasterIdentity:  ptp.ClockIdentity(0xabcd),
+	}
+	cds := &ptp.CurrentDataSetTLV{StepsRemoved: 2}
+	require.Equal(t, testUpstreamGM, upstreamGrandmaster(dds, pds, cds))
+
+	// ptp4l is the grandmaster itself
+	pds.GrandmasterIdentity = dds.ClockIdentity
+	require.Nil(t, upstreamGrandmaster(dds, pds, cds))
+}
+
+func TestUpstreamSync(t *testing.T) {
+	cds := &ptp.CurrentDataSetTLV{OffsetFromMaster: ptp.NewTimeInterval(-42), MeanPathDelay: ptp.NewTimeInterval(1500)}
+	pds := &ptp.PortDataSetTLV{PortState: ptp.PortStateSlave}
+	require.Equal(t, &upstreamSync{Offset: -42, PathDelay: 1500, State: servo.StateLocked}, upstreamSyncOf(cds, pds))
+
+	pds.PortState = ptp.PortStateUncalibrated
+	require.Equal(t, servo.StateJump, upstreamSyncOf(cds, pds).State)
+	pds.PortState = ptp.PortStateListening
+	require.Equal(t, servo.StateInit, upstreamSyncOf(cds, pds).State)
+}
+
+func TestUpstreamCheck(t *testing.T) {
+	var err error
+	us := &upstreamSync{Offset: -42, PathDelay: 1500, State: servo.StateLocked}
+	u := &upstream{fetch: func() (*Grandmaster, *upstreamSync, error) { return testUpstreamGM, us, err }}
+	require.Nil(t, u.Grandmaster())
+	require.Nil(t, u.Sync())
+
+	u.check()
+	require.Equal(t, testUpstreamGM, u.Grandmaster())
+	require.Equal(t, us, u.Sync())
+
+	st := stats.NewJSONStats()
+	s := &Server{Config: &Config{upstream: u}, Stats: st}
+	s.setUpstreamStats()
+	require.Equal(t, int64(-42), st.Live()["upstream.offset_ns"])
+	require.Equal(t, int64(1500), st.Live()["upstream.path_delay_ns"])
+	require.Equal(t, int64(servo.StateLocked), st.Live()["upstream.servo_state"])
+
+	// stale upstream is forgotten
+	err = fmt.Errorf("nope")
+	u.check()
+	require.Nil(t, u.Grandmaster())
+	require.Nil(t, u.Sync())
+	s.setUpstreamStats()
+	require.Equal(t, int64(0), st.Live()["upstream.offset_ns"])
+	require.Equal(t, int64(servo.StateInit), st.Live()["upstream.servo_state"])
+
+	var nilUpstream *upstream
+	require.Nil(t, nilUpstream.Grandmaster())
+	require.Nil(t, nilUpstream.Sync())
+}
+
+func TestConfigGrandmaster(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{DefaultPriority1: 128, DefaultPriority2: 128},
+		DynamicConfig: DynamicConfig{
+			ClockClass:    ptp.ClockClass7,
+			ClockAccuracy: ptp.ClockAccuracyMicrosecond1,
+		},
+	}
+	self := Grandmaster{
+		Identity:                ptp.ClockIdentity(1234),
+		Priority1:               128,
+		Priority2:               128,
+		ClockClass:              ptp.ClockClass7,
+		ClockAccuracy:           ptp.ClockAccuracyMicrosecond1,
+		OffsetScaledLogVariance: 23008,
+	}
+	require.Equal(t, self, c.Grandmaster(""))
+
+	c.upstream = &upstream{gm: testUpstreamGM}
+	require.Equal(t, *testUpstreamGM, c.Grandmaster(""))
+
+	// degraded server announces itself
+	c.degraded = 1
+	self.ClockClass, self.ClockAccuracy = ptp.ClockClass52, ptp.ClockAccuracyUnknown
+	require.Equal(t, self, c.Grandmaster(""))
+}
+
+func TestAnnounceUpstream(t *testing.T) {
+	w := &sendWorker{}
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		DynamicConfig: DynamicConfig{
+			ClockClass:    ptp.ClockClass7,
+			ClockAccuracy: ptp.ClockAccuracyMicrosecond1,
+		},
+		upstream: &upstream{gm: testUpstreamGM},
+	}
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Time{})
+	sc.UpdateAnnounce()
+
+	a := sc.Announce()
+	require.Equal(t, ptp.ClockIdentity(1234), a.SourcePortIdentity.ClockIdentity)
+	require.Equal(t, testUpstreamGM.Identity, a.GrandmasterIdentity)
+	require.Equal(t, testUpstreamGM.StepsRemoved, a.StepsRemoved)
+	require.Equal(t, testUpstreamGM.Priority1, a.GrandmasterPriority1)
+	require.Equal(t, testUpstreamGM.Priority2, a.GrandmasterPriority2)
+	require.Equal(t, ptp.ClockQuality{
+		ClockClass:              ptp.ClockClass6,
+		ClockAccuracy:           ptp.ClockAccuracyNanosecond100,
+		OffsetScaledLogVariance: 0x4e5d,
+	}, a.GrandmasterClockQuality)
+
+	// upstream lost
+	c.upstream.gm = nil
+	sc.UpdateAnnounceDelayReq(ptp.NewCorrection(0), 1)
+	require.Equal(t, ptp.ClockIdentity(1234), a.GrandmasterIdentity)
+	require.Equal(t, uint16(0), a.StepsRemoved)
+	require.Equal(t, ptp.ClockClass7, a.GrandmasterClockQuality.ClockClass)
+}
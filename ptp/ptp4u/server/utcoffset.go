@@ -0,0 +1,97 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/facebook/time/leapsectz"
+	"github.com/facebook/time/phc"
+	log "github.com/sirupsen/logrus"
+)
+
+// utcOffsetChecker compares UTC offset advertised to clients with the
+// kernel TAI offset and the leap second file, as any disagreement means
+// one of them is about to serve or steer clocks by whole seconds
+type utcOffsetChecker struct {
+	// kernel returns kernel TAI offset, zero if never set
+	kernel func() (time.Duration, error)
+	// leapFile returns current UTC offset according to the leap second file
+	leapFile func() (time.Duration, error)
+	// advertised returns UTC offset announced to clients
+	advertised func() time.Duration
+
+	alarm int64
+}
+
+func newUTCOffsetChecker(leapFile string, advertised func() time.Duration) *utcOffsetChecker {
+	return &utcOffsetChecker{
+		kernel:     phc.TAIOffset,
+		leapFile:   func() (time.Duration, error) { return leapsectz.UTCOffset(leapFile) },
+		advertised: advertised,
+	}
+}
+
+// check raises the alarm if any of the available sources disagree.
+// Sources which can't be read are skipped, as well as the kernel offset if it was never set
+func (u *utcOffsetChecker) check() {
+	advertised := u.advertised()
+	mismatch := false
+
+	kernel, err := u.kernel()
+	if err != nil {
+		log.Warningf("UTC offset check: %v", err)
+	} else if kernel == 0 {
+		log.Debugf("UTC offset check: kernel TAI offset is not set")
+	} else if kernel != advertised {
+		mismatch = true
+	}
+
+	leapFile, err := u.leapFile()
+	if err != nil {
+		log.Warningf("UTC offset check: reading leap second file: %v", err)
+	} else if leapFile != advertised {
+		mismatch = true
+	}
+
+	if mismatch {
+		log.Errorf("UTC offset mismatch: advertised %v, kernel TAI offset %v, leap second file %v", advertised, kernel, leapFile)
+		atomic.StoreInt64(&u.alarm, 1)
+		return
+	}
+	atomic.StoreInt64(&u.alarm, 0)
+}
+
+// Alarm returns 1 if UTC offset sources disagree
+func (u *utcOffsetChecker) Alarm() int64 {
+	return atomic.LoadInt64(&u.alarm)
+}
+
+// startUTCOffsetCheck periodically checks UTC offset consistency
+func (s *Server) startUTCOffsetCheck() {
+	for ; true; <-time.After(s.Config.UTCOffsetCheckInterval) {
+		s.utcOffsetCheck.check()
+	}
+}
+
+// advertisedUTCOffset returns UTC offset currently announced to clients
+func (s *Server) advertisedUTCOffset() time.Duration {
+	dcMux.Lock()
+	defer dcMux.Unlock()
+	return s.Config.UTCOffset
+}
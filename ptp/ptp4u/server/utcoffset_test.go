@@ -0,0 +1,64 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUTCOffsetChecker(t *testing.T) {
+	offset := func(d time.Duration, err error) func() (time.Duration, error) {
+		return func() (time.Duration, error) { return d, err }
+	}
+	tests := []struct {
+		name     string
+		kernel   func() (time.Duration, error)
+		leapFile func() (time.Duration, error)
+		alarm    int64
+	}{
+		{"all agree", offset(37*time.Second, nil), offset(37*time.Second, nil), 0},
+		{"kernel not set", offset(0, nil), offset(37*time.Second, nil), 0},
+		{"kernel disagrees", offset(36*time.Second, nil), offset(37*time.Second, nil), 1},
+		{"leap file disagrees", offset(37*time.Second, nil), offset(38*time.Second, nil), 1},
+		{"sources unavailable", offset(0, fmt.Errorf("nope")), offset(0, fmt.Errorf("nope")), 0},
+		{"leap file unavailable, kernel disagrees", offset(36*time.Second, nil), offset(0, fmt.Errorf("nope")), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &utcOffsetChecker{
+				kernel:     tt.kernel,
+				leapFile:   tt.leapFile,
+				advertised: func() time.Duration { return 37 * time.Second },
+				alarm:      1 - tt.alarm,
+			}
+			u.check()
+			require.Equal(t, tt.alarm, u.Alarm())
+		})
+	}
+}
+
+func TestUTCOffsetAlarmEvent(t *testing.T) {
+	s := &Server{
+		Config:         &Config{},
+		utcOffsetCheck: &utcOffsetChecker{alarm: 1},
+	}
+	require.Equal(t, int64(1), s.alarms()["utc_offset"])
+}
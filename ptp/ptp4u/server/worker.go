@@ -20,9 +20,12 @@ Package server implements simple Unicast PTP UDP server.
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
@@ -32,13 +35,15 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func enableDSCP(fd int, localAddr net.IP, dscp int) error {
+// enableDSCP sets DSCP and ECN codepoint of the packets sent from the socket
+func enableDSCP(fd int, localAddr net.IP, dscp int, ecn uint8) error {
+	tos := dscp<<2 | int(ecn&timestamp.ECNMask)
 	if localAddr.To4() == nil {
-		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, dscp<<2); err != nil {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos); err != nil {
 			return err
 		}
 	} else {
-		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, dscp<<2); err != nil {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, tos); err != nil {
 			return err
 		}
 	}
@@ -54,7 +59,37 @@ type sendWorker struct {
 	config         *Config
 	stats          stats.Stats
 
+	// packets sent since the last pps update and the resulting rate
+	txCount int64
+	pps     int64
+
+	// worker thread id and time accounting, used when WorkerCPUStats is enabled
+	tid       int64
+	lastCPU   int64
+	phaseTime [3]int64
+
+	// shadow scheduler running next to the active one
+	shadow *shadowScheduler
+	// sends taken off the queue, serviced in deadline order. Only accessed by the worker goroutine
+	pending    deadlineQueue
+	pendingSeq uint64
+	// sends on request in pending
+	requested map[*SubscriptionClient]bool
+	// length of pending for the other goroutines
+	pendingLen int64
+	// attempts of the last TX timestamp read
+	txtsAttempts int
+
 	clients map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient
+	// negotiation start of the clients, kept while they have subscriptions
+	requests map[ptp.PortIdentity]*clientRequest
+}
+
+// clientRequest tracks the time to first sync of a client
+type clientRequest struct {
+	first time.Time
+	// synced is only accessed by the worker goroutine
+	synced bool
 }
 
 func newSendWorker(i int, c *Config, st stats.Stats) *sendWorker {
@@ -62,17 +97,19 @@ func newSendWorker(i int, c *Config, st stats.Stats) *sendWorker {
 		id:     i,
 		config: c,
 		stats:  st,
+		shadow: newShadowScheduler(),
 	}
 	s.clients = make(map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient)
+	s.requests = make(map[ptp.PortIdentity]*clientRequest)
 	s.queue = make(chan *SubscriptionClient, c.QueueSize)
 	s.signalingQueue = make(chan *SubscriptionClient, c.QueueSize)
 	return s
 }
 
-func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
+func (s *sendWorker) listen(l *listener) (eventFD, generalFD int, err error) {
 	// socket domain differs depending whether we are listening on ipv4 or ipv6
 	domain := unix.AF_INET6
-	if s.config.IP.To4() != nil {
+	if l.IP.To4() != nil {
 		domain = unix.AF_INET
 	}
 	// set up event connection
@@ -80,7 +117,7 @@ func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
 	if err != nil {
 		return -1, -1, fmt.Errorf("creating event socket error: %w", err)
 	}
-	sockAddrAnyPort := timestamp.IPToSockaddr(s.config.IP, 0)
+	sockAddrAnyPort := timestamp.IPToSockaddr(l.IP, 0)
 
 	// set SO_REUSEPORT so we can potentially trace network path from same source port.
 	// needs to be set before we bind to a port.
@@ -99,29 +136,31 @@ func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
 	}
 	switch v := localSockAddr.(type) {
 	case *unix.SockaddrInet4:
-		log.Infof("Started worker#%d event on [%v]:%d", s.id, net.IP(v.Addr[:]), v.Port)
+		log.Infof("Started worker#%d event on %s [%v]:%d", s.id, l.Interface, net.IP(v.Addr[:]), v.Port)
 	case *unix.SockaddrInet6:
-		log.Infof("Started worker#%d event on [%v]:%d", s.id, net.IP(v.Addr[:]), v.Port)
+		log.Infof("Started worker#%d event on %s [%v]:%d", s.id, l.Interface, net.IP(v.Addr[:]), v.Port)
 	default:
 		log.Errorf("Unexpected local addr type %T", v)
 	}
 
-	if err = enableDSCP(eventFD, s.config.IP, s.config.DSCP); err != nil {
+	// Syncs are sent ECN capable so congestion on the way to the clients is marked rather than queued silently
+	ecn := timestamp.ECNNotECT
+	if s.config.ECN {
+		ecn = timestamp.ECNECT0
+	}
+	if err = enableDSCP(eventFD, l.IP, l.DSCP, ecn); err != nil {
 		return -1, -1, fmt.Errorf("setting DSCP on event socket: %w", err)
 	}
+	if err = enableHopLimit(eventFD, l.IP, s.config.EventHopLimit); err != nil {
+		return -1, -1, fmt.Errorf("setting hop limit on event socket: %w", err)
+	}
+	if err = enableFlowLabel(eventFD, l.IP, s.config.EventFlowLabel); err != nil {
+		return -1, -1, fmt.Errorf("setting flow label on event socket: %w", err)
+	}
 
 	// Syncs sent from event port, so need to turn on timestamping here
-	switch s.config.TimestampType {
-	case timestamp.HWTIMESTAMP:
-		if err = timestamp.EnableHWTimestamps(eventFD, s.config.Interface); err != nil {
-			return -1, -1, fmt.Errorf("failed to enable RX hardware timestamps: %w", err)
-		}
-	case timestamp.SWTIMESTAMP:
-		if err = timestamp.EnableSWTimestamps(eventFD); err != nil {
-			return -1, -1, fmt.Errorf("unable to enable RX software timestamps: %w", err)
-		}
-	default:
-		return -1, -1, fmt.Errorf("unrecognized timestamp type: %s", s.config.TimestampType)
+	if err = l.timeSrc.EnableTimestamps(eventFD); err != nil {
+		return -1, -1, fmt.Errorf("failed to enable timestamps: %w", err)
 	}
 
 	// set up general connection
@@ -139,20 +178,39 @@ func (s *sendWorker) listen() (eventFD, generalFD int, err error) {
 		return -1, -1, fmt.Errorf("binding event socket connection: %w", err)
 	}
 	// enable DSCP
-	if err = enableDSCP(generalFD, s.config.IP, s.config.DSCP); err != nil {
+	if err = enableDSCP(generalFD, l.IP, l.DSCP, timestamp.ECNNotECT); err != nil {
 		return -1, -1, fmt.Errorf("setting DSCP on general socket: %w", err)
 	}
+	if err = enableHopLimit(generalFD, l.IP, s.config.GeneralHopLimit); err != nil {
+		return -1, -1, fmt.Errorf("setting hop limit on general socket: %w", err)
+	}
+	if err = enableFlowLabel(generalFD, l.IP, s.config.GeneralFlowLabel); err != nil {
+		return -1, -1, fmt.Errorf("setting flow label on general socket: %w", err)
+	}
 	return
 }
 
 // Start a SendWorker which will pull data from the queue and send Sync and Followup packets
 func (s *sendWorker) Start() {
-	eFd, gFd, err := s.listen()
-	if err != nil {
-		log.Fatal(err)
+	if s.config.WorkerCPUStats {
+		// Pin the worker to a thread so the thread CPU clock represents the worker
+		runtime.LockOSThread()
+		atomic.StoreInt64(&s.tid, int64(unix.Gettid()))
+	}
+
+	// sockets of each listener, subscriptions are served from the listener they were requested on
+	listeners := s.config.serving()
+	eFds := make([]int, len(listeners))
+	gFds := make([]int, len(listeners))
+	for _, l := range listeners {
+		eFd, gFd, err := s.listen(l)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer unix.Close(eFd)
+		defer unix.Close(gFd)
+		eFds[l.id], gFds[l.id] = eFd, gFd
 	}
-	defer unix.Close(eFd)
-	defer unix.Close(gFd)
 
 	// reusable buffers
 	buf := make([]byte, timestamp.PayloadSizeBytes)
@@ -162,162 +220,376 @@ func (s *sendWorker) Start() {
 	toob := make([]byte, timestamp.ControlSizeBytes)
 
 	var (
-		n        int
-		attempts int
-		txTS     time.Time
-		c        *SubscriptionClient
+		n     int
+		txTS  time.Time
+		start time.Time
+		c     *SubscriptionClient
+		l     *listener
+		tr    tappedRequest
+		eFd   int
+		gFd   int
+		err   error
+		// whether txTS is a software timestamp taken after the TX timestamp missed the Follow_Up budget
+		software bool
+		// dequeue time of the first Sync of the burst being sent. Zero if the queue is drained
+		fanoutStart time.Time
 	)
 
 	for {
+		if !fanoutStart.IsZero() && s.backlog() == 0 {
+			s.stats.ObserveFanoutDuration(time.Since(fanoutStart))
+			fanoutStart = time.Time{}
+		}
 		select {
-		case c = <-s.queue:
-			switch c.subscriptionType {
-			case ptp.MessageSync:
-				// send sync
-				c.UpdateSync()
-				n, err = ptp.BytesTo(c.Sync(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the sync packet: %v", err)
-					continue
-				}
-				log.Debugf("Sending sync")
-
-				err = unix.Sendto(eFd, buf[:n], 0, c.eclisa)
-				if err != nil {
-					log.Errorf("Failed to send the sync packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-				txTS, attempts, err = timestamp.ReadTXtimestampBuf(eFd, oob, toob)
-				s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
-				if err != nil {
-					log.Errorf("Failed to read TX timestamp: %v", err)
-					return
-				}
-				if s.config.TimestampType != timestamp.HWTIMESTAMP {
-					txTS = txTS.Add(s.config.UTCOffset)
-				}
-
-				// send followup
-				c.UpdateFollowup(txTS)
-				n, err = ptp.BytesTo(c.Followup(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the followup packet: %v", err)
-					continue
-				}
-				log.Debug("Sending followup")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the followup packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(ptp.MessageFollowUp)
-			case ptp.MessageAnnounce:
-				// send announce
-				c.UpdateAnnounce()
-				n, err = ptp.BytesTo(c.Announce(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the announce packet: %v", err)
-					continue
-				}
-				log.Debug("Sending announce")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the announce packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-			case ptp.MessageDelayResp:
-				// send delay response
-				n, err = ptp.BytesTo(c.DelayResp(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the delay response packet: %v", err)
-					continue
-				}
-				log.Debug("Sending delay response")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the delay response: %v", err)
-					continue
-				}
-				s.stats.IncTX(c.subscriptionType)
-
-			case ptp.MessageDelayReq:
-				// send sync
-				n, err = ptp.BytesTo(c.Sync(), buf)
-				if err != nil {
-					log.Errorf("Failed to generate the sync packet: %v", err)
-					continue
-				}
-				log.Debugf("Sending sync")
-
-				err = unix.Sendto(eFd, buf[:n], 0, c.eclisa)
-				if err != nil {
-					log.Errorf("Failed to send the sync packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(ptp.MessageSync)
-
-				txTS, attempts, err = timestamp.ReadTXtimestampBuf(eFd, oob, toob)
-				s.stats.SetMaxTXTSAttempts(s.id, int64(attempts))
-				if err != nil {
-					log.Errorf("Failed to read TX timestamp: %v", err)
-					return
-				}
-				if s.config.TimestampType != timestamp.HWTIMESTAMP {
-					txTS = txTS.Add(s.config.UTCOffset)
-				}
-
-				// send announce
-				c.UpdateAnnounceFollowUp(txTS)
-				n, err = ptp.BytesTo(c.Announce(), buf)
-				if err != nil {
-					log.Errorf("Failed to prepare the announce packet: %v", err)
-					continue
-				}
-				log.Debug("Sending announce")
-
-				err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
-				if err != nil {
-					log.Errorf("Failed to send the announce packet: %v", err)
-					continue
-				}
-				s.stats.IncTX(ptp.MessageAnnounce)
-			default:
-				log.Errorf("Unknown subscription type: %v", c.subscriptionType)
+		case c = <-s.signalingQueue:
+			if s.config.Standby {
+				s.stats.IncStandbySuppressed(ptp.MessageSignaling)
 				continue
 			}
-			c.IncSequenceID()
-			s.stats.SetMaxWorkerQueue(s.id, int64(len(s.queue)))
-		case c = <-s.signalingQueue:
-			n, err = ptp.BytesTo(c.Signaling(), buf)
+			s.sendSignaling(listeners[c.listener], gFds[c.listener], c, buf)
+			continue
+		case c = <-s.pendingQueue():
+			s.addPending(c)
+		case <-s.pendingReady():
+		}
+		c = s.nextDue()
+		s.checkDeadline(c, s.config.Clock().Now())
+		tr = c.tapped(time.Now())
+		l, eFd, gFd = listeners[c.listener], eFds[c.listener], gFds[c.listener]
+		if fanoutStart.IsZero() && c.subscriptionType == ptp.MessageSync {
+			fanoutStart = time.Now()
+		}
+		if s.config.Features.ShadowScheduler {
+			s.observeShadow(c)
+		}
+		if s.config.Standby {
+			s.suppress(c, buf)
+			continue
+		}
+		switch c.subscriptionType {
+		case ptp.MessageSync:
+			// send sync
+			start = s.phaseStart()
+			c.UpdateSync()
+			n, err = s.bytesTo(c.Sync(), buf)
 			if err != nil {
-				log.Errorf("Failed to prepare the unicast signaling: %v", err)
+				log.Errorf("Failed to generate the sync packet: %v", err)
+				continue
+			}
+			log.Debugf("Sending sync")
+			start = s.phaseDone(stats.PhaseSerialization, start)
+
+			if !s.fits(n, c.subscriptionType) {
+				continue
+			}
+			err = sendTo(eFd, buf[:n], c.eclisa, s.config.EventFlowLabel)
+			if err != nil {
+				log.Errorf("Failed to send the sync packet: %v", err)
+				continue
+			}
+			s.incTX(l, c.subscriptionType)
+			s.stats.IncClientTX(c.client, c.subscriptionType)
+			c.traceSent(c.subscriptionType)
+			start = s.phaseDone(stats.PhaseSocketIO, start)
+
+			txTS, software, err = s.followUpTimestamp(l, eFd, c, buf[:n], oob, toob)
+			start = s.phaseDone(stats.PhaseTXTimestamp, start)
+			if errors.Is(err, errFollowUpSkipped) {
+				log.Debugf("Skipping %s: %v", ptp.MessageFollowUp, err)
+				break
+			}
+			if err != nil {
+				log.Errorf("Failed to read TX timestamp: %v", err)
+				return
+			}
+
+			// send followup
+			c.UpdateFollowup(txTS)
+			n, err = s.followUpBytesTo(c.Followup(), buf, software)
+			if err != nil {
+				log.Errorf("Failed to generate the followup packet: %v", err)
+				continue
+			}
+			log.Debug("Sending followup")
+			start = s.phaseDone(stats.PhaseSerialization, start)
+
+			if !s.fits(n, ptp.MessageFollowUp) {
+				continue
+			}
+			err = sendTo(gFd, buf[:n], c.gclisa, s.config.GeneralFlowLabel)
+			if err != nil {
+				log.Errorf("Failed to send the followup packet: %v", err)
+				continue
+			}
+			s.incTX(l, ptp.MessageFollowUp)
+			s.phaseDone(stats.PhaseSocketIO, start)
+			if c.request != nil && !c.request.synced {
+				c.request.synced = true
+				s.stats.ObserveTimeToFirstSync(time.Since(c.request.first))
+			}
+		case ptp.MessageAnnounce:
+			// send announce
+			start = s.phaseStart()
+			c.UpdateAnnounce()
+			n, err = s.bytesTo(c.Announce(), buf)
+			if err != nil {
+				log.Errorf("Failed to prepare the announce packet: %v", err)
+				continue
+			}
+			log.Debug("Sending announce")
+			start = s.phaseDone(stats.PhaseSerialization, start)
+
+			if !s.fits(n, c.subscriptionType) {
+				continue
+			}
+			err = sendTo(gFd, buf[:n], c.gclisa, s.config.GeneralFlowLabel)
+			if err != nil {
+				log.Errorf("Failed to send the announce packet: %v", err)
+				continue
+			}
+			s.incTX(l, c.subscriptionType)
+			s.stats.IncClientTX(c.client, c.subscriptionType)
+			c.traceSent(c.subscriptionType)
+			s.phaseDone(stats.PhaseSocketIO, start)
+
+		case ptp.MessageDelayResp:
+			// send delay response
+			start = s.phaseStart()
+			n, err = s.bytesTo(c.DelayResp(), buf)
+			if err != nil {
+				log.Errorf("Failed to prepare the delay response packet: %v", err)
+				continue
+			}
+			log.Debug("Sending delay response")
+			start = s.phaseDone(stats.PhaseSerialization, start)
+
+			if !s.fits(n, c.subscriptionType) {
+				continue
+			}
+			err = sendTo(gFd, buf[:n], c.gclisa, s.config.GeneralFlowLabel)
+			if err != nil {
+				log.Errorf("Failed to send the delay response: %v", err)
+				continue
+			}
+			s.tapResponse(tr, l, ptp.PortGeneral, c.gclisa, buf[:n], time.Time{}, false)
+			s.incTX(l, c.subscriptionType)
+			s.stats.IncClientTX(c.client, c.subscriptionType)
+			c.traceSent(c.subscriptionType)
+			s.phaseDone(stats.PhaseSocketIO, start)
+
+		case ptp.MessageDelayReq:
+			// send sync
+			start = s.phaseStart()
+			n, err = s.bytesTo(c.Sync(), buf)
+			if err != nil {
+				log.Errorf("Failed to generate the sync packet: %v", err)
+				continue
+			}
+			log.Debugf("Sending sync")
+			start = s.phaseDone(stats.PhaseSerialization, start)
+
+			if !s.fits(n, ptp.MessageSync) {
+				continue
+			}
+			err = sendTo(eFd, buf[:n], c.eclisa, s.config.EventFlowLabel)
+			if err != nil {
+				log.Errorf("Failed to send the sync packet: %v", err)
+				continue
+			}
+			s.incTX(l, ptp.MessageSync)
+			s.stats.IncClientTX(c.client, ptp.MessageSync)
+			start = s.phaseDone(stats.PhaseSocketIO, start)
+
+			txTS, software, err = s.followUpTimestamp(l, eFd, c, buf[:n], oob, toob)
+			start = s.phaseDone(stats.PhaseTXTimestamp, start)
+			s.tapResponse(tr, l, ptp.PortEvent, c.eclisa, buf[:n], txTS, true)
+			if errors.Is(err, errFollowUpSkipped) {
+				log.Debugf("Skipping %s: %v", ptp.MessageFollowUp, err)
+				break
+			}
+			if err != nil {
+				log.Errorf("Failed to read TX timestamp: %v", err)
+				return
+			}
+
+			// send announce
+			c.UpdateAnnounceFollowUp(txTS)
+			n, err = s.followUpBytesTo(c.Announce(), buf, software)
+			if err != nil {
+				log.Errorf("Failed to prepare the announce packet: %v", err)
+				continue
+			}
+			log.Debug("Sending announce")
+			start = s.phaseDone(stats.PhaseSerialization, start)
+
+			if !s.fits(n, ptp.MessageAnnounce) {
 				continue
 			}
-			err = unix.Sendto(gFd, buf[:n], 0, c.gclisa)
+			err = sendTo(gFd, buf[:n], c.gclisa, s.config.GeneralFlowLabel)
 			if err != nil {
-				log.Errorf("Failed to send the unicast signaling: %v", err)
+				log.Errorf("Failed to send the announce packet: %v", err)
 				continue
 			}
-			log.Debug("Sent unicast signaling")
-			for _, tlv := range c.Signaling().TLVs {
-				switch tlv.(type) {
-				case *ptp.GrantUnicastTransmissionTLV:
-					s.stats.IncTXSignalingGrant(c.subscriptionType)
-				case *ptp.CancelUnicastTransmissionTLV:
-					s.stats.IncTXSignalingCancel(c.subscriptionType)
-				}
+			s.tapResponse(tr, l, ptp.PortGeneral, c.gclisa, buf[:n], time.Time{}, false)
+			s.incTX(l, ptp.MessageAnnounce)
+			s.stats.IncClientTX(c.client, ptp.MessageAnnounce)
+			s.phaseDone(stats.PhaseSocketIO, start)
+		default:
+			log.Errorf("Unknown subscription type: %v", c.subscriptionType)
+			continue
+		}
+		c.IncSequenceID()
+		atomic.AddInt64(&s.txCount, 1)
+		s.stats.SetMaxWorkerQueue(s.id, int64(s.backlog()))
+	}
+}
+
+// checkDeadline accounts the periodic send of the subscription against its deadline, the start of the next interval.
+// Sends serviced after the deadline and the intervals missed before are overruns
+func (s *sendWorker) checkDeadline(c *SubscriptionClient, now time.Time) {
+	if !atomic.CompareAndSwapInt32(&c.queued, 1, 0) {
+		// not a periodic send
+		return
+	}
+	s.stats.SetMaxWorkerLateness(s.id, now.UnixNano()-atomic.LoadInt64(&c.scheduled))
+	overruns := atomic.SwapInt64(&c.missed, 0)
+	if now.UnixNano() > atomic.LoadInt64(&c.deadline) {
+		overruns++
+	}
+	if overruns > 0 {
+		s.stats.AddWorkerOverruns(s.id, overruns)
+	}
+}
+
+// incTX counts the message of the type sent from the listener
+func (s *sendWorker) incTX(l *listener, t ptp.MessageType) {
+	s.stats.IncTX(t)
+	s.stats.IncInterfaceTX(l.Interface, t)
+}
+
+// sendSignaling sends the signaling message of the subscription, split if it doesn't fit into the path MTU
+func (s *sendWorker) sendSignaling(l *listener, gFd int, c *SubscriptionClient, buf []byte) {
+	n, err := s.bytesTo(c.Signaling(), buf)
+	if err != nil {
+		log.Errorf("Failed to prepare the unicast signaling: %v", err)
+		return
+	}
+	for _, sg := range s.signalingParts(c.Signaling(), n) {
+		if sg != c.Signaling() {
+			n, err = s.bytesTo(sg, buf)
+			if err != nil {
+				log.Errorf("Failed to prepare the unicast signaling: %v", err)
+				return
+			}
+		}
+		err = sendTo(gFd, buf[:n], c.gclisa, s.config.GeneralFlowLabel)
+		if err != nil {
+			log.Errorf("Failed to send the unicast signaling: %v", err)
+			return
+		}
+		log.Debug("Sent unicast signaling")
+		s.stats.IncInterfaceTX(l.Interface, ptp.MessageSignaling)
+		for _, tlv := range sg.TLVs {
+			switch tlv.(type) {
+			case *ptp.GrantUnicastTransmissionTLV:
+				s.stats.IncTXSignalingGrant(c.subscriptionType)
+			case *ptp.CancelUnicastTransmissionTLV:
+				s.stats.IncTXSignalingCancel(c.subscriptionType)
 			}
 		}
 	}
 }
 
+// suppress does everything to serve the subscription, but sending. Used in standby mode
+func (s *sendWorker) suppress(c *SubscriptionClient, buf []byte) {
+	var p ptp.BinaryMarshalerTo
+	switch c.subscriptionType {
+	case ptp.MessageSync, ptp.MessageDelayReq:
+		c.UpdateSync()
+		p = c.Sync()
+	case ptp.MessageAnnounce:
+		c.UpdateAnnounce()
+		p = c.Announce()
+	case ptp.MessageDelayResp:
+		p = c.DelayResp()
+	default:
+		log.Errorf("Unknown subscription type: %v", c.subscriptionType)
+		return
+	}
+	if _, err := ptp.BytesTo(p, buf); err != nil {
+		log.Errorf("Failed to generate the %s packet: %v", c.subscriptionType, err)
+		return
+	}
+	s.stats.IncStandbySuppressed(c.subscriptionType)
+	c.IncSequenceID()
+	// count as sent, so worker load reflects what it would be in service
+	atomic.AddInt64(&s.txCount, 1)
+	s.stats.SetMaxWorkerQueue(s.id, int64(s.backlog()))
+}
+
+// observeShadow records the divergence of the active scheduler from the shadow one
+func (s *sendWorker) observeShadow(c *SubscriptionClient) {
+	// only periodic subscriptions are scheduled, the rest is sent on request
+	if c.subscriptionType != ptp.MessageSync && c.subscriptionType != ptp.MessageAnnounce {
+		return
+	}
+	d, ok := s.shadow.observe(c, s.config.Clock().Now(), c.interval)
+	if !ok {
+		return
+	}
+	if d < 0 {
+		d = -d
+	}
+	s.stats.SetMaxShadowDivergence(s.id, d.Nanoseconds())
+}
+
+// phaseStart returns the start time of the pipeline phase
+func (s *sendWorker) phaseStart() time.Time {
+	if !s.config.WorkerCPUStats {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// phaseDone accounts the time spent in the phase and returns the start time of the next one
+func (s *sendWorker) phaseDone(phase stats.WorkerPhase, start time.Time) time.Time {
+	if !s.config.WorkerCPUStats {
+		return start
+	}
+	now := time.Now()
+	atomic.AddInt64(&s.phaseTime[phase], int64(now.Sub(start)))
+	return now
+}
+
+// threadCPUClockID returns the clock id of the CPU time of a thread.
+// See MAKE_THREAD_CPUCLOCK in linux/posix-timers.h
+func threadCPUClockID(tid int) int32 {
+	return int32((^tid << 3) | 6)
+}
+
+// reportCPUUsage reports worker thread CPU time and time spent in each pipeline phase since the previous call
+func (s *sendWorker) reportCPUUsage() {
+	if !s.config.WorkerCPUStats {
+		return
+	}
+	for phase := range s.phaseTime {
+		s.stats.AddWorkerPhaseTime(s.id, stats.WorkerPhase(phase), atomic.SwapInt64(&s.phaseTime[phase], 0))
+	}
+
+	tid := atomic.LoadInt64(&s.tid)
+	if tid == 0 {
+		return
+	}
+	var ts unix.Timespec
+	if err := unix.ClockGettime(threadCPUClockID(int(tid)), &ts); err != nil {
+		log.Errorf("Failed to get CPU time of worker#%d: %v", s.id, err)
+		return
+	}
+	cpu := ts.Nano()
+	s.stats.SetWorkerCPUTime(s.id, cpu-s.lastCPU)
+	s.lastCPU = cpu
+}
+
 // FindSubscription retrieves an existing client
 func (s *sendWorker) FindSubscription(clientID ptp.PortIdentity, st ptp.MessageType) *SubscriptionClient {
 	s.mux.Lock()
@@ -349,6 +621,10 @@ func (s *sendWorker) FindClients(st ptp.MessageType) map[ptp.PortIdentity]*Subsc
 func (s *sendWorker) RegisterSubscription(clientID ptp.PortIdentity, st ptp.MessageType, sc *SubscriptionClient) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	// First subscription of the client is its assignment to the worker
+	if !s.hasClientLocked(clientID) {
+		s.stats.IncWorkerAssignment(s.id)
+	}
 	m, ok := s.clients[st]
 	if !ok {
 		s.clients[st] = map[ptp.PortIdentity]*SubscriptionClient{}
@@ -357,17 +633,80 @@ func (s *sendWorker) RegisterSubscription(clientID ptp.PortIdentity, st ptp.Mess
 	m[clientID] = sc
 }
 
-func (s *sendWorker) inventoryClients() {
+// clientRequest returns when the client started negotiating with the worker.
+// The first request of a client without subscriptions starts the clock
+func (s *sendWorker) clientRequest(clientID ptp.PortIdentity) *clientRequest {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	if s.requests == nil {
+		s.requests = make(map[ptp.PortIdentity]*clientRequest)
+	}
+	r, ok := s.requests[clientID]
+	if !ok {
+		r = &clientRequest{first: time.Now()}
+		s.requests[clientID] = r
+	}
+	return r
+}
+
+// hasClient checks if the client has any subscription on this worker
+func (s *sendWorker) hasClient(clientID ptp.PortIdentity) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.hasClientLocked(clientID)
+}
+
+func (s *sendWorker) hasClientLocked(clientID ptp.PortIdentity) bool {
+	for _, subs := range s.clients {
+		if _, ok := subs[clientID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePPS calculates the send rate since the previous call
+func (s *sendWorker) updatePPS(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	sent := atomic.SwapInt64(&s.txCount, 0)
+	atomic.StoreInt64(&s.pps, int64(float64(sent)/interval.Seconds()))
+}
+
+// lessLoaded compares current load of 2 workers.
+// Queue backlog translates directly into send latency so it goes first, pps breaks the tie
+func (s *sendWorker) lessLoaded(o *sendWorker) bool {
+	if s.backlog() != o.backlog() {
+		return s.backlog() < o.backlog()
+	}
+	return atomic.LoadInt64(&s.pps) <= atomic.LoadInt64(&o.pps)
+}
+
+// inventoryClients cleans up finished subscriptions and returns the number of running ones
+func (s *sendWorker) inventoryClients() int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var running int64
+	active := map[ptp.PortIdentity]bool{}
 	for st, subs := range s.clients {
 		for k, sc := range subs {
 			if !sc.Running() {
 				delete(subs, k)
+				s.stats.IncSubscriptionExpired()
 				continue
 			}
+			active[k] = true
 			s.stats.IncSubscription(st)
 			s.stats.IncWorkerSubs(s.id)
+			running++
+		}
+	}
+	// clients which are gone start over next time
+	for k := range s.requests {
+		if !active[k] {
+			delete(s.requests, k)
 		}
 	}
+	return running
 }
@@ -19,6 +19,7 @@ package server
 import (
 	"context"
 	"net"
+	"runtime"
 	"testing"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/facebook/time/ptp/ptp4u/stats"
 	"github.com/facebook/time/timestamp"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestWorkerQueue(t *testing.T) {
@@ -35,6 +37,7 @@ func TestWorkerQueue(t *testing.T) {
 			TimestampType: timestamp.SWTIMESTAMP,
 		},
 	}
+	c.timeSrc = &SysClockTimeSource{config: c}
 
 	st := stats.NewJSONStats()
 	go st.Start(0)
@@ -95,6 +98,7 @@ func TestFindSubscription(t *testing.T) {
 		id:      0,
 		queue:   make(chan *SubscriptionClient),
 		clients: make(map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient),
+		stats:   stats.NewJSONStats(),
 	}
 
 	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
@@ -123,6 +127,7 @@ func TestFindClients(t *testing.T) {
 		id:      0,
 		queue:   make(chan *SubscriptionClient),
 		clients: make(map[ptp.MessageType]map[ptp.PortIdentity]*SubscriptionClient),
+		stats:   stats.NewJSONStats(),
 	}
 
 	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
@@ -204,6 +209,97 @@ func TestInventoryClients(t *testing.T) {
 	require.Equal(t, 0, len(w.clients[ptp.MessageSync]))
 }
 
+func TestClientRequest(t *testing.T) {
+	clipi := ptp.PortIdentity{
+		PortNumber:    1,
+		ClockIdentity: ptp.ClockIdentity(1234),
+	}
+	c := &Config{StaticConfig: StaticConfig{QueueSize: 100}}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+
+	// all subscriptions of the client share the negotiation start
+	r := w.clientRequest(clipi)
+	require.Same(t, r, w.clientRequest(clipi))
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, time.Second, time.Now().Add(time.Minute))
+	sc.setRunning(true)
+	w.RegisterSubscription(clipi, ptp.MessageAnnounce, sc)
+	w.inventoryClients()
+	require.Same(t, r, w.clientRequest(clipi))
+
+	// client without subscriptions starts over
+	sc.setRunning(false)
+	w.inventoryClients()
+	require.NotSame(t, r, w.clientRequest(clipi))
+}
+
+func TestSuppress(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 100, Standby: true},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	buf := make([]byte, timestamp.PayloadSizeBytes)
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	for _, mt := range []ptp.MessageType{ptp.MessageSync, ptp.MessageAnnounce, ptp.MessageDelayResp} {
+		sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, mt, c, time.Second, time.Now().Add(time.Minute))
+		w.suppress(sc, buf)
+		require.Equal(t, uint16(1), sc.sequenceID)
+	}
+	require.Equal(t, int64(3), w.txCount)
+}
+
+// overrunStats records the deadline accounting of the worker
+type overrunStats struct {
+	*stats.JSONStats
+	overruns int64
+	lateness int64
+}
+
+func (s *overrunStats) AddWorkerOverruns(_ int, overruns int64) { s.overruns += overruns }
+
+func (s *overrunStats) SetMaxWorkerLateness(_ int, ns int64) { s.lateness = ns }
+
+func TestCheckDeadline(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 100},
+	}
+	st := &overrunStats{JSONStats: stats.NewJSONStats()}
+	w := newSendWorker(0, c, st)
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, time.Now().Add(time.Minute))
+	start := time.Now()
+
+	// serviced within the interval
+	sc.Due(start, time.Second)
+	w.checkDeadline(<-w.queue, start.Add(100*time.Millisecond))
+	require.Equal(t, int64(0), st.overruns)
+	require.Equal(t, int64(100*time.Millisecond), st.lateness)
+
+	// the next interval began while the send was queued, the second one is coalesced
+	sc.Due(start.Add(time.Second), time.Second)
+	sc.Due(start.Add(2*time.Second), time.Second)
+	require.Len(t, w.queue, 1)
+	w.checkDeadline(<-w.queue, start.Add(2500*time.Millisecond))
+	require.Equal(t, int64(2), st.overruns)
+	require.Equal(t, int64(1500*time.Millisecond), st.lateness)
+
+	// intervals the scheduler skipped
+	sc.Due(start.Add(5*time.Second), time.Second)
+	w.checkDeadline(<-w.queue, start.Add(5*time.Second))
+	require.Equal(t, int64(4), st.overruns)
+
+	// request driven sends have no deadline
+	st.overruns = 0
+	sc.Once()
+	w.checkDeadline(<-w.queue, start.Add(time.Hour))
+	require.Equal(t, int64(0), st.overruns)
+}
+
 func TestEnableDSCP(t *testing.T) {
 	conn4, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
 	require.NoError(t, err)
@@ -211,7 +307,7 @@ func TestEnableDSCP(t *testing.T) {
 	// get connection file descriptor
 	fd4, err := timestamp.ConnFd(conn4)
 	require.NoError(t, err)
-	err = enableDSCP(fd4, net.ParseIP("127.0.0.1"), 42)
+	err = enableDSCP(fd4, net.ParseIP("127.0.0.1"), 42, timestamp.ECNECT0)
 	require.NoError(t, err)
 
 	conn6, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: 0})
@@ -220,6 +316,117 @@ func TestEnableDSCP(t *testing.T) {
 	// get connection file descriptor
 	fd6, err := timestamp.ConnFd(conn6)
 	require.NoError(t, err)
-	err = enableDSCP(fd6, net.ParseIP("::"), 42)
+	err = enableDSCP(fd6, net.ParseIP("::"), 42, timestamp.ECNNotECT)
 	require.NoError(t, err)
 }
+
+func TestThreadCPUClockID(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var ts unix.Timespec
+	err := unix.ClockGettime(threadCPUClockID(unix.Gettid()), &ts)
+	require.NoError(t, err)
+	require.Greater(t, ts.Nano(), int64(0))
+}
+
+func TestPhaseTime(t *testing.T) {
+	c := &Config{StaticConfig: StaticConfig{WorkerCPUStats: true}}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+
+	start := w.phaseStart()
+	require.False(t, start.IsZero())
+	time.Sleep(time.Millisecond)
+	next := w.phaseDone(stats.PhaseSocketIO, start)
+	require.True(t, next.After(start))
+	require.GreaterOrEqual(t, w.phaseTime[stats.PhaseSocketIO], int64(time.Millisecond))
+	require.Equal(t, int64(0), w.phaseTime[stats.PhaseSerialization])
+
+	w.tid = int64(unix.Gettid())
+	w.reportCPUUsage()
+	require.Equal(t, int64(0), w.phaseTime[stats.PhaseSocketIO])
+	require.Greater(t, w.lastCPU, int64(0))
+
+	// Disabled accounting doesn't measure anything
+	c.WorkerCPUStats = false
+	require.True(t, w.phaseStart().IsZero())
+	w.phaseDone(stats.PhaseSocketIO, time.Now().Add(-time.Second))
+	require.Equal(t, int64(0), w.phaseTime[stats.PhaseSocketIO])
+}
+
+func TestWorkerNextDue(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 100},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	require.Nil(t, w.nextDue())
+	require.Nil(t, w.pendingReady())
+
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	start := time.Now()
+	late := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageAnnounce, c, 2*time.Second, start.Add(time.Minute))
+	early := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, 125*time.Millisecond, start.Add(time.Minute))
+	middle := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, start.Add(time.Minute))
+	resp := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, 0, start.Add(time.Minute))
+
+	// queued in the order of scheduling, not of the deadlines
+	late.Due(start, 2*time.Second)
+	middle.Due(start, time.Second)
+	early.Due(start, 125*time.Millisecond)
+	resp.Once()
+	require.Equal(t, 4, w.backlog())
+
+	// sends on request first, then the periodic ones by deadline
+	require.Equal(t, resp, w.nextDue())
+	require.Equal(t, 3, w.backlog())
+	require.NotNil(t, w.pendingReady())
+	require.Equal(t, early, w.nextDue())
+
+	// queued later, but due sooner than the rest
+	sooner := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, 500*time.Millisecond, start.Add(time.Minute))
+	sooner.Due(start, 500*time.Millisecond)
+	require.Equal(t, sooner, w.nextDue())
+	require.Equal(t, middle, w.nextDue())
+	require.Equal(t, late, w.nextDue())
+	require.Equal(t, 0, w.backlog())
+	require.Nil(t, w.pendingReady())
+}
+
+func TestWorkerNextDueBounded(t *testing.T) {
+	c := &Config{
+		clockIdentity: ptp.ClockIdentity(1234),
+		StaticConfig:  StaticConfig{QueueSize: 3},
+	}
+	w := newSendWorker(0, c, stats.NewJSONStats())
+	sa := timestamp.IPToSockaddr(net.ParseIP("127.0.0.1"), 123)
+	now := time.Now()
+
+	// repeated requests of the client are answered once
+	resp := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageDelayResp, c, 0, now.Add(time.Minute))
+	resp.Once()
+	resp.Once()
+	require.Equal(t, resp, w.nextDue())
+	require.Nil(t, w.nextDue())
+
+	// periodic send about to miss the interval goes before the newer request
+	due := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, now.Add(time.Minute))
+	due.Due(now.Add(-time.Second), time.Second)
+	resp.Once()
+	require.Equal(t, due, w.nextDue())
+	require.Equal(t, resp, w.nextDue())
+
+	// no more than QueueSize sends are taken off the channel
+	for i := 0; i < 3; i++ {
+		sc := NewSubscriptionClient(w.queue, w.signalingQueue, sa, sa, ptp.MessageSync, c, time.Second, now.Add(time.Minute))
+		sc.Due(now, time.Second)
+	}
+	w.addPending(<-w.queue)
+	w.addPending(<-w.queue)
+	w.addPending(<-w.queue)
+	require.Nil(t, w.pendingQueue())
+	resp.Once()
+	require.NotNil(t, w.nextDue())
+	require.Equal(t, 1, len(w.queue))
+	require.Equal(t, 3, w.backlog())
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shmstats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readRetries is how many times a read is retried while ptp4u is writing
+const readRetries = 1000
+
+// ErrBusy is returned when a consistent read wasn't possible
+var ErrBusy = errors.New("counters are being written")
+
+// Reader reads the counters published by Writer. It is not safe for concurrent use
+type Reader struct {
+	data       region
+	capacity   int
+	generation uint64
+	index      map[string]int
+}
+
+// Open maps the file read only
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < HeaderSize {
+		return nil, fmt.Errorf("%s is too short", path)
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, int(st.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", path, err)
+	}
+	r := &Reader{data: data}
+	if !bytes.Equal(r.data[:len(magic)], magic[:]) {
+		_ = r.Close()
+		return nil, fmt.Errorf("%s is not a ptp4u stats file", path)
+	}
+	if v := atomic.LoadUint32(r.data.uint32At(offVersion)); v != Version {
+		_ = r.Close()
+		return nil, fmt.Errorf("unsupported layout version %d", v)
+	}
+	r.capacity = int(atomic.LoadUint32(r.data.uint32At(offCapacity)))
+	if HeaderSize+r.capacity*EntrySize > len(r.data) {
+		_ = r.Close()
+		return nil, fmt.Errorf("%s is shorter than its capacity %d", path, r.capacity)
+	}
+	return r, nil
+}
+
+// Close unmaps the file
+func (r *Reader) Close() error {
+	return unix.Munmap(r.data)
+}
+
+// read calls f until it runs with no write in progress
+func (r *Reader) read(f func()) error {
+	seq := r.data.uint64At(offSequence)
+	for i := 0; i < readRetries; i++ {
+		before := atomic.LoadUint64(seq)
+		if before%2 == 1 {
+			continue
+		}
+		f()
+		if atomic.LoadUint64(seq) == before {
+			return nil
+		}
+	}
+	return ErrBusy
+}
+
+// count returns the number of entries in use, bounded by the capacity
+func (r *Reader) count() int {
+	n := int(atomic.LoadUint32(r.data.uint32At(offCount)))
+	if n > r.capacity {
+		n = r.capacity
+	}
+	return n
+}
+
+// Snapshot returns all counters and the time they were written at
+func (r *Reader) Snapshot() (map[string]int64, time.Time, error) {
+	var counters map[string]int64
+	var updated int64
+	err := r.read(func() {
+		n := r.count()
+		counters = make(map[string]int64, n)
+		for i := 0; i < n; i++ {
+			_, off := entry(i)
+			counters[r.data.name(i)] = atomic.LoadInt64(r.data.int64At(off))
+		}
+		updated = atomic.LoadInt64(r.data.int64At(offUpdated))
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return counters, time.Unix(0, updated), nil
+}
+
+// Get returns a single counter. The name lookup is cached until the set of names changes,
+// so repeated calls only load the value
+func (r *Reader) Get(name string) (int64, bool, error) {
+	var value int64
+	var found bool
+	err := r.read(func() {
+		if generation := atomic.LoadUint64(r.data.uint64At(offGeneration)); generation != r.generation || r.index == nil {
+			n := r.count()
+			r.index = make(map[string]int, n)
+			for i := 0; i < n; i++ {
+				r.index[r.data.name(i)] = i
+			}
+			r.generation = generation
+		}
+		var i int
+		i, found = r.index[name]
+		if found {
+			_, off := entry(i)
+			value = atomic.LoadInt64(r.data.int64At(off))
+		}
+	})
+	return value, found, err
+}
@@ -0,0 +1,204 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package shmstats exposes the ptp4u counters in a memory-mapped file, so local samplers can read them
+thousands of times per second without the HTTP overhead.
+
+The file is written by ptp4u and read by Reader. All integers are in the host byte order:
+
+	offset  size  field
+	0       8     magic "PTP4USHM"
+	8       4     layout version, 1
+	12      4     capacity, number of entry slots
+	16      8     sequence, odd while ptp4u writes and even when the data is consistent
+	24      8     generation, incremented when the set of counter names changes
+	32      8     time of the last write, unix nanoseconds
+	40      4     count, number of entries in use
+	44      20    reserved
+	64      64*n  entries, sorted by name
+
+Every entry is 64 bytes: the counter name NUL padded to 56 bytes followed by the int64 value.
+Readers load the sequence, read the data and load the sequence again, retrying if it was odd or changed.
+*/
+package shmstats
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultPath is where ptp4u keeps the counters by default
+const DefaultPath = "/dev/shm/ptp4u_stats"
+
+// DefaultCapacity is the default number of entry slots
+const DefaultCapacity = 4096
+
+// Version of the layout
+const Version = 1
+
+// Layout of the file
+const (
+	HeaderSize    = 64
+	EntrySize     = 64
+	MaxNameLength = 56
+)
+
+var magic = [8]byte{'P', 'T', 'P', '4', 'U', 'S', 'H', 'M'}
+
+// header offsets
+const (
+	offVersion    = 8
+	offCapacity   = 12
+	offSequence   = 16
+	offGeneration = 24
+	offUpdated    = 32
+	offCount      = 40
+)
+
+// region is the mapped file
+type region []byte
+
+func (r region) uint32At(off int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&r[off]))
+}
+
+func (r region) uint64At(off int) *uint64 {
+	return (*uint64)(unsafe.Pointer(&r[off]))
+}
+
+func (r region) int64At(off int) *int64 {
+	return (*int64)(unsafe.Pointer(&r[off]))
+}
+
+// entry returns the name and value offsets of the entry
+func entry(i int) (name, value int) {
+	name = HeaderSize + i*EntrySize
+	return name, name + MaxNameLength
+}
+
+// name returns the name of the entry
+func (r region) name(i int) string {
+	off, _ := entry(i)
+	b := r[off : off+MaxNameLength]
+	for n, c := range b {
+		if c == 0 {
+			return string(b[:n])
+		}
+	}
+	return string(b)
+}
+
+// Writer publishes the counters to the file. It is not safe for concurrent use
+type Writer struct {
+	path     string
+	data     region
+	capacity int
+	names    []string
+	skipped  int
+}
+
+// Create creates the file with the capacity entry slots and maps it
+func Create(path string, capacity int) (*Writer, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("capacity must be positive, got %d", capacity)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size := HeaderSize + capacity*EntrySize
+	if err := f.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", path, err)
+	}
+	w := &Writer{path: path, data: data, capacity: capacity}
+	copy(w.data, magic[:])
+	*w.data.uint32At(offVersion) = Version
+	*w.data.uint32At(offCapacity) = uint32(capacity)
+	return w, nil
+}
+
+// Close unmaps the file. The file is kept, so readers see the last counters
+func (w *Writer) Close() error {
+	return unix.Munmap(w.data)
+}
+
+// sameNames checks the names are the published ones
+func (w *Writer) sameNames(names []string) bool {
+	if len(names) != len(w.names) {
+		return false
+	}
+	for i := range names {
+		if names[i] != w.names[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Write publishes the counters as of now
+func (w *Writer) Write(counters map[string]int64, now time.Time) {
+	names := make([]string, 0, len(counters))
+	skipped := 0
+	for name := range counters {
+		if len(name) >= MaxNameLength {
+			skipped++
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > w.capacity {
+		skipped += len(names) - w.capacity
+		names = names[:w.capacity]
+	}
+	if skipped != w.skipped {
+		log.Warningf("%d counters don't fit %s", skipped, w.path)
+		w.skipped = skipped
+	}
+
+	atomic.AddUint64(w.data.uint64At(offSequence), 1)
+	if !w.sameNames(names) {
+		for i, name := range names {
+			off, _ := entry(i)
+			n := copy(w.data[off:off+MaxNameLength], name)
+			for j := off + n; j < off+MaxNameLength; j++ {
+				w.data[j] = 0
+			}
+		}
+		w.names = names
+		atomic.StoreUint32(w.data.uint32At(offCount), uint32(len(names)))
+		atomic.AddUint64(w.data.uint64At(offGeneration), 1)
+	}
+	for i, name := range names {
+		_, off := entry(i)
+		atomic.StoreInt64(w.data.int64At(off), counters[name])
+	}
+	atomic.StoreInt64(w.data.int64At(offUpdated), now.UnixNano())
+	atomic.AddUint64(w.data.uint64At(offSequence), 1)
+}
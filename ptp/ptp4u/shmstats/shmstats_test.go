@@ -0,0 +1,113 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shmstats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats")
+	w, err := Create(path, 8)
+	require.NoError(t, err)
+	defer w.Close()
+
+	now := time.Unix(1700000000, 42)
+	w.Write(map[string]int64{"subscriptions.sync": 3, "tx.sync": 100}, now)
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	counters, updated, err := r.Snapshot()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"subscriptions.sync": 3, "tx.sync": 100}, counters)
+	require.Equal(t, now.UnixNano(), updated.UnixNano())
+
+	v, ok, err := r.Get("tx.sync")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(100), v)
+
+	w.Write(map[string]int64{"subscriptions.sync": 4, "tx.sync": 200}, now)
+	v, ok, err = r.Get("tx.sync")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(200), v)
+
+	// new name rebuilds the index
+	w.Write(map[string]int64{"rx.signaling": 1, "tx.sync": 300}, now)
+	v, ok, err = r.Get("tx.sync")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(300), v)
+	_, ok, err = r.Get("subscriptions.sync")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestWriteLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats")
+	w, err := Create(path, 2)
+	require.NoError(t, err)
+	defer w.Close()
+
+	w.Write(map[string]int64{"a": 1, "b": 2, "c": 3, strings.Repeat("x", MaxNameLength): 4}, time.Now())
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	counters, _, err := r.Snapshot()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"a": 1, "b": 2}, counters)
+}
+
+func TestOpenInvalid(t *testing.T) {
+	_, err := Create(filepath.Join(t.TempDir(), "stats"), 0)
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "junk")
+	require.NoError(t, os.WriteFile(path, make([]byte, HeaderSize), 0644))
+	_, err = Open(path)
+	require.Error(t, err)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestReadBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats")
+	w, err := Create(path, 2)
+	require.NoError(t, err)
+	defer w.Close()
+	w.Write(map[string]int64{"a": 1}, time.Now())
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// writer died in the middle of a write
+	*w.data.uint64At(offSequence)++
+	_, _, err = r.Snapshot()
+	require.Equal(t, ErrBusy, err)
+}
@@ -0,0 +1,238 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// DefaultTopClients is the number of clients /clients returns unless asked otherwise
+const DefaultTopClients = 10
+
+// ClientCounters are the counters of a single client over the metric interval
+type ClientCounters struct {
+	Client        string `json:"client"`
+	Subscriptions int64  `json:"subscriptions"`
+	Denied        int64  `json:"denied"`
+	RXSignaling   int64  `json:"rx_signaling"`
+	TXSync        int64  `json:"tx_sync"`
+	TXAnnounce    int64  `json:"tx_announce"`
+	TXDelayResp   int64  `json:"tx_delay_resp"`
+	// Traffic is the number of packets received from and sent to the client, including Overcount
+	Traffic int64 `json:"traffic"`
+	// Overcount is the traffic inherited from the client evicted to make room for this one.
+	// Traffic is at most that much higher than the real one
+	Overcount int64 `json:"overcount"`
+}
+
+// clientTable keeps the counters of at most limit clients.
+// When it's full a new client replaces the one with the least traffic and inherits its traffic,
+// as the Space-Saving algorithm does, so the top talkers are kept but memory stays bounded
+type clientTable struct {
+	sync.Mutex
+	limit   int
+	clients map[string]*ClientCounters
+}
+
+// init initializes the underlying map
+func (t *clientTable) init() {
+	t.clients = make(map[string]*ClientCounters)
+}
+
+// setLimit sets the maximum number of tracked clients. 0 disables tracking
+func (t *clientTable) setLimit(limit int) {
+	t.Lock()
+	defer t.Unlock()
+	t.limit = limit
+}
+
+// update applies f to the counters of the client, evicting the client with the least traffic if needed
+func (t *clientTable) update(client string, traffic int64, f func(c *ClientCounters)) {
+	t.Lock()
+	defer t.Unlock()
+	if t.limit <= 0 {
+		return
+	}
+	c, ok := t.clients[client]
+	if !ok {
+		c = &ClientCounters{Client: client}
+		if len(t.clients) >= t.limit {
+			var least *ClientCounters
+			for _, e := range t.clients {
+				if least == nil || e.Traffic < least.Traffic {
+					least = e
+				}
+			}
+			delete(t.clients, least.Client)
+			c.Traffic = least.Traffic
+			c.Overcount = least.Traffic
+		}
+		t.clients[client] = c
+	}
+	c.Traffic += traffic
+	f(c)
+}
+
+// addTo adds the counters of our clients to the ones of dst.
+// dst keeps the clients of all the tables it's added up from, its limit is not applied
+func (t *clientTable) addTo(dst *clientTable) {
+	t.Lock()
+	clients := make([]ClientCounters, 0, len(t.clients))
+	for _, c := range t.clients {
+		clients = append(clients, *c)
+	}
+	t.Unlock()
+
+	dst.Lock()
+	defer dst.Unlock()
+	for _, c := range clients {
+		d, ok := dst.clients[c.Client]
+		if !ok {
+			d = &ClientCounters{Client: c.Client}
+			dst.clients[c.Client] = d
+		}
+		d.Subscriptions += c.Subscriptions
+		d.Denied += c.Denied
+		d.RXSignaling += c.RXSignaling
+		d.TXSync += c.TXSync
+		d.TXAnnounce += c.TXAnnounce
+		d.TXDelayResp += c.TXDelayResp
+		d.Traffic += c.Traffic
+		d.Overcount += c.Overcount
+	}
+}
+
+// reset forgets all the clients
+func (t *clientTable) reset() {
+	t.Lock()
+	t.clients = make(map[string]*ClientCounters)
+	t.Unlock()
+}
+
+// clientSortKeys are the counters the top clients can be sorted by
+var clientSortKeys = map[string]func(c *ClientCounters) int64{
+	"traffic":       func(c *ClientCounters) int64 { return c.Traffic },
+	"subscriptions": func(c *ClientCounters) int64 { return c.Subscriptions },
+	"denied":        func(c *ClientCounters) int64 { return c.Denied },
+	"rx_signaling":  func(c *ClientCounters) int64 { return c.RXSignaling },
+	"tx_sync":       func(c *ClientCounters) int64 { return c.TXSync },
+	"tx_announce":   func(c *ClientCounters) int64 { return c.TXAnnounce },
+	"tx_delay_resp": func(c *ClientCounters) int64 { return c.TXDelayResp },
+}
+
+// top returns n clients with the highest counter by
+func (t *clientTable) top(n int, by string) ([]ClientCounters, error) {
+	key, ok := clientSortKeys[by]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort key %q", by)
+	}
+	t.Lock()
+	res := make([]ClientCounters, 0, len(t.clients))
+	for _, c := range t.clients {
+		res = append(res, *c)
+	}
+	t.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		if key(&res[i]) != key(&res[j]) {
+			return key(&res[i]) > key(&res[j])
+		}
+		return res[i].Client < res[j].Client
+	})
+	if n < len(res) {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// handleClients returns the top clients of the last metric interval.
+// Supports top=N and by=<counter> query parameters
+func (s *JSONStats) handleClients(w http.ResponseWriter, r *http.Request) {
+	n := DefaultTopClients
+	if v := r.URL.Query().Get("top"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid top %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "traffic"
+	}
+
+	s.reportMux.RLock()
+	top, err := s.report.clients.top(n, by)
+	s.reportMux.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	replyJSON(w, r, top)
+}
+
+// SetClientsLimit sets the maximum number of clients with own counters in each shard. 0 disables per client counters
+func (s *JSONStats) SetClientsLimit(limit int) {
+	s.shardsMux.Lock()
+	defer s.shardsMux.Unlock()
+	s.clientsLimit = limit
+	for _, sh := range s.shards {
+		sh.clients.setLimit(limit)
+	}
+}
+
+// IncClientSubscription atomically add 1 to the subscriptions granted to the client
+func (s *JSONStats) IncClientSubscription(client string) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.clients.update(client, 0, func(c *ClientCounters) { c.Subscriptions++ })
+}
+
+// IncClientDenied atomically add 1 to the subscriptions denied to the client
+func (s *JSONStats) IncClientDenied(client string) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.clients.update(client, 0, func(c *ClientCounters) { c.Denied++ })
+}
+
+// IncClientRXSignaling atomically add 1 to the signaling messages received from the client
+func (s *JSONStats) IncClientRXSignaling(client string) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.clients.update(client, 1, func(c *ClientCounters) { c.RXSignaling++ })
+}
+
+// IncClientTX atomically add 1 to the messages of the type sent to the client
+func (s *JSONStats) IncClientTX(client string, t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.clients.update(client, 1, func(c *ClientCounters) {
+		switch t {
+		case ptp.MessageSync:
+			c.TXSync++
+		case ptp.MessageAnnounce:
+			c.TXAnnounce++
+		case ptp.MessageDelayResp:
+			c.TXDelayResp++
+		}
+	})
+}
@@ -0,0 +1,129 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCountersDisabled(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncClientRXSignaling("10.0.0.1")
+	require.Empty(t, stats.clients.clients)
+}
+
+func TestClientCounters(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetClientsLimit(10)
+
+	stats.IncClientRXSignaling("10.0.0.1")
+	stats.IncClientSubscription("10.0.0.1")
+	stats.IncClientTX("10.0.0.1", ptp.MessageSync)
+	stats.IncClientTX("10.0.0.1", ptp.MessageAnnounce)
+	stats.IncClientTX("10.0.0.1", ptp.MessageDelayResp)
+	stats.IncClientRXSignaling("10.0.0.2")
+	stats.IncClientDenied("10.0.0.2")
+
+	require.Equal(t, ClientCounters{Client: "10.0.0.1", Subscriptions: 1, RXSignaling: 1, TXSync: 1, TXAnnounce: 1, TXDelayResp: 1, Traffic: 4}, *stats.clients.clients["10.0.0.1"])
+	require.Equal(t, ClientCounters{Client: "10.0.0.2", Denied: 1, RXSignaling: 1, Traffic: 1}, *stats.clients.clients["10.0.0.2"])
+
+	stats.Snapshot()
+	stats.Reset()
+	require.Empty(t, stats.clients.clients)
+	require.Len(t, stats.report.clients.clients, 2)
+}
+
+func TestClientCountersEviction(t *testing.T) {
+	table := clientTable{}
+	table.init()
+	table.setLimit(2)
+	inc := func(c *ClientCounters) { c.RXSignaling++ }
+
+	for i := 0; i < 5; i++ {
+		table.update("flood", 1, inc)
+	}
+	table.update("a", 1, inc)
+	table.update("a", 1, inc)
+	// replaces a with the least traffic and inherits it
+	table.update("b", 1, inc)
+
+	require.Len(t, table.clients, 2)
+	require.Equal(t, int64(5), table.clients["flood"].Traffic)
+	require.Equal(t, ClientCounters{Client: "b", RXSignaling: 1, Traffic: 3, Overcount: 2}, *table.clients["b"])
+}
+
+func TestClientTableTop(t *testing.T) {
+	table := clientTable{}
+	table.init()
+	table.setLimit(10)
+
+	table.update("a", 1, func(c *ClientCounters) { c.Denied++ })
+	for i := 0; i < 3; i++ {
+		table.update("b", 1, func(c *ClientCounters) { c.TXSync++ })
+	}
+	table.update("c", 1, func(c *ClientCounters) { c.TXSync++ })
+
+	top, err := table.top(2, "traffic")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "a"}, []string{top[0].Client, top[1].Client})
+
+	top, err = table.top(10, "denied")
+	require.NoError(t, err)
+	require.Len(t, top, 3)
+	require.Equal(t, "a", top[0].Client)
+
+	_, err = table.top(1, "nope")
+	require.Error(t, err)
+}
+
+func TestClientsExport(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetClientsLimit(10)
+	port, err := getFreePort()
+	require.Nil(t, err, "Failed to allocate port")
+	go stats.Start(port)
+	time.Sleep(time.Second)
+
+	stats.IncClientRXSignaling("10.0.0.1")
+	stats.IncClientRXSignaling("10.0.0.2")
+	stats.IncClientRXSignaling("10.0.0.2")
+	stats.Snapshot()
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/clients?top=1", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var top []ClientCounters
+	require.NoError(t, json.Unmarshal(body, &top))
+	require.Equal(t, []ClientCounters{{Client: "10.0.0.2", RXSignaling: 2, Traffic: 2}}, top)
+
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%d/clients?by=nope", port))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is a payload size below which compression is not worth it
+const gzipMinSize = 1024
+
+// acceptsGzip checks if gzip is acceptable according to the Accept-Encoding header.
+// Explicit gzip entry takes precedence over the * wildcard, coding names are case-insensitive
+func acceptsGzip(header string) bool {
+	wildcard := false
+	for _, enc := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(enc, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		accepted := true
+		if q := strings.TrimSpace(params); len(q) > 1 && strings.EqualFold(q[:2], "q=") {
+			v, err := strconv.ParseFloat(q[2:], 64)
+			accepted = err == nil && v > 0
+		}
+		if name == "gzip" {
+			return accepted
+		}
+		wildcard = accepted
+	}
+	return wildcard
+}
+
+// WriteCompressed writes payload gzipped if client accepts it and payload is large enough
+func WriteCompressed(w http.ResponseWriter, r *http.Request, payload []byte) error {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(payload) < gzipMinSize || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		_, err := w.Write(payload)
+		return err
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(payload); err != nil {
+		return err
+	}
+	return gz.Close()
+}
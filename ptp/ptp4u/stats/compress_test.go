@@ -0,0 +1,75 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	require.False(t, acceptsGzip(""))
+	require.False(t, acceptsGzip("identity"))
+	require.False(t, acceptsGzip("br, deflate"))
+	require.False(t, acceptsGzip("gzip;q=0"))
+	require.True(t, acceptsGzip("gzip"))
+	require.True(t, acceptsGzip("deflate, gzip;q=0.5"))
+	require.True(t, acceptsGzip("*"))
+	require.True(t, acceptsGzip("GZIP"))
+	require.True(t, acceptsGzip("gzip;Q=1"))
+	// explicit refusal wins over the wildcard
+	require.False(t, acceptsGzip("gzip;q=0, *"))
+	require.False(t, acceptsGzip("*, gzip;q=0"))
+	require.True(t, acceptsGzip("*;q=0, gzip"))
+	require.False(t, acceptsGzip("br, *;q=0"))
+}
+
+func TestWriteCompressed(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), gzipMinSize)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	require.NoError(t, WriteCompressed(w, r, payload))
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	require.Less(t, w.Body.Len(), len(payload))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	got, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, payload, got)
+
+	// not accepted
+	r = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	require.NoError(t, WriteCompressed(w, r, payload))
+	require.Equal(t, "", w.Header().Get("Content-Encoding"))
+	require.Equal(t, payload, w.Body.Bytes())
+
+	// too small
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	require.NoError(t, WriteCompressed(w, r, payload[:10]))
+	require.Equal(t, "", w.Header().Get("Content-Encoding"))
+	require.Equal(t, payload[:10], w.Body.Bytes())
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MetricWriter renders metric families of other daemons the way the ptp4u backends render the server stats
+type MetricWriter struct {
+	promWriter
+}
+
+// Family starts a metric family of the type, counter or gauge
+func (w *MetricWriter) Family(name, typ, help string) {
+	w.family(name, typ, help)
+}
+
+// Sample writes a sample of the current family with the label name and value pairs
+func (w *MetricWriter) Sample(name string, value float64, labels ...string) {
+	w.sample(name, value, labels...)
+}
+
+// Collector writes the metric families of a daemon
+type Collector func(w *MetricWriter)
+
+// Exporter exports the metrics of daemons other than ptp4u through the ptp4u backends,
+// so they share the naming, the Prometheus exposition and the StatsD push with the server
+type Exporter struct {
+	collect Collector
+	statsd  statsdPusher
+}
+
+// NewExporter returns an exporter of the collected metrics, which are named namespace_<name>
+func NewExporter(namespace string, collect Collector) *Exporter {
+	e := &Exporter{collect: collect}
+	e.statsd.namespace = namespace
+	e.statsd.last = map[string]float64{}
+	return e
+}
+
+// render collects the metrics
+func (e *Exporter) render() *MetricWriter {
+	w := &MetricWriter{}
+	e.collect(w)
+	return w
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WriteCompressed(w, r, []byte(e.render().String())); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
+
+// PushStatsD starts pushing the metrics to the StatsD agent every flush interval
+func (e *Exporter) PushStatsD(c StatsDConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	e.statsd.config = c
+	return e.statsd.start(func() []promSample { return e.render().samples })
+}
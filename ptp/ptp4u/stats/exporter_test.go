@@ -0,0 +1,49 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	var sent float64
+	e := NewExporter("sptp", func(w *MetricWriter) {
+		w.Family("sptp_tx_messages_total", "counter", "Sent PTP messages")
+		w.Sample("sptp_tx_messages_total", sent, "message_type", "delay_req")
+		w.Family("sptp_gm_offset_seconds", "gauge", "Offset from the GM")
+		w.Sample("sptp_gm_offset_seconds", -0.001, "server", "10.0.0.1")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, rec.Body.String(), "# TYPE sptp_tx_messages_total counter\nsptp_tx_messages_total{message_type=\"delay_req\"} 0\n")
+	require.Contains(t, rec.Body.String(), "sptp_gm_offset_seconds{server=\"10.0.0.1\"} -0.001\n")
+
+	e.statsd.config = StatsDConfig{Prefix: "sptp.", DogStatsD: true}
+	sent = 5
+	var buf bytes.Buffer
+	require.NoError(t, e.statsd.flush(&buf, e.render().samples))
+	require.Equal(t, "sptp.tx_messages:5|c|#message_type:delay_req\nsptp.gm_offset_seconds:-0.001|g|#server:10.0.0.1", buf.String())
+
+	require.Error(t, e.PushStatsD(StatsDConfig{}))
+}
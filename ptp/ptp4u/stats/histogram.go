@@ -0,0 +1,147 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// histogramSubBits is log2 of the number of linear sub-buckets per power of 2.
+// It bounds the relative error of the reported percentiles to 1/8
+const histogramSubBits = 3
+
+// histogramBuckets is enough buckets for any non-negative int64
+const histogramBuckets = 64 << histogramSubBits
+
+// HistogramPercentiles are the percentiles reported for every histogram
+var HistogramPercentiles = []int{50, 95, 99}
+
+// histogramBucket returns the index of the log-linear bucket of v
+func histogramBucket(v int64) int {
+	if v < 1<<histogramSubBits {
+		return int(v)
+	}
+	exp := bits.Len64(uint64(v)) - 1 - histogramSubBits
+	mantissa := int(v>>exp) & (1<<histogramSubBits - 1)
+	return (exp+1)<<histogramSubBits + mantissa
+}
+
+// histogramUpper returns the largest value of the bucket
+func histogramUpper(i int) int64 {
+	if i < 1<<histogramSubBits {
+		return int64(i)
+	}
+	exp := i>>histogramSubBits - 1
+	mantissa := int64(i & (1<<histogramSubBits - 1))
+	lower := (1<<histogramSubBits | mantissa) << exp
+	return lower + 1<<exp - 1
+}
+
+// syncHistogram is a concurrent histogram of durations with log-linear buckets
+type syncHistogram struct {
+	buckets [histogramBuckets]int64
+	count   int64
+	sum     int64
+	max     int64
+}
+
+// observe atomically adds the duration to the histogram
+func (h *syncHistogram) observe(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	atomic.AddInt64(&h.buckets[histogramBucket(v)], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+	for {
+		m := atomic.LoadInt64(&h.max)
+		if v <= m || atomic.CompareAndSwapInt64(&h.max, m, v) {
+			return
+		}
+	}
+}
+
+// copy all the buckets to dst
+func (h *syncHistogram) copy(dst *syncHistogram) {
+	for i := range h.buckets {
+		atomic.StoreInt64(&dst.buckets[i], atomic.LoadInt64(&h.buckets[i]))
+	}
+	atomic.StoreInt64(&dst.count, atomic.LoadInt64(&h.count))
+	atomic.StoreInt64(&dst.sum, atomic.LoadInt64(&h.sum))
+	atomic.StoreInt64(&dst.max, atomic.LoadInt64(&h.max))
+}
+
+// addTo adds all the buckets to the buckets of dst
+func (h *syncHistogram) addTo(dst *syncHistogram) {
+	for i := range h.buckets {
+		atomic.AddInt64(&dst.buckets[i], atomic.LoadInt64(&h.buckets[i]))
+	}
+	atomic.AddInt64(&dst.count, atomic.LoadInt64(&h.count))
+	atomic.AddInt64(&dst.sum, atomic.LoadInt64(&h.sum))
+	if m := atomic.LoadInt64(&h.max); m > atomic.LoadInt64(&dst.max) {
+		atomic.StoreInt64(&dst.max, m)
+	}
+}
+
+// reset the histogram to empty
+func (h *syncHistogram) reset() {
+	for i := range h.buckets {
+		atomic.StoreInt64(&h.buckets[i], 0)
+	}
+	atomic.StoreInt64(&h.count, 0)
+	atomic.StoreInt64(&h.sum, 0)
+	atomic.StoreInt64(&h.max, 0)
+}
+
+// percentile returns the upper bound of the bucket the p-th percentile falls into, capped by the max
+func (h *syncHistogram) percentile(p int) int64 {
+	count := atomic.LoadInt64(&h.count)
+	if count == 0 {
+		return 0
+	}
+	target := (count*int64(p) + 99) / 100
+	if target < 1 {
+		target = 1
+	}
+	max := atomic.LoadInt64(&h.max)
+	var seen int64
+	for i := range h.buckets {
+		seen += atomic.LoadInt64(&h.buckets[i])
+		if seen >= target {
+			if u := histogramUpper(i); u < max {
+				return u
+			}
+			return max
+		}
+	}
+	return max
+}
+
+// toMap adds the percentiles and max of a non-empty histogram to the map
+func (h *syncHistogram) toMap(name string, res map[string]int64) {
+	if atomic.LoadInt64(&h.count) == 0 {
+		return
+	}
+	for _, p := range HistogramPercentiles {
+		res[fmt.Sprintf("%s.p%d_ns", name, p)] = h.percentile(p)
+	}
+	res[fmt.Sprintf("%s.max_ns", name)] = atomic.LoadInt64(&h.max)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	for _, v := range []int64{0, 1, 7, 8, 9, 15, 16, 17, 1000, 123456789, 1<<62 + 1} {
+		i := histogramBucket(v)
+		require.Less(t, i, histogramBuckets)
+		require.LessOrEqual(t, v, histogramUpper(i), v)
+		if i > 0 {
+			require.Greater(t, v, histogramUpper(i-1), v)
+		}
+		// relative error is bounded by the sub-buckets
+		require.LessOrEqual(t, float64(histogramUpper(i)-v), float64(v)/(1<<histogramSubBits), v)
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := &syncHistogram{}
+	require.Equal(t, int64(0), h.percentile(50))
+
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Microsecond)
+	}
+	require.InEpsilon(t, 50*time.Microsecond, h.percentile(50), 0.125)
+	require.InEpsilon(t, 95*time.Microsecond, h.percentile(95), 0.125)
+	require.InEpsilon(t, 99*time.Microsecond, h.percentile(99), 0.125)
+	require.Equal(t, int64(100*time.Microsecond), h.percentile(100))
+	require.Equal(t, int64(100), h.count)
+
+	res := map[string]int64{}
+	h.toMap("test", res)
+	require.Len(t, res, len(HistogramPercentiles)+1)
+	require.Equal(t, int64(100*time.Microsecond), res["test.max_ns"])
+
+	h.reset()
+	res = map[string]int64{}
+	h.toMap("test", res)
+	require.Empty(t, res)
+}
+
+func TestHistogramConcurrent(t *testing.T) {
+	h := &syncHistogram{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.observe(time.Duration(i*1000 + j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int64(10000), h.count)
+	require.Equal(t, int64(9999), h.max)
+
+	dst := &syncHistogram{}
+	h.addTo(dst)
+	h.addTo(dst)
+	require.Equal(t, int64(20000), dst.count)
+	require.Equal(t, h.percentile(50), dst.percentile(50))
+}
+
+func TestJSONStatsLatencyHistograms(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.ObserveTXTSLatency(20 * time.Microsecond)
+	stats.ObserveFanoutDuration(3 * time.Millisecond)
+	stats.ObserveKernelTXLatency(40 * time.Microsecond)
+	m := stats.toMap()
+	require.Equal(t, int64(20*time.Microsecond), m["txts_latency.max_ns"])
+	require.Equal(t, int64(20*time.Microsecond), m["txts_latency.p99_ns"])
+	require.Equal(t, int64(3*time.Millisecond), m["sync_fanout.p50_ns"])
+	require.Equal(t, int64(40*time.Microsecond), m["kernel_tx_latency.max_ns"])
+
+	stats.Snapshot()
+	stats.Reset()
+	require.NotContains(t, stats.toMap(), "txts_latency.max_ns")
+	require.Contains(t, stats.report.toMap(), "txts_latency.max_ns")
+}
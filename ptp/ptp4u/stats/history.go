@@ -0,0 +1,170 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultHistory is the number of snapshots kept in memory unless configured otherwise
+const DefaultHistory = 10
+
+// HistorySnapshot is a snapshot of the stats served on /history
+type HistorySnapshot struct {
+	Time   time.Time        `json:"time"`
+	Values map[string]int64 `json:"values"`
+}
+
+// Delta is the difference between the two most recent snapshots served on /delta
+type Delta struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Elapsed is the time between the snapshots
+	Elapsed time.Duration `json:"elapsed_ns"`
+	// Delta is the value of the newer snapshot minus the older one, absent values are 0
+	Delta map[string]int64 `json:"delta"`
+	// Rates are the deltas per second
+	Rates map[string]float64 `json:"rates"`
+}
+
+// snapshotHistory keeps the last snapshots, oldest first
+type snapshotHistory struct {
+	size      int
+	snapshots []HistorySnapshot
+}
+
+// add records the snapshot, forgetting the oldest ones over the size
+func (h *snapshotHistory) add(s HistorySnapshot) {
+	if h.size <= 0 {
+		return
+	}
+	h.snapshots = append(h.snapshots, s)
+	if over := len(h.snapshots) - h.size; over > 0 {
+		h.snapshots = append([]HistorySnapshot{}, h.snapshots[over:]...)
+	}
+}
+
+// last returns up to n most recent snapshots, oldest first. Non-positive n returns all of them
+func (h *snapshotHistory) last(n int) []HistorySnapshot {
+	if n <= 0 || n > len(h.snapshots) {
+		n = len(h.snapshots)
+	}
+	return append([]HistorySnapshot{}, h.snapshots[len(h.snapshots)-n:]...)
+}
+
+// delta returns the difference between the two most recent snapshots
+func (h *snapshotHistory) delta() (*Delta, bool) {
+	if len(h.snapshots) < 2 {
+		return nil, false
+	}
+	from, to := h.snapshots[len(h.snapshots)-2], h.snapshots[len(h.snapshots)-1]
+	return snapshotDelta(from, to), true
+}
+
+// snapshotDelta returns the difference of the snapshots and its rates per second
+func snapshotDelta(from, to HistorySnapshot) *Delta {
+	d := &Delta{
+		From:    from.Time,
+		To:      to.Time,
+		Elapsed: to.Time.Sub(from.Time),
+		Delta:   map[string]int64{},
+		Rates:   map[string]float64{},
+	}
+	for k, v := range to.Values {
+		d.Delta[k] = v - from.Values[k]
+	}
+	for k, v := range from.Values {
+		if _, ok := to.Values[k]; !ok {
+			d.Delta[k] = -v
+		}
+	}
+	if d.Elapsed <= 0 {
+		return d
+	}
+	for k, v := range d.Delta {
+		d.Rates[k] = float64(v) / d.Elapsed.Seconds()
+	}
+	return d
+}
+
+// SetHistorySize sets the number of snapshots kept for /history and /delta. 0 disables the history
+func (s *JSONStats) SetHistorySize(size int) {
+	s.historyMux.Lock()
+	defer s.historyMux.Unlock()
+	s.history.size = size
+	if size <= 0 {
+		s.history.snapshots = nil
+		return
+	}
+	s.history.snapshots = s.history.last(size)
+}
+
+// recordSnapshot adds report to the history. Called with the report locked
+func (s *JSONStats) recordSnapshot(t time.Time) {
+	s.historyMux.Lock()
+	defer s.historyMux.Unlock()
+	if s.history.size <= 0 {
+		return
+	}
+	s.history.add(HistorySnapshot{Time: t, Values: s.report.toMap()})
+}
+
+// handleHistory returns the kept snapshots, oldest first, limited to the last n ones by the query
+func (s *JSONStats) handleHistory(w http.ResponseWriter, r *http.Request) {
+	n := 0
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, "invalid n "+strconv.Quote(v), http.StatusBadRequest)
+			return
+		}
+	}
+	s.historyMux.Lock()
+	snapshots := s.history.last(n)
+	s.historyMux.Unlock()
+	replyJSON(w, r, snapshots)
+}
+
+// handleDelta returns the difference between the two most recent snapshots
+func (s *JSONStats) handleDelta(w http.ResponseWriter, r *http.Request) {
+	s.historyMux.Lock()
+	d, ok := s.history.delta()
+	s.historyMux.Unlock()
+	if !ok {
+		http.Error(w, "less than two snapshots taken so far", http.StatusServiceUnavailable)
+		return
+	}
+	replyJSON(w, r, d)
+}
+
+// replyJSON writes v marshaled as JSON
+func replyJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = WriteCompressed(w, r, js); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotDelta(t *testing.T) {
+	now := time.Now()
+	from := HistorySnapshot{Time: now, Values: map[string]int64{"tx.sync": 10, "gone": 3}}
+	to := HistorySnapshot{Time: now.Add(2 * time.Second), Values: map[string]int64{"tx.sync": 30, "new": 4}}
+	d := snapshotDelta(from, to)
+	require.Equal(t, 2*time.Second, d.Elapsed)
+	require.Equal(t, map[string]int64{"tx.sync": 20, "gone": -3, "new": 4}, d.Delta)
+	require.Equal(t, map[string]float64{"tx.sync": 10, "gone": -1.5, "new": 2}, d.Rates)
+
+	d = snapshotDelta(from, from)
+	require.Empty(t, d.Rates)
+}
+
+func TestSnapshotHistory(t *testing.T) {
+	h := &snapshotHistory{size: 3}
+	_, ok := h.delta()
+	require.False(t, ok)
+	for i := int64(0); i < 5; i++ {
+		h.add(HistorySnapshot{Values: map[string]int64{"i": i}})
+	}
+	require.Equal(t, 3, len(h.last(0)))
+	last := h.last(2)
+	require.Equal(t, int64(3), last[0].Values["i"])
+	require.Equal(t, int64(4), last[1].Values["i"])
+	d, ok := h.delta()
+	require.True(t, ok)
+	require.Equal(t, int64(1), d.Delta["i"])
+}
+
+func TestHistoryRecorded(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetHistorySize(2)
+	serve := func(h http.HandlerFunc, query string, v interface{}) int {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/"+query, nil))
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+		return w.Code
+	}
+
+	d := &Delta{}
+	stats.IncTX(ptp.MessageSync)
+	stats.Snapshot()
+	require.Equal(t, http.StatusServiceUnavailable, serve(stats.handleDelta, "", d))
+
+	for i := 0; i < 3; i++ {
+		stats.IncTX(ptp.MessageSync)
+	}
+	stats.Snapshot()
+	require.Equal(t, http.StatusOK, serve(stats.handleDelta, "", d))
+	require.Equal(t, int64(3), d.Delta["tx.sync"])
+	require.Positive(t, d.Rates["tx.sync"])
+
+	stats.Snapshot()
+	history := []HistorySnapshot{}
+	require.Equal(t, http.StatusOK, serve(stats.handleHistory, "", &history))
+	require.Equal(t, 2, len(history))
+	require.Equal(t, int64(4), history[0].Values["tx.sync"])
+	require.Equal(t, http.StatusOK, serve(stats.handleHistory, "?n=1", &history))
+	require.Equal(t, 1, len(history))
+	require.Equal(t, http.StatusBadRequest, serve(stats.handleHistory, "?n=x", &history))
+
+	stats.SetHistorySize(0)
+	stats.Snapshot()
+	require.Equal(t, http.StatusOK, serve(stats.handleHistory, "", &history))
+	require.Empty(t, history)
+}
@@ -20,193 +20,788 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 	log "github.com/sirupsen/logrus"
 )
 
-// JSONStats is what we want to report as stats via http
+// JSONStats is what we want to report as stats via http.
+// Updates go to the shard of the JSONStats, taking only its epoch lock, so workers updating
+// their own shards from Shard don't contend on it. Snapshot and Reset hold the locks of all
+// the shards, so every snapshot is a point in time sum where no update is half applied
 type JSONStats struct {
-	report counters
+	*jsonReport
+	*statsShard
+}
 
+// statsShard are the counters updated by one worker
+type statsShard struct {
+	epoch sync.RWMutex
 	counters
 }
 
+// jsonReport is shared by all the shards of the JSONStats
+type jsonReport struct {
+	// shardsMux protects the shards from being added while they are summed
+	shardsMux    sync.Mutex
+	shards       []*statsShard
+	clientsLimit int
+
+	// reportMux protects report from being read while the snapshot is taken
+	reportMux sync.RWMutex
+	report    counters
+
+	// mux serves the monitoring port
+	mux *http.ServeMux
+	// interval is the snapshot interval, zero for the metric interval of the server
+	interval time.Duration
+
+	// historyMux protects the snapshots kept for /history and /delta
+	historyMux sync.Mutex
+	history    snapshotHistory
+}
+
 // NewJSONStats returns a new JSONStats
 func NewJSONStats() *JSONStats {
-	s := &JSONStats{}
+	r := &jsonReport{mux: http.NewServeMux(), history: snapshotHistory{size: DefaultHistory}}
+	r.report.init()
+
+	return &JSONStats{jsonReport: r, statsShard: r.newShard()}
+}
 
-	s.init()
-	s.report.init()
+// newShard returns new counters summed on snapshots
+func (r *jsonReport) newShard() *statsShard {
+	sh := &statsShard{}
+	sh.init()
 
-	return s
+	r.shardsMux.Lock()
+	defer r.shardsMux.Unlock()
+	sh.clients.setLimit(r.clientsLimit)
+	r.shards = append(r.shards, sh)
+	return sh
+}
+
+// allShards returns the shards added so far
+func (r *jsonReport) allShards() []*statsShard {
+	r.shardsMux.Lock()
+	defer r.shardsMux.Unlock()
+	return r.shards
+}
+
+// lock holds the epoch locks of all the shards, waiting for the updates in flight
+func (r *jsonReport) lock() []*statsShard {
+	shards := r.allShards()
+	for _, sh := range shards {
+		sh.epoch.Lock()
+	}
+	return shards
+}
+
+// unlock releases the epoch locks taken by lock
+func unlock(shards []*statsShard) {
+	for _, sh := range shards {
+		sh.epoch.Unlock()
+	}
+}
+
+// Shard returns the stats updating own counters, summed with the others on Snapshot.
+// Every worker takes its own one so updates on the hot path share neither lock nor cache lines
+func (s *JSONStats) Shard() Stats {
+	return &JSONStats{jsonReport: s.jsonReport, statsShard: s.newShard()}
 }
 
 // Start runs http server and initializes maps
 func (s *JSONStats) Start(monitoringport int) {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.handleRequest)
+	s.mux.HandleFunc("/", s.handleRequest)
+	s.mux.HandleFunc("/metadata", handleMetadata)
+	s.mux.HandleFunc("/clients", s.handleClients)
+	s.mux.HandleFunc("/history", s.handleHistory)
+	s.mux.HandleFunc("/delta", s.handleDelta)
 	addr := fmt.Sprintf(":%d", monitoringport)
 	log.Infof("Starting http json server on %s", addr)
-	err := http.ListenAndServe(addr, mux)
+	err := http.ListenAndServe(addr, s.mux)
 	if err != nil {
 		log.Fatalf("Failed to start listener: %v", err)
 	}
 }
 
+// Schedule returns the snapshot interval of the stats served on /
+func (s *JSONStats) Schedule(_ func()) time.Duration {
+	return s.interval
+}
+
+// Handle registers an extra handler served on the monitoring port
+func (s *JSONStats) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Live returns the values collected so far in the current epoch
+func (s *JSONStats) Live() map[string]int64 {
+	var live counters
+	live.init()
+	for _, sh := range s.allShards() {
+		sh.epoch.RLock()
+		sh.addTo(&live)
+		sh.epoch.RUnlock()
+	}
+	return live.toMap()
+}
+
+// Report returns the values of the last snapshot
+func (s *JSONStats) Report() map[string]int64 {
+	s.reportMux.RLock()
+	defer s.reportMux.RUnlock()
+	return s.report.toMap()
+}
+
 // Snapshot the values so they can be reported atomically
 func (s *JSONStats) Snapshot() {
-	s.subscriptions.copy(&s.report.subscriptions)
-	s.rx.copy(&s.report.rx)
-	s.tx.copy(&s.report.tx)
-	s.rxSignalingGrant.copy(&s.report.rxSignalingGrant)
-	s.rxSignalingCancel.copy(&s.report.rxSignalingCancel)
-	s.txSignalingGrant.copy(&s.report.txSignalingGrant)
-	s.txSignalingCancel.copy(&s.report.txSignalingCancel)
-	s.workerQueue.copy(&s.report.workerQueue)
-	s.workerSubs.copy(&s.report.workerSubs)
-	s.txtsattempts.copy(&s.report.txtsattempts)
-	s.report.utcoffsetSec = s.utcoffsetSec
-	s.report.clockaccuracy = s.clockaccuracy
-	s.report.clockclass = s.clockclass
-	s.report.drain = s.drain
-	s.report.reload = s.reload
+	shards := s.lock()
+	defer unlock(shards)
+	s.reportMux.Lock()
+	defer s.reportMux.Unlock()
+
+	s.report.reset()
+	for _, sh := range shards {
+		sh.addTo(&s.report)
+	}
+	s.recordSnapshot(time.Now())
 }
 
 // handleRequest is a handler used for all http monitoring requests
 func (s *JSONStats) handleRequest(w http.ResponseWriter, r *http.Request) {
-	js, err := json.Marshal(s.report.toMap())
+	js, err := json.Marshal(s.Report())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	if _, err = w.Write(js); err != nil {
+	if err = WriteCompressed(w, r, js); err != nil {
 		log.Errorf("Failed to reply: %v", err)
 	}
 }
 
 // Reset atomically sets all the counters to 0
 func (s *JSONStats) Reset() {
-	s.reset()
+	shards := s.lock()
+	defer unlock(shards)
+	for _, sh := range shards {
+		sh.reset()
+	}
 }
 
 // IncSubscription atomically add 1 to the counter
 func (s *JSONStats) IncSubscription(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.subscriptions.inc(int(t))
 }
 
 // IncRX atomically add 1 to the counter
 func (s *JSONStats) IncRX(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.rx.inc(int(t))
 }
 
 // IncTX atomically add 1 to the counter
 func (s *JSONStats) IncTX(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.tx.inc(int(t))
 }
 
 // IncRXSignalingGrant atomically add 1 to the counter
 func (s *JSONStats) IncRXSignalingGrant(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.rxSignalingGrant.inc(int(t))
 }
 
 // IncRXSignalingCancel atomically add 1 to the counter
 func (s *JSONStats) IncRXSignalingCancel(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.rxSignalingCancel.inc(int(t))
 }
 
+// IncRXSignalingCoalesced atomically add 1 to the grant requests identical to the running subscription
+func (s *JSONStats) IncRXSignalingCoalesced(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.rxCoalesced.inc(int(t))
+}
+
+// IncRXDomain atomically add 1 to the messages received on the PTP domain
+func (s *JSONStats) IncRXDomain(domain uint8) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.rxDomain.inc(int(domain))
+}
+
 // IncTXSignalingGrant atomically add 1 to the counter
 func (s *JSONStats) IncTXSignalingGrant(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.txSignalingGrant.inc(int(t))
 }
 
 // IncTXSignalingCancel atomically add 1 to the counter
 func (s *JSONStats) IncTXSignalingCancel(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.txSignalingCancel.inc(int(t))
 }
 
 // IncWorkerSubs atomically add 1 to the counter
 func (s *JSONStats) IncWorkerSubs(workerid int) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.workerSubs.inc(workerid)
 }
 
 // IncReload atomically add 1 to the counter
 func (s *JSONStats) IncReload() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	atomic.StoreInt64(&s.reload, 1)
 }
 
+// IncConfigRollback atomically add 1 to the config rollback counter
+func (s *JSONStats) IncConfigRollback() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.configRollback, 1)
+}
+
+// SetConfigGeneration atomically sets the generation of the applied dynamic config
+func (s *JSONStats) SetConfigGeneration(gen int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.configGeneration, gen)
+}
+
+// SetShutdownPending atomically sets the number of subscriptions left to cancel on shutdown
+func (s *JSONStats) SetShutdownPending(pending int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.shutdownPending, pending)
+}
+
+// SetShutdownCancelled atomically sets the number of subscriptions cancelled on shutdown
+func (s *JSONStats) SetShutdownCancelled(cancelled int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.shutdownCancelled, cancelled)
+}
+
+// IncWorkerAssignment atomically add 1 to the counter
+func (s *JSONStats) IncWorkerAssignment(workerid int) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.workerAssignments.inc(workerid)
+}
+
 // DecSubscription atomically removes 1 from the counter
 func (s *JSONStats) DecSubscription(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.subscriptions.dec(int(t))
 }
 
 // DecRX atomically removes 1 from the counter
 func (s *JSONStats) DecRX(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.rx.dec(int(t))
 }
 
 // DecTX atomically removes 1 from the counter
 func (s *JSONStats) DecTX(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.tx.dec(int(t))
 }
 
 // DecRXSignalingGrant atomically removes 1 from the counter
 func (s *JSONStats) DecRXSignalingGrant(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.rxSignalingGrant.dec(int(t))
 }
 
 // DecRXSignalingCancel atomically removes 1 from the counter
 func (s *JSONStats) DecRXSignalingCancel(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.rxSignalingCancel.dec(int(t))
 }
 
 // DecTXSignalingGrant atomically removes 1 from the counter
 func (s *JSONStats) DecTXSignalingGrant(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.txSignalingGrant.dec(int(t))
 }
 
 // DecTXSignalingCancel atomically removes 1 from the counter
 func (s *JSONStats) DecTXSignalingCancel(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.txSignalingCancel.dec(int(t))
 }
 
 // DecWorkerSubs atomically removes 1 from the counter
 func (s *JSONStats) DecWorkerSubs(workerid int) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	s.workerSubs.dec(workerid)
 }
 
 // SetMaxWorkerQueue atomically sets worker queue len
 func (s *JSONStats) SetMaxWorkerQueue(workerid int, queue int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	if queue > s.workerQueue.load(workerid) {
 		s.workerQueue.store(workerid, queue)
 	}
 }
 
+// AddWorkerOverruns atomically adds to the periodic sends the worker serviced after their interval was over
+func (s *JSONStats) AddWorkerOverruns(workerid int, overruns int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.workerOverruns.add(workerid, overruns)
+}
+
+// SetMaxWorkerLateness atomically sets max time from the scheduled send to the worker servicing it
+func (s *JSONStats) SetMaxWorkerLateness(workerid int, ns int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	if ns > s.workerLateness.load(workerid) {
+		s.workerLateness.store(workerid, ns)
+	}
+}
+
 // SetMaxTXTSAttempts atomically sets number of retries for get latest TX timestamp
 func (s *JSONStats) SetMaxTXTSAttempts(workerid int, attempts int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	if attempts > s.txtsattempts.load(workerid) {
 		s.txtsattempts.store(workerid, attempts)
 	}
 }
 
+// SetMaxShadowDivergence atomically sets max divergence of the active scheduler from the shadow one
+func (s *JSONStats) SetMaxShadowDivergence(workerid int, ns int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	if ns > s.shadowDivergence.load(workerid) {
+		s.shadowDivergence.store(workerid, ns)
+	}
+}
+
+// SetWorkerCPUTime atomically sets CPU time consumed by the worker thread since last reset
+func (s *JSONStats) SetWorkerCPUTime(workerid int, ns int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.workerCPU.store(workerid, ns)
+}
+
+// AddWorkerPhaseTime atomically adds time spent by the worker in a pipeline phase
+func (s *JSONStats) AddWorkerPhaseTime(workerid int, phase WorkerPhase, ns int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	switch phase {
+	case PhaseSerialization:
+		s.workerSerialize.add(workerid, ns)
+	case PhaseTXTimestamp:
+		s.workerTXTS.add(workerid, ns)
+	case PhaseSocketIO:
+		s.workerSocket.add(workerid, ns)
+	}
+}
+
 // SetUTCOffsetSec atomically sets the utcoffset
 func (s *JSONStats) SetUTCOffsetSec(utcoffsetSec int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	atomic.StoreInt64(&s.utcoffsetSec, utcoffsetSec)
 }
 
 // SetClockAccuracy atomically sets the clock accuracy
 func (s *JSONStats) SetClockAccuracy(clockaccuracy int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	atomic.StoreInt64(&s.clockaccuracy, clockaccuracy)
 }
 
 // SetClockClass atomically sets the clock class
 func (s *JSONStats) SetClockClass(clockclass int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	atomic.StoreInt64(&s.clockclass, clockclass)
 }
 
+// SetClockClassRaw atomically sets the clock class before debouncing
+func (s *JSONStats) SetClockClassRaw(clockclass int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.clockclassRaw, clockclass)
+}
+
 // SetDrain atomically sets the drain status
 func (s *JSONStats) SetDrain(drain int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
 	atomic.StoreInt64(&s.drain, drain)
 }
+
+// SetDegraded atomically sets the peer drift degradation status
+func (s *JSONStats) SetDegraded(degraded int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.degraded, degraded)
+}
+
+// SetNTPOffset atomically sets the offset of the served time from NTP
+func (s *JSONStats) SetNTPOffset(offset int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.ntpOffset, offset)
+}
+
+// SetUpstreamOffset atomically sets the offset from the upstream master in boundary mode
+func (s *JSONStats) SetUpstreamOffset(offset int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.upstreamOffset, offset)
+}
+
+// SetUpstreamPathDelay atomically sets the mean path delay to the upstream master in boundary mode
+func (s *JSONStats) SetUpstreamPathDelay(delay int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.upstreamDelay, delay)
+}
+
+// SetUpstreamServoState atomically sets the servo state of the sync to the upstream master in boundary mode
+func (s *JSONStats) SetUpstreamServoState(state int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.upstreamServo, state)
+}
+
+// SetNTPAlarm atomically sets the NTP cross-check alarm
+func (s *JSONStats) SetNTPAlarm(alarm int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.ntpAlarm, alarm)
+}
+
+// SetUTCOffsetAlarm atomically sets the UTC offset consistency alarm
+func (s *JSONStats) SetUTCOffsetAlarm(alarm int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.utcOffsetAlarm, alarm)
+}
+
+// SetLeapPending atomically sets the upcoming leap second
+func (s *JSONStats) SetLeapPending(leap int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.leapPending, leap)
+}
+
+// SetLeapSmear atomically sets the offset of the served time from TAI while a leap second is smeared
+func (s *JSONStats) SetLeapSmear(ns int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.leapSmear, ns)
+}
+
+// SetFeature atomically sets the feature flag state
+func (s *JSONStats) SetFeature(f Feature, enabled int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.features.store(int(f), enabled)
+}
+
+// SetTenantSubscriptions atomically sets the number of running subscriptions of the tenant
+func (s *JSONStats) SetTenantSubscriptions(tenant string, count int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.tenantSubs.store(tenant, count)
+}
+
+// IncTenantQuotaReject atomically add 1 to the subscriptions rejected over the tenant quota
+func (s *JSONStats) IncTenantQuotaReject(tenant string) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.tenantRejects.inc(tenant)
+}
+
+// SetPathDelay atomically sets the percentile of the client to server delay of the prefix
+func (s *JSONStats) SetPathDelay(prefix string, percentile int, delay time.Duration) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.pathDelay.store(fmt.Sprintf("%s.p%d", prefix, percentile), int64(delay))
+}
+
+// SetCanary atomically sets the behavior of the canary subscription to the target
+func (s *JSONStats) SetCanary(target string, c CanaryStats) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	var alarm int64
+	if c.Alarm {
+		alarm = 1
+	}
+	s.canary.store(target+".sends", c.Sends)
+	s.canary.store(target+".txts_failures", c.TXTSFailures)
+	s.canary.store(target+".txts_latency_max_ns", int64(c.MaxTXTSLatency))
+	s.canary.store(target+".cadence_error_max_ns", int64(c.MaxCadenceError))
+	s.canary.store(target+".alarm", alarm)
+}
+
+// SetFPSDemand atomically sets the packets per second the subscriptions of the message type ask for
+func (s *JSONStats) SetFPSDemand(t ptp.MessageType, pps int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.fpsDemand.store(int(t), pps)
+}
+
+// SetFPSStretch atomically sets the percentage the intervals of the message type are stretched to in order to fit the FPS caps
+func (s *JSONStats) SetFPSStretch(t ptp.MessageType, percent int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.fpsStretch.store(int(t), percent)
+}
+
+// IncTXOversize atomically add 1 to the messages not sent because they exceed the path MTU
+func (s *JSONStats) IncTXOversize(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.txOversize.inc(int(t))
+}
+
+// IncTXSignalingSplit atomically add 1 to the signaling messages split to fit into the path MTU
+func (s *JSONStats) IncTXSignalingSplit() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.txSignalingSplit, 1)
+}
+
+// IncRXECNCE atomically add 1 to the event messages received with the ECN Congestion Experienced mark
+func (s *JSONStats) IncRXECNCE() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.rxECNCE, 1)
+}
+
+// IncRXBlocked atomically add 1 to the messages dropped because the client is blocked
+func (s *JSONStats) IncRXBlocked() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.rxBlocked, 1)
+}
+
+// SetTimestampingInfo atomically sets the timestamping mode and NIC description
+func (s *JSONStats) SetTimestampingInfo(info TimestampingInfo) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.timestamping.store(info)
+}
+
+// SetDrained atomically sets the graceful drain status
+func (s *JSONStats) SetDrained(drained int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.drained, drained)
+}
+
+// SetBlocklistEntries atomically sets the number of blocklist entries
+func (s *JSONStats) SetBlocklistEntries(entries int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.blocklistEntries, entries)
+}
+
+// IncDeniedACL atomically add 1 to the grant requests denied by the ACL
+func (s *JSONStats) IncDeniedACL() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.deniedACL, 1)
+}
+
+// IncDeniedRateLimit atomically add 1 to the grant requests denied over the per client request rate
+func (s *JSONStats) IncDeniedRateLimit() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.deniedRateLimit, 1)
+}
+
+// IncDeniedClientLimit atomically add 1 to the grant requests denied over the per client subscription limit
+func (s *JSONStats) IncDeniedClientLimit() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.deniedClientLimit, 1)
+}
+
+// IncDeniedPolicy atomically add 1 to the grant requests denied by the policy
+func (s *JSONStats) IncDeniedPolicy() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.deniedPolicy, 1)
+}
+
+// IncGrantHintHonored atomically add 1 to the grants extended by the client grant hint
+func (s *JSONStats) IncGrantHintHonored() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.grantHintHonored, 1)
+}
+
+// IncAuthFailure atomically add 1 to the received messages which failed authentication for the reason
+func (s *JSONStats) IncAuthFailure(reason string) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.authFailures.inc(reason)
+}
+
+// IncCompat atomically add 1 to the times the compatibility mode changed how a client was served
+func (s *JSONStats) IncCompat(mode string) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.compat.inc(mode)
+}
+
+// IncFollowUpOutcome atomically add 1 to the Sync TX timestamps with the Follow_Up budget outcome
+func (s *JSONStats) IncFollowUpOutcome(outcome string) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.followUpOutcomes.inc(outcome)
+}
+
+// IncInterfaceRX atomically add 1 to the messages of the type received on the interface
+func (s *JSONStats) IncInterfaceRX(iface string, t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.ifaceRX.inc(iface, int(t))
+}
+
+// IncInterfaceTX atomically add 1 to the messages of the type sent from the interface
+func (s *JSONStats) IncInterfaceTX(iface string, t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.ifaceTX.inc(iface, int(t))
+}
+
+// IncSubscriptionCreated atomically add 1 to the subscriptions created
+func (s *JSONStats) IncSubscriptionCreated() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.churnCreated, 1)
+}
+
+// IncSubscriptionExpired atomically add 1 to the finished subscriptions cleaned up
+func (s *JSONStats) IncSubscriptionExpired() {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.churnExpired, 1)
+}
+
+// AddChurnAllocs atomically adds the heap allocations attributed to subscription creation
+func (s *JSONStats) AddChurnAllocs(bytes, objects int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.AddInt64(&s.churnAllocBytes, bytes)
+	atomic.AddInt64(&s.churnAllocObjects, objects)
+}
+
+// SetGCStats atomically sets the garbage collector activity over the metric interval
+func (s *JSONStats) SetGCStats(gc GCStats) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.gcCycles, gc.Cycles)
+	atomic.StoreInt64(&s.gcPauseNs, gc.PauseNs)
+	atomic.StoreInt64(&s.gcMaxPauseNs, gc.MaxPauseNs)
+	atomic.StoreInt64(&s.heapAllocBytes, gc.HeapAllocBytes)
+}
+
+// SetWorkerSizing atomically sets how the worker pool was sized
+func (s *JSONStats) SetWorkerSizing(ws WorkerSizing) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	var auto int64
+	if ws.Auto {
+		auto = 1
+	}
+	atomic.StoreInt64(&s.sizingCPUs, ws.CPUs)
+	atomic.StoreInt64(&s.sizingRXQueues, ws.RXQueues)
+	atomic.StoreInt64(&s.sizingTXQueues, ws.TXQueues)
+	atomic.StoreInt64(&s.sizingSubs, ws.Subscriptions)
+	atomic.StoreInt64(&s.sizingSend, ws.SendWorkers)
+	atomic.StoreInt64(&s.sizingRecv, ws.RecvWorkers)
+	atomic.StoreInt64(&s.sizingRecommended, ws.RecommendedSendWorkers)
+	atomic.StoreInt64(&s.sizingAuto, auto)
+}
+
+// SetStandby atomically sets the standby mode status
+func (s *JSONStats) SetStandby(standby int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	atomic.StoreInt64(&s.standby, standby)
+}
+
+// IncStandbySuppressed atomically add 1 to the messages not sent because of the standby mode
+func (s *JSONStats) IncStandbySuppressed(t ptp.MessageType) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.standbySuppressed.inc(int(t))
+}
+
+// SetSocketRcvBuf atomically sets the receive buffer size of the socket
+func (s *JSONStats) SetSocketRcvBuf(socket string, bytes int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.socketRcvBuf.store(socket, bytes)
+}
+
+// AddSocketDrops atomically adds packets dropped by the kernel on the socket
+func (s *JSONStats) AddSocketDrops(socket string, drops int64) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.socketDrops.add(socket, drops)
+}
+
+// ObserveTimeToFirstSync atomically adds the time it took a client to get the first Sync and Follow Up to the histogram
+func (s *JSONStats) ObserveTimeToFirstSync(d time.Duration) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.timeToFirstSync.inc(timeToFirstSyncBucket(d))
+	atomic.AddInt64(&s.timeToFirstSyncNs, int64(d))
+}
+
+// ObserveTXTSLatency atomically adds the time it took to read the TX timestamp of a Sync to the histogram
+func (s *JSONStats) ObserveTXTSLatency(d time.Duration) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.txtsLatency.observe(d)
+}
+
+// ObserveFanoutDuration atomically adds the time it took a worker to send a burst of Syncs to the histogram
+func (s *JSONStats) ObserveFanoutDuration(d time.Duration) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.syncFanout.observe(d)
+}
+
+// ObserveKernelTXLatency atomically adds the time from sending an event message until the kernel reported its TX timestamp to the histogram
+func (s *JSONStats) ObserveKernelTXLatency(d time.Duration) {
+	s.epoch.RLock()
+	defer s.epoch.RUnlock()
+	s.kernelTXLatency.observe(d)
+}
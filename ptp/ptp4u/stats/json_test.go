@@ -22,6 +22,8 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -44,11 +46,7 @@ func getFreePort() (int, error) {
 }
 
 func TestJSONStatsReset(t *testing.T) {
-	stats := JSONStats{}
-	stats.subscriptions.init()
-	stats.rxSignalingGrant.init()
-	stats.rxSignalingCancel.init()
-	stats.workerQueue.init()
+	stats := NewJSONStats()
 
 	stats.IncSubscription(ptp.MessageAnnounce)
 	stats.IncRXSignalingGrant(ptp.MessageSync)
@@ -147,6 +145,61 @@ func TestJSONStatsWorkerSubs(t *testing.T) {
 	require.Equal(t, int64(0), stats.tx.load(10))
 }
 
+func TestJSONStatsLive(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncTX(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.Live()["tx.sync"])
+	stats.Snapshot()
+	stats.Reset()
+	require.Equal(t, int64(0), stats.Live()["tx.sync"])
+}
+
+func TestJSONStatsWorkerAssignment(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncWorkerAssignment(10)
+	stats.IncWorkerAssignment(10)
+	require.Equal(t, int64(2), stats.workerAssignments.load(10))
+	require.Equal(t, int64(2), stats.toMap()["worker.10.assignments"])
+}
+
+func TestJSONStatsWorkerCPU(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetWorkerCPUTime(1, 42)
+	stats.AddWorkerPhaseTime(1, PhaseSerialization, 10)
+	stats.AddWorkerPhaseTime(1, PhaseSerialization, 10)
+	stats.AddWorkerPhaseTime(1, PhaseTXTimestamp, 20)
+	stats.AddWorkerPhaseTime(1, PhaseSocketIO, 30)
+
+	res := stats.toMap()
+	require.Equal(t, int64(42), res["worker.1.cpu_ns"])
+	require.Equal(t, int64(20), res["worker.1.serialization_ns"])
+	require.Equal(t, int64(20), res["worker.1.txts_ns"])
+	require.Equal(t, int64(30), res["worker.1.socket_ns"])
+}
+
+func TestJSONStatsSetMaxShadowDivergence(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetMaxShadowDivergence(3, 42)
+	stats.SetMaxShadowDivergence(3, 10)
+	require.Equal(t, int64(42), stats.shadowDivergence.load(3))
+	require.Equal(t, int64(42), stats.toMap()["worker.3.shadow_divergence_ns"])
+}
+
+func TestJSONStatsWorkerOverruns(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.AddWorkerOverruns(3, 2)
+	stats.AddWorkerOverruns(3, 1)
+	stats.SetMaxWorkerLateness(3, 42)
+	stats.SetMaxWorkerLateness(3, 10)
+	require.Equal(t, int64(3), stats.toMap()["worker.3.overruns"])
+	require.Equal(t, int64(42), stats.toMap()["worker.3.lateness_ns"])
+}
+
 func TestJSONStatsSetMaxTXTSAttempts(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -173,6 +226,8 @@ func TestJSONStatsSetClockCLass(t *testing.T) {
 
 	stats.SetClockClass(42)
 	require.Equal(t, int64(42), stats.clockclass)
+	stats.SetClockClassRaw(43)
+	require.Equal(t, int64(43), stats.clockclassRaw)
 }
 
 func TestJSONStatsSetDrain(t *testing.T) {
@@ -182,6 +237,363 @@ func TestJSONStatsSetDrain(t *testing.T) {
 	require.Equal(t, int64(1), stats.drain)
 }
 
+func TestJSONStatsSetDegraded(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetDegraded(1)
+	require.Equal(t, int64(1), stats.degraded)
+}
+
+func TestJSONStatsSetShutdown(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetShutdownPending(10)
+	stats.SetShutdownCancelled(5)
+	require.Equal(t, int64(10), stats.shutdownPending)
+	require.Equal(t, int64(5), stats.shutdownCancelled)
+}
+
+func TestJSONStatsObserveTimeToFirstSync(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.ObserveTimeToFirstSync(50 * time.Millisecond)
+	stats.ObserveTimeToFirstSync(time.Second)
+	stats.ObserveTimeToFirstSync(time.Hour)
+	require.Equal(t, int64(1), stats.timeToFirstSync.load(0))
+	require.Equal(t, int64(1), stats.timeToFirstSync.load(3))
+	require.Equal(t, int64(1), stats.timeToFirstSync.load(len(TimeToFirstSyncBuckets)))
+
+	m := stats.toMap()
+	require.Equal(t, int64(1), m["time_to_first_sync.le_100ms"])
+	require.Equal(t, int64(1), m["time_to_first_sync.le_500ms"])
+	require.Equal(t, int64(2), m["time_to_first_sync.le_1000ms"])
+	require.Equal(t, int64(2), m["time_to_first_sync.le_60000ms"])
+	require.Equal(t, int64(3), m["time_to_first_sync.le_inf"])
+}
+
+func TestJSONStatsTXOversize(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncTXOversize(ptp.MessageSignaling)
+	stats.IncTXSignalingSplit()
+	require.Equal(t, int64(1), stats.txOversize.load(int(ptp.MessageSignaling)))
+	require.Equal(t, int64(1), stats.txSignalingSplit)
+	require.Equal(t, int64(1), stats.toMap()["tx.oversize.signaling"])
+}
+
+func TestJSONStatsRXSignalingCoalesced(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncRXSignalingCoalesced(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.rxCoalesced.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(1), stats.toMap()["rx.signaling.coalesced.sync"])
+}
+
+func TestJSONStatsRXDomain(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncRXDomain(0)
+	stats.IncRXDomain(24)
+	stats.IncRXDomain(24)
+	require.Equal(t, int64(2), stats.rxDomain.load(24))
+	require.Equal(t, int64(1), stats.toMap()["rx.domain.0"])
+	require.Equal(t, int64(2), stats.toMap()["rx.domain.24"])
+}
+
+func TestJSONStatsRXECNCE(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncRXECNCE()
+	stats.IncRXECNCE()
+	require.Equal(t, int64(2), stats.rxECNCE)
+	require.Equal(t, int64(2), stats.toMap()["rx.ecn.ce"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["rx.ecn.ce"])
+}
+
+func TestJSONStatsSetDrained(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetDrained(1)
+	require.Equal(t, int64(1), stats.drained)
+	require.Equal(t, int64(1), stats.toMap()["drained"])
+}
+
+func TestJSONStatsSetTimestampingInfo(t *testing.T) {
+	stats := NewJSONStats()
+	require.NotContains(t, stats.toMap(), "phc.index")
+
+	stats.SetTimestampingInfo(TimestampingInfo{Mode: TimestampingHardware, PHCIndex: 2, Driver: "mlx5_core", Firmware: "16.35.2000"})
+	m := stats.toMap()
+	require.Equal(t, int64(1), m["timestamping.hardware"])
+	require.Equal(t, int64(2), m["phc.index"])
+	require.Equal(t, int64(1), m["nic.driver.mlx5_core"])
+	require.Equal(t, int64(1), m["nic.firmware.16.35.2000"])
+
+	stats.SetTimestampingInfo(TimestampingInfo{Mode: TimestampingSoftware, PHCIndex: -1})
+	m = stats.toMap()
+	require.Equal(t, int64(1), m["timestamping.software"])
+	require.Equal(t, int64(-1), m["phc.index"])
+	require.NotContains(t, m, "timestamping.hardware")
+	require.NotContains(t, m, "nic.driver.mlx5_core")
+}
+
+func TestJSONStatsBlocklist(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncRXBlocked()
+	stats.SetBlocklistEntries(3)
+	require.Equal(t, int64(1), stats.rxBlocked)
+	require.Equal(t, int64(1), stats.toMap()["rx.blocked"])
+	require.Equal(t, int64(3), stats.toMap()["blocklist.entries"])
+}
+
+func TestJSONStatsDenied(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncDeniedACL()
+	stats.IncDeniedRateLimit()
+	stats.IncDeniedRateLimit()
+	stats.IncDeniedPolicy()
+	stats.IncDeniedClientLimit()
+	require.Equal(t, int64(1), stats.toMap()["denied.acl"])
+	require.Equal(t, int64(2), stats.toMap()["denied.ratelimit"])
+	require.Equal(t, int64(1), stats.toMap()["denied.clientlimit"])
+	require.Equal(t, int64(1), stats.toMap()["denied.policy"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["denied.acl"])
+}
+
+func TestJSONStatsStandby(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetStandby(1)
+	stats.IncStandbySuppressed(ptp.MessageSync)
+	stats.IncStandbySuppressed(ptp.MessageSync)
+	require.Equal(t, int64(1), stats.standby)
+	require.Equal(t, int64(2), stats.standbySuppressed.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(2), stats.toMap()["standby.suppressed.sync"])
+}
+
+func TestJSONStatsSocket(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetSocketRcvBuf("event", 4096)
+	stats.AddSocketDrops("event", 2)
+	stats.AddSocketDrops("event", 3)
+	require.Equal(t, int64(4096), stats.socketRcvBuf.load("event"))
+	require.Equal(t, int64(5), stats.socketDrops.load("event"))
+
+	m := stats.toMap()
+	require.Equal(t, int64(4096), m["socket.event.rcvbuf"])
+	require.Equal(t, int64(5), m["socket.event.drops"])
+}
+
+func TestJSONStatsSetNTP(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetNTPOffset(-42)
+	stats.SetNTPAlarm(1)
+	require.Equal(t, int64(-42), stats.ntpOffset)
+	require.Equal(t, int64(1), stats.ntpAlarm)
+}
+
+func TestJSONStatsSetUpstream(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetUpstreamOffset(-42)
+	stats.SetUpstreamPathDelay(1500)
+	stats.SetUpstreamServoState(2)
+	m := stats.toMap()
+	require.Equal(t, int64(-42), m["upstream.offset_ns"])
+	require.Equal(t, int64(1500), m["upstream.path_delay_ns"])
+	require.Equal(t, int64(2), m["upstream.servo_state"])
+}
+
+func TestJSONStatsSetUTCOffsetAlarm(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetUTCOffsetAlarm(1)
+	require.Equal(t, int64(1), stats.utcOffsetAlarm)
+	require.Equal(t, int64(1), stats.toMap()["utcoffset.alarm"])
+}
+
+func TestJSONStatsSetLeap(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetLeapPending(-1)
+	stats.SetLeapSmear(int64(500 * time.Millisecond))
+	require.Equal(t, int64(-1), stats.toMap()["leap.pending"])
+	require.Equal(t, int64(500*time.Millisecond), stats.toMap()["leap.smear_ns"])
+}
+
+func TestJSONStatsConfig(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncConfigRollback()
+	stats.SetConfigGeneration(3)
+	require.Equal(t, int64(1), stats.configRollback)
+	require.Equal(t, int64(3), stats.configGeneration)
+}
+
+func TestJSONStatsTenants(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetTenantSubscriptions("lab", 42)
+	stats.IncTenantQuotaReject("lab")
+	stats.IncTenantQuotaReject("lab")
+	require.Equal(t, int64(42), stats.toMap()["tenant.lab.subscriptions"])
+	require.Equal(t, int64(2), stats.toMap()["tenant.lab.quota_rejects"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["tenant.lab.quota_rejects"])
+}
+
+func TestJSONStatsAuthFailures(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncAuthFailure("icv")
+	stats.IncAuthFailure("icv")
+	stats.IncAuthFailure("missing")
+	require.Equal(t, int64(2), stats.toMap()["auth.failures.icv"])
+	require.Equal(t, int64(1), stats.toMap()["auth.failures.missing"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["auth.failures.icv"])
+}
+
+func TestJSONStatsCompat(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncCompat("first-tlv.v1")
+	stats.IncCompat("first-tlv.v1")
+	require.Equal(t, int64(2), stats.toMap()["compat.first-tlv.v1"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["compat.first-tlv.v1"])
+}
+
+func TestJSONStatsFollowUpOutcomes(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncFollowUpOutcome("ontime")
+	stats.IncFollowUpOutcome("ontime")
+	stats.IncFollowUpOutcome("skipped")
+	require.Equal(t, int64(2), stats.toMap()["followup.ontime"])
+	require.Equal(t, int64(1), stats.toMap()["followup.skipped"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["followup.ontime"])
+}
+
+func TestJSONStatsInterfaces(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncInterfaceRX("eth0", ptp.MessageDelayReq)
+	stats.IncInterfaceRX("eth1", ptp.MessageDelayReq)
+	stats.IncInterfaceRX("eth1", ptp.MessageSignaling)
+	stats.IncInterfaceTX("eth1", ptp.MessageSync)
+	stats.IncInterfaceTX("eth1", ptp.MessageSync)
+	require.Equal(t, int64(1), stats.toMap()["iface.eth0.rx.delay_req"])
+	require.Equal(t, int64(1), stats.toMap()["iface.eth1.rx.delay_req"])
+	require.Equal(t, int64(1), stats.toMap()["iface.eth1.rx.signaling"])
+	require.Equal(t, int64(2), stats.toMap()["iface.eth1.tx.sync"])
+
+	stats.Snapshot()
+	require.Equal(t, int64(2), stats.report.toMap()["iface.eth1.tx.sync"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["iface.eth1.tx.sync"])
+}
+
+func TestJSONStatsChurn(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.IncSubscriptionCreated()
+	stats.IncSubscriptionCreated()
+	stats.IncSubscriptionExpired()
+	stats.AddChurnAllocs(1024, 10)
+	stats.AddChurnAllocs(1024, 10)
+	stats.SetGCStats(GCStats{Cycles: 3, PauseNs: 1500, MaxPauseNs: 1000, HeapAllocBytes: 1 << 20})
+	m := stats.toMap()
+	require.Equal(t, int64(2), m["churn.created"])
+	require.Equal(t, int64(1), m["churn.expired"])
+	require.Equal(t, int64(2048), m["churn.alloc_bytes"])
+	require.Equal(t, int64(20), m["churn.alloc_objects"])
+	require.Equal(t, int64(3), m["gc.cycles"])
+	require.Equal(t, int64(1500), m["gc.pause_ns"])
+	require.Equal(t, int64(1000), m["gc.max_pause_ns"])
+	require.Equal(t, int64(1<<20), m["gc.heap_alloc_bytes"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["churn.alloc_bytes"])
+}
+
+func TestJSONStatsWorkerSizing(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetWorkerSizing(WorkerSizing{CPUs: 32, RXQueues: 8, TXQueues: 16, Subscriptions: 50000, SendWorkers: 50, RecvWorkers: 8, RecommendedSendWorkers: 64, Auto: true})
+	m := stats.toMap()
+	require.Equal(t, int64(32), m["workers.sizing.cpus"])
+	require.Equal(t, int64(8), m["workers.sizing.rx_queues"])
+	require.Equal(t, int64(16), m["workers.sizing.tx_queues"])
+	require.Equal(t, int64(50000), m["workers.sizing.subscriptions"])
+	require.Equal(t, int64(50), m["workers.sizing.send"])
+	require.Equal(t, int64(8), m["workers.sizing.recv"])
+	require.Equal(t, int64(64), m["workers.sizing.recommended_send"])
+	require.Equal(t, int64(1), m["workers.sizing.auto"])
+}
+
+func TestJSONStatsPathDelay(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetPathDelay("192.168.0.0/24", 50, 20*time.Microsecond)
+	stats.SetPathDelay("192.168.0.0/24", 99, 42*time.Microsecond)
+	require.Equal(t, int64(20000), stats.toMap()["pathdelay.192.168.0.0/24.p50_ns"])
+	require.Equal(t, int64(42000), stats.toMap()["pathdelay.192.168.0.0/24.p99_ns"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["pathdelay.192.168.0.0/24.p50_ns"])
+}
+
+func TestJSONStatsCanary(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetCanary("self", CanaryStats{Sends: 60, TXTSFailures: 1, MaxTXTSLatency: 20 * time.Microsecond, MaxCadenceError: time.Millisecond, Alarm: true})
+	require.Equal(t, int64(60), stats.toMap()["canary.self.sends"])
+	require.Equal(t, int64(1), stats.toMap()["canary.self.txts_failures"])
+	require.Equal(t, int64(20000), stats.toMap()["canary.self.txts_latency_max_ns"])
+	require.Equal(t, int64(1000000), stats.toMap()["canary.self.cadence_error_max_ns"])
+	require.Equal(t, int64(1), stats.toMap()["canary.self.alarm"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["canary.self.alarm"])
+}
+
+func TestJSONStatsFPS(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetFPSDemand(ptp.MessageSync, 60000)
+	stats.SetFPSStretch(ptp.MessageSync, 120)
+	require.Equal(t, int64(60000), stats.toMap()["fps.demand.sync"])
+	require.Equal(t, int64(120), stats.toMap()["fps.stretch_pct.sync"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.toMap()["fps.stretch_pct.sync"])
+}
+
+func TestJSONStatsSetFeature(t *testing.T) {
+	stats := NewJSONStats()
+
+	stats.SetFeature(FeatureTimeSequence, 1)
+	stats.SetFeature(FeatureShadowScheduler, 0)
+	require.Equal(t, int64(1), stats.features.load(int(FeatureTimeSequence)))
+	require.Equal(t, int64(1), stats.toMap()["feature.timesequence"])
+	require.Equal(t, int64(0), stats.toMap()["feature.shadowscheduler"])
+}
+
 func TestJSONStatsSnapshot(t *testing.T) {
 	stats := NewJSONStats()
 
@@ -213,9 +625,9 @@ func TestJSONStatsSnapshot(t *testing.T) {
 	expectedStats.drain = 1
 	expectedStats.reload = 1
 
-	require.Equal(t, expectedStats.subscriptions.m, stats.report.subscriptions.m)
-	require.Equal(t, expectedStats.tx.m, stats.report.tx.m)
-	require.Equal(t, expectedStats.rxSignalingGrant.m, stats.report.rxSignalingGrant.m)
+	require.Equal(t, expectedStats.subscriptions.values(), stats.report.subscriptions.values())
+	require.Equal(t, expectedStats.tx.values(), stats.report.tx.values())
+	require.Equal(t, expectedStats.rxSignalingGrant.values(), stats.report.rxSignalingGrant.values())
 	require.Equal(t, expectedStats.utcoffsetSec, stats.report.utcoffsetSec)
 	require.Equal(t, expectedStats.clockaccuracy, stats.report.clockaccuracy)
 	require.Equal(t, expectedStats.clockclass, stats.report.clockclass)
@@ -223,6 +635,99 @@ func TestJSONStatsSnapshot(t *testing.T) {
 	require.Equal(t, expectedStats.reload, stats.report.reload)
 }
 
+func TestJSONStatsSnapshotConsistent(t *testing.T) {
+	stats := NewJSONStats()
+
+	var stop int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every TX is preceded by RX, so no snapshot may see more TX than RX
+			for atomic.LoadInt32(&stop) == 0 {
+				stats.IncRX(ptp.MessageDelayReq)
+				stats.IncTX(ptp.MessageDelayResp)
+			}
+		}()
+	}
+
+	for i := 0; i < 10000; i++ {
+		stats.Snapshot()
+		rx := stats.report.rx.load(int(ptp.MessageDelayReq))
+		tx := stats.report.tx.load(int(ptp.MessageDelayResp))
+		require.LessOrEqual(t, tx, rx)
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+}
+
+func TestJSONStatsShard(t *testing.T) {
+	stats := NewJSONStats()
+	stats.SetClientsLimit(10)
+	w := stats.Shard()
+
+	stats.IncTX(ptp.MessageSync)
+	w.IncTX(ptp.MessageSync)
+	w.IncTX(ptp.MessageAnnounce)
+	w.SetMaxWorkerQueue(1, 42)
+	w.IncClientTX("10.0.0.1", ptp.MessageSync)
+	stats.IncClientSubscription("10.0.0.1")
+	stats.SetClockClass(6)
+
+	live := stats.Live()
+	require.Equal(t, int64(2), live["tx.sync"])
+	require.Equal(t, int64(1), live["tx.announce"])
+	require.Equal(t, int64(42), live["worker.1.queue"])
+	require.Equal(t, int64(6), live["clockclass"])
+
+	stats.Snapshot()
+	require.Equal(t, int64(2), stats.report.tx.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(1), stats.report.tx.load(int(ptp.MessageAnnounce)))
+	require.Equal(t, int64(6), stats.report.clockclass)
+	require.Equal(t, int64(2), w.Report()["tx.sync"])
+	require.Equal(t, ClientCounters{Client: "10.0.0.1", Subscriptions: 1, TXSync: 1, Traffic: 1}, *stats.report.clients.clients["10.0.0.1"])
+
+	stats.Reset()
+	require.Equal(t, int64(0), stats.Live()["tx.sync"])
+
+	// the next snapshot doesn't keep what only the previous one had
+	w.IncTX(ptp.MessageSync)
+	stats.Snapshot()
+	require.Equal(t, int64(1), stats.report.tx.load(int(ptp.MessageSync)))
+	require.Equal(t, int64(0), stats.report.tx.load(int(ptp.MessageAnnounce)))
+	require.Empty(t, stats.report.clients.clients)
+}
+
+func TestJSONStatsShardSnapshotConsistent(t *testing.T) {
+	stats := NewJSONStats()
+
+	var stop int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		w := stats.Shard()
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				w.IncRX(ptp.MessageDelayReq)
+				w.IncTX(ptp.MessageDelayResp)
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		stats.Snapshot()
+		rx := stats.report.rx.load(int(ptp.MessageDelayReq))
+		tx := stats.report.tx.load(int(ptp.MessageDelayResp))
+		// every worker is at most one RX ahead of its TX
+		require.LessOrEqual(t, tx, rx)
+		require.LessOrEqual(t, rx-tx, int64(4))
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+}
+
 func TestJSONExport(t *testing.T) {
 	stats := NewJSONStats()
 	port, err := getFreePort()
@@ -265,7 +770,48 @@ func TestJSONExport(t *testing.T) {
 	expectedMap["utcoffset_sec"] = 1
 	expectedMap["clockaccuracy"] = 1
 	expectedMap["clockclass"] = 1
+	expectedMap["clockclass.raw"] = 0
 	expectedMap["drain"] = 1
+	expectedMap["drained"] = 0
+	expectedMap["degraded"] = 0
+	expectedMap["ntp.offset_ns"] = 0
+	expectedMap["upstream.offset_ns"] = 0
+	expectedMap["upstream.path_delay_ns"] = 0
+	expectedMap["upstream.servo_state"] = 0
+	expectedMap["ntp.alarm"] = 0
+	expectedMap["utcoffset.alarm"] = 0
+	expectedMap["leap.pending"] = 0
+	expectedMap["leap.smear_ns"] = 0
+	expectedMap["config.rollback"] = 0
+	expectedMap["config.generation"] = 0
+	expectedMap["shutdown.pending"] = 0
+	expectedMap["shutdown.cancelled"] = 0
+	expectedMap["standby"] = 0
+	expectedMap["tx.signaling.split"] = 0
+	expectedMap["rx.ecn.ce"] = 0
+	expectedMap["rx.blocked"] = 0
+	expectedMap["blocklist.entries"] = 0
+	expectedMap["denied.acl"] = 0
+	expectedMap["denied.ratelimit"] = 0
+	expectedMap["denied.clientlimit"] = 0
+	expectedMap["denied.policy"] = 0
+	expectedMap["granthint.honored"] = 0
+	expectedMap["churn.created"] = 0
+	expectedMap["churn.expired"] = 0
+	expectedMap["churn.alloc_bytes"] = 0
+	expectedMap["churn.alloc_objects"] = 0
+	expectedMap["gc.cycles"] = 0
+	expectedMap["gc.pause_ns"] = 0
+	expectedMap["gc.max_pause_ns"] = 0
+	expectedMap["gc.heap_alloc_bytes"] = 0
+	expectedMap["workers.sizing.cpus"] = 0
+	expectedMap["workers.sizing.rx_queues"] = 0
+	expectedMap["workers.sizing.tx_queues"] = 0
+	expectedMap["workers.sizing.subscriptions"] = 0
+	expectedMap["workers.sizing.send"] = 0
+	expectedMap["workers.sizing.recv"] = 0
+	expectedMap["workers.sizing.recommended_send"] = 0
+	expectedMap["workers.sizing.auto"] = 0
 	expectedMap["reload"] = 1
 
 	require.Equal(t, expectedMap, data)
@@ -0,0 +1,58 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MetricMetadata describes a metric family the server may export
+type MetricMetadata struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Unit string `json:"unit,omitempty"`
+	Help string `json:"help"`
+}
+
+// metricUnits are the base units of the name suffixes following the Prometheus naming conventions
+var metricUnits = []string{"seconds", "bytes", "ratio"}
+
+// unitOf returns the unit encoded in the metric name, empty for plain counts
+func unitOf(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+	for _, u := range metricUnits {
+		if strings.HasSuffix(name, "_"+u) {
+			return u
+		}
+	}
+	return ""
+}
+
+// Metadata returns every metric family the Prometheus and StatsD backends may export, sorted by name.
+// Families are listed even if they have no samples yet, e.g. before the first subscription
+func Metadata() []MetricMetadata {
+	m := NewPrometheusStats().collect().families
+	sort.Slice(m, func(i, j int) bool { return m[i].Name < m[j].Name })
+	return m
+}
+
+// handleMetadata replies with the metadata of the metrics
+func handleMetadata(w http.ResponseWriter, r *http.Request) {
+	replyJSON(w, r, Metadata())
+}
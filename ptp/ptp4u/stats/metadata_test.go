@@ -0,0 +1,80 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitOf(t *testing.T) {
+	require.Equal(t, "seconds", unitOf("ptp4u_gc_pause_seconds_total"))
+	require.Equal(t, "seconds", unitOf("ptp4u_utcoffset_seconds"))
+	require.Equal(t, "bytes", unitOf("ptp4u_socket_rcvbuf_bytes"))
+	require.Equal(t, "ratio", unitOf("ptp4u_fps_stretch_ratio"))
+	require.Equal(t, "", unitOf("ptp4u_tx_messages_total"))
+	require.Equal(t, "", unitOf("ptp4u_clock_class"))
+}
+
+func TestMetadata(t *testing.T) {
+	m := Metadata()
+	byName := map[string]MetricMetadata{}
+	for i, f := range m {
+		require.NotEmpty(t, f.Help, f.Name)
+		if i > 0 {
+			require.Less(t, m[i-1].Name, f.Name)
+		}
+		byName[f.Name] = f
+	}
+
+	// families without samples are listed too
+	require.Equal(t, MetricMetadata{Name: "ptp4u_tx_messages_total", Type: "counter", Help: "Sent PTP messages"}, byName["ptp4u_tx_messages_total"])
+	require.Equal(t, "histogram", byName["ptp4u_time_to_first_sync_seconds"].Type)
+	require.Equal(t, "summary", byName["ptp4u_txts_latency_seconds"].Type)
+	require.Equal(t, "gauge", byName["ptp4u_txts_latency_seconds_max"].Type)
+	require.Equal(t, "seconds", byName["ptp4u_worker_cpu_seconds_total"].Unit)
+
+	// every exported family is described
+	stats := NewPrometheusStats()
+	stats.SetUTCOffsetSec(37)
+	stats.Snapshot()
+	for _, s := range stats.collect().samples {
+		name := s.name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if _, ok := byName[name]; !ok {
+				name = strings.TrimSuffix(name, suffix)
+			}
+		}
+		require.Contains(t, byName, name)
+	}
+}
+
+func TestHandleMetadata(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleMetadata(rr, httptest.NewRequest(http.MethodGet, "/metadata", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var got []MetricMetadata
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	require.Equal(t, Metadata(), got)
+}
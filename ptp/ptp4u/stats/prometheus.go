@@ -0,0 +1,511 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	log "github.com/sirupsen/logrus"
+)
+
+// Monitoring backends selectable on the server
+const (
+	BackendJSON       = "json"
+	BackendPrometheus = "prometheus"
+	BackendStatsD     = "statsd"
+)
+
+// PrometheusStats reports the stats on /metrics in the Prometheus text exposition format.
+// Updates are collected the same way as by JSONStats, counters JSONStats reports per metric interval
+// are accumulated into monotonic totals on every snapshot
+type PrometheusStats struct {
+	*JSONStats
+
+	// totalsMux protects the totals from being read while the snapshot is accumulated
+	totalsMux sync.RWMutex
+	totals    counters
+
+	// onScrape runs the epoch on every scrape
+	onScrape  bool
+	epochMux  sync.Mutex
+	epochFunc func()
+}
+
+// NewPrometheusStats returns a new PrometheusStats
+func NewPrometheusStats() *PrometheusStats {
+	s := &PrometheusStats{JSONStats: NewJSONStats()}
+	s.totals.init()
+	return s
+}
+
+// NewStats returns the Stats of the monitoring backend snapshotted at its interval.
+// StatsD config is only used by the statsd backend, which pushes at its own flush interval
+func NewStats(backend string, statsd StatsDConfig, intervals ReportIntervals) (Stats, error) {
+	if intervals.JSON < 0 || intervals.Prometheus < 0 {
+		return nil, fmt.Errorf("report intervals must not be negative, got %+v", intervals)
+	}
+	switch backend {
+	case BackendJSON:
+		s := NewJSONStats()
+		s.interval = intervals.JSON
+		return s, nil
+	case BackendPrometheus:
+		s := NewPrometheusStats()
+		s.interval = intervals.Prometheus
+		s.onScrape = intervals.PrometheusOnScrape
+		return s, nil
+	case BackendStatsD:
+		if err := statsd.Validate(); err != nil {
+			return nil, err
+		}
+		s := NewStatsDStats(statsd)
+		s.interval = intervals.JSON
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported monitoring backend %q", backend)
+	}
+}
+
+// Start runs http server serving /metrics, /metadata, /clients, /history and /delta
+func (s *PrometheusStats) Start(monitoringport int) {
+	s.mux.HandleFunc("/metrics", s.handleRequest)
+	s.mux.HandleFunc("/metadata", handleMetadata)
+	s.mux.HandleFunc("/clients", s.handleClients)
+	s.mux.HandleFunc("/history", s.handleHistory)
+	s.mux.HandleFunc("/delta", s.handleDelta)
+	addr := fmt.Sprintf(":%d", monitoringport)
+	log.Infof("Starting http prometheus server on %s", addr)
+	err := http.ListenAndServe(addr, s.mux)
+	if err != nil {
+		log.Fatalf("Failed to start listener: %v", err)
+	}
+}
+
+// Schedule keeps the epoch to run on scrapes and returns the snapshot interval
+func (s *PrometheusStats) Schedule(epoch func()) time.Duration {
+	s.epochMux.Lock()
+	defer s.epochMux.Unlock()
+	s.epochFunc = epoch
+	return s.interval
+}
+
+// scrape runs the epoch if snapshots are taken on scrape
+func (s *PrometheusStats) scrape() {
+	if !s.onScrape {
+		return
+	}
+	s.epochMux.Lock()
+	epoch := s.epochFunc
+	s.epochMux.Unlock()
+	if epoch != nil {
+		epoch()
+	}
+}
+
+// Snapshot the values so they can be reported atomically and add the interval counters to the totals
+func (s *PrometheusStats) Snapshot() {
+	s.JSONStats.Snapshot()
+
+	s.reportMux.RLock()
+	defer s.reportMux.RUnlock()
+	s.totalsMux.Lock()
+	defer s.totalsMux.Unlock()
+
+	r, t := &s.report, &s.totals
+	r.rx.addTo(&t.rx)
+	r.tx.addTo(&t.tx)
+	r.rxSignalingGrant.addTo(&t.rxSignalingGrant)
+	r.rxSignalingCancel.addTo(&t.rxSignalingCancel)
+	r.rxCoalesced.addTo(&t.rxCoalesced)
+	r.rxDomain.addTo(&t.rxDomain)
+	r.txSignalingGrant.addTo(&t.txSignalingGrant)
+	r.txSignalingCancel.addTo(&t.txSignalingCancel)
+	r.workerAssignments.addTo(&t.workerAssignments)
+	r.workerOverruns.addTo(&t.workerOverruns)
+	r.workerCPU.addTo(&t.workerCPU)
+	r.workerSerialize.addTo(&t.workerSerialize)
+	r.workerTXTS.addTo(&t.workerTXTS)
+	r.workerSocket.addTo(&t.workerSocket)
+	r.tenantRejects.addTo(&t.tenantRejects)
+	r.authFailures.addTo(&t.authFailures)
+	r.compat.addTo(&t.compat)
+	r.followUpOutcomes.addTo(&t.followUpOutcomes)
+	r.ifaceRX.addTo(&t.ifaceRX)
+	r.ifaceTX.addTo(&t.ifaceTX)
+	r.timeToFirstSync.addTo(&t.timeToFirstSync)
+	r.standbySuppressed.addTo(&t.standbySuppressed)
+	r.txOversize.addTo(&t.txOversize)
+	r.socketDrops.addTo(&t.socketDrops)
+	r.txtsLatency.addTo(&t.txtsLatency)
+	r.syncFanout.addTo(&t.syncFanout)
+	r.kernelTXLatency.addTo(&t.kernelTXLatency)
+	t.reload += r.reload
+	t.configRollback += r.configRollback
+	t.txSignalingSplit += r.txSignalingSplit
+	t.rxECNCE += r.rxECNCE
+	t.rxBlocked += r.rxBlocked
+	t.deniedACL += r.deniedACL
+	t.deniedRateLimit += r.deniedRateLimit
+	t.deniedClientLimit += r.deniedClientLimit
+	t.deniedPolicy += r.deniedPolicy
+	t.grantHintHonored += r.grantHintHonored
+	t.churnCreated += r.churnCreated
+	t.churnExpired += r.churnExpired
+	t.churnAllocBytes += r.churnAllocBytes
+	t.churnAllocObjects += r.churnAllocObjects
+	t.gcCycles += r.gcCycles
+	t.gcPauseNs += r.gcPauseNs
+	t.heapAllocBytes += r.heapAllocBytes
+	t.timeToFirstSyncNs += r.timeToFirstSyncNs
+}
+
+// handleRequest is a handler used for all http monitoring requests
+func (s *PrometheusStats) handleRequest(w http.ResponseWriter, r *http.Request) {
+	s.scrape()
+	payload := []byte(s.exposition())
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WriteCompressed(w, r, payload); err != nil {
+		log.Errorf("Failed to reply: %v", err)
+	}
+}
+
+// exposition renders the stats in the text format
+func (s *PrometheusStats) exposition() string {
+	return s.collect().String()
+}
+
+// collect renders gauges from the last snapshot and counters from the totals
+func (s *PrometheusStats) collect() *promWriter {
+	s.reportMux.RLock()
+	defer s.reportMux.RUnlock()
+	s.totalsMux.RLock()
+	defer s.totalsMux.RUnlock()
+
+	r, t := &s.report, &s.totals
+	w := &promWriter{}
+
+	w.family("ptp4u_rx_messages_total", "counter", "Received PTP messages")
+	w.messageTypes("ptp4u_rx_messages_total", &t.rx)
+	w.family("ptp4u_rx_ecn_ce_total", "counter", "Event messages received with the ECN Congestion Experienced mark")
+	w.sample("ptp4u_rx_ecn_ce_total", float64(t.rxECNCE))
+	w.family("ptp4u_rx_blocked_total", "counter", "Messages dropped because the client is blocked")
+	w.sample("ptp4u_rx_blocked_total", float64(t.rxBlocked))
+	w.family("ptp4u_denied_total", "counter", "Grant requests denied by access control")
+	w.sample("ptp4u_denied_total", float64(t.deniedACL), "reason", "acl")
+	w.sample("ptp4u_denied_total", float64(t.deniedRateLimit), "reason", "ratelimit")
+	w.sample("ptp4u_denied_total", float64(t.deniedClientLimit), "reason", "clientlimit")
+	w.sample("ptp4u_denied_total", float64(t.deniedPolicy), "reason", "policy")
+	w.family("ptp4u_grant_hints_honored_total", "counter", "Grants extended by the client grant hint")
+	w.sample("ptp4u_grant_hints_honored_total", float64(t.grantHintHonored))
+	w.family("ptp4u_subscription_churn_total", "counter", "Subscriptions created and cleaned up")
+	w.sample("ptp4u_subscription_churn_total", float64(t.churnCreated), "event", "created")
+	w.sample("ptp4u_subscription_churn_total", float64(t.churnExpired), "event", "expired")
+	w.family("ptp4u_churn_alloc_bytes_total", "counter", "Estimated heap bytes allocated by subscription creation")
+	w.sample("ptp4u_churn_alloc_bytes_total", float64(t.churnAllocBytes))
+	w.family("ptp4u_churn_alloc_objects_total", "counter", "Estimated heap objects allocated by subscription creation")
+	w.sample("ptp4u_churn_alloc_objects_total", float64(t.churnAllocObjects))
+	w.family("ptp4u_gc_cycles_total", "counter", "Completed GC cycles")
+	w.sample("ptp4u_gc_cycles_total", float64(t.gcCycles))
+	w.family("ptp4u_gc_pause_seconds_total", "counter", "Estimated GC stop-the-world pause time")
+	w.sample("ptp4u_gc_pause_seconds_total", float64(t.gcPauseNs)/float64(time.Second))
+	w.family("ptp4u_heap_alloc_bytes_total", "counter", "Heap bytes allocated by the process")
+	w.sample("ptp4u_heap_alloc_bytes_total", float64(t.heapAllocBytes))
+	w.family("ptp4u_worker_sizing", "gauge", "Inputs and outcome of the worker pool sizing")
+	for _, v := range []struct {
+		input string
+		value int64
+	}{
+		{"cpus", r.sizingCPUs},
+		{"rx_queues", r.sizingRXQueues},
+		{"tx_queues", r.sizingTXQueues},
+		{"subscriptions", r.sizingSubs},
+		{"send", r.sizingSend},
+		{"recv", r.sizingRecv},
+		{"recommended_send", r.sizingRecommended},
+		{"auto", r.sizingAuto},
+	} {
+		w.sample("ptp4u_worker_sizing", float64(v.value), "input", v.input)
+	}
+	w.family("ptp4u_tx_messages_total", "counter", "Sent PTP messages")
+	w.messageTypes("ptp4u_tx_messages_total", &t.tx)
+	w.family("ptp4u_interface_rx_messages_total", "counter", "Received PTP messages per interface")
+	for _, iface := range t.ifaceRX.ifaces() {
+		w.messageTypes("ptp4u_interface_rx_messages_total", t.ifaceRX.counters(iface), "interface", iface)
+	}
+	w.family("ptp4u_interface_tx_messages_total", "counter", "Sent PTP messages per interface")
+	for _, iface := range t.ifaceTX.ifaces() {
+		w.messageTypes("ptp4u_interface_tx_messages_total", t.ifaceTX.counters(iface), "interface", iface)
+	}
+	w.family("ptp4u_rx_signaling_total", "counter", "Received signaling requests")
+	w.messageTypes("ptp4u_rx_signaling_total", &t.rxSignalingGrant, "action", "grant")
+	w.messageTypes("ptp4u_rx_signaling_total", &t.rxSignalingCancel, "action", "cancel")
+	w.family("ptp4u_rx_signaling_coalesced_total", "counter", "Grant requests identical to the running subscription which refreshed it")
+	w.messageTypes("ptp4u_rx_signaling_coalesced_total", &t.rxCoalesced)
+	w.family("ptp4u_rx_domain_messages_total", "counter", "Received messages by the PTP domain")
+	for _, d := range sortedInts(&t.rxDomain) {
+		w.sample("ptp4u_rx_domain_messages_total", float64(t.rxDomain.load(d)), "domain", strconv.Itoa(d))
+	}
+	w.family("ptp4u_tx_signaling_total", "counter", "Sent signaling responses")
+	w.messageTypes("ptp4u_tx_signaling_total", &t.txSignalingGrant, "action", "grant")
+	w.messageTypes("ptp4u_tx_signaling_total", &t.txSignalingCancel, "action", "cancel")
+	w.family("ptp4u_tx_oversize_total", "counter", "Messages not sent because they exceed the path MTU")
+	w.messageTypes("ptp4u_tx_oversize_total", &t.txOversize)
+	w.family("ptp4u_tx_signaling_split_total", "counter", "Signaling messages split to fit into the path MTU")
+	w.sample("ptp4u_tx_signaling_split_total", float64(t.txSignalingSplit))
+	w.family("ptp4u_standby_suppressed_total", "counter", "Messages not sent because of the standby mode")
+	w.messageTypes("ptp4u_standby_suppressed_total", &t.standbySuppressed)
+	w.family("ptp4u_subscriptions", "gauge", "Running subscriptions")
+	w.messageTypes("ptp4u_subscriptions", &r.subscriptions)
+	w.family("ptp4u_fps_demand", "gauge", "Packets per second the subscriptions ask for")
+	w.messageTypes("ptp4u_fps_demand", &r.fpsDemand)
+	w.family("ptp4u_fps_stretch_ratio", "gauge", "Ratio the subscription intervals are stretched by to fit the FPS caps")
+	for _, t := range sortedInts(&r.fpsStretch) {
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		w.sample("ptp4u_fps_stretch_ratio", float64(r.fpsStretch.load(t))/100, "message_type", mt)
+	}
+
+	w.family("ptp4u_worker_queue", "gauge", "Maximum send worker queue length over the metric interval")
+	w.workers("ptp4u_worker_queue", &r.workerQueue, 1)
+	w.family("ptp4u_worker_subscriptions", "gauge", "Subscriptions served by the send worker")
+	w.workers("ptp4u_worker_subscriptions", &r.workerSubs, 1)
+	w.family("ptp4u_worker_assignments_total", "counter", "Clients assigned to the send worker")
+	w.workers("ptp4u_worker_assignments_total", &t.workerAssignments, 1)
+	w.family("ptp4u_worker_txts_attempts", "gauge", "Maximum attempts to read a TX timestamp over the metric interval")
+	w.workers("ptp4u_worker_txts_attempts", &r.txtsattempts, 1)
+	w.family("ptp4u_worker_cpu_seconds_total", "counter", "CPU time of the send worker thread")
+	w.workers("ptp4u_worker_cpu_seconds_total", &t.workerCPU, 1/float64(time.Second))
+	w.family("ptp4u_worker_phase_seconds_total", "counter", "Time the send worker spent in a pipeline phase")
+	w.workers("ptp4u_worker_phase_seconds_total", &t.workerSerialize, 1/float64(time.Second), "phase", "serialization")
+	w.workers("ptp4u_worker_phase_seconds_total", &t.workerTXTS, 1/float64(time.Second), "phase", "txts")
+	w.workers("ptp4u_worker_phase_seconds_total", &t.workerSocket, 1/float64(time.Second), "phase", "socket")
+	w.family("ptp4u_worker_shadow_divergence_seconds", "gauge", "Maximum divergence of the active scheduler from the shadow one over the metric interval")
+	w.workers("ptp4u_worker_shadow_divergence_seconds", &r.shadowDivergence, 1/float64(time.Second))
+	w.family("ptp4u_worker_overruns_total", "counter", "Periodic sends serviced after their interval was over")
+	w.workers("ptp4u_worker_overruns_total", &t.workerOverruns, 1)
+	w.family("ptp4u_worker_lateness_seconds", "gauge", "Maximum time from the scheduled send to the worker servicing it over the metric interval")
+	w.workers("ptp4u_worker_lateness_seconds", &r.workerLateness, 1/float64(time.Second))
+
+	w.family("ptp4u_feature_enabled", "gauge", "Feature flag state")
+	for _, f := range sortedInts(&r.features) {
+		w.sample("ptp4u_feature_enabled", float64(r.features.load(f)), "feature", Feature(f).String())
+	}
+	w.family("ptp4u_tenant_subscriptions", "gauge", "Running subscriptions of the tenant")
+	w.names("ptp4u_tenant_subscriptions", &r.tenantSubs, "tenant", 1)
+	w.family("ptp4u_tenant_quota_rejects_total", "counter", "Subscriptions rejected over the tenant quota")
+	w.names("ptp4u_tenant_quota_rejects_total", &t.tenantRejects, "tenant", 1)
+	w.family("ptp4u_auth_failures_total", "counter", "Received messages which failed authentication")
+	w.names("ptp4u_auth_failures_total", &t.authFailures, "reason", 1)
+	w.family("ptp4u_compat_total", "counter", "Times the compatibility mode changed how a client was served")
+	w.names("ptp4u_compat_total", &t.compat, "mode", 1)
+	w.family("ptp4u_followup_total", "counter", "Sync TX timestamps by the Follow_Up delay budget outcome")
+	w.names("ptp4u_followup_total", &t.followUpOutcomes, "outcome", 1)
+	w.family("ptp4u_socket_rcvbuf_bytes", "gauge", "Receive buffer size of the server socket")
+	w.names("ptp4u_socket_rcvbuf_bytes", &r.socketRcvBuf, "socket", 1)
+	w.family("ptp4u_socket_drops_total", "counter", "Packets dropped by the kernel on the server socket")
+	w.names("ptp4u_socket_drops_total", &t.socketDrops, "socket", 1)
+	w.family("ptp4u_timestamping_info", "gauge", "Timestamping mode, PHC device and NIC of the server")
+	if ts := r.timestamping.load(); ts.Mode != "" {
+		w.sample("ptp4u_timestamping_info", 1, "mode", ts.Mode, "phc_index", strconv.Itoa(ts.PHCIndex), "driver", ts.Driver, "firmware", ts.Firmware)
+	}
+	w.family("ptp4u_path_delay_seconds", "gauge", "Percentile of the client to server delay of the client prefix over the metric interval")
+	for _, k := range sortedStrings(&r.pathDelay) {
+		prefix, percentile := k, ""
+		if i := strings.LastIndex(k, ".p"); i >= 0 {
+			prefix, percentile = k[:i], k[i+2:]
+		}
+		p, _ := strconv.Atoi(percentile)
+		w.sample("ptp4u_path_delay_seconds", float64(r.pathDelay.load(k))/float64(time.Second), "prefix", prefix, "quantile", formatFloat(float64(p)/100))
+	}
+	for _, m := range []struct{ measure, name, help string }{
+		{"sends", "ptp4u_canary_sends", "Syncs sent by the canary subscription over the metric interval"},
+		{"txts_failures", "ptp4u_canary_txts_failures", "Syncs of the canary subscription without a TX timestamp over the metric interval"},
+		{"txts_latency_max_ns", "ptp4u_canary_txts_latency_max_seconds", "Longest TX timestamp retrieval of the canary subscription over the metric interval"},
+		{"cadence_error_max_ns", "ptp4u_canary_cadence_error_max_seconds", "Largest deviation of the canary Sync interval over the metric interval"},
+		{"alarm", "ptp4u_canary_alarm", "Whether the canary subscription exceeded the latency budgets over the metric interval"},
+	} {
+		w.family(m.name, "gauge", m.help)
+		for _, k := range sortedStrings(&r.canary) {
+			i := strings.LastIndex(k, ".")
+			if i < 0 || k[i+1:] != m.measure {
+				continue
+			}
+			v := float64(r.canary.load(k))
+			if strings.HasSuffix(m.measure, "_ns") {
+				v /= float64(time.Second)
+			}
+			w.sample(m.name, v, "target", k[:i])
+		}
+	}
+
+	w.family("ptp4u_time_to_first_sync_seconds", "histogram", "Time from the first signaling request of a client to its first Sync and Follow Up")
+	var total int64
+	for i, b := range TimeToFirstSyncBuckets {
+		total += t.timeToFirstSync.load(i)
+		w.sample("ptp4u_time_to_first_sync_seconds_bucket", float64(total), "le", formatFloat(b.Seconds()))
+	}
+	total += t.timeToFirstSync.load(len(TimeToFirstSyncBuckets))
+	w.sample("ptp4u_time_to_first_sync_seconds_bucket", float64(total), "le", "+Inf")
+	w.sample("ptp4u_time_to_first_sync_seconds_sum", float64(t.timeToFirstSyncNs)/float64(time.Second))
+	w.sample("ptp4u_time_to_first_sync_seconds_count", float64(total))
+
+	w.summary("ptp4u_txts_latency_seconds", "Time to read the TX timestamp of a Sync", &r.txtsLatency, &t.txtsLatency)
+	w.summary("ptp4u_sync_fanout_seconds", "Time from dequeuing the first Sync of a burst until the worker queue is drained", &r.syncFanout, &t.syncFanout)
+	w.summary("ptp4u_kernel_tx_latency_seconds", "Time from sending an event message until the kernel reported its TX timestamp", &r.kernelTXLatency, &t.kernelTXLatency)
+
+	w.family("ptp4u_config_reloads_total", "counter", "Metric intervals with a dynamic config reload")
+	w.sample("ptp4u_config_reloads_total", float64(t.reload))
+	w.family("ptp4u_config_rollbacks_total", "counter", "Rollbacks to the previous dynamic config")
+	w.sample("ptp4u_config_rollbacks_total", float64(t.configRollback))
+
+	gauges := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"ptp4u_utcoffset_seconds", "Announced UTC offset", float64(r.utcoffsetSec)},
+		{"ptp4u_clock_accuracy", "Announced clock accuracy", float64(r.clockaccuracy)},
+		{"ptp4u_clock_class", "Announced clock class", float64(r.clockclass)},
+		{"ptp4u_clock_class_raw", "Clock class before debouncing", float64(r.clockclassRaw)},
+		{"ptp4u_drain", "Drain status", float64(r.drain)},
+		{"ptp4u_drained", "Graceful drain status", float64(r.drained)},
+		{"ptp4u_degraded", "Peer drift degradation status", float64(r.degraded)},
+		{"ptp4u_ntp_offset_seconds", "Offset of the served time from NTP", float64(r.ntpOffset) / float64(time.Second)},
+		{"ptp4u_ntp_alarm", "NTP cross-check alarm", float64(r.ntpAlarm)},
+		{"ptp4u_upstream_offset_seconds", "Offset from the upstream master in boundary mode", float64(r.upstreamOffset) / float64(time.Second)},
+		{"ptp4u_upstream_mean_path_delay_seconds", "Mean path delay to the upstream master in boundary mode", float64(r.upstreamDelay) / float64(time.Second)},
+		{"ptp4u_upstream_servo_state", "Servo state of the sync to the upstream master, 0 init, 1 jump, 2 locked", float64(r.upstreamServo)},
+		{"ptp4u_utcoffset_alarm", "UTC offset consistency alarm", float64(r.utcOffsetAlarm)},
+		{"ptp4u_leap_pending", "Upcoming leap second, 1 inserted, -1 deleted", float64(r.leapPending)},
+		{"ptp4u_leap_smear_seconds", "Offset of the served time from TAI while a leap second is smeared", float64(r.leapSmear) / float64(time.Second)},
+		{"ptp4u_config_generation", "Generation of the applied dynamic config", float64(r.configGeneration)},
+		{"ptp4u_shutdown_pending", "Subscriptions left to cancel on shutdown", float64(r.shutdownPending)},
+		{"ptp4u_shutdown_cancelled", "Subscriptions cancelled on shutdown", float64(r.shutdownCancelled)},
+		{"ptp4u_standby", "Standby mode status", float64(r.standby)},
+		{"ptp4u_blocklist_entries", "Blocked client prefixes", float64(r.blocklistEntries)},
+		{"ptp4u_gc_max_pause_seconds", "Upper bound of the longest GC pause over the metric interval", float64(r.gcMaxPauseNs) / float64(time.Second)},
+	}
+	for _, g := range gauges {
+		w.family(g.name, "gauge", g.help)
+		w.sample(g.name, g.value)
+	}
+	return w
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedInts(m *syncMapInt64) []int {
+	keys := m.keys()
+	sort.Ints(keys)
+	return keys
+}
+
+func sortedStrings(m *syncMapStringInt64) []string {
+	keys := m.keys()
+	sort.Strings(keys)
+	return keys
+}
+
+// promSample is a single rendered sample
+type promSample struct {
+	name   string
+	labels []string
+	value  float64
+	// counter is set for monotonic samples: counters, histogram buckets and sums and counts of summaries
+	counter bool
+}
+
+// promWriter renders metric families in the Prometheus text exposition format
+// and keeps the samples for the push based backends
+type promWriter struct {
+	strings.Builder
+	samples  []promSample
+	families []MetricMetadata
+	// name and type of the current family
+	name string
+	typ  string
+}
+
+// family starts a metric family
+func (w *promWriter) family(name, typ, help string) {
+	w.name, w.typ = name, typ
+	w.families = append(w.families, MetricMetadata{Name: name, Type: typ, Unit: unitOf(name), Help: help})
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample with the label name and value pairs
+func (w *promWriter) sample(name string, value float64, labels ...string) {
+	counter := w.typ == "counter" || w.typ == "histogram" || (w.typ == "summary" && name != w.name)
+	w.samples = append(w.samples, promSample{name: name, labels: labels, value: value, counter: counter})
+	w.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			w.WriteByte('{')
+		} else {
+			w.WriteByte(',')
+		}
+		fmt.Fprintf(w, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	if len(labels) > 1 {
+		w.WriteByte('}')
+	}
+	fmt.Fprintf(w, " %s\n", formatFloat(value))
+}
+
+// summary writes the percentiles of the last interval and max as a summary, with the count and sum of all intervals
+func (w *promWriter) summary(name, help string, last, total *syncHistogram) {
+	w.family(name, "summary", help)
+	for _, p := range HistogramPercentiles {
+		w.sample(name, float64(last.percentile(p))/float64(time.Second), "quantile", formatFloat(float64(p)/100))
+	}
+	w.sample(name+"_sum", float64(total.sum)/float64(time.Second))
+	w.sample(name+"_count", float64(total.count))
+	w.family(name+"_max", "gauge", help+", maximum over the metric interval")
+	w.sample(name+"_max", float64(last.max)/float64(time.Second))
+}
+
+// messageTypes writes a sample per message type
+func (w *promWriter) messageTypes(name string, m *syncMapInt64, labels ...string) {
+	for _, t := range sortedInts(m) {
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		w.sample(name, float64(m.load(t)), append([]string{"message_type", mt}, labels...)...)
+	}
+}
+
+// workers writes a sample per worker scaled by scale
+func (w *promWriter) workers(name string, m *syncMapInt64, scale float64, labels ...string) {
+	for _, id := range sortedInts(m) {
+		w.sample(name, float64(m.load(id))*scale, append([]string{"worker_id", strconv.Itoa(id)}, labels...)...)
+	}
+}
+
+// names writes a sample per key with the key as the label scaled by scale
+func (w *promWriter) names(name string, m *syncMapStringInt64, label string, scale float64) {
+	for _, k := range sortedStrings(m) {
+		w.sample(name, float64(m.load(k))*scale, label, k)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusStatsCounters(t *testing.T) {
+	stats := NewPrometheusStats()
+
+	// counters keep growing across intervals, gauges report the last one
+	for i := 0; i < 2; i++ {
+		stats.IncTX(ptp.MessageSync)
+		stats.IncSubscription(ptp.MessageSync)
+		stats.IncRXSignalingGrant(ptp.MessageAnnounce)
+		stats.IncWorkerAssignment(3)
+		stats.SetMaxWorkerQueue(3, 10)
+		stats.AddWorkerPhaseTime(3, PhaseSocketIO, int64(500*time.Millisecond))
+		stats.SetUTCOffsetSec(37)
+		stats.IncRXECNCE()
+		stats.IncRXBlocked()
+		stats.SetBlocklistEntries(1)
+		stats.SetDrained(1)
+		stats.IncDeniedACL()
+		stats.IncAuthFailure("icv")
+		stats.IncFollowUpOutcome("resent")
+		stats.IncInterfaceTX("eth1", ptp.MessageSync)
+		stats.IncSubscriptionCreated()
+		stats.AddChurnAllocs(512, 4)
+		stats.SetGCStats(GCStats{Cycles: 1, PauseNs: int64(time.Millisecond), MaxPauseNs: int64(time.Millisecond)})
+		stats.AddWorkerOverruns(3, 2)
+		stats.SetLeapPending(1)
+		stats.SetTimestampingInfo(TimestampingInfo{Mode: TimestampingHardware, PHCIndex: 0, Driver: "ice", Firmware: "4.40 0x8001c967"})
+		stats.Snapshot()
+		stats.Reset()
+	}
+
+	e := stats.exposition()
+	require.Contains(t, e, "# TYPE ptp4u_tx_messages_total counter\nptp4u_tx_messages_total{message_type=\"sync\"} 2\n")
+	require.Contains(t, e, "# TYPE ptp4u_subscriptions gauge\nptp4u_subscriptions{message_type=\"sync\"} 1\n")
+	require.Contains(t, e, "ptp4u_rx_signaling_total{message_type=\"announce\",action=\"grant\"} 2\n")
+	require.Contains(t, e, "ptp4u_worker_assignments_total{worker_id=\"3\"} 2\n")
+	require.Contains(t, e, "ptp4u_worker_queue{worker_id=\"3\"} 10\n")
+	require.Contains(t, e, "ptp4u_worker_phase_seconds_total{worker_id=\"3\",phase=\"socket\"} 1\n")
+	require.Contains(t, e, "ptp4u_utcoffset_seconds 37\n")
+	require.Contains(t, e, "ptp4u_rx_ecn_ce_total 2\n")
+	require.Contains(t, e, "ptp4u_rx_blocked_total 2\n")
+	require.Contains(t, e, "ptp4u_blocklist_entries 1\n")
+	require.Contains(t, e, "ptp4u_drained 1\n")
+	require.Contains(t, e, "ptp4u_worker_overruns_total{worker_id=\"3\"} 4\n")
+	require.Contains(t, e, "ptp4u_denied_total{reason=\"acl\"} 2\nptp4u_denied_total{reason=\"ratelimit\"} 0\nptp4u_denied_total{reason=\"clientlimit\"} 0\n")
+	require.Contains(t, e, "ptp4u_subscription_churn_total{event=\"created\"} 2\nptp4u_subscription_churn_total{event=\"expired\"} 0\n")
+	require.Contains(t, e, "ptp4u_churn_alloc_bytes_total 1024\n")
+	require.Contains(t, e, "ptp4u_gc_cycles_total 2\n")
+	require.Contains(t, e, "ptp4u_gc_pause_seconds_total 0.002\n")
+	require.Contains(t, e, "ptp4u_gc_max_pause_seconds 0.001\n")
+	require.Contains(t, e, "ptp4u_leap_pending 1\n")
+	require.Contains(t, e, "ptp4u_auth_failures_total{reason=\"icv\"} 2\n")
+	require.Contains(t, e, "ptp4u_followup_total{outcome=\"resent\"} 2\n")
+	require.Contains(t, e, "ptp4u_interface_tx_messages_total{message_type=\"sync\",interface=\"eth1\"} 2\n")
+	require.Contains(t, e, "ptp4u_timestamping_info{mode=\"hardware\",phc_index=\"0\",driver=\"ice\",firmware=\"4.40 0x8001c967\"} 1\n")
+}
+
+func TestPrometheusStatsLabels(t *testing.T) {
+	stats := NewPrometheusStats()
+
+	stats.SetTenantSubscriptions("a\"b", 4)
+	stats.SetPathDelay("10.0.0.0/24", 99, 25*time.Microsecond)
+	stats.SetFeature(FeatureShadowScheduler, 1)
+	stats.SetFPSStretch(ptp.MessageAnnounce, 250)
+	stats.IncRXDomain(24)
+	stats.SetWorkerSizing(WorkerSizing{CPUs: 32, SendWorkers: 50})
+	stats.SetCanary("2001:db8::1", CanaryStats{Sends: 60, MaxTXTSLatency: 20 * time.Microsecond, Alarm: true})
+	stats.Snapshot()
+
+	e := stats.exposition()
+	require.Contains(t, e, "ptp4u_fps_stretch_ratio{message_type=\"announce\"} 2.5\n")
+	require.Contains(t, e, "ptp4u_rx_domain_messages_total{domain=\"24\"} 1\n")
+	require.Contains(t, e, "ptp4u_worker_sizing{input=\"cpus\"} 32\n")
+	require.Contains(t, e, "ptp4u_worker_sizing{input=\"send\"} 50\n")
+	require.Contains(t, e, "ptp4u_canary_sends{target=\"2001:db8::1\"} 60\n")
+	require.Contains(t, e, "ptp4u_canary_txts_latency_max_seconds{target=\"2001:db8::1\"} 2e-05\n")
+	require.Contains(t, e, "ptp4u_canary_alarm{target=\"2001:db8::1\"} 1\n")
+	require.Contains(t, e, "ptp4u_tenant_subscriptions{tenant=\"a\\\"b\"} 4\n")
+	require.Contains(t, e, "ptp4u_path_delay_seconds{prefix=\"10.0.0.0/24\",quantile=\"0.99\"} 2.5e-05\n")
+	require.Contains(t, e, "ptp4u_feature_enabled{feature=\"shadowscheduler\"} 1\n")
+}
+
+func TestPrometheusStatsHistogram(t *testing.T) {
+	stats := NewPrometheusStats()
+
+	stats.ObserveTimeToFirstSync(50 * time.Millisecond)
+	stats.ObserveTimeToFirstSync(time.Second)
+	stats.ObserveTimeToFirstSync(time.Hour)
+	stats.Snapshot()
+
+	e := stats.exposition()
+	require.Contains(t, e, "# TYPE ptp4u_time_to_first_sync_seconds histogram\n")
+	require.Contains(t, e, "ptp4u_time_to_first_sync_seconds_bucket{le=\"0.1\"} 1\n")
+	require.Contains(t, e, "ptp4u_time_to_first_sync_seconds_bucket{le=\"1\"} 2\n")
+	require.Contains(t, e, "ptp4u_time_to_first_sync_seconds_bucket{le=\"+Inf\"} 3\n")
+	require.Contains(t, e, "ptp4u_time_to_first_sync_seconds_sum 3601.05\n")
+	require.Contains(t, e, "ptp4u_time_to_first_sync_seconds_count 3\n")
+}
+
+func TestPrometheusStatsSummary(t *testing.T) {
+	stats := NewPrometheusStats()
+
+	for i := 0; i < 2; i++ {
+		stats.ObserveTXTSLatency(time.Duration(i+1) * time.Millisecond)
+		stats.Snapshot()
+		stats.Reset()
+	}
+
+	e := stats.exposition()
+	require.Contains(t, e, "# TYPE ptp4u_txts_latency_seconds summary\nptp4u_txts_latency_seconds{quantile=\"0.5\"} 0.002\n")
+	require.Contains(t, e, "ptp4u_txts_latency_seconds_sum 0.003\n")
+	require.Contains(t, e, "ptp4u_txts_latency_seconds_count 2\n")
+	require.Contains(t, e, "ptp4u_txts_latency_seconds_max 0.002\n")
+}
+
+func TestNewStats(t *testing.T) {
+	s, err := NewStats(BackendJSON, StatsDConfig{}, ReportIntervals{})
+	require.NoError(t, err)
+	require.IsType(t, &JSONStats{}, s)
+
+	s, err = NewStats(BackendPrometheus, StatsDConfig{}, ReportIntervals{})
+	require.NoError(t, err)
+	require.IsType(t, &PrometheusStats{}, s)
+
+	_, err = NewStats("graphite", StatsDConfig{}, ReportIntervals{})
+	require.Error(t, err)
+
+	_, err = NewStats(BackendJSON, StatsDConfig{}, ReportIntervals{JSON: -time.Second})
+	require.Error(t, err)
+}
+
+func TestNewStatsReportIntervals(t *testing.T) {
+	intervals := ReportIntervals{JSON: 10 * time.Second, Prometheus: time.Minute}
+	s, err := NewStats(BackendJSON, StatsDConfig{}, intervals)
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, s.Schedule(func() {}))
+
+	s, err = NewStats(BackendPrometheus, StatsDConfig{}, intervals)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, s.Schedule(func() {}))
+
+	s, err = NewStats(BackendStatsD, StatsDConfig{Addr: "localhost:8125", FlushInterval: time.Minute}, intervals)
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, s.Schedule(func() {}))
+
+	s, err = NewStats(BackendJSON, StatsDConfig{}, ReportIntervals{})
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), s.Schedule(func() {}))
+}
+
+func TestPrometheusSnapshotOnScrape(t *testing.T) {
+	epochs := 0
+	s := NewPrometheusStats()
+	s.Schedule(func() {
+		epochs++
+		s.IncRX(ptp.MessageSync)
+		s.Snapshot()
+		s.Reset()
+	})
+	// periodic snapshots only
+	s.handleRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, 0, epochs)
+
+	s.onScrape = true
+	w := httptest.NewRecorder()
+	s.handleRequest(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, 1, epochs)
+	require.Contains(t, w.Body.String(), "ptp4u_rx_messages_total{message_type=\"sync\"} 1\n")
+
+	w = httptest.NewRecorder()
+	s.handleRequest(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, 2, epochs)
+	require.Contains(t, w.Body.String(), "ptp4u_rx_messages_total{message_type=\"sync\"} 2\n")
+}
+
+func TestPrometheusExport(t *testing.T) {
+	stats := NewPrometheusStats()
+	port, err := getFreePort()
+	require.Nil(t, err, "Failed to allocate port")
+	go stats.Start(port)
+	time.Sleep(time.Second)
+
+	stats.IncRX(ptp.MessageDelayReq)
+	stats.Snapshot()
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/metrics", port))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "ptp4u_rx_messages_total{message_type=\"delay_req\"} 1\n")
+}
@@ -23,24 +23,191 @@ package stats
 
 import (
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	ptp "github.com/facebook/time/ptp/protocol"
 )
 
+// WorkerPhase is a stage of the send worker pipeline
+type WorkerPhase int
+
+// Send worker pipeline stages we account time for
+const (
+	PhaseSerialization WorkerPhase = iota
+	PhaseTXTimestamp
+	PhaseSocketIO
+)
+
+// Feature is a runtime feature flag gating a risky behavior
+type Feature int
+
+// Feature flags which can be toggled via dynamic config
+const (
+	FeatureShadowScheduler Feature = iota
+	FeatureTimeSequence
+)
+
+// Features is a list of all feature flags
+var Features = []Feature{FeatureShadowScheduler, FeatureTimeSequence}
+
+var featureToString = map[Feature]string{
+	FeatureShadowScheduler: "shadowscheduler",
+	FeatureTimeSequence:    "timesequence",
+}
+
+func (f Feature) String() string {
+	return featureToString[f]
+}
+
+// Timestamping modes reported in TimestampingInfo
+const (
+	TimestampingHardware = "hardware"
+	TimestampingSoftware = "software"
+)
+
+// TimestampingInfo describes how the server timestamps packets and on which NIC
+type TimestampingInfo struct {
+	// Mode is one of hardware or software
+	Mode string
+	// PHCIndex is the index of the /dev/ptp device, -1 if there is none
+	PHCIndex int
+	// Driver and Firmware of the NIC as reported by ethtool, empty if unknown
+	Driver   string
+	Firmware string
+}
+
+// CanaryStats is the end-to-end behavior of a canary subscription over the metric interval
+type CanaryStats struct {
+	// Sends is the number of Syncs sent
+	Sends int64
+	// TXTSFailures is the number of Syncs without a TX timestamp
+	TXTSFailures int64
+	// MaxTXTSLatency is the longest time it took to read a TX timestamp
+	MaxTXTSLatency time.Duration
+	// MaxCadenceError is the largest deviation of the time between Syncs from the interval
+	MaxCadenceError time.Duration
+	// Alarm is set when the behavior exceeded the budgets
+	Alarm bool
+}
+
+// GCStats is the garbage collector activity over the metric interval
+type GCStats struct {
+	// Cycles is the number of completed GC cycles
+	Cycles int64
+	// PauseNs is the estimated total stop-the-world pause time
+	PauseNs int64
+	// MaxPauseNs is the upper bound of the longest pause
+	MaxPauseNs int64
+	// HeapAllocBytes is the amount of memory allocated on the heap
+	HeapAllocBytes int64
+}
+
+// WorkerSizing is how the worker pool was sized and what it was sized for
+type WorkerSizing struct {
+	// CPUs usable by the workers, local to the NIC when its NUMA node is known
+	CPUs int64
+	// RXQueues and TXQueues of the NIC, 0 if unknown
+	RXQueues int64
+	TXQueues int64
+	// Subscriptions the pool is sized for
+	Subscriptions int64
+	// SendWorkers and RecvWorkers running
+	SendWorkers int64
+	RecvWorkers int64
+	// RecommendedSendWorkers for the current subscription load. Resizing takes a restart
+	RecommendedSendWorkers int64
+	// Auto is set when the workers were sized automatically instead of configured
+	Auto bool
+}
+
+// syncTimestampingInfo is TimestampingInfo which can be updated concurrently
+type syncTimestampingInfo struct {
+	sync.Mutex
+	info TimestampingInfo
+}
+
+func (s *syncTimestampingInfo) load() TimestampingInfo {
+	s.Lock()
+	defer s.Unlock()
+	return s.info
+}
+
+func (s *syncTimestampingInfo) store(info TimestampingInfo) {
+	s.Lock()
+	s.info = info
+	s.Unlock()
+}
+
+// TimeToFirstSyncBuckets are the upper bounds of the time to first sync histogram buckets
+var TimeToFirstSyncBuckets = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// timeToFirstSyncBucket returns the index of the histogram bucket for d.
+// Index past the last bucket is the overflow bucket
+func timeToFirstSyncBucket(d time.Duration) int {
+	for i, b := range TimeToFirstSyncBuckets {
+		if d <= b {
+			return i
+		}
+	}
+	return len(TimeToFirstSyncBuckets)
+}
+
+// ReportIntervals are the snapshot intervals of the monitoring backends.
+// Zero keeps the metric interval of the server
+type ReportIntervals struct {
+	// JSON is the interval of the stats served on / by the json and statsd backends
+	JSON time.Duration
+	// Prometheus is the snapshot interval of the prometheus backend
+	Prometheus time.Duration
+	// PrometheusOnScrape takes a fresh snapshot on every scrape of /metrics on top of the periodic ones
+	PrometheusOnScrape bool
+}
+
 // Stats is a metric collection interface
 type Stats interface {
 	// Start starts a stat reporter
 	// Use this for passive reporters
 	Start(monitoringport int)
 
+	// Schedule hands over the epoch which collects the stats, snapshots and resets them,
+	// and returns how often the backend wants it run, zero for the metric interval of the server.
+	// Backends reporting on demand run the epoch themselves as well
+	Schedule(epoch func()) time.Duration
+
+	// Handle registers an extra handler served on the monitoring port
+	Handle(pattern string, handler http.Handler)
+
 	// Snapshot the values so they can be reported atomically
 	Snapshot()
 
+	// Live returns the values collected so far in the current epoch
+	Live() map[string]int64
+
+	// Report returns the values of the last snapshot
+	Report() map[string]int64
+
 	// Reset atomically sets all the counters to 0
 	Reset()
 
+	// Shard returns the stats a worker updates without contending with the others.
+	// Its updates are summed on Snapshot of the stats it comes from
+	Shard() Stats
+
 	// IncSubscription atomically add 1 to the counter
 	IncSubscription(t ptp.MessageType)
 
@@ -56,6 +223,9 @@ type Stats interface {
 	// IncRXSignalingCancel atomically add 1 to the counter
 	IncRXSignalingCancel(t ptp.MessageType)
 
+	// IncRXSignalingCoalesced atomically add 1 to the grant requests identical to the running subscription
+	IncRXSignalingCoalesced(t ptp.MessageType)
+
 	// IncTXSignalingGrant atomically add 1 to the counter
 	IncTXSignalingGrant(t ptp.MessageType)
 
@@ -68,6 +238,21 @@ type Stats interface {
 	// IncReload atomically add 1 to the counter
 	IncReload()
 
+	// IncConfigRollback atomically add 1 to the config rollback counter
+	IncConfigRollback()
+
+	// SetConfigGeneration atomically sets the generation of the applied dynamic config
+	SetConfigGeneration(gen int64)
+
+	// SetShutdownPending atomically sets the number of subscriptions left to cancel on shutdown
+	SetShutdownPending(pending int64)
+
+	// SetShutdownCancelled atomically sets the number of subscriptions cancelled on shutdown
+	SetShutdownCancelled(cancelled int64)
+
+	// IncWorkerAssignment atomically add 1 to the counter
+	IncWorkerAssignment(workerid int)
+
 	// DecSubscription atomically removes 1 from the counter
 	DecSubscription(t ptp.MessageType)
 
@@ -98,6 +283,21 @@ type Stats interface {
 	// SetMaxTXTSAttempts atomically sets number of retries for get latest TX timestamp
 	SetMaxTXTSAttempts(workerid int, retries int64)
 
+	// SetMaxShadowDivergence atomically sets max divergence of the active scheduler from the shadow one
+	SetMaxShadowDivergence(workerid int, ns int64)
+
+	// AddWorkerOverruns atomically adds to the periodic sends the worker serviced after their interval was over
+	AddWorkerOverruns(workerid int, overruns int64)
+
+	// SetMaxWorkerLateness atomically sets max time from the scheduled send to the worker servicing it
+	SetMaxWorkerLateness(workerid int, ns int64)
+
+	// SetWorkerCPUTime atomically sets CPU time consumed by the worker thread since last reset
+	SetWorkerCPUTime(workerid int, ns int64)
+
+	// AddWorkerPhaseTime atomically adds time spent by the worker in a pipeline phase
+	AddWorkerPhaseTime(workerid int, phase WorkerPhase, ns int64)
+
 	// SetUTCOffsetSec atomically sets the utcoffset
 	SetUTCOffsetSec(utcoffsetSec int64)
 
@@ -106,25 +306,284 @@ type Stats interface {
 
 	// SetClockClass atomically sets the clock class
 	SetClockClass(clockclass int64)
+	// SetClockClassRaw atomically sets the clock class before debouncing
+	SetClockClassRaw(clockclass int64)
 
 	// SetDrain atomically sets the drain status
 	SetDrain(drain int64)
+
+	// SetTimestampingInfo atomically sets the timestamping mode and NIC description
+	SetTimestampingInfo(info TimestampingInfo)
+
+	// SetDrained atomically sets the status of the graceful drain, during which no subscriptions are granted
+	SetDrained(drained int64)
+
+	// SetDegraded atomically sets the peer drift degradation status
+	SetDegraded(degraded int64)
+
+	// SetNTPOffset atomically sets the offset of the served time from NTP
+	SetNTPOffset(offset int64)
+
+	// SetNTPAlarm atomically sets the NTP cross-check alarm
+	SetNTPAlarm(alarm int64)
+
+	// SetUpstreamOffset atomically sets the offset from the upstream master in boundary mode
+	SetUpstreamOffset(offset int64)
+	// SetUpstreamPathDelay atomically sets the mean path delay to the upstream master in boundary mode
+	SetUpstreamPathDelay(delay int64)
+	// SetUpstreamServoState atomically sets the servo state of the sync to the upstream master in boundary mode
+	SetUpstreamServoState(state int64)
+	// SetUTCOffsetAlarm atomically sets the UTC offset consistency alarm
+	SetUTCOffsetAlarm(alarm int64)
+	// SetLeapPending atomically sets the upcoming leap second: 1 inserted, -1 deleted, 0 none
+	SetLeapPending(leap int64)
+	// SetLeapSmear atomically sets the offset of the served time from TAI while a leap second is smeared
+	SetLeapSmear(ns int64)
+
+	// SetFeature atomically sets the feature flag state
+	SetFeature(f Feature, enabled int64)
+
+	// SetTenantSubscriptions atomically sets the number of running subscriptions of the tenant
+	SetTenantSubscriptions(tenant string, count int64)
+
+	// IncTenantQuotaReject atomically add 1 to the subscriptions rejected over the tenant quota
+	IncTenantQuotaReject(tenant string)
+
+	// IncRXDomain atomically add 1 to the messages received on the PTP domain
+	IncRXDomain(domain uint8)
+
+	// IncTXOversize atomically add 1 to the messages not sent because they exceed the path MTU
+	IncTXOversize(t ptp.MessageType)
+
+	// IncTXSignalingSplit atomically add 1 to the signaling messages split to fit into the path MTU
+	IncTXSignalingSplit()
+
+	// IncRXECNCE atomically add 1 to the event messages received with the ECN Congestion Experienced mark
+	IncRXECNCE()
+
+	// IncRXBlocked atomically add 1 to the messages dropped because the client is blocked
+	IncRXBlocked()
+
+	// SetBlocklistEntries atomically sets the number of blocklist entries
+	SetBlocklistEntries(entries int64)
+
+	// IncDeniedACL atomically add 1 to the grant requests denied by the ACL
+	IncDeniedACL()
+
+	// IncDeniedRateLimit atomically add 1 to the grant requests denied over the per client request rate
+	IncDeniedRateLimit()
+	// IncDeniedClientLimit atomically add 1 to the grant requests denied over the per client subscription limit
+	IncDeniedClientLimit()
+
+	// IncDeniedPolicy atomically add 1 to the grant requests denied by the policy
+	IncDeniedPolicy()
+
+	// IncGrantHintHonored atomically add 1 to the grants extended by the client grant hint
+	IncGrantHintHonored()
+
+	// IncAuthFailure atomically add 1 to the received messages which failed authentication for the reason
+	IncAuthFailure(reason string)
+
+	// IncCompat atomically add 1 to the times the compatibility mode changed how a client was served
+	IncCompat(mode string)
+
+	// IncFollowUpOutcome atomically add 1 to the Sync TX timestamps with the Follow_Up budget outcome
+	IncFollowUpOutcome(outcome string)
+
+	// IncInterfaceRX atomically add 1 to the messages of the type received on the interface
+	IncInterfaceRX(iface string, t ptp.MessageType)
+
+	// IncInterfaceTX atomically add 1 to the messages of the type sent from the interface
+	IncInterfaceTX(iface string, t ptp.MessageType)
+
+	// IncSubscriptionCreated atomically add 1 to the subscriptions created
+	IncSubscriptionCreated()
+
+	// IncSubscriptionExpired atomically add 1 to the finished subscriptions cleaned up
+	IncSubscriptionExpired()
+
+	// AddChurnAllocs atomically adds the heap allocations attributed to subscription creation
+	AddChurnAllocs(bytes, objects int64)
+
+	// SetGCStats sets the garbage collector activity over the metric interval
+	SetGCStats(gc GCStats)
+
+	// SetWorkerSizing sets how the worker pool was sized
+	SetWorkerSizing(ws WorkerSizing)
+
+	// SetClientsLimit sets the maximum number of clients with own counters. 0 disables per client counters
+	SetClientsLimit(limit int)
+
+	// SetHistorySize sets the number of snapshots kept for /history and /delta. 0 disables the history
+	SetHistorySize(size int)
+
+	// IncClientSubscription atomically add 1 to the subscriptions granted to the client
+	IncClientSubscription(client string)
+
+	// IncClientDenied atomically add 1 to the subscriptions denied to the client
+	IncClientDenied(client string)
+
+	// IncClientRXSignaling atomically add 1 to the signaling messages received from the client
+	IncClientRXSignaling(client string)
+
+	// IncClientTX atomically add 1 to the messages of the type sent to the client
+	IncClientTX(client string, t ptp.MessageType)
+
+	// SetStandby atomically sets the standby mode status
+	SetStandby(standby int64)
+
+	// IncStandbySuppressed atomically add 1 to the messages not sent because of the standby mode
+	IncStandbySuppressed(t ptp.MessageType)
+
+	// SetSocketRcvBuf atomically sets the receive buffer size of the socket
+	SetSocketRcvBuf(socket string, bytes int64)
+
+	// AddSocketDrops atomically adds packets dropped by the kernel on the socket
+	AddSocketDrops(socket string, drops int64)
+
+	// ObserveTimeToFirstSync atomically adds the time it took a client to get the first Sync and Follow Up to the histogram
+	ObserveTimeToFirstSync(d time.Duration)
+
+	// SetPathDelay atomically sets the percentile of the client to server delay of the prefix
+	SetPathDelay(prefix string, percentile int, delay time.Duration)
+
+	// SetCanary atomically sets the behavior of the canary subscription to the target
+	SetCanary(target string, c CanaryStats)
+
+	// SetFPSDemand atomically sets the packets per second the subscriptions of the message type ask for
+	SetFPSDemand(t ptp.MessageType, pps int64)
+
+	// SetFPSStretch atomically sets the percentage the intervals of the message type are stretched to in order to fit the FPS caps
+	SetFPSStretch(t ptp.MessageType, percent int64)
+
+	// ObserveTXTSLatency atomically adds the time it took to read the TX timestamp of a Sync to the histogram
+	ObserveTXTSLatency(d time.Duration)
+
+	// ObserveFanoutDuration atomically adds the time it took a worker to send a burst of Syncs to the histogram
+	ObserveFanoutDuration(d time.Duration)
+
+	// ObserveKernelTXLatency atomically adds the time from sending an event message until the kernel reported its TX timestamp to the histogram
+	ObserveKernelTXLatency(d time.Duration)
+}
+
+// syncMapStringInt64 sync map of per name counters
+type syncMapStringInt64 struct {
+	sync.Mutex
+	m map[string]int64
+}
+
+// init initializes the underlying map
+func (s *syncMapStringInt64) init() {
+	s.m = make(map[string]int64)
+}
+
+// keys returns slice of keys of the underlying map
+func (s *syncMapStringInt64) keys() []string {
+	keys := make([]string, 0, len(s.m))
+	s.Lock()
+	for k := range s.m {
+		keys = append(keys, k)
+	}
+	s.Unlock()
+	return keys
+}
+
+// load gets the value by the key
+func (s *syncMapStringInt64) load(key string) int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.m[key]
+}
+
+// inc increments the counter for the given key
+func (s *syncMapStringInt64) inc(key string) {
+	s.Lock()
+	s.m[key]++
+	s.Unlock()
 }
 
-// syncMapInt64 sync map of PTP messages
+// add adds delta to the counter for the given key
+func (s *syncMapStringInt64) add(key string, delta int64) {
+	s.Lock()
+	s.m[key] += delta
+	s.Unlock()
+}
+
+// store saves the value with the key
+func (s *syncMapStringInt64) store(key string, value int64) {
+	s.Lock()
+	s.m[key] = value
+	s.Unlock()
+}
+
+// copy all key-values between maps
+func (s *syncMapStringInt64) copy(dst *syncMapStringInt64) {
+	for _, t := range s.keys() {
+		dst.store(t, s.load(t))
+	}
+}
+
+// addTo adds all the values to the counters of dst
+func (s *syncMapStringInt64) addTo(dst *syncMapStringInt64) {
+	for _, t := range s.keys() {
+		dst.add(t, s.load(t))
+	}
+}
+
+// reset stats to 0
+func (s *syncMapStringInt64) reset() {
+	s.Lock()
+	for t := range s.m {
+		s.m[t] = 0
+	}
+	s.Unlock()
+}
+
+// denseKeys is the number of the smallest non-negative keys of syncMapInt64 kept in atomic slots.
+// It covers PTP message types and worker IDs of any realistic deployment
+const denseKeys = 256
+
+// syncMapInt64 sync map of PTP messages.
+// Keys in [0, denseKeys) are updated with atomic operations without taking the lock,
+// as they are incremented by every worker for every message sent.
+// Other keys fall back to the map protected by the mutex
 type syncMapInt64 struct {
+	// values of the dense keys
+	dense []int64
+	// non-zero if the dense key was set
+	present []uint32
 	sync.Mutex
 	m map[int]int64
 }
 
-// init initializes the underlying map
+// init initializes the underlying storage
 func (s *syncMapInt64) init() {
+	s.dense = make([]int64, denseKeys)
+	s.present = make([]uint32, denseKeys)
 	s.m = make(map[int]int64)
 }
 
-// keys returns slice of keys of the underlying map
+// isDense tells if the key is kept in the atomic slots
+func isDense(key int) bool {
+	return key >= 0 && key < denseKeys
+}
+
+// slot returns the atomic value of the dense key and marks the key present
+func (s *syncMapInt64) slot(key int) *int64 {
+	if atomic.LoadUint32(&s.present[key]) == 0 {
+		atomic.StoreUint32(&s.present[key], 1)
+	}
+	return &s.dense[key]
+}
+
+// keys returns slice of the keys set
 func (s *syncMapInt64) keys() []int {
-	keys := make([]int, 0, len(s.m))
+	var keys []int
+	for k := range s.present {
+		if atomic.LoadUint32(&s.present[k]) != 0 {
+			keys = append(keys, k)
+		}
+	}
 	s.Lock()
 	for k := range s.m {
 		keys = append(keys, k)
@@ -133,8 +592,20 @@ func (s *syncMapInt64) keys() []int {
 	return keys
 }
 
+// values returns a copy of all the key-values
+func (s *syncMapInt64) values() map[int]int64 {
+	values := make(map[int]int64)
+	for _, k := range s.keys() {
+		values[k] = s.load(k)
+	}
+	return values
+}
+
 // load gets the value by the key
 func (s *syncMapInt64) load(key int) int64 {
+	if isDense(key) {
+		return atomic.LoadInt64(&s.dense[key])
+	}
 	s.Lock()
 	defer s.Unlock()
 	return s.m[key]
@@ -142,20 +613,31 @@ func (s *syncMapInt64) load(key int) int64 {
 
 // inc increments the counter for the given key
 func (s *syncMapInt64) inc(key int) {
+	s.add(key, 1)
+}
+
+// add adds delta to the counter for the given key
+func (s *syncMapInt64) add(key int, delta int64) {
+	if isDense(key) {
+		atomic.AddInt64(s.slot(key), delta)
+		return
+	}
 	s.Lock()
-	s.m[key]++
+	s.m[key] += delta
 	s.Unlock()
 }
 
 // dec decrements the counter for the given key
 func (s *syncMapInt64) dec(key int) {
-	s.Lock()
-	s.m[key]--
-	s.Unlock()
+	s.add(key, -1)
 }
 
 // store saves the value with the key
 func (s *syncMapInt64) store(key int, value int64) {
+	if isDense(key) {
+		atomic.StoreInt64(s.slot(key), value)
+		return
+	}
 	s.Lock()
 	s.m[key] = value
 	s.Unlock()
@@ -163,13 +645,23 @@ func (s *syncMapInt64) store(key int, value int64) {
 
 // copy all key-values between maps
 func (s *syncMapInt64) copy(dst *syncMapInt64) {
-	for _, t := range s.keys() {
-		dst.store(t, s.load(t))
+	for k, v := range s.values() {
+		dst.store(k, v)
+	}
+}
+
+// addTo adds all the values to the counters of dst
+func (s *syncMapInt64) addTo(dst *syncMapInt64) {
+	for k, v := range s.values() {
+		dst.add(k, v)
 	}
 }
 
 // reset stats to 0
 func (s *syncMapInt64) reset() {
+	for k := range s.dense {
+		atomic.StoreInt64(&s.dense[k], 0)
+	}
 	s.Lock()
 	for t := range s.m {
 		s.m[t] = 0
@@ -178,10 +670,79 @@ func (s *syncMapInt64) reset() {
 	s.Unlock()
 }
 
+// syncMapIfaceInt64 keeps per message type counters of each interface
+type syncMapIfaceInt64 struct {
+	sync.RWMutex
+	m map[string]*syncMapInt64
+}
+
+// init initializes the underlying map
+func (s *syncMapIfaceInt64) init() {
+	s.m = make(map[string]*syncMapInt64)
+}
+
+// counters returns the counters of the interface, creating them on first use
+func (s *syncMapIfaceInt64) counters(iface string) *syncMapInt64 {
+	s.RLock()
+	c, ok := s.m[iface]
+	s.RUnlock()
+	if ok {
+		return c
+	}
+	s.Lock()
+	defer s.Unlock()
+	if c, ok = s.m[iface]; !ok {
+		c = &syncMapInt64{}
+		c.init()
+		s.m[iface] = c
+	}
+	return c
+}
+
+// ifaces returns sorted names of the interfaces with counters
+func (s *syncMapIfaceInt64) ifaces() []string {
+	s.RLock()
+	ifaces := make([]string, 0, len(s.m))
+	for iface := range s.m {
+		ifaces = append(ifaces, iface)
+	}
+	s.RUnlock()
+	sort.Strings(ifaces)
+	return ifaces
+}
+
+// inc increments the counter of the message type on the interface
+func (s *syncMapIfaceInt64) inc(iface string, key int) {
+	s.counters(iface).inc(key)
+}
+
+// copy all the counters between maps
+func (s *syncMapIfaceInt64) copy(dst *syncMapIfaceInt64) {
+	for _, iface := range s.ifaces() {
+		s.counters(iface).copy(dst.counters(iface))
+	}
+}
+
+// addTo adds all the counters to the ones of dst
+func (s *syncMapIfaceInt64) addTo(dst *syncMapIfaceInt64) {
+	for _, iface := range s.ifaces() {
+		s.counters(iface).addTo(dst.counters(iface))
+	}
+}
+
+// reset stats to 0, keeping the interfaces
+func (s *syncMapIfaceInt64) reset() {
+	for _, iface := range s.ifaces() {
+		s.counters(iface).reset()
+	}
+}
+
 type counters struct {
 	rx                syncMapInt64
 	rxSignalingGrant  syncMapInt64
 	rxSignalingCancel syncMapInt64
+	rxCoalesced       syncMapInt64
+	rxDomain          syncMapInt64
 	subscriptions     syncMapInt64
 	tx                syncMapInt64
 	txSignalingGrant  syncMapInt64
@@ -189,11 +750,84 @@ type counters struct {
 	txtsattempts      syncMapInt64
 	workerQueue       syncMapInt64
 	workerSubs        syncMapInt64
+	workerAssignments syncMapInt64
+	workerCPU         syncMapInt64
+	workerSerialize   syncMapInt64
+	workerTXTS        syncMapInt64
+	workerSocket      syncMapInt64
+	features          syncMapInt64
+	shadowDivergence  syncMapInt64
+	workerOverruns    syncMapInt64
+	workerLateness    syncMapInt64
+	tenantSubs        syncMapStringInt64
+	tenantRejects     syncMapStringInt64
+	authFailures      syncMapStringInt64
+	compat            syncMapStringInt64
+	followUpOutcomes  syncMapStringInt64
+	ifaceRX           syncMapIfaceInt64
+	ifaceTX           syncMapIfaceInt64
+	timeToFirstSync   syncMapInt64
+	standbySuppressed syncMapInt64
+	txOversize        syncMapInt64
+	fpsDemand         syncMapInt64
+	fpsStretch        syncMapInt64
+	socketRcvBuf      syncMapStringInt64
+	socketDrops       syncMapStringInt64
+	pathDelay         syncMapStringInt64
+	canary            syncMapStringInt64
+	clients           clientTable
+	timestamping      syncTimestampingInfo
+	txtsLatency       syncHistogram
+	syncFanout        syncHistogram
+	kernelTXLatency   syncHistogram
 	utcoffsetSec      int64
 	clockaccuracy     int64
 	clockclass        int64
+	clockclassRaw     int64
 	drain             int64
+	drained           int64
+	degraded          int64
+	ntpOffset         int64
+	ntpAlarm          int64
+	upstreamOffset    int64
+	upstreamDelay     int64
+	upstreamServo     int64
+	utcOffsetAlarm    int64
+	leapPending       int64
+	leapSmear         int64
 	reload            int64
+	configRollback    int64
+	configGeneration  int64
+	shutdownPending   int64
+	shutdownCancelled int64
+	standby           int64
+	txSignalingSplit  int64
+	rxECNCE           int64
+	rxBlocked         int64
+	blocklistEntries  int64
+	deniedACL         int64
+	deniedRateLimit   int64
+	deniedClientLimit int64
+	deniedPolicy      int64
+	grantHintHonored  int64
+	churnCreated      int64
+	churnExpired      int64
+	churnAllocBytes   int64
+	churnAllocObjects int64
+	gcCycles          int64
+	gcPauseNs         int64
+	gcMaxPauseNs      int64
+	heapAllocBytes    int64
+	sizingCPUs        int64
+	sizingRXQueues    int64
+	sizingTXQueues    int64
+	sizingSubs        int64
+	sizingSend        int64
+	sizingRecv        int64
+	sizingRecommended int64
+	sizingAuto        int64
+	// sum of the time to first sync observations, not part of the map
+	timeToFirstSyncNs int64
 }
 
 func (c *counters) init() {
@@ -202,10 +836,38 @@ func (c *counters) init() {
 	c.tx.init()
 	c.rxSignalingGrant.init()
 	c.rxSignalingCancel.init()
+	c.rxCoalesced.init()
+	c.rxDomain.init()
 	c.txSignalingGrant.init()
 	c.txSignalingCancel.init()
 	c.workerQueue.init()
 	c.workerSubs.init()
+	c.workerAssignments.init()
+	c.workerCPU.init()
+	c.workerSerialize.init()
+	c.workerTXTS.init()
+	c.workerSocket.init()
+	c.features.init()
+	c.shadowDivergence.init()
+	c.workerOverruns.init()
+	c.workerLateness.init()
+	c.tenantSubs.init()
+	c.tenantRejects.init()
+	c.authFailures.init()
+	c.compat.init()
+	c.followUpOutcomes.init()
+	c.ifaceRX.init()
+	c.ifaceTX.init()
+	c.timeToFirstSync.init()
+	c.standbySuppressed.init()
+	c.txOversize.init()
+	c.fpsDemand.init()
+	c.fpsStretch.init()
+	c.socketRcvBuf.init()
+	c.socketDrops.init()
+	c.pathDelay.init()
+	c.canary.init()
+	c.clients.init()
 	c.txtsattempts.init()
 }
 
@@ -215,16 +877,185 @@ func (c *counters) reset() {
 	c.tx.reset()
 	c.rxSignalingGrant.reset()
 	c.rxSignalingCancel.reset()
+	c.rxCoalesced.reset()
+	c.rxDomain.reset()
 	c.txSignalingGrant.reset()
 	c.txSignalingCancel.reset()
 	c.workerQueue.reset()
 	c.workerSubs.reset()
+	c.workerAssignments.reset()
+	c.workerCPU.reset()
+	c.workerSerialize.reset()
+	c.workerTXTS.reset()
+	c.workerSocket.reset()
+	c.features.reset()
+	c.shadowDivergence.reset()
+	c.workerOverruns.reset()
+	c.workerLateness.reset()
+	c.tenantSubs.reset()
+	c.tenantRejects.reset()
+	c.authFailures.reset()
+	c.compat.reset()
+	c.followUpOutcomes.reset()
+	c.ifaceRX.reset()
+	c.ifaceTX.reset()
+	c.timeToFirstSync.reset()
+	c.standbySuppressed.reset()
+	c.txOversize.reset()
+	c.fpsDemand.reset()
+	c.fpsStretch.reset()
+	c.socketRcvBuf.reset()
+	c.timestamping.store(TimestampingInfo{})
+	c.socketDrops.reset()
+	c.pathDelay.reset()
+	c.canary.reset()
+	c.clients.reset()
+	c.txtsLatency.reset()
+	c.syncFanout.reset()
+	c.kernelTXLatency.reset()
 	c.txtsattempts.reset()
 	c.utcoffsetSec = 0
 	c.clockaccuracy = 0
 	c.clockclass = 0
+	c.clockclassRaw = 0
 	c.drain = 0
+	c.drained = 0
+	c.degraded = 0
+	c.ntpOffset = 0
+	c.ntpAlarm = 0
+	c.upstreamOffset = 0
+	c.upstreamDelay = 0
+	c.upstreamServo = 0
+	c.utcOffsetAlarm = 0
+	c.leapPending = 0
+	c.leapSmear = 0
 	c.reload = 0
+	c.configRollback = 0
+	c.configGeneration = 0
+	c.shutdownPending = 0
+	c.shutdownCancelled = 0
+	c.standby = 0
+	c.txSignalingSplit = 0
+	c.rxECNCE = 0
+	c.rxBlocked = 0
+	c.blocklistEntries = 0
+	c.deniedACL = 0
+	c.deniedRateLimit = 0
+	c.deniedClientLimit = 0
+	c.deniedPolicy = 0
+	c.grantHintHonored = 0
+	c.churnCreated = 0
+	c.churnExpired = 0
+	c.churnAllocBytes = 0
+	c.churnAllocObjects = 0
+	c.gcCycles = 0
+	c.gcPauseNs = 0
+	c.gcMaxPauseNs = 0
+	c.heapAllocBytes = 0
+	c.sizingCPUs = 0
+	c.sizingRXQueues = 0
+	c.sizingTXQueues = 0
+	c.sizingSubs = 0
+	c.sizingSend = 0
+	c.sizingRecv = 0
+	c.sizingRecommended = 0
+	c.sizingAuto = 0
+	c.timeToFirstSyncNs = 0
+}
+
+// addTo adds all the counters to the ones of dst, keeping the timestamping info if set
+func (c *counters) addTo(dst *counters) {
+	c.subscriptions.addTo(&dst.subscriptions)
+	c.rx.addTo(&dst.rx)
+	c.tx.addTo(&dst.tx)
+	c.rxSignalingGrant.addTo(&dst.rxSignalingGrant)
+	c.rxSignalingCancel.addTo(&dst.rxSignalingCancel)
+	c.rxCoalesced.addTo(&dst.rxCoalesced)
+	c.rxDomain.addTo(&dst.rxDomain)
+	c.txSignalingGrant.addTo(&dst.txSignalingGrant)
+	c.txSignalingCancel.addTo(&dst.txSignalingCancel)
+	c.workerQueue.addTo(&dst.workerQueue)
+	c.workerSubs.addTo(&dst.workerSubs)
+	c.workerAssignments.addTo(&dst.workerAssignments)
+	c.workerCPU.addTo(&dst.workerCPU)
+	c.workerSerialize.addTo(&dst.workerSerialize)
+	c.workerTXTS.addTo(&dst.workerTXTS)
+	c.workerSocket.addTo(&dst.workerSocket)
+	c.features.addTo(&dst.features)
+	c.shadowDivergence.addTo(&dst.shadowDivergence)
+	c.workerOverruns.addTo(&dst.workerOverruns)
+	c.workerLateness.addTo(&dst.workerLateness)
+	c.tenantSubs.addTo(&dst.tenantSubs)
+	c.tenantRejects.addTo(&dst.tenantRejects)
+	c.authFailures.addTo(&dst.authFailures)
+	c.compat.addTo(&dst.compat)
+	c.followUpOutcomes.addTo(&dst.followUpOutcomes)
+	c.ifaceRX.addTo(&dst.ifaceRX)
+	c.ifaceTX.addTo(&dst.ifaceTX)
+	c.timeToFirstSync.addTo(&dst.timeToFirstSync)
+	c.standbySuppressed.addTo(&dst.standbySuppressed)
+	c.txOversize.addTo(&dst.txOversize)
+	c.fpsDemand.addTo(&dst.fpsDemand)
+	c.fpsStretch.addTo(&dst.fpsStretch)
+	c.socketRcvBuf.addTo(&dst.socketRcvBuf)
+	if info := c.timestamping.load(); info != (TimestampingInfo{}) {
+		dst.timestamping.store(info)
+	}
+	c.socketDrops.addTo(&dst.socketDrops)
+	c.pathDelay.addTo(&dst.pathDelay)
+	c.canary.addTo(&dst.canary)
+	c.clients.addTo(&dst.clients)
+	c.txtsLatency.addTo(&dst.txtsLatency)
+	c.syncFanout.addTo(&dst.syncFanout)
+	c.kernelTXLatency.addTo(&dst.kernelTXLatency)
+	c.txtsattempts.addTo(&dst.txtsattempts)
+	atomic.AddInt64(&dst.utcoffsetSec, atomic.LoadInt64(&c.utcoffsetSec))
+	atomic.AddInt64(&dst.clockaccuracy, atomic.LoadInt64(&c.clockaccuracy))
+	atomic.AddInt64(&dst.clockclass, atomic.LoadInt64(&c.clockclass))
+	atomic.AddInt64(&dst.clockclassRaw, atomic.LoadInt64(&c.clockclassRaw))
+	atomic.AddInt64(&dst.drain, atomic.LoadInt64(&c.drain))
+	atomic.AddInt64(&dst.drained, atomic.LoadInt64(&c.drained))
+	atomic.AddInt64(&dst.degraded, atomic.LoadInt64(&c.degraded))
+	atomic.AddInt64(&dst.ntpOffset, atomic.LoadInt64(&c.ntpOffset))
+	atomic.AddInt64(&dst.ntpAlarm, atomic.LoadInt64(&c.ntpAlarm))
+	atomic.AddInt64(&dst.upstreamOffset, atomic.LoadInt64(&c.upstreamOffset))
+	atomic.AddInt64(&dst.upstreamDelay, atomic.LoadInt64(&c.upstreamDelay))
+	atomic.AddInt64(&dst.upstreamServo, atomic.LoadInt64(&c.upstreamServo))
+	atomic.AddInt64(&dst.utcOffsetAlarm, atomic.LoadInt64(&c.utcOffsetAlarm))
+	atomic.AddInt64(&dst.leapPending, atomic.LoadInt64(&c.leapPending))
+	atomic.AddInt64(&dst.leapSmear, atomic.LoadInt64(&c.leapSmear))
+	atomic.AddInt64(&dst.reload, atomic.LoadInt64(&c.reload))
+	atomic.AddInt64(&dst.configRollback, atomic.LoadInt64(&c.configRollback))
+	atomic.AddInt64(&dst.configGeneration, atomic.LoadInt64(&c.configGeneration))
+	atomic.AddInt64(&dst.shutdownPending, atomic.LoadInt64(&c.shutdownPending))
+	atomic.AddInt64(&dst.shutdownCancelled, atomic.LoadInt64(&c.shutdownCancelled))
+	atomic.AddInt64(&dst.standby, atomic.LoadInt64(&c.standby))
+	atomic.AddInt64(&dst.txSignalingSplit, atomic.LoadInt64(&c.txSignalingSplit))
+	atomic.AddInt64(&dst.rxECNCE, atomic.LoadInt64(&c.rxECNCE))
+	atomic.AddInt64(&dst.rxBlocked, atomic.LoadInt64(&c.rxBlocked))
+	atomic.AddInt64(&dst.blocklistEntries, atomic.LoadInt64(&c.blocklistEntries))
+	atomic.AddInt64(&dst.deniedACL, atomic.LoadInt64(&c.deniedACL))
+	atomic.AddInt64(&dst.deniedRateLimit, atomic.LoadInt64(&c.deniedRateLimit))
+	atomic.AddInt64(&dst.deniedClientLimit, atomic.LoadInt64(&c.deniedClientLimit))
+	atomic.AddInt64(&dst.deniedPolicy, atomic.LoadInt64(&c.deniedPolicy))
+	atomic.AddInt64(&dst.grantHintHonored, atomic.LoadInt64(&c.grantHintHonored))
+	atomic.AddInt64(&dst.churnCreated, atomic.LoadInt64(&c.churnCreated))
+	atomic.AddInt64(&dst.churnExpired, atomic.LoadInt64(&c.churnExpired))
+	atomic.AddInt64(&dst.churnAllocBytes, atomic.LoadInt64(&c.churnAllocBytes))
+	atomic.AddInt64(&dst.churnAllocObjects, atomic.LoadInt64(&c.churnAllocObjects))
+	atomic.AddInt64(&dst.gcCycles, atomic.LoadInt64(&c.gcCycles))
+	atomic.AddInt64(&dst.gcPauseNs, atomic.LoadInt64(&c.gcPauseNs))
+	atomic.AddInt64(&dst.gcMaxPauseNs, atomic.LoadInt64(&c.gcMaxPauseNs))
+	atomic.AddInt64(&dst.heapAllocBytes, atomic.LoadInt64(&c.heapAllocBytes))
+	atomic.AddInt64(&dst.sizingCPUs, atomic.LoadInt64(&c.sizingCPUs))
+	atomic.AddInt64(&dst.sizingRXQueues, atomic.LoadInt64(&c.sizingRXQueues))
+	atomic.AddInt64(&dst.sizingTXQueues, atomic.LoadInt64(&c.sizingTXQueues))
+	atomic.AddInt64(&dst.sizingSubs, atomic.LoadInt64(&c.sizingSubs))
+	atomic.AddInt64(&dst.sizingSend, atomic.LoadInt64(&c.sizingSend))
+	atomic.AddInt64(&dst.sizingRecv, atomic.LoadInt64(&c.sizingRecv))
+	atomic.AddInt64(&dst.sizingRecommended, atomic.LoadInt64(&c.sizingRecommended))
+	atomic.AddInt64(&dst.sizingAuto, atomic.LoadInt64(&c.sizingAuto))
+	atomic.AddInt64(&dst.timeToFirstSyncNs, atomic.LoadInt64(&c.timeToFirstSyncNs))
 }
 
 // toMap converts counters to a map
@@ -261,6 +1092,16 @@ func (c *counters) toMap() (export map[string]int64) {
 		res[fmt.Sprintf("rx.signaling.cancel.%s", mt)] = c
 	}
 
+	for _, t := range c.rxCoalesced.keys() {
+		c := c.rxCoalesced.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("rx.signaling.coalesced.%s", mt)] = c
+	}
+
+	for _, d := range c.rxDomain.keys() {
+		res[fmt.Sprintf("rx.domain.%d", d)] = c.rxDomain.load(d)
+	}
+
 	for _, t := range c.txSignalingGrant.keys() {
 		c := c.txSignalingGrant.load(t)
 		mt := strings.ToLower(ptp.MessageType(t).String())
@@ -283,16 +1124,198 @@ func (c *counters) toMap() (export map[string]int64) {
 		res[fmt.Sprintf("worker.%d.subscriptions", t)] = c
 	}
 
+	for _, t := range c.workerAssignments.keys() {
+		c := c.workerAssignments.load(t)
+		res[fmt.Sprintf("worker.%d.assignments", t)] = c
+	}
+
+	for _, t := range c.workerCPU.keys() {
+		c := c.workerCPU.load(t)
+		res[fmt.Sprintf("worker.%d.cpu_ns", t)] = c
+	}
+
+	for _, t := range c.workerSerialize.keys() {
+		c := c.workerSerialize.load(t)
+		res[fmt.Sprintf("worker.%d.serialization_ns", t)] = c
+	}
+
+	for _, t := range c.workerTXTS.keys() {
+		c := c.workerTXTS.load(t)
+		res[fmt.Sprintf("worker.%d.txts_ns", t)] = c
+	}
+
+	for _, t := range c.workerSocket.keys() {
+		c := c.workerSocket.load(t)
+		res[fmt.Sprintf("worker.%d.socket_ns", t)] = c
+	}
+
+	for _, t := range c.shadowDivergence.keys() {
+		c := c.shadowDivergence.load(t)
+		res[fmt.Sprintf("worker.%d.shadow_divergence_ns", t)] = c
+	}
+
+	for _, t := range c.workerOverruns.keys() {
+		c := c.workerOverruns.load(t)
+		res[fmt.Sprintf("worker.%d.overruns", t)] = c
+	}
+
+	for _, t := range c.workerLateness.keys() {
+		c := c.workerLateness.load(t)
+		res[fmt.Sprintf("worker.%d.lateness_ns", t)] = c
+	}
+
+	for _, t := range c.features.keys() {
+		c := c.features.load(t)
+		res[fmt.Sprintf("feature.%s", Feature(t))] = c
+	}
+
 	for _, t := range c.txtsattempts.keys() {
 		c := c.txtsattempts.load(t)
 		res[fmt.Sprintf("worker.%d.txtsattempts", t)] = c
 	}
 
+	for _, t := range c.tenantSubs.keys() {
+		res[fmt.Sprintf("tenant.%s.subscriptions", t)] = c.tenantSubs.load(t)
+	}
+
+	for _, t := range c.tenantRejects.keys() {
+		res[fmt.Sprintf("tenant.%s.quota_rejects", t)] = c.tenantRejects.load(t)
+	}
+
+	for _, r := range c.authFailures.keys() {
+		res[fmt.Sprintf("auth.failures.%s", r)] = c.authFailures.load(r)
+	}
+
+	for _, m := range c.compat.keys() {
+		res[fmt.Sprintf("compat.%s", m)] = c.compat.load(m)
+	}
+
+	for _, o := range c.followUpOutcomes.keys() {
+		res[fmt.Sprintf("followup.%s", o)] = c.followUpOutcomes.load(o)
+	}
+
+	for _, iface := range c.ifaceRX.ifaces() {
+		for t, v := range c.ifaceRX.counters(iface).values() {
+			mt := strings.ToLower(ptp.MessageType(t).String())
+			res[fmt.Sprintf("iface.%s.rx.%s", iface, mt)] = v
+		}
+	}
+
+	for _, iface := range c.ifaceTX.ifaces() {
+		for t, v := range c.ifaceTX.counters(iface).values() {
+			mt := strings.ToLower(ptp.MessageType(t).String())
+			res[fmt.Sprintf("iface.%s.tx.%s", iface, mt)] = v
+		}
+	}
+
+	for _, t := range c.pathDelay.keys() {
+		res[fmt.Sprintf("pathdelay.%s_ns", t)] = c.pathDelay.load(t)
+	}
+
+	for _, k := range c.canary.keys() {
+		res[fmt.Sprintf("canary.%s", k)] = c.canary.load(k)
+	}
+
+	for _, t := range c.txOversize.keys() {
+		c := c.txOversize.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("tx.oversize.%s", mt)] = c
+	}
+
+	for _, t := range c.fpsDemand.keys() {
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("fps.demand.%s", mt)] = c.fpsDemand.load(t)
+	}
+
+	for _, t := range c.fpsStretch.keys() {
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("fps.stretch_pct.%s", mt)] = c.fpsStretch.load(t)
+	}
+
+	for _, t := range c.standbySuppressed.keys() {
+		c := c.standbySuppressed.load(t)
+		mt := strings.ToLower(ptp.MessageType(t).String())
+		res[fmt.Sprintf("standby.suppressed.%s", mt)] = c
+	}
+
+	for _, t := range c.socketRcvBuf.keys() {
+		res[fmt.Sprintf("socket.%s.rcvbuf", t)] = c.socketRcvBuf.load(t)
+	}
+
+	for _, t := range c.socketDrops.keys() {
+		res[fmt.Sprintf("socket.%s.drops", t)] = c.socketDrops.load(t)
+	}
+
+	if ts := c.timestamping.load(); ts.Mode != "" {
+		res[fmt.Sprintf("timestamping.%s", ts.Mode)] = 1
+		res["phc.index"] = int64(ts.PHCIndex)
+		if ts.Driver != "" {
+			res[fmt.Sprintf("nic.driver.%s", ts.Driver)] = 1
+			res[fmt.Sprintf("nic.firmware.%s", ts.Firmware)] = 1
+		}
+	}
+
+	c.txtsLatency.toMap("txts_latency", res)
+	c.syncFanout.toMap("sync_fanout", res)
+	c.kernelTXLatency.toMap("kernel_tx_latency", res)
+
+	// cumulative buckets, each one counts all observations up to its bound
+	if len(c.timeToFirstSync.keys()) > 0 {
+		var total int64
+		for i, b := range TimeToFirstSyncBuckets {
+			total += c.timeToFirstSync.load(i)
+			res[fmt.Sprintf("time_to_first_sync.le_%dms", b.Milliseconds())] = total
+		}
+		total += c.timeToFirstSync.load(len(TimeToFirstSyncBuckets))
+		res["time_to_first_sync.le_inf"] = total
+	}
+
 	res["utcoffset_sec"] = c.utcoffsetSec
 	res["clockaccuracy"] = c.clockaccuracy
 	res["clockclass"] = c.clockclass
+	res["clockclass.raw"] = c.clockclassRaw
 	res["drain"] = c.drain
+	res["drained"] = c.drained
+	res["degraded"] = c.degraded
+	res["ntp.offset_ns"] = c.ntpOffset
+	res["ntp.alarm"] = c.ntpAlarm
+	res["upstream.offset_ns"] = c.upstreamOffset
+	res["upstream.path_delay_ns"] = c.upstreamDelay
+	res["upstream.servo_state"] = c.upstreamServo
+	res["utcoffset.alarm"] = c.utcOffsetAlarm
+	res["leap.pending"] = c.leapPending
+	res["leap.smear_ns"] = c.leapSmear
 	res["reload"] = c.reload
+	res["config.rollback"] = c.configRollback
+	res["config.generation"] = c.configGeneration
+	res["shutdown.pending"] = c.shutdownPending
+	res["shutdown.cancelled"] = c.shutdownCancelled
+	res["standby"] = c.standby
+	res["tx.signaling.split"] = c.txSignalingSplit
+	res["rx.ecn.ce"] = c.rxECNCE
+	res["rx.blocked"] = c.rxBlocked
+	res["blocklist.entries"] = c.blocklistEntries
+	res["denied.acl"] = c.deniedACL
+	res["denied.ratelimit"] = c.deniedRateLimit
+	res["denied.clientlimit"] = c.deniedClientLimit
+	res["denied.policy"] = c.deniedPolicy
+	res["granthint.honored"] = c.grantHintHonored
+	res["churn.created"] = c.churnCreated
+	res["churn.expired"] = c.churnExpired
+	res["churn.alloc_bytes"] = c.churnAllocBytes
+	res["churn.alloc_objects"] = c.churnAllocObjects
+	res["gc.cycles"] = c.gcCycles
+	res["gc.pause_ns"] = c.gcPauseNs
+	res["gc.max_pause_ns"] = c.gcMaxPauseNs
+	res["gc.heap_alloc_bytes"] = c.heapAllocBytes
+	res["workers.sizing.cpus"] = c.sizingCPUs
+	res["workers.sizing.rx_queues"] = c.sizingRXQueues
+	res["workers.sizing.tx_queues"] = c.sizingTXQueues
+	res["workers.sizing.subscriptions"] = c.sizingSubs
+	res["workers.sizing.send"] = c.sizingSend
+	res["workers.sizing.recv"] = c.sizingRecv
+	res["workers.sizing.recommended_send"] = c.sizingRecommended
+	res["workers.sizing.auto"] = c.sizingAuto
 
 	return res
 }
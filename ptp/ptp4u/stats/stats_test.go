@@ -56,10 +56,29 @@ func TestSyncMapInt64Copy(t *testing.T) {
 	dst.init()
 
 	s.copy(&dst)
-	require.Equal(t, s.m, dst.m)
+	require.Equal(t, s.values(), dst.values())
 	require.Equal(t, int64(1), dst.load(1))
 }
 
+func TestSyncMapInt64SparseKeys(t *testing.T) {
+	s := syncMapInt64{}
+	s.init()
+
+	for _, k := range []int{-1, 0, denseKeys - 1, denseKeys, 100000} {
+		s.inc(k)
+		s.add(k, 2)
+		s.dec(k)
+		require.Equal(t, int64(2), s.load(k), k)
+	}
+	require.Len(t, s.keys(), 5)
+
+	s.reset()
+	require.Len(t, s.keys(), 5)
+	for k, v := range s.values() {
+		require.Equal(t, int64(0), v, k)
+	}
+}
+
 func TestSyncMapInt64Counters(t *testing.T) {
 	c := counters{}
 	c.init()
@@ -76,6 +95,7 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	c.clockaccuracy = 1
 	c.clockclass = 1
 	c.drain = 1
+	c.degraded = 1
 	c.reload = 1
 
 	require.Equal(t, int64(1), c.subscriptions.load(1))
@@ -90,6 +110,7 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	require.Equal(t, int64(1), c.clockaccuracy)
 	require.Equal(t, int64(1), c.clockclass)
 	require.Equal(t, int64(1), c.drain)
+	require.Equal(t, int64(1), c.degraded)
 	require.Equal(t, int64(1), c.reload)
 
 	c.reset()
@@ -106,6 +127,7 @@ func TestSyncMapInt64Counters(t *testing.T) {
 	require.Equal(t, int64(0), c.clockaccuracy)
 	require.Equal(t, int64(0), c.clockclass)
 	require.Equal(t, int64(0), c.drain)
+	require.Equal(t, int64(0), c.degraded)
 	require.Equal(t, int64(0), c.reload)
 }
 
@@ -133,8 +155,80 @@ func TestCountersToMap(t *testing.T) {
 	expectedMap["utcoffset_sec"] = 1
 	expectedMap["clockaccuracy"] = 42
 	expectedMap["clockclass"] = 6
+	expectedMap["clockclass.raw"] = 0
 	expectedMap["drain"] = 1
+	expectedMap["drained"] = 0
+	expectedMap["degraded"] = 0
+	expectedMap["ntp.offset_ns"] = 0
+	expectedMap["upstream.offset_ns"] = 0
+	expectedMap["upstream.path_delay_ns"] = 0
+	expectedMap["upstream.servo_state"] = 0
+	expectedMap["ntp.alarm"] = 0
+	expectedMap["utcoffset.alarm"] = 0
+	expectedMap["leap.pending"] = 0
+	expectedMap["leap.smear_ns"] = 0
+	expectedMap["config.rollback"] = 0
+	expectedMap["config.generation"] = 0
+	expectedMap["shutdown.pending"] = 0
+	expectedMap["shutdown.cancelled"] = 0
+	expectedMap["standby"] = 0
+	expectedMap["tx.signaling.split"] = 0
+	expectedMap["rx.ecn.ce"] = 0
+	expectedMap["rx.blocked"] = 0
+	expectedMap["blocklist.entries"] = 0
+	expectedMap["denied.acl"] = 0
+	expectedMap["denied.ratelimit"] = 0
+	expectedMap["denied.clientlimit"] = 0
+	expectedMap["denied.policy"] = 0
+	expectedMap["granthint.honored"] = 0
+	expectedMap["churn.created"] = 0
+	expectedMap["churn.expired"] = 0
+	expectedMap["churn.alloc_bytes"] = 0
+	expectedMap["churn.alloc_objects"] = 0
+	expectedMap["gc.cycles"] = 0
+	expectedMap["gc.pause_ns"] = 0
+	expectedMap["gc.max_pause_ns"] = 0
+	expectedMap["gc.heap_alloc_bytes"] = 0
+	expectedMap["workers.sizing.cpus"] = 0
+	expectedMap["workers.sizing.rx_queues"] = 0
+	expectedMap["workers.sizing.tx_queues"] = 0
+	expectedMap["workers.sizing.subscriptions"] = 0
+	expectedMap["workers.sizing.send"] = 0
+	expectedMap["workers.sizing.recv"] = 0
+	expectedMap["workers.sizing.recommended_send"] = 0
+	expectedMap["workers.sizing.auto"] = 0
 	expectedMap["reload"] = 2
 
 	require.Equal(t, expectedMap, result)
 }
+
+func BenchmarkSyncMapInt64Inc(b *testing.B) {
+	s := syncMapInt64{}
+	s.init()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.inc(int(ptp.MessageSync))
+		}
+	})
+}
+
+func BenchmarkJSONStatsIncTX(b *testing.B) {
+	s := NewJSONStats()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.IncTX(ptp.MessageSync)
+			s.IncRX(ptp.MessageDelayReq)
+		}
+	})
+}
+
+func BenchmarkJSONStatsShardIncTX(b *testing.B) {
+	s := NewJSONStats()
+	b.RunParallel(func(pb *testing.PB) {
+		w := s.Shard()
+		for pb.Next() {
+			w.IncTX(ptp.MessageSync)
+			w.IncRX(ptp.MessageDelayReq)
+		}
+	})
+}
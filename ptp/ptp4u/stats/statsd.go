@@ -0,0 +1,211 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// statsdPacketSize keeps datagrams within the MTU of the most restrictive paths
+const statsdPacketSize = 1432
+
+// StatsDConfig configures pushing the stats to a StatsD or DogStatsD agent
+type StatsDConfig struct {
+	// Addr is host:port of the agent
+	Addr string
+	// Prefix is prepended to the metric names
+	Prefix string
+	// Tags are static key:value tags added to every metric. DogStatsD only
+	Tags []string
+	// DogStatsD sends labels as tags. Plain StatsD gets them appended to the metric name
+	DogStatsD bool
+	// FlushInterval is how often the stats are pushed
+	FlushInterval time.Duration
+}
+
+// Validate checks the config is usable
+func (c StatsDConfig) Validate() error {
+	if c.Addr == "" {
+		return fmt.Errorf("statsd address is required")
+	}
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("statsd flush interval must be positive, got %v", c.FlushInterval)
+	}
+	if len(c.Tags) > 0 && !c.DogStatsD {
+		return fmt.Errorf("statsd tags require dogstatsd")
+	}
+	for _, t := range c.Tags {
+		if !strings.Contains(t, ":") {
+			return fmt.Errorf("statsd tag %q is not key:value", t)
+		}
+	}
+	return nil
+}
+
+// statsdPusher renders samples in the StatsD line format and pushes them to the agent.
+// Counters are sent as deltas since the previous flush and gauges as they are
+type statsdPusher struct {
+	config StatsDConfig
+	// namespace of the metric names, replaced by the config prefix
+	namespace string
+	// flushMux serializes flushes
+	flushMux sync.Mutex
+	// counter values of the previous flush by the metric line without the value
+	last map[string]float64
+}
+
+// start pushes the samples every flush interval
+func (p *statsdPusher) start(samples func() []promSample) error {
+	conn, err := net.Dial("udp", p.config.Addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("Pushing stats to statsd on %s every %v", p.config.Addr, p.config.FlushInterval)
+	go func() {
+		for range time.Tick(p.config.FlushInterval) {
+			if err := p.flush(conn, samples()); err != nil {
+				log.Errorf("Failed to push stats: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// flush writes the samples to w, a datagram per write
+func (p *statsdPusher) flush(w io.Writer, samples []promSample) error {
+	for _, data := range statsdPackets(p.lines(samples)) {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statsdPackets packs the metric lines into datagrams
+func statsdPackets(lines []string) [][]byte {
+	var packets [][]byte
+	var p []byte
+	for _, l := range lines {
+		if len(p) > 0 && len(p)+1+len(l) > statsdPacketSize {
+			packets = append(packets, p)
+			p = nil
+		}
+		if len(p) > 0 {
+			p = append(p, '\n')
+		}
+		p = append(p, l...)
+	}
+	if len(p) > 0 {
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+// lines renders the samples in the StatsD line format
+func (p *statsdPusher) lines(samples []promSample) []string {
+	p.flushMux.Lock()
+	defer p.flushMux.Unlock()
+	lines := make([]string, 0, len(samples))
+	for _, m := range samples {
+		name, tags := p.name(m)
+		if m.counter {
+			delta := m.value - p.last[name+tags]
+			p.last[name+tags] = m.value
+			lines = append(lines, fmt.Sprintf("%s:%s|c%s", name, formatFloat(delta), tags))
+			continue
+		}
+		if m.value < 0 && !p.config.DogStatsD {
+			// plain StatsD treats signed gauges as relative changes
+			lines = append(lines, fmt.Sprintf("%s:0|g%s", name, tags))
+		}
+		lines = append(lines, fmt.Sprintf("%s:%s|g%s", name, formatFloat(m.value), tags))
+	}
+	return lines
+}
+
+// statsdEscaper replaces characters with a meaning in the StatsD line format
+var statsdEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_", "\n", "_")
+
+// name returns the metric name and the DogStatsD tags section of the sample
+func (p *statsdPusher) name(m promSample) (string, string) {
+	name := strings.TrimPrefix(m.name, p.namespace+"_")
+	if m.counter {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	name = p.config.Prefix + name
+	tags := append([]string{}, p.config.Tags...)
+	for i := 0; i+1 < len(m.labels); i += 2 {
+		if p.config.DogStatsD {
+			tags = append(tags, m.labels[i]+":"+statsdEscaper.Replace(m.labels[i+1]))
+		} else {
+			// dots separate the levels of plain StatsD names
+			name += "." + strings.ReplaceAll(statsdEscaper.Replace(m.labels[i+1]), ".", "_")
+		}
+	}
+	if len(tags) == 0 {
+		return name, ""
+	}
+	return name, "|#" + strings.Join(tags, ",")
+}
+
+// StatsDStats pushes the stats to a StatsD agent. Metrics are the ones PrometheusStats exports,
+// counters are sent as deltas since the previous flush and gauges as the values of the last snapshot.
+// JSON is still served on the monitoring port
+type StatsDStats struct {
+	*PrometheusStats
+
+	statsd statsdPusher
+}
+
+// NewStatsDStats returns a new StatsDStats
+func NewStatsDStats(c StatsDConfig) *StatsDStats {
+	s := &StatsDStats{PrometheusStats: NewPrometheusStats()}
+	s.statsd.config = c
+	s.statsd.namespace = "ptp4u"
+	s.statsd.last = map[string]float64{}
+	return s
+}
+
+// Start starts pushing the stats and runs http server serving json
+func (s *StatsDStats) Start(monitoringport int) {
+	if err := s.statsd.start(s.samples); err != nil {
+		log.Fatalf("Failed to connect to statsd: %v", err)
+	}
+	s.JSONStats.Start(monitoringport)
+}
+
+// samples returns the metrics PrometheusStats exports
+func (s *StatsDStats) samples() []promSample {
+	return s.collect().samples
+}
+
+// flush writes the metrics to w, a datagram per write
+func (s *StatsDStats) flush(w io.Writer) error {
+	return s.statsd.flush(w, s.samples())
+}
+
+// lines renders the metrics in the StatsD line format
+func (s *StatsDStats) lines() []string {
+	return s.statsd.lines(s.samples())
+}
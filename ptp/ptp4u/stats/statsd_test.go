@@ -0,0 +1,112 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stats
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsDConfigValidate(t *testing.T) {
+	c := StatsDConfig{Addr: "localhost:8125", FlushInterval: time.Second, DogStatsD: true, Tags: []string{"region:eu"}}
+	require.NoError(t, c.Validate())
+
+	for _, bad := range []StatsDConfig{
+		{FlushInterval: time.Second},
+		{Addr: "localhost:8125"},
+		{Addr: "localhost:8125", FlushInterval: time.Second, Tags: []string{"region:eu"}},
+		{Addr: "localhost:8125", FlushInterval: time.Second, DogStatsD: true, Tags: []string{"eu"}},
+	} {
+		require.Error(t, bad.Validate(), bad)
+	}
+}
+
+func TestStatsDStatsLines(t *testing.T) {
+	stats := NewStatsDStats(StatsDConfig{Prefix: "ptp4u.", DogStatsD: true, Tags: []string{"region:eu"}})
+
+	stats.IncTX(ptp.MessageSync)
+	stats.IncTX(ptp.MessageSync)
+	stats.IncSubscription(ptp.MessageSync)
+	stats.SetUTCOffsetSec(37)
+	stats.Snapshot()
+	stats.Reset()
+
+	lines := stats.lines()
+	require.Contains(t, lines, "ptp4u.tx_messages:2|c|#region:eu,message_type:sync")
+	require.Contains(t, lines, "ptp4u.subscriptions:1|g|#region:eu,message_type:sync")
+	require.Contains(t, lines, "ptp4u.utcoffset_seconds:37|g|#region:eu")
+
+	// counters are deltas since the previous flush, gauges are absolute
+	stats.IncTX(ptp.MessageSync)
+	stats.SetUTCOffsetSec(37)
+	stats.Snapshot()
+	stats.Reset()
+	lines = stats.lines()
+	require.Contains(t, lines, "ptp4u.tx_messages:1|c|#region:eu,message_type:sync")
+	require.Contains(t, lines, "ptp4u.utcoffset_seconds:37|g|#region:eu")
+
+	lines = stats.lines()
+	require.Contains(t, lines, "ptp4u.tx_messages:0|c|#region:eu,message_type:sync")
+}
+
+func TestStatsDStatsPlain(t *testing.T) {
+	stats := NewStatsDStats(StatsDConfig{Prefix: "ptp4u."})
+
+	stats.IncTX(ptp.MessageSync)
+	stats.SetNTPOffset(-int64(time.Second))
+	stats.SetTimestampingInfo(TimestampingInfo{Mode: TimestampingHardware, Driver: "mlx5_core", Firmware: "16.35.1012"})
+	stats.Snapshot()
+
+	lines := stats.lines()
+	require.Contains(t, lines, "ptp4u.tx_messages.sync:1|c")
+	require.Contains(t, lines, "ptp4u.timestamping_info.hardware.0.mlx5_core.16_35_1012:1|g")
+	// negative gauge is reset first, otherwise it'd be a decrement
+	require.Contains(t, strings.Join(lines, "\n"), "ptp4u.ntp_offset_seconds:0|g\nptp4u.ntp_offset_seconds:-1|g")
+}
+
+func TestStatsDStatsFlush(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	stats := NewStatsDStats(StatsDConfig{Prefix: "ptp4u.", DogStatsD: true})
+	stats.IncRX(ptp.MessageDelayReq)
+	stats.Snapshot()
+	lines := stats.lines()
+	stats.statsd.last = map[string]float64{}
+	require.NoError(t, stats.flush(client))
+
+	var received []string
+	buf := make([]byte, 2*statsdPacketSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	for len(received) < len(lines) {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.LessOrEqual(t, n, statsdPacketSize)
+		received = append(received, strings.Split(string(buf[:n]), "\n")...)
+	}
+	require.Equal(t, lines, received)
+	require.Contains(t, received, "ptp4u.rx_messages:1|c|#message_type:delay_req")
+}
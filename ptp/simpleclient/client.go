@@ -118,6 +118,28 @@ type Config struct {
 	Duration time.Duration
 	// what type of typestamping to use
 	Timestamping string
+	// transport to use, UDP if empty. TCP and TLS are experimental and have reduced accuracy
+	Transport string
+	// server port for TCP and TLS transports
+	Port int
+	// skip server certificate verification for TLS transport
+	InsecureTLS bool
+	// potential masters to discover the best active one from, used instead of Address when set. UDP transport only
+	UnicastMasterTable []string
+	// how often masters of the table which haven't answered yet are queried
+	LogQueryInterval ptp.LogInterval
+	// log the packet exchange at debug level only, for long running clients
+	Quiet bool
+	// grant duration and renewal strategy hinted to the server along with the requests. Not sent if nil
+	GrantHint *ptp.GrantHint
+}
+
+// transport returns the transport in use
+func (c *Config) transport() string {
+	if c.Transport == "" {
+		return TransportUDP
+	}
+	return c.Transport
 }
 
 // Client is a very simplified PTPv2 unicast client.
@@ -162,6 +184,10 @@ func New(cfg *Config, callback func(*MeasurementResult)) *Client {
 }
 
 func (c *Client) sendGeneralMsg(p ptp.Packet) (uint16, error) {
+	return c.sendGeneralMsgTo(p, c.genAddr)
+}
+
+func (c *Client) sendGeneralMsgTo(p ptp.Packet, addr *net.UDPAddr) (uint16, error) {
 	seq := c.genSequence
 	p.SetSequence(c.genSequence)
 	b, err := ptp.Bytes(p)
@@ -169,11 +195,11 @@ func (c *Client) sendGeneralMsg(p ptp.Packet) (uint16, error) {
 		return 0, err
 	}
 	// send packet
-	_, err = c.genConn.WriteTo(b, c.genAddr)
+	_, err = c.genConn.WriteTo(b, addr)
 	if err != nil {
 		return 0, err
 	}
-	log.Debugf("sent packet via port %d to %v", ptp.PortGeneral, c.genAddr)
+	log.Debugf("sent packet via port %d to %v", ptp.PortGeneral, addr)
 	c.genSequence++
 	return seq, nil
 }
@@ -206,9 +232,28 @@ func (c *Client) setup(ctx context.Context, eg *errgroup.Group) error {
 	if err != nil {
 		return err
 	}
-	log.Infof("using ClockIdentity %s, talking to %v using Two-Step Unicast PTPv2 protocol", cid, c.cfg.Address)
 	c.clockID = cid
 
+	if c.cfg.transport() != TransportUDP {
+		log.Infof("using ClockIdentity %s, talking to %v using Two-Step Unicast PTPv2 protocol", cid, c.cfg.Address)
+		return c.setupStream(ctx, eg)
+	}
+
+	// bind to general port
+	genConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: ptp.PortGeneral})
+	if err != nil {
+		return err
+	}
+	c.genConn = genConn
+	if len(c.cfg.UnicastMasterTable) > 0 {
+		best, err := c.discover(ctx, genConn)
+		if err != nil {
+			return err
+		}
+		c.cfg.Address = best.Address
+	}
+	log.Infof("using ClockIdentity %s, talking to %v using Two-Step Unicast PTPv2 protocol", cid, c.cfg.Address)
+
 	// addresses
 	// where to send to
 	genAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(c.cfg.Address, fmt.Sprintf("%d", ptp.PortGeneral)))
@@ -219,12 +264,6 @@ func (c *Client) setup(ctx context.Context, eg *errgroup.Group) error {
 	if err != nil {
 		return err
 	}
-	// bind to general port
-	genConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: ptp.PortGeneral})
-	if err != nil {
-		return err
-	}
-	c.genConn = genConn
 	c.genAddr = genAddr
 	// bind to event port
 	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: ptp.PortEvent})
@@ -336,7 +375,7 @@ func (c *Client) handleGrantUnicast(tlv *ptp.GrantUnicastTransmissionTLV) error
 			return fmt.Errorf("server denied us grant for %s", msgType)
 		}
 		// ask for sync messages
-		seq, err := c.sendGeneralMsg(reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageSync))
+		seq, err := c.sendGeneralMsg(c.reqUnicast(ptp.MessageSync))
 		if err != nil {
 			return err
 		}
@@ -346,7 +385,7 @@ func (c *Client) handleGrantUnicast(tlv *ptp.GrantUnicastTransmissionTLV) error
 			return fmt.Errorf("server denied us grant for %s", msgType)
 		}
 		// ask for delay_resp messages
-		seq, err := c.sendGeneralMsg(reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageDelayResp))
+		seq, err := c.sendGeneralMsg(c.reqUnicast(ptp.MessageDelayResp))
 		if err != nil {
 			return err
 		}
@@ -402,6 +441,10 @@ func (c *Client) handleDelay(b *ptp.DelayResp) error {
 		log.Warningf("failed to get measurements: %v", err)
 		return nil
 	}
+	res.Transport = c.cfg.transport()
+	if res.Clocks, err = timestamp.ReadClocks(); err != nil {
+		log.Warningf("failed to read system clocks: %v", err)
+	}
 	c.callback(res)
 	return nil
 }
@@ -489,10 +532,17 @@ func (c *Client) setState(s state) {
 
 // couple of helpers to log nice lines about happening communication
 func (c *Client) logSent(t ptp.MessageType, msg string, v ...interface{}) {
-	log.Infof(color.GreenString("client -> %s (%s)", t, fmt.Sprintf(msg, v...)))
+	c.logExchange(color.GreenString("client -> %s (%s)", t, fmt.Sprintf(msg, v...)))
 }
 func (c *Client) logReceive(t ptp.MessageType, msg string, v ...interface{}) {
-	log.Infof(color.BlueString("server -> %s (%s)", t, fmt.Sprintf(msg, v...)))
+	c.logExchange(color.BlueString("server -> %s (%s)", t, fmt.Sprintf(msg, v...)))
+}
+func (c *Client) logExchange(line string) {
+	if c.cfg.Quiet {
+		log.Debug(line)
+		return
+	}
+	log.Info(line)
 }
 
 // Run is the main function, it makes client talk to server provided in config
@@ -525,7 +575,7 @@ func (c *Client) runInternal(skipSetup bool) error {
 			default:
 				switch c.state {
 				case stateInit:
-					seq, err := c.sendGeneralMsg(reqUnicast(c.clockID, c.cfg.Duration, ptp.MessageAnnounce))
+					seq, err := c.sendGeneralMsg(c.reqUnicast(ptp.MessageAnnounce))
 					if err != nil {
 						return err
 					}
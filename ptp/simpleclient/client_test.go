@@ -275,7 +275,8 @@ func TestClientRun(t *testing.T) {
 	err := c.runInternal(true)
 	require.Nil(t, err, "full client run should succeed")
 
-	assert.Equal(t, 1, len(history), "measurements should be collected by client")
+	require.Equal(t, 1, len(history), "measurements should be collected by client")
+	assert.False(t, history[0].Clocks.Wallclock.IsZero(), "measurements should have system clock readings")
 }
 
 func TestClientTimeout(t *testing.T) {
@@ -306,3 +307,26 @@ func TestClientTimeout(t *testing.T) {
 	require.Error(t, err, "full client run should fail")
 	assert.Equal(t, 0, len(history))
 }
+
+func TestClientRequestGrantHint(t *testing.T) {
+	c := New(&Config{Duration: 5 * time.Minute}, nil)
+	b, err := ptp.Bytes(c.reqUnicast(ptp.MessageSync))
+	require.Nil(t, err)
+	signaling := &ptp.Signaling{}
+	require.Nil(t, ptp.FromBytes(b, signaling))
+	require.Equal(t, 1, len(signaling.TLVs))
+	_, ok := ptp.FindGrantHint(signaling.TLVs)
+	require.False(t, ok)
+
+	hint := ptp.GrantHint{Duration: 3600, Strategy: ptp.GrantHintBackoff}
+	c.cfg.GrantHint = &hint
+	b, err = ptp.Bytes(c.reqUnicast(ptp.MessageSync))
+	require.Nil(t, err)
+	signaling = &ptp.Signaling{}
+	require.Nil(t, ptp.FromBytes(b, signaling))
+	require.Equal(t, len(b)-2, int(signaling.MessageLength))
+	require.Equal(t, 2, len(signaling.TLVs))
+	got, ok := ptp.FindGrantHint(signaling.TLVs)
+	require.True(t, ok)
+	require.Equal(t, hint, got)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simpleclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/ptp/sptp/bmc"
+)
+
+// deadlineConn is a UDP connection which supports read deadlines
+type deadlineConn interface {
+	UDPConn
+	SetReadDeadline(t time.Time) error
+}
+
+// Master is an entry of the unicast master table
+type Master struct {
+	Address string
+	// Granted is set once the master granted Announce
+	Granted bool
+	// Denied is set once the master denied Announce
+	Denied bool
+	// Announce is the last Announce received from the master
+	Announce *ptp.Announce
+
+	addr *net.UDPAddr
+}
+
+// Alternate tells if the master announces itself as an alternate master
+func (m *Master) Alternate() bool {
+	return m.Announce != nil && m.Announce.FlagField&ptp.FlagAlternateMaster != 0
+}
+
+// Active tells if the master granted Announce and announces itself as the master
+func (m *Master) Active() bool {
+	return m.Granted && m.Announce != nil && !m.Alternate()
+}
+
+// answered tells if there is nothing to wait for from the master
+func (m *Master) answered() bool {
+	return m.Denied || m.Announce != nil
+}
+
+// bestMaster selects the best active master by BMCA, earlier entries of the table win ties
+func bestMaster(masters []*Master) *Master {
+	var best *Master
+	bestPrio := 0
+	for prio, m := range masters {
+		if !m.Active() {
+			continue
+		}
+		if best == nil || bmc.TelcoDscmp(best.Announce, m.Announce, bestPrio, prio) < 0 {
+			best = m
+			bestPrio = prio
+		}
+	}
+	return best
+}
+
+// discover implements unicast discovery: it requests Announce from every master of the unicast master table,
+// querying those which haven't answered every LogQueryInterval, until all of them answer or ctx is done.
+// Announce grants of all masters but the best active one are cancelled
+func (c *Client) discover(ctx context.Context, conn deadlineConn) (*Master, error) {
+	masters := make([]*Master, 0, len(c.cfg.UnicastMasterTable))
+	byIP := map[string]*Master{}
+	for _, address := range c.cfg.UnicastMasterTable {
+		addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(address, fmt.Sprintf("%d", ptp.PortGeneral)))
+		if err != nil {
+			return nil, err
+		}
+		m := &Master{Address: address, addr: addr}
+		masters = append(masters, m)
+		byIP[addr.IP.String()] = m
+	}
+	log.Infof("discovering active masters among %v", c.cfg.UnicastMasterTable)
+
+	queryInterval := c.cfg.LogQueryInterval.Duration()
+	deadline, hasDeadline := ctx.Deadline()
+	var nextQuery time.Time
+	buf := make([]byte, 1024)
+	for !allAnswered(masters) {
+		now := time.Now()
+		if ctx.Err() != nil || (hasDeadline && !now.Before(deadline)) {
+			break
+		}
+		if !now.Before(nextQuery) {
+			for _, m := range masters {
+				// granted masters are only waited for
+				if m.Granted || m.answered() {
+					continue
+				}
+				seq, err := c.sendGeneralMsgTo(c.reqUnicast(ptp.MessageAnnounce), m.addr)
+				if err != nil {
+					return nil, err
+				}
+				c.logSent(ptp.MessageSignaling, "for %s to %s, seq=%d", ptp.MessageAnnounce, m.Address, seq)
+			}
+			nextQuery = now.Add(queryInterval)
+		}
+		readDeadline := nextQuery
+		if hasDeadline && deadline.Before(readDeadline) {
+			readDeadline = deadline
+		}
+		if err := conn.SetReadDeadline(readDeadline); err != nil {
+			return nil, err
+		}
+		n, addr, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m, found := byIP[addr.IP.String()]
+		if !found {
+			log.Warningf("ignoring packets from server %v", addr)
+			continue
+		}
+		if err := c.handleDiscoveryMsg(m, buf[:n]); err != nil {
+			log.Warningf("discovery: %s: %v", m.Address, err)
+		}
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	best := bestMaster(masters)
+	for _, m := range masters {
+		if m == best || !m.Granted {
+			continue
+		}
+		seq, err := c.sendGeneralMsgTo(reqCancelUnicast(c.clockID, ptp.MessageAnnounce), m.addr)
+		if err != nil {
+			return nil, err
+		}
+		c.logSent(ptp.MessageSignaling, "CANCEL for %s to %s, seq=%d", ptp.MessageAnnounce, m.Address, seq)
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no active master discovered among %v", c.cfg.UnicastMasterTable)
+	}
+	log.Infof("discovered best master %s (%s)", best.Address, best.Announce.GrandmasterIdentity)
+	return best, nil
+}
+
+// allAnswered tells if all masters answered
+func allAnswered(masters []*Master) bool {
+	for _, m := range masters {
+		if !m.answered() {
+			return false
+		}
+	}
+	return true
+}
+
+// handleDiscoveryMsg records Announce grants and Announce messages of the master
+func (c *Client) handleDiscoveryMsg(m *Master, b []byte) error {
+	msgType, err := ptp.ProbeMsgType(b)
+	if err != nil {
+		return err
+	}
+	switch msgType {
+	case ptp.MessageSignaling:
+		signaling := &ptp.Signaling{}
+		if err := ptp.FromBytes(b, signaling); err != nil {
+			return fmt.Errorf("reading signaling msg: %w", err)
+		}
+		for _, tlv := range signaling.TLVs {
+			grant, ok := tlv.(*ptp.GrantUnicastTransmissionTLV)
+			if !ok || grant.MsgTypeAndReserved.MsgType() != ptp.MessageAnnounce {
+				continue
+			}
+			c.logReceive(ptp.MessageSignaling, "unicast grant for %s from %s, duration=%d", ptp.MessageAnnounce, m.Address, grant.DurationField)
+			m.Granted = grant.DurationField > 0
+			m.Denied = !m.Granted
+		}
+	case ptp.MessageAnnounce:
+		announce := &ptp.Announce{}
+		if err := ptp.FromBytes(b, announce); err != nil {
+			return fmt.Errorf("reading announce msg: %w", err)
+		}
+		c.logReceive(ptp.MessageAnnounce, "from %s, gmIdentity=%s, clockClass=%d, alternate=%v",
+			m.Address, announce.GrandmasterIdentity, announce.GrandmasterClockQuality.ClockClass, announce.FlagField&ptp.FlagAlternateMaster != 0)
+		m.Announce = announce
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simpleclient
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+type fakePacket struct {
+	b    []byte
+	addr *net.UDPAddr
+}
+
+// fakeDiscoveryConn answers packets sent to it with the responses of respond
+type fakeDiscoveryConn struct {
+	sync.Mutex
+	in       chan fakePacket
+	deadline time.Time
+	sent     []fakePacket
+	respond  func(p ptp.Packet, addr *net.UDPAddr) []ptp.Packet
+}
+
+func (c *fakeDiscoveryConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	c.Lock()
+	deadline := c.deadline
+	c.Unlock()
+	select {
+	case p := <-c.in:
+		return copy(b, p.b), p.addr, nil
+	case <-time.After(time.Until(deadline)):
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *fakeDiscoveryConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	uaddr := addr.(*net.UDPAddr)
+	c.sent = append(c.sent, fakePacket{b: b, addr: uaddr})
+	p, err := ptp.DecodePacket(b)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range c.respond(p, uaddr) {
+		rb, err := ptp.Bytes(r)
+		if err != nil {
+			return 0, err
+		}
+		c.in <- fakePacket{b: rb, addr: uaddr}
+	}
+	return len(b), nil
+}
+
+func (c *fakeDiscoveryConn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *fakeDiscoveryConn) Close() error {
+	return nil
+}
+
+// cancelled returns addresses the Announce cancellations were sent to
+func (c *fakeDiscoveryConn) cancelled() []string {
+	c.Lock()
+	defer c.Unlock()
+	res := []string{}
+	for _, s := range c.sent {
+		p, err := ptp.DecodePacket(s.b)
+		if err != nil {
+			continue
+		}
+		if sig, ok := p.(*ptp.Signaling); ok {
+			if _, ok := sig.TLVs[0].(*ptp.CancelUnicastTransmissionTLV); ok {
+				res = append(res, s.addr.IP.String())
+			}
+		}
+	}
+	return res
+}
+
+func discoveryAnnounce(clockClass ptp.ClockClass, flags uint16) *ptp.Announce {
+	a := announcePkt(0)
+	a.FlagField |= flags
+	a.GrandmasterClockQuality.ClockClass = clockClass
+	a.GrandmasterIdentity = ptp.ClockIdentity(clockClass)
+	return a
+}
+
+func newDiscoveryConn(announces map[string]*ptp.Announce) *fakeDiscoveryConn {
+	return &fakeDiscoveryConn{
+		in: make(chan fakePacket, 100),
+		respond: func(p ptp.Packet, addr *net.UDPAddr) []ptp.Packet {
+			sig, ok := p.(*ptp.Signaling)
+			if !ok {
+				return nil
+			}
+			if _, ok := sig.TLVs[0].(*ptp.RequestUnicastTransmissionTLV); !ok {
+				return nil
+			}
+			ip := addr.IP.String()
+			if ip == "192.0.2.4" {
+				// silent master
+				return nil
+			}
+			a, found := announces[ip]
+			if !found {
+				return []ptp.Packet{grantUnicastPkt(0, 0, 0, ptp.MessageAnnounce)}
+			}
+			return []ptp.Packet{grantUnicastPkt(0, 0, time.Minute, ptp.MessageAnnounce), a}
+		},
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	conn := newDiscoveryConn(map[string]*ptp.Announce{
+		"192.0.2.1": discoveryAnnounce(7, 0),
+		"192.0.2.2": discoveryAnnounce(6, 0),
+		// better, but alternate
+		"192.0.2.3": discoveryAnnounce(5, ptp.FlagAlternateMaster),
+	})
+	c := New(&Config{
+		UnicastMasterTable: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.5"},
+		LogQueryInterval:   -3,
+		Duration:           time.Minute,
+	}, nil)
+	c.genConn = conn
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	best, err := c.discover(ctx, conn)
+	require.NoError(t, err)
+	require.Equal(t, "192.0.2.2", best.Address)
+	require.True(t, best.Active())
+	// all masters answered, denial included, so no need to wait for timeout
+	require.NoError(t, ctx.Err())
+	require.ElementsMatch(t, []string{"192.0.2.1", "192.0.2.3"}, conn.cancelled())
+}
+
+func TestDiscoverRequery(t *testing.T) {
+	conn := newDiscoveryConn(map[string]*ptp.Announce{
+		"192.0.2.1": discoveryAnnounce(6, 0),
+	})
+	c := New(&Config{
+		UnicastMasterTable: []string{"192.0.2.1", "192.0.2.4"},
+		LogQueryInterval:   -3,
+		Duration:           time.Minute,
+	}, nil)
+	c.genConn = conn
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	best, err := c.discover(ctx, conn)
+	require.NoError(t, err)
+	require.Equal(t, "192.0.2.1", best.Address)
+
+	// silent master is queried every query interval until timeout
+	requests := 0
+	for _, s := range conn.sent {
+		if s.addr.IP.String() == "192.0.2.4" {
+			requests++
+		}
+	}
+	require.Greater(t, requests, 2)
+}
+
+func TestDiscoverNoActiveMaster(t *testing.T) {
+	conn := newDiscoveryConn(map[string]*ptp.Announce{
+		"192.0.2.3": discoveryAnnounce(6, ptp.FlagAlternateMaster),
+	})
+	c := New(&Config{
+		UnicastMasterTable: []string{"192.0.2.3", "192.0.2.5"},
+		LogQueryInterval:   -3,
+		Duration:           time.Minute,
+	}, nil)
+	c.genConn = conn
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := c.discover(ctx, conn)
+	require.Error(t, err)
+	require.Equal(t, []string{"192.0.2.3"}, conn.cancelled())
+}
+
+func TestBestMaster(t *testing.T) {
+	require.Nil(t, bestMaster(nil))
+	a := &Master{Address: "a", Granted: true, Announce: discoveryAnnounce(6, 0)}
+	b := &Master{Address: "b", Granted: true, Announce: discoveryAnnounce(6, 0)}
+	// ties are won by the earlier entry
+	require.Equal(t, a, bestMaster([]*Master{a, b}))
+	require.Equal(t, b, bestMaster([]*Master{b, a}))
+	notGranted := &Master{Address: "c", Announce: discoveryAnnounce(5, 0)}
+	require.Equal(t, a, bestMaster([]*Master{notGranted, a}))
+}
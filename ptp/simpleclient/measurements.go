@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/facebook/time/timestamp"
 )
 
 // mDataSync is a single measured raw data of GM to OC communication
@@ -46,6 +48,12 @@ type MeasurementResult struct {
 	ServerToClientDiff time.Duration
 	ClientToServerDiff time.Duration
 	Timestamp          time.Time
+	// SyncSequenceID is the sequence ID of the Sync the measurement is based on
+	SyncSequenceID uint16
+	// Transport the measurement was taken over. Anything but UDP is monitoring grade only
+	Transport string
+	// Clocks are system clock readings taken when the measurement was completed
+	Clocks timestamp.ClockReadings
 }
 
 // measurements abstracts away tracking and calculation of various packet timestamps
@@ -149,6 +157,7 @@ func (m *measurements) latest() (*MeasurementResult, error) {
 		ServerToClientDiff: serverToClientDiff,
 		ClientToServerDiff: clientToServerDiff,
 		Timestamp:          lastClientToServer.t4,
+		SyncSequenceID:     lastServerToClient.seq,
 	}, nil
 }
 
@@ -54,6 +54,7 @@ func TestMeasurementsFullRun(t *testing.T) {
 			ClientToServerDiff: netDelayBack,
 			Offset:             0,
 			Timestamp:          timeLastPacket,
+			SyncSequenceID:     syncSeq,
 		}
 		assert.Equal(t, want, got)
 	})
@@ -84,6 +85,7 @@ func TestMeasurementsFullRun(t *testing.T) {
 			ClientToServerDiff: netDelayBack,
 			Offset:             -100 * time.Millisecond,
 			Timestamp:          timeLastPacket,
+			SyncSequenceID:     syncSeq,
 		}
 		assert.Equal(t, want, got)
 	})
@@ -116,6 +118,7 @@ func TestMeasurementsFullRun(t *testing.T) {
 			ClientToServerDiff: netDelayBack - netCorrectionBack,
 			Offset:             -100001 * time.Microsecond,
 			Timestamp:          timeLastPacket,
+			SyncSequenceID:     syncSeq,
 		}
 		assert.Equal(t, want, got)
 	})
@@ -57,6 +57,49 @@ func reqUnicast(clockID ptp.ClockIdentity, duration time.Duration, what ptp.Mess
 	}
 }
 
+// reqUnicast builds the ptp.RequestUnicastTransmission of the client, with the grant hint if configured
+func (c *Client) reqUnicast(what ptp.MessageType) *ptp.Signaling {
+	req := reqUnicast(c.clockID, c.cfg.Duration, what)
+	if c.cfg.GrantHint != nil {
+		tlv := c.cfg.GrantHint.TLV()
+		req.TLVs = append(req.TLVs, tlv)
+		req.MessageLength += uint16(binary.Size(ptp.TLVHead{})) + tlv.LengthField
+	}
+	return req
+}
+
+// reqCancelUnicast is a helper to build ptp.CancelUnicastTransmission
+func reqCancelUnicast(clockID ptp.ClockIdentity, what ptp.MessageType) *ptp.Signaling {
+	l := binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.CancelUnicastTransmissionTLV{})
+	return &ptp.Signaling{
+		Header: ptp.Header{
+			SdoIDAndMsgType: ptp.NewSdoIDAndMsgType(ptp.MessageSignaling, 0),
+			Version:         ptp.Version,
+			SequenceID:      0, // will be populated on sending
+			MessageLength:   uint16(l),
+			FlagField:       ptp.FlagUnicast,
+			SourcePortIdentity: ptp.PortIdentity{
+				PortNumber:    1,
+				ClockIdentity: clockID,
+			},
+			LogMessageInterval: 0x7f,
+		},
+		TargetPortIdentity: ptp.PortIdentity{
+			PortNumber:    0xffff,
+			ClockIdentity: 0xffffffffffffffff,
+		},
+		TLVs: []ptp.TLV{
+			&ptp.CancelUnicastTransmissionTLV{
+				TLVHead: ptp.TLVHead{
+					TLVType:     ptp.TLVCancelUnicastTransmission,
+					LengthField: uint16(binary.Size(ptp.CancelUnicastTransmissionTLV{}) - binary.Size(ptp.TLVHead{})),
+				},
+				MsgTypeAndFlags: ptp.NewUnicastMsgTypeAndFlags(what, 0),
+			},
+		},
+	}
+}
+
 // reqAckCancelUnicast is a helper to build ptp.AcknowledgeCancelUnicastTransmission
 func reqAckCancelUnicast(clockID ptp.ClockIdentity, what ptp.MessageType) *ptp.Signaling {
 	l := binary.Size(ptp.Header{}) + binary.Size(ptp.PortIdentity{}) + binary.Size(ptp.AcknowledgeCancelUnicastTransmissionTLV{})
@@ -0,0 +1,118 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simpleclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+)
+
+// supported transports
+const (
+	// TransportUDP is a regular PTP over UDP
+	TransportUDP = "udp"
+	// TransportTCP is an experimental PTP over TCP with reduced accuracy
+	TransportTCP = "tcp"
+	// TransportTLS is an experimental PTP over TLS with reduced accuracy
+	TransportTLS = "tls"
+)
+
+// streamConn carries all PTP messages over a single TCP or TLS connection.
+// It's timestamped in user space on both ends, so results are monitoring grade only
+type streamConn struct {
+	net.Conn
+}
+
+// ReadFromUDP reads a single PTP message from the stream
+func (c *streamConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	n, err := ptp.ReadStreamPacket(c.Conn, b)
+	return n, nil, err
+}
+
+// WriteTo writes a single PTP message to the stream. Address is ignored
+func (c *streamConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	if err := ptp.WriteStreamPacket(c.Conn, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// WriteToWithTS writes a single PTP message to the stream and returns the time it was handed to the kernel
+func (c *streamConn) WriteToWithTS(b []byte, addr net.Addr) (int, time.Time, error) {
+	n, err := c.WriteTo(b, addr)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return n, time.Now(), nil
+}
+
+// setupStream connects to the server over TCP or TLS and starts the receiver
+func (c *Client) setupStream(ctx context.Context, eg *errgroup.Group) error {
+	log.Warningf("using experimental PTP over %s transport. Measurements have reduced accuracy and are for monitoring only", c.cfg.Transport)
+	addr := net.JoinHostPort(c.cfg.Address, strconv.Itoa(c.cfg.Port))
+	d := &net.Dialer{Timeout: c.cfg.Timeout}
+	var conn net.Conn
+	var err error
+	switch c.cfg.Transport {
+	case TransportTCP:
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	case TransportTLS:
+		conn, err = tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: c.cfg.Address, InsecureSkipVerify: c.cfg.InsecureTLS})
+	default:
+		return fmt.Errorf("unknown transport: %q", c.cfg.Transport)
+	}
+	if err != nil {
+		return err
+	}
+	sc := &streamConn{conn}
+	c.genConn = sc
+	c.eventConn = sc
+
+	eg.Go(func() error {
+		// it's done in non-blocking way, so if context is cancelled we exit correctly
+		doneChan := make(chan error, 1)
+		go func() {
+			for {
+				response := make([]uint8, 1024)
+				n, _, err := sc.ReadFromUDP(response)
+				if err != nil {
+					doneChan <- err
+					return
+				}
+				// no kernel timestamps here, take the time right after read
+				c.inChan <- &inPacket{data: response[:n], ts: time.Now()}
+			}
+		}()
+		select {
+		case <-ctx.Done():
+			log.Debugf("cancelled stream receiver")
+			return ctx.Err()
+		case err = <-doneChan:
+			return err
+		}
+	})
+	return nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simpleclient
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamConn(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	ca := &streamConn{a}
+	cb := &streamConn{b}
+
+	go func() {
+		_, _, _ = ca.WriteToWithTS([]byte{1, 2, 3}, nil)
+	}()
+	buf := make([]byte, 16)
+	n, addr, err := cb.ReadFromUDP(buf)
+	require.NoError(t, err)
+	require.Nil(t, addr)
+	require.Equal(t, []byte{1, 2, 3}, buf[:n])
+
+	go func() {
+		_, _, _ = cb.ReadFromUDP(buf)
+	}()
+	n, ts, err := ca.WriteToWithTS([]byte{4, 5}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.WithinDuration(t, time.Now(), ts, time.Second)
+}
+
+func TestConfigTransport(t *testing.T) {
+	require.Equal(t, TransportUDP, (&Config{}).transport())
+	require.Equal(t, TransportTLS, (&Config{Transport: TransportTLS}).transport())
+}
@@ -102,7 +102,10 @@ func Dscmp(a *ptp.Announce, b *ptp.Announce) ComparisonResult {
 	return BBetter
 }
 
-// TelcoDscmp Dscmp finds better Announce based on Announce response content and local priorities
+// TelcoDscmp Dscmp finds better Announce based on Announce response content and local priorities.
+// Unlike G.8275.2 it honors priority1 after clock class and accuracy, so operators can prefer
+// one of the GMs of the same quality by announcing lower priority1 without overriding a better clock.
+// GMs announcing the default priority1 of 128 compare as in G.8275.2.
 func TelcoDscmp(a *ptp.Announce, b *ptp.Announce, localPrioA int, localPrioB int) ComparisonResult {
 	if a.AnnounceBody == b.AnnounceBody {
 		return Unknown
@@ -126,6 +129,12 @@ func TelcoDscmp(a *ptp.Announce, b *ptp.Announce, localPrioA int, localPrioB int
 	if a.AnnounceBody.GrandmasterClockQuality.ClockAccuracy > b.AnnounceBody.GrandmasterClockQuality.ClockAccuracy {
 		return BBetter
 	}
+	if a.AnnounceBody.GrandmasterPriority1 < b.AnnounceBody.GrandmasterPriority1 {
+		return ABetter
+	}
+	if a.AnnounceBody.GrandmasterPriority1 > b.AnnounceBody.GrandmasterPriority1 {
+		return BBetter
+	}
 	if a.AnnounceBody.GrandmasterClockQuality.OffsetScaledLogVariance < b.AnnounceBody.GrandmasterClockQuality.OffsetScaledLogVariance {
 		return ABetter
 	}
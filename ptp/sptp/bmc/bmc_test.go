@@ -98,8 +98,12 @@ func TestTelcoDscmp(t *testing.T) {
 	a10 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority2: 2}}
 	a11 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: 128}}}
 	a12 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: 128}}}
-	lp1 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 1}}
-	lp2 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 2}}
+	lp1 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 128}}
+	lp2 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 128}}
+	p1 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 127, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass7}}}
+	p2 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 128, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass6}}}
+	q1 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 1, GrandmasterPriority1: 127, GrandmasterPriority2: 128, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass6, OffsetScaledLogVariance: 69}}}
+	q2 := ptp.Announce{AnnounceBody: ptp.AnnounceBody{GrandmasterIdentity: 2, GrandmasterPriority1: 128, GrandmasterPriority2: 1, GrandmasterClockQuality: ptp.ClockQuality{ClockClass: ptp.ClockClass6, OffsetScaledLogVariance: 42}}}
 	require.Equal(t, TelcoDscmp(&a1, &a2, 1, 2), Unknown)
 	require.Equal(t, TelcoDscmp(&a3, &a4, 1, 2), ABetter)
 	require.Equal(t, TelcoDscmp(&a4, &a3, 1, 2), BBetter)
@@ -113,4 +117,10 @@ func TestTelcoDscmp(t *testing.T) {
 	require.Equal(t, TelcoDscmp(&a12, &a11, 1, 1), BBetter)
 	require.Equal(t, TelcoDscmp(&lp1, &lp2, 1, 2), ABetter)
 	require.Equal(t, TelcoDscmp(&lp1, &lp2, 2, 1), BBetter)
+	// better clock class wins over priority1
+	require.Equal(t, TelcoDscmp(&p1, &p2, 2, 1), BBetter)
+	require.Equal(t, TelcoDscmp(&p2, &p1, 1, 2), ABetter)
+	// priority1 wins over variance, priority2 and the local priority of the GMs of the same class and accuracy
+	require.Equal(t, TelcoDscmp(&q1, &q2, 2, 1), ABetter)
+	require.Equal(t, TelcoDscmp(&q2, &q1, 1, 2), BBetter)
 }
@@ -42,6 +42,8 @@ const (
 	HWTIMESTAMP = timestamp.HWTIMESTAMP
 	// SWTIMESTAMP is a software timestamp
 	SWTIMESTAMP = timestamp.SWTIMESTAMP
+	// VIRTUALTIMESTAMP is a software timestamp measured against the virtual PHC
+	VIRTUALTIMESTAMP = timestamp.VIRTUALTIMESTAMP
 )
 
 // UDPConn describes what functionality we expect from UDP connection
@@ -61,6 +63,8 @@ type UDPConnWithTS interface {
 type udpConnTS struct {
 	*net.UDPConn
 	l sync.Mutex
+	// correction of the NIC model specific timestamp latencies
+	correction timestamp.Correction
 }
 
 func newUDPConnTS(conn *net.UDPConn) *udpConnTS {
@@ -85,7 +89,7 @@ func (c *udpConnTS) WriteToWithTS(b []byte, addr net.Addr) (int, time.Time, erro
 	if err != nil {
 		return 0, time.Time{}, fmt.Errorf("failed to get timestamp of last packet: %w", err)
 	}
-	return n, hwts, nil
+	return n, c.correction.TXTimestamp(hwts), nil
 }
 
 func (c *udpConnTS) ReadPacketWithRXTimestamp() ([]byte, unix.Sockaddr, time.Time, error) {
@@ -94,7 +98,11 @@ func (c *udpConnTS) ReadPacketWithRXTimestamp() ([]byte, unix.Sockaddr, time.Tim
 	if err != nil {
 		return nil, nil, time.Time{}, fmt.Errorf("failed to get conn fd udp connection: %w", err)
 	}
-	return timestamp.ReadPacketWithRXTimestamp(connFd)
+	b, sa, rxts, err := timestamp.ReadPacketWithRXTimestamp(connFd)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	return b, sa, c.correction.RXTimestamp(rxts), nil
 }
 
 // corrToDuration converts PTP CorrectionField to time.Duration, ignoring
@@ -293,6 +301,9 @@ func (c *Client) RunOnce(ctx context.Context, timeout time.Duration) *RunResult
 						return err
 					}
 				} else {
+					if latest.Clocks, err = timestamp.ReadClocks(); err != nil {
+						return fmt.Errorf("reading system clocks: %w", err)
+					}
 					log.Debugf("latest measurement: %+v", latest)
 					c.m.cleanup(latest.Timestamp, time.Minute)
 					result.Measurement = latest
@@ -114,6 +114,8 @@ func TestClientRun(t *testing.T) {
 	require.NotEqual(t, 0, runResult.Measurement.ServerToClientDiff)
 	require.NotEqual(t, 0, runResult.Measurement.ClientToServerDiff)
 	require.False(t, runResult.Measurement.Timestamp.IsZero())
+	require.False(t, runResult.Measurement.Clocks.Wallclock.IsZero())
+	require.NotZero(t, runResult.Measurement.Clocks.MonotonicRaw)
 }
 
 func TestClientTimeout(t *testing.T) {
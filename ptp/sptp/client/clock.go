@@ -47,6 +47,17 @@ func NewPHC(iface string) (*PHC, error) {
 	}, nil
 }
 
+// NewVirtualPHC creates PHC device abstraction for the virtual PHC exposed by the hypervisor
+func NewVirtualPHC() (*PHC, error) {
+	device, err := phc.VirtualDevice()
+	if err != nil {
+		return nil, err
+	}
+	return &PHC{
+		devicePath: device,
+	}, nil
+}
+
 // AdjFreqPPB adjusts PHC frequency
 func (p *PHC) AdjFreqPPB(freq float64) error {
 	return phc.ClockAdjFreq(p.devicePath, freq)
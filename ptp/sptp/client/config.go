@@ -20,6 +20,7 @@ import (
 	"os"
 	"time"
 
+	ptp4ustats "github.com/facebook/time/ptp/ptp4u/stats"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -31,9 +32,16 @@ type MeasurementConfig struct {
 	PathDelayDiscardBelow         time.Duration `yaml:"path_delay_discard_below"`          // discard path delays that are below this threshold
 }
 
+// FailbackConfig describes when we switch to a better GM while the current one is still usable
+type FailbackConfig struct {
+	Hysteresis    time.Duration `yaml:"hysteresis"`     // how long a GM has to stay the best before we fail back to it. 0 fails back immediately
+	QualityMargin int           `yaml:"quality_margin"` // minimum clock accuracy improvement to fail back unless the GM has better clock class. 0 disables the check
+}
+
 // Config specifies PTPNG run options
 type Config struct {
 	Iface                    string
+	ListenIP                 string // IP to listen on, any if empty. Has to differ from the IPs of ptp4u on the same host
 	Timestamping             string
 	MonitoringPort           int
 	Interval                 time.Duration
@@ -41,7 +49,11 @@ type Config struct {
 	FirstStepThreshold       time.Duration
 	Servers                  map[string]int
 	Measurement              MeasurementConfig
+	Failback                 FailbackConfig
 	MetricsAggregationWindow time.Duration
+	QuirksFile               string
+	MonitoringBackend        string                  // json, prometheus or statsd, same as ptp4u. JSON is always served
+	StatsD                   ptp4ustats.StatsDConfig // agent to push to with statsd backend
 }
 
 // ReadConfig reads config from the file
@@ -21,27 +21,56 @@ import (
 	"fmt"
 	"net/http"
 
+	ptp4ustats "github.com/facebook/time/ptp/ptp4u/stats"
 	log "github.com/sirupsen/logrus"
 )
 
 // JSONStats is what we want to report as stats via http
 type JSONStats struct {
 	Stats
+	exporter   *ptp4ustats.Exporter
+	prometheus bool
 }
 
 // NewJSONStats returns a new JSONStats
 func NewJSONStats() *JSONStats {
-	return &JSONStats{Stats: *NewStats()}
+	s := &JSONStats{Stats: *NewStats()}
+	s.exporter = ptp4ustats.NewExporter(metricsNamespace, s.collect)
+	return s
 }
 
-// Start runs http server and initializes maps
-func (s *JSONStats) Start(monitoringport int) {
+// SetBackend exports the stats through the ptp4u monitoring backend on top of the JSON served on / and /counters.
+// Prometheus backend serves them on /metrics, statsd backend pushes them to the agent
+func (s *JSONStats) SetBackend(backend string, statsd ptp4ustats.StatsDConfig) error {
+	switch backend {
+	case "", ptp4ustats.BackendJSON:
+		return nil
+	case ptp4ustats.BackendPrometheus:
+		s.prometheus = true
+		return nil
+	case ptp4ustats.BackendStatsD:
+		return s.exporter.PushStatsD(statsd)
+	default:
+		return fmt.Errorf("unsupported monitoring backend %q", backend)
+	}
+}
+
+// Handler returns the handler serving the stats, so they can be served on the monitoring port of another daemon
+func (s *JSONStats) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleRootRequest)
 	mux.HandleFunc("/counters", s.handleCountersRequest)
+	if s.prometheus {
+		mux.Handle("/metrics", s.exporter)
+	}
+	return mux
+}
+
+// Start runs http server and initializes maps
+func (s *JSONStats) Start(monitoringport int) {
 	addr := fmt.Sprintf(":%d", monitoringport)
 	log.Infof("Starting http json server on %s", addr)
-	err := http.ListenAndServe(addr, mux)
+	err := http.ListenAndServe(addr, s.Handler())
 	if err != nil {
 		log.Fatalf("Failed to start listener: %v", err)
 	}
@@ -25,6 +25,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	ptp "github.com/facebook/time/ptp/protocol"
+	"github.com/facebook/time/timestamp"
 )
 
 var errNotEnoughData = fmt.Errorf("not enough data")
@@ -78,6 +79,8 @@ type MeasurementResult struct {
 	CorrectionFieldTX  time.Duration
 	Timestamp          time.Time
 	Announce           ptp.Announce
+	// Clocks are system clock readings taken when the measurement was completed
+	Clocks timestamp.ClockReadings
 }
 
 // measurements abstracts away tracking and calculation of various packet timestamps
@@ -0,0 +1,149 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ptp4ustats "github.com/facebook/time/ptp/ptp4u/stats"
+	gmstats "github.com/facebook/time/ptp/sptp/stats"
+)
+
+// namespace of the sptp metrics exported through the ptp4u backends
+const metricsNamespace = "sptp"
+
+// nanoseconds per second, as Prometheus expects durations in seconds
+const nsPerSecond = float64(time.Second)
+
+// counterMetric describes how a counter of the client is exported
+type counterMetric struct {
+	name string
+	help string
+	// divisor converts the counter to the base unit of the metric
+	divisor float64
+}
+
+// counterMetrics are the counters with well known names.
+// All the other counters are exported as gauges named after the counter
+var counterMetrics = map[string]counterMetric{
+	"sptp.offset_ns":          {"sptp_offset_seconds", "Offset from the best master", nsPerSecond},
+	"sptp.mean_path_delay_ns": {"sptp_mean_path_delay_seconds", "Mean path delay to the best master", nsPerSecond},
+	"sptp.servo.state":        {"sptp_servo_state", "Servo state, 0 init, 1 jump, 2 locked, 3 filter", 1},
+	"sptp.servo.freq_adj_ppb": {"sptp_servo_freq_adj_ppb", "Frequency adjustment applied by the servo", 1},
+}
+
+// gmSwitches are the counters of best master switches by reason
+var gmSwitches = map[string]string{
+	"sptp.failover": "failover",
+	"sptp.failback": "failback",
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// boolToFloat returns 1 for true and 0 for false
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// collect writes the stats as metric families following the ptp4u naming conventions
+func (s *Stats) collect(w *ptp4ustats.MetricWriter) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	servers := make([]string, 0, len(s.gmStats))
+	for server := range s.gmStats {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	gauge := func(name, help string, value func(gm *gmstats.Stats) float64) {
+		w.Family(name, "gauge", help)
+		for _, server := range servers {
+			w.Sample(name, value(s.gmStats[server]), "server", server)
+		}
+	}
+	gauge("sptp_gm_present", "Whether the GM replied to the last exchange", func(gm *gmstats.Stats) float64 { return float64(gm.GMPresent) })
+	gauge("sptp_gm_selected", "Whether the GM is the best master", func(gm *gmstats.Stats) float64 { return boolToFloat(gm.Selected) })
+	gauge("sptp_gm_offset_seconds", "Offset from the GM measured by the last exchange", func(gm *gmstats.Stats) float64 { return gm.Offset / nsPerSecond })
+	gauge("sptp_gm_mean_path_delay_seconds", "Mean path delay to the GM", func(gm *gmstats.Stats) float64 { return gm.MeanPathDelay / nsPerSecond })
+	gauge("sptp_gm_clock_class", "Clock class announced by the GM", func(gm *gmstats.Stats) float64 { return float64(gm.ClockQuality.ClockClass) })
+	gauge("sptp_gm_clock_accuracy", "Clock accuracy announced by the GM", func(gm *gmstats.Stats) float64 { return float64(gm.ClockQuality.ClockAccuracy) })
+	gauge("sptp_gm_steps_removed", "Steps removed announced by the GM", func(gm *gmstats.Stats) float64 { return float64(gm.StepsRemoved) })
+
+	keys := sortedKeys(s.counters)
+	w.Family("sptp_gm_exchanges_total", "counter", "Exchanges with the GM by outcome")
+	for _, k := range keys {
+		if !strings.HasPrefix(k, gmCounterPrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, gmCounterPrefix)
+		i := strings.LastIndex(rest, ".")
+		if i < 0 {
+			continue
+		}
+		w.Sample("sptp_gm_exchanges_total", float64(s.counters[k]), "server", rest[:i], "outcome", rest[i+1:])
+	}
+	for _, port := range []struct{ prefix, name, help string }{
+		{gmstats.PortStatsRxPrefix, "sptp_rx_messages_total", "Received PTP messages"},
+		{gmstats.PortStatsTxPrefix, "sptp_tx_messages_total", "Sent PTP messages"},
+	} {
+		w.Family(port.name, "counter", port.help)
+		for _, k := range keys {
+			if strings.HasPrefix(k, port.prefix) {
+				w.Sample(port.name, float64(s.counters[k]), "message_type", strings.TrimPrefix(k, port.prefix))
+			}
+		}
+	}
+	w.Family("sptp_gm_switches_total", "counter", "Switches of the best master by reason")
+	for _, k := range keys {
+		if reason, ok := gmSwitches[k]; ok {
+			w.Sample("sptp_gm_switches_total", float64(s.counters[k]), "reason", reason)
+		}
+	}
+
+	for _, k := range keys {
+		if strings.HasPrefix(k, gmCounterPrefix) || strings.HasPrefix(k, gmstats.PortStatsRxPrefix) || strings.HasPrefix(k, gmstats.PortStatsTxPrefix) {
+			continue
+		}
+		if _, ok := gmSwitches[k]; ok {
+			continue
+		}
+		m, ok := counterMetrics[k]
+		if !ok {
+			m = counterMetric{
+				name:    metricsNamespace + "_" + strings.ReplaceAll(strings.TrimPrefix(k, metricsNamespace+"."), ".", "_"),
+				help:    fmt.Sprintf("SPTP counter %s", k),
+				divisor: 1,
+			}
+		}
+		w.Family(m.name, "gauge", m.help)
+		w.Sample(m.name, float64(s.counters[k])/m.divisor)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	ptp "github.com/facebook/time/ptp/protocol"
+	ptp4ustats "github.com/facebook/time/ptp/ptp4u/stats"
+	gmstats "github.com/facebook/time/ptp/sptp/stats"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultOutcome(t *testing.T) {
+	require.Equal(t, outcomeMeasurement, resultOutcome(&RunResult{Measurement: &MeasurementResult{}}))
+	require.Equal(t, outcomeError, resultOutcome(&RunResult{}))
+	require.Equal(t, outcomeError, resultOutcome(&RunResult{Error: errors.New("boom")}))
+	require.Equal(t, outcomeAnnounceTimeout, resultOutcome(&RunResult{Error: context.DeadlineExceeded}))
+}
+
+func TestStatsMetrics(t *testing.T) {
+	s := NewJSONStats()
+	s.SetGMStats("192.168.0.10", &gmstats.Stats{
+		GMPresent:     1,
+		Selected:      true,
+		Offset:        1500,
+		MeanPathDelay: 250000,
+		ClockQuality:  ptp.ClockQuality{ClockClass: ptp.ClockClass6, ClockAccuracy: ptp.ClockAccuracyNanosecond100},
+		StepsRemoved:  1,
+	})
+	s.UpdateCounterBy(gmCounter("192.168.0.10", outcomeMeasurement), 3)
+	s.UpdateCounterBy(gmCounter("192.168.0.10", outcomeAnnounceTimeout), 1)
+	s.SetCounter(gmstats.PortStatsRxPrefix+"sync", 4)
+	s.SetCounter(gmstats.PortStatsTxPrefix+"delay_req", 5)
+	s.UpdateCounterBy("sptp.failover", 2)
+	s.SetCounter("sptp.offset_ns", -2000)
+	s.SetCounter("sptp.servo.state", 2)
+	s.SetCounter("sptp.gms.total", 1)
+	require.NoError(t, s.SetBackend(ptp4ustats.BackendPrometheus, ptp4ustats.StatsDConfig{}))
+
+	rec := httptest.NewRecorder()
+	s.exporter.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	out := string(body)
+	for _, want := range []string{
+		"# TYPE sptp_gm_present gauge\nsptp_gm_present{server=\"192.168.0.10\"} 1\n",
+		"sptp_gm_selected{server=\"192.168.0.10\"} 1\n",
+		"sptp_gm_offset_seconds{server=\"192.168.0.10\"} 1.5e-06\n",
+		"sptp_gm_mean_path_delay_seconds{server=\"192.168.0.10\"} 0.00025\n",
+		"sptp_gm_clock_class{server=\"192.168.0.10\"} 6\n",
+		"# TYPE sptp_gm_exchanges_total counter\n",
+		"sptp_gm_exchanges_total{server=\"192.168.0.10\",outcome=\"announce_timeout\"} 1\n",
+		"sptp_gm_exchanges_total{server=\"192.168.0.10\",outcome=\"measured\"} 3\n",
+		"sptp_rx_messages_total{message_type=\"sync\"} 4\n",
+		"sptp_tx_messages_total{message_type=\"delay_req\"} 5\n",
+		"sptp_gm_switches_total{reason=\"failover\"} 2\n",
+		"sptp_offset_seconds -2e-06\n",
+		"sptp_servo_state 2\n",
+		"# TYPE sptp_gms_total gauge\nsptp_gms_total 1\n",
+	} {
+		require.Contains(t, out, want)
+	}
+}
+
+func TestStatsSetBackend(t *testing.T) {
+	s := NewJSONStats()
+	require.NoError(t, s.SetBackend("", ptp4ustats.StatsDConfig{}))
+	require.False(t, s.prometheus)
+	require.Error(t, s.SetBackend(ptp4ustats.BackendStatsD, ptp4ustats.StatsDConfig{}))
+	require.Error(t, s.SetBackend("influx", ptp4ustats.StatsDConfig{}))
+}
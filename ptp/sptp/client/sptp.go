@@ -49,8 +49,13 @@ type SPTP struct {
 	stats StatsServer
 
 	phc PHCIface
+	// sysoff reads offset between sys clock and the virtual PHC. Set in virtual mode only
+	sysoff func() (phc.SysoffResult, error)
 
 	bestGM string
+	// GM we may fail back to once hysteresis passes, and since when it's the best
+	failbackGM    string
+	failbackSince time.Time
 
 	clients    map[string]*Client
 	priorities map[string]int
@@ -98,13 +103,20 @@ func (p *SPTP) init() error {
 	p.clockID = cid
 
 	// bind to general port
-	genConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: ptp.PortGeneral})
+	listenIP := net.ParseIP("::")
+	if p.cfg.ListenIP != "" {
+		listenIP = net.ParseIP(p.cfg.ListenIP)
+		if listenIP == nil {
+			return fmt.Errorf("invalid listen IP %q", p.cfg.ListenIP)
+		}
+	}
+	genConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: listenIP, Port: ptp.PortGeneral})
 	if err != nil {
 		return err
 	}
 	p.genConn = genConn
 	// bind to event port
-	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("::"), Port: ptp.PortEvent})
+	eventConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: listenIP, Port: ptp.PortEvent})
 	if err != nil {
 		return err
 	}
@@ -122,6 +134,7 @@ func (p *SPTP) init() error {
 	}
 
 	// we need to enable HW or SW timestamps on event port
+	hwts := false
 	switch p.cfg.Timestamping {
 	case "": // auto-detection
 		if err = timestamp.EnableHWTimestamps(connFd, p.cfg.Iface); err != nil {
@@ -131,15 +144,21 @@ func (p *SPTP) init() error {
 			log.Warningf("Failed to enable hardware timestamps on port %d, falling back to software timestamps", ptp.PortEvent)
 		} else {
 			log.Infof("Using hardware timestamps")
+			hwts = true
 		}
 	case HWTIMESTAMP:
 		if err = timestamp.EnableHWTimestamps(connFd, p.cfg.Iface); err != nil {
 			return fmt.Errorf("failed to enable hardware timestamps on port %d: %w", ptp.PortEvent, err)
 		}
+		hwts = true
 	case SWTIMESTAMP:
 		if err = timestamp.EnableSWTimestamps(connFd); err != nil {
 			return fmt.Errorf("failed to enable software timestamps on port %d: %w", ptp.PortEvent, err)
 		}
+	case VIRTUALTIMESTAMP:
+		if err = timestamp.EnableSWTimestamps(connFd); err != nil {
+			return fmt.Errorf("failed to enable software timestamps on port %d: %w", ptp.PortEvent, err)
+		}
 	default:
 		return fmt.Errorf("unknown type of typestamping: %q", p.cfg.Timestamping)
 	}
@@ -147,11 +166,37 @@ func (p *SPTP) init() error {
 	if err = unix.SetNonblock(connFd, false); err != nil {
 		return fmt.Errorf("failed to set event socket to blocking: %w", err)
 	}
-	p.eventConn = newUDPConnTS(eventConn)
+	conn := newUDPConnTS(eventConn)
+	// NIC quirks only apply to the hardware timestamps
+	if hwts && p.cfg.QuirksFile != "" {
+		quirks, err := timestamp.ReadQuirks(p.cfg.QuirksFile)
+		if err != nil {
+			return fmt.Errorf("reading NIC quirks: %w", err)
+		}
+		correction, nic, err := timestamp.CorrectionFor(p.cfg.Iface, quirks)
+		if err != nil {
+			return err
+		}
+		log.Infof("NIC %s (driver %s, firmware %s, device %s) timestamp correction: RX %v, TX %v", p.cfg.Iface, nic.Driver, nic.Firmware, nic.Device, correction.RX, correction.TX)
+		conn.correction = correction
+	}
+	p.eventConn = conn
 
-	phcDev, err := NewPHC(p.cfg.Iface)
-	if err != nil {
-		return err
+	var phcDev *PHC
+	if p.cfg.Timestamping == VIRTUALTIMESTAMP {
+		phcDev, err = NewVirtualPHC()
+		if err != nil {
+			return fmt.Errorf("virtual timestamping requires ptp_kvm or ptp_vmw: %w", err)
+		}
+		log.Infof("Using virtual PHC %s", phcDev.devicePath)
+		p.sysoff = func() (phc.SysoffResult, error) {
+			return phc.TimeAndOffsetFromDevice(phcDev.devicePath, phc.MethodSyscallClockGettime)
+		}
+	} else {
+		phcDev, err = NewPHC(p.cfg.Iface)
+		if err != nil {
+			return err
+		}
 	}
 	p.phc = phcDev
 
@@ -258,6 +303,7 @@ func (p *SPTP) processResults(results map[string]*RunResult) {
 	for addr, res := range results {
 		s := runResultToStats(res, p.priorities[addr], addr == p.bestGM)
 		p.stats.SetGMStats(addr, s)
+		p.stats.UpdateCounterBy(gmCounter(addr, resultOutcome(res)), 1)
 		if res.Error == nil {
 			log.Debugf("result %s: %+v", addr, res.Measurement)
 		} else {
@@ -284,7 +330,7 @@ func (p *SPTP) processResults(results map[string]*RunResult) {
 		log.Warningf("no Best Master selected")
 		return
 	}
-	bestAddr := idsToClients[best.GrandmasterIdentity]
+	bestAddr := p.selectGM(idsToClients[best.GrandmasterIdentity], results)
 	bm := results[bestAddr].Measurement
 	if p.bestGM != bestAddr {
 		log.Warningf("new best master selected: %q (%s)", bestAddr, bm.Announce.GrandmasterIdentity)
@@ -292,8 +338,16 @@ func (p *SPTP) processResults(results map[string]*RunResult) {
 	}
 
 	log.Infof("best master: %v, offset: %v, delay: %v", bestAddr, bm.Offset, bm.Delay)
+	p.stats.SetCounter("sptp.offset_ns", int64(bm.Offset))
+	p.stats.SetCounter("sptp.mean_path_delay_ns", int64(bm.Delay))
+	if p.sysoff != nil {
+		p.processVirtual(bm.Offset)
+		return
+	}
 	freqAdj, state := p.pi.Sample(int64(bm.Offset), uint64(bm.Timestamp.UnixNano()))
 	log.Infof("freqAdj: %v, state: %s(%d)", freqAdj, state, state)
+	p.stats.SetCounter("sptp.servo.state", int64(state))
+	p.stats.SetCounter("sptp.servo.freq_adj_ppb", int64(freqAdj))
 	switch state {
 	case servo.StateJump:
 		if err := p.phc.Step(-1 * bm.Offset); err != nil {
@@ -306,40 +360,107 @@ func (p *SPTP) processResults(results map[string]*RunResult) {
 	}
 }
 
+// selectGM applies failover/failback policy to the GM selected by BMCA.
+// Failover happens immediately when the current GM becomes unusable or BMCA rejects it
+// for a worse clock class, failback to a better GM is subject to the quality margin and hysteresis
+func (p *SPTP) selectGM(candidate string, results map[string]*RunResult) string {
+	current := p.bestGM
+	if current == "" || current == candidate {
+		p.failbackGM = ""
+		return candidate
+	}
+	res, found := results[current]
+	if !found || res.Error != nil || res.Measurement == nil {
+		log.Warningf("failover from %q to %q", current, candidate)
+		p.stats.UpdateCounterBy("sptp.failover", 1)
+		p.failbackGM = ""
+		return candidate
+	}
+	cur := res.Measurement.Announce.GrandmasterClockQuality
+	cand := results[candidate].Measurement
+	candQ := cand.Announce.GrandmasterClockQuality
+	// current GM lost its lock, holding it for the hysteresis would follow a degraded clock
+	if cur.ClockClass > candQ.ClockClass {
+		log.Warningf("failover from %q to %q: clock class %d is worse than %d", current, candidate, cur.ClockClass, candQ.ClockClass)
+		p.stats.UpdateCounterBy("sptp.failover", 1)
+		p.failbackGM = ""
+		return candidate
+	}
+	if margin := p.cfg.Failback.QualityMargin; margin > 0 && int(cur.ClockAccuracy)-int(candQ.ClockAccuracy) < margin {
+		log.Debugf("not failing back to %q: clock accuracy improvement is below %d", candidate, margin)
+		p.failbackGM = ""
+		return current
+	}
+	if hysteresis := p.cfg.Failback.Hysteresis; hysteresis > 0 {
+		if p.failbackGM != candidate {
+			p.failbackGM = candidate
+			p.failbackSince = cand.Timestamp
+		}
+		if cand.Timestamp.Sub(p.failbackSince) < hysteresis {
+			log.Debugf("not failing back to %q: best for %v only", candidate, cand.Timestamp.Sub(p.failbackSince))
+			return current
+		}
+	}
+	log.Warningf("failback from %q to %q", current, candidate)
+	p.stats.UpdateCounterBy("sptp.failback", 1)
+	p.failbackGM = ""
+	return candidate
+}
+
+// processVirtual reports offset of the hypervisor clock from the best master.
+// Virtual PHC is owned by the host, so nothing is adjusted
+func (p *SPTP) processVirtual(offset time.Duration) {
+	sysoff, err := p.sysoff()
+	if err != nil {
+		log.Errorf("failed to read virtual PHC: %v", err)
+		return
+	}
+	// offset is sys clock - GM, sysoff.Offset is sys clock - virtual PHC
+	virtOffset := offset - sysoff.Offset
+	log.Infof("virtual PHC offset: %v, sys clock to virtual PHC offset: %v", virtOffset, sysoff.Offset)
+	p.stats.SetCounter("sptp.virtual.offset_ns", int64(virtOffset))
+	p.stats.SetCounter("sptp.virtual.sysclock_offset_ns", int64(sysoff.Offset))
+}
+
 func (p *SPTP) runInternal(ctx context.Context, interval time.Duration) error {
 	timeout := 500 * time.Millisecond
 	p.pi.SyncInterval(interval.Seconds())
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
-	var lock sync.Mutex
 	for {
 		select {
 		case <-ctx.Done():
 			log.Debugf("cancelled main loop")
 			return ctx.Err()
 		case <-ticker.C:
-			eg, ctx := errgroup.WithContext(ctx)
-			results := map[string]*RunResult{}
-			for addr, c := range p.clients {
-				addr := addr
-				c := c
-				eg.Go(func() error {
-					res := c.RunOnce(ctx, timeout)
-					lock.Lock()
-					defer lock.Unlock()
-					results[addr] = res
-					return nil
-				})
-			}
-			err := eg.Wait()
-			if err != nil {
-				log.Errorf("run failed: %v", err)
-			}
-			p.processResults(results)
+			p.processResults(p.RunOnce(ctx, timeout))
 		}
 	}
 }
 
+// RunOnce performs a single exchange with all servers simultaneously and returns results by server.
+// It only measures and never steers the clock. RunListener must be running
+func (p *SPTP) RunOnce(ctx context.Context, timeout time.Duration) map[string]*RunResult {
+	var lock sync.Mutex
+	eg, ctx := errgroup.WithContext(ctx)
+	results := map[string]*RunResult{}
+	for addr, c := range p.clients {
+		addr := addr
+		c := c
+		eg.Go(func() error {
+			res := c.RunOnce(ctx, timeout)
+			lock.Lock()
+			defer lock.Unlock()
+			results[addr] = res
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		log.Errorf("run failed: %v", err)
+	}
+	return results
+}
+
 // Run makes things run, continuously
 func (p *SPTP) Run(ctx context.Context, interval time.Duration) error {
 	go func() {
@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/facebook/time/phc"
 	ptp "github.com/facebook/time/ptp/protocol"
 	"github.com/facebook/time/servo"
 
@@ -68,6 +69,7 @@ func TestProcessResultsEmptyResult(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.total", int64(1))
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.available_pct", int64(0))
 	mockStatsServer.EXPECT().SetGMStats("iamthebest", gomock.Any())
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.iamthebest.error", int64(1))
 	p.processResults(results)
 	require.Equal(t, "", p.bestGM)
 }
@@ -87,6 +89,11 @@ func TestProcessResultsSingle(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.total", int64(1))
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.available_pct", int64(100))
 	mockStatsServer.EXPECT().SetGMStats("iamthebest", gomock.Any())
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.iamthebest.measured", int64(1))
+	mockStatsServer.EXPECT().SetCounter("sptp.offset_ns", int64(-200002000))
+	mockStatsServer.EXPECT().SetCounter("sptp.mean_path_delay_ns", int64(299995000))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.state", int64(servo.StateJump))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.freq_adj_ppb", int64(12))
 	p := &SPTP{
 		phc:   mockPHC,
 		pi:    mockServo,
@@ -113,6 +120,50 @@ func TestProcessResultsSingle(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.total", int64(1))
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.available_pct", int64(100))
 	mockStatsServer.EXPECT().SetGMStats("iamthebest", gomock.Any())
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.iamthebest.measured", int64(1))
+	mockStatsServer.EXPECT().SetCounter("sptp.offset_ns", int64(-100001000))
+	mockStatsServer.EXPECT().SetCounter("sptp.mean_path_delay_ns", int64(299995000))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.state", int64(servo.StateLocked))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.freq_adj_ppb", int64(14))
+	p.processResults(results)
+	require.Equal(t, "iamthebest", p.bestGM)
+}
+
+func TestProcessResultsVirtual(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// neither PHC nor servo are touched in virtual mode
+	mockPHC := NewMockPHCIface(ctrl)
+	mockServo := NewMockServo(ctrl)
+	mockStatsServer := NewMockStatsServer(ctrl)
+	mockStatsServer.EXPECT().SetCounter("sptp.gms.total", int64(1))
+	mockStatsServer.EXPECT().SetCounter("sptp.gms.available_pct", int64(100))
+	mockStatsServer.EXPECT().SetGMStats("iamthebest", gomock.Any())
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.iamthebest.measured", int64(1))
+	mockStatsServer.EXPECT().SetCounter("sptp.offset_ns", int64(-200))
+	mockStatsServer.EXPECT().SetCounter("sptp.mean_path_delay_ns", int64(299995000))
+	mockStatsServer.EXPECT().SetCounter("sptp.virtual.offset_ns", int64(-250))
+	mockStatsServer.EXPECT().SetCounter("sptp.virtual.sysclock_offset_ns", int64(50))
+	p := &SPTP{
+		phc:   mockPHC,
+		pi:    mockServo,
+		stats: mockStatsServer,
+		sysoff: func() (phc.SysoffResult, error) {
+			return phc.SysoffResult{Offset: 50}, nil
+		},
+	}
+	results := map[string]*RunResult{
+		"iamthebest": {
+			Server: "iamthebest",
+			Measurement: &MeasurementResult{
+				Delay:     299995 * time.Microsecond,
+				Offset:    -200,
+				Timestamp: ts,
+			},
+		},
+	}
 	p.processResults(results)
 	require.Equal(t, "iamthebest", p.bestGM)
 }
@@ -133,8 +184,15 @@ func TestProcessResultsMulti(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.available_pct", int64(50))
 	mockStatsServer.EXPECT().SetGMStats("iamthebest", gomock.Any())
 	mockStatsServer.EXPECT().SetGMStats("soontobebest", gomock.Any())
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.iamthebest.measured", int64(1))
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.soontobebest.error", int64(1))
+	mockStatsServer.EXPECT().SetCounter("sptp.offset_ns", int64(-200002000))
+	mockStatsServer.EXPECT().SetCounter("sptp.mean_path_delay_ns", int64(299995000))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.state", int64(servo.StateJump))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.freq_adj_ppb", int64(12))
 
 	p := &SPTP{
+		cfg:   &Config{},
 		phc:   mockPHC,
 		pi:    mockServo,
 		stats: mockStatsServer,
@@ -181,6 +239,86 @@ func TestProcessResultsMulti(t *testing.T) {
 	mockStatsServer.EXPECT().SetCounter("sptp.gms.available_pct", int64(100))
 	mockStatsServer.EXPECT().SetGMStats("iamthebest", gomock.Any())
 	mockStatsServer.EXPECT().SetGMStats("soontobebest", gomock.Any())
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.failback", int64(1))
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.iamthebest.measured", int64(1))
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.gm.soontobebest.measured", int64(1))
+	mockStatsServer.EXPECT().SetCounter("sptp.offset_ns", int64(-104002000))
+	mockStatsServer.EXPECT().SetCounter("sptp.mean_path_delay_ns", int64(299995000))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.state", int64(servo.StateLocked))
+	mockStatsServer.EXPECT().SetCounter("sptp.servo.freq_adj_ppb", int64(14))
 	p.processResults(results)
 	require.Equal(t, "soontobebest", p.bestGM)
 }
+
+func TestSelectGM(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStatsServer := NewMockStatsServer(ctrl)
+	p := &SPTP{
+		cfg:    &Config{Failback: FailbackConfig{Hysteresis: time.Minute, QualityMargin: 1}},
+		stats:  mockStatsServer,
+		bestGM: "current",
+	}
+	result := func(accuracy ptp.ClockAccuracy, ts time.Time) *RunResult {
+		a := announcePkt(0)
+		a.GrandmasterClockQuality.ClockClass = ptp.ClockClass6
+		a.GrandmasterClockQuality.ClockAccuracy = accuracy
+		return &RunResult{Measurement: &MeasurementResult{Timestamp: ts, Announce: *a}}
+	}
+
+	// same quality, preferred by priority only
+	results := map[string]*RunResult{
+		"current":   result(ptp.ClockAccuracyNanosecond100, ts),
+		"preferred": result(ptp.ClockAccuracyNanosecond100, ts),
+	}
+	require.Equal(t, "current", p.selectGM("preferred", results))
+
+	// better quality, but hysteresis didn't pass yet
+	results["preferred"] = result(ptp.ClockAccuracyNanosecond25, ts)
+	require.Equal(t, "current", p.selectGM("preferred", results))
+	results["preferred"] = result(ptp.ClockAccuracyNanosecond25, ts.Add(30*time.Second))
+	require.Equal(t, "current", p.selectGM("preferred", results))
+
+	// hysteresis passed
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.failback", int64(1))
+	results["preferred"] = result(ptp.ClockAccuracyNanosecond25, ts.Add(time.Minute))
+	require.Equal(t, "preferred", p.selectGM("preferred", results))
+
+	// current is gone
+	mockStatsServer.EXPECT().UpdateCounterBy("sptp.failover", int64(1))
+	results["current"] = &RunResult{Error: fmt.Errorf("context deadline exceeded")}
+	require.Equal(t, "preferred", p.selectGM("preferred", results))
+}
+
+func TestSelectGMDegraded(t *testing.T) {
+	ts, err := time.Parse(time.RFC3339, "2021-05-21T13:32:05+01:00")
+	require.Nil(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStatsServer := NewMockStatsServer(ctrl)
+	p := &SPTP{
+		cfg:    &Config{Failback: FailbackConfig{Hysteresis: time.Minute, QualityMargin: 1}},
+		stats:  mockStatsServer,
+		bestGM: "current",
+	}
+	result := func(class ptp.ClockClass) *RunResult {
+		a := announcePkt(0)
+		a.GrandmasterClockQuality.ClockClass = class
+		a.GrandmasterClockQuality.ClockAccuracy = ptp.ClockAccuracyNanosecond100
+		return &RunResult{Measurement: &MeasurementResult{Timestamp: ts, Announce: *a}}
+	}
+
+	// current GM is out of holdover spec or runs on the degradation alternative, no hysteresis applies
+	for _, class := range []ptp.ClockClass{ptp.ClockClass52, ptp.ClockClass187} {
+		p.bestGM = "current"
+		mockStatsServer.EXPECT().UpdateCounterBy("sptp.failover", int64(1))
+		results := map[string]*RunResult{
+			"current": result(class),
+			"backup":  result(ptp.ClockClass6),
+		}
+		require.Equal(t, "backup", p.selectGM("backup", results))
+		require.Equal(t, "", p.failbackGM)
+	}
+}
@@ -17,11 +17,41 @@ limitations under the License.
 package client
 
 import (
+	"context"
+	"errors"
 	"sync"
 
 	gmstats "github.com/facebook/time/ptp/sptp/stats"
 )
 
+// per GM counters are kept as sptp.gm.<server>.<outcome>
+const gmCounterPrefix = "sptp.gm."
+
+// outcomes of the exchanges with a GM
+const (
+	outcomeMeasurement     = "measured"
+	outcomeAnnounceTimeout = "announce_timeout"
+	outcomeError           = "error"
+)
+
+// gmCounter returns the key of the per GM counter
+func gmCounter(server, name string) string {
+	return gmCounterPrefix + server + "." + name
+}
+
+// resultOutcome returns the outcome of the exchange with a GM. Timeout means no Announce and Sync
+// arrived in reply to the Delay Request in time
+func resultOutcome(r *RunResult) string {
+	switch {
+	case errors.Is(r.Error, context.DeadlineExceeded):
+		return outcomeAnnounceTimeout
+	case r.Error != nil || r.Measurement == nil:
+		return outcomeError
+	default:
+		return outcomeMeasurement
+	}
+}
+
 // StatsServer is a stats server interface
 type StatsServer interface {
 	// Reset atomically sets all the counters to 0
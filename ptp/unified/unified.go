@@ -0,0 +1,164 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package unified runs the SPTP client, the clock quality calculator and the ptp4u server in one process.
+Client steers the PHC from the upstream GMs, the calculator derives the clock quality from the client
+and applies it to the server, which serves the same PHC. All of them are monitored on the server monitoring port.
+*/
+package unified
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/facebook/time/phc"
+	"github.com/facebook/time/ptp/c4u"
+	"github.com/facebook/time/ptp/c4u/clock"
+	c4ustats "github.com/facebook/time/ptp/c4u/stats"
+	"github.com/facebook/time/ptp/ptp4u/seccomp"
+	"github.com/facebook/time/ptp/ptp4u/server"
+	"github.com/facebook/time/ptp/sptp/client"
+	"github.com/facebook/time/servo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Config of the unified daemon
+type Config struct {
+	// Client syncs the PHC from the upstream GMs
+	Client *client.Config
+	// Quality calculates the clock quality advertised by the server
+	Quality *c4u.Config
+	// QualityInterval is how often the clock quality is calculated
+	QualityInterval time.Duration
+	// QualitySample is the sliding window size (samples) of the calculation
+	QualitySample int
+}
+
+// Validate checks the client steers the PHC served by the server without taking its ports
+func (c *Config) Validate(sc *server.Config) error {
+	if c.Client.Iface != sc.Interface {
+		return fmt.Errorf("client steers the PHC of %q while the server serves %q", c.Client.Iface, sc.Interface)
+	}
+	if c.Client.Timestamping != client.HWTIMESTAMP || sc.TimestampType != client.HWTIMESTAMP {
+		return fmt.Errorf("sharing the PHC requires hardware timestamps")
+	}
+	ip := net.ParseIP(c.Client.ListenIP)
+	if ip == nil {
+		return fmt.Errorf("client listen IP is required to keep the server ports")
+	}
+	if ip.Equal(sc.IP) {
+		return fmt.Errorf("client listen IP %s is served by the server", ip)
+	}
+	for _, l := range sc.Listeners {
+		if ip.Equal(l.IP) {
+			return fmt.Errorf("client listen IP %s is served by the server", ip)
+		}
+	}
+	if c.QualityInterval <= 0 {
+		return fmt.Errorf("clock quality interval must be positive")
+	}
+	if c.QualitySample <= 0 {
+		return fmt.Errorf("clock quality sample must be positive")
+	}
+	return nil
+}
+
+// Daemon is the SPTP client, the clock quality calculator and the ptp4u server sharing the PHC and the monitoring
+type Daemon struct {
+	Config *Config
+	Server *server.Server
+
+	clientStats  *client.JSONStats
+	qualityStats *c4ustats.JSONStats
+}
+
+// dataPoint converts the client stats into the clock data of the calculator: offset from the best master
+// is the PHC offset and the servo state gives the clock class. Missing upstream is an error,
+// so the lost reference policy of the calculator applies
+func dataPoint(counters map[string]int64) (*clock.DataPoint, error) {
+	if counters["sptp.gms.available_pct"] == 0 {
+		return nil, fmt.Errorf("no upstream GM is available")
+	}
+	offset, ok := counters["sptp.offset_ns"]
+	if !ok {
+		return nil, fmt.Errorf("no offset from the upstream GM yet")
+	}
+	class := clock.ClockClassCalibrating
+	if servo.State(counters["sptp.servo.state"]) == servo.StateLocked {
+		class = clock.ClockClassLock
+	}
+	return &clock.DataPoint{
+		PHCOffset:            time.Duration(offset),
+		OscillatorClockClass: class,
+	}, nil
+}
+
+// handle serves the client and the calculator stats on the server monitoring port
+func (d *Daemon) handle() {
+	d.Server.Stats.Handle("/sptp/", http.StripPrefix("/sptp", d.clientStats.Handler()))
+	d.Server.Stats.Handle("/c4u", d.qualityStats)
+}
+
+// runQuality calculates the clock quality and applies it to the server every interval
+func (d *Daemon) runQuality() {
+	rb := clock.NewRingBuffer(d.Config.QualitySample)
+	for range time.Tick(d.Config.QualityInterval) {
+		if err := c4u.Run(d.Config.Quality, rb, d.qualityStats); err != nil {
+			log.Errorf("Failed to calculate the clock quality: %v", err)
+		}
+	}
+}
+
+// Start runs the client and the calculator and then the server
+func (d *Daemon) Start() error {
+	if err := d.Config.Validate(d.Server.Config); err != nil {
+		return err
+	}
+	d.clientStats = client.NewJSONStats()
+	if err := d.clientStats.SetBackend(d.Config.Client.MonitoringBackend, d.Config.Client.StatsD); err != nil {
+		return err
+	}
+	d.qualityStats = c4ustats.NewJSONStats()
+	d.handle()
+
+	p, err := client.NewSPTP(d.Config.Client, d.clientStats)
+	if err != nil {
+		return fmt.Errorf("initializing the client: %w", err)
+	}
+	go func() {
+		if err := p.Run(context.Background(), d.Config.Client.Interval); err != nil {
+			log.Fatalf("Client run failed: %v", err)
+		}
+	}()
+
+	d.Config.Quality.Collect = func() (*clock.DataPoint, error) {
+		return dataPoint(d.clientStats.Get())
+	}
+	d.Config.Quality.Target = d.Server
+	go d.runQuality()
+
+	// the servo steers the PHC from the client goroutine, which runs under the seccomp filter of the server
+	d.Server.SeccompProbes = append(d.Server.SeccompProbes, seccomp.Probe{Name: "servo", Run: func() error {
+		_, err := phc.FrequencyPPB(d.Config.Client.Iface)
+		return err
+	}})
+
+	return d.Server.Start()
+}
@@ -0,0 +1,84 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package unified
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/facebook/time/ptp/c4u/clock"
+	"github.com/facebook/time/ptp/ptp4u/server"
+	"github.com/facebook/time/ptp/sptp/client"
+	"github.com/facebook/time/servo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataPoint(t *testing.T) {
+	_, err := dataPoint(map[string]int64{})
+	require.Error(t, err)
+
+	_, err = dataPoint(map[string]int64{"sptp.gms.available_pct": 0, "sptp.offset_ns": 10})
+	require.Error(t, err)
+
+	_, err = dataPoint(map[string]int64{"sptp.gms.available_pct": 100})
+	require.Error(t, err)
+
+	dp, err := dataPoint(map[string]int64{"sptp.gms.available_pct": 50, "sptp.offset_ns": -42, "sptp.servo.state": int64(servo.StateLocked)})
+	require.NoError(t, err)
+	require.Equal(t, &clock.DataPoint{PHCOffset: -42 * time.Nanosecond, OscillatorClockClass: clock.ClockClassLock}, dp)
+
+	dp, err = dataPoint(map[string]int64{"sptp.gms.available_pct": 50, "sptp.offset_ns": 42, "sptp.servo.state": int64(servo.StateJump)})
+	require.NoError(t, err)
+	require.Equal(t, clock.ClockClassCalibrating, dp.OscillatorClockClass)
+}
+
+func TestConfigValidate(t *testing.T) {
+	sc := &server.Config{
+		StaticConfig: server.StaticConfig{
+			Interface:     "eth0",
+			IP:            net.ParseIP("2001:db8::1"),
+			Listeners:     []server.Listener{{Interface: "eth1", IP: net.ParseIP("2001:db8::2")}},
+			TimestampType: client.HWTIMESTAMP,
+		},
+	}
+	c := &Config{
+		Client:          &client.Config{Iface: "eth0", ListenIP: "2001:db8::3", Timestamping: client.HWTIMESTAMP},
+		QualityInterval: time.Second,
+		QualitySample:   600,
+	}
+	require.NoError(t, c.Validate(sc))
+
+	c.Client.ListenIP = "2001:db8::2"
+	require.Error(t, c.Validate(sc))
+	c.Client.ListenIP = "2001:db8::1"
+	require.Error(t, c.Validate(sc))
+	c.Client.ListenIP = ""
+	require.Error(t, c.Validate(sc))
+
+	c.Client.ListenIP = "2001:db8::3"
+	c.Client.Iface = "eth1"
+	require.Error(t, c.Validate(sc))
+
+	c.Client.Iface = "eth0"
+	c.Client.Timestamping = client.SWTIMESTAMP
+	require.Error(t, c.Validate(sc))
+
+	c.Client.Timestamping = client.HWTIMESTAMP
+	c.QualitySample = 0
+	require.Error(t, c.Validate(sc))
+}
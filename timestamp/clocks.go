@@ -0,0 +1,54 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ClockReadings are system clock readings taken back to back.
+// Comparing readings of two measurements tells steps of the system clock
+// apart from genuine changes in the measured data
+type ClockReadings struct {
+	// Wallclock is CLOCK_REALTIME, which is stepped and slewed by time daemons
+	Wallclock time.Time
+	// MonotonicRaw is CLOCK_MONOTONIC_RAW, which is never stepped nor slewed
+	MonotonicRaw time.Duration
+}
+
+// ReadClocks reads system wall clock and raw monotonic clock
+func ReadClocks() (ClockReadings, error) {
+	var mono, wall unix.Timespec
+	if err := unix.ClockGettime(monotonicRawClock, &mono); err != nil {
+		return ClockReadings{}, err
+	}
+	if err := unix.ClockGettime(unix.CLOCK_REALTIME, &wall); err != nil {
+		return ClockReadings{}, err
+	}
+	return ClockReadings{
+		Wallclock:    time.Unix(wall.Unix()),
+		MonotonicRaw: time.Duration(mono.Nano()),
+	}, nil
+}
+
+// WallclockShift returns how much further wall clock moved since the previous readings than raw monotonic clock did.
+// It's a sum of steps and slews of the system clock plus the frequency error of the raw monotonic clock
+func (r ClockReadings) WallclockShift(prev ClockReadings) time.Duration {
+	return r.Wallclock.Sub(prev.Wallclock) - (r.MonotonicRaw - prev.MonotonicRaw)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadClocks(t *testing.T) {
+	first, err := ReadClocks()
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	second, err := ReadClocks()
+	require.NoError(t, err)
+
+	require.Greater(t, second.MonotonicRaw, first.MonotonicRaw)
+	require.InDelta(t, time.Now().UnixNano(), second.Wallclock.UnixNano(), float64(time.Second))
+	require.InDelta(t, 0, second.WallclockShift(first), float64(time.Millisecond))
+}
+
+func TestWallclockShift(t *testing.T) {
+	prev := ClockReadings{Wallclock: time.Unix(1000, 0), MonotonicRaw: 10 * time.Second}
+	// system clock stepped forward by 5s while 1s passed
+	cur := ClockReadings{Wallclock: time.Unix(1006, 0), MonotonicRaw: 11 * time.Second}
+	require.Equal(t, 5*time.Second, cur.WallclockShift(prev))
+	// no step
+	cur = ClockReadings{Wallclock: time.Unix(1001, 0), MonotonicRaw: 11 * time.Second}
+	require.Equal(t, time.Duration(0), cur.WallclockShift(prev))
+}
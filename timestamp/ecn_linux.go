@@ -0,0 +1,81 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"fmt"
+	"net"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ECN codepoints of the two lowest bits of the IPv4 TOS and IPv6 traffic class
+const (
+	ECNNotECT uint8 = 0
+	ECNECT1   uint8 = 1
+	ECNECT0   uint8 = 2
+	ECNCE     uint8 = 3
+	ECNMask   uint8 = 3
+)
+
+// EnableRecvTOS enables reporting of the TOS or traffic class of received packets.
+// IPv6 sockets also report it for IPv4 packets received via v4-mapped addresses
+func EnableRecvTOS(connFd int, localAddr net.IP) error {
+	if localAddr.To4() != nil {
+		return unix.SetsockoptInt(connFd, unix.IPPROTO_IP, unix.IP_RECVTOS, 1)
+	}
+	if err := unix.SetsockoptInt(connFd, unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS, 1); err != nil {
+		return err
+	}
+	// v6only sockets don't support IPv4 options
+	_ = unix.SetsockoptInt(connFd, unix.IPPROTO_IP, unix.IP_RECVTOS, 1)
+	return nil
+}
+
+// ReadPacketWithRXTimestampTOSBuf is ReadPacketWithRXTimestampBuf which also returns the TOS or traffic class of the packet.
+// TOS is 0 if it's not reported
+func ReadPacketWithRXTimestampTOSBuf(connFd int, buf, oob []byte) (int, unix.Sockaddr, time.Time, uint8, error) {
+	bbuf, boob, _, saddr, err := unix.Recvmsg(connFd, buf, oob, 0)
+	if err != nil {
+		return 0, nil, time.Time{}, 0, fmt.Errorf("failed to read timestamp: %w", err)
+	}
+
+	timestamp, err := socketControlMessageTimestamp(oob[:boob])
+	return bbuf, saddr, timestamp, socketControlMessageTOS(oob[:boob]), err
+}
+
+// socketControlMessageTOS finds the TOS or traffic class in the socket control messages
+func socketControlMessageTOS(b []byte) uint8 {
+	mlen := 0
+	for i := 0; i+unix.SizeofCmsghdr <= len(b); i += mlen {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&b[i]))
+		if int(h.Len) < unix.SizeofCmsghdr || i+int(h.Len) > len(b) {
+			return 0
+		}
+		mlen = unix.CmsgSpace(int(h.Len) - unix.SizeofCmsghdr)
+		data := b[i+unix.CmsgLen(0) : i+int(h.Len)]
+		switch {
+		case h.Level == unix.IPPROTO_IP && h.Type == unix.IP_TOS && len(data) >= 1:
+			return data[0]
+		case h.Level == unix.IPPROTO_IPV6 && h.Type == unix.IPV6_TCLASS && len(data) >= 4:
+			return uint8(*(*int32)(unsafe.Pointer(&data[0])))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestReadPacketWithRXTimestampTOS(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		t.Run(addr, func(t *testing.T) {
+			ip := net.ParseIP(addr)
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: 0})
+			if err != nil {
+				t.Skipf("no loopback: %v", err)
+			}
+			defer conn.Close()
+			fd, err := ConnFd(conn)
+			require.NoError(t, err)
+			require.NoError(t, EnableSWTimestampsRx(fd))
+			require.NoError(t, EnableRecvTOS(fd, ip))
+			require.NoError(t, unix.SetNonblock(fd, false))
+
+			cconn, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+			require.NoError(t, err)
+			defer cconn.Close()
+			cfd, err := ConnFd(cconn)
+			require.NoError(t, err)
+			if ip.To4() != nil {
+				require.NoError(t, unix.SetsockoptInt(cfd, unix.IPPROTO_IP, unix.IP_TOS, 46<<2|int(ECNCE)))
+			} else {
+				require.NoError(t, unix.SetsockoptInt(cfd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, 46<<2|int(ECNCE)))
+			}
+			_, err = cconn.Write([]byte("ptp"))
+			require.NoError(t, err)
+
+			buf := make([]byte, PayloadSizeBytes)
+			oob := make([]byte, ControlSizeBytes)
+			n, _, ts, tos, err := ReadPacketWithRXTimestampTOSBuf(fd, buf, oob)
+			require.NoError(t, err)
+			require.Equal(t, "ptp", string(buf[:n]))
+			require.InDelta(t, time.Now().UnixNano(), ts.UnixNano(), float64(time.Second))
+			require.Equal(t, ECNCE, tos&ECNMask)
+			require.Equal(t, uint8(46), tos>>2)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// NIC identifies the NIC model
+type NIC struct {
+	// Driver name as reported by ethtool, e.g. mlx5_core
+	Driver string
+	// Firmware version as reported by ethtool
+	Firmware string
+	// Device is the PCI device ID, e.g. 0x1017. Empty for non-PCI devices
+	Device string
+}
+
+// Quirk is a fixed timestamp correction of the NIC models it matches
+type Quirk struct {
+	// Driver must match exactly
+	Driver string `yaml:"driver"`
+	// Firmware version prefix. Any firmware if empty
+	Firmware string `yaml:"firmware"`
+	// Device is the PCI device ID. Any device if empty
+	Device string `yaml:"device"`
+	// RX is the ingress latency between the reference plane and the RX timestamp point
+	RX time.Duration `yaml:"rx"`
+	// TX is the egress latency between the TX timestamp point and the reference plane
+	TX time.Duration `yaml:"tx"`
+}
+
+// matches returns how specific the quirk is for the NIC, or -1 if it doesn't match
+func (q *Quirk) matches(nic *NIC) int {
+	if q.Driver != nic.Driver {
+		return -1
+	}
+	score := 0
+	if q.Firmware != "" {
+		if !strings.HasPrefix(nic.Firmware, q.Firmware) {
+			return -1
+		}
+		score++
+	}
+	if q.Device != "" {
+		if !strings.EqualFold(q.Device, nic.Device) {
+			return -1
+		}
+		score++
+	}
+	return score
+}
+
+// Quirks is a table of NIC quirks
+type Quirks []Quirk
+
+// ReadQuirks reads the quirks table from the YAML file
+func ReadQuirks(path string) (Quirks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var q Quirks
+	if err := yaml.UnmarshalStrict(data, &q); err != nil {
+		return nil, err
+	}
+	for i := range q {
+		if q[i].Driver == "" {
+			return nil, fmt.Errorf("quirk %d: driver is required", i)
+		}
+	}
+	return q, nil
+}
+
+// Match returns the correction of the most specific quirk matching the NIC.
+// The first one wins among equally specific quirks. No correction if none matches
+func (q Quirks) Match(nic *NIC) Correction {
+	best := -1
+	var c Correction
+	for i := range q {
+		if score := q[i].matches(nic); score > best {
+			best = score
+			c = Correction{RX: q[i].RX, TX: q[i].TX}
+		}
+	}
+	return c
+}
+
+// Correction is applied to the hardware timestamps of a NIC
+type Correction struct {
+	RX time.Duration
+	TX time.Duration
+}
+
+// RXTimestamp moves the RX timestamp to the reference plane
+func (c Correction) RXTimestamp(ts time.Time) time.Time {
+	return ts.Add(-c.RX)
+}
+
+// TXTimestamp moves the TX timestamp to the reference plane
+func (c Correction) TXTimestamp(ts time.Time) time.Time {
+	return ts.Add(c.TX)
+}
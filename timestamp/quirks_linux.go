@@ -0,0 +1,61 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// sysClassNet is where the network devices are in sysfs
+var sysClassNet = "/sys/class/net"
+
+// NICInfo returns the driver, firmware and PCI device ID of the interface
+func NICInfo(iface string) (*NIC, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket for ioctl: %w", err)
+	}
+	defer unix.Close(fd)
+
+	info, err := unix.IoctlGetEthtoolDrvinfo(fd, iface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get driver info of %s: %w", iface, err)
+	}
+	nic := &NIC{
+		Driver:   unix.ByteSliceToString(info.Driver[:]),
+		Firmware: unix.ByteSliceToString(info.Fw_version[:]),
+	}
+	// virtual devices have no device ID
+	if device, err := os.ReadFile(filepath.Join(sysClassNet, iface, "device", "device")); err == nil {
+		nic.Device = strings.TrimSpace(string(device))
+	}
+	return nic, nil
+}
+
+// CorrectionFor returns the correction of the interface NIC according to the quirks
+func CorrectionFor(iface string, quirks Quirks) (Correction, *NIC, error) {
+	nic, err := NICInfo(iface)
+	if err != nil {
+		return Correction{}, nil, err
+	}
+	return quirks.Match(nic), nic, nil
+}
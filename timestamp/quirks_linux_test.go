@@ -0,0 +1,31 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNICInfoNoInterface(t *testing.T) {
+	_, err := NICInfo("lol-does-not-exist")
+	require.Error(t, err)
+
+	_, _, err = CorrectionFor("lol-does-not-exist", Quirks{{Driver: "ice"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (c) Facebook, Inc. and its affiliates.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timestamp
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuirksMatch(t *testing.T) {
+	quirks := Quirks{
+		{Driver: "mlx5_core", RX: 10 * time.Nanosecond, TX: 20 * time.Nanosecond},
+		{Driver: "mlx5_core", Firmware: "16.", RX: 30 * time.Nanosecond},
+		{Driver: "mlx5_core", Firmware: "16.", Device: "0x1017", RX: 40 * time.Nanosecond},
+		{Driver: "mlx5_core", RX: 50 * time.Nanosecond},
+	}
+	tests := []struct {
+		name string
+		nic  NIC
+		want Correction
+	}{
+		{"driver only", NIC{Driver: "mlx5_core", Firmware: "14.32.1010"}, Correction{RX: 10 * time.Nanosecond, TX: 20 * time.Nanosecond}},
+		{"firmware prefix", NIC{Driver: "mlx5_core", Firmware: "16.35.2000"}, Correction{RX: 30 * time.Nanosecond}},
+		{"device", NIC{Driver: "mlx5_core", Firmware: "16.35.2000", Device: "0x1017"}, Correction{RX: 40 * time.Nanosecond}},
+		{"device case", NIC{Driver: "mlx5_core", Firmware: "16.35.2000", Device: "0X1017"}, Correction{RX: 40 * time.Nanosecond}},
+		{"other driver", NIC{Driver: "ice"}, Correction{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, quirks.Match(&tt.nic))
+		})
+	}
+}
+
+func TestCorrection(t *testing.T) {
+	ts := time.Unix(1653574589, 0)
+	c := Correction{RX: 20 * time.Nanosecond, TX: 30 * time.Nanosecond}
+	require.Equal(t, ts.Add(-20*time.Nanosecond), c.RXTimestamp(ts))
+	require.Equal(t, ts.Add(30*time.Nanosecond), c.TXTimestamp(ts))
+
+	require.Equal(t, ts, Correction{}.RXTimestamp(ts))
+	require.Equal(t, ts, Correction{}.TXTimestamp(ts))
+}
+
+func TestReadQuirks(t *testing.T) {
+	f, err := os.CreateTemp("", "quirks")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`- driver: ice
+  device: "0x1593"
+  rx: 12ns
+  tx: 8ns
+- driver: igb
+  rx: 150ns
+`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	quirks, err := ReadQuirks(f.Name())
+	require.NoError(t, err)
+	expected := Quirks{
+		{Driver: "ice", Device: "0x1593", RX: 12 * time.Nanosecond, TX: 8 * time.Nanosecond},
+		{Driver: "igb", RX: 150 * time.Nanosecond},
+	}
+	require.Equal(t, expected, quirks)
+
+	require.NoError(t, os.WriteFile(f.Name(), []byte("- rx: 1ns\n"), 0644))
+	_, err = ReadQuirks(f.Name())
+	require.EqualError(t, err, "quirk 0: driver is required")
+
+	_, err = ReadQuirks("/does/not/exist")
+	require.Error(t, err)
+}
@@ -53,6 +53,8 @@ const (
 	HWTIMESTAMP = "hardware"
 	// SWTIMESTAMP is a software timestamp
 	SWTIMESTAMP = "software"
+	// VIRTUALTIMESTAMP is a software timestamp in a guest with the hypervisor clock exposed as a virtual PHC
+	VIRTUALTIMESTAMP = "virtual"
 )
 
 // Ifreq is a struct for ioctl ethernet manipulation syscalls.
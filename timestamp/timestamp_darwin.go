@@ -30,6 +30,8 @@ var socketControlMessageHeaderOffset = binary.Size(unix.Cmsghdr{})
 
 var timestamping = unix.SO_TIMESTAMP
 
+const monotonicRawClock = unix.CLOCK_MONOTONIC_RAW
+
 // Here we have basic HW and SW timestamping support
 
 // byteToTime converts bytes into a timestamp
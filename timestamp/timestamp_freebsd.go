@@ -30,6 +30,9 @@ var socketControlMessageHeaderOffset = binary.Size(unix.Cmsghdr{})
 
 var timestamping = unix.SO_TIMESTAMP
 
+// freebsd has no raw monotonic clock, CLOCK_MONOTONIC is the closest one
+const monotonicRawClock = unix.CLOCK_MONOTONIC
+
 // Here we have basic HW and SW timestamping support
 
 // byteToTime converts bytes into a timestamp
@@ -32,6 +32,8 @@ var socketControlMessageHeaderOffset = binary.Size(unix.Cmsghdr{})
 
 var timestamping = unix.SO_TIMESTAMPING_NEW
 
+const monotonicRawClock = unix.CLOCK_MONOTONIC_RAW
+
 func init() {
 	// if kernel is older than 5, it doesn't support unix.SO_TIMESTAMPING_NEW
 	var uname unix.Utsname
@@ -193,6 +195,12 @@ func recvoob(connFd int, oob []byte) (oobn int, err error) {
 
 // ReadTXtimestampBuf returns HW TX timestamp, needs to be provided 2 buffers which all can be re-used after ReadTXtimestampBuf finishes.
 func ReadTXtimestampBuf(connFd int, oob, toob []byte) (time.Time, int, error) {
+	return ReadTXtimestampBufDeadline(connFd, oob, toob, time.Time{})
+}
+
+// ReadTXtimestampBufDeadline is ReadTXtimestampBuf which stops waiting for the TX timestamp at the deadline.
+// Zero deadline waits for all the tries
+func ReadTXtimestampBufDeadline(connFd int, oob, toob []byte, deadline time.Time) (time.Time, int, error) {
 	// Accessing hw timestamp
 	var boob int
 
@@ -204,6 +212,9 @@ func ReadTXtimestampBuf(connFd int, oob, toob []byte) (time.Time, int, error) {
 	// Because we always perform at least 2 tries we start with 0 so on success we are at 1.
 	attempts := 0
 	for ; attempts < maxTXTS; attempts++ {
+		if !txfound && attempts > 0 && !deadline.IsZero() && !time.Now().Before(deadline) {
+			return time.Time{}, attempts, fmt.Errorf("no TX timestamp found before the deadline after %d tries", attempts)
+		}
 		if !txfound {
 			// Wait for the poll event, ignore the error
 			_ = waitForHWTS(connFd)
@@ -74,6 +74,33 @@ func Test_ReadTXtimestamp(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func Test_ReadTXtimestampBufDeadline(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.Nil(t, err)
+	defer conn.Close()
+
+	connFd, err := ConnFd(conn)
+	require.Nil(t, err)
+
+	err = EnableSWTimestamps(connFd)
+	require.Nil(t, err)
+
+	oob := make([]byte, ControlSizeBytes)
+	toob := make([]byte, ControlSizeBytes)
+	txts, attempts, err := ReadTXtimestampBufDeadline(connFd, oob, toob, time.Now())
+	require.Equal(t, time.Time{}, txts)
+	require.Equal(t, 1, attempts)
+	require.Equal(t, fmt.Errorf("no TX timestamp found before the deadline after 1 tries"), err)
+
+	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}
+	_, err = conn.WriteTo([]byte{}, addr)
+	require.Nil(t, err)
+	txts, attempts, err = ReadTXtimestampBufDeadline(connFd, oob, toob, time.Now().Add(time.Second))
+	require.NotEqual(t, time.Time{}, txts)
+	require.Equal(t, 1, attempts)
+	require.Nil(t, err)
+}
+
 func Test_scmDataToTime(t *testing.T) {
 	hwData := []byte{
 		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,